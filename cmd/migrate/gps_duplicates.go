@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// gpsDuplicate summarizes the duplicate fixes of one vehicle: fixes sharing
+// a timestamp with an earlier stored fix of the same vehicle
+type gpsDuplicate struct {
+	VehicleID string
+	Rows      int64
+	From, To  time.Time
+}
+
+// findGPSDuplicates returns the vehicles with duplicate GPS fixes, most
+// duplicates first
+func findGPSDuplicates(ctx context.Context, db *sql.DB) ([]gpsDuplicate, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT vehicle_id, SUM(copies - 1), MIN(timestamp), MAX(timestamp)
+		FROM (
+			SELECT vehicle_id, timestamp, COUNT(*) AS copies
+			FROM gps_tracks
+			GROUP BY vehicle_id, timestamp
+			HAVING COUNT(*) > 1
+		) duplicated
+		GROUP BY vehicle_id
+		ORDER BY 2 DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var duplicates []gpsDuplicate
+	for rows.Next() {
+		var d gpsDuplicate
+		if err := rows.Scan(&d.VehicleID, &d.Rows, &d.From, &d.To); err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, d)
+	}
+	return duplicates, rows.Err()
+}
+
+// deleteGPSDuplicates deletes the duplicate fixes of a vehicle, keeping the
+// first stored fix of each timestamp, and returns how many were deleted
+func deleteGPSDuplicates(ctx context.Context, db *sql.DB, vehicleID string) (int64, error) {
+	result, err := db.ExecContext(ctx, `
+		DELETE FROM gps_tracks
+		WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (
+					PARTITION BY timestamp ORDER BY created_at NULLS LAST, id
+				) AS copy
+				FROM gps_tracks
+				WHERE vehicle_id = $1
+			) ranked
+			WHERE copy > 1
+		)`, vehicleID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// dedupeGPSTracks reports the duplicate GPS fixes that keep migration 024
+// from building its unique index and, when apply is set, deletes them one
+// vehicle at a time so ingestion is not blocked
+func dedupeGPSTracks(ctx context.Context, db *sql.DB, apply bool) error {
+	duplicates, err := findGPSDuplicates(ctx, db)
+	if err != nil {
+		return err
+	}
+	if len(duplicates) == 0 {
+		fmt.Println("✅ No duplicate GPS fixes")
+		return nil
+	}
+
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VEHICLE\tDUPLICATES\tFIRST\tLAST")
+	for _, d := range duplicates {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", d.VehicleID, d.Rows,
+			d.From.UTC().Format(time.RFC3339), d.To.UTC().Format(time.RFC3339))
+		total += d.Rows
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !apply {
+		fmt.Printf("⚠️  %d duplicate GPS fixes of %d vehicles; run 'migrate dedupe-gps-tracks apply' to delete them\n", total, len(duplicates))
+		return nil
+	}
+
+	var deleted int64
+	for _, d := range duplicates {
+		n, err := deleteGPSDuplicates(ctx, db, d.VehicleID)
+		if err != nil {
+			return fmt.Errorf("failed to delete duplicate GPS fixes of vehicle %s: %w", d.VehicleID, err)
+		}
+		deleted += n
+	}
+	fmt.Printf("🎉 %d duplicate GPS fixes deleted, the first stored fix of each timestamp was kept\n", deleted)
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/config"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/database"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/migrate"
+)
+
+func main() {
+	// Command line flags
+	cfg := config.Load()
+	dir := flag.String("dir", cfg.MigrationsDir, "Directory containing the migration scripts")
+	databaseURL := flag.String("database", cfg.DatabaseURL, "PostgreSQL connection URL")
+	timeout := flag.Duration("timeout", 30*time.Minute, "Maximum time to wait for the lock and run the migrations")
+	help := flag.Bool("help", false, "Show help message")
+
+	flag.Usage = showHelp
+	flag.Parse()
+
+	if *help || flag.NArg() == 0 {
+		showHelp()
+		return
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	// create only touches the migrations directory
+	if command == "create" {
+		if len(args) != 1 {
+			log.Fatal("❌ Usage: migrate create NAME")
+		}
+		upPath, downPath, err := migrate.Create(*dir, args[0])
+		if err != nil {
+			log.Fatalf("❌ Failed to create migration: %v", err)
+		}
+		fmt.Printf("📝 Created %s\n📝 Created %s\n", upPath, downPath)
+		return
+	}
+
+	db, err := database.Connect(*databaseURL)
+	if err != nil {
+		log.Fatalf("❌ Failed to connect to database: %v", err)
+	}
+	defer database.Close(db)
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("❌ Failed to get database connection: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	migrator := migrate.New(sqlDB, *dir)
+
+	switch command {
+	case "status":
+		err = printStatus(ctx, migrator, *dir)
+
+	case "up":
+		var n int
+		if n, err = countArg(args, 0); err == nil {
+			var applied []*migrate.Migration
+			applied, err = migrator.Up(ctx, n)
+			if err == nil {
+				fmt.Printf("🎉 %d migrations applied\n", len(applied))
+			}
+		}
+
+	case "down":
+		var n int
+		if n, err = countArg(args, 1); err == nil {
+			var reverted []*migrate.Migration
+			reverted, err = migrator.Down(ctx, n)
+			if err == nil {
+				fmt.Printf("🎉 %d migrations rolled back\n", len(reverted))
+			}
+		}
+
+	case "baseline":
+		if len(args) != 1 {
+			log.Fatal("❌ Usage: migrate baseline VERSION")
+		}
+		var version int64
+		if version, err = strconv.ParseInt(args[0], 10, 64); err == nil {
+			var recorded []*migrate.Migration
+			recorded, err = migrator.Baseline(ctx, version)
+			if err == nil {
+				fmt.Printf("🎉 %d migrations recorded as applied\n", len(recorded))
+			}
+		}
+
+	case "dedupe-gps-tracks":
+		if len(args) > 1 || (len(args) == 1 && args[0] != "apply") {
+			log.Fatal("❌ Usage: migrate dedupe-gps-tracks [apply]")
+		}
+		err = dedupeGPSTracks(ctx, sqlDB, len(args) == 1)
+
+	default:
+		showHelp()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		if errors.Is(err, migrate.ErrDrift) {
+			log.Printf("💡 Run 'migrate status' to see which migrations differ")
+		}
+		log.Fatalf("❌ %s failed: %v", command, err)
+	}
+}
+
+// printStatus prints the state of every migration and any gaps in the numbering
+func printStatus(ctx context.Context, migrator *migrate.Migrator, dir string) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "-"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	migrations, err := migrate.Load(dir)
+	if err != nil {
+		return err
+	}
+	for _, version := range migrate.Gaps(migrations) {
+		fmt.Printf("⚠️  No migration with version %03d\n", version)
+	}
+	return nil
+}
+
+// countArg parses the optional migration count argument
+func countArg(args []string, defaultValue int) (int, error) {
+	if len(args) == 0 {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number of migrations %q", args[0])
+	}
+	return n, nil
+}
+
+func showHelp() {
+	help := `
+FleetTracker Pro Database Migrations
+
+Usage:
+  go run cmd/migrate/main.go [flags] COMMAND [ARGS]
+
+Commands:
+  status             Show applied, pending, modified and missing migrations
+  up [N]             Apply the next N pending migrations (all when omitted)
+  down [N]           Roll back the last N applied migrations (default 1)
+  create NAME        Create empty up/down scripts numbered after the latest one
+  baseline VERSION   Record migrations up to VERSION as applied without running
+                     them, for databases created with psql before this tool
+  dedupe-gps-tracks [apply]
+                     Report GPS fixes sharing a vehicle and timestamp, which
+                     keep migration 024 from building its unique index; with
+                     'apply', delete them, keeping the first stored fix
+
+Flags:
+  --dir DIR          Migration scripts directory (default $MIGRATIONS_DIR or migrations)
+  --database URL     Database URL (default $DATABASE_URL)
+  --timeout DURATION Maximum time to wait for the lock and run (default 30m)
+  --help             Show this help message
+
+Applied migrations are recorded in the schema_versions table. Runs hold a
+PostgreSQL advisory lock, so concurrent runs (e.g. several servers with
+MIGRATE_ON_STARTUP=true) apply each migration once. 'up' refuses to run when
+an applied script was modified or deleted, or when a pending migration is
+older than the latest applied one.
+
+Scripts containing CONCURRENTLY, or the line '-- migrate:no-transaction', run
+statement by statement outside a transaction; keep them idempotent.
+
+Using Make commands:
+  make migrate-up              # Apply all pending migrations
+  make migrate-down            # Roll back the last migration
+  make migrate-status          # Show migration status
+  make migrate-create NAME=... # Create a new migration
+  make gps-dedupe [APPLY=1]    # Report (or delete) duplicate GPS fixes
+`
+	fmt.Println(help)
+}
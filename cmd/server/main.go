@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"net/mail"
 	"os"
 	"os/signal"
 	"syscall"
@@ -22,16 +23,25 @@ import (
 	advancedanalytics "github.com/tobangado69/fleettracker-pro/backend/internal/common/analytics"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/config"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/database"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/email"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/export"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/fleet"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/geofencing"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/health"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/jobs"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/logging"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/mapmatch"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/notification"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/ratelimit"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/storage"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/realtime"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/reports"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/repository"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/device"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/driver"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/gateway"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/payment"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/tracking"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/vehicle"
@@ -126,11 +136,16 @@ func main() {
 	defer redisClient.Close()
 	logger.Info("✅ Redis connected successfully")
 
-	// Database migrations are handled via SQL migration files
-	// See migrations/ directory and use: make migrate-up
-	// AutoMigrate disabled to avoid UUID default syntax issues
-	logger.Info("⏭️  Skipping AutoMigrate - use 'make migrate-up' to run migrations")
-	logger.Info("💡 Note: Database schema is managed via SQL migrations in migrations/ directory")
+	// Database schema is managed via SQL migration files in migrations/
+	// Apply them with: make migrate-up (or MIGRATE_ON_STARTUP=true)
+	if cfg.MigrateOnStartup {
+		if err := database.AutoMigrate(db, cfg.MigrationsDir); err != nil {
+			logger.Error("Failed to run database migrations", "error", err)
+			log.Fatal("Failed to run database migrations:", err)
+		}
+	} else {
+		logger.Info("⏭️  Skipping migrations - use 'make migrate-up' or MIGRATE_ON_STARTUP=true to apply them")
+	}
 
 	// Initialize repository manager
 	repoManager := repository.NewRepositoryManager(db)
@@ -161,6 +176,9 @@ func main() {
 	
 	logger.Info("✅ Logging middleware initialized")
 
+	// Standardized error responses for handlers that abort with an AppError
+	r.Use(middleware.ErrorHandler())
+
 	// CORS configuration for Indonesian domains
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.CORSAllowedOrigins,
@@ -192,40 +210,261 @@ func main() {
 	// Initialize export service with caching
 	exportCacheService := export.NewExportCacheService(redisClient)
 	exportService := export.NewExportService(db, exportCacheService)
+	reportService := reports.NewService(db)
 	
 	// Initialize job processing system
 	log.Println("Initializing job processing system...")
 	jobManager := jobs.NewManager(db, redisClient, jobs.DefaultManagerConfig())
-	
-	// Start job manager (workers and scheduler)
-	if err := jobManager.Start(); err != nil {
-		log.Fatal("Failed to start job manager:", err)
+
+	// Exports are streamed to blob storage by background jobs
+	exportStore, err := storage.New(storage.Config{
+		Driver:      cfg.ExportStorageDriver,
+		Dir:         cfg.ExportStorageDir,
+		PublicURL:   cfg.ExportPublicURL,
+		Secret:      cfg.ExportLinkSecret,
+		S3Endpoint:  cfg.ExportS3Endpoint,
+		S3Region:    cfg.ExportS3Region,
+		S3Bucket:    cfg.ExportS3Bucket,
+		S3AccessKey: cfg.ExportS3AccessKey,
+		S3SecretKey: cfg.ExportS3SecretKey,
+		S3PathStyle: cfg.ExportS3PathStyle,
+	})
+	if err != nil {
+		log.Printf("Data exports and reports disabled: %v", err)
+	} else {
+		exportService.SetStorage(exportStore, cfg.ExportLinkTTL, cfg.ExportRetention)
+		exportService.SetQueue(jobManager)
+		reportService.SetStorage(exportStore)
+		reportService.SetQueue(jobManager)
 	}
 	log.Println("✅ Export service with caching initialized successfully")
 
 	// Initialize services
 	authService := auth.NewService(db, redisClient, cfg.JWTSecret)
+	if cfg.TwoFactorEncryptionKey == "" {
+		log.Println("Warning: TWO_FACTOR_ENCRYPTION_KEY is not set, two-factor enrolment is disabled")
+	}
+	authService.SetTwoFactorKeys(cfg.TwoFactorEncryptionKeyID, cfg.TwoFactorEncryptionKey, cfg.TwoFactorPreviousKeys)
 	trackingService := tracking.NewService(db, redisClient)
+	trackingService.ConfigureWebSocket(realtime.NewSessionAuthenticator(db, redisClient, cfg.JWTSecret), cfg.WebSocketAllowedOrigins)
+	trackingService.SetOfflineThreshold(cfg.VehicleOfflineThreshold)
+	trackingService.SetTripDetectionSettings(tracking.TripDetectionSettings{IdleTimeout: cfg.TripIdleTimeout, MaxGap: cfg.TripMaxGPSGap})
+	trackingService.SetDefaultBehaviorRules(tracking.DefaultBehaviorRules(cfg.DefaultSpeedLimit, cfg.HighwaySpeedLimit, cfg.HarshBrakingThreshold, cfg.RapidAccelerationThreshold))
+	var roadGraph *mapmatch.Graph
+	if cfg.MapGraphPath != "" {
+		// Routes, trip distances and speeding follow the roads driven
+		graph, err := mapmatch.LoadGraph(cfg.MapGraphPath)
+		if err != nil {
+			log.Printf("Map matching disabled: %v", err)
+		} else {
+			roadGraph = graph
+			trackingService.SetMapMatcher(mapmatch.NewMatcher(graph, mapmatch.DefaultOptions()))
+			log.Printf("✅ Road network loaded for map matching (%d nodes, %d edges)", graph.NodeCount(), graph.EdgeCount())
+		}
+	}
 	vehicleService := vehicle.NewService(db, redisClient)
 	vehicleHistoryService := vehicle.NewVehicleHistoryService(db, repoManager)
 	driverService := driver.NewService(db, redisClient)
+	deviceService := device.NewService(db)
 	paymentService := payment.NewService(db, redisClient, cfg, repoManager)
 	analyticsService := analytics.NewService(db, redisClient, repoManager)
+	exportService.SetReportSource(analyticsService.BuildReport)
+
+	// Reports are generated by background jobs and kept in the export store.
+	// Reports and notifications show times in the default timezone.
+	location, err := time.LoadLocation(cfg.DefaultTimezone)
+	if err != nil {
+		log.Printf("Unknown timezone %s for reports and notifications, using Asia/Jakarta: %v", cfg.DefaultTimezone, err)
+	}
+	reportService.SetLocation(location)
+	analyticsService.RegisterReports(reportService)
+	reportService.SetScheduler(jobManager)
+	reportService.SetAlerter(trackingService.GetAlertSystem())
+
+	// Emails are recorded and delivered by background jobs, retrying
+	// temporary failures
+	emailSender, err := email.New(email.Config{
+		Driver:       cfg.EmailDriver,
+		Dir:          cfg.EmailDir,
+		SMTPHost:     cfg.SMTPHost,
+		SMTPPort:     cfg.SMTPPort,
+		SMTPUsername: cfg.SMTPUsername,
+		SMTPPassword: cfg.SMTPPassword,
+	})
+	if err != nil {
+		log.Printf("Email delivery disabled: %v", err)
+	} else {
+		from := (&mail.Address{Name: cfg.SMTPFromName, Address: cfg.SMTPFromAddress}).String()
+		emailService := email.NewService(db, emailSender, from)
+		emailService.SetQueue(jobManager)
+		jobManager.RegisterHandler(jobs.NewEmailNotificationJob(emailService))
+		authService.SetMailer(emailService, cfg.AppURL)
+		reportService.SetMailer(emailService)
+	}
+
+	// WhatsApp and SMS notifications are recorded and delivered by background
+	// jobs; high and critical alerts are sent to supervisors and drivers
+	var notificationChannels []notification.Channel
+	if cfg.WhatsAppAccessToken != "" {
+		whatsApp, err := notification.NewWhatsAppChannel(notification.WhatsAppConfig{
+			APIURL:        cfg.WhatsAppAPIURL,
+			AccessToken:   cfg.WhatsAppAccessToken,
+			PhoneNumberID: cfg.WhatsAppPhoneNumberID,
+			AppSecret:     cfg.WhatsAppAppSecret,
+			VerifyToken:   cfg.WhatsAppVerifyToken,
+		})
+		if err != nil {
+			log.Printf("WhatsApp notifications disabled: %v", err)
+		} else {
+			notificationChannels = append(notificationChannels, whatsApp)
+		}
+	}
+	if cfg.SMSAPIKey != "" {
+		sms, err := notification.NewSMSChannel(notification.SMSConfig{
+			APIURL:        cfg.SMSAPIURL,
+			APIKey:        cfg.SMSAPIKey,
+			SenderID:      cfg.SMSSenderID,
+			WebhookSecret: cfg.SMSWebhookSecret,
+		})
+		if err != nil {
+			log.Printf("SMS notifications disabled: %v", err)
+		} else {
+			notificationChannels = append(notificationChannels, sms)
+		}
+	}
+	var notificationService *notification.Service
+	if len(notificationChannels) == 0 {
+		log.Printf("WhatsApp and SMS notifications disabled: no channel configured")
+	} else {
+		notificationService = notification.NewService(db, notificationChannels...)
+		notificationService.SetQueue(jobManager)
+		notificationService.SetLocation(location)
+		jobManager.RegisterHandler(jobs.NewNotificationDeliveryJob(notificationService))
+		trackingService.GetAlertSystem().SetNotifier(notificationService)
+	}
+
+	// Notify dashboards when gateway webhooks settle a payment
+	paymentService.SetAlerter(trackingService.GetAlertSystem())
+
+	// Register domain job handlers before the workers start
+	jobManager.RegisterHandler(payment.NewPaymentExpiryJob(paymentService))
+	jobManager.RegisterHandler(payment.NewSubscriptionRenewalJob(paymentService))
+	jobManager.RegisterHandler(tracking.NewVehicleOfflineJob(trackingService))
+	jobManager.RegisterHandler(tracking.NewTripCloseJob(trackingService))
+	jobManager.RegisterHandler(jobs.NewDataExportJob(db, exportService))
+	jobManager.RegisterHandler(jobs.NewExportCleanupJob(exportService))
+	jobManager.RegisterHandler(jobs.NewReportGenerationJob(db, reportService))
+	jobManager.RegisterHandler(jobs.NewReportSubscriptionJob(reportService))
+
+	// Start job manager (workers and scheduler)
+	if err := jobManager.Start(); err != nil {
+		log.Fatal("Failed to start job manager:", err)
+	}
+
+	// Expire unpaid QRIS, virtual account and e-wallet charges
+	if err := jobManager.AddScheduledJob(&jobs.ScheduledJob{
+		ID:       "system_payment_expiry",
+		Name:     "Pending Payment Expiry",
+		JobType:  "payment_expiry",
+		Schedule: "*/5 * * * *",
+		Priority: jobs.JobPriorityNormal,
+		IsActive: true,
+	}); err != nil {
+		log.Printf("Failed to schedule payment expiry: %v", err)
+	}
+
+	// Renew and invoice subscriptions reaching the end of their period
+	if err := jobManager.AddScheduledJob(&jobs.ScheduledJob{
+		ID:       "system_subscription_renewal",
+		Name:     "Subscription Renewal",
+		JobType:  "subscription_renewal",
+		Schedule: "0 * * * *",
+		Priority: jobs.JobPriorityNormal,
+		IsActive: true,
+	}); err != nil {
+		log.Printf("Failed to schedule subscription renewal: %v", err)
+	}
+
+	// Mark vehicles that stopped reporting as offline and alert dispatchers
+	if err := jobManager.AddScheduledJob(&jobs.ScheduledJob{
+		ID:       "system_vehicle_offline_check",
+		Name:     "Vehicle Offline Watchdog",
+		JobType:  "vehicle_offline_check",
+		Schedule: "* * * * *",
+		Priority: jobs.JobPriorityHigh,
+		IsActive: true,
+	}); err != nil {
+		log.Printf("Failed to schedule vehicle offline check: %v", err)
+	}
+
+	// Complete detected trips of vehicles that stopped reporting mid-trip
+	if err := jobManager.AddScheduledJob(&jobs.ScheduledJob{
+		ID:       "system_trip_auto_close",
+		Name:     "Detected Trip Auto Close",
+		JobType:  "trip_auto_close",
+		Schedule: "*/5 * * * *",
+		Priority: jobs.JobPriorityNormal,
+		IsActive: true,
+	}); err != nil {
+		log.Printf("Failed to schedule trip auto close: %v", err)
+	}
+
+	// Delete export files once their retention ends
+	if err := jobManager.AddScheduledJob(&jobs.ScheduledJob{
+		ID:       "system_export_cleanup",
+		Name:     "Expired Export Cleanup",
+		JobType:  "export_cleanup",
+		Schedule: "0 * * * *",
+		Priority: jobs.JobPriorityLow,
+		IsActive: true,
+	}); err != nil {
+		log.Printf("Failed to schedule export cleanup: %v", err)
+	}
+
+	// Follow the report subscriptions stored in the database
+	if scheduled, err := reportService.ScheduleSubscriptions(context.Background()); err != nil {
+		log.Printf("Failed to schedule report subscriptions: %v", err)
+	} else {
+		log.Printf("Scheduled %d report subscriptions", scheduled)
+	}
 	
 	// Initialize fleet management system
 	fleetManager := fleet.NewFleetManager(db, redisClient)
+	if roadGraph != nil {
+		// Route optimization drives the road network at time-of-day speeds
+		timezone, err := time.LoadLocation(cfg.DefaultTimezone)
+		if err != nil {
+			log.Printf("Unknown timezone %s for route speed profiles, using UTC: %v", cfg.DefaultTimezone, err)
+			timezone = time.UTC
+		}
+		fleetManager.SetDistanceMatrixProvider(fleet.NewRoadGraphProvider(roadGraph, fleet.JakartaSpeedProfile(timezone)))
+	}
 	fleetAPI := fleet.NewFleetAPI(fleetManager)
 	log.Println("✅ Advanced Fleet Management system initialized successfully")
 	
 	// Initialize geofencing system
-	geofenceManager := geofencing.NewGeofenceManager(db, redisClient)
+	geofenceManager := trackingService.GetGeofenceManager()
 	geofenceAPI := geofencing.NewGeofenceAPI(geofenceManager)
 	geofenceMonitor := geofencing.NewGeofenceMonitor(db, redisClient, geofenceManager)
+	geofenceMonitor.SetBroadcaster(trackingService.GetAnalyticsBroadcaster())
+	trackingService.SetGeofenceMonitor(geofenceMonitor)
 	
 	// Start geofence monitoring
 	geofenceMonitor.StartMonitoring(context.Background(), nil)
 	log.Println("✅ Advanced Geofencing Management system initialized successfully")
 	
+	// Start the TCP gateway for hardwired GPS trackers
+	var trackerGateway *gateway.Server
+	if cfg.TrackerGatewayAddr != "" {
+		trackerGateway = gateway.NewServer(cfg.TrackerGatewayAddr, deviceService, trackingService)
+		trackerGateway.SetIdleTimeout(cfg.TrackerGatewayIdleTimeout)
+		if err := trackerGateway.Start(); err != nil {
+			logger.Error("Failed to start tracker gateway", "error", err)
+			log.Fatal("Failed to start tracker gateway:", err)
+		}
+		logger.Info("✅ Tracker gateway listening", "addr", trackerGateway.Addr().String())
+	}
+	
 	// Initialize advanced analytics system
 	analyticsEngine := advancedanalytics.NewAnalyticsEngine(db, redisClient)
 	analyticsAPI := advancedanalytics.NewAnalyticsAPI(analyticsEngine)
@@ -234,14 +473,18 @@ func main() {
 	// Initialize handlers
 	authHandler := auth.NewHandler(authService)
 	trackingHandler := tracking.NewHandler(trackingService)
+	trackingHandler.SetReportService(reportService)
 	vehicleHandler := vehicle.NewHandler(vehicleService)
 	vehicleHistoryHandler := vehicle.NewVehicleHistoryHandler(vehicleHistoryService)
 	driverHandler := driver.NewHandler(driverService)
+	deviceHandler := device.NewHandler(deviceService)
 	paymentHandler := payment.NewHandler(paymentService)
 	analyticsHandler := analytics.NewHandler(analyticsService)
+	analyticsHandler.SetExportService(exportService)
+	analyticsHandler.SetReportService(reportService)
 
 	// Setup routes
-	setupRoutes(r, authHandler, trackingHandler, vehicleHandler, vehicleHistoryHandler, driverHandler, paymentHandler, analyticsHandler, fleetAPI, geofenceAPI, analyticsAPI, cfg, db, repoManager, rateLimitManager, rateLimitMonitor, jobManager, exportService)
+	setupRoutes(r, authHandler, trackingHandler, vehicleHandler, vehicleHistoryHandler, driverHandler, deviceHandler, deviceService, paymentHandler, analyticsHandler, fleetAPI, geofenceAPI, analyticsAPI, cfg, db, repoManager, rateLimitManager, rateLimitMonitor, jobManager, exportService, reportService, notificationService)
 
 	// Setup WebSocket for real-time tracking
 	setupWebSocket(r, trackingService)
@@ -278,6 +521,13 @@ func main() {
 
 	logger.Warn("🛑 Shutting down server...")
 	
+	// Stop accepting tracker data before the pipeline shuts down
+	if trackerGateway != nil {
+		logger.Info("Stopping tracker gateway...")
+		trackerGateway.Stop()
+		logger.Info("✅ Tracker gateway stopped")
+	}
+	
 	// Stop geofence monitoring
 	logger.Info("Stopping geofence monitoring...")
 	geofenceMonitor.StopMonitoring()
@@ -306,6 +556,8 @@ func setupRoutes(
 	vehicleHandler *vehicle.Handler,
 	vehicleHistoryHandler *vehicle.VehicleHistoryHandler,
 	driverHandler *driver.Handler,
+	deviceHandler *device.Handler,
+	deviceService *device.Service,
 	paymentHandler *payment.Handler,
 	analyticsHandler *analytics.Handler,
 	fleetAPI *fleet.FleetAPI,
@@ -318,6 +570,8 @@ func setupRoutes(
 	rateLimitMonitor *ratelimit.RateLimitMonitor,
 	jobManager *jobs.Manager,
 	exportService *export.ExportService,
+	reportService *reports.Service,
+	notificationService *notification.Service,
 ) {
 	// API documentation
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -330,6 +584,9 @@ func setupRoutes(
 		{
 			auth.POST("/register", authHandler.Register)
 			auth.POST("/login", authHandler.Login)
+			auth.POST("/login/2fa", authHandler.CompleteTwoFactorLogin)
+			auth.POST("/login/2fa/setup", authHandler.BeginTwoFactorEnrolment)
+			auth.POST("/login/2fa/enable", authHandler.CompleteTwoFactorEnrolment)
 			auth.POST("/refresh", authHandler.RefreshToken)
 			auth.POST("/logout", middleware.AuthRequired(cfg.JWTSecret, db), authHandler.Logout)
 			auth.GET("/profile", middleware.AuthRequired(cfg.JWTSecret, db), authHandler.GetProfile)
@@ -337,6 +594,36 @@ func setupRoutes(
 			auth.PUT("/change-password", middleware.AuthRequired(cfg.JWTSecret, db), authHandler.ChangePassword)
 			auth.POST("/forgot-password", authHandler.ForgotPassword)
 			auth.POST("/reset-password", authHandler.ResetPassword)
+
+			// Two-factor authentication
+			twoFactor := auth.Group("/2fa", middleware.AuthRequired(cfg.JWTSecret, db))
+			{
+				twoFactor.GET("", authHandler.GetTwoFactorStatus)
+				twoFactor.POST("/setup", authHandler.SetupTwoFactor)
+				twoFactor.POST("/enable", authHandler.EnableTwoFactor)
+				twoFactor.POST("/disable", authHandler.DisableTwoFactor)
+				twoFactor.POST("/recovery-codes", authHandler.RegenerateRecoveryCodes)
+				twoFactor.PUT("/policy", authHandler.SetTwoFactorPolicy) // owner/admin only
+			}
+		}
+
+		// Payment gateway notifications (authenticated by signature, not JWT)
+		webhooks := v1.Group("/payments/webhooks")
+		{
+			webhooks.POST("/:provider", paymentHandler.HandleWebhook)
+		}
+
+		// WhatsApp and SMS delivery reports (authenticated by signature, not JWT)
+		var notificationAPI *notification.NotificationAPI
+		if notificationService != nil {
+			notificationAPI = notification.NewNotificationAPI(notificationService)
+			notification.SetupWebhookRoutes(v1, notificationAPI)
+		}
+
+		// Device ingestion (authenticated by device API key, not JWT)
+		deviceIngest := v1.Group("/device", device.AuthRequired(deviceService))
+		{
+			deviceIngest.POST("/gps", trackingHandler.ProcessDeviceGPSBatch) // Submit GPS data as a device
 		}
 
 		// Protected routes
@@ -400,14 +687,41 @@ func setupRoutes(
 				drivers.GET("/:id/trips", driverHandler.GetDriverTrips)
 			}
 
+			// Device registry
+			devices := protected.Group("/devices")
+			{
+				devices.GET("", deviceHandler.ListDevices)                  // List devices with filters
+				devices.GET("/:id", deviceHandler.GetDevice)                // Get device details
+				devices.GET("/:id/bindings", deviceHandler.GetBindingHistory) // Get vehicle binding history
+
+				deviceAdmin := devices.Group("", middleware.RoleRequired("super-admin", "owner", "admin"))
+				{
+					deviceAdmin.POST("", deviceHandler.CreateDevice)                // Register device
+					deviceAdmin.PUT("/:id", deviceHandler.UpdateDevice)             // Update device
+					deviceAdmin.DELETE("/:id", deviceHandler.DeleteDevice)          // Delete device
+					deviceAdmin.POST("/:id/bind", deviceHandler.BindDevice)         // Bind device to vehicle
+					deviceAdmin.POST("/:id/unbind", deviceHandler.UnbindDevice)     // Unbind device from vehicle
+					deviceAdmin.POST("/:id/rotate-key", deviceHandler.RotateAPIKey) // Issue new device API key
+				}
+			}
+
 			// GPS tracking
 			tracking := protected.Group("/tracking")
 			{
 				// GPS Data Management
 				tracking.POST("/gps", trackingHandler.ProcessGPSData)                    // Submit GPS data
+				tracking.POST("/gps/batch", trackingHandler.ProcessGPSBatch)             // Submit buffered GPS data
 				tracking.GET("/vehicles/:id/current", trackingHandler.GetCurrentLocation) // Get current location
 				tracking.GET("/vehicles/:id/history", trackingHandler.GetLocationHistory) // Get location history
 				tracking.GET("/vehicles/:id/route", trackingHandler.GetRoute)            // Get route data
+				tracking.GET("/vehicles/offline", trackingHandler.GetOfflineVehicles)    // Vehicles that stopped reporting
+				tracking.PUT("/vehicles/offline/threshold", middleware.RoleRequired("super-admin", "owner", "admin"), trackingHandler.SetOfflineThreshold) // Company offline threshold
+
+				// Driver Behavior Rules
+				tracking.GET("/behavior-rules", trackingHandler.GetBehaviorRules)                                                                      // Rule sets per vehicle type
+				tracking.PUT("/behavior-rules", middleware.RoleRequired("super-admin", "owner", "admin"), trackingHandler.SaveBehaviorRules)            // Create or replace a rule set
+				tracking.DELETE("/behavior-rules/:id", middleware.RoleRequired("super-admin", "owner", "admin"), trackingHandler.DeleteBehaviorRules)   // Delete a rule set
+				tracking.POST("/behavior-rules/dry-run", middleware.RoleRequired("super-admin", "owner", "admin"), trackingHandler.DryRunBehaviorRules) // Replay tracks against a draft
 				
 				// Driver Event Management
 				tracking.POST("/events", trackingHandler.ProcessDriverEvent)             // Submit driver event
@@ -425,6 +739,7 @@ func setupRoutes(
 				
 				// WebSocket for real-time tracking
 				tracking.GET("/ws/:vehicle_id", trackingHandler.HandleWebSocket)         // WebSocket connection
+				tracking.POST("/ws/ticket", trackingHandler.CreateWebSocketTicket)      // Single-use WebSocket ticket
 				
 				// Analytics and Reporting
 				tracking.GET("/dashboard/stats", trackingHandler.GetDashboardStats)     // Dashboard statistics
@@ -442,14 +757,21 @@ func setupRoutes(
 				payments.POST("/invoices/:id/confirm", paymentHandler.ConfirmPayment)        // Confirm payment
 				payments.GET("/invoices", paymentHandler.GetInvoices)                        // List invoices
 				payments.GET("/invoices/:id/instructions", paymentHandler.GetPaymentInstructions) // Get payment instructions
+				payments.GET("/invoices/:id/pdf", paymentHandler.DownloadInvoicePDF)          // Download invoice PDF
 				payments.POST("/subscriptions/billing", paymentHandler.GenerateSubscriptionBilling) // Generate subscription billing
 				
 				// Legacy endpoints (not implemented for manual bank transfer)
 				payments.POST("/qris", paymentHandler.CreateQRISPayment)
 				payments.POST("/bank-transfer", paymentHandler.CreateBankTransfer)
 				payments.POST("/e-wallet", paymentHandler.CreateEWalletPayment)
+
+				// Subscription lifecycle
+				payments.GET("/plans", paymentHandler.GetPlans)
+				payments.GET("/usage", paymentHandler.GetPlanUsage)
 				payments.GET("/subscriptions", paymentHandler.GetSubscriptions)
 				payments.POST("/subscriptions", paymentHandler.CreateSubscription)
+				payments.POST("/subscriptions/:id/change-plan", paymentHandler.ChangeSubscriptionPlan)
+				payments.POST("/subscriptions/:id/cancel", paymentHandler.CancelSubscription)
 			}
 
 		// User Management (admin-only endpoints)
@@ -497,14 +819,17 @@ func setupRoutes(
 			analytics.GET("/reports/export/:id", analyticsHandler.ExportReport)
 		}
 
+		// Plan entitlements for tier-restricted features
+		entitlements := entitlement.NewService(db)
+
 		// Fleet Management System
-		fleet.SetupFleetRoutes(protected, fleetAPI)
+		fleet.SetupFleetRoutes(protected.Group("", middleware.FeatureRequired(entitlements, entitlement.FeatureFleetManagement)), fleetAPI)
 
 		// Geofencing Management System
 		geofencing.SetupGeofenceRoutes(protected, geofenceAPI)
 		
 		// Advanced Analytics System
-		advancedanalytics.SetupAnalyticsRoutes(protected, analyticsAPI)
+		advancedanalytics.SetupAnalyticsRoutes(protected.Group("", middleware.FeatureRequired(entitlements, entitlement.FeatureAdvancedAnalytics)), analyticsAPI)
 
 			// Repository health check (admin only)
 			repo := protected.Group("/repository")
@@ -559,7 +884,18 @@ func setupRoutes(
 		
 		// Export endpoints (authenticated users)
 		exportAPI := export.NewExportAPI(exportService)
-		export.SetupExportRoutes(v1, exportAPI)
+		export.SetupExportRoutes(protected, exportAPI)
+
+		// Generated reports and recurring report subscriptions
+		reports.SetupReportRoutes(protected, reports.NewReportAPI(reportService))
+
+		// WhatsApp and SMS notification history and delivery status
+		if notificationAPI != nil {
+			notification.SetupNotificationRoutes(protected, notificationAPI)
+		}
+
+		// Export downloads are authorized by their signed link
+		export.SetupExportDownloadRoutes(v1, exportAPI)
 	}
 }
 
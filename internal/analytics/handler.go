@@ -1,8 +1,15 @@
 package analytics
 
+import (
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/export"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/reports"
+)
+
 // Handler handles analytics HTTP requests
 type Handler struct {
 	service *Service
+	exports *export.ExportService
+	reports *reports.Service
 }
 
 // NewHandler creates a new analytics handler
@@ -12,6 +19,18 @@ func NewHandler(service *Service) *Handler {
 	}
 }
 
+// SetExportService enables report exports, which are written to blob storage
+// by background jobs
+func (h *Handler) SetExportService(exports *export.ExportService) {
+	h.exports = exports
+}
+
+// SetReportService enables generated reports, which are kept in blob storage
+// by background jobs
+func (h *Handler) SetReportService(reportService *reports.Service) {
+	h.reports = reportService
+}
+
 // SuccessResponse represents a successful API response
 type SuccessResponse struct {
 	Success bool        `json:"success"`
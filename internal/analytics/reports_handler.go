@@ -2,21 +2,27 @@ package analytics
 
 import (
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/export"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/reports"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 )
 
 // GenerateReport godoc
 // @Summary Generate analytics report
-// @Description Generate various analytics reports
+// @Description Queue an analytics report. The report is kept once generated; poll the returned status_url or wait for the report ready alert, then fetch download_url.
 // @Tags analytics
 // @Produce json
-// @Param type query string false "Report type (fuel, driver, fleet, compliance)"
-// @Param format query string false "Report format (json, csv, pdf)"
-// @Success 200 {object} SuccessResponse
+// @Param type query string false "Report type (fleet, fuel, compliance)"
+// @Param format query string false "Report format (csv, json, jsonl, xlsx, pdf)"
+// @Param start_date query string false "First day of the report (YYYY-MM-DD), default 30 days ago"
+// @Param end_date query string false "Last day of the report (YYYY-MM-DD), default today"
+// @Success 202 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /api/v1/analytics/reports/generate [post]
 // @Security BearerAuth
 func (h *Handler) GenerateReport(c *gin.Context) {
@@ -26,51 +32,35 @@ func (h *Handler) GenerateReport(c *gin.Context) {
 		middleware.AbortWithUnauthorized(c, "company ID not found in token")
 		return
 	}
+	userID, _ := c.Get("user_id")
 
-	reportType := c.DefaultQuery("type", "fleet")
-	format := c.DefaultQuery("format", "json")
-
-	// Generate report based on type
-	var reportData interface{}
-
-	switch reportType {
-	case "fuel":
-		analytics, err := h.service.GetFuelConsumption(c.Request.Context(), companyID.(string), 
-			time.Now().AddDate(0, 0, -30), time.Now())
-		if err != nil {
-			middleware.AbortWithInternal(c, "Failed to generate fuel report", err)
-			return
-		}
-		reportData = analytics
-	case "compliance":
-		report, err := h.service.GetComplianceReport(c.Request.Context(), companyID.(string), "monthly")
-		if err != nil {
-			middleware.AbortWithInternal(c, "Failed to generate compliance report", err)
-			return
-		}
-		reportData = report
-	default: // fleet
-		dashboard, err := h.service.GetFleetDashboard(c.Request.Context(), companyID.(string))
-		if err != nil {
-			middleware.AbortWithInternal(c, "Failed to generate fleet report", err)
-			return
-		}
-		reportData = dashboard
+	if h.reports == nil {
+		middleware.AbortWithError(c, apperrors.NewServiceUnavailableError("reports are not available"))
+		return
 	}
 
-	// For now, return JSON format
-	// In real implementation, this would generate PDF/CSV based on format parameter
-	responseData := map[string]interface{}{
-		"report_type": reportType,
-		"format":     format,
-		"data":       reportData,
-		"generated_at": time.Now().Format(time.RFC3339),
+	userIDStr, _ := userID.(string)
+	report, err := h.reports.RequestReport(c.Request.Context(), &reports.ReportRequest{
+		ReportType: c.DefaultQuery("type", "fleet"),
+		Format:     c.DefaultQuery("format", "json"),
+		StartDate:  c.Query("start_date"),
+		EndDate:    c.Query("end_date"),
+		CompanyID:  companyID.(string),
+		UserID:     userIDStr,
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to generate report", err)
+		}
+		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{
+	c.JSON(http.StatusAccepted, SuccessResponse{
 		Success: true,
-		Data:    responseData,
-		Message: "Report generated successfully",
+		Data:    reports.QueuedReport(report),
+		Message: "Report queued",
 	})
 }
 
@@ -108,13 +98,15 @@ func (h *Handler) GetComplianceReport(c *gin.Context) {
 
 // ExportReport godoc
 // @Summary Export analytics report
-// @Description Export analytics report in various formats
+// @Description Queue a background export of an analytics report. Poll the returned status_url until the export completes and carries a signed download_url.
 // @Tags analytics
 // @Produce json
-// @Param id path string true "Report ID"
-// @Param format query string false "Export format (csv, pdf, excel)"
-// @Success 200 {object} SuccessResponse
+// @Param id path string true "Report type (fleet, fuel, compliance)"
+// @Param format query string false "Export format (csv, json, jsonl, xlsx, pdf)"
+// @Success 202 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /api/v1/analytics/reports/export/{id} [get]
 // @Security BearerAuth
 func (h *Handler) ExportReport(c *gin.Context) {
@@ -124,24 +116,46 @@ func (h *Handler) ExportReport(c *gin.Context) {
 		middleware.AbortWithUnauthorized(c, "company ID not found in token")
 		return
 	}
+	userID, _ := c.Get("user_id")
 
-	reportID := c.Param("id")
-	_ = companyID // Use companyID for future implementation
-	format := c.DefaultQuery("format", "csv")
+	if h.exports == nil {
+		middleware.AbortWithError(c, apperrors.NewServiceUnavailableError("report exports are not available"))
+		return
+	}
 
-	// For now, return a placeholder response
-	// In real implementation, this would generate and return the actual file
-	exportData := map[string]interface{}{
-		"report_id":    reportID,
-		"format":      format,
-		"download_url": "/api/v1/analytics/reports/download/" + reportID + "." + format,
-		"expires_at":  time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+	reportType := c.Param("id")
+	if !IsValidReportType(reportType) {
+		middleware.AbortWithError(c, apperrors.NewValidationError("unknown report type "+reportType))
+		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{
+	userIDStr, _ := userID.(string)
+	status, err := h.exports.RequestExport(c.Request.Context(), &export.ExportRequest{
+		ExportType: "reports",
+		Format:     c.DefaultQuery("format", "csv"),
+		Filters:    map[string]interface{}{"report_type": reportType},
+		CompanyID:  companyID.(string),
+		UserID:     userIDStr,
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to export report", err)
+		}
+		return
+	}
+
+	code, message := http.StatusAccepted, "Report export queued"
+	if status.DownloadURL != "" {
+		code, message = http.StatusOK, "Report export ready"
+	}
+	c.JSON(code, SuccessResponse{
 		Success: true,
-		Data:    exportData,
-		Message: "Export link generated successfully",
+		Data: map[string]interface{}{
+			"export":     status,
+			"status_url": "/api/v1/exports/" + status.ID,
+		},
+		Message: message,
 	})
 }
-
@@ -12,6 +12,7 @@ import (
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/reports"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/repository"
 	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
@@ -645,6 +646,46 @@ func (s *Service) GetComplianceReport(ctx context.Context, companyID string, per
 	return report, nil
 }
 
+// reportTypes are the reports BuildReport can generate
+var reportTypes = map[string]bool{
+	"fleet":      true,
+	"fuel":       true,
+	"compliance": true,
+}
+
+// IsValidReportType reports whether BuildReport can generate a report type
+func IsValidReportType(reportType string) bool {
+	return reportTypes[reportType]
+}
+
+// BuildReport generates a fleet, fuel (last 30 days) or monthly compliance
+// report, falling back to the fleet report for unknown types
+func (s *Service) BuildReport(ctx context.Context, companyID, reportType string) (interface{}, error) {
+	switch reportType {
+	case "fuel":
+		return s.GetFuelConsumption(ctx, companyID, time.Now().AddDate(0, 0, -30), time.Now())
+	case "compliance":
+		return s.GetComplianceReport(ctx, companyID, "monthly")
+	default: // fleet
+		return s.GetFleetDashboard(ctx, companyID)
+	}
+}
+
+// RegisterReports makes the analytics reports available to the report
+// service. The fleet dashboard and monthly compliance report describe the
+// fleet when they run; the fuel report covers the requested period.
+func (s *Service) RegisterReports(reportService *reports.Service) {
+	reportService.RegisterGenerator("fleet", "Fleet Dashboard", func(ctx context.Context, companyID string, period reports.Period) (interface{}, error) {
+		return s.GetFleetDashboard(ctx, companyID)
+	})
+	reportService.RegisterGenerator("fuel", "Fuel Analytics", func(ctx context.Context, companyID string, period reports.Period) (interface{}, error) {
+		return s.GetFuelConsumption(ctx, companyID, period.Start, period.End)
+	})
+	reportService.RegisterGenerator("compliance", "Compliance", func(ctx context.Context, companyID string, period reports.Period) (interface{}, error) {
+		return s.GetComplianceReport(ctx, companyID, "monthly")
+	})
+}
+
 // Helper methods
 
 func (s *Service) calculateBehaviorMetrics(gpsTracks []*models.GPSTrack) BehaviorMetrics {
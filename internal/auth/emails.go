@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/email"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// passwordResetTTL is how long a password reset link can be used
+const passwordResetTTL = time.Hour
+
+// Mailer sends emails in the background
+type Mailer interface {
+	Send(ctx context.Context, email *email.Email) (*models.EmailMessage, error)
+}
+
+// SetMailer enables account emails. appURL is the base URL of the web app
+// the emails link to, e.g. https://app.fleettracker.id
+func (s *Service) SetMailer(mailer Mailer, appURL string) {
+	s.mailer = mailer
+	s.appURL = strings.TrimRight(appURL, "/")
+}
+
+// sendInvitationEmail sends a new user their login and temporary password.
+// Failures are logged; the user can be sent a password reset instead.
+func (s *Service) sendInvitationEmail(ctx context.Context, user *models.User, companyName, tempPassword string) {
+	if s.mailer == nil {
+		fmt.Printf("Warning: Email is not configured, invitation to %s not sent\n", user.Email)
+		return
+	}
+
+	_, err := s.mailer.Send(ctx, &email.Email{
+		CompanyID: user.CompanyID,
+		UserID:    user.ID,
+		To:        user.Email,
+		Language:  user.Language,
+		Template:  email.TemplateUserInvitation,
+		Data: map[string]interface{}{
+			"Name":              user.GetFullName(),
+			"Email":             user.Email,
+			"CompanyName":       companyName,
+			"TemporaryPassword": tempPassword,
+			"LoginURL":          s.appURL + "/login",
+		},
+		Sensitive: true,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to send invitation to %s: %v\n", user.Email, err)
+	}
+}
+
+// sendPasswordResetEmail sends a user the link to reset their password.
+// Failures are logged so the response does not reveal whether the account
+// exists.
+func (s *Service) sendPasswordResetEmail(ctx context.Context, user *models.User, resetToken string) {
+	if s.mailer == nil {
+		fmt.Printf("Warning: Email is not configured, password reset for %s not sent\n", user.Email)
+		return
+	}
+
+	_, err := s.mailer.Send(ctx, &email.Email{
+		CompanyID: user.CompanyID,
+		UserID:    user.ID,
+		To:        user.Email,
+		Language:  user.Language,
+		Template:  email.TemplatePasswordReset,
+		Data: map[string]interface{}{
+			"Name":             user.GetFullName(),
+			"ResetURL":         s.appURL + "/reset-password?token=" + url.QueryEscape(resetToken),
+			"ExpiresInMinutes": int(passwordResetTTL / time.Minute),
+		},
+		Sensitive: true,
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to send password reset to %s: %v\n", user.Email, err)
+	}
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -100,7 +101,7 @@ func (h *Handler) Register(c *gin.Context) {
 
 // Login handles user login
 // @Summary User login
-// @Description Authenticate user with email and password, returns JWT tokens
+// @Description Authenticate user with email and password, returns JWT tokens. Users with two-factor authentication, or whose company requires it, receive a challenge to complete at /auth/login/2fa (or /auth/login/2fa/setup to enrol) instead.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -128,6 +129,15 @@ func (h *Handler) Login(c *gin.Context) {
 
 	user, tokens, err := h.service.Login(req)
 	if err != nil {
+		var twoFactorErr *TwoFactorRequiredError
+		if errors.As(err, &twoFactorErr) {
+			c.JSON(http.StatusOK, gin.H{
+				"message":             "Two-factor authentication required",
+				"two_factor_required": true,
+				"challenge":           twoFactorErr.Challenge,
+			})
+			return
+		}
 		middleware.AbortWithUnauthorized(c, err.Error())
 		return
 	}
@@ -13,16 +13,24 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/realtime"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
 
 // Service handles authentication operations
 type Service struct {
-	db        *gorm.DB
-	redis     *redis.Client
-	jwtSecret []byte
-	cache     *CacheService
+	db           *gorm.DB
+	redis        *redis.Client
+	jwtSecret    []byte
+	cache        *CacheService
+	entitlements *entitlement.Service
+	mailer       Mailer
+	appURL       string
+
+	twoFactorKeyID string            // key encrypting new TOTP secrets
+	twoFactorKeys  map[string][]byte // key id -> AES key, including retired keys
 }
 
 // CacheService provides caching functionality for auth operations
@@ -167,6 +175,7 @@ type UserResponse struct {
 	IsActive           bool      `json:"is_active"`
 	IsVerified         bool      `json:"is_verified"`
 	MustChangePassword bool      `json:"must_change_password"` // NEW: Force password change flag
+	TwoFactorEnabled   bool      `json:"two_factor_enabled"`
 	LastLoginAt *time.Time `json:"last_login_at"`
 	CreatedAt   time.Time `json:"created_at"`
 }
@@ -174,10 +183,11 @@ type UserResponse struct {
 // NewService creates a new authentication service
 func NewService(db *gorm.DB, redis *redis.Client, jwtSecret string) *Service {
 	return &Service{
-		db:        db,
-		redis:     redis,
-		jwtSecret: []byte(jwtSecret),
-		cache:     NewCacheService(redis),
+		db:           db,
+		redis:        redis,
+		jwtSecret:    []byte(jwtSecret),
+		cache:        NewCacheService(redis),
+		entitlements: entitlement.NewService(db),
 	}
 }
 
@@ -272,6 +282,16 @@ func (s *Service) Login(req LoginRequest) (*UserResponse, *TokenResponse, error)
 		return nil, nil, errors.NewUnauthorizedError("Invalid email or password")
 	}
 
+	// Users with 2FA, or whose company requires it, complete the login with a
+	// second factor. Failed attempts are only reset once it is verified.
+	challenge, err := s.loginChallenge(&user)
+	if err != nil {
+		return nil, nil, errors.NewInternalError("Failed to start two-factor authentication").WithInternal(err)
+	}
+	if challenge != nil {
+		return nil, nil, &TwoFactorRequiredError{Challenge: challenge}
+	}
+
 	// Reset failed attempts on successful login
 	user.ResetFailedAttempts()
 	user.UpdateLastLogin()
@@ -313,6 +333,17 @@ func (s *Service) RefreshToken(refreshToken string) (*TokenResponse, error) {
 		return nil, errors.NewForbiddenError("User account is inactive")
 	}
 
+	// Users who have not enrolled since their company required 2FA must log in again
+	if !user.TwoFactorEnabled {
+		required, err := s.companyRequiresTwoFactor(user.CompanyID)
+		if err != nil {
+			return nil, errors.NewInternalError("Failed to fetch company").WithInternal(err)
+		}
+		if required {
+			return nil, errors.NewUnauthorizedError("Two-factor authentication is required, please log in again")
+		}
+	}
+
 	// Generate new tokens
 	tokenResponse, err := s.generateTokens(&user)
 	if err != nil {
@@ -331,9 +362,19 @@ func (s *Service) RefreshToken(refreshToken string) (*TokenResponse, error) {
 // Logout invalidates user session
 func (s *Service) Logout(accessToken string) error {
 	// Find and deactivate session
-	if err := s.db.Model(&models.Session{}).Where("token = ?", accessToken).Update("is_active", false).Error; err != nil {
+	var session models.Session
+	if err := s.db.Select("id", "user_id").Where("token = ?", accessToken).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
 		return errors.NewInternalError("Failed to logout").WithInternal(err)
 	}
+	if err := s.db.Model(&models.Session{}).Where("id = ?", session.ID).Update("is_active", false).Error; err != nil {
+		return errors.NewInternalError("Failed to logout").WithInternal(err)
+	}
+
+	// Close live WebSocket connections of the session
+	s.notifySessionRevoked(context.Background(), realtime.SessionRevocation{SessionID: session.ID, UserID: session.UserID})
 	return nil
 }
 
@@ -446,6 +487,7 @@ func (s *Service) ChangePassword(userID, currentPassword, newPassword string) er
 	if err := s.db.Model(&models.Session{}).Where("user_id = ?", userID).Update("is_active", false).Error; err != nil {
 		return errors.NewInternalError("Failed to invalidate sessions").WithInternal(err)
 	}
+	s.notifySessionRevoked(context.Background(), realtime.SessionRevocation{UserID: userID})
 
 	return nil
 }
@@ -468,15 +510,14 @@ func (s *Service) ForgotPassword(email string) error {
 	resetTokenRecord := models.PasswordResetToken{
 		UserID:    user.ID,
 		Token:     resetToken,
-		ExpiresAt: time.Now().Add(1 * time.Hour), // 1 hour expiry
+		ExpiresAt: time.Now().Add(passwordResetTTL),
 	}
 
 	if err := s.db.Create(&resetTokenRecord).Error; err != nil {
 		return errors.NewInternalError("Failed to create reset token").WithInternal(err)
 	}
 
-	// TODO: Send password reset email
-	// s.sendPasswordResetEmail(user.Email, resetToken)
+	s.sendPasswordResetEmail(context.Background(), &user, resetToken)
 
 	return nil
 }
@@ -520,6 +561,7 @@ func (s *Service) ResetPassword(token, newPassword string) error {
 	if err := s.db.Model(&models.Session{}).Where("user_id = ?", user.ID).Update("is_active", false).Error; err != nil {
 		return errors.NewInternalError("Failed to invalidate sessions").WithInternal(err)
 	}
+	s.notifySessionRevoked(context.Background(), realtime.SessionRevocation{UserID: user.ID})
 
 	return nil
 }
@@ -639,6 +681,7 @@ func (s *Service) userToResponse(user *models.User) *UserResponse {
 		IsActive:           user.IsActive,
 		IsVerified:         user.IsVerified,
 		MustChangePassword: user.MustChangePassword, // NEW: Include force password change flag
+		TwoFactorEnabled:   user.TwoFactorEnabled,
 		LastLoginAt:        user.LastLoginAt,
 		CreatedAt:          user.CreatedAt,
 	}
@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"context"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -353,3 +355,127 @@ func TestService_TokenExpiry(t *testing.T) {
 	})
 }
 
+
+func TestService_TwoFactorLogin(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	service := NewService(db, redisClient, "test-jwt-secret")
+	service.SetTwoFactorKeys("1", "test-2fa-key", nil)
+	ctx := context.Background()
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	user, err := service.Register(RegisterRequest{
+		CompanyID: company.ID,
+		Email:     "totp@test.com",
+		Username:  "totpuser",
+		Password:  "SecurePass123!",
+		FirstName: "Totp",
+		LastName:  "User",
+		Phone:     "+62 811 5555555",
+		Role:      "admin",
+	})
+	require.NoError(t, err)
+
+	setup, err := service.SetupTwoFactor(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Contains(t, setup.OTPAuthURL, setup.Secret)
+	key, err := decodeTOTPSecret(setup.Secret)
+	require.NoError(t, err)
+
+	step := totpStep(time.Now())
+	_, err = service.EnableTwoFactor(ctx, user.ID, "000000")
+	assert.Error(t, err)
+	recoveryCodes, err := service.EnableTwoFactor(ctx, user.ID, totpCode(key, step))
+	require.NoError(t, err)
+	assert.Len(t, recoveryCodes, recoveryCodeCount)
+
+	login := func() *TwoFactorChallenge {
+		_, tokens, err := service.Login(LoginRequest{Email: "totp@test.com", Password: "SecurePass123!"})
+		var twoFactorErr *TwoFactorRequiredError
+		require.ErrorAs(t, err, &twoFactorErr)
+		assert.Nil(t, tokens)
+		return twoFactorErr.Challenge
+	}
+
+	t.Run("password alone does not issue tokens", func(t *testing.T) {
+		challenge := login()
+		assert.False(t, challenge.SetupRequired)
+		assert.NotEmpty(t, challenge.ChallengeToken)
+	})
+
+	t.Run("code completes the login once", func(t *testing.T) {
+		challenge := login()
+		code := totpCode(key, step+1)
+
+		_, tokens, err := service.CompleteTwoFactorLogin(ctx, TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code})
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+
+		_, _, err = service.CompleteTwoFactorLogin(ctx, TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code})
+		assert.Error(t, err)
+	})
+
+	t.Run("recovery code completes the login once", func(t *testing.T) {
+		challenge := login()
+
+		_, tokens, err := service.CompleteTwoFactorLogin(ctx, TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, RecoveryCode: recoveryCodes[0]})
+		require.NoError(t, err)
+		assert.NotNil(t, tokens)
+
+		_, _, err = service.CompleteTwoFactorLogin(ctx, TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, RecoveryCode: recoveryCodes[0]})
+		assert.Error(t, err)
+
+		status, err := service.GetTwoFactorStatus(ctx, user.ID)
+		require.NoError(t, err)
+		assert.True(t, status.Enabled)
+		assert.Equal(t, recoveryCodeCount-1, status.RecoveryCodesRemaining)
+	})
+
+	t.Run("company policy requires enrolment", func(t *testing.T) {
+		_, err := service.SetTwoFactorPolicy(ctx, RoleOperator, company.ID, true)
+		assert.Error(t, err)
+
+		policy, err := service.SetTwoFactorPolicy(ctx, RoleAdmin, company.ID, true)
+		require.NoError(t, err)
+		assert.True(t, policy.RequireTwoFactor)
+
+		_, err = service.Register(RegisterRequest{
+			CompanyID: company.ID,
+			Email:     "enrol@test.com",
+			Username:  "enroluser",
+			Password:  "SecurePass123!",
+			FirstName: "Enrol",
+			LastName:  "User",
+			Phone:     "+62 811 6666666",
+			Role:      "operator",
+		})
+		require.NoError(t, err)
+
+		_, _, err = service.Login(LoginRequest{Email: "enrol@test.com", Password: "SecurePass123!"})
+		var twoFactorErr *TwoFactorRequiredError
+		require.ErrorAs(t, err, &twoFactorErr)
+		assert.True(t, twoFactorErr.Challenge.SetupRequired)
+
+		// A setup challenge cannot be used to log in directly
+		_, _, err = service.CompleteTwoFactorLogin(ctx, TwoFactorLoginRequest{ChallengeToken: twoFactorErr.Challenge.ChallengeToken, Code: "000000"})
+		assert.Error(t, err)
+
+		enrolSetup, err := service.BeginTwoFactorEnrolment(ctx, twoFactorErr.Challenge.ChallengeToken)
+		require.NoError(t, err)
+		enrolKey, err := decodeTOTPSecret(enrolSetup.Secret)
+		require.NoError(t, err)
+
+		enrolment, err := service.CompleteTwoFactorEnrolment(ctx, twoFactorErr.Challenge.ChallengeToken, totpCode(enrolKey, totpStep(time.Now())))
+		require.NoError(t, err)
+		assert.True(t, enrolment.User.TwoFactorEnabled)
+		assert.NotEmpty(t, enrolment.Tokens.AccessToken)
+
+		// Disabling is refused while the policy is on
+		err = service.DisableTwoFactor(ctx, user.ID, "SecurePass123!", totpCode(key, step+2))
+		assert.Error(t, err)
+	})
+}
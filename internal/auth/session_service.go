@@ -2,10 +2,12 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/realtime"
 	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
@@ -83,6 +85,9 @@ func (s *Service) RevokeSession(ctx context.Context, userID, sessionID string) *
 		// The session is already deactivated in the database
 	}
 	
+	// Close live WebSocket connections of the session
+	s.notifySessionRevoked(ctx, realtime.SessionRevocation{SessionID: sessionID, UserID: userID})
+	
 	return nil
 }
 
@@ -97,6 +102,12 @@ func (s *Service) RevokeAllSessions(ctx context.Context, userID string, exceptSe
 		query = query.Where("id != ?", exceptSessionID)
 	}
 	
+	// Remember which sessions are revoked to close their WebSocket connections
+	var sessionIDs []string
+	if err := query.Session(&gorm.Session{}).Pluck("id", &sessionIDs).Error; err != nil {
+		return apperrors.NewInternalError("Failed to find sessions").WithInternal(err)
+	}
+	
 	// Deactivate all matching sessions
 	updates := map[string]interface{}{
 		"is_active": false,
@@ -106,6 +117,10 @@ func (s *Service) RevokeAllSessions(ctx context.Context, userID string, exceptSe
 		return apperrors.NewInternalError("Failed to revoke sessions").WithInternal(err)
 	}
 	
+	for _, sessionID := range sessionIDs {
+		s.notifySessionRevoked(ctx, realtime.SessionRevocation{SessionID: sessionID, UserID: userID})
+	}
+	
 	// Invalidate cache for all user sessions
 	pattern := "session:user:" + userID + ":*"
 	keys, err := s.redis.Keys(ctx, pattern).Result()
@@ -135,3 +150,14 @@ func (s *Service) CleanupExpiredSessions(ctx context.Context) error {
 	return nil
 }
 
+// notifySessionRevoked asks the WebSocket hubs of every instance to close the
+// connections of revoked sessions. Hubs also re-check sessions periodically,
+// so a failed notification only delays the disconnect.
+func (s *Service) notifySessionRevoked(ctx context.Context, revocation realtime.SessionRevocation) {
+	if s.redis == nil {
+		return
+	}
+	if err := realtime.PublishSessionRevocation(ctx, s.redis, revocation); err != nil {
+		fmt.Printf("Warning: Failed to publish session revocation: %v\n", err)
+	}
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B test vectors (SHA-1), truncated to 6 digits
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		assert.Equal(t, want, totpCode(key, totpStep(time.Unix(unix, 0))), "time %d", unix)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	require.NoError(t, err)
+	key, err := decodeTOTPSecret(strings.ToLower(secret))
+	require.NoError(t, err)
+	require.Len(t, key, totpSecretSize)
+
+	now := time.Unix(1700000000, 0)
+	current := totpStep(now)
+
+	t.Run("current and adjacent steps", func(t *testing.T) {
+		for _, step := range []int64{current - 1, current, current + 1} {
+			got, ok := validateTOTP(key, totpCode(key, step), now, 0)
+			assert.True(t, ok)
+			assert.Equal(t, step, got)
+		}
+	})
+
+	t.Run("outside the window", func(t *testing.T) {
+		_, ok := validateTOTP(key, totpCode(key, current-2), now, 0)
+		assert.False(t, ok)
+		_, ok = validateTOTP(key, totpCode(key, current+2), now, 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("replayed code", func(t *testing.T) {
+		_, ok := validateTOTP(key, totpCode(key, current), now, current)
+		assert.False(t, ok)
+	})
+
+	t.Run("malformed code", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+			_, ok := validateTOTP(key, code, now, 0)
+			assert.False(t, ok, code)
+		}
+	})
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := totpURI("owner@fleet.co.id", "JBSWY3DPEHPK3PXP")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/FleetTracker%20Pro:owner@fleet.co.id?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=FleetTracker%20Pro")
+	assert.Contains(t, uri, "digits=6")
+	assert.Contains(t, uri, "period=30")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}$`, codes[0])
+
+	stored := strings.Join(hashes, ",")
+	assert.Equal(t, recoveryCodeCount, countRecoveryCodes(stored))
+
+	// Codes are accepted regardless of case and dashes, but only once
+	remaining, ok := consumeRecoveryCode(stored, strings.ToUpper(strings.ReplaceAll(codes[3], "-", "")))
+	require.True(t, ok)
+	assert.Equal(t, recoveryCodeCount-1, countRecoveryCodes(remaining))
+
+	_, ok = consumeRecoveryCode(remaining, codes[3])
+	assert.False(t, ok)
+
+	_, ok = consumeRecoveryCode(remaining, "aaaa-bbbb")
+	assert.False(t, ok)
+
+	assert.Zero(t, countRecoveryCodes(""))
+}
+
+func TestEncryptTOTPSecret(t *testing.T) {
+	service := &Service{jwtSecret: []byte("test-jwt-secret")}
+	service.SetTwoFactorKeys("2", "test-2fa-key", nil)
+
+	encrypted, err := service.sealTOTPSecret("JBSWY3DPEHPK3PXP")
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "JBSWY3DPEHPK3PXP")
+	assert.True(t, strings.HasPrefix(encrypted, "2:"))
+	assert.LessOrEqual(t, len(encrypted), 255)
+
+	secret, keyID, err := service.openTOTPSecret(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", secret)
+	assert.Equal(t, "2", keyID)
+
+	// Secrets cannot be read with another server's key
+	other := &Service{jwtSecret: []byte("test-jwt-secret")}
+	other.SetTwoFactorKeys("2", "another-2fa-key", nil)
+	_, _, err = other.openTOTPSecret(encrypted)
+	assert.Error(t, err)
+
+	t.Run("rotated key still decrypts", func(t *testing.T) {
+		rotated := &Service{jwtSecret: []byte("test-jwt-secret")}
+		rotated.SetTwoFactorKeys("3", "new-2fa-key", map[string]string{"2": "test-2fa-key"})
+
+		secret, keyID, err := rotated.openTOTPSecret(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "JBSWY3DPEHPK3PXP", secret)
+		assert.Equal(t, "2", keyID)
+
+		sealed, err := rotated.sealTOTPSecret(secret)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(sealed, "3:"))
+	})
+
+	t.Run("secrets without key id are rejected", func(t *testing.T) {
+		_, _, err := service.openTOTPSecret(strings.TrimPrefix(encrypted, "2:"))
+		assert.Error(t, err)
+	})
+
+	t.Run("no key configured", func(t *testing.T) {
+		unconfigured := &Service{jwtSecret: []byte("test-jwt-secret")}
+		_, err := unconfigured.sealTOTPSecret("JBSWY3DPEHPK3PXP")
+		assert.Error(t, err)
+	})
+}
+
+func TestChallengeTokenIsNotAnAccessToken(t *testing.T) {
+	service := &Service{jwtSecret: []byte("test-jwt-secret")}
+	user := &models.User{ID: "0b7d3c4e-1f2a-4b5c-8d9e-0f1a2b3c4d5e", TwoFactorEnabled: true}
+
+	challenge, err := service.loginChallenge(user)
+	require.NoError(t, err)
+	require.NotNil(t, challenge)
+	assert.False(t, challenge.SetupRequired)
+
+	// ValidateToken parses with the access token key before touching the database
+	_, err = service.ValidateToken(challenge.ChallengeToken)
+	assert.Error(t, err)
+}
@@ -0,0 +1,604 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// Challenge purposes
+const (
+	challengePurposeLogin = "login" // user is enrolled and must enter a code
+	challengePurposeSetup = "setup" // company requires 2FA and the user must enrol first
+)
+
+// twoFactorChallengeTTL bounds the time between the password and code steps
+const twoFactorChallengeTTL = 5 * time.Minute
+
+// TwoFactorChallenge is returned by the first login step when a second factor is needed
+type TwoFactorChallenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	SetupRequired  bool   `json:"setup_required"` // enrol via /auth/login/2fa/setup before logging in
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+// TwoFactorRequiredError is returned by Login when the password is correct
+// but the login must be completed with a second factor. Callers that do not
+// handle it treat the login as failed.
+type TwoFactorRequiredError struct {
+	Challenge *TwoFactorChallenge
+}
+
+func (e *TwoFactorRequiredError) Error() string {
+	return "Two-factor authentication required"
+}
+
+// TwoFactorLoginRequest completes a login with a TOTP or recovery code
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required" example:"123456"`
+}
+
+// DisableTwoFactorRequest requires both factors to turn 2FA off
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required" example:"123456"`
+}
+
+// TwoFactorPolicyRequest updates the company two-factor policy
+type TwoFactorPolicyRequest struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+// TwoFactorSetupResponse contains the secret to add to an authenticator app
+type TwoFactorSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// TwoFactorStatusResponse describes the two-factor state of a user
+type TwoFactorStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RequiredByCompany      bool `json:"required_by_company"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorPolicyResponse describes the company two-factor policy
+type TwoFactorPolicyResponse struct {
+	CompanyID        string `json:"company_id"`
+	RequireTwoFactor bool   `json:"require_two_factor"`
+	UsersNotEnrolled int64  `json:"users_not_enrolled"`
+}
+
+// TwoFactorEnrolmentResponse completes a login that required enrolment
+type TwoFactorEnrolmentResponse struct {
+	User          *UserResponse  `json:"user"`
+	Tokens        *TokenResponse `json:"tokens"`
+	RecoveryCodes []string       `json:"recovery_codes"`
+}
+
+// challengeClaims are the claims of a two-factor challenge token
+type challengeClaims struct {
+	UserID  string `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// challengeKey signs challenge tokens. It differs from the access token key
+// so a challenge can never be used as an access token.
+func (s *Service) challengeKey() []byte {
+	sum := sha256.Sum256(append([]byte("2fa-challenge:"), s.jwtSecret...))
+	return sum[:]
+}
+
+// SetTwoFactorKeys sets the key that encrypts TOTP secrets at rest and the
+// retired keys that still decrypt them. Secrets are stored as
+// "<key id>:<ciphertext>" so the key can be rotated: new secrets use the
+// current key and a secret of a retired key is re-encrypted the next time
+// its code is verified.
+func (s *Service) SetTwoFactorKeys(keyID, key string, previous map[string]string) {
+	s.twoFactorKeys = make(map[string][]byte, len(previous)+1)
+	for id, retired := range previous {
+		if retired != "" {
+			s.twoFactorKeys[id] = deriveSecretKey(retired)
+		}
+	}
+	s.twoFactorKeyID = ""
+	if key != "" && keyID != "" {
+		s.twoFactorKeyID = keyID
+		s.twoFactorKeys[keyID] = deriveSecretKey(key)
+	}
+}
+
+// deriveSecretKey turns a configured key into an AES-256 key
+func deriveSecretKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// sealTOTPSecret encrypts a secret with the current key
+func (s *Service) sealTOTPSecret(secret string) (string, error) {
+	key, ok := s.twoFactorKeys[s.twoFactorKeyID]
+	if s.twoFactorKeyID == "" || !ok {
+		return "", fmt.Errorf("no two-factor encryption key configured")
+	}
+	encrypted, err := encryptTOTPSecret(key, secret)
+	if err != nil {
+		return "", err
+	}
+	return s.twoFactorKeyID + ":" + encrypted, nil
+}
+
+// openTOTPSecret decrypts a stored secret with the key it was encrypted
+// with and returns the id of that key
+func (s *Service) openTOTPSecret(stored string) (string, string, error) {
+	sep := strings.LastIndex(stored, ":")
+	if sep < 0 {
+		return "", "", fmt.Errorf("two-factor secret has no key id")
+	}
+
+	keyID := stored[:sep]
+	key, ok := s.twoFactorKeys[keyID]
+	if !ok {
+		return "", keyID, fmt.Errorf("unknown two-factor key id %q", keyID)
+	}
+	secret, err := decryptTOTPSecret(key, stored[sep+1:])
+	return secret, keyID, err
+}
+
+// loginChallenge returns the challenge a user must pass after the password,
+// or nil when the password is enough
+func (s *Service) loginChallenge(user *models.User) (*TwoFactorChallenge, error) {
+	purpose := challengePurposeLogin
+	if !user.TwoFactorEnabled {
+		required, err := s.companyRequiresTwoFactor(user.CompanyID)
+		if err != nil {
+			return nil, err
+		}
+		if !required {
+			return nil, nil
+		}
+		purpose = challengePurposeSetup
+	}
+
+	claims := &challengeClaims{
+		UserID:  user.ID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(twoFactorChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.challengeKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorChallenge{
+		ChallengeToken: token,
+		SetupRequired:  purpose == challengePurposeSetup,
+		ExpiresIn:      int(twoFactorChallengeTTL.Seconds()),
+	}, nil
+}
+
+// parseChallenge validates a challenge token and loads its user
+func (s *Service) parseChallenge(ctx context.Context, tokenString, purpose string) (*models.User, error) {
+	claims := &challengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return s.challengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid || claims.Purpose != purpose {
+		return nil, apperrors.NewUnauthorizedError("Invalid or expired two-factor challenge")
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ? AND is_active = true", claims.UserID).First(&user).Error; err != nil {
+		return nil, apperrors.NewUnauthorizedError("Invalid or expired two-factor challenge")
+	}
+
+	if user.IsAccountLocked() {
+		return nil, apperrors.NewForbiddenError("Account is locked due to too many failed login attempts")
+	}
+
+	return &user, nil
+}
+
+// CompleteTwoFactorLogin finishes a login with a TOTP code or a recovery code
+func (s *Service) CompleteTwoFactorLogin(ctx context.Context, req TwoFactorLoginRequest) (*UserResponse, *TokenResponse, error) {
+	if strings.TrimSpace(req.Code) == "" && strings.TrimSpace(req.RecoveryCode) == "" {
+		return nil, nil, apperrors.NewValidationError("Either code or recovery_code is required")
+	}
+
+	user, err := s.parseChallenge(ctx, req.ChallengeToken, challengePurposeLogin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if req.RecoveryCode != "" {
+		err = s.useRecoveryCode(ctx, user, req.RecoveryCode)
+	} else {
+		err = s.verifyTOTP(ctx, user, req.Code)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.finishLogin(user)
+}
+
+// BeginTwoFactorEnrolment starts the enrolment required by the company policy
+// during login and returns the secret for the authenticator app
+func (s *Service) BeginTwoFactorEnrolment(ctx context.Context, challengeToken string) (*TwoFactorSetupResponse, error) {
+	user, err := s.parseChallenge(ctx, challengeToken, challengePurposeSetup)
+	if err != nil {
+		return nil, err
+	}
+	return s.newTOTPSecret(ctx, user)
+}
+
+// CompleteTwoFactorEnrolment enables 2FA with the first code from the
+// authenticator app and logs the user in
+func (s *Service) CompleteTwoFactorEnrolment(ctx context.Context, challengeToken, code string) (*TwoFactorEnrolmentResponse, error) {
+	user, err := s.parseChallenge(ctx, challengeToken, challengePurposeSetup)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.enableTOTP(ctx, user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	userResponse, tokens, err := s.finishLogin(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrolmentResponse{User: userResponse, Tokens: tokens, RecoveryCodes: recoveryCodes}, nil
+}
+
+// GetTwoFactorStatus returns the two-factor state of a user
+func (s *Service) GetTwoFactorStatus(ctx context.Context, userID string) (*TwoFactorStatusResponse, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	required, err := s.companyRequiresTwoFactor(user.CompanyID)
+	if err != nil {
+		return nil, apperrors.NewInternalError("Failed to fetch company").WithInternal(err)
+	}
+
+	return &TwoFactorStatusResponse{
+		Enabled:                user.TwoFactorEnabled,
+		RequiredByCompany:      required,
+		RecoveryCodesRemaining: countRecoveryCodes(user.TwoFactorRecoveryCodes),
+	}, nil
+}
+
+// SetupTwoFactor generates a new secret for a signed in user. 2FA is only
+// enabled once EnableTwoFactor confirms a code.
+func (s *Service) SetupTwoFactor(ctx context.Context, userID string) (*TwoFactorSetupResponse, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.newTOTPSecret(ctx, user)
+}
+
+// EnableTwoFactor confirms the secret from SetupTwoFactor and returns the recovery codes
+func (s *Service) EnableTwoFactor(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.enableTOTP(ctx, user, code)
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a current code
+func (s *Service) DisableTwoFactor(ctx context.Context, userID, password, code string) error {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		return apperrors.NewBadRequestError("Two-factor authentication is not enabled")
+	}
+
+	required, err := s.companyRequiresTwoFactor(user.CompanyID)
+	if err != nil {
+		return apperrors.NewInternalError("Failed to fetch company").WithInternal(err)
+	}
+	if required {
+		return apperrors.NewForbiddenError("Your company requires two-factor authentication")
+	}
+
+	if !user.CheckPassword(password) {
+		return apperrors.NewUnauthorizedError("Password is incorrect")
+	}
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":        false,
+		"two_factor_secret":         "",
+		"two_factor_recovery_codes": "",
+		"two_factor_last_step":      0,
+	}).Error
+	if err != nil {
+		return apperrors.NewInternalError("Failed to disable two-factor authentication").WithInternal(err)
+	}
+
+	s.invalidateUser(ctx, user.ID)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current code
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TwoFactorEnabled {
+		return nil, apperrors.NewBadRequestError("Two-factor authentication is not enabled")
+	}
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, apperrors.NewInternalError("Failed to generate recovery codes").WithInternal(err)
+	}
+
+	if err := s.db.WithContext(ctx).Model(user).Update("two_factor_recovery_codes", strings.Join(hashes, ",")).Error; err != nil {
+		return nil, apperrors.NewInternalError("Failed to save recovery codes").WithInternal(err)
+	}
+
+	return codes, nil
+}
+
+// SetTwoFactorPolicy makes 2FA mandatory, or optional, for every user of the
+// company. Only owners and admins can change it.
+func (s *Service) SetTwoFactorPolicy(ctx context.Context, userRole, companyID string, required bool) (*TwoFactorPolicyResponse, error) {
+	if userRole != RoleSuperAdmin && userRole != RoleOwner && userRole != RoleAdmin {
+		return nil, apperrors.NewForbiddenError("Only owners and admins can change the two-factor policy")
+	}
+	if companyID == "" {
+		return nil, apperrors.NewForbiddenError("Company context required")
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.Company{}).Where("id = ?", companyID).Update("require_two_factor", required)
+	if result.Error != nil {
+		return nil, apperrors.NewInternalError("Failed to update two-factor policy").WithInternal(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, apperrors.NewNotFoundError("Company")
+	}
+
+	var notEnrolled int64
+	err := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("company_id = ? AND is_active = true AND (two_factor_enabled = false OR two_factor_enabled IS NULL)", companyID).
+		Count(&notEnrolled).Error
+	if err != nil {
+		return nil, apperrors.NewInternalError("Failed to count users").WithInternal(err)
+	}
+
+	return &TwoFactorPolicyResponse{
+		CompanyID:        companyID,
+		RequireTwoFactor: required,
+		UsersNotEnrolled: notEnrolled,
+	}, nil
+}
+
+// newTOTPSecret stores a new, not yet enabled, secret for the user
+func (s *Service) newTOTPSecret(ctx context.Context, user *models.User) (*TwoFactorSetupResponse, error) {
+	if user.TwoFactorEnabled {
+		return nil, apperrors.NewConflictError("Two-factor authentication is already enabled")
+	}
+	if s.twoFactorKeyID == "" {
+		return nil, apperrors.NewServiceUnavailableError("Two-factor authentication is not configured")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, apperrors.NewInternalError("Failed to generate secret").WithInternal(err)
+	}
+
+	encrypted, err := s.sealTOTPSecret(secret)
+	if err != nil {
+		return nil, apperrors.NewInternalError("Failed to encrypt secret").WithInternal(err)
+	}
+
+	if err := s.db.WithContext(ctx).Model(user).Update("two_factor_secret", encrypted).Error; err != nil {
+		return nil, apperrors.NewInternalError("Failed to save secret").WithInternal(err)
+	}
+
+	return &TwoFactorSetupResponse{
+		Secret:     secret,
+		OTPAuthURL: totpURI(user.Email, secret),
+	}, nil
+}
+
+// enableTOTP enables 2FA once the user proves the app generates valid codes
+func (s *Service) enableTOTP(ctx context.Context, user *models.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled {
+		return nil, apperrors.NewConflictError("Two-factor authentication is already enabled")
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, apperrors.NewBadRequestError("Start two-factor setup first")
+	}
+
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, apperrors.NewInternalError("Failed to generate recovery codes").WithInternal(err)
+	}
+
+	err = s.db.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"two_factor_enabled":        true,
+		"two_factor_recovery_codes": strings.Join(hashes, ","),
+	}).Error
+	if err != nil {
+		return nil, apperrors.NewInternalError("Failed to enable two-factor authentication").WithInternal(err)
+	}
+	user.TwoFactorEnabled = true
+
+	s.invalidateUser(ctx, user.ID)
+	return codes, nil
+}
+
+// verifyTOTP checks a code against the user's secret. Wrong codes count as
+// failed login attempts so the account lockout also limits code guessing.
+func (s *Service) verifyTOTP(ctx context.Context, user *models.User, code string) error {
+	secret, keyID, err := s.openTOTPSecret(user.TwoFactorSecret)
+	if err != nil {
+		return apperrors.NewInternalError("Failed to read two-factor secret").WithInternal(err)
+	}
+
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return apperrors.NewInternalError("Failed to read two-factor secret").WithInternal(err)
+	}
+
+	step, ok := validateTOTP(key, code, time.Now(), user.TwoFactorLastStep)
+	if !ok {
+		s.recordFailedAttempt(ctx, user)
+		return apperrors.NewUnauthorizedError("Invalid two-factor code")
+	}
+
+	// Only move forward so a concurrent request cannot replay the same code
+	result := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND (two_factor_last_step IS NULL OR two_factor_last_step < ?)", user.ID, step).
+		Update("two_factor_last_step", step)
+	if result.Error != nil {
+		return apperrors.NewInternalError("Failed to verify two-factor code").WithInternal(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.NewUnauthorizedError("Two-factor code was already used")
+	}
+	user.TwoFactorLastStep = step
+
+	// Move secrets of retired keys to the current key
+	if s.twoFactorKeyID != "" && keyID != s.twoFactorKeyID {
+		if encrypted, err := s.sealTOTPSecret(secret); err == nil {
+			if err := s.db.WithContext(ctx).Model(user).Update("two_factor_secret", encrypted).Error; err != nil {
+				fmt.Printf("Warning: Failed to re-encrypt two-factor secret of user %s: %v\n", user.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// useRecoveryCode consumes one of the user's recovery codes
+func (s *Service) useRecoveryCode(ctx context.Context, user *models.User, code string) error {
+	remaining, ok := consumeRecoveryCode(user.TwoFactorRecoveryCodes, code)
+	if !ok {
+		s.recordFailedAttempt(ctx, user)
+		return apperrors.NewUnauthorizedError("Invalid recovery code")
+	}
+
+	// Guard on the previous value so the same code cannot be used twice concurrently
+	result := s.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND two_factor_recovery_codes = ?", user.ID, user.TwoFactorRecoveryCodes).
+		Update("two_factor_recovery_codes", remaining)
+	if result.Error != nil {
+		return apperrors.NewInternalError("Failed to use recovery code").WithInternal(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.NewUnauthorizedError("Invalid recovery code")
+	}
+
+	user.TwoFactorRecoveryCodes = remaining
+	return nil
+}
+
+// recordFailedAttempt counts a wrong second factor towards the account lockout
+func (s *Service) recordFailedAttempt(ctx context.Context, user *models.User) {
+	user.IncrementFailedAttempts()
+	s.db.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+		"failed_login_attempts": user.FailedLoginAttempts,
+		"locked_until":          user.LockedUntil,
+	})
+}
+
+// finishLogin issues tokens once every required factor was verified
+func (s *Service) finishLogin(user *models.User) (*UserResponse, *TokenResponse, error) {
+	user.ResetFailedAttempts()
+	user.UpdateLastLogin()
+	s.db.Model(user).Updates(map[string]interface{}{
+		"failed_login_attempts": 0,
+		"last_login_at":         user.LastLoginAt,
+	})
+
+	tokenResponse, err := s.generateTokens(user)
+	if err != nil {
+		return nil, nil, apperrors.NewInternalError("Failed to generate tokens").WithInternal(err)
+	}
+
+	if err := s.createSession(user, tokenResponse.AccessToken, tokenResponse.RefreshToken); err != nil {
+		return nil, nil, apperrors.NewInternalError("Failed to create session").WithInternal(err)
+	}
+
+	return s.userToResponse(user), tokenResponse, nil
+}
+
+// companyRequiresTwoFactor reports whether the company enforces 2FA
+func (s *Service) companyRequiresTwoFactor(companyID string) (bool, error) {
+	if companyID == "" {
+		return false, nil
+	}
+
+	var company models.Company
+	err := s.db.Select("require_two_factor").Where("id = ?", companyID).First(&company).Error
+	if err == gorm.ErrRecordNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return company.RequireTwoFactor, nil
+}
+
+// findUser loads an active user by ID
+func (s *Service) findUser(ctx context.Context, userID string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ? AND is_active = true", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, apperrors.NewNotFoundError("User")
+		}
+		return nil, apperrors.NewInternalError("Failed to fetch user").WithInternal(err)
+	}
+	return &user, nil
+}
+
+// invalidateUser drops the cached copy of a user whose 2FA state changed
+func (s *Service) invalidateUser(ctx context.Context, userID string) {
+	if s.cache == nil || s.redis == nil {
+		return
+	}
+	if err := s.cache.InvalidateUserCache(ctx, userID); err != nil {
+		// Log but don't fail - cache invalidation is not critical
+		fmt.Printf("Warning: Failed to invalidate user cache: %v\n", err)
+	}
+}
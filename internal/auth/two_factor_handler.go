@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+)
+
+// TwoFactorEnrolmentRequest carries the challenge of a login that requires enrolment
+type TwoFactorEnrolmentRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+}
+
+// CompleteTwoFactorLogin handles the second step of a two-factor login
+// @Summary Complete two-factor login
+// @Description Exchange the challenge returned by /auth/login and a TOTP code, or a recovery code, for JWT tokens
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorLoginRequest true "Challenge and code"
+// @Success 200 {object} SuccessResponse{data=TokenResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Account locked"
+// @Router /api/v1/auth/login/2fa [post]
+func (h *Handler) CompleteTwoFactorLogin(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	user, tokens, err := h.service.CompleteTwoFactorLogin(c.Request.Context(), req)
+	if err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Login successful",
+		"user":    user,
+		"tokens":  tokens,
+	})
+}
+
+// BeginTwoFactorEnrolment handles enrolment required by the company policy during login
+// @Summary Start required two-factor enrolment
+// @Description Generate a TOTP secret for a user whose company requires two-factor authentication, using the setup challenge returned by /auth/login
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorEnrolmentRequest true "Setup challenge"
+// @Success 200 {object} SuccessResponse{data=TwoFactorSetupResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/auth/login/2fa/setup [post]
+func (h *Handler) BeginTwoFactorEnrolment(c *gin.Context) {
+	var req TwoFactorEnrolmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	setup, err := h.service.BeginTwoFactorEnrolment(c.Request.Context(), req.ChallengeToken)
+	if err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    setup,
+		Message: "Add the secret to your authenticator app and confirm with a code",
+	})
+}
+
+// CompleteTwoFactorEnrolment confirms required enrolment and logs the user in
+// @Summary Complete required two-factor enrolment
+// @Description Enable two-factor authentication with the first code from the authenticator app and return JWT tokens and recovery codes
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorEnrolmentRequest true "Setup challenge and code"
+// @Success 200 {object} SuccessResponse{data=TwoFactorEnrolmentResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/auth/login/2fa/enable [post]
+func (h *Handler) CompleteTwoFactorEnrolment(c *gin.Context) {
+	var req TwoFactorEnrolmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+	if req.Code == "" {
+		middleware.AbortWithBadRequest(c, "code is required")
+		return
+	}
+
+	enrolment, err := h.service.CompleteTwoFactorEnrolment(c.Request.Context(), req.ChallengeToken, req.Code)
+	if err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    enrolment,
+		Message: "Two-factor authentication enabled. Store the recovery codes somewhere safe.",
+	})
+}
+
+// GetTwoFactorStatus handles getting the current user's two-factor state
+// @Summary Get two-factor status
+// @Description Get whether two-factor authentication is enabled, required by the company, and how many recovery codes remain
+// @Tags auth
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=TwoFactorStatusResponse}
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/auth/2fa [get]
+// @Security BearerAuth
+func (h *Handler) GetTwoFactorStatus(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "User ID not found in context")
+		return
+	}
+
+	status, err := h.service.GetTwoFactorStatus(c.Request.Context(), userID.(string))
+	if err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    status,
+	})
+}
+
+// SetupTwoFactor handles generating a TOTP secret for the current user
+// @Summary Start two-factor setup
+// @Description Generate a TOTP secret and otpauth URI. Two-factor authentication is enabled once a code is confirmed at /auth/2fa/enable.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=TwoFactorSetupResponse}
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Already enabled"
+// @Router /api/v1/auth/2fa/setup [post]
+// @Security BearerAuth
+func (h *Handler) SetupTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "User ID not found in context")
+		return
+	}
+
+	setup, err := h.service.SetupTwoFactor(c.Request.Context(), userID.(string))
+	if err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    setup,
+		Message: "Add the secret to your authenticator app and confirm with a code",
+	})
+}
+
+// EnableTwoFactor handles confirming the TOTP secret
+// @Summary Enable two-factor authentication
+// @Description Confirm the secret from /auth/2fa/setup with a code and receive one-time recovery codes
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/auth/2fa/enable [post]
+// @Security BearerAuth
+func (h *Handler) EnableTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	codes, err := h.service.EnableTwoFactor(c.Request.Context(), userID.(string), req.Code)
+	if err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    gin.H{"recovery_codes": codes},
+		Message: "Two-factor authentication enabled. Store the recovery codes somewhere safe.",
+	})
+}
+
+// DisableTwoFactor handles turning two-factor authentication off
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication with the password and a current code. Not allowed when the company requires it.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body DisableTwoFactorRequest true "Password and TOTP code"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Required by company policy"
+// @Router /api/v1/auth/2fa/disable [post]
+// @Security BearerAuth
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	if err := h.service.DisableTwoFactor(c.Request.Context(), userID.(string), req.Password, req.Code); err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Message: "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes handles replacing the recovery codes
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes after confirming a current code. Previous codes stop working.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/auth/2fa/recovery-codes [post]
+// @Security BearerAuth
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "User ID not found in context")
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(c.Request.Context(), userID.(string), req.Code)
+	if err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    gin.H{"recovery_codes": codes},
+		Message: "Recovery codes regenerated",
+	})
+}
+
+// SetTwoFactorPolicy handles the company-wide two-factor policy
+// @Summary Set company two-factor policy
+// @Description Require two-factor authentication for every user of the company (owner/admin only). Users who are not enrolled must enrol at their next login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body TwoFactorPolicyRequest true "Policy"
+// @Success 200 {object} SuccessResponse{data=TwoFactorPolicyResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/auth/2fa/policy [put]
+// @Security BearerAuth
+func (h *Handler) SetTwoFactorPolicy(c *gin.Context) {
+	userRole, _ := c.Get("user_role")
+	companyID, _ := c.Get("company_id")
+
+	var req TwoFactorPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	role, _ := userRole.(string)
+	company, _ := companyID.(string)
+	policy, err := h.service.SetTwoFactorPolicy(c.Request.Context(), role, company, *req.Required)
+	if err != nil {
+		abortWithServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    policy,
+		Message: "Two-factor policy updated",
+	})
+}
+
+// abortWithServiceError responds with the status of an AppError, or 500
+func abortWithServiceError(c *gin.Context, err error) {
+	if appErr, ok := err.(*apperrors.AppError); ok {
+		middleware.AbortWithError(c, appErr)
+		return
+	}
+	middleware.AbortWithInternal(c, "Two-factor authentication failed", err)
+}
@@ -18,6 +18,7 @@ import (
 // @Success 201 {object} SuccessResponse{data=UserResponse}
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 402 {object} ErrorResponse "User limit of the subscription plan reached"
 // @Failure 403 {object} ErrorResponse
 // @Router /api/v1/users [post]
 // @Security BearerAuth
@@ -5,11 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
-	"log"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/realtime"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/validators"
 	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
@@ -35,23 +37,6 @@ func generateTemporaryPassword() (string, error) {
 	return password + "!Aa1", nil
 }
 
-// sendInvitationEmail sends an email with login credentials to the new user
-func sendInvitationEmail(email, name, tempPassword string) {
-	// TODO: Implement actual email sending with SendGrid/AWS SES
-	// For now, just log the credentials
-	log.Println("")
-	log.Println("📧 ═══════════════════════════════════════════════════════════")
-	log.Printf("📧 USER INVITATION EMAIL")
-	log.Println("📧 ═══════════════════════════════════════════════════════════")
-	log.Printf("📧 To: %s (%s)", email, name)
-	log.Printf("📧 Login URL: http://localhost:8080/api/v1/auth/login")
-	log.Printf("📧 Email: %s", email)
-	log.Printf("📧 Temporary Password: %s", tempPassword)
-	log.Println("📧 ⚠️  You must change your password on first login!")
-	log.Println("📧 ═══════════════════════════════════════════════════════════")
-	log.Println("")
-}
-
 // toUserResponse converts models.User to UserResponse
 func toUserResponse(user *models.User) *UserResponse {
 	return &UserResponse{
@@ -66,6 +51,7 @@ func toUserResponse(user *models.User) *UserResponse {
 		IsActive:           user.IsActive,
 		IsVerified:         user.IsVerified,
 		MustChangePassword: user.MustChangePassword, // NEW: Include force password change flag
+		TwoFactorEnabled:   user.TwoFactorEnabled,
 		LastLoginAt:        user.LastLoginAt,
 		CreatedAt:          user.CreatedAt,
 	}
@@ -79,6 +65,7 @@ type CreateUserRequest struct {
 	LastName  string `json:"last_name" binding:"required"`
 	Phone     string `json:"phone"`
 	Role      string `json:"role" binding:"required"`
+	Language  string `json:"language"`   // id or en; emails to the user use it, default id
 	CompanyID string `json:"company_id"` // For super-admin creating users in other companies
 }
 
@@ -101,6 +88,11 @@ func (s *Service) CreateUser(ctx context.Context, creatorUserID, creatorRole, cr
 	if !IsValidRole(req.Role) {
 		return nil, apperrors.NewValidationError(fmt.Sprintf("invalid role: %s", req.Role))
 	}
+	if req.Language != "" {
+		if err := validators.ValidateLanguage(req.Language); err != nil {
+			return nil, apperrors.NewValidationError(err.Error())
+		}
+	}
 
 	// Check if creator can create users
 	if !CanManageUsers(creatorRole) {
@@ -166,18 +158,26 @@ func (s *Service) CreateUser(ctx context.Context, creatorUserID, creatorRole, cr
 		LastName:           req.LastName,
 		Phone:              req.Phone,
 		Role:               req.Role,
+		Language:           strings.ToLower(strings.TrimSpace(req.Language)),
 		IsActive:           true,
 		Status:             "active",
 		MustChangePassword: true, // NEW: Force password change on first login
 	}
 
-	if err := s.db.Create(user).Error; err != nil {
-		return nil, apperrors.NewInternalError(err.Error()).WithInternal(err)
+	// Save within the user limit of the subscription plan
+	err = s.entitlements.WithinUserLimit(ctx, companyID, func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return apperrors.NewInternalError(err.Error()).WithInternal(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, apperrors.GetAppError(err)
 	}
 
 	// Send invitation email if temporary password was generated
 	if tempPassword != "" {
-		go sendInvitationEmail(user.Email, user.GetFullName(), tempPassword)
+		s.sendInvitationEmail(ctx, user, company.Name, tempPassword)
 	}
 
 	// Clear password before returning
@@ -347,6 +347,9 @@ func (s *Service) DeactivateUser(ctx context.Context, userRole, companyID, targe
 		}
 	}
 
+	// Close live WebSocket connections of the user
+	s.notifySessionRevoked(ctx, realtime.SessionRevocation{UserID: targetUserID})
+
 	return nil
 }
 
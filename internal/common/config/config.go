@@ -24,31 +24,21 @@ type Config struct {
 	JWTAccessExpiry         time.Duration
 	JWTRefreshExpiry        time.Duration
 	BcryptCost              int
+	TwoFactorEncryptionKey   string            // encrypts TOTP secrets at rest
+	TwoFactorEncryptionKeyID string            // stored with each secret so the key can be rotated
+	TwoFactorPreviousKeys    map[string]string // key id -> retired key, still used to decrypt
 
 	// Indonesian Payment Integration
-	QRISAPIURL              string
-	QRISAPIKey              string
-	QRISMerchantID          string
-
-	// Bank Transfer APIs
-	BCAAPIURL               string
-	BCAAPIKey               string
-	MandiriAPIURL           string
-	MandiriAPIKey           string
-	BNIAPIURL               string
-	BNIAPIKey               string
-	BRIAPIURL               string
-	BRIAPIKey               string
-
-	// E-Wallet APIs
-	GoPayAPIURL             string
-	GoPayAPIKey             string
-	OVOAPIURL               string
-	OVOAPIKey               string
-	DANAAPIURL              string
-	DANAAPIKey              string
-	ShopeePayAPIURL         string
-	ShopeePayAPIKey         string
+	PaymentGatewayMode      string // live or fake
+	PaymentWebhookSecrets   map[string]string // provider -> webhook signing secret
+	PaymentWebhookTolerance time.Duration
+	MidtransAPIURL          string // Midtrans Core API, the live gateway of every payment channel
+	MidtransServerKey       string
+
+	// Invoice issuer (seller) printed on e-Faktur invoices
+	InvoiceIssuerName       string
+	InvoiceIssuerNPWP       string
+	InvoiceIssuerAddress    string
 
 	// External APIs
 	GoogleMapsAPIKey        string
@@ -58,17 +48,43 @@ type Config struct {
 	WhatsAppAPIURL          string
 	WhatsAppAccessToken     string
 	WhatsAppPhoneNumberID   string
+	WhatsAppAppSecret       string // signs WhatsApp status webhooks
+	WhatsAppVerifyToken     string // answers the WhatsApp webhook subscription check
 	SMSAPIURL               string
 	SMSAPIKey               string
+	SMSSenderID             string
+	SMSWebhookSecret        string // signs SMS delivery reports
 
 	// GPS Tracking Configuration
 	GPSUpdateInterval       int
 	GPSAccuracyThreshold    float64
-	DefaultSpeedLimit       int
-	HighwaySpeedLimit       int
+	DefaultSpeedLimit       int     // km/h, default speed violation threshold (typical urban limit)
+	HighwaySpeedLimit       int     // km/h, speeding above it is critical severity
 	CitySpeedLimit          int
-	HarshBrakingThreshold   float64
-	RapidAccelerationThreshold float64
+	HarshBrakingThreshold   float64 // g, default harsh braking threshold
+	RapidAccelerationThreshold float64 // g, default rapid acceleration threshold
+	VehicleOfflineThreshold time.Duration // silence before a vehicle is marked offline, unless the company overrides it
+	TripIdleTimeout         time.Duration // idling with the engine running this long ends a detected trip
+	TripMaxGPSGap           time.Duration // no fix for this long ends a detected trip
+	MapGraphPath            string        // OSM road network exported to GeoJSON for map matching and route optimization; empty disables them
+
+	// Tracker Gateway (TCP listener for hardwired GPS trackers)
+	TrackerGatewayAddr        string        // e.g. ":5027"; empty disables the gateway
+	TrackerGatewayIdleTimeout time.Duration // close tracker connections silent for this long
+
+	// Data Exports (large exports are written to blob storage by background jobs)
+	ExportStorageDriver string        // "local" or "s3"
+	ExportStorageDir    string        // directory of the local driver
+	ExportPublicURL     string        // base URL of the local driver's signed download links
+	ExportLinkSecret    string        // signs the local driver's download links
+	ExportS3Endpoint    string        // S3-compatible endpoint, e.g. MinIO; empty uses AWS
+	ExportS3Region      string
+	ExportS3Bucket      string
+	ExportS3AccessKey   string
+	ExportS3SecretKey   string
+	ExportS3PathStyle   bool
+	ExportLinkTTL       time.Duration // lifetime of signed download links
+	ExportRetention     time.Duration // export files are deleted this long after completing
 
 	// Indonesian Market Configuration
 	DefaultCurrency         string
@@ -103,6 +119,10 @@ type Config struct {
 	SMTPUsername            string
 	SMTPPassword            string
 	SMTPFromAddress         string
+	SMTPFromName            string
+	EmailDriver             string // "smtp" or "file"; empty uses SMTP when SMTP credentials are set
+	EmailDir                string // directory the file driver writes .eml files to
+	AppURL                  string // base URL of the web app that emails link to
 
 	// Development Configuration
 	Debug                   bool
@@ -110,12 +130,17 @@ type Config struct {
 	CORSAllowedOrigins      []string
 	CORSAllowedMethods      []string
 	CORSAllowedHeaders      []string
+	WebSocketAllowedOrigins []string // browser origins allowed to open WebSocket connections
 
 	// Database Connection Pooling
 	DBMaxOpenConns          int
 	DBMaxIdleConns          int
 	DBConnMaxLifetime       time.Duration
 
+	// Database Migrations
+	MigrationsDir           string
+	MigrateOnStartup        bool // apply pending migrations when the server starts
+
 	// Cache Configuration
 	CacheTTL                time.Duration
 	CacheMaxSize            int
@@ -146,31 +171,21 @@ func Load() *Config {
 		JWTAccessExpiry:  getDurationEnv("JWT_ACCESS_EXPIRY", 15*time.Minute),
 		JWTRefreshExpiry: getDurationEnv("JWT_REFRESH_EXPIRY", 7*24*time.Hour),
 		BcryptCost:       getIntEnv("BCRYPT_COST", 12),
+		TwoFactorEncryptionKey:   getEnv("TWO_FACTOR_ENCRYPTION_KEY", ""),
+		TwoFactorEncryptionKeyID: strings.ToLower(getEnv("TWO_FACTOR_ENCRYPTION_KEY_ID", "1")), // matches the lower-cased TWO_FACTOR_PREVIOUS_KEYS ids
+		TwoFactorPreviousKeys:    getMapEnv("TWO_FACTOR_PREVIOUS_KEYS"), // e.g. "1=old-key"
 
 		// Indonesian Payment Integration
-		QRISAPIURL:     getEnv("QRIS_API_URL", "https://api.qris.id"),
-		QRISAPIKey:     getEnv("QRIS_API_KEY", ""),
-		QRISMerchantID: getEnv("QRIS_MERCHANT_ID", ""),
-
-		// Bank Transfer APIs
-		BCAAPIURL:     getEnv("BCA_API_URL", "https://api.bca.co.id"),
-		BCAAPIKey:     getEnv("BCA_API_KEY", ""),
-		MandiriAPIURL: getEnv("MANDIRI_API_URL", "https://api.mandiri.co.id"),
-		MandiriAPIKey: getEnv("MANDIRI_API_KEY", ""),
-		BNIAPIURL:     getEnv("BNI_API_URL", "https://api.bni.co.id"),
-		BNIAPIKey:     getEnv("BNI_API_KEY", ""),
-		BRIAPIURL:     getEnv("BRI_API_URL", "https://api.bri.co.id"),
-		BRIAPIKey:     getEnv("BRI_API_KEY", ""),
-
-		// E-Wallet APIs
-		GoPayAPIURL:     getEnv("GOPAY_API_URL", "https://api.gopay.co.id"),
-		GoPayAPIKey:     getEnv("GOPAY_API_KEY", ""),
-		OVOAPIURL:       getEnv("OVO_API_URL", "https://api.ovo.id"),
-		OVOAPIKey:       getEnv("OVO_API_KEY", ""),
-		DANAAPIURL:      getEnv("DANA_API_URL", "https://api.dana.id"),
-		DANAAPIKey:      getEnv("DANA_API_KEY", ""),
-		ShopeePayAPIURL: getEnv("SHOPEEPAY_API_URL", "https://api.shopee.co.id"),
-		ShopeePayAPIKey: getEnv("SHOPEEPAY_API_KEY", ""),
+		PaymentGatewayMode: getEnv("PAYMENT_GATEWAY_MODE", "live"),
+		PaymentWebhookSecrets: getMapEnv("PAYMENT_WEBHOOK_SECRETS"), // e.g. "fake=secret1"; Midtrans signs with its server key
+		PaymentWebhookTolerance: getDurationEnv("PAYMENT_WEBHOOK_TOLERANCE", 5*time.Minute),
+		MidtransAPIURL:    getEnv("MIDTRANS_API_URL", "https://api.sandbox.midtrans.com"),
+		MidtransServerKey: getEnv("MIDTRANS_SERVER_KEY", ""),
+
+		// Invoice issuer
+		InvoiceIssuerName:    getEnv("INVOICE_ISSUER_NAME", "PT FleetTracker Indonesia"),
+		InvoiceIssuerNPWP:    getEnv("INVOICE_ISSUER_NPWP", ""),
+		InvoiceIssuerAddress: getEnv("INVOICE_ISSUER_ADDRESS", "Jakarta, Indonesia"),
 
 		// External APIs
 		GoogleMapsAPIKey:      getEnv("GOOGLE_MAPS_API_KEY", ""),
@@ -180,17 +195,43 @@ func Load() *Config {
 		WhatsAppAPIURL:        getEnv("WHATSAPP_API_URL", "https://graph.facebook.com/v18.0"),
 		WhatsAppAccessToken:   getEnv("WHATSAPP_ACCESS_TOKEN", ""),
 		WhatsAppPhoneNumberID: getEnv("WHATSAPP_PHONE_NUMBER_ID", ""),
+		WhatsAppAppSecret:     getEnv("WHATSAPP_APP_SECRET", ""),
+		WhatsAppVerifyToken:   getEnv("WHATSAPP_VERIFY_TOKEN", ""),
 		SMSAPIURL:             getEnv("SMS_API_URL", "https://api.sms-gateway.id"),
 		SMSAPIKey:             getEnv("SMS_API_KEY", ""),
+		SMSSenderID:           getEnv("SMS_SENDER_ID", "FleetTrack"),
+		SMSWebhookSecret:      getEnv("SMS_WEBHOOK_SECRET", ""),
 
 		// GPS Tracking Configuration
 		GPSUpdateInterval:         getIntEnv("GPS_UPDATE_INTERVAL", 30),
 		GPSAccuracyThreshold:      getFloatEnv("GPS_ACCURACY_THRESHOLD", 5.0),
-		DefaultSpeedLimit:         getIntEnv("DEFAULT_SPEED_LIMIT", 100),
+		DefaultSpeedLimit:         getIntEnv("DEFAULT_SPEED_LIMIT", 80),
 		HighwaySpeedLimit:         getIntEnv("HIGHWAY_SPEED_LIMIT", 120),
 		CitySpeedLimit:            getIntEnv("CITY_SPEED_LIMIT", 60),
 		HarshBrakingThreshold:     getFloatEnv("HARSH_BRAKING_THRESHOLD", 0.4),
 		RapidAccelerationThreshold: getFloatEnv("RAPID_ACCELERATION_THRESHOLD", 0.3),
+		VehicleOfflineThreshold:    getDurationEnv("VEHICLE_OFFLINE_THRESHOLD", 30*time.Minute),
+		TripIdleTimeout:            getDurationEnv("TRIP_IDLE_TIMEOUT", 10*time.Minute),
+		TripMaxGPSGap:              getDurationEnv("TRIP_MAX_GPS_GAP", 15*time.Minute),
+		MapGraphPath:               getEnv("MAP_GRAPH_PATH", ""),
+
+		// Tracker Gateway
+		TrackerGatewayAddr:        getEnv("TRACKER_GATEWAY_ADDR", ""),
+		TrackerGatewayIdleTimeout: getDurationEnv("TRACKER_GATEWAY_IDLE_TIMEOUT", 10*time.Minute),
+
+		// Data Exports
+		ExportStorageDriver: getEnv("EXPORT_STORAGE_DRIVER", "local"),
+		ExportStorageDir:    getEnv("EXPORT_STORAGE_DIR", "./storage/exports"),
+		ExportPublicURL:     getEnv("EXPORT_PUBLIC_URL", "http://localhost:8080/api/v1/exports/files"),
+		ExportLinkSecret:    getEnv("EXPORT_LINK_SECRET", ""),
+		ExportS3Endpoint:    getEnv("EXPORT_S3_ENDPOINT", ""),
+		ExportS3Region:      getEnv("EXPORT_S3_REGION", "ap-southeast-3"),
+		ExportS3Bucket:      getEnv("EXPORT_S3_BUCKET", ""),
+		ExportS3AccessKey:   getEnv("EXPORT_S3_ACCESS_KEY", ""),
+		ExportS3SecretKey:   getEnv("EXPORT_S3_SECRET_KEY", ""),
+		ExportS3PathStyle:   getBoolEnv("EXPORT_S3_PATH_STYLE", false),
+		ExportLinkTTL:       getDurationEnv("EXPORT_LINK_TTL", time.Hour),
+		ExportRetention:     getDurationEnv("EXPORT_RETENTION", 24*time.Hour),
 
 		// Indonesian Market Configuration
 		DefaultCurrency:   getEnv("DEFAULT_CURRENCY", "IDR"),
@@ -225,6 +266,10 @@ func Load() *Config {
 		SMTPUsername:    getEnv("SMTP_USERNAME", ""),
 		SMTPPassword:    getEnv("SMTP_PASSWORD", ""),
 		SMTPFromAddress: getEnv("SMTP_FROM_ADDRESS", "noreply@fleettracker.id"),
+		SMTPFromName:    getEnv("SMTP_FROM_NAME", "FleetTracker Pro"),
+		EmailDriver:     getEnv("EMAIL_DRIVER", ""),
+		EmailDir:        getEnv("EMAIL_DIR", "./storage/emails"),
+		AppURL:          getEnv("APP_URL", "http://localhost:5173"),
 
 		// Development Configuration
 		Debug:               getBoolEnv("DEBUG", true),
@@ -232,12 +277,17 @@ func Load() *Config {
 		CORSAllowedOrigins:  strings.Split(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:5173,http://localhost:3000"), ","),
 		CORSAllowedMethods:  strings.Split(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE,OPTIONS"), ","),
 		CORSAllowedHeaders:  strings.Split(getEnv("CORS_ALLOWED_HEADERS", "Origin,Content-Type,Authorization"), ","),
+		WebSocketAllowedOrigins: strings.Split(getEnv("WS_ALLOWED_ORIGINS", getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:5173,http://localhost:3000")), ","),
 
 		// Database Connection Pooling
 		DBMaxOpenConns:    getIntEnv("DB_MAX_OPEN_CONNS", 100),
 		DBMaxIdleConns:    getIntEnv("DB_MAX_IDLE_CONNS", 10),
 		DBConnMaxLifetime: getDurationEnv("DB_CONN_MAX_LIFETIME", time.Hour),
 
+		// Database Migrations
+		MigrationsDir:    getEnv("MIGRATIONS_DIR", "migrations"),
+		MigrateOnStartup: getBoolEnv("MIGRATE_ON_STARTUP", false),
+
 		// Cache Configuration
 		CacheTTL:     getDurationEnv("CACHE_TTL", 5*time.Minute),
 		CacheMaxSize: getIntEnv("CACHE_MAX_SIZE", 1000),
@@ -305,3 +355,16 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+// getMapEnv parses "key=value,key=value" pairs; keys are lower-cased
+func getMapEnv(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || name == "" {
+			continue
+		}
+		result[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+	return result
+}
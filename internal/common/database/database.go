@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/migrate"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -108,27 +109,21 @@ func ConnectTimescaleDB(timeseriesURL string) (*gorm.DB, error) {
 	return db, nil
 }
 
-// AutoMigrate runs database migrations
-func AutoMigrate(db *gorm.DB) error {
+// AutoMigrate applies the pending SQL migrations in dir
+func AutoMigrate(db *gorm.DB, dir string) error {
 	log.Println("🔄 Running database migrations...")
 
-	// Import models here when they are created
-	// err := db.AutoMigrate(
-	//     &models.User{},
-	//     &models.Company{},
-	//     &models.Vehicle{},
-	//     &models.Driver{},
-	//     &models.GPSTrack{},
-	//     &models.DriverEvent{},
-	//     &models.Trip{},
-	//     &models.Payment{},
-	//     &models.Subscription{},
-	// )
-
-	// For now, just log that migrations would run here
-	log.Println("📝 Database migrations would run here")
-	log.Println("✅ Database migrations completed")
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+
+	applied, err := migrate.New(sqlDB, dir).Up(context.Background(), 0)
+	if err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
 
+	log.Printf("✅ Database migrations completed (%d applied)", len(applied))
 	return nil
 }
 
@@ -0,0 +1,212 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is an email ready to be sent
+type Message struct {
+	From        string // "Name <address>" or an address
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string // optional alternative to Text
+	Attachments []Attachment
+	MessageID   string // Message-ID header without angle brackets
+	Date        time.Time
+}
+
+// Attachment is a file attached to a message
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Sender delivers messages. Senders return a PermanentError when the message
+// can never be delivered, e.g. the server rejected the recipient.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// PermanentError is a delivery failure that retrying will not fix
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether a delivery failure should not be retried
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// Bytes renders the message in RFC 5322 format with MIME parts: the text
+// and HTML bodies as alternatives, followed by the attachments.
+func (m *Message) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", m.From, err)
+	}
+	if len(m.To) == 0 {
+		return nil, fmt.Errorf("message has no recipients")
+	}
+	to := make([]string, 0, len(m.To))
+	for _, recipient := range m.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", recipient, err)
+		}
+		to = append(to, address.String())
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "From", from.String())
+	writeHeader(&buf, "To", strings.Join(to, ", "))
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	if m.MessageID != "" {
+		writeHeader(&buf, "Message-ID", "<"+m.MessageID+">")
+	}
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	bodyHeader, body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Attachments) == 0 {
+		for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if value := bodyHeader.Get(name); value != "" {
+				writeHeader(&buf, name, value)
+			}
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mixed.Boundary()}))
+	buf.WriteString("\r\n")
+	part, err := mixed.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(body); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range m.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"name": attachment.Name}))
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+		header.Set("Content-Transfer-Encoding", "base64")
+		part, err := mixed.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// body renders the text body, or the text and HTML alternatives, with the
+// headers describing it
+func (m *Message) body() (textproto.MIMEHeader, []byte, error) {
+	var buf bytes.Buffer
+	header := textproto.MIMEHeader{}
+	if m.HTML == "" {
+		header.Set("Content-Type", "text/plain; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, nil, err
+		}
+		return header, buf.Bytes(), nil
+	}
+
+	alternative := multipart.NewWriter(&buf)
+	header.Set("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": alternative.Boundary()}))
+	for _, body := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		partHeader := textproto.MIMEHeader{}
+		partHeader.Set("Content-Type", body.contentType)
+		partHeader.Set("Content-Transfer-Encoding", "quoted-printable")
+		part, err := alternative.CreatePart(partHeader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeQuotedPrintable(part, body.content); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, nil, err
+	}
+	return header, buf.Bytes(), nil
+}
+
+// writeHeader writes a header line
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+// writeQuotedPrintable writes text in quoted-printable encoding with CRLF
+// line endings
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64 writes data in base64 lines of 76 characters
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := w.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := w.Write([]byte(encoded + "\r\n"))
+	return err
+}
@@ -0,0 +1,140 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMessage() *Message {
+	return &Message{
+		From:      "FleetTracker Pro <noreply@fleettracker.id>",
+		To:        []string{"budi@example.co.id"},
+		Subject:   "Laporan siap: Ringkasan Armada",
+		Text:      "Halo Budi,\nLaporan Anda sudah siap.\n",
+		HTML:      "<p>Halo Budi,</p>",
+		MessageID: "abc123@fleettracker.id",
+		Date:      time.Date(2024, 6, 3, 7, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestMessage_Alternatives(t *testing.T) {
+	data, err := testMessage().Bytes()
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, `"FleetTracker Pro" <noreply@fleettracker.id>`, msg.Header.Get("From"))
+	assert.Equal(t, "<budi@example.co.id>", msg.Header.Get("To"))
+	assert.Equal(t, "<abc123@fleettracker.id>", msg.Header.Get("Message-ID"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Laporan siap: Ringkasan Armada", subject)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	text, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", text.Header.Get("Content-Type"))
+	body, err := io.ReadAll(text)
+	require.NoError(t, err)
+	assert.Equal(t, "Halo Budi,\r\nLaporan Anda sudah siap.\r\n", string(body))
+
+	html, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/html; charset=utf-8", html.Header.Get("Content-Type"))
+	body, err = io.ReadAll(html)
+	require.NoError(t, err)
+	assert.Equal(t, "<p>Halo Budi,</p>", string(body))
+
+	_, err = reader.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessage_TextOnly(t *testing.T) {
+	message := testMessage()
+	message.HTML = ""
+	message.Text = "Sisa anggaran: 100%"
+
+	data, err := message.Bytes()
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", msg.Header.Get("Content-Type"))
+	assert.Equal(t, "quoted-printable", msg.Header.Get("Content-Transfer-Encoding"))
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "Sisa anggaran: 100%", string(body))
+}
+
+func TestMessage_Attachments(t *testing.T) {
+	message := testMessage()
+	pdf := bytes.Repeat([]byte("%PDF-1.4 report "), 20)
+	message.Attachments = []Attachment{{Name: "laporan armada.pdf", ContentType: "application/pdf", Data: pdf}}
+
+	data, err := message.Bytes()
+	require.NoError(t, err)
+	for _, line := range strings.Split(string(data), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998, "line too long")
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := reader.NextPart()
+	require.NoError(t, err)
+	mediaType, _, err = mime.ParseMediaType(body.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	attachment, err := reader.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "laporan armada.pdf", attachment.FileName())
+	assert.Equal(t, "base64", attachment.Header.Get("Content-Transfer-Encoding"))
+	// multipart decodes quoted-printable only; decode base64 here
+	encoded, err := io.ReadAll(attachment)
+	require.NoError(t, err)
+	decoded, err := decodeBase64Lines(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, pdf, decoded)
+}
+
+func TestMessage_InvalidAddresses(t *testing.T) {
+	message := testMessage()
+	message.To = []string{"not an address"}
+	_, err := message.Bytes()
+	assert.Error(t, err)
+
+	message = testMessage()
+	message.To = nil
+	_, err = message.Bytes()
+	assert.Error(t, err)
+}
+
+func TestIsPermanent(t *testing.T) {
+	assert.True(t, IsPermanent(&PermanentError{Err: io.EOF}))
+	assert.False(t, IsPermanent(io.EOF))
+	assert.False(t, IsPermanent(nil))
+}
+
+func decodeBase64Lines(encoded []byte) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+}
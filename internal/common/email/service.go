@@ -0,0 +1,252 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// maxAttachmentBytes limits the total size of a message's attachments
+const maxAttachmentBytes = 10 << 20
+
+// Queue delivers recorded emails in the background, retrying failures
+type Queue interface {
+	EnqueueEmail(ctx context.Context, userID, emailID string) error
+}
+
+// Service records outgoing emails and delivers them through a sender
+type Service struct {
+	db        *gorm.DB
+	sender    Sender
+	from      string
+	templates *Templates
+	queue     Queue
+}
+
+// Email is an email to send: a template rendered in the recipient's
+// language, or a plain subject and body
+type Email struct {
+	CompanyID   string
+	UserID      string // user the email is sent for
+	To          string
+	Language    string // empty uses the language of the recipient's account, then of UserID
+	Template    string
+	Data        map[string]interface{}
+	Subject     string // plain emails
+	Text        string
+	HTML        string
+	Attachments []Attachment
+	Sensitive   bool // erase the bodies once the email is settled
+}
+
+// NewService creates an email service sending from an address, e.g.
+// "FleetTracker Pro <noreply@fleettracker.id>"
+func NewService(db *gorm.DB, sender Sender, from string) *Service {
+	templates, err := LoadTemplates()
+	if err != nil {
+		panic(err) // the templates are embedded in the binary
+	}
+	return &Service{
+		db:        db,
+		sender:    sender,
+		from:      from,
+		templates: templates,
+	}
+}
+
+// SetQueue sets the queue delivering emails. Without a queue emails are
+// delivered while sending them.
+func (s *Service) SetQueue(queue Queue) {
+	s.queue = queue
+}
+
+// Send records an email and queues its delivery
+func (s *Service) Send(ctx context.Context, email *Email) (*models.EmailMessage, error) {
+	message, err := s.Create(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.queue == nil {
+		return message, s.Deliver(ctx, message.ID, true)
+	}
+	if err := s.queue.EnqueueEmail(ctx, email.UserID, message.ID); err != nil {
+		s.settle(ctx, message, models.EmailStatusFailed, fmt.Sprintf("failed to queue email: %v", err))
+		return nil, fmt.Errorf("failed to queue email: %w", err)
+	}
+	return message, nil
+}
+
+// Create renders and records an email without sending it
+func (s *Service) Create(ctx context.Context, email *Email) (*models.EmailMessage, error) {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", email.To, err)
+	}
+	size := 0
+	attachments := make([]models.EmailAttachment, 0, len(email.Attachments))
+	for _, attachment := range email.Attachments {
+		size += len(attachment.Data)
+		attachments = append(attachments, models.EmailAttachment{
+			Name:        attachment.Name,
+			ContentType: attachment.ContentType,
+			Data:        attachment.Data,
+		})
+	}
+	if size > maxAttachmentBytes {
+		return nil, fmt.Errorf("attachments exceed %d MB", maxAttachmentBytes>>20)
+	}
+
+	message := &models.EmailMessage{
+		Recipient:   to.Address,
+		Sender:      s.from,
+		Subject:     email.Subject,
+		TextBody:    email.Text,
+		HTMLBody:    email.HTML,
+		Attachments: attachments,
+		Sensitive:   email.Sensitive,
+		Status:      models.EmailStatusQueued,
+		MessageID:   newMessageID(s.from),
+	}
+	if email.Template != "" {
+		message.Template = email.Template
+		message.Language = s.language(ctx, email, to.Address)
+		rendered, err := s.templates.Render(email.Template, message.Language, email.Data)
+		if err != nil {
+			return nil, err
+		}
+		message.Subject, message.TextBody, message.HTMLBody = rendered.Subject, rendered.Text, rendered.HTML
+	}
+	if message.Subject == "" || (message.TextBody == "" && message.HTMLBody == "") {
+		return nil, fmt.Errorf("email needs a subject and a body")
+	}
+	if email.CompanyID != "" {
+		message.CompanyID = &email.CompanyID
+	}
+	if email.UserID != "" {
+		message.UserID = &email.UserID
+	}
+
+	if err := s.db.WithContext(ctx).Create(message).Error; err != nil {
+		return nil, fmt.Errorf("failed to record email: %w", err)
+	}
+	return message, nil
+}
+
+// Deliver sends a recorded email. Emails already sent are not sent again and
+// permanent failures, such as rejected recipients, are not retried. Other
+// failures are returned so the queue retries them, except on the last
+// attempt, which marks the email failed.
+func (s *Service) Deliver(ctx context.Context, emailID string, lastAttempt bool) error {
+	var message models.EmailMessage
+	if err := s.db.WithContext(ctx).First(&message, "id = ?", emailID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load email: %w", err)
+	}
+	if message.Status != models.EmailStatusQueued {
+		return nil
+	}
+
+	attachments := make([]Attachment, 0, len(message.Attachments))
+	for _, attachment := range message.Attachments {
+		attachments = append(attachments, Attachment{
+			Name:        attachment.Name,
+			ContentType: attachment.ContentType,
+			Data:        attachment.Data,
+		})
+	}
+	err := s.sender.Send(ctx, &Message{
+		From:        message.Sender,
+		To:          []string{message.Recipient},
+		Subject:     message.Subject,
+		Text:        message.TextBody,
+		HTML:        message.HTMLBody,
+		Attachments: attachments,
+		MessageID:   message.MessageID,
+		Date:        message.CreatedAt,
+	})
+	message.Attempts++
+
+	switch {
+	case err == nil:
+		s.settle(ctx, &message, models.EmailStatusSent, "")
+		return nil
+	case IsPermanent(err) || lastAttempt:
+		s.settle(ctx, &message, models.EmailStatusFailed, err.Error())
+		fmt.Printf("Failed to send email %s to %s: %v\n", message.ID, message.Recipient, err)
+		return nil
+	default:
+		if updateErr := s.db.WithContext(ctx).Model(&message).Updates(map[string]interface{}{
+			"attempts":   message.Attempts,
+			"last_error": err.Error(),
+		}).Error; updateErr != nil {
+			fmt.Printf("Failed to record attempt of email %s: %v\n", message.ID, updateErr)
+		}
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+}
+
+// settle records the final status of an email, dropping its attachments and
+// the bodies of sensitive emails
+func (s *Service) settle(ctx context.Context, message *models.EmailMessage, status, lastError string) {
+	updates := map[string]interface{}{
+		"status":      status,
+		"attempts":    message.Attempts,
+		"last_error":  lastError,
+		"attachments": nil,
+	}
+	if status == models.EmailStatusSent {
+		updates["sent_at"] = time.Now()
+	}
+	if message.Sensitive {
+		updates["text_body"] = ""
+		updates["html_body"] = ""
+	}
+	if err := s.db.WithContext(ctx).Model(message).Updates(updates).Error; err != nil {
+		fmt.Printf("Failed to record status of email %s: %v\n", message.ID, err)
+	}
+}
+
+// language picks the template language of an email: the requested one, the
+// recipient's if they have an account, or the language of the user it is
+// sent for
+func (s *Service) language(ctx context.Context, email *Email, recipient string) string {
+	if email.Language != "" {
+		return NormalizeLanguage(email.Language)
+	}
+	var user models.User
+	if err := s.db.WithContext(ctx).Select("language").Where("LOWER(email) = ?", strings.ToLower(recipient)).
+		First(&user).Error; err == nil {
+		return NormalizeLanguage(user.Language)
+	}
+	if email.UserID != "" {
+		if err := s.db.WithContext(ctx).Select("language").First(&user, "id = ?", email.UserID).Error; err == nil {
+			return NormalizeLanguage(user.Language)
+		}
+	}
+	return DefaultLanguage
+}
+
+// newMessageID creates a unique Message-ID in the sender's domain
+func newMessageID(from string) string {
+	domain := "fleettracker.id"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if _, host, ok := strings.Cut(address.Address, "@"); ok {
+			domain = host
+		}
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b) + "@" + domain
+}
@@ -0,0 +1,114 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config selects and configures the sender of outgoing email
+type Config struct {
+	Driver       string // "smtp" or "file"; empty uses SMTP when credentials are set
+	Dir          string // directory of the file driver
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// New creates the sender selected by the configuration
+func New(cfg Config) (Sender, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = "file"
+		if cfg.SMTPHost != "" && cfg.SMTPUsername != "" {
+			driver = "smtp"
+		}
+	}
+
+	switch driver {
+	case "smtp":
+		return NewSMTPSender(SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		})
+	case "file":
+		return NewFileSink(cfg.Dir)
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", cfg.Driver)
+	}
+}
+
+// FileSink writes messages to .eml files instead of sending them, for
+// development
+type FileSink struct {
+	dir string
+}
+
+// NewFileSink creates a file sink writing to a directory
+func NewFileSink(dir string) (*FileSink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("email directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create email directory: %w", err)
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+// Send writes a message to a file named after its time and Message-ID
+func (f *FileSink) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000")
+	if msg.MessageID != "" {
+		id, _, _ := strings.Cut(msg.MessageID, "@")
+		name += "_" + filepath.Base(id)
+	}
+	return os.WriteFile(filepath.Join(f.dir, name+".eml"), data, 0o600)
+}
+
+// MemorySink keeps sent messages in memory, for tests
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []Message
+	err      error
+}
+
+// NewMemorySink creates an empty memory sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Send records a message
+func (m *MemorySink) Send(ctx context.Context, msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, *msg)
+	return nil
+}
+
+// SetError makes the sink fail every send with err, or succeed when err is nil
+func (m *MemorySink) SetError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+// Messages returns the messages sent so far
+func (m *MemorySink) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
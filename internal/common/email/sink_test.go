@@ -0,0 +1,69 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_SelectsDriver(t *testing.T) {
+	dir := t.TempDir()
+
+	sender, err := New(Config{Dir: dir})
+	require.NoError(t, err)
+	assert.IsType(t, &FileSink{}, sender)
+
+	sender, err = New(Config{Dir: dir, SMTPHost: "smtp.example.co.id", SMTPUsername: "apikey"})
+	require.NoError(t, err)
+	assert.IsType(t, &SMTPSender{}, sender)
+
+	sender, err = New(Config{Driver: "file", Dir: dir, SMTPHost: "smtp.example.co.id", SMTPUsername: "apikey"})
+	require.NoError(t, err)
+	assert.IsType(t, &FileSink{}, sender)
+
+	_, err = New(Config{Driver: "smtp"})
+	assert.Error(t, err, "smtp needs a host")
+
+	_, err = New(Config{Driver: "carrier-pigeon"})
+	assert.Error(t, err)
+}
+
+func TestFileSink_Send(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileSink(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Send(context.Background(), testMessage()))
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0].Name(), "_abc123.eml"), files[0].Name())
+
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Message-ID: <abc123@fleettracker.id>")
+
+	message := testMessage()
+	message.To = nil
+	assert.True(t, IsPermanent(sink.Send(context.Background(), message)))
+}
+
+func TestMemorySink(t *testing.T) {
+	sink := NewMemorySink()
+	require.NoError(t, sink.Send(context.Background(), testMessage()))
+
+	failure := errors.New("connection reset")
+	sink.SetError(failure)
+	assert.Equal(t, failure, sink.Send(context.Background(), testMessage()))
+
+	messages := sink.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, []string{"budi@example.co.id"}, messages[0].To)
+}
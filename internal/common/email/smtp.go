@@ -0,0 +1,141 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// smtpTimeout bounds a whole SMTP conversation
+const smtpTimeout = 30 * time.Second
+
+// SMTPConfig configures an SMTP sender
+type SMTPConfig struct {
+	Host     string
+	Port     int // 465 uses implicit TLS; other ports upgrade with STARTTLS when offered
+	Username string
+	Password string
+}
+
+// SMTPSender delivers messages through an SMTP server
+type SMTPSender struct {
+	config    SMTPConfig
+	tlsConfig *tls.Config
+}
+
+// NewSMTPSender creates an SMTP sender
+func NewSMTPSender(config SMTPConfig) (*SMTPSender, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	return &SMTPSender{
+		config:    config,
+		tlsConfig: &tls.Config{ServerName: config.Host, MinVersion: tls.VersionTLS12},
+	}, nil
+}
+
+// Send delivers a message. Rejections with a 5xx reply are permanent; other
+// failures may succeed on retry. Once the server accepted the message it is
+// sent, even if closing the connection fails.
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return &PermanentError{Err: err}
+	}
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return &PermanentError{Err: fmt.Errorf("invalid sender: %w", err)}
+	}
+
+	client, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if s.config.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)); err != nil {
+				return classifySMTPError("authenticate", err)
+			}
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return classifySMTPError("send MAIL FROM", err)
+	}
+	for _, recipient := range msg.To {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return &PermanentError{Err: fmt.Errorf("invalid recipient: %w", err)}
+		}
+		if err := client.Rcpt(address.Address); err != nil {
+			return classifySMTPError("send RCPT TO", err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return classifySMTPError("send DATA", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return classifySMTPError("write message", err)
+	}
+	if err := w.Close(); err != nil {
+		return classifySMTPError("finish message", err)
+	}
+	client.Quit()
+	return nil
+}
+
+// dial connects to the server, with TLS from the start on port 465 and
+// STARTTLS on other ports when the server offers it
+func (s *SMTPSender) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline := time.Now().Add(smtpTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+	if s.config.Port == 465 {
+		conn = tls.Client(conn, s.tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, classifySMTPError("greet SMTP server", err)
+	}
+	if s.config.Port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(s.tlsConfig); err != nil {
+				client.Close()
+				return nil, fmt.Errorf("failed to start TLS: %w", err)
+			}
+		}
+	}
+	return client, nil
+}
+
+// classifySMTPError marks 5xx replies as permanent failures
+func classifySMTPError(action string, err error) error {
+	err = fmt.Errorf("failed to %s: %w", action, err)
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &PermanentError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package email
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTPServer accepts one SMTP conversation, answering RCPT TO with
+// rcptReply, and records the envelope and data it received
+type fakeSMTPServer struct {
+	listener  net.Listener
+	rcptReply string
+	done      chan struct{}
+
+	from       string
+	recipients []string
+	data       string
+}
+
+func startFakeSMTPServer(t *testing.T, rcptReply string) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &fakeSMTPServer{listener: listener, rcptReply: rcptReply, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+func (f *fakeSMTPServer) port() int {
+	return f.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (f *fakeSMTPServer) serve() {
+	defer close(f.done)
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP fake")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250-localhost")
+			text.PrintfLine("250 8BITMIME")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			f.from = envelopeAddress(line[len("MAIL FROM:"):])
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			f.recipients = append(f.recipients, envelopeAddress(line[len("RCPT TO:"):]))
+			text.PrintfLine("%s", f.rcptReply)
+		case command == "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			f.data = string(data)
+			text.PrintfLine("250 OK queued")
+		case command == "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+// envelopeAddress returns the address of a MAIL FROM or RCPT TO argument,
+// dropping parameters such as BODY=8BITMIME
+func envelopeAddress(arg string) string {
+	address, _, _ := strings.Cut(strings.TrimSpace(arg), " ")
+	return strings.Trim(address, "<>")
+}
+
+func testSender(t *testing.T, server *fakeSMTPServer) *SMTPSender {
+	sender, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: server.port()})
+	require.NoError(t, err)
+	return sender
+}
+
+func TestSMTPSender_Send(t *testing.T) {
+	server := startFakeSMTPServer(t, "250 OK")
+
+	err := testSender(t, server).Send(context.Background(), testMessage())
+	require.NoError(t, err)
+	<-server.done
+
+	assert.Equal(t, "noreply@fleettracker.id", server.from)
+	assert.Equal(t, []string{"budi@example.co.id"}, server.recipients)
+	assert.Contains(t, server.data, "Message-ID: <abc123@fleettracker.id>")
+	assert.Contains(t, server.data, "Halo Budi,")
+}
+
+func TestSMTPSender_RejectedRecipientIsPermanent(t *testing.T) {
+	server := startFakeSMTPServer(t, "550 5.1.1 User unknown")
+
+	err := testSender(t, server).Send(context.Background(), testMessage())
+	require.Error(t, err)
+	assert.True(t, IsPermanent(err))
+	assert.Contains(t, err.Error(), "User unknown")
+}
+
+func TestSMTPSender_TemporaryFailureIsRetried(t *testing.T) {
+	server := startFakeSMTPServer(t, "451 4.7.1 Greylisted, try again later")
+
+	err := testSender(t, server).Send(context.Background(), testMessage())
+	require.Error(t, err)
+	assert.False(t, IsPermanent(err))
+}
+
+func TestSMTPSender_ConnectionRefusedIsRetried(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	sender, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: port})
+	require.NoError(t, err)
+	err = sender.Send(context.Background(), testMessage())
+	require.Error(t, err)
+	assert.False(t, IsPermanent(err))
+}
+
+func TestSMTPSender_InvalidMessageIsPermanent(t *testing.T) {
+	sender, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: 2525})
+	require.NoError(t, err)
+
+	message := testMessage()
+	message.To = []string{"budi"}
+	err = sender.Send(context.Background(), message)
+	assert.True(t, IsPermanent(err))
+}
+
+func TestNewSMTPSender_DefaultPort(t *testing.T) {
+	sender, err := NewSMTPSender(SMTPConfig{Host: "smtp.example.co.id"})
+	require.NoError(t, err)
+	assert.Equal(t, 587, sender.config.Port)
+
+	_, err = NewSMTPSender(SMTPConfig{})
+	assert.Error(t, err)
+}
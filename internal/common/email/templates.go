@@ -0,0 +1,110 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Email templates
+const (
+	TemplatePasswordReset  = "password_reset"
+	TemplateUserInvitation = "user_invitation"
+	TemplateReportReady    = "report_ready"
+)
+
+// Languages of the templates; users without a supported language get
+// Indonesian
+const (
+	LanguageIndonesian = "id"
+	LanguageEnglish    = "en"
+	DefaultLanguage    = LanguageIndonesian
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	templateNames = []string{TemplatePasswordReset, TemplateUserInvitation, TemplateReportReady}
+	languages     = []string{LanguageIndonesian, LanguageEnglish}
+)
+
+// Templates renders the subject, text and HTML bodies of templated emails.
+// Each template has a text file defining "subject" and "text" and an HTML
+// file defining "title" and "content", wrapped in the language's layout.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// Rendered is a rendered email template
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// LoadTemplates parses the built-in templates
+func LoadTemplates() (*Templates, error) {
+	t := &Templates{
+		text: map[string]*texttemplate.Template{},
+		html: map[string]*htmltemplate.Template{},
+	}
+	for _, name := range templateNames {
+		for _, language := range languages {
+			key := name + "." + language
+			text, err := texttemplate.New(key).Option("missingkey=error").ParseFS(templateFiles, "templates/"+key+".txt")
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s text template: %w", key, err)
+			}
+			html, err := htmltemplate.New(key).Option("missingkey=error").ParseFS(templateFiles,
+				"templates/layout."+language+".html", "templates/"+key+".html")
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s HTML template: %w", key, err)
+			}
+			t.text[key] = text
+			t.html[key] = html
+		}
+	}
+	return t, nil
+}
+
+// Render renders a template in a language, falling back to Indonesian
+func (t *Templates) Render(name, language string, data interface{}) (*Rendered, error) {
+	key := name + "." + NormalizeLanguage(language)
+	text, ok := t.text[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, body, html bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s subject: %w", key, err)
+	}
+	if err := text.ExecuteTemplate(&body, "text", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s text: %w", key, err)
+	}
+	if err := t.html[key].ExecuteTemplate(&html, "layout", data); err != nil {
+		return nil, fmt.Errorf("failed to render %s HTML: %w", key, err)
+	}
+	return &Rendered{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    body.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// NormalizeLanguage maps a user's language to a template language, e.g.
+// "en-US" to English and unknown languages to Indonesian
+func NormalizeLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	for _, supported := range languages {
+		if language == supported || strings.HasPrefix(language, supported+"-") || strings.HasPrefix(language, supported+"_") {
+			return supported
+		}
+	}
+	return DefaultLanguage
+}
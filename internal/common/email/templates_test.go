@@ -0,0 +1,105 @@
+package email
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func templateData() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		TemplatePasswordReset: {
+			"Name":             "Budi Santoso",
+			"ResetURL":         "https://app.fleettracker.id/reset-password?token=abc",
+			"ExpiresInMinutes": 60,
+		},
+		TemplateUserInvitation: {
+			"Name":              "Budi Santoso",
+			"Email":             "budi@example.co.id",
+			"CompanyName":       "PT Maju Jaya",
+			"TemporaryPassword": "Xy7#kLm9",
+			"LoginURL":          "https://app.fleettracker.id/login",
+		},
+		TemplateReportReady: {
+			"Title":       "Ringkasan Armada",
+			"DownloadURL": "https://files.fleettracker.id/reports/1.pdf",
+			"ExpiresAt":   "10/06/2024 07:00",
+		},
+	}
+}
+
+func TestTemplates_RenderAll(t *testing.T) {
+	templates, err := LoadTemplates()
+	require.NoError(t, err)
+
+	for name, data := range templateData() {
+		for _, language := range languages {
+			rendered, err := templates.Render(name, language, data)
+			require.NoError(t, err, "%s.%s", name, language)
+			assert.NotEmpty(t, rendered.Subject, "%s.%s", name, language)
+			assert.NotContains(t, rendered.Subject, "\n")
+			assert.NotEmpty(t, rendered.Text, "%s.%s", name, language)
+			assert.Contains(t, rendered.HTML, "<html", "%s.%s", name, language)
+			assert.Contains(t, rendered.HTML, `lang="`+language+`"`, "%s.%s", name, language)
+		}
+	}
+}
+
+func TestTemplates_Languages(t *testing.T) {
+	templates, err := LoadTemplates()
+	require.NoError(t, err)
+	data := templateData()[TemplatePasswordReset]
+
+	indonesian, err := templates.Render(TemplatePasswordReset, "id", data)
+	require.NoError(t, err)
+	english, err := templates.Render(TemplatePasswordReset, "en-US", data)
+	require.NoError(t, err)
+	fallback, err := templates.Render(TemplatePasswordReset, "fr", data)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, indonesian.Subject, english.Subject)
+	assert.Equal(t, indonesian, fallback)
+	assert.Contains(t, english.Text, "https://app.fleettracker.id/reset-password?token=abc")
+	assert.Contains(t, english.Text, "60")
+}
+
+func TestTemplates_EscapesHTML(t *testing.T) {
+	templates, err := LoadTemplates()
+	require.NoError(t, err)
+	data := templateData()[TemplateUserInvitation]
+	data["CompanyName"] = `<script>alert("x")</script>`
+
+	rendered, err := templates.Render(TemplateUserInvitation, "en", data)
+	require.NoError(t, err)
+	assert.NotContains(t, rendered.HTML, "<script>")
+	assert.Contains(t, rendered.HTML, "&lt;script&gt;")
+	assert.Contains(t, rendered.Text, `<script>alert("x")</script>`)
+}
+
+func TestTemplates_Errors(t *testing.T) {
+	templates, err := LoadTemplates()
+	require.NoError(t, err)
+
+	_, err = templates.Render("welcome", "en", map[string]interface{}{})
+	assert.Error(t, err)
+
+	_, err = templates.Render(TemplateReportReady, "en", map[string]interface{}{"Title": "Ringkasan Armada"})
+	assert.Error(t, err, "missing data should not render")
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"":      LanguageIndonesian,
+		"id":    LanguageIndonesian,
+		"id-ID": LanguageIndonesian,
+		"en":    LanguageEnglish,
+		"EN-us": LanguageEnglish,
+		"en_GB": LanguageEnglish,
+		"fr":    LanguageIndonesian,
+		"eng":   LanguageIndonesian,
+	}
+	for language, expected := range tests {
+		assert.Equal(t, expected, NormalizeLanguage(language), language)
+	}
+}
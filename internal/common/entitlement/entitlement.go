@@ -0,0 +1,263 @@
+// Package entitlement enforces the resource limits and features of the
+// subscription plan a company is on.
+package entitlement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// Sources of the entitlements of a company
+const (
+	SourceSubscription = "subscription" // an active subscription
+	SourceTier         = "tier"         // Company.SubscriptionTier, for companies that never subscribed
+)
+
+// Limits are the maximum number of active resources of a plan
+type Limits struct {
+	Vehicles int `json:"vehicles"`
+	Drivers  int `json:"drivers"`
+	Users    int `json:"users"`
+}
+
+// Usage is the number of active resources a company has
+type Usage struct {
+	Vehicles int `json:"vehicles"`
+	Drivers  int `json:"drivers"`
+	Users    int `json:"users"`
+}
+
+// Entitlements are the limits and features a company is entitled to
+type Entitlements struct {
+	CompanyID      string          `json:"company_id"`
+	Plan           string          `json:"plan"`
+	Source         string          `json:"source"`
+	SubscriptionID string          `json:"subscription_id,omitempty"`
+	ExpiresAt      *time.Time      `json:"expires_at,omitempty"`
+	Limits         Limits          `json:"limits"`
+	Features       map[string]bool `json:"features"`
+}
+
+// HasFeature reports whether the entitlements include a feature
+func (e *Entitlements) HasFeature(feature string) bool {
+	return e.Features[feature]
+}
+
+// Service resolves entitlements and checks them against usage
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new entitlement service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// GetEntitlements returns the entitlements of a company. An active
+// subscription takes precedence; companies that never subscribed fall back
+// to the plan named by Company.SubscriptionTier. Companies whose
+// subscriptions have all ended get a payment required error.
+func (s *Service) GetEntitlements(ctx context.Context, companyID string) (*Entitlements, error) {
+	return getEntitlements(s.db.WithContext(ctx), companyID)
+}
+
+// getEntitlements resolves the entitlements of a company with db
+func getEntitlements(db *gorm.DB, companyID string) (*Entitlements, error) {
+	var subscription models.Subscription
+	err := db.Where("company_id = ? AND is_active = ? AND status = ? AND end_date > ?", companyID, true, "active", time.Now()).
+		Order("end_date DESC").
+		First(&subscription).Error
+	if err == nil {
+		return subscriptionEntitlements(&subscription), nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperrors.Wrap(err, "failed to get active subscription")
+	}
+
+	var subscriptions int64
+	if err := db.Model(&models.Subscription{}).Where("company_id = ?", companyID).Count(&subscriptions).Error; err != nil {
+		return nil, apperrors.Wrap(err, "failed to count subscriptions")
+	}
+	if subscriptions > 0 {
+		return nil, apperrors.NewPaymentRequiredError("The subscription of this company has ended, renew it to continue")
+	}
+
+	var company models.Company
+	if err := db.Select("id", "subscription_tier").First(&company, "id = ?", companyID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("company")
+		}
+		return nil, apperrors.Wrap(err, "failed to get company")
+	}
+
+	plan, ok := GetPlan(company.SubscriptionTier)
+	if !ok {
+		plan, _ = GetPlan(PlanBasic)
+	}
+	return planEntitlements(companyID, plan), nil
+}
+
+// GetUsage counts the active vehicles, drivers and users of a company
+func (s *Service) GetUsage(ctx context.Context, companyID string) (*Usage, error) {
+	var vehicles, drivers, users int64
+	db := s.db.WithContext(ctx)
+
+	if err := db.Model(&models.Vehicle{}).Where("company_id = ? AND is_active = ?", companyID, true).Count(&vehicles).Error; err != nil {
+		return nil, apperrors.Wrap(err, "failed to count vehicles")
+	}
+	if err := db.Model(&models.Driver{}).Where("company_id = ? AND is_active = ?", companyID, true).Count(&drivers).Error; err != nil {
+		return nil, apperrors.Wrap(err, "failed to count drivers")
+	}
+	if err := db.Model(&models.User{}).Where("company_id = ? AND is_active = ?", companyID, true).Count(&users).Error; err != nil {
+		return nil, apperrors.Wrap(err, "failed to count users")
+	}
+
+	return &Usage{Vehicles: int(vehicles), Drivers: int(drivers), Users: int(users)}, nil
+}
+
+// CheckVehicleLimit returns an error when the company cannot add a vehicle
+func (s *Service) CheckVehicleLimit(ctx context.Context, companyID string) error {
+	return checkLimit(s.db.WithContext(ctx), companyID, vehicleLimit)
+}
+
+// CheckDriverLimit returns an error when the company cannot add a driver
+func (s *Service) CheckDriverLimit(ctx context.Context, companyID string) error {
+	return checkLimit(s.db.WithContext(ctx), companyID, driverLimit)
+}
+
+// CheckUserLimit returns an error when the company cannot add a user
+func (s *Service) CheckUserLimit(ctx context.Context, companyID string) error {
+	return checkLimit(s.db.WithContext(ctx), companyID, userLimit)
+}
+
+// WithinVehicleLimit runs create, which inserts a vehicle, when the company
+// can add one. The check and the insert share a transaction.
+func (s *Service) WithinVehicleLimit(ctx context.Context, companyID string, create func(tx *gorm.DB) error) error {
+	return s.withinLimit(ctx, companyID, vehicleLimit, create)
+}
+
+// WithinDriverLimit runs create, which inserts a driver, when the company
+// can add one. The check and the insert share a transaction.
+func (s *Service) WithinDriverLimit(ctx context.Context, companyID string, create func(tx *gorm.DB) error) error {
+	return s.withinLimit(ctx, companyID, driverLimit, create)
+}
+
+// WithinUserLimit runs create, which inserts a user, when the company can
+// add one. The check and the insert share a transaction.
+func (s *Service) WithinUserLimit(ctx context.Context, companyID string, create func(tx *gorm.DB) error) error {
+	return s.withinLimit(ctx, companyID, userLimit, create)
+}
+
+// RequireFeature returns an error when the plan of the company does not include a feature
+func (s *Service) RequireFeature(ctx context.Context, companyID, feature string) error {
+	entitlements, err := s.GetEntitlements(ctx, companyID)
+	if err != nil {
+		return err
+	}
+	if !entitlements.HasFeature(feature) {
+		return apperrors.NewFeatureNotAvailableError(feature, entitlements.Plan)
+	}
+	return nil
+}
+
+// resourceLimit describes a limited resource of a plan
+type resourceLimit struct {
+	resource string
+	model    interface{}
+	limit    func(Limits) int
+}
+
+var (
+	vehicleLimit = resourceLimit{"vehicles", &models.Vehicle{}, func(l Limits) int { return l.Vehicles }}
+	driverLimit  = resourceLimit{"drivers", &models.Driver{}, func(l Limits) int { return l.Drivers }}
+	userLimit    = resourceLimit{"users", &models.User{}, func(l Limits) int { return l.Users }}
+)
+
+// withinLimit locks the company row, checks the limit and runs create in
+// one transaction, so concurrent creations are counted one after another
+// and cannot both take the last free slot
+func (s *Service) withinLimit(ctx context.Context, companyID string, limit resourceLimit, create func(tx *gorm.DB) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var company models.Company
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&company, "id = ?", companyID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperrors.NewNotFoundError("company")
+			}
+			return apperrors.Wrap(err, "failed to lock company")
+		}
+		if err := checkLimit(tx, companyID, limit); err != nil {
+			return err
+		}
+		return create(tx)
+	})
+}
+
+// checkLimit compares the active resources of a company with a plan limit
+func checkLimit(db *gorm.DB, companyID string, limit resourceLimit) error {
+	entitlements, err := getEntitlements(db, companyID)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := db.Model(limit.model).Where("company_id = ? AND is_active = ?", companyID, true).Count(&count).Error; err != nil {
+		return apperrors.Wrap(err, fmt.Sprintf("failed to count %s", limit.resource))
+	}
+
+	allowed := limit.limit(entitlements.Limits)
+	if int(count) >= allowed {
+		return apperrors.NewPlanLimitExceededError(limit.resource, allowed, entitlements.Plan)
+	}
+	return nil
+}
+
+// subscriptionEntitlements uses the limits and features stored on a subscription
+func subscriptionEntitlements(subscription *models.Subscription) *Entitlements {
+	features := make(map[string]bool, len(subscription.Features))
+	for name := range subscription.Features {
+		features[name] = subscription.HasFeature(name)
+	}
+
+	expiresAt := subscription.EndDate
+	return &Entitlements{
+		CompanyID:      subscription.CompanyID,
+		Plan:           subscription.PlanName,
+		Source:         SourceSubscription,
+		SubscriptionID: subscription.ID,
+		ExpiresAt:      &expiresAt,
+		Limits: Limits{
+			Vehicles: subscription.MaxVehicles,
+			Drivers:  subscription.MaxDrivers,
+			Users:    subscription.MaxUsers,
+		},
+		Features: features,
+	}
+}
+
+// planEntitlements uses the limits and features of a catalog plan
+func planEntitlements(companyID string, plan Plan) *Entitlements {
+	features := make(map[string]bool, len(plan.Features))
+	for name, enabled := range plan.Features {
+		features[name] = enabled
+	}
+
+	return &Entitlements{
+		CompanyID: companyID,
+		Plan:      plan.Name,
+		Source:    SourceTier,
+		Limits: Limits{
+			Vehicles: plan.MaxVehicles,
+			Drivers:  plan.MaxDrivers,
+			Users:    plan.MaxUsers,
+		},
+		Features: features,
+	}
+}
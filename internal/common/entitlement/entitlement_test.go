@@ -0,0 +1,191 @@
+package entitlement
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+func TestService_GetEntitlements(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db)
+	ctx := context.Background()
+
+	t.Run("company without subscription uses its tier", func(t *testing.T) {
+		company := testutil.NewTestCompany()
+		company.SubscriptionTier = PlanProfessional
+		require.NoError(t, db.Create(company).Error)
+
+		entitlements, err := service.GetEntitlements(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, SourceTier, entitlements.Source)
+		assert.Equal(t, PlanProfessional, entitlements.Plan)
+		assert.Equal(t, 50, entitlements.Limits.Vehicles)
+	})
+
+	t.Run("active subscription takes precedence", func(t *testing.T) {
+		company := testutil.NewTestCompany()
+		require.NoError(t, db.Create(company).Error)
+
+		enterprise, _ := GetPlan(PlanEnterprise)
+		subscription := &models.Subscription{
+			CompanyID:   company.ID,
+			PlanName:    PlanEnterprise,
+			PlanType:    BillingMonthly,
+			Status:      "active",
+			IsActive:    true,
+			StartDate:   time.Now().AddDate(0, 0, -1),
+			EndDate:     time.Now().AddDate(0, 1, 0),
+			MaxVehicles: enterprise.MaxVehicles,
+			MaxDrivers:  enterprise.MaxDrivers,
+			MaxUsers:    enterprise.MaxUsers,
+			Features:    enterprise.FeatureJSON(),
+		}
+		require.NoError(t, db.Create(subscription).Error)
+
+		entitlements, err := service.GetEntitlements(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, SourceSubscription, entitlements.Source)
+		assert.Equal(t, subscription.ID, entitlements.SubscriptionID)
+		assert.True(t, entitlements.HasFeature(FeatureAdvancedAnalytics))
+		assert.NoError(t, service.RequireFeature(ctx, company.ID, FeatureAdvancedAnalytics))
+	})
+
+	t.Run("ended subscription requires payment", func(t *testing.T) {
+		company := testutil.NewTestCompany()
+		require.NoError(t, db.Create(company).Error)
+
+		subscription := &models.Subscription{
+			CompanyID: company.ID,
+			PlanName:  PlanBasic,
+			PlanType:  BillingMonthly,
+			Status:    "active",
+			IsActive:  true,
+			StartDate: time.Now().AddDate(0, -2, 0),
+			EndDate:   time.Now().AddDate(0, -1, 0),
+		}
+		require.NoError(t, db.Create(subscription).Error)
+
+		_, err := service.GetEntitlements(ctx, company.ID)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusPaymentRequired, apperrors.GetAppError(err).Status)
+	})
+}
+
+func TestService_Limits(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db)
+	ctx := context.Background()
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	for i := 0; i < 3; i++ {
+		user := testutil.NewTestUser(company.ID)
+		user.Email = user.ID + "@example.co.id"
+		user.Username = user.ID
+		require.NoError(t, db.Create(user).Error)
+	}
+
+	usage, err := service.GetUsage(ctx, company.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, usage.Users)
+
+	err = service.CheckUserLimit(ctx, company.ID)
+	require.Error(t, err)
+	appErr := apperrors.GetAppError(err)
+	assert.Equal(t, "PLAN_LIMIT_EXCEEDED", appErr.Code)
+	assert.Equal(t, http.StatusPaymentRequired, appErr.Status)
+
+	assert.NoError(t, service.CheckVehicleLimit(ctx, company.ID))
+
+	err = service.RequireFeature(ctx, company.ID, FeatureFleetManagement)
+	require.Error(t, err)
+	appErr = apperrors.GetAppError(err)
+	assert.Equal(t, "FEATURE_NOT_AVAILABLE", appErr.Code)
+	assert.Equal(t, http.StatusForbidden, appErr.Status)
+}
+
+func TestService_WithinLimit(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db)
+	ctx := context.Background()
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	basic, _ := GetPlan(PlanBasic)
+	for i := 0; i < basic.MaxUsers-1; i++ {
+		user := testutil.NewTestUser(company.ID)
+		user.Email = user.ID + "@example.co.id"
+		user.Username = user.ID
+		require.NoError(t, db.Create(user).Error)
+	}
+
+	t.Run("concurrent creations cannot exceed the limit", func(t *testing.T) {
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		created, rejected := 0, 0
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				user := testutil.NewTestUser(company.ID)
+				user.Email = user.ID + "@example.co.id"
+				user.Username = user.ID
+				err := service.WithinUserLimit(ctx, company.ID, func(tx *gorm.DB) error {
+					return tx.Create(user).Error
+				})
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				if err == nil {
+					created++
+				} else if apperrors.GetAppError(err).Code == "PLAN_LIMIT_EXCEEDED" {
+					rejected++
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, created)
+		assert.Equal(t, 4, rejected)
+
+		usage, err := service.GetUsage(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, basic.MaxUsers, usage.Users)
+	})
+
+	t.Run("create is not run when the limit is reached", func(t *testing.T) {
+		called := false
+		err := service.WithinUserLimit(ctx, company.ID, func(tx *gorm.DB) error {
+			called = true
+			return nil
+		})
+		require.Error(t, err)
+		assert.False(t, called)
+	})
+
+	t.Run("unknown company", func(t *testing.T) {
+		err := service.WithinVehicleLimit(ctx, "00000000-0000-0000-0000-000000000000", func(tx *gorm.DB) error {
+			return nil
+		})
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, apperrors.GetAppError(err).Status)
+	})
+}
@@ -0,0 +1,131 @@
+package entitlement
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// Subscription plan tiers (models.Subscription.PlanName, models.Company.SubscriptionTier)
+const (
+	PlanBasic        = "basic"
+	PlanProfessional = "professional"
+	PlanEnterprise   = "enterprise"
+)
+
+// Billing cycles (models.Subscription.PlanType)
+const (
+	BillingMonthly = "monthly"
+	BillingYearly  = "yearly"
+)
+
+// Plan features stored in models.Subscription.Features
+const (
+	FeatureRealtimeTracking  = "realtime_tracking"
+	FeatureGeofencing        = "geofencing"
+	FeatureDataExport        = "data_export"
+	FeatureFleetManagement   = "fleet_management"
+	FeatureAdvancedAnalytics = "advanced_analytics"
+	FeatureAPIAccess         = "api_access"
+	FeaturePrioritySupport   = "priority_support"
+)
+
+// Plan describes the limits, features and prices of a subscription tier
+type Plan struct {
+	Name         string          `json:"name"`
+	DisplayName  string          `json:"display_name"`
+	MonthlyPrice float64         `json:"monthly_price"` // in IDR, excluding PPN
+	YearlyPrice  float64         `json:"yearly_price"`  // in IDR, excluding PPN
+	MaxVehicles  int             `json:"max_vehicles"`
+	MaxDrivers   int             `json:"max_drivers"`
+	MaxUsers     int             `json:"max_users"`
+	Features     map[string]bool `json:"features"`
+	rank         int
+}
+
+// plans is the subscription plan catalog. Yearly billing costs ten months.
+var plans = map[string]Plan{
+	PlanBasic: {
+		Name:         PlanBasic,
+		DisplayName:  "Basic",
+		MonthlyPrice: 250000,
+		YearlyPrice:  2500000,
+		MaxVehicles:  10,
+		MaxDrivers:   15,
+		MaxUsers:     3,
+		Features: map[string]bool{
+			FeatureRealtimeTracking: true,
+			FeatureGeofencing:       true,
+		},
+		rank: 1,
+	},
+	PlanProfessional: {
+		Name:         PlanProfessional,
+		DisplayName:  "Professional",
+		MonthlyPrice: 750000,
+		YearlyPrice:  7500000,
+		MaxVehicles:  50,
+		MaxDrivers:   75,
+		MaxUsers:     10,
+		Features: map[string]bool{
+			FeatureRealtimeTracking: true,
+			FeatureGeofencing:       true,
+			FeatureDataExport:       true,
+			FeatureFleetManagement:  true,
+		},
+		rank: 2,
+	},
+	PlanEnterprise: {
+		Name:         PlanEnterprise,
+		DisplayName:  "Enterprise",
+		MonthlyPrice: 2000000,
+		YearlyPrice:  20000000,
+		MaxVehicles:  500,
+		MaxDrivers:   750,
+		MaxUsers:     50,
+		Features: map[string]bool{
+			FeatureRealtimeTracking:  true,
+			FeatureGeofencing:        true,
+			FeatureDataExport:        true,
+			FeatureFleetManagement:   true,
+			FeatureAdvancedAnalytics: true,
+			FeatureAPIAccess:         true,
+			FeaturePrioritySupport:   true,
+		},
+		rank: 3,
+	},
+}
+
+// GetPlan returns a plan by name
+func GetPlan(name string) (Plan, bool) {
+	plan, ok := plans[strings.ToLower(strings.TrimSpace(name))]
+	return plan, ok
+}
+
+// Plans returns all plans ordered from the smallest to the largest tier
+func Plans() []Plan {
+	result := make([]Plan, 0, len(plans))
+	for _, plan := range plans {
+		result = append(result, plan)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].rank < result[j].rank })
+	return result
+}
+
+// Price returns the plan price for a billing cycle
+func (p Plan) Price(planType string) float64 {
+	if planType == BillingYearly {
+		return p.YearlyPrice
+	}
+	return p.MonthlyPrice
+}
+
+// FeatureJSON returns the plan features in the form stored on subscriptions
+func (p Plan) FeatureJSON() models.JSON {
+	features := make(models.JSON, len(p.Features))
+	for name, enabled := range p.Features {
+		features[name] = enabled
+	}
+	return features
+}
@@ -0,0 +1,41 @@
+package entitlement
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlans(t *testing.T) {
+	all := Plans()
+	require.Len(t, all, 3)
+	assert.Equal(t, PlanBasic, all[0].Name)
+	assert.Equal(t, PlanProfessional, all[1].Name)
+	assert.Equal(t, PlanEnterprise, all[2].Name)
+
+	plan, ok := GetPlan(" Professional ")
+	require.True(t, ok)
+	assert.Equal(t, 750000.0, plan.Price(BillingMonthly))
+	assert.Equal(t, 7500000.0, plan.Price(BillingYearly))
+	assert.True(t, plan.Features[FeatureFleetManagement])
+	assert.False(t, plan.Features[FeatureAdvancedAnalytics])
+
+	_, ok = GetPlan("platinum")
+	assert.False(t, ok)
+}
+
+func TestPlanEntitlements(t *testing.T) {
+	plan, _ := GetPlan(PlanBasic)
+	entitlements := planEntitlements("company-1", plan)
+
+	assert.Equal(t, SourceTier, entitlements.Source)
+	assert.Equal(t, Limits{Vehicles: 10, Drivers: 15, Users: 3}, entitlements.Limits)
+	assert.True(t, entitlements.HasFeature(FeatureRealtimeTracking))
+	assert.False(t, entitlements.HasFeature(FeatureFleetManagement))
+
+	// The catalog must not be modified through the entitlements
+	entitlements.Features[FeatureFleetManagement] = true
+	plan, _ = GetPlan(PlanBasic)
+	assert.False(t, plan.Features[FeatureFleetManagement])
+}
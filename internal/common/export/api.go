@@ -1,11 +1,14 @@
 package export
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 )
 
 // ExportAPI provides HTTP API for data export operations
@@ -36,25 +39,18 @@ func (ea *ExportAPI) ExportDataHandler(c *gin.Context) {
 	req.CompanyID = companyID.(string)
 
 	// Validate export type
-	if !ea.isValidExportType(req.ExportType) {
+	if !IsValidExportType(req.ExportType) {
 		middleware.AbortWithBadRequest(c, "Invalid export type")
 		return
 	}
 
 	// Validate format
-	if !ea.isValidFormat(req.Format) {
+	if !IsValidFormat(req.Format) {
 		middleware.AbortWithBadRequest(c, "Invalid format")
 		return
 	}
 
-	// Export data
-	response, err := ea.exportService.ExportData(c.Request.Context(), &req)
-	if err != nil {
-		middleware.AbortWithInternal(c, "Export operation failed", err)
-		return
-	}
-
-	c.JSON(http.StatusOK, response)
+	ea.requestExport(c, &req)
 }
 
 // ExportVehiclesHandler handles vehicle export requests
@@ -87,14 +83,7 @@ func (ea *ExportAPI) ExportVehiclesHandler(c *gin.Context) {
 		UserID:     userID.(string),
 	}
 
-	// Export data
-	response, err := ea.exportService.ExportData(c.Request.Context(), req)
-	if err != nil {
-		middleware.AbortWithInternal(c, "Export operation failed", err)
-		return
-	}
-
-	c.JSON(http.StatusOK, response)
+	ea.requestExport(c, req)
 }
 
 // ExportDriversHandler handles driver export requests
@@ -122,14 +111,7 @@ func (ea *ExportAPI) ExportDriversHandler(c *gin.Context) {
 		UserID:     userID.(string),
 	}
 
-	// Export data
-	response, err := ea.exportService.ExportData(c.Request.Context(), req)
-	if err != nil {
-		middleware.AbortWithInternal(c, "Export operation failed", err)
-		return
-	}
-
-	c.JSON(http.StatusOK, response)
+	ea.requestExport(c, req)
 }
 
 // ExportTripsHandler handles trip export requests
@@ -166,14 +148,7 @@ func (ea *ExportAPI) ExportTripsHandler(c *gin.Context) {
 		UserID:     userID.(string),
 	}
 
-	// Export data
-	response, err := ea.exportService.ExportData(c.Request.Context(), req)
-	if err != nil {
-		middleware.AbortWithInternal(c, "Export operation failed", err)
-		return
-	}
-
-	c.JSON(http.StatusOK, response)
+	ea.requestExport(c, req)
 }
 
 // ExportGPSTracksHandler handles GPS track export requests
@@ -212,14 +187,7 @@ func (ea *ExportAPI) ExportGPSTracksHandler(c *gin.Context) {
 		UserID:     userID.(string),
 	}
 
-	// Export data
-	response, err := ea.exportService.ExportData(c.Request.Context(), req)
-	if err != nil {
-		middleware.AbortWithInternal(c, "Export operation failed", err)
-		return
-	}
-
-	c.JSON(http.StatusOK, response)
+	ea.requestExport(c, req)
 }
 
 // InvalidateCacheHandler handles cache invalidation requests
@@ -309,26 +277,76 @@ func (ea *ExportAPI) CleanupExpiredCacheHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Expired cache cleaned up successfully"})
 }
 
-// isValidExportType validates export type
-func (ea *ExportAPI) isValidExportType(exportType string) bool {
-	validTypes := []string{"vehicles", "drivers", "trips", "gps_tracks", "reports"}
-	for _, validType := range validTypes {
-		if exportType == validType {
-			return true
-		}
+// requestExport starts an export in the background and responds with its
+// status; poll GET /exports/:id for the download link
+func (ea *ExportAPI) requestExport(c *gin.Context, req *ExportRequest) {
+	status, err := ea.exportService.RequestExport(c.Request.Context(), req)
+	if err != nil {
+		abortWithExportError(c, "Export operation failed", err)
+		return
+	}
+
+	code := http.StatusAccepted
+	if status.DownloadURL != "" {
+		code = http.StatusOK
 	}
-	return false
+	c.JSON(code, status)
 }
 
-// isValidFormat validates export format
-func (ea *ExportAPI) isValidFormat(format string) bool {
-	validFormats := []string{"json", "csv"}
-	for _, validFormat := range validFormats {
-		if format == validFormat {
-			return true
-		}
+// ListExportsHandler lists the company's latest exports
+func (ea *ExportAPI) ListExportsHandler(c *gin.Context) {
+	companyID, _ := c.Get("company_id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	exports, err := ea.exportService.ListExports(c.Request.Context(), companyID.(string), limit)
+	if err != nil {
+		abortWithExportError(c, "Failed to list exports", err)
+		return
 	}
-	return false
+
+	c.JSON(http.StatusOK, gin.H{"exports": exports})
+}
+
+// GetExportHandler returns the status of an export, with a signed download
+// link once its file is ready
+func (ea *ExportAPI) GetExportHandler(c *gin.Context) {
+	companyID, _ := c.Get("company_id")
+
+	status, err := ea.exportService.GetExport(c.Request.Context(), companyID.(string), c.Param("id"))
+	if err != nil {
+		abortWithExportError(c, "Failed to get export", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// DownloadExportHandler streams an export or report file from a signed
+// download link.
+// The signature authenticates the request, so the route needs no login.
+func (ea *ExportAPI) DownloadExportHandler(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	reader, file, err := ea.exportService.OpenDownload(c.Request.Context(), key, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		abortWithExportError(c, "Failed to download export", err)
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, file.Size, file.ContentType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", file.Name),
+		"Cache-Control":       "private, no-store",
+	})
+}
+
+// abortWithExportError aborts with the service's error, or an internal error
+func abortWithExportError(c *gin.Context, message string, err error) {
+	if appErr, ok := err.(*apperrors.AppError); ok {
+		middleware.AbortWithError(c, appErr)
+		return
+	}
+	middleware.AbortWithInternal(c, message, err)
 }
 
 // SetupExportRoutes sets up export API routes
@@ -337,6 +355,10 @@ func SetupExportRoutes(r *gin.RouterGroup, api *ExportAPI) {
 	{
 		// General export endpoint
 		exports.POST("/data", api.ExportDataHandler)
+
+		// Export status and download links
+		exports.GET("", api.ListExportsHandler)
+		exports.GET("/:id", api.GetExportHandler)
 		
 		// Specific export endpoints
 		exports.GET("/vehicles", api.ExportVehiclesHandler)
@@ -356,3 +378,10 @@ func SetupExportRoutes(r *gin.RouterGroup, api *ExportAPI) {
 		}
 	}
 }
+
+// SetupExportDownloadRoutes sets up the route serving signed download links of
+// export and report files kept on the local filesystem; it must not require a
+// login
+func SetupExportDownloadRoutes(r *gin.RouterGroup, api *ExportAPI) {
+	r.GET("/exports/files/*key", api.DownloadExportHandler)
+}
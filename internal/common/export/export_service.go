@@ -1,20 +1,56 @@
 package export
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/storage"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
 
-// ExportService provides data export functionality with caching
+const (
+	// defaultLinkTTL is how long a download link works
+	defaultLinkTTL = time.Hour
+
+	// defaultRetention is how long export files are kept
+	defaultRetention = 24 * time.Hour
+
+	// exportKeyPrefix starts the blob storage keys of export files
+	exportKeyPrefix = "exports/"
+
+	// cleanupBatchSize limits the expired exports deleted per cleanup run
+	cleanupBatchSize = 500
+)
+
+// ExportQueue runs exports in the background
+type ExportQueue interface {
+	EnqueueDataExport(ctx context.Context, companyID, userID, exportID string) error
+}
+
+// ReportSource builds the analytics report of a type for a company, for
+// exports of the reports type
+type ReportSource func(ctx context.Context, companyID, reportType string) (interface{}, error)
+
+// ExportService generates data exports in the background, streaming the rows
+// into files in blob storage that are downloaded through signed links
 type ExportService struct {
-	db     *gorm.DB
-	cache  *ExportCacheService
+	db        *gorm.DB
+	cache     *ExportCacheService
+	store     storage.BlobStore
+	queue     ExportQueue
+	reports   ReportSource
+	linkTTL   time.Duration
+	retention time.Duration
 }
 
 // ExportRequest represents a request to export data
@@ -26,505 +62,417 @@ type ExportRequest struct {
 	UserID     string                 `json:"user_id"`
 }
 
-// ExportResponse represents the response from an export operation
-type ExportResponse struct {
-	ExportID    string         `json:"export_id"`
-	Data        interface{}    `json:"data"`
-	Metadata    ExportMetadata `json:"metadata"`
-	FromCache   bool           `json:"from_cache"`
-	CacheHit    bool           `json:"cache_hit"`
-	ProcessedAt time.Time      `json:"processed_at"`
+// ExportStatus is an export with, once its file is ready, a link to
+// download it
+type ExportStatus struct {
+	models.DataExport
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+	FromCache         bool       `json:"from_cache"`
+}
+
+// signedURLVerifier is implemented by blob stores whose signed URLs are
+// served by this API rather than by the store itself
+type signedURLVerifier interface {
+	Verify(key, expires, signature string) error
 }
 
 // NewExportService creates a new export service
 func NewExportService(db *gorm.DB, cache *ExportCacheService) *ExportService {
 	return &ExportService{
-		db:    db,
-		cache: cache,
+		db:        db,
+		cache:     cache,
+		linkTTL:   defaultLinkTTL,
+		retention: defaultRetention,
 	}
 }
 
-// ExportData exports data with caching support
-func (es *ExportService) ExportData(ctx context.Context, req *ExportRequest) (*ExportResponse, error) {
-	// Check cache first
-	cachedData, err := es.cache.GetExportCache(ctx, req.ExportType, req.Format, req.Filters, req.CompanyID, req.UserID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check cache: %w", err)
-	}
-	
-	if cachedData != nil {
-		// Cache hit
-		es.cache.RecordCacheHit(ctx)
-		
-		return &ExportResponse{
-			ExportID:    fmt.Sprintf("cached_%d", time.Now().UnixNano()),
-			Data:        cachedData.Data,
-			Metadata:    cachedData.Metadata,
-			FromCache:   true,
-			CacheHit:    true,
-			ProcessedAt: time.Now(),
-		}, nil
-	}
-	
-	// Cache miss - record it
-	es.cache.RecordCacheMiss(ctx)
-	
-	// Generate new export data
-	data, metadata, err := es.generateExportData(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate export data: %w", err)
+// SetStorage sets the blob store export files are written to, how long
+// download links work and how long files are kept
+func (es *ExportService) SetStorage(store storage.BlobStore, linkTTL, retention time.Duration) {
+	es.store = store
+	if linkTTL > 0 {
+		es.linkTTL = linkTTL
+	}
+	if retention > 0 {
+		es.retention = retention
+	}
+}
+
+// SetQueue sets the queue that runs requested exports
+func (es *ExportService) SetQueue(queue ExportQueue) {
+	es.queue = queue
+}
+
+// SetReportSource sets where the reports export type gets its reports from
+func (es *ExportService) SetReportSource(source ReportSource) {
+	es.reports = source
+}
+
+// RequestExport starts an export in the background. An identical export
+// whose file is still available is returned instead of exporting again.
+func (es *ExportService) RequestExport(ctx context.Context, req *ExportRequest) (*ExportStatus, error) {
+	if es.store == nil || es.queue == nil {
+		return nil, apperrors.NewServiceUnavailableError("data exports are not available")
 	}
-	
-	// Cache the result
-	ttl := es.cache.GetTTLForExportType(req.ExportType)
-	err = es.cache.SetExportCache(ctx, req.ExportType, req.Format, data, metadata, req.Filters, req.CompanyID, req.UserID, ttl)
+	if err := validateExportRequest(req); err != nil {
+		return nil, err
+	}
+
+	if status := es.cachedExport(ctx, req); status != nil {
+		return status, nil
+	}
+
+	dataExport, err := es.CreateExport(ctx, req)
 	if err != nil {
-		// Log error but don't fail the export
-		fmt.Printf("Warning: failed to cache export data: %v\n", err)
-	}
-	
-	return &ExportResponse{
-		ExportID:    fmt.Sprintf("export_%d", time.Now().UnixNano()),
-		Data:        data,
-		Metadata:    metadata,
-		FromCache:   false,
-		CacheHit:    false,
-		ProcessedAt: time.Now(),
-	}, nil
+		return nil, err
+	}
+	if err := es.queue.EnqueueDataExport(ctx, req.CompanyID, req.UserID, dataExport.ID); err != nil {
+		es.failExport(ctx, dataExport, err)
+		return nil, apperrors.Wrap(err, "Failed to queue export")
+	}
+
+	return &ExportStatus{DataExport: *dataExport}, nil
 }
 
-// generateExportData generates export data based on the request
-func (es *ExportService) generateExportData(ctx context.Context, req *ExportRequest) (interface{}, ExportMetadata, error) {
-	switch req.ExportType {
-	case "vehicles":
-		return es.exportVehicles(ctx, req)
-	case "drivers":
-		return es.exportDrivers(ctx, req)
-	case "trips":
-		return es.exportTrips(ctx, req)
-	case "gps_tracks":
-		return es.exportGPSTracks(ctx, req)
-	case "reports":
-		return es.exportReports(ctx, req)
-	default:
-		return nil, ExportMetadata{}, fmt.Errorf("unsupported export type: %s", req.ExportType)
+// CreateExport records a pending export without queueing it
+func (es *ExportService) CreateExport(ctx context.Context, req *ExportRequest) (*models.DataExport, error) {
+	if err := validateExportRequest(req); err != nil {
+		return nil, err
+	}
+
+	dataExport := &models.DataExport{
+		CompanyID:  req.CompanyID,
+		ExportType: req.ExportType,
+		Format:     req.Format,
+		Filters:    models.JSON(req.Filters),
+		Status:     models.ExportStatusPending,
+	}
+	if req.UserID != "" {
+		dataExport.RequestedBy = &req.UserID
 	}
+	if err := es.db.WithContext(ctx).Create(dataExport).Error; err != nil {
+		return nil, apperrors.Wrap(err, "Failed to create export")
+	}
+	return dataExport, nil
 }
 
-// exportVehicles exports vehicle data
-func (es *ExportService) exportVehicles(_ context.Context, req *ExportRequest) (interface{}, ExportMetadata, error) {
-	startTime := time.Now()
-	_ = startTime // Use the variable to avoid unused variable error
-	
-	// Build query
-	query := es.db.Model(&models.Vehicle{}).Where("company_id = ?", req.CompanyID)
-	
-	// Apply filters
-	if req.Filters != nil {
-		if status, ok := req.Filters["status"].(string); ok && status != "" {
-			query = query.Where("status = ?", status)
-		}
-		if make, ok := req.Filters["make"].(string); ok && make != "" {
-			query = query.Where("make = ?", make)
-		}
-		if year, ok := req.Filters["year"].(float64); ok && year > 0 {
-			query = query.Where("year = ?", int(year))
-		}
+// cachedExport returns the completed export of an identical earlier request
+// while its file can still be downloaded
+func (es *ExportService) cachedExport(ctx context.Context, req *ExportRequest) *ExportStatus {
+	if es.cache == nil {
+		return nil
 	}
-	
-	// Get vehicles
-	var vehicles []models.Vehicle
-	err := query.Find(&vehicles).Error
-	if err != nil {
-		return nil, ExportMetadata{}, fmt.Errorf("failed to get vehicles: %w", err)
-	}
-	
-	// Format data based on requested format
-	var data interface{}
-	var fileSize int64
-	
-	switch req.Format {
-	case "json":
-		data = vehicles
-		jsonData, _ := json.Marshal(vehicles)
-		fileSize = int64(len(jsonData))
-	case "csv":
-		csvData, err := es.convertToCSV(vehicles)
-		if err != nil {
-			return nil, ExportMetadata{}, fmt.Errorf("failed to convert to CSV: %w", err)
-		}
-		data = csvData
-		fileSize = int64(len(csvData))
-	default:
-		return nil, ExportMetadata{}, fmt.Errorf("unsupported format: %s", req.Format)
+
+	cached, err := es.cache.GetExportCache(ctx, req.ExportType, req.Format, req.Filters, req.CompanyID, req.UserID)
+	if err != nil || cached == nil {
+		es.cache.RecordCacheMiss(ctx)
+		return nil
 	}
-	
-	metadata := ExportMetadata{
-		RecordCount: int64(len(vehicles)),
-		FileSize:    fileSize,
-		ExportTime:  time.Now(),
-		Format:      req.Format,
-		Filters:     req.Filters,
+	exportID, _ := cached.Data.(string)
+	status, err := es.GetExport(ctx, req.CompanyID, exportID)
+	if err != nil || status.DownloadURL == "" {
+		es.cache.RecordCacheMiss(ctx)
+		return nil
 	}
-	
-	return data, metadata, nil
+
+	es.cache.RecordCacheHit(ctx)
+	status.FromCache = true
+	return status
 }
 
-// exportDrivers exports driver data
-func (es *ExportService) exportDrivers(_ context.Context, req *ExportRequest) (interface{}, ExportMetadata, error) {
-	startTime := time.Now()
-	_ = startTime // Use the variable to avoid unused variable error
-	
-	// Build query
-	query := es.db.Model(&models.Driver{}).Where("company_id = ?", req.CompanyID)
-	
-	// Apply filters
-	if req.Filters != nil {
-		if status, ok := req.Filters["status"].(string); ok && status != "" {
-			query = query.Where("status = ?", status)
-		}
-		if gender, ok := req.Filters["gender"].(string); ok && gender != "" {
-			query = query.Where("gender = ?", gender)
-		}
+// RunExport writes the file of a pending export to blob storage. Exports
+// that already completed are returned as they are, so retried jobs do not
+// export twice.
+func (es *ExportService) RunExport(ctx context.Context, exportID string) (*models.DataExport, error) {
+	if es.store == nil {
+		return nil, fmt.Errorf("export storage is not configured")
 	}
-	
-	// Get drivers
-	var drivers []models.Driver
-	err := query.Find(&drivers).Error
-	if err != nil {
-		return nil, ExportMetadata{}, fmt.Errorf("failed to get drivers: %w", err)
-	}
-	
-	// Format data based on requested format
-	var data interface{}
-	var fileSize int64
-	
-	switch req.Format {
-	case "json":
-		data = drivers
-		jsonData, _ := json.Marshal(drivers)
-		fileSize = int64(len(jsonData))
-	case "csv":
-		csvData, err := es.convertToCSV(drivers)
-		if err != nil {
-			return nil, ExportMetadata{}, fmt.Errorf("failed to convert to CSV: %w", err)
+
+	var dataExport models.DataExport
+	if err := es.db.WithContext(ctx).First(&dataExport, "id = ?", exportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("export")
 		}
-		data = csvData
-		fileSize = int64(len(csvData))
-	default:
-		return nil, ExportMetadata{}, fmt.Errorf("unsupported format: %s", req.Format)
+		return nil, fmt.Errorf("failed to load export: %w", err)
 	}
-	
-	metadata := ExportMetadata{
-		RecordCount: int64(len(drivers)),
-		FileSize:    fileSize,
-		ExportTime:  time.Now(),
-		Format:      req.Format,
-		Filters:     req.Filters,
+	if dataExport.Status == models.ExportStatusCompleted || dataExport.Status == models.ExportStatusExpired {
+		return &dataExport, nil
 	}
-	
-	return data, metadata, nil
+
+	startedAt := time.Now()
+	dataExport.StartedAt = &startedAt
+	if err := es.db.WithContext(ctx).Model(&dataExport).Updates(map[string]interface{}{
+		"status":     models.ExportStatusRunning,
+		"started_at": startedAt,
+		"error":      "",
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to start export: %w", err)
+	}
+
+	if err := es.writeExport(ctx, &dataExport); err != nil {
+		es.failExport(ctx, &dataExport, err)
+		return &dataExport, err
+	}
+
+	completedAt := time.Now()
+	expiresAt := completedAt.Add(es.retention)
+	dataExport.Status = models.ExportStatusCompleted
+	dataExport.CompletedAt = &completedAt
+	dataExport.ExpiresAt = &expiresAt
+	if err := es.db.WithContext(ctx).Model(&dataExport).Updates(map[string]interface{}{
+		"status":       models.ExportStatusCompleted,
+		"storage_key":  dataExport.StorageKey,
+		"file_name":    dataExport.FileName,
+		"content_type": dataExport.ContentType,
+		"record_count": dataExport.RecordCount,
+		"file_size":    dataExport.FileSize,
+		"completed_at": completedAt,
+		"expires_at":   expiresAt,
+	}).Error; err != nil {
+		es.store.Delete(ctx, dataExport.StorageKey)
+		return nil, fmt.Errorf("failed to complete export: %w", err)
+	}
+
+	es.cacheExport(ctx, &dataExport)
+	return &dataExport, nil
 }
 
-// exportTrips exports trip data
-func (es *ExportService) exportTrips(_ context.Context, req *ExportRequest) (interface{}, ExportMetadata, error) {
-	startTime := time.Now()
-	_ = startTime // Use the variable to avoid unused variable error
-	
-	// Build query
-	query := es.db.Model(&models.Trip{}).Where("company_id = ?", req.CompanyID)
-	
-	// Apply filters
-	if req.Filters != nil {
-		if startDate, ok := req.Filters["start_date"].(string); ok && startDate != "" {
-			query = query.Where("start_time >= ?", startDate)
-		}
-		if endDate, ok := req.Filters["end_date"].(string); ok && endDate != "" {
-			query = query.Where("start_time <= ?", endDate)
-		}
-		if status, ok := req.Filters["status"].(string); ok && status != "" {
-			query = query.Where("status = ?", status)
-		}
-		if vehicleID, ok := req.Filters["vehicle_id"].(string); ok && vehicleID != "" {
-			query = query.Where("vehicle_id = ?", vehicleID)
-		}
-		if driverID, ok := req.Filters["driver_id"].(string); ok && driverID != "" {
-			query = query.Where("driver_id = ?", driverID)
-		}
+// writeExport streams the rows of an export into a temporary file and moves
+// the file to blob storage
+func (es *ExportService) writeExport(ctx context.Context, dataExport *models.DataExport) error {
+	format, ok := exportFormats[dataExport.Format]
+	if !ok {
+		return fmt.Errorf("unsupported format: %s", dataExport.Format)
 	}
-	
-	// Get trips
-	var trips []models.Trip
-	err := query.Find(&trips).Error
+
+	file, err := os.CreateTemp("", "export-*."+dataExport.Format)
 	if err != nil {
-		return nil, ExportMetadata{}, fmt.Errorf("failed to get trips: %w", err)
-	}
-	
-	// Format data based on requested format
-	var data interface{}
-	var fileSize int64
-	
-	switch req.Format {
-	case "json":
-		data = trips
-		jsonData, _ := json.Marshal(trips)
-		fileSize = int64(len(jsonData))
-	case "csv":
-		csvData, err := es.convertToCSV(trips)
-		if err != nil {
-			return nil, ExportMetadata{}, fmt.Errorf("failed to convert to CSV: %w", err)
-		}
-		data = csvData
-		fileSize = int64(len(csvData))
-	default:
-		return nil, ExportMetadata{}, fmt.Errorf("unsupported format: %s", req.Format)
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	buffered := bufio.NewWriterSize(file, 64*1024)
+	count, err := es.writeRecords(ctx, dataExport, buffered)
+	if err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to size export file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind export file: %w", err)
+	}
+
+	dataExport.FileName = fmt.Sprintf("%s_%s.%s", dataExport.ExportType, time.Now().Format("20060102_150405"), dataExport.Format)
+	dataExport.StorageKey = fmt.Sprintf("%s%s/%s/%s", exportKeyPrefix, dataExport.CompanyID, dataExport.ID, dataExport.FileName)
+	dataExport.ContentType = format.contentType
+	dataExport.RecordCount = count
+	dataExport.FileSize = size
+
+	if err := es.store.Put(ctx, dataExport.StorageKey, file, size, format.contentType); err != nil {
+		return fmt.Errorf("failed to store export file: %w", err)
+	}
+	return nil
+}
+
+// failExport records why an export failed
+func (es *ExportService) failExport(ctx context.Context, dataExport *models.DataExport, cause error) {
+	dataExport.Status = models.ExportStatusFailed
+	dataExport.Error = cause.Error()
+	if err := es.db.WithContext(ctx).Model(dataExport).Updates(map[string]interface{}{
+		"status": models.ExportStatusFailed,
+		"error":  cause.Error(),
+	}).Error; err != nil {
+		fmt.Printf("Failed to mark export %s as failed: %v\n", dataExport.ID, err)
+	}
+}
+
+// cacheExport remembers a completed export so identical requests reuse its
+// file while it is kept
+func (es *ExportService) cacheExport(ctx context.Context, dataExport *models.DataExport) {
+	if es.cache == nil {
+		return
+	}
+
+	ttl := es.cache.GetTTLForExportType(dataExport.ExportType)
+	if ttl > es.retention {
+		ttl = es.retention
+	}
+	var userID string
+	if dataExport.RequestedBy != nil {
+		userID = *dataExport.RequestedBy
 	}
-	
 	metadata := ExportMetadata{
-		RecordCount: int64(len(trips)),
-		FileSize:    fileSize,
+		RecordCount: dataExport.RecordCount,
+		FileSize:    dataExport.FileSize,
 		ExportTime:  time.Now(),
-		Format:      req.Format,
-		Filters:     req.Filters,
+		Format:      dataExport.Format,
+		Filters:     dataExport.Filters,
+	}
+	if err := es.cache.SetExportCache(ctx, dataExport.ExportType, dataExport.Format, dataExport.ID, metadata,
+		dataExport.Filters, dataExport.CompanyID, userID, ttl); err != nil {
+		fmt.Printf("Warning: failed to cache export %s: %v\n", dataExport.ID, err)
 	}
-	
-	return data, metadata, nil
 }
 
-// exportGPSTracks exports GPS track data
-func (es *ExportService) exportGPSTracks(_ context.Context, req *ExportRequest) (interface{}, ExportMetadata, error) {
-	startTime := time.Now()
-	_ = startTime // Use the variable to avoid unused variable error
-	
-	// Build query
-	query := es.db.Model(&models.GPSTrack{})
-	
-	// Apply filters
-	if req.Filters != nil {
-		if startDate, ok := req.Filters["start_date"].(string); ok && startDate != "" {
-			query = query.Where("timestamp >= ?", startDate)
-		}
-		if endDate, ok := req.Filters["end_date"].(string); ok && endDate != "" {
-			query = query.Where("timestamp <= ?", endDate)
-		}
-		if vehicleID, ok := req.Filters["vehicle_id"].(string); ok && vehicleID != "" {
-			query = query.Where("vehicle_id = ?", vehicleID)
-		}
-		if driverID, ok := req.Filters["driver_id"].(string); ok && driverID != "" {
-			query = query.Where("driver_id = ?", driverID)
+// GetExport returns an export of a company with a fresh download link once
+// its file is ready
+func (es *ExportService) GetExport(ctx context.Context, companyID, exportID string) (*ExportStatus, error) {
+	var dataExport models.DataExport
+	if err := es.db.WithContext(ctx).Where("id = ? AND company_id = ?", exportID, companyID).First(&dataExport).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("export")
 		}
+		return nil, apperrors.Wrap(err, "Failed to get export")
 	}
-	
-	// Limit GPS tracks to prevent memory issues
-	limit := 10000
-	if req.Filters != nil {
-		if l, ok := req.Filters["limit"].(float64); ok && l > 0 {
-			limit = int(l)
-		}
+	return es.exportStatus(ctx, dataExport)
+}
+
+// ListExports returns the latest exports of a company, newest first
+func (es *ExportService) ListExports(ctx context.Context, companyID string, limit int) ([]ExportStatus, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
 	}
-	query = query.Limit(limit)
-	
-	// Get GPS tracks
-	var gpsTracks []models.GPSTrack
-	err := query.Find(&gpsTracks).Error
-	if err != nil {
-		return nil, ExportMetadata{}, fmt.Errorf("failed to get GPS tracks: %w", err)
-	}
-	
-	// Format data based on requested format
-	var data interface{}
-	var fileSize int64
-	
-	switch req.Format {
-	case "json":
-		data = gpsTracks
-		jsonData, _ := json.Marshal(gpsTracks)
-		fileSize = int64(len(jsonData))
-	case "csv":
-		csvData, err := es.convertToCSV(gpsTracks)
+
+	var dataExports []models.DataExport
+	if err := es.db.WithContext(ctx).Where("company_id = ?", companyID).
+		Order("created_at DESC").Limit(limit).Find(&dataExports).Error; err != nil {
+		return nil, apperrors.Wrap(err, "Failed to list exports")
+	}
+
+	statuses := make([]ExportStatus, 0, len(dataExports))
+	for _, dataExport := range dataExports {
+		status, err := es.exportStatus(ctx, dataExport)
 		if err != nil {
-			return nil, ExportMetadata{}, fmt.Errorf("failed to convert to CSV: %w", err)
+			return nil, err
 		}
-		data = csvData
-		fileSize = int64(len(csvData))
-	default:
-		return nil, ExportMetadata{}, fmt.Errorf("unsupported format: %s", req.Format)
+		statuses = append(statuses, *status)
 	}
-	
-	metadata := ExportMetadata{
-		RecordCount: int64(len(gpsTracks)),
-		FileSize:    fileSize,
-		ExportTime:  time.Now(),
-		Format:      req.Format,
-		Filters:     req.Filters,
-	}
-	
-	return data, metadata, nil
+	return statuses, nil
 }
 
-// exportReports exports report data
-func (es *ExportService) exportReports(_ context.Context, req *ExportRequest) (interface{}, ExportMetadata, error) {
-	startTime := time.Now()
-	_ = startTime // Use the variable to avoid unused variable error
-	
-	// This would integrate with the analytics service to generate reports
-	// For now, return a placeholder
-	reportData := map[string]interface{}{
-		"report_type": req.Filters["report_type"],
-		"generated_at": time.Now(),
-		"data": "Report data would be generated here",
-	}
-	
-	// Format data based on requested format
-	var data interface{}
-	var fileSize int64
-	
-	switch req.Format {
-	case "json":
-		data = reportData
-		jsonData, _ := json.Marshal(reportData)
-		fileSize = int64(len(jsonData))
-	case "csv":
-		// Convert report to CSV format
-		csvData := "Report Type,Generated At,Data\n"
-		csvData += fmt.Sprintf("%v,%v,%v\n", 
-			reportData["report_type"], 
-			reportData["generated_at"], 
-			reportData["data"])
-		data = csvData
-		fileSize = int64(len(csvData))
-	default:
-		return nil, ExportMetadata{}, fmt.Errorf("unsupported format: %s", req.Format)
-	}
-	
-	metadata := ExportMetadata{
-		RecordCount: 1,
-		FileSize:    fileSize,
-		ExportTime:  time.Now(),
-		Format:      req.Format,
-		Filters:     req.Filters,
+// exportStatus adds a download link to a completed, unexpired export. Links
+// never outlive the file they point to.
+func (es *ExportService) exportStatus(ctx context.Context, dataExport models.DataExport) (*ExportStatus, error) {
+	status := &ExportStatus{DataExport: dataExport}
+	if dataExport.Status != models.ExportStatusCompleted || dataExport.ExpiresAt == nil || es.store == nil {
+		return status, nil
+	}
+
+	expiry := es.linkTTL
+	if remaining := time.Until(*dataExport.ExpiresAt); remaining < expiry {
+		expiry = remaining
+	}
+	if expiry <= 0 {
+		return status, nil
 	}
-	
-	return data, metadata, nil
-}
 
-// convertToCSV converts a slice of structs to CSV format
-func (es *ExportService) convertToCSV(data interface{}) (string, error) {
-	// This is a simplified CSV conversion
-	// In a real implementation, you'd want to use reflection or a proper CSV library
-	
-	switch v := data.(type) {
-	case []models.Vehicle:
-		return es.vehiclesToCSV(v)
-	case []models.Driver:
-		return es.driversToCSV(v)
-	case []models.Trip:
-		return es.tripsToCSV(v)
-	case []models.GPSTrack:
-		return es.gpsTracksToCSV(v)
-	default:
-		return "", fmt.Errorf("unsupported data type for CSV conversion")
+	link, err := es.store.SignedURL(ctx, dataExport.StorageKey, expiry)
+	if err != nil {
+		return nil, apperrors.Wrap(err, "Failed to sign download link")
 	}
+	expiresAt := time.Now().Add(expiry)
+	status.DownloadURL = link
+	status.DownloadExpiresAt = &expiresAt
+	return status, nil
 }
 
-// vehiclesToCSV converts vehicles to CSV format
-func (es *ExportService) vehiclesToCSV(vehicles []models.Vehicle) (string, error) {
-	var csvData string
-	
-	// Header
-	csvData += "ID,License Plate,Make,Model,Year,Color,Status,Company ID,Created At\n"
-	
-	// Data rows
-	for _, vehicle := range vehicles {
-		csvData += fmt.Sprintf("%s,%s,%s,%s,%d,%s,%s,%s,%s\n",
-			vehicle.ID,
-			vehicle.LicensePlate,
-			vehicle.Make,
-			vehicle.Model,
-			vehicle.Year,
-			vehicle.Color,
-			vehicle.Status,
-			vehicle.CompanyID,
-			vehicle.CreatedAt.Format("2006-01-02 15:04:05"),
-		)
-	}
-	
-	return csvData, nil
+// DownloadFile describes a file served from a signed download link
+type DownloadFile struct {
+	Name        string
+	ContentType string
+	Size        int64 // -1 when unknown
 }
 
-// driversToCSV converts drivers to CSV format
-func (es *ExportService) driversToCSV(drivers []models.Driver) (string, error) {
-	var csvData string
-	
-	// Header
-	csvData += "ID,First Name,Last Name,Email,Phone,NIK,Status,Company ID,Created At\n"
-	
-	// Data rows
-	for _, driver := range drivers {
-		csvData += fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%s,%s\n",
-			driver.ID,
-			driver.FirstName,
-			driver.LastName,
-			driver.Email,
-			driver.Phone,
-			driver.NIK,
-			driver.Status,
-			driver.CompanyID,
-			driver.CreatedAt.Format("2006-01-02 15:04:05"),
-		)
-	}
-	
-	return csvData, nil
+// OpenDownload checks a signed download link served by this API and opens
+// the file it points to. Export files must belong to a completed export;
+// other files kept in the same store, such as generated reports, are
+// authorized by the signature alone and described by their key.
+func (es *ExportService) OpenDownload(ctx context.Context, key, expires, signature string) (io.ReadCloser, *DownloadFile, error) {
+	verifier, ok := es.store.(signedURLVerifier)
+	if !ok {
+		return nil, nil, apperrors.NewNotFoundError("export file")
+	}
+	if err := verifier.Verify(key, expires, signature); err != nil {
+		return nil, nil, apperrors.NewForbiddenError("Download link is invalid or has expired")
+	}
+
+	file := &DownloadFile{
+		Name:        path.Base(key),
+		ContentType: ContentType(strings.TrimPrefix(path.Ext(key), ".")),
+		Size:        -1,
+	}
+	if strings.HasPrefix(key, exportKeyPrefix) {
+		var dataExport models.DataExport
+		if err := es.db.WithContext(ctx).Where("storage_key = ? AND status = ?", key, models.ExportStatusCompleted).
+			First(&dataExport).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, apperrors.NewNotFoundError("export file")
+			}
+			return nil, nil, apperrors.Wrap(err, "Failed to get export")
+		}
+		file = &DownloadFile{Name: dataExport.FileName, ContentType: dataExport.ContentType, Size: dataExport.FileSize}
+	}
+	if file.ContentType == "" {
+		file.ContentType = "application/octet-stream"
+	}
+
+	reader, err := es.store.Open(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, apperrors.NewNotFoundError("export file")
+	}
+	if err != nil {
+		return nil, nil, apperrors.Wrap(err, "Failed to open export file")
+	}
+	return reader, file, nil
 }
 
-// tripsToCSV converts trips to CSV format
-func (es *ExportService) tripsToCSV(trips []models.Trip) (string, error) {
-	var csvData string
-	
-	// Header
-	csvData += "ID,Vehicle ID,Driver ID,Start Time,End Time,Status,Total Distance,Total Duration,Company ID,Created At\n"
-	
-	// Data rows
-	for _, trip := range trips {
-		csvData += fmt.Sprintf("%s,%s,%s,%s,%s,%s,%.2f,%d,%s,%s\n",
-			trip.ID,
-			trip.VehicleID,
-			*trip.DriverID,
-			trip.StartTime.Format("2006-01-02 15:04:05"),
-			trip.EndTime.Format("2006-01-02 15:04:05"),
-			trip.Status,
-			trip.TotalDistance,
-			trip.TotalDuration,
-			trip.CompanyID,
-			trip.CreatedAt.Format("2006-01-02 15:04:05"),
-		)
-	}
-	
-	return csvData, nil
+// CleanupExpiredExports deletes the files of expired exports and returns
+// how many were removed
+func (es *ExportService) CleanupExpiredExports(ctx context.Context) (int, error) {
+	if es.store == nil {
+		return 0, nil
+	}
+
+	var expired []models.DataExport
+	if err := es.db.WithContext(ctx).Where("status = ? AND expires_at < ?", models.ExportStatusCompleted, time.Now()).
+		Order("expires_at").Limit(cleanupBatchSize).Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to find expired exports: %w", err)
+	}
+
+	removed := 0
+	for i := range expired {
+		if err := es.store.Delete(ctx, expired[i].StorageKey); err != nil {
+			fmt.Printf("Failed to delete export file %s: %v\n", expired[i].StorageKey, err)
+			continue
+		}
+		if err := es.db.WithContext(ctx).Model(&expired[i]).Update("status", models.ExportStatusExpired).Error; err != nil {
+			return removed, fmt.Errorf("failed to expire export %s: %w", expired[i].ID, err)
+		}
+		removed++
+	}
+	return removed, nil
 }
 
-// gpsTracksToCSV converts GPS tracks to CSV format
-func (es *ExportService) gpsTracksToCSV(gpsTracks []models.GPSTrack) (string, error) {
-	var csvData string
-	
-	// Header
-	csvData += "ID,Vehicle ID,Driver ID,Latitude,Longitude,Speed,Heading,Timestamp\n"
-	
-	// Data rows
-	for _, track := range gpsTracks {
-		csvData += fmt.Sprintf("%s,%s,%s,%.6f,%.6f,%.2f,%.2f,%s\n",
-			track.ID,
-			track.VehicleID,
-			*track.DriverID,
-			track.Latitude,
-			track.Longitude,
-			track.Speed,
-			track.Heading,
-			track.Timestamp.Format("2006-01-02 15:04:05"),
-		)
-	}
-	
-	return csvData, nil
+// validateExportRequest checks the export type and format of a request
+func validateExportRequest(req *ExportRequest) error {
+	if req.CompanyID == "" {
+		return apperrors.NewValidationError("company is required")
+	}
+	if !IsValidExportType(req.ExportType) {
+		return apperrors.NewValidationError(fmt.Sprintf("unsupported export type: %s", req.ExportType))
+	}
+	if !IsValidFormat(req.Format) {
+		return apperrors.NewValidationError(fmt.Sprintf("unsupported format: %s", req.Format))
+	}
+	return nil
 }
 
 // InvalidateCache invalidates cache for specific export parameters
@@ -0,0 +1,231 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/storage"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+const testDownloadURL = "http://localhost:8080/api/v1/exports/download"
+
+// fakeExportQueue records the exports it is asked to run
+type fakeExportQueue struct {
+	exportIDs []string
+	err       error
+}
+
+func (q *fakeExportQueue) EnqueueDataExport(_ context.Context, _, _, exportID string) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.exportIDs = append(q.exportIDs, exportID)
+	return nil
+}
+
+// newTestExportService returns an export service writing to a temporary
+// local store
+func newTestExportService(t *testing.T, db *gorm.DB) (*ExportService, *fakeExportQueue, *storage.LocalStore) {
+	store, err := storage.NewLocalStore(t.TempDir(), testDownloadURL, "test-export-link-secret")
+	require.NoError(t, err)
+	queue := &fakeExportQueue{}
+
+	service := NewExportService(db, nil)
+	service.SetStorage(store, time.Hour, 24*time.Hour)
+	service.SetQueue(queue)
+	return service, queue, store
+}
+
+// createTestVehicle creates a vehicle with a unique license plate and VIN,
+// which soft-deleted vehicles of earlier tests keep reserved
+func createTestVehicle(t *testing.T, db *gorm.DB, companyID string) *models.Vehicle {
+	vehicle := testutil.NewTestVehicle(companyID)
+	suffix := strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", ""))
+	vehicle.LicensePlate = "B " + suffix[:8]
+	vehicle.VIN = suffix[:17]
+	require.NoError(t, db.Create(vehicle).Error)
+	return vehicle
+}
+
+// assertAppErrorStatus asserts that err is an AppError with an HTTP status
+func assertAppErrorStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	appErr, ok := err.(*apperrors.AppError)
+	require.True(t, ok, "expected an AppError, got %v", err)
+	assert.Equal(t, status, appErr.Status)
+}
+
+func TestExportService_RequestExport(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	userID := uuid.New().String()
+
+	t.Run("unavailable without storage", func(t *testing.T) {
+		_, err := NewExportService(db, nil).RequestExport(ctx, &ExportRequest{
+			ExportType: "vehicles", Format: "csv", CompanyID: company.ID,
+		})
+		assertAppErrorStatus(t, err, http.StatusServiceUnavailable)
+	})
+
+	service, queue, _ := newTestExportService(t, db)
+
+	t.Run("reject unsupported format", func(t *testing.T) {
+		_, err := service.RequestExport(ctx, &ExportRequest{ExportType: "vehicles", Format: "doc", CompanyID: company.ID})
+		assertAppErrorStatus(t, err, http.StatusBadRequest)
+		assert.Empty(t, queue.exportIDs)
+	})
+
+	t.Run("record and queue a pending export", func(t *testing.T) {
+		status, err := service.RequestExport(ctx, &ExportRequest{
+			ExportType: "vehicles",
+			Format:     "csv",
+			Filters:    map[string]interface{}{"status": "active"},
+			CompanyID:  company.ID,
+			UserID:     userID,
+		})
+		require.NoError(t, err)
+		testutil.AssertValidUUID(t, status.ID)
+		assert.Equal(t, models.ExportStatusPending, status.Status)
+		assert.Empty(t, status.DownloadURL)
+		assert.Equal(t, []string{status.ID}, queue.exportIDs)
+
+		var stored models.DataExport
+		require.NoError(t, db.First(&stored, "id = ?", status.ID).Error)
+		assert.Equal(t, company.ID, stored.CompanyID)
+		require.NotNil(t, stored.RequestedBy)
+		assert.Equal(t, userID, *stored.RequestedBy)
+		assert.Equal(t, "active", stored.Filters["status"])
+	})
+
+	t.Run("mark the export failed when it cannot be queued", func(t *testing.T) {
+		queue.err = errors.New("redis unavailable")
+		defer func() { queue.err = nil }()
+
+		_, err := service.RequestExport(ctx, &ExportRequest{ExportType: "drivers", Format: "csv", CompanyID: company.ID})
+		require.Error(t, err)
+
+		var failed models.DataExport
+		require.NoError(t, db.Where("company_id = ? AND export_type = ?", company.ID, "drivers").First(&failed).Error)
+		assert.Equal(t, models.ExportStatusFailed, failed.Status)
+		assert.Equal(t, "redis unavailable", failed.Error)
+	})
+}
+
+func TestExportService_RunExport(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	service, _, store := newTestExportService(t, db)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	otherCompany := testutil.NewTestCompany()
+	require.NoError(t, db.Create(otherCompany).Error)
+
+	vehicles := []*models.Vehicle{createTestVehicle(t, db, company.ID), createTestVehicle(t, db, company.ID)}
+	createTestVehicle(t, db, otherCompany.ID)
+
+	dataExport, err := service.CreateExport(ctx, &ExportRequest{ExportType: "vehicles", Format: "csv", CompanyID: company.ID})
+	require.NoError(t, err)
+
+	completed, err := service.RunExport(ctx, dataExport.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ExportStatusCompleted, completed.Status)
+	assert.Equal(t, int64(2), completed.RecordCount)
+	assert.Positive(t, completed.FileSize)
+	assert.Equal(t, "text/csv", completed.ContentType)
+	assert.True(t, strings.HasPrefix(completed.StorageKey, exportKeyPrefix+company.ID+"/"+dataExport.ID+"/"))
+	require.NotNil(t, completed.ExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), *completed.ExpiresAt, time.Minute)
+
+	t.Run("running again keeps the completed export", func(t *testing.T) {
+		again, err := service.RunExport(ctx, dataExport.ID)
+		require.NoError(t, err)
+		assert.Equal(t, completed.StorageKey, again.StorageKey)
+	})
+
+	t.Run("unknown export", func(t *testing.T) {
+		_, err := service.RunExport(ctx, uuid.New().String())
+		assertAppErrorStatus(t, err, http.StatusNotFound)
+	})
+
+	t.Run("get and list exports per company", func(t *testing.T) {
+		status, err := service.GetExport(ctx, company.ID, dataExport.ID)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(status.DownloadURL, testDownloadURL+"/"))
+		require.NotNil(t, status.DownloadExpiresAt)
+
+		_, err = service.GetExport(ctx, otherCompany.ID, dataExport.ID)
+		assertAppErrorStatus(t, err, http.StatusNotFound)
+
+		statuses, err := service.ListExports(ctx, company.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, statuses, 1)
+		assert.Equal(t, dataExport.ID, statuses[0].ID)
+
+		others, err := service.ListExports(ctx, otherCompany.ID, 0)
+		require.NoError(t, err)
+		assert.Empty(t, others)
+	})
+
+	t.Run("download through the signed link", func(t *testing.T) {
+		status, err := service.GetExport(ctx, company.ID, dataExport.ID)
+		require.NoError(t, err)
+		link, err := url.Parse(status.DownloadURL)
+		require.NoError(t, err)
+		base, err := url.Parse(testDownloadURL)
+		require.NoError(t, err)
+		key := strings.TrimPrefix(link.Path, base.Path+"/")
+
+		_, _, err = service.OpenDownload(ctx, key, link.Query().Get("expires"), "forged")
+		assertAppErrorStatus(t, err, http.StatusForbidden)
+
+		reader, file, err := service.OpenDownload(ctx, key, link.Query().Get("expires"), link.Query().Get("signature"))
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, completed.FileName, file.Name)
+		assert.Equal(t, completed.FileSize, file.Size)
+
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		for _, vehicle := range vehicles {
+			assert.Contains(t, string(content), vehicle.LicensePlate)
+		}
+	})
+
+	t.Run("cleanup deletes the files of expired exports", func(t *testing.T) {
+		require.NoError(t, db.Model(&models.DataExport{}).Where("id = ?", dataExport.ID).
+			Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		removed, err := service.CleanupExpiredExports(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, removed)
+
+		status, err := service.GetExport(ctx, company.ID, dataExport.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.ExportStatusExpired, status.Status)
+		assert.Empty(t, status.DownloadURL)
+
+		_, err = store.Open(ctx, completed.StorageKey)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+}
@@ -0,0 +1,380 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnKind selects how the values of a column are rendered
+type ColumnKind int
+
+const (
+	ColumnText ColumnKind = iota
+	ColumnInteger
+	ColumnNumber
+	ColumnRupiah
+	ColumnTime
+)
+
+// Column describes a column of an exported table
+type Column struct {
+	Header   string
+	Kind     ColumnKind
+	Decimals int     // fraction digits of printed ColumnNumber and ColumnRupiah values
+	Width    float64 // in characters; zero picks a width from the kind
+}
+
+// Cell is a value rendered as its own kind instead of its column's, for
+// columns mixing kinds such as the values of a report summary
+type Cell struct {
+	Value    interface{}
+	Kind     ColumnKind
+	Decimals int
+}
+
+// Exporter renders tables of records into an export file. Row values are
+// strings, integers, floats, booleans, time.Time, nil or Cell.
+type Exporter interface {
+	// BeginSheet starts a table; tabular formats write its header
+	BeginSheet(name string, columns []Column) error
+	// WriteRow writes a row of the current table. Record formats serialize
+	// record, or the values keyed by column header when record is nil.
+	WriteRow(record interface{}, values []interface{}) error
+	// Close finishes the file, without closing the underlying writer
+	Close() error
+}
+
+// exportFormat describes an export file format
+type exportFormat struct {
+	contentType string
+	newExporter func(w io.Writer, title string) Exporter
+}
+
+// exportFormats are the supported export file formats
+var exportFormats = map[string]exportFormat{
+	"csv":   {contentType: "text/csv", newExporter: newCSVExporter},
+	"json":  {contentType: "application/json", newExporter: newJSONExporter},
+	"jsonl": {contentType: "application/x-ndjson", newExporter: newJSONLinesExporter},
+	"xlsx":  {contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newExporter: newXLSXExporter},
+	"pdf":   {contentType: "application/pdf", newExporter: newPDFExporter},
+}
+
+// IsValidFormat reports whether exports can be written in a format
+func IsValidFormat(format string) bool {
+	_, ok := exportFormats[format]
+	return ok
+}
+
+// ContentType returns the MIME type of an export format
+func ContentType(format string) string {
+	return exportFormats[format].contentType
+}
+
+// NewExporter creates an exporter writing a format to w. The title heads
+// printable formats.
+func NewExporter(format string, w io.Writer, title string) (Exporter, error) {
+	exportFormat, ok := exportFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	return exportFormat.newExporter(w, title), nil
+}
+
+// csvExporter writes rows as CSV. Sheets after the first are separated by a
+// blank line and a line holding the sheet name.
+type csvExporter struct {
+	writer  *csv.Writer
+	columns []Column
+	sheets  int
+}
+
+func newCSVExporter(w io.Writer, _ string) Exporter {
+	return &csvExporter{writer: csv.NewWriter(w)}
+}
+
+func (ce *csvExporter) BeginSheet(name string, columns []Column) error {
+	if ce.sheets > 0 {
+		if err := ce.writer.Write(nil); err != nil {
+			return err
+		}
+		if err := ce.writer.Write([]string{name}); err != nil {
+			return err
+		}
+	}
+	ce.sheets++
+	ce.columns = columns
+
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.Header
+	}
+	return ce.writer.Write(headers)
+}
+
+func (ce *csvExporter) WriteRow(_ interface{}, values []interface{}) error {
+	fields := make([]string, len(values))
+	for i, value := range values {
+		fields[i] = plainText(cellAt(ce.columns, i, value))
+	}
+	return ce.writer.Write(fields)
+}
+
+func (ce *csvExporter) Close() error {
+	ce.writer.Flush()
+	return ce.writer.Error()
+}
+
+// jsonExporter writes the records of all sheets as the elements of a JSON
+// array
+type jsonExporter struct {
+	writer  io.Writer
+	columns []Column
+	written int
+}
+
+func newJSONExporter(w io.Writer, _ string) Exporter {
+	return &jsonExporter{writer: w}
+}
+
+func (je *jsonExporter) BeginSheet(_ string, columns []Column) error {
+	je.columns = columns
+	return nil
+}
+
+func (je *jsonExporter) WriteRow(record interface{}, values []interface{}) error {
+	data, err := json.Marshal(rowRecord(je.columns, record, values))
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if je.written == 0 {
+		separator = "[\n"
+	}
+	if _, err := io.WriteString(je.writer, separator); err != nil {
+		return err
+	}
+	if _, err := je.writer.Write(data); err != nil {
+		return err
+	}
+	je.written++
+	return nil
+}
+
+func (je *jsonExporter) Close() error {
+	trailer := "\n]\n"
+	if je.written == 0 {
+		trailer = "[]\n"
+	}
+	_, err := io.WriteString(je.writer, trailer)
+	return err
+}
+
+// jsonLinesExporter writes one JSON record per line
+type jsonLinesExporter struct {
+	encoder *json.Encoder
+	columns []Column
+}
+
+func newJSONLinesExporter(w io.Writer, _ string) Exporter {
+	return &jsonLinesExporter{encoder: json.NewEncoder(w)}
+}
+
+func (je *jsonLinesExporter) BeginSheet(_ string, columns []Column) error {
+	je.columns = columns
+	return nil
+}
+
+func (je *jsonLinesExporter) WriteRow(record interface{}, values []interface{}) error {
+	return je.encoder.Encode(rowRecord(je.columns, record, values))
+}
+
+func (je *jsonLinesExporter) Close() error {
+	return nil
+}
+
+// rowRecord returns the record of a row, built from its values when the row
+// has none
+func rowRecord(columns []Column, record interface{}, values []interface{}) interface{} {
+	if record != nil {
+		return record
+	}
+	fields := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		if cell, ok := value.(Cell); ok {
+			value = cell.Value
+		}
+		header := fmt.Sprintf("column_%d", i+1)
+		if i < len(columns) {
+			header = columns[i].Header
+		}
+		fields[header] = value
+	}
+	return fields
+}
+
+// cellAt resolves the value of a row's i-th cell and how it is rendered
+func cellAt(columns []Column, i int, value interface{}) (interface{}, ColumnKind, int) {
+	if cell, ok := value.(Cell); ok {
+		return normalizeValue(cell.Value), cell.Kind, cell.Decimals
+	}
+	if i < len(columns) {
+		return normalizeValue(value), columns[i].Kind, columns[i].Decimals
+	}
+	return normalizeValue(value), ColumnText, 0
+}
+
+// normalizeValue reduces a value to a string, int64, float64, bool,
+// time.Time or nil
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, int64, float64, bool:
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		return v
+	case *time.Time:
+		if v == nil || v.IsZero() {
+			return nil
+		}
+		return *v
+	case *string:
+		if v == nil {
+			return nil
+		}
+		return *v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// plainText renders a value for machine-readable formats
+func plainText(value interface{}, kind ColumnKind, decimals int) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		if kind == ColumnNumber {
+			return strconv.FormatFloat(float64(v), 'f', decimals, 64)
+		}
+		return strconv.FormatInt(v, 10)
+	case float64:
+		switch kind {
+		case ColumnInteger:
+			return strconv.FormatFloat(v, 'f', 0, 64)
+		case ColumnNumber:
+			return strconv.FormatFloat(v, 'f', decimals, 64)
+		default:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// displayText renders a value for printing, with Indonesian number formats
+func displayText(value interface{}, kind ColumnKind, decimals int) string {
+	number, isNumber := 0.0, false
+	switch v := value.(type) {
+	case int64:
+		number, isNumber = float64(v), true
+	case float64:
+		number, isNumber = v, true
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case time.Time:
+		return v.Format("02/01/2006 15:04")
+	}
+	if !isNumber {
+		return plainText(value, kind, decimals)
+	}
+
+	switch kind {
+	case ColumnInteger:
+		return formatIndonesianNumber(number, 0)
+	case ColumnNumber:
+		return formatIndonesianNumber(number, decimals)
+	case ColumnRupiah:
+		if number < 0 {
+			return "-Rp " + formatIndonesianNumber(-number, decimals)
+		}
+		return "Rp " + formatIndonesianNumber(number, decimals)
+	default:
+		return plainText(value, kind, decimals)
+	}
+}
+
+// formatIndonesianNumber formats a number with dots between thousands and a
+// decimal comma, e.g. 1.234.567,89
+func formatIndonesianNumber(value float64, decimals int) string {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	formatted := strconv.FormatFloat(math.Abs(value), 'f', decimals, 64)
+	whole, fraction, _ := strings.Cut(formatted, ".")
+
+	var grouped strings.Builder
+	if value < 0 && strings.Trim(formatted, "0.") != "" {
+		grouped.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte('.')
+		}
+		grouped.WriteRune(digit)
+	}
+	if fraction != "" {
+		grouped.WriteString("," + fraction)
+	}
+	return grouped.String()
+}
+
+// columnWidth returns the width of a column in characters
+func columnWidth(column Column) float64 {
+	if column.Width > 0 {
+		return column.Width
+	}
+	width := 16.0
+	switch column.Kind {
+	case ColumnInteger:
+		width = 10
+	case ColumnNumber:
+		width = 12
+	case ColumnRupiah:
+		width = 16
+	case ColumnTime:
+		width = 19
+	}
+	if header := float64(len(column.Header)) + 2; header > width {
+		width = header
+	}
+	return width
+}
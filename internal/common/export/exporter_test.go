@@ -0,0 +1,240 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testColumns = []Column{
+	{Header: "Plate"},
+	{Header: "Trips", Kind: ColumnInteger},
+	{Header: "Distance", Kind: ColumnNumber, Decimals: 2},
+	{Header: "Latitude", Kind: ColumnNumber, Decimals: 6},
+	{Header: "Fuel Cost", Kind: ColumnRupiah},
+	{Header: "Last Seen", Kind: ColumnTime},
+}
+
+var testRows = [][]interface{}{
+	{"B 1234 ABC", 12, 1234.5, -6.2088, 1500000.0, time.Date(2024, 5, 6, 8, 30, 0, 0, time.UTC)},
+	{"D 9 XY, Bandung", int64(3), 10.0, -6.9175, int64(250000), nil},
+}
+
+func exportTable(t *testing.T, format string) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	exporter, err := NewExporter(format, &out, "Vehicles - 06/05/2024 08:30")
+	require.NoError(t, err)
+	require.NoError(t, exporter.BeginSheet("Vehicles", testColumns))
+	for _, row := range testRows {
+		require.NoError(t, exporter.WriteRow(nil, row))
+	}
+	require.NoError(t, exporter.Close())
+	return out.Bytes()
+}
+
+func TestNewExporter_UnknownFormat(t *testing.T) {
+	_, err := NewExporter("xml", io.Discard, "")
+	assert.Error(t, err)
+	assert.False(t, IsValidFormat("xml"))
+	for _, format := range []string{"csv", "json", "jsonl", "xlsx", "pdf"} {
+		assert.True(t, IsValidFormat(format), format)
+		assert.NotEmpty(t, ContentType(format), format)
+	}
+}
+
+func TestCSVExporter(t *testing.T) {
+	assert.Equal(t, "Plate,Trips,Distance,Latitude,Fuel Cost,Last Seen\n"+
+		"B 1234 ABC,12,1234.50,-6.208800,1500000,2024-05-06 08:30:00\n"+
+		"\"D 9 XY, Bandung\",3,10.00,-6.917500,250000,\n", string(exportTable(t, "csv")))
+
+	var out bytes.Buffer
+	exporter, _ := NewExporter("csv", &out, "")
+	require.NoError(t, exporter.BeginSheet("Summary", []Column{{Header: "Field"}}))
+	require.NoError(t, exporter.WriteRow(nil, []interface{}{"a"}))
+	require.NoError(t, exporter.BeginSheet("Vehicles", []Column{{Header: "Plate"}}))
+	require.NoError(t, exporter.Close())
+	assert.Equal(t, "Field\na\n\nVehicles\nPlate\n", out.String(), "later sheets are separated by their name")
+}
+
+func TestJSONExporters(t *testing.T) {
+	var records []map[string]interface{}
+	require.NoError(t, json.Unmarshal(exportTable(t, "json"), &records))
+	require.Len(t, records, 2)
+	assert.Equal(t, "B 1234 ABC", records[0]["Plate"], "records are built from the values without a record")
+	assert.Equal(t, 12.0, records[0]["Trips"])
+
+	lines := strings.Split(strings.TrimSpace(string(exportTable(t, "jsonl"))), "\n")
+	require.Len(t, lines, 2)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "D 9 XY, Bandung", record["Plate"])
+
+	var out bytes.Buffer
+	exporter, _ := NewExporter("jsonl", &out, "")
+	require.NoError(t, exporter.BeginSheet("Trips", nil))
+	require.NoError(t, exporter.WriteRow(map[string]string{"id": "t1"}, []interface{}{"ignored"}))
+	require.NoError(t, exporter.Close())
+	assert.Equal(t, "{\"id\":\"t1\"}\n", out.String(), "records are written as they are")
+
+	out.Reset()
+	exporter, _ = NewExporter("json", &out, "")
+	require.NoError(t, exporter.Close())
+	assert.Equal(t, "[]\n", out.String())
+}
+
+func TestDisplayText(t *testing.T) {
+	assert.Equal(t, "1.234.567", displayText(int64(1234567), ColumnInteger, 0))
+	assert.Equal(t, "1.234,50", displayText(1234.5, ColumnNumber, 2))
+	assert.Equal(t, "-0,50", displayText(-0.5, ColumnNumber, 2))
+	assert.Equal(t, "Rp 1.500.000", displayText(1500000.0, ColumnRupiah, 0))
+	assert.Equal(t, "-Rp 25.000", displayText(int64(-25000), ColumnRupiah, 0))
+	assert.Equal(t, "06/05/2024 08:30", displayText(time.Date(2024, 5, 6, 8, 30, 0, 0, time.UTC), ColumnTime, 0))
+	assert.Equal(t, "999", displayText(int64(999), ColumnText, 0))
+}
+
+// readZip returns the entries of a zip archive
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	entries := map[string]string{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		reader.Close()
+		entries[file.Name] = string(content)
+	}
+	return entries
+}
+
+func TestXLSXExporter(t *testing.T) {
+	entries := readZip(t, exportTable(t, "xlsx"))
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		assert.Contains(t, entries, name)
+	}
+
+	sheet := entries["xl/worksheets/sheet1.xml"]
+	assert.Contains(t, sheet, `<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`, "the header row is frozen")
+	assert.Contains(t, sheet, `<c r="A1" t="inlineStr" s="1"><is><t>Plate</t></is></c>`, "headers are styled")
+	assert.Contains(t, sheet, `<c r="B2" s="2"><v>12</v></c>`, "integers use the thousands format")
+	assert.Contains(t, sheet, `<c r="C2" s="3"><v>1234.5</v></c>`, "numbers keep their value")
+	assert.Contains(t, sheet, `<c r="D2" s="7"><v>-6.2088</v></c>`, "coordinates get a six decimal format")
+	assert.Contains(t, sheet, `<c r="E2" s="4"><v>1500000</v></c>`, "amounts use the Rupiah format")
+	assert.Contains(t, sheet, `<c r="F2" s="5"><v>45418.354167</v></c>`, "times are date serials")
+	assert.Contains(t, sheet, `<is><t xml:space="preserve">D 9 XY, Bandung</t></is>`)
+	assert.NotContains(t, sheet, `r="F3"`, "empty cells are left out")
+
+	styles := entries["xl/styles.xml"]
+	assert.Contains(t, styles, `formatCode="&quot;Rp&quot;\ #,##0"`)
+	assert.Contains(t, styles, `<numFmt numFmtId="166" formatCode="#,##0.000000"/>`)
+	assert.Contains(t, styles, `<cellXfs count="8">`)
+	assert.Contains(t, entries["xl/workbook.xml"], `<sheet name="Vehicles" sheetId="1" r:id="rId1"/>`)
+}
+
+func TestXLSXExporter_SheetNames(t *testing.T) {
+	var out bytes.Buffer
+	exporter, _ := NewExporter("xlsx", &out, "")
+	for _, name := range []string{"Summary", "summary", "Fuel / Theft [Alerts]: monthly report details"} {
+		require.NoError(t, exporter.BeginSheet(name, []Column{{Header: "Field"}}))
+	}
+	require.NoError(t, exporter.Close())
+
+	workbook := readZip(t, out.Bytes())["xl/workbook.xml"]
+	assert.Contains(t, workbook, `name="Summary"`)
+	assert.Contains(t, workbook, `name="summary 2"`, "sheet names are unique regardless of case")
+	assert.Contains(t, workbook, `name="Fuel - Theft -Alerts-- monthly"`, "invalid characters are replaced and names shortened")
+}
+
+func TestXLSXExporter_Empty(t *testing.T) {
+	var out bytes.Buffer
+	exporter, _ := NewExporter("xlsx", &out, "")
+	require.NoError(t, exporter.Close())
+	assert.Contains(t, readZip(t, out.Bytes()), "xl/worksheets/sheet1.xml", "workbooks need a sheet")
+}
+
+func TestCellRef(t *testing.T) {
+	assert.Equal(t, "A1", cellRef(0, 1))
+	assert.Equal(t, "Z9", cellRef(25, 9))
+	assert.Equal(t, "AA10", cellRef(26, 10))
+	assert.Equal(t, "AZ1", cellRef(51, 1))
+	assert.Equal(t, "BA1", cellRef(52, 1))
+}
+
+// pdfPages returns the decompressed content streams of a PDF, checking the
+// cross-reference table points at its objects
+func pdfPages(t *testing.T, data []byte) []string {
+	t.Helper()
+	document := string(data)
+	require.True(t, strings.HasPrefix(document, "%PDF-1.4\n"))
+	require.True(t, strings.HasSuffix(document, "%%EOF\n"))
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(document)
+	require.NotNil(t, startxref)
+	xref, _ := strconv.Atoi(startxref[1])
+	require.True(t, strings.HasPrefix(document[xref:], "xref\n"))
+	for i, offset := range regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(document[xref:], -1) {
+		at, _ := strconv.Atoi(offset[1])
+		assert.True(t, strings.HasPrefix(document[at:], strconv.Itoa(i+1)+" 0 obj\n"), "object %d", i+1)
+	}
+
+	var pages []string
+	for _, stream := range regexp.MustCompile(`(?s)/Length (\d+) /Filter /FlateDecode >>\nstream\n`).FindAllStringSubmatchIndex(document, -1) {
+		length, _ := strconv.Atoi(document[stream[2]:stream[3]])
+		reader, err := zlib.NewReader(strings.NewReader(document[stream[1] : stream[1]+length]))
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		pages = append(pages, string(content))
+	}
+	return pages
+}
+
+func TestPDFExporter(t *testing.T) {
+	data := exportTable(t, "pdf")
+	assert.Contains(t, string(data), "/Title (Vehicles - 06/05/2024 08:30)")
+	assert.Contains(t, string(data), "/Count 1")
+
+	pages := pdfPages(t, data)
+	require.Len(t, pages, 1)
+	page := pages[0]
+	assert.Contains(t, page, "/F2 12 Tf 36 547.28 Td (Vehicles - 06/05/2024 08:30) Tj")
+	assert.Contains(t, page, "(Vehicles) Tj", "the sheet name heads the table")
+	assert.Contains(t, page, "(Fuel Cost) Tj")
+	assert.Contains(t, page, "(Rp 1.500.000) Tj")
+	assert.Contains(t, page, "(1.234,50) Tj")
+	assert.Contains(t, page, "(06/05/2024 08:30) Tj")
+	assert.Contains(t, page, "(Page 1) Tj")
+}
+
+func TestPDFExporter_Pagination(t *testing.T) {
+	var out bytes.Buffer
+	exporter, _ := NewExporter("pdf", &out, "GPS Tracks")
+	require.NoError(t, exporter.BeginSheet("GPS Tracks", []Column{{Header: "Vehicle"}, {Header: "Note (internal)"}}))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, exporter.WriteRow(nil, []interface{}{"B " + strconv.Itoa(i), strings.Repeat("very long note ", 40)}))
+	}
+	require.NoError(t, exporter.BeginSheet("Summary", []Column{{Header: "Field"}}))
+	require.NoError(t, exporter.Close())
+
+	pages := pdfPages(t, out.Bytes())
+	require.Len(t, pages, 5, "33 tracks a page, and the next sheet on a page of its own")
+	assert.Contains(t, pages[1], "(Vehicle) Tj", "headers repeat on every page")
+	assert.Contains(t, pages[1], "(Page 2) Tj")
+	assert.Contains(t, pages[0], `(Note \(internal\)) Tj`, "parentheses are escaped")
+	assert.Contains(t, pages[0], "note very...) Tj", "long text is cut with an ellipsis")
+	assert.Contains(t, pages[3], "(B 99) Tj")
+	assert.Contains(t, pages[4], "(Summary) Tj")
+}
@@ -0,0 +1,177 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/pdf"
+)
+
+// Page layout in points, on landscape A4
+const (
+	pdfMargin      = 36.0
+	pdfFontSize    = 8.0
+	pdfRowHeight   = 14.0
+	pdfCellPadding = 3.0
+)
+
+// pdfHeaderColor fills the column header, as in the XLSX header style
+var pdfHeaderColor = [3]float64{0x1F / 255.0, 0x4E / 255.0, 0x78 / 255.0}
+
+// pdfExporter prints tables on landscape A4 pages using the standard
+// Helvetica fonts. Each sheet starts a new page headed by the title and the
+// sheet name, and the column header is repeated on every page. Finished
+// pages are kept compressed until the document is written on Close.
+type pdfExporter struct {
+	w     io.Writer
+	doc   *pdf.Document
+	title string
+
+	sheet   string
+	columns []Column
+	widths  []float64
+	y       float64
+	rows    int
+	open    bool
+}
+
+func newPDFExporter(w io.Writer, title string) Exporter {
+	doc := pdf.NewLandscape()
+	doc.SetTitle(title)
+	return &pdfExporter{w: w, doc: doc, title: title}
+}
+
+func (pe *pdfExporter) BeginSheet(name string, columns []Column) error {
+	pe.finishPage()
+	pe.sheet, pe.columns = name, columns
+	pe.widths = pdfColumnWidths(pe.tableWidth(), columns)
+	pe.startPage()
+	return nil
+}
+
+func (pe *pdfExporter) WriteRow(_ interface{}, values []interface{}) error {
+	if !pe.open {
+		return fmt.Errorf("row written before a sheet was started")
+	}
+	if pe.y+pdfRowHeight > pe.doc.Height()-pdfMargin {
+		pe.finishPage()
+		pe.startPage()
+	}
+
+	pe.rows++
+	if pe.rows%2 == 0 {
+		pe.doc.FillRect(pdfMargin, pe.y, pe.tableWidth(), pdfRowHeight, 0.95)
+	}
+	pe.doc.SetFont(pdf.Helvetica, pdfFontSize)
+	x := pdfMargin
+	for i, width := range pe.widths {
+		if i < len(values) {
+			value, kind, decimals := cellAt(pe.columns, i, values[i])
+			numeric := kind != ColumnText && kind != ColumnTime
+			pe.cell(x, width, displayText(value, kind, decimals), numeric)
+		}
+		x += width
+	}
+	pe.y += pdfRowHeight
+	return nil
+}
+
+func (pe *pdfExporter) Close() error {
+	if !pe.open && pe.doc.PageCount() == 0 {
+		pe.startPage()
+	}
+	pe.finishPage()
+	if _, err := pe.doc.WriteTo(pe.w); err != nil {
+		return fmt.Errorf("failed to write PDF: %w", err)
+	}
+	return nil
+}
+
+// startPage begins a page with the title, the sheet name and the column
+// header
+func (pe *pdfExporter) startPage() {
+	pe.doc.AddPage()
+	pe.open = true
+	pe.rows = 0
+
+	pe.doc.SetFont(pdf.HelveticaBold, 12)
+	pe.doc.Text(pdfMargin, pdfMargin+12, pe.title)
+	if pe.sheet != "" && pe.sheet != pe.title {
+		pe.doc.SetFont(pdf.Helvetica, 10)
+		pe.doc.Text(pdfMargin, pdfMargin+28, pe.sheet)
+	}
+	pe.y = pdfMargin + 36
+	if len(pe.columns) == 0 {
+		return
+	}
+
+	pe.doc.FillRectRGB(pdfMargin, pe.y, pe.tableWidth(), pdfRowHeight, pdfHeaderColor[0], pdfHeaderColor[1], pdfHeaderColor[2])
+	pe.doc.SetFont(pdf.HelveticaBold, pdfFontSize)
+	pe.doc.SetFillGray(1)
+	x := pdfMargin
+	for i, column := range pe.columns {
+		pe.cell(x, pe.widths[i], column.Header, false)
+		x += pe.widths[i]
+	}
+	pe.doc.SetFillGray(0)
+	pe.y += pdfRowHeight
+}
+
+// finishPage numbers the current page in its footer
+func (pe *pdfExporter) finishPage() {
+	if !pe.open {
+		return
+	}
+	pe.doc.SetFont(pdf.Helvetica, pdfFontSize)
+	pe.doc.TextRight(pe.doc.Width()-pdfMargin, pe.doc.Height()-pdfMargin/2, fmt.Sprintf("Page %d", pe.doc.PageCount()))
+	pe.open = false
+}
+
+// cell writes the text of a table cell in the current font, shortened to
+// fit the cell
+func (pe *pdfExporter) cell(x, width float64, text string, alignRight bool) {
+	text = fitText(pe.doc, text, width-2*pdfCellPadding)
+	baseline := pe.y + pdfRowHeight - 4
+	if alignRight {
+		pe.doc.TextRight(x+width-pdfCellPadding, baseline, text)
+	} else {
+		pe.doc.Text(x+pdfCellPadding, baseline, text)
+	}
+}
+
+// tableWidth is the width of a table spanning the page between margins
+func (pe *pdfExporter) tableWidth() float64 {
+	return pe.doc.Width() - 2*pdfMargin
+}
+
+// pdfColumnWidths shares the table width between columns in proportion to
+// their widths in characters
+func pdfColumnWidths(tableWidth float64, columns []Column) []float64 {
+	total := 0.0
+	for _, column := range columns {
+		total += columnWidth(column)
+	}
+	widths := make([]float64, len(columns))
+	for i, column := range columns {
+		widths[i] = tableWidth * columnWidth(column) / total
+	}
+	return widths
+}
+
+// fitText shortens text with an ellipsis until it fits a width in the
+// current font of a document
+func fitText(doc *pdf.Document, text string, width float64) string {
+	if doc.StringWidth(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimRight(string(runes), " ") + "..."
+		if doc.StringWidth(candidate) <= width {
+			return candidate
+		}
+	}
+	return ""
+}
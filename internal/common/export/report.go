@@ -0,0 +1,311 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportSheet is a table of a report
+type ReportSheet struct {
+	Name    string
+	Columns []Column
+	Rows    [][]interface{}
+}
+
+// monetaryWords mark the fields of a report holding Rupiah amounts
+var monetaryWords = []string{"cost", "price", "amount", "revenue", "tax", "fee", "spend", "idr", "rupiah"}
+
+// acronyms are written in capitals in headers
+var acronyms = map[string]string{
+	"id": "ID", "gps": "GPS", "nik": "NIK", "sim": "SIM", "stnk": "STNK",
+	"bpkb": "BPKB", "idr": "IDR", "kpi": "KPI", "ppn": "PPN", "npwp": "NPWP",
+}
+
+// WriteReport renders a report in a format and returns the number of rows
+// written. Record formats write the report as a single record; tabular
+// formats write the sheets of ReportSheets.
+func WriteReport(format string, w io.Writer, title string, report interface{}) (int64, error) {
+	out, err := NewExporter(format, w, title)
+	if err != nil {
+		return 0, err
+	}
+
+	if format == "json" || format == "jsonl" {
+		if err := out.BeginSheet(title, nil); err != nil {
+			return 0, err
+		}
+		if err := out.WriteRow(report, nil); err != nil {
+			return 0, err
+		}
+		return 1, out.Close()
+	}
+
+	sheets, err := ReportSheets(report)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	for _, sheet := range sheets {
+		if err := out.BeginSheet(sheet.Name, sheet.Columns); err != nil {
+			return count, err
+		}
+		for _, row := range sheet.Rows {
+			if err := out.WriteRow(nil, row); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, out.Close()
+}
+
+// ReportSheets lays a report out as tables: a summary listing its fields,
+// followed by a sheet for every list of records in it. Fields named like
+// money are Rupiah amounts and RFC 3339 strings are times.
+func ReportSheets(report interface{}) ([]ReportSheet, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	summary := ReportSheet{
+		Name:    "Summary",
+		Columns: []Column{{Header: "Field", Width: 40}, {Header: "Value", Width: 24}},
+	}
+	var tables []ReportSheet
+
+	var walk func(path []string, value interface{})
+	walk = func(path []string, value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, key := range sortedKeys(v) {
+				walk(append(path, key), v[key])
+			}
+		case []interface{}:
+			if records, ok := recordList(v); ok {
+				tables = append(tables, recordTable(sheetName(path), records))
+				return
+			}
+			for i, item := range v {
+				walk(append(path, strconv.Itoa(i+1)), item)
+			}
+		default:
+			value, kind := reportValue(lastKey(path), v)
+			summary.Rows = append(summary.Rows, []interface{}{fieldLabel(path), Cell{Value: value, Kind: kind, Decimals: reportDecimals(kind)}})
+		}
+	}
+	walk(nil, decoded)
+
+	if len(summary.Rows) == 0 && len(tables) > 0 {
+		return tables, nil
+	}
+	return append([]ReportSheet{summary}, tables...), nil
+}
+
+// recordList returns the records of a non-empty list holding only records
+func recordList(items []interface{}) ([]map[string]interface{}, bool) {
+	if len(items) == 0 {
+		return nil, false
+	}
+	records := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		record, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		records[i] = record
+	}
+	return records, true
+}
+
+// recordTable tabulates records, with a column for every field of any record
+func recordTable(name string, records []map[string]interface{}) ReportSheet {
+	flattened := make([]map[string]interface{}, len(records))
+	fields := map[string]bool{}
+	for i, record := range records {
+		flattened[i] = map[string]interface{}{}
+		flattenRecord("", record, flattened[i])
+		for field := range flattened[i] {
+			fields[field] = true
+		}
+	}
+
+	keys := sortedKeys(fields)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return identifying(keys[i]) && !identifying(keys[j])
+	})
+
+	sheet := ReportSheet{Name: name, Columns: make([]Column, len(keys))}
+	kinds := make([]ColumnKind, len(keys))
+	for c, key := range keys {
+		kinds[c] = columnKind(key, flattened)
+		sheet.Columns[c] = Column{Header: headerLabel(key), Kind: kinds[c], Decimals: reportDecimals(kinds[c])}
+	}
+	for _, record := range flattened {
+		row := make([]interface{}, len(keys))
+		for c, key := range keys {
+			row[c], _ = reportValue(key, record[key])
+		}
+		sheet.Rows = append(sheet.Rows, row)
+	}
+	return sheet
+}
+
+// flattenRecord collects the fields of a record under dotted keys
+func flattenRecord(prefix string, value interface{}, fields map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			flattenRecord(joinKey(prefix, key), field, fields)
+		}
+	case []interface{}:
+		for i, item := range v {
+			flattenRecord(joinKey(prefix, strconv.Itoa(i+1)), item, fields)
+		}
+	default:
+		fields[prefix] = v
+	}
+}
+
+// columnKind picks the kind of a table column from the values of its field
+func columnKind(key string, records []map[string]interface{}) ColumnKind {
+	kind, seen := ColumnText, false
+	for _, record := range records {
+		if record[key] == nil {
+			continue
+		}
+		_, valueKind := reportValue(key, record[key])
+		switch {
+		case !seen:
+			kind, seen = valueKind, true
+		case kind == valueKind:
+		case (kind == ColumnInteger || kind == ColumnNumber) && (valueKind == ColumnInteger || valueKind == ColumnNumber):
+			kind = ColumnNumber
+		default:
+			return ColumnText
+		}
+	}
+	return kind
+}
+
+// reportValue converts a decoded JSON value of a field to a row value and
+// the kind it is rendered as
+func reportValue(key string, value interface{}) (interface{}, ColumnKind) {
+	switch v := value.(type) {
+	case json.Number:
+		if integer, err := v.Int64(); err == nil {
+			if monetary(key) {
+				return integer, ColumnRupiah
+			}
+			return integer, ColumnInteger
+		}
+		number, _ := v.Float64()
+		if monetary(key) {
+			return number, ColumnRupiah
+		}
+		return number, ColumnNumber
+	case string:
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, ColumnTime
+		}
+		return v, ColumnText
+	default:
+		return v, ColumnText
+	}
+}
+
+// reportDecimals returns the fraction digits printed for report values of a
+// kind; Rupiah amounts are printed whole
+func reportDecimals(kind ColumnKind) int {
+	if kind == ColumnNumber {
+		return 2
+	}
+	return 0
+}
+
+// monetary reports whether a field holds Rupiah amounts
+func monetary(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range monetaryWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// identifying reports whether a field names its record, so it leads tables
+func identifying(key string) bool {
+	key = lastSegment(key)
+	return key == "id" || key == "name" || strings.HasSuffix(key, "_id") || strings.HasSuffix(key, "_name")
+}
+
+// fieldLabel turns the path of a report field into a readable label
+func fieldLabel(path []string) string {
+	labels := make([]string, len(path))
+	for i, key := range path {
+		labels[i] = headerLabel(key)
+	}
+	return strings.Join(labels, " / ")
+}
+
+func sheetName(path []string) string {
+	if len(path) == 0 {
+		return "Records"
+	}
+	return fieldLabel(path)
+}
+
+// headerLabel turns a field key such as vehicle_id into Vehicle ID
+func headerLabel(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool { return r == '_' || r == '.' || r == ' ' })
+	for i, word := range words {
+		if acronym, ok := acronyms[strings.ToLower(word)]; ok {
+			words[i] = acronym
+		} else {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func lastKey(path []string) string {
+	if len(path) == 0 {
+		return ""
+	}
+	return path[len(path)-1]
+}
+
+func lastSegment(key string) string {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testFuelReport struct {
+	CompanyID     string    `json:"company_id"`
+	TotalFuelCost float64   `json:"total_fuel_cost"`
+	TotalLiters   float64   `json:"total_liters"`
+	Vehicles      int       `json:"vehicles"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	Alerts        []string  `json:"alerts"`
+	ByVehicle     []struct {
+		VehicleID string  `json:"vehicle_id"`
+		Liters    float64 `json:"liters"`
+		Cost      int     `json:"cost"`
+		Driver    struct {
+			Name string `json:"name"`
+		} `json:"driver"`
+	} `json:"by_vehicle"`
+}
+
+func fuelReport() testFuelReport {
+	report := testFuelReport{
+		CompanyID:     "c1",
+		TotalFuelCost: 2750000.5,
+		TotalLiters:   180.25,
+		Vehicles:      2,
+		GeneratedAt:   time.Date(2024, 5, 6, 8, 30, 0, 0, time.UTC),
+		Alerts:        []string{"theft suspected"},
+	}
+	report.ByVehicle = make([]struct {
+		VehicleID string  `json:"vehicle_id"`
+		Liters    float64 `json:"liters"`
+		Cost      int     `json:"cost"`
+		Driver    struct {
+			Name string `json:"name"`
+		} `json:"driver"`
+	}, 2)
+	report.ByVehicle[0].VehicleID, report.ByVehicle[0].Liters, report.ByVehicle[0].Cost = "v1", 100, 1500000
+	report.ByVehicle[0].Driver.Name = "Budi"
+	report.ByVehicle[1].VehicleID, report.ByVehicle[1].Liters, report.ByVehicle[1].Cost = "v2", 80.25, 1250000
+	return report
+}
+
+func TestReportSheets(t *testing.T) {
+	sheets, err := ReportSheets(fuelReport())
+	require.NoError(t, err)
+	require.Len(t, sheets, 2)
+
+	summary := sheets[0]
+	assert.Equal(t, "Summary", summary.Name)
+	assert.Equal(t, [][]interface{}{
+		{"Alerts / 1", Cell{Value: "theft suspected", Kind: ColumnText}},
+		{"Company ID", Cell{Value: "c1", Kind: ColumnText}},
+		{"Generated At", Cell{Value: time.Date(2024, 5, 6, 8, 30, 0, 0, time.UTC), Kind: ColumnTime}},
+		{"Total Fuel Cost", Cell{Value: 2750000.5, Kind: ColumnRupiah}},
+		{"Total Liters", Cell{Value: 180.25, Kind: ColumnNumber, Decimals: 2}},
+		{"Vehicles", Cell{Value: int64(2), Kind: ColumnInteger}},
+	}, summary.Rows)
+
+	table := sheets[1]
+	assert.Equal(t, "By Vehicle", table.Name)
+	assert.Equal(t, []Column{
+		{Header: "Driver Name", Kind: ColumnText},
+		{Header: "Vehicle ID", Kind: ColumnText},
+		{Header: "Cost", Kind: ColumnRupiah},
+		{Header: "Liters", Kind: ColumnNumber, Decimals: 2},
+	}, table.Columns, "identifying fields lead, amounts are Rupiah and mixed integers and decimals are numbers")
+	assert.Equal(t, [][]interface{}{
+		{"Budi", "v1", int64(1500000), int64(100)},
+		{"", "v2", int64(1250000), 80.25},
+	}, table.Rows)
+}
+
+func TestWriteReport(t *testing.T) {
+	var out bytes.Buffer
+	count, err := WriteReport("json", &out, "Fuel Report", fuelReport())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	var records []testFuelReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &records))
+	assert.Equal(t, []testFuelReport{fuelReport()}, records, "record formats keep the report as it is")
+
+	out.Reset()
+	count, err = WriteReport("csv", &out, "Fuel Report", fuelReport())
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), count)
+	assert.Equal(t, "Field,Value\n"+
+		"Alerts / 1,theft suspected\n"+
+		"Company ID,c1\n"+
+		"Generated At,2024-05-06 08:30:00\n"+
+		"Total Fuel Cost,2750000.5\n"+
+		"Total Liters,180.25\n"+
+		"Vehicles,2\n"+
+		"\n"+
+		"By Vehicle\n"+
+		"Driver Name,Vehicle ID,Cost,Liters\n"+
+		"Budi,v1,1500000,100.00\n"+
+		",v2,1250000,80.25\n", out.String())
+
+	_, err = WriteReport("xml", &out, "Fuel Report", fuelReport())
+	assert.Error(t, err)
+}
+
+func TestHeaderLabel(t *testing.T) {
+	assert.Equal(t, "Vehicle ID", headerLabel("vehicle_id"))
+	assert.Equal(t, "GPS Accuracy", headerLabel("gps_accuracy"))
+	assert.Equal(t, "Driver Name", headerLabel("driver.name"))
+}
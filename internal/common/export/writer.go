@@ -0,0 +1,294 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// exportTypes are the data that can be exported, with their display names
+var exportTypes = map[string]string{
+	"vehicles":   "Vehicles",
+	"drivers":    "Drivers",
+	"trips":      "Trips",
+	"gps_tracks": "GPS Tracks",
+	"reports":    "Report",
+}
+
+// IsValidExportType reports whether data of a type can be exported
+func IsValidExportType(exportType string) bool {
+	_, ok := exportTypes[exportType]
+	return ok
+}
+
+// writeRecords writes the records of an export and returns how many it wrote
+func (es *ExportService) writeRecords(ctx context.Context, dataExport *models.DataExport, w io.Writer) (int64, error) {
+	filters := map[string]interface{}(dataExport.Filters)
+	if dataExport.ExportType == "reports" {
+		count, err := es.writeReport(ctx, dataExport.CompanyID, filters, dataExport.Format, w)
+		if err != nil {
+			return count, fmt.Errorf("failed to export report: %w", err)
+		}
+		return count, nil
+	}
+
+	name, ok := exportTypes[dataExport.ExportType]
+	if !ok {
+		return 0, fmt.Errorf("unsupported export type: %s", dataExport.ExportType)
+	}
+	out, err := NewExporter(dataExport.Format, w, exportTitle(name))
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	switch dataExport.ExportType {
+	case "vehicles":
+		count, err = streamRecords(ctx, es.vehiclesQuery(dataExport.CompanyID, filters), out, name, vehicleColumns, vehicleValues)
+	case "drivers":
+		count, err = streamRecords(ctx, es.driversQuery(dataExport.CompanyID, filters), out, name, driverColumns, driverValues)
+	case "trips":
+		count, err = streamRecords(ctx, es.tripsQuery(dataExport.CompanyID, filters), out, name, tripColumns, tripValues)
+	case "gps_tracks":
+		count, err = streamRecords(ctx, es.gpsTracksQuery(dataExport.CompanyID, filters), out, name, gpsTrackColumns, gpsTrackValues)
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		return count, fmt.Errorf("failed to export %s: %w", dataExport.ExportType, err)
+	}
+	return count, nil
+}
+
+// streamRecords writes the rows of a query into a sheet one at a time, so
+// exports of any size run in constant memory
+func streamRecords[T any](ctx context.Context, query *gorm.DB, out Exporter, sheet string, columns []Column, values func(*T) []interface{}) (int64, error) {
+	if err := out.BeginSheet(sheet, columns); err != nil {
+		return 0, err
+	}
+
+	rows, err := query.WithContext(ctx).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	for rows.Next() {
+		var record T
+		if err := query.ScanRows(rows, &record); err != nil {
+			return count, err
+		}
+		if err := out.WriteRow(&record, values(&record)); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// writeReport writes an analytics report, laid out as sheets in tabular
+// formats
+func (es *ExportService) writeReport(ctx context.Context, companyID string, filters map[string]interface{}, format string, w io.Writer) (int64, error) {
+	if es.reports == nil {
+		return 0, fmt.Errorf("report exports are not available")
+	}
+	reportType, _ := filters["report_type"].(string)
+	if reportType == "" {
+		reportType = "fleet"
+	}
+
+	report, err := es.reports(ctx, companyID, reportType)
+	if err != nil {
+		return 0, err
+	}
+	return WriteReport(format, w, exportTitle(headerLabel(reportType)+" Report"), report)
+}
+
+// exportTitle heads printed exports with what they hold and when they were
+// generated
+func exportTitle(name string) string {
+	return name + " - " + time.Now().Format("02/01/2006 15:04")
+}
+
+// Queries and columns of the export types
+
+func (es *ExportService) vehiclesQuery(companyID string, filters map[string]interface{}) *gorm.DB {
+	query := es.db.Model(&models.Vehicle{}).Where("company_id = ?", companyID)
+	if status, ok := filters["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if make, ok := filters["make"].(string); ok && make != "" {
+		query = query.Where("make = ?", make)
+	}
+	if year, ok := filters["year"].(float64); ok && year > 0 {
+		query = query.Where("year = ?", int(year))
+	}
+	return query.Order("created_at")
+}
+
+var vehicleColumns = []Column{
+	{Header: "ID", Width: 36},
+	{Header: "License Plate", Width: 14},
+	{Header: "Make"},
+	{Header: "Model"},
+	{Header: "Year", Kind: ColumnInteger, Width: 6},
+	{Header: "Color", Width: 10},
+	{Header: "Status", Width: 10},
+	{Header: "Company ID", Width: 36},
+	{Header: "Created At", Kind: ColumnTime},
+}
+
+func vehicleValues(vehicle *models.Vehicle) []interface{} {
+	return []interface{}{
+		vehicle.ID,
+		vehicle.LicensePlate,
+		vehicle.Make,
+		vehicle.Model,
+		vehicle.Year,
+		vehicle.Color,
+		vehicle.Status,
+		vehicle.CompanyID,
+		vehicle.CreatedAt,
+	}
+}
+
+func (es *ExportService) driversQuery(companyID string, filters map[string]interface{}) *gorm.DB {
+	query := es.db.Model(&models.Driver{}).Where("company_id = ?", companyID)
+	if status, ok := filters["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if gender, ok := filters["gender"].(string); ok && gender != "" {
+		query = query.Where("gender = ?", gender)
+	}
+	return query.Order("created_at")
+}
+
+var driverColumns = []Column{
+	{Header: "ID", Width: 36},
+	{Header: "First Name"},
+	{Header: "Last Name"},
+	{Header: "Email", Width: 28},
+	{Header: "Phone", Width: 15},
+	{Header: "NIK", Width: 17},
+	{Header: "Status", Width: 10},
+	{Header: "Company ID", Width: 36},
+	{Header: "Created At", Kind: ColumnTime},
+}
+
+func driverValues(driver *models.Driver) []interface{} {
+	return []interface{}{
+		driver.ID,
+		driver.FirstName,
+		driver.LastName,
+		driver.Email,
+		driver.Phone,
+		driver.NIK,
+		driver.Status,
+		driver.CompanyID,
+		driver.CreatedAt,
+	}
+}
+
+func (es *ExportService) tripsQuery(companyID string, filters map[string]interface{}) *gorm.DB {
+	query := es.db.Model(&models.Trip{}).Where("company_id = ?", companyID)
+	if startDate, ok := filters["start_date"].(string); ok && startDate != "" {
+		query = query.Where("start_time >= ?", startDate)
+	}
+	if endDate, ok := filters["end_date"].(string); ok && endDate != "" {
+		query = query.Where("start_time <= ?", endDate)
+	}
+	if status, ok := filters["status"].(string); ok && status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if vehicleID, ok := filters["vehicle_id"].(string); ok && vehicleID != "" {
+		query = query.Where("vehicle_id = ?", vehicleID)
+	}
+	if driverID, ok := filters["driver_id"].(string); ok && driverID != "" {
+		query = query.Where("driver_id = ?", driverID)
+	}
+	return query.Order("start_time")
+}
+
+var tripColumns = []Column{
+	{Header: "ID", Width: 36},
+	{Header: "Vehicle ID", Width: 36},
+	{Header: "Driver ID", Width: 36},
+	{Header: "Start Time", Kind: ColumnTime},
+	{Header: "End Time", Kind: ColumnTime},
+	{Header: "Status", Width: 10},
+	{Header: "Total Distance", Kind: ColumnNumber, Decimals: 2},
+	{Header: "Total Duration", Kind: ColumnInteger},
+	{Header: "Company ID", Width: 36},
+	{Header: "Created At", Kind: ColumnTime},
+}
+
+func tripValues(trip *models.Trip) []interface{} {
+	return []interface{}{
+		trip.ID,
+		trip.VehicleID,
+		trip.DriverID,
+		trip.StartTime,
+		trip.EndTime,
+		trip.Status,
+		trip.TotalDistance,
+		trip.TotalDuration,
+		trip.CompanyID,
+		trip.CreatedAt,
+	}
+}
+
+// gpsTracksQuery selects the fixes of the company's vehicles, oldest first.
+// There is no default limit: the rows are streamed.
+func (es *ExportService) gpsTracksQuery(companyID string, filters map[string]interface{}) *gorm.DB {
+	query := es.db.Model(&models.GPSTrack{}).
+		Select("gps_tracks.*").
+		Joins("JOIN vehicles ON vehicles.id = gps_tracks.vehicle_id").
+		Where("vehicles.company_id = ?", companyID)
+	if startDate, ok := filters["start_date"].(string); ok && startDate != "" {
+		query = query.Where("gps_tracks.timestamp >= ?", startDate)
+	}
+	if endDate, ok := filters["end_date"].(string); ok && endDate != "" {
+		query = query.Where("gps_tracks.timestamp <= ?", endDate)
+	}
+	if vehicleID, ok := filters["vehicle_id"].(string); ok && vehicleID != "" {
+		query = query.Where("gps_tracks.vehicle_id = ?", vehicleID)
+	}
+	if driverID, ok := filters["driver_id"].(string); ok && driverID != "" {
+		query = query.Where("gps_tracks.driver_id = ?", driverID)
+	}
+	if limit, ok := filters["limit"].(float64); ok && limit > 0 {
+		query = query.Limit(int(limit))
+	}
+	return query.Order("gps_tracks.timestamp")
+}
+
+var gpsTrackColumns = []Column{
+	{Header: "ID", Width: 36},
+	{Header: "Vehicle ID", Width: 36},
+	{Header: "Driver ID", Width: 36},
+	{Header: "Latitude", Kind: ColumnNumber, Decimals: 6},
+	{Header: "Longitude", Kind: ColumnNumber, Decimals: 6},
+	{Header: "Speed", Kind: ColumnNumber, Decimals: 2},
+	{Header: "Heading", Kind: ColumnNumber, Decimals: 2},
+	{Header: "Timestamp", Kind: ColumnTime},
+}
+
+func gpsTrackValues(track *models.GPSTrack) []interface{} {
+	return []interface{}{
+		track.ID,
+		track.VehicleID,
+		track.DriverID,
+		track.Latitude,
+		track.Longitude,
+		track.Speed,
+		track.Heading,
+		track.Timestamp,
+	}
+}
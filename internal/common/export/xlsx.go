@@ -0,0 +1,353 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// xlsxMaxRows is the number of rows of an Excel worksheet; longer tables
+	// continue on further sheets
+	xlsxMaxRows = 1048576
+
+	// xlsxMaxSheetName is the longest sheet name Excel accepts
+	xlsxMaxSheetName = 31
+)
+
+// Cell styles, indexes into the cellXfs of the stylesheet
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleInteger
+	xlsxStyleNumber
+	xlsxStyleRupiah
+	xlsxStyleTime
+	xlsxStyleText
+)
+
+// xlsxExporter writes an Office Open XML workbook. Rows are streamed into
+// the zip entry of their worksheet as inline strings, so workbooks of any
+// size are written in constant memory. Each sheet has a bold, shaded header
+// row frozen above the data.
+type xlsxExporter struct {
+	zip     *zip.Writer
+	sheet   *bufio.Writer
+	names   []string
+	name    string
+	columns []Column
+	rows    int
+	parts   int
+
+	// decimalStyles are the styles of ColumnNumber cells by decimals,
+	// appended to the fixed styles
+	decimalStyles map[int]int
+	decimals      []int
+}
+
+func newXLSXExporter(w io.Writer, _ string) Exporter {
+	return &xlsxExporter{zip: zip.NewWriter(w), decimalStyles: map[int]int{}}
+}
+
+func (xe *xlsxExporter) BeginSheet(name string, columns []Column) error {
+	xe.name, xe.columns, xe.parts = name, columns, 1
+	return xe.startSheet(name)
+}
+
+func (xe *xlsxExporter) WriteRow(_ interface{}, values []interface{}) error {
+	if xe.sheet == nil {
+		return fmt.Errorf("row written before a sheet was started")
+	}
+	if xe.rows == xlsxMaxRows {
+		xe.parts++
+		if err := xe.startSheet(fmt.Sprintf("%s (%d)", xe.name, xe.parts)); err != nil {
+			return err
+		}
+	}
+
+	xe.rows++
+	fmt.Fprintf(xe.sheet, `<row r="%d">`, xe.rows)
+	for i, value := range values {
+		value, kind, decimals := cellAt(xe.columns, i, value)
+		xe.writeCell(cellRef(i, xe.rows), value, kind, decimals)
+	}
+	_, err := xe.sheet.WriteString("</row>")
+	return err
+}
+
+func (xe *xlsxExporter) Close() error {
+	if err := xe.endSheet(); err != nil {
+		return err
+	}
+	if len(xe.names) == 0 {
+		if err := xe.startSheet("Sheet1"); err != nil {
+			return err
+		}
+		if err := xe.endSheet(); err != nil {
+			return err
+		}
+	}
+
+	var workbook, workbookRels, contentTypes strings.Builder
+	for i, name := range xe.names {
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(xe.names)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			contentTypes.String() + `</Types>`},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + workbook.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			workbookRels.String() + `</Relationships>`},
+		{"xl/styles.xml", xmlHeader + xe.styles()},
+	}
+	for _, part := range parts {
+		entry, err := xe.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, part.content); err != nil {
+			return err
+		}
+	}
+	return xe.zip.Close()
+}
+
+// startSheet finishes the current worksheet and starts the next one with
+// the header row
+func (xe *xlsxExporter) startSheet(name string) error {
+	if err := xe.endSheet(); err != nil {
+		return err
+	}
+
+	name = xe.uniqueSheetName(name)
+	xe.names = append(xe.names, name)
+	entry, err := xe.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(xe.names)))
+	if err != nil {
+		return err
+	}
+	xe.sheet = bufio.NewWriter(entry)
+	xe.rows = 0
+
+	xe.sheet.WriteString(xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(xe.columns) > 0 {
+		xe.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+			`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>` +
+			`</sheetView></sheetViews><cols>`)
+		for i, column := range xe.columns {
+			fmt.Fprintf(xe.sheet, `<col min="%d" max="%d" width="%.1f" customWidth="1"/>`, i+1, i+1, columnWidth(column)+2)
+		}
+		xe.sheet.WriteString(`</cols>`)
+	}
+	xe.sheet.WriteString(`<sheetData>`)
+
+	if len(xe.columns) > 0 {
+		xe.rows++
+		xe.sheet.WriteString(`<row r="1">`)
+		for i, column := range xe.columns {
+			fmt.Fprintf(xe.sheet, `<c r="%s" t="inlineStr" s="%d"><is><t>%s</t></is></c>`, cellRef(i, 1), xlsxStyleHeader, xmlEscape(column.Header))
+		}
+		xe.sheet.WriteString(`</row>`)
+	}
+	return nil
+}
+
+// endSheet closes the open worksheet, if any
+func (xe *xlsxExporter) endSheet() error {
+	if xe.sheet == nil {
+		return nil
+	}
+	xe.sheet.WriteString(`</sheetData></worksheet>`)
+	err := xe.sheet.Flush()
+	xe.sheet = nil
+	return err
+}
+
+// writeCell writes a cell styled by its kind
+func (xe *xlsxExporter) writeCell(ref string, value interface{}, kind ColumnKind, decimals int) {
+	switch v := value.(type) {
+	case nil:
+		return
+	case int64:
+		fmt.Fprintf(xe.sheet, `<c r="%s" s="%d"><v>%d</v></c>`, ref, xe.numberStyle(kind, decimals), v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			fmt.Fprintf(xe.sheet, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+			return
+		}
+		fmt.Fprintf(xe.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xe.numberStyle(kind, decimals), strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		flag := 0
+		if v {
+			flag = 1
+		}
+		fmt.Fprintf(xe.sheet, `<c r="%s" t="b"><v>%d</v></c>`, ref, flag)
+	case time.Time:
+		fmt.Fprintf(xe.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, xlsxStyleTime, strconv.FormatFloat(excelSerial(v), 'f', 6, 64))
+	default:
+		fmt.Fprintf(xe.sheet, `<c r="%s" t="inlineStr" s="%d"><is><t xml:space="preserve">%s</t></is></c>`, ref, xlsxStyleText, xmlEscape(fmt.Sprint(v)))
+	}
+}
+
+// uniqueSheetName makes a name valid and distinct from earlier sheet names
+func (xe *xlsxExporter) uniqueSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		name = "Sheet"
+	}
+	base := strings.TrimSpace(truncateRunes(name, xlsxMaxSheetName))
+
+	candidate := base
+	for n := 2; xe.hasSheet(candidate); n++ {
+		suffix := fmt.Sprintf(" %d", n)
+		candidate = strings.TrimSpace(truncateRunes(base, xlsxMaxSheetName-len(suffix))) + suffix
+	}
+	return candidate
+}
+
+func (xe *xlsxExporter) hasSheet(name string) bool {
+	for _, existing := range xe.names {
+		if strings.EqualFold(existing, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// numberStyle returns the style of a numeric cell of a kind, adding a style
+// for numbers of unusual precision such as coordinates
+func (xe *xlsxExporter) numberStyle(kind ColumnKind, decimals int) int {
+	switch kind {
+	case ColumnInteger:
+		return xlsxStyleInteger
+	case ColumnNumber:
+		switch decimals {
+		case 0:
+			return xlsxStyleInteger
+		case 2:
+			return xlsxStyleNumber
+		}
+		style, ok := xe.decimalStyles[decimals]
+		if !ok {
+			style = xlsxStyleText + 1 + len(xe.decimals)
+			xe.decimalStyles[decimals] = style
+			xe.decimals = append(xe.decimals, decimals)
+		}
+		return style
+	case ColumnRupiah:
+		return xlsxStyleRupiah
+	default:
+		return xlsxStyleDefault
+	}
+}
+
+// styles returns the stylesheet: the fixed styles, in the order of the
+// xlsxStyle constants, followed by the number styles added while writing
+func (xe *xlsxExporter) styles() string {
+	var numFmts, cellXfs strings.Builder
+	for i, decimals := range xe.decimals {
+		format := "#,##0"
+		if decimals > 0 {
+			format += "." + strings.Repeat("0", decimals)
+		}
+		fmt.Fprintf(&numFmts, `<numFmt numFmtId="%d" formatCode="%s"/>`, 166+i, format)
+		fmt.Fprintf(&cellXfs, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, 166+i)
+	}
+
+	return `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		fmt.Sprintf(`<numFmts count="%d">`, 2+len(xe.decimals)) +
+		`<numFmt numFmtId="164" formatCode="&quot;Rp&quot;\ #,##0"/>` +
+		`<numFmt numFmtId="165" formatCode="yyyy\-mm\-dd\ hh:mm:ss"/>` +
+		numFmts.String() +
+		`</numFmts>` +
+		`<fonts count="2">` +
+		`<font><sz val="11"/><name val="Calibri"/></font>` +
+		`<font><b/><sz val="11"/><color rgb="FFFFFFFF"/><name val="Calibri"/></font>` +
+		`</fonts>` +
+		`<fills count="3">` +
+		`<fill><patternFill patternType="none"/></fill>` +
+		`<fill><patternFill patternType="gray125"/></fill>` +
+		`<fill><patternFill patternType="solid"><fgColor rgb="FF1F4E78"/><bgColor indexed="64"/></patternFill></fill>` +
+		`</fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		fmt.Sprintf(`<cellXfs count="%d">`, xlsxStyleText+1+len(xe.decimals)) +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="2" borderId="0" xfId="0" applyFont="1" applyFill="1" applyAlignment="1"><alignment horizontal="center" vertical="center"/></xf>` +
+		`<xf numFmtId="3" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="49" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		cellXfs.String() +
+		`</cellXfs>` +
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+		`</styleSheet>`
+}
+
+// excelSerial converts a time to an Excel date serial in its own time zone
+func excelSerial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return wall.Sub(epoch).Hours() / 24
+}
+
+// cellRef returns the A1 reference of a zero-based column and a row
+func cellRef(column, row int) string {
+	var letters []byte
+	for column++; column > 0; column = (column - 1) / 26 {
+		letters = append([]byte{byte('A' + (column-1)%26)}, letters...)
+	}
+	return string(letters) + strconv.Itoa(row)
+}
+
+// xmlEscape escapes text for XML, dropping characters XML cannot carry
+func xmlEscape(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '&':
+			escaped.WriteString("&amp;")
+		case r == '<':
+			escaped.WriteString("&lt;")
+		case r == '>':
+			escaped.WriteString("&gt;")
+		case r == '"':
+			escaped.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != 0xFFFE && r != 0xFFFF):
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
+
+func truncateRunes(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max])
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
@@ -0,0 +1,252 @@
+package fleet
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/mapmatch"
+)
+
+const (
+	// distanceMatrixCacheTTL keeps matrices for a day; they only change
+	// with the road network and speed profiles
+	distanceMatrixCacheTTL = 24 * time.Hour
+
+	// roadSnapRadius is how far in meters a stop may be from the road
+	// network it is routed on
+	roadSnapRadius = 500
+
+	// freeFlowShare is the share of the speed limit driven on empty roads
+	freeFlowShare = 0.85
+)
+
+// DistanceMatrix holds the travel distances and durations between
+// locations, indexed like the locations it was computed for
+type DistanceMatrix struct {
+	Distances [][]float64 `json:"distances"` // km
+	Durations [][]float64 `json:"durations"` // minutes
+	Source    string      `json:"source"`    // provider that computed it
+}
+
+// DistanceMatrixProvider computes travel distances and durations between
+// locations for a departure time
+type DistanceMatrixProvider interface {
+	// Name identifies the provider in results and cache keys
+	Name() string
+	DistanceMatrix(ctx context.Context, locations []Location, departure time.Time) (*DistanceMatrix, error)
+}
+
+// SpeedProfile scales travel speeds by local hour of day, so routes planned
+// for rush hour take longer than at night
+type SpeedProfile struct {
+	Factors  [24]float64    // share of the free-flow speed per hour; 0 counts as 1
+	Location *time.Location // time zone of the hours; nil is UTC
+}
+
+// Factor returns the speed factor at a time
+func (p SpeedProfile) Factor(t time.Time) float64 {
+	if p.Location != nil {
+		t = t.In(p.Location)
+	}
+	if factor := p.Factors[t.Hour()]; factor > 0 {
+		return factor
+	}
+	return 1
+}
+
+// JakartaSpeedProfile returns a speed profile of Jakarta traffic: free
+// flowing at night, slow during the day and crawling in the morning and
+// evening rush hours
+func JakartaSpeedProfile(location *time.Location) SpeedProfile {
+	return SpeedProfile{
+		Factors: [24]float64{
+			1, 1, 1, 1, 1, 0.95, // 00-05
+			0.75, 0.45, 0.4, 0.5, 0.65, 0.65, // 06-11
+			0.6, 0.65, 0.65, 0.55, 0.45, 0.4, // 12-17
+			0.4, 0.5, 0.65, 0.8, 0.9, 0.95, // 18-23
+		},
+		Location: location,
+	}
+}
+
+// HaversineProvider estimates travel along great-circle distances at a
+// fixed speed. It needs no road data and is the fallback of the other
+// providers.
+type HaversineProvider struct {
+	Speed   float64 // km/h
+	Profile SpeedProfile
+}
+
+// NewHaversineProvider creates a provider driving straight lines at 40 km/h
+// around the clock
+func NewHaversineProvider() *HaversineProvider {
+	return &HaversineProvider{Speed: 40}
+}
+
+// Name returns the provider name
+func (hp *HaversineProvider) Name() string {
+	return "haversine"
+}
+
+// DistanceMatrix returns the great-circle distances between locations
+func (hp *HaversineProvider) DistanceMatrix(_ context.Context, locations []Location, departure time.Time) (*DistanceMatrix, error) {
+	matrix := newDistanceMatrix(len(locations), hp.Name())
+	for i := range locations {
+		for j := range locations {
+			if i != j {
+				matrix.Distances[i][j], matrix.Durations[i][j] = hp.estimate(locations[i], locations[j], departure)
+			}
+		}
+	}
+	return matrix, nil
+}
+
+// estimate returns the straight-line distance in km and duration in minutes
+// between two locations
+func (hp *HaversineProvider) estimate(from, to Location, departure time.Time) (float64, float64) {
+	distance := haversineDistance(from.Latitude, from.Longitude, to.Latitude, to.Longitude)
+	return distance, distance / (hp.Speed * hp.Profile.Factor(departure)) * 60
+}
+
+// RoadGraphProvider routes along an offline road network, driving each road
+// at a share of its speed limit scaled by the time of day. Stops off the
+// network, or cut off from each other, fall back to straight lines.
+type RoadGraphProvider struct {
+	graph    *mapmatch.Graph
+	profile  SpeedProfile
+	fallback *HaversineProvider
+}
+
+// NewRoadGraphProvider creates a provider routing on a road network
+func NewRoadGraphProvider(graph *mapmatch.Graph, profile SpeedProfile) *RoadGraphProvider {
+	return &RoadGraphProvider{
+		graph:    graph,
+		profile:  profile,
+		fallback: &HaversineProvider{Speed: 40, Profile: profile},
+	}
+}
+
+// Name returns the provider name
+func (rp *RoadGraphProvider) Name() string {
+	return "road_graph"
+}
+
+// DistanceMatrix returns the fastest road routes between locations
+func (rp *RoadGraphProvider) DistanceMatrix(_ context.Context, locations []Location, departure time.Time) (*DistanceMatrix, error) {
+	positions := make([]mapmatch.Coordinate, len(locations))
+	for i, location := range locations {
+		positions[i] = mapmatch.Coordinate{Latitude: location.Latitude, Longitude: location.Longitude}
+	}
+
+	factor := rp.profile.Factor(departure)
+	travel := rp.graph.TravelMatrix(positions, roadSnapRadius, func(road mapmatch.Road) float64 {
+		return math.Max(float64(road.SpeedLimit), 10) * freeFlowShare * factor
+	})
+
+	matrix := newDistanceMatrix(len(locations), rp.Name())
+	for i := range locations {
+		for j := range locations {
+			if i == j {
+				continue
+			}
+			if travel.Reachable[i][j] {
+				matrix.Distances[i][j] = travel.Distances[i][j] / 1000
+				matrix.Durations[i][j] = travel.Durations[i][j] / 60
+			} else {
+				matrix.Distances[i][j], matrix.Durations[i][j] = rp.fallback.estimate(locations[i], locations[j], departure)
+			}
+		}
+	}
+	return matrix, nil
+}
+
+// CachedDistanceMatrixProvider keeps the matrices of another provider in
+// Redis, per set of locations and hour of departure
+type CachedDistanceMatrixProvider struct {
+	provider DistanceMatrixProvider
+	redis    *redis.Client
+	ttl      time.Duration
+}
+
+// NewCachedDistanceMatrixProvider wraps a provider with a Redis cache; a nil
+// client disables caching
+func NewCachedDistanceMatrixProvider(provider DistanceMatrixProvider, redis *redis.Client, ttl time.Duration) *CachedDistanceMatrixProvider {
+	return &CachedDistanceMatrixProvider{provider: provider, redis: redis, ttl: ttl}
+}
+
+// Name returns the name of the wrapped provider
+func (cp *CachedDistanceMatrixProvider) Name() string {
+	return cp.provider.Name()
+}
+
+// DistanceMatrix returns the cached matrix, computing and caching it on a miss
+func (cp *CachedDistanceMatrixProvider) DistanceMatrix(ctx context.Context, locations []Location, departure time.Time) (*DistanceMatrix, error) {
+	if cp.redis == nil {
+		return cp.provider.DistanceMatrix(ctx, locations, departure)
+	}
+
+	key := distanceMatrixCacheKey(cp.provider.Name(), locations, departure)
+	if data, err := cp.redis.Get(ctx, key).Bytes(); err == nil {
+		var matrix DistanceMatrix
+		if err := json.Unmarshal(data, &matrix); err == nil && len(matrix.Distances) == len(locations) {
+			return &matrix, nil
+		}
+	}
+
+	matrix, err := cp.provider.DistanceMatrix(ctx, locations, departure)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(matrix); err == nil {
+		if err := cp.redis.Set(ctx, key, data, cp.ttl).Err(); err != nil {
+			fmt.Printf("Failed to cache distance matrix: %v\n", err)
+		}
+	}
+	return matrix, nil
+}
+
+// distanceMatrixCacheKey identifies a matrix by provider, hour of departure
+// and locations rounded to about a meter
+func distanceMatrixCacheKey(provider string, locations []Location, departure time.Time) string {
+	hash := sha1.New()
+	for _, location := range locations {
+		fmt.Fprintf(hash, "%.5f,%.5f;", location.Latitude, location.Longitude)
+	}
+	return fmt.Sprintf("distance_matrix:%s:%02d:%x", provider, departure.UTC().Hour(), hash.Sum(nil))
+}
+
+// newDistanceMatrix returns an all-zero matrix for n locations
+func newDistanceMatrix(n int, source string) *DistanceMatrix {
+	matrix := &DistanceMatrix{
+		Distances: make([][]float64, n),
+		Durations: make([][]float64, n),
+		Source:    source,
+	}
+	for i := 0; i < n; i++ {
+		matrix.Distances[i] = make([]float64, n)
+		matrix.Durations[i] = make([]float64, n)
+	}
+	return matrix
+}
+
+// haversineDistance returns the great-circle distance in km between two
+// positions
+func haversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	const R = 6371 // Earth's radius in kilometers
+
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return R * c
+}
@@ -0,0 +1,161 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/mapmatch"
+)
+
+// stubMatrixProvider drives every pair of locations in 60 minutes before
+// 08:00 and in 90 minutes from then on
+type stubMatrixProvider struct {
+	calls int
+	err   error
+}
+
+func (sp *stubMatrixProvider) Name() string { return "stub" }
+
+func (sp *stubMatrixProvider) DistanceMatrix(_ context.Context, locations []Location, departure time.Time) (*DistanceMatrix, error) {
+	sp.calls++
+	if sp.err != nil {
+		return nil, sp.err
+	}
+	minutes := 60.0
+	if departure.Hour() >= 8 {
+		minutes = 90
+	}
+	matrix := newDistanceMatrix(len(locations), sp.Name())
+	for i := range locations {
+		for j := range locations {
+			if i != j {
+				matrix.Distances[i][j] = 10
+				matrix.Durations[i][j] = minutes
+			}
+		}
+	}
+	return matrix, nil
+}
+
+func TestSpeedProfile_Factor(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*60*60)
+	profile := JakartaSpeedProfile(jakarta)
+
+	assert.Equal(t, 1.0, profile.Factor(time.Date(2024, 5, 6, 20, 0, 0, 0, time.UTC)), "03:00 in Jakarta")
+	assert.Equal(t, 0.4, profile.Factor(time.Date(2024, 5, 6, 8, 30, 0, 0, jakarta)))
+	assert.Equal(t, 1.0, SpeedProfile{}.Factor(time.Now()), "an empty profile keeps speeds")
+}
+
+func TestHaversineProvider(t *testing.T) {
+	provider := &HaversineProvider{Speed: 40, Profile: JakartaSpeedProfile(time.UTC)}
+	locations := []Location{
+		{Latitude: -6.2, Longitude: 106.8},
+		{Latitude: -6.2, Longitude: 106.9},
+	}
+
+	night, err := provider.DistanceMatrix(context.Background(), locations, time.Date(2024, 5, 6, 2, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	rush, err := provider.DistanceMatrix(context.Background(), locations, time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	assert.InDelta(t, 11.06, night.Distances[0][1], 0.01)
+	assert.Equal(t, night.Distances[0][1], night.Distances[1][0])
+	assert.Zero(t, night.Distances[0][0])
+	assert.InDelta(t, 11.06/40*60, night.Durations[0][1], 0.1)
+	assert.InDelta(t, night.Durations[0][1]/0.4, rush.Durations[0][1], 0.1)
+}
+
+func TestRoadGraphProvider(t *testing.T) {
+	// A one-way primary road heading east
+	graph, err := mapmatch.ReadGraph(strings.NewReader(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"highway": "primary", "oneway": "yes"},
+		 "geometry": {"type": "LineString", "coordinates": [[106.800, -6.2], [106.810, -6.2], [106.820, -6.2]]}}
+	]}`))
+	require.NoError(t, err)
+
+	provider := NewRoadGraphProvider(graph, SpeedProfile{})
+	locations := []Location{
+		{Latitude: -6.2, Longitude: 106.801},
+		{Latitude: -6.2, Longitude: 106.819},
+		{Latitude: -6.3, Longitude: 106.801}, // 11 km from the road
+	}
+	matrix, err := provider.DistanceMatrix(context.Background(), locations, time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, "road_graph", matrix.Source)
+	assert.InDelta(t, 1.99, matrix.Distances[0][1], 0.01)
+	assert.InDelta(t, 1.99/(80*freeFlowShare)*60, matrix.Durations[0][1], 0.01)
+
+	// Against the one-way road and off the network fall back to straight lines
+	assert.InDelta(t, 1.99, matrix.Distances[1][0], 0.01)
+	assert.InDelta(t, 1.99/40*60, matrix.Durations[1][0], 0.01)
+	assert.InDelta(t, 11.1, matrix.Distances[0][2], 0.1)
+}
+
+func TestDistanceMatrixCacheKey(t *testing.T) {
+	locations := []Location{{Latitude: -6.2, Longitude: 106.8}, {Latitude: -6.21, Longitude: 106.81}}
+	departure := time.Date(2024, 5, 6, 8, 10, 0, 0, time.UTC)
+
+	key := distanceMatrixCacheKey("road_graph", locations, departure)
+	assert.True(t, strings.HasPrefix(key, "distance_matrix:road_graph:08:"))
+	assert.Equal(t, key, distanceMatrixCacheKey("road_graph", locations, departure.Add(40*time.Minute)), "same hour")
+	assert.NotEqual(t, key, distanceMatrixCacheKey("road_graph", locations, departure.Add(time.Hour)))
+	assert.NotEqual(t, key, distanceMatrixCacheKey("road_graph", locations[:1], departure))
+}
+
+func TestCalculateRouteMetrics_TimesLegsByHour(t *testing.T) {
+	provider := &stubMatrixProvider{}
+	ro := &RouteOptimizer{matrices: provider}
+	stops := []RouteStop{
+		{ID: "depot", Latitude: -6.2, Longitude: 106.8},
+		{ID: "a", Latitude: -6.21, Longitude: 106.81, ServiceTime: 15},
+		{ID: "b", Latitude: -6.22, Longitude: 106.82, ServiceTime: 10},
+	}
+	departure := time.Date(2024, 5, 6, 6, 30, 0, 0, time.UTC)
+	costs := ro.newRouteCosts(context.Background(), stops, departure)
+
+	route := &OptimizedRoute{Stops: stops}
+	ro.calculateRouteMetrics(costs, route)
+
+	require.Len(t, route.Legs, 2)
+	assert.Equal(t, departure.Add(60*time.Minute), route.Legs[0].Arrival)
+	// Leaves "a" at 07:45, before the slowdown
+	assert.Equal(t, time.Date(2024, 5, 6, 7, 45, 0, 0, time.UTC), route.Legs[1].Departure)
+	assert.Equal(t, time.Date(2024, 5, 6, 8, 45, 0, 0, time.UTC), route.EstimatedArrival)
+	assert.Equal(t, 60+15+60+10, route.TotalDuration)
+	assert.Equal(t, 20.0, route.TotalDistance)
+	assert.Equal(t, "stub", route.DistanceSource)
+	assert.Equal(t, 2, provider.calls, "one matrix per hour driven in")
+
+	// A later departure runs into the slower hours
+	costs = ro.newRouteCosts(context.Background(), stops, departure.Add(2*time.Hour))
+	ro.calculateRouteMetrics(costs, route)
+	assert.Equal(t, 90+15+90+10, route.TotalDuration)
+}
+
+func TestRouteCosts_FallsBackToStraightLines(t *testing.T) {
+	ro := &RouteOptimizer{matrices: &stubMatrixProvider{err: errors.New("road network unavailable")}}
+	stops := []RouteStop{
+		{ID: "depot", Latitude: -6.2, Longitude: 106.8},
+		{ID: "a", Latitude: -6.2, Longitude: 106.9},
+	}
+	costs := ro.newRouteCosts(context.Background(), stops, time.Now())
+
+	assert.InDelta(t, 11.06, ro.calculateTotalDistance(costs, stops), 0.01)
+	assert.Equal(t, "haversine", costs.matrixAt(time.Now()).Source)
+}
+
+func TestOptimizeRoute_RejectsDuplicateStops(t *testing.T) {
+	ro := &RouteOptimizer{matrices: NewHaversineProvider()}
+	_, err := ro.OptimizeRoute(context.Background(), &RouteRequest{
+		Stops:       []RouteStop{{ID: "a"}, {ID: "a"}},
+		Constraints: RouteConstraints{MaxDistance: 100, MaxDuration: 600, MaxStops: 10},
+	})
+	assert.Error(t, err)
+}
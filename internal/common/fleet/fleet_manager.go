@@ -194,6 +194,11 @@ func NewFleetManager(db *gorm.DB, redis *redis.Client) *FleetManager {
 	}
 }
 
+// SetDistanceMatrixProvider sets how travel between route stops is measured
+func (fm *FleetManager) SetDistanceMatrixProvider(provider DistanceMatrixProvider) {
+	fm.routeOptimizer.SetDistanceMatrixProvider(provider)
+}
+
 // GetFleetOverview retrieves comprehensive fleet overview
 func (fm *FleetManager) GetFleetOverview(ctx context.Context, companyID string) (*FleetOverview, error) {
 	// Check cache first
@@ -14,8 +14,9 @@ import (
 
 // RouteOptimizer provides route optimization capabilities
 type RouteOptimizer struct {
-	db    *gorm.DB
-	redis *redis.Client
+	db       *gorm.DB
+	redis    *redis.Client
+	matrices DistanceMatrixProvider
 }
 
 // RouteRequest represents a route optimization request
@@ -76,11 +77,24 @@ type OptimizedRoute struct {
 	TotalDistance   float64     `json:"total_distance"`   // km
 	TotalDuration   int         `json:"total_duration"`   // minutes
 	TotalFuelCost   float64     `json:"total_fuel_cost"`  // IDR
-	EstimatedArrival time.Time  `json:"estimated_arrival"`
+	Departure       time.Time   `json:"departure"`
+	EstimatedArrival time.Time  `json:"estimated_arrival"` // at the last stop
+	Legs            []RouteLeg  `json:"legs"`
+	DistanceSource  string      `json:"distance_source"`  // provider of the travel distances
 	OptimizationScore float64   `json:"optimization_score"`
 	CreatedAt       time.Time   `json:"created_at"`
 }
 
+// RouteLeg represents the drive between two consecutive stops of a route
+type RouteLeg struct {
+	FromStopID string    `json:"from_stop_id"`
+	ToStopID   string    `json:"to_stop_id"`
+	Distance   float64   `json:"distance"` // km
+	Duration   float64   `json:"duration"` // minutes
+	Departure  time.Time `json:"departure"`
+	Arrival    time.Time `json:"arrival"`
+}
+
 // RouteNode represents a node in the route graph
 type RouteNode struct {
 	Stop      RouteStop
@@ -93,11 +107,18 @@ type RouteNode struct {
 // NewRouteOptimizer creates a new route optimizer
 func NewRouteOptimizer(db *gorm.DB, redis *redis.Client) *RouteOptimizer {
 	return &RouteOptimizer{
-		db:    db,
-		redis: redis,
+		db:       db,
+		redis:    redis,
+		matrices: NewCachedDistanceMatrixProvider(NewHaversineProvider(), redis, distanceMatrixCacheTTL),
 	}
 }
 
+// SetDistanceMatrixProvider sets the provider of the travel distances and
+// durations routes are optimized on. Matrices are cached in Redis.
+func (ro *RouteOptimizer) SetDistanceMatrixProvider(provider DistanceMatrixProvider) {
+	ro.matrices = NewCachedDistanceMatrixProvider(provider, ro.redis, distanceMatrixCacheTTL)
+}
+
 // OptimizeRoute optimizes a route based on the given criteria
 func (ro *RouteOptimizer) OptimizeRoute(ctx context.Context, req *RouteRequest) (*OptimizedRoute, error) {
 	if len(req.Stops) < 2 {
@@ -142,18 +163,34 @@ func (ro *RouteOptimizer) validateConstraints(req *RouteRequest) error {
 	if len(req.Stops) > req.Constraints.MaxStops {
 		return fmt.Errorf("number of stops (%d) exceeds max stops (%d)", len(req.Stops), req.Constraints.MaxStops)
 	}
+	seen := make(map[string]bool, len(req.Stops))
+	for _, stop := range req.Stops {
+		if stop.ID == "" {
+			return fmt.Errorf("every stop needs an id")
+		}
+		if seen[stop.ID] {
+			return fmt.Errorf("duplicate stop id %s", stop.ID)
+		}
+		seen[stop.ID] = true
+	}
 	return nil
 }
 
 // generateOptimizedRoute generates an optimized route using multiple algorithms
-func (ro *RouteOptimizer) generateOptimizedRoute(_ context.Context, req *RouteRequest) (*OptimizedRoute, error) {
+func (ro *RouteOptimizer) generateOptimizedRoute(ctx context.Context, req *RouteRequest) (*OptimizedRoute, error) {
+	departure := time.Now()
+	if req.TimeWindow != nil && !req.TimeWindow.Start.IsZero() {
+		departure = req.TimeWindow.Start
+	}
+	costs := ro.newRouteCosts(ctx, req.Stops, departure)
+
 	// Try different optimization algorithms and pick the best result
 	var bestRoute *OptimizedRoute
 	var bestScore float64 = -1
 
 	// Algorithm 1: Nearest Neighbor (fast, good for small routes)
 	if len(req.Stops) <= 10 {
-		route, err := ro.nearestNeighborOptimization(req)
+		route, err := ro.nearestNeighborOptimization(costs, req)
 		if err == nil {
 			score := ro.calculateOptimizationScore(route, req.Optimization)
 			if score > bestScore {
@@ -165,7 +202,7 @@ func (ro *RouteOptimizer) generateOptimizedRoute(_ context.Context, req *RouteRe
 
 	// Algorithm 2: Genetic Algorithm (better for complex routes)
 	if len(req.Stops) > 5 {
-		route, err := ro.geneticAlgorithmOptimization(req)
+		route, err := ro.geneticAlgorithmOptimization(costs, req)
 		if err == nil {
 			score := ro.calculateOptimizationScore(route, req.Optimization)
 			if score > bestScore {
@@ -176,7 +213,7 @@ func (ro *RouteOptimizer) generateOptimizedRoute(_ context.Context, req *RouteRe
 	}
 
 	// Algorithm 3: Simulated Annealing (good balance)
-	route, err := ro.simulatedAnnealingOptimization(req)
+	route, err := ro.simulatedAnnealingOptimization(costs, req)
 	if err == nil {
 		score := ro.calculateOptimizationScore(route, req.Optimization)
 		if score > bestScore {
@@ -197,7 +234,7 @@ func (ro *RouteOptimizer) generateOptimizedRoute(_ context.Context, req *RouteRe
 }
 
 // nearestNeighborOptimization implements nearest neighbor algorithm
-func (ro *RouteOptimizer) nearestNeighborOptimization(req *RouteRequest) (*OptimizedRoute, error) {
+func (ro *RouteOptimizer) nearestNeighborOptimization(costs *routeCosts, req *RouteRequest) (*OptimizedRoute, error) {
 	if len(req.Stops) < 2 {
 		return nil, fmt.Errorf("insufficient stops for optimization")
 	}
@@ -216,7 +253,7 @@ func (ro *RouteOptimizer) nearestNeighborOptimization(req *RouteRequest) (*Optim
 
 	// Find nearest unvisited stop iteratively
 	for len(visited) < len(req.Stops) {
-		nearestStop := ro.findNearestStop(currentStop, req.Stops, visited)
+		nearestStop := ro.findNearestStop(costs, currentStop, req.Stops, visited)
 		if nearestStop == nil {
 			break
 		}
@@ -227,13 +264,13 @@ func (ro *RouteOptimizer) nearestNeighborOptimization(req *RouteRequest) (*Optim
 	}
 
 	// Calculate route metrics
-	ro.calculateRouteMetrics(route)
+	ro.calculateRouteMetrics(costs, route)
 
 	return route, nil
 }
 
 // geneticAlgorithmOptimization implements genetic algorithm for route optimization
-func (ro *RouteOptimizer) geneticAlgorithmOptimization(req *RouteRequest) (*OptimizedRoute, error) {
+func (ro *RouteOptimizer) geneticAlgorithmOptimization(costs *routeCosts, req *RouteRequest) (*OptimizedRoute, error) {
 	const (
 		populationSize = 50
 		generations    = 100
@@ -248,7 +285,7 @@ func (ro *RouteOptimizer) geneticAlgorithmOptimization(req *RouteRequest) (*Opti
 	for generation := 0; generation < generations; generation++ {
 		// Evaluate fitness
 		for i := range population {
-			population[i].Fitness = ro.calculateFitness(population[i], req.Optimization)
+			population[i].Fitness = ro.calculateFitness(costs, population[i], req.Optimization)
 		}
 
 		// Sort by fitness (higher is better)
@@ -290,12 +327,12 @@ func (ro *RouteOptimizer) geneticAlgorithmOptimization(req *RouteRequest) (*Opti
 		Stops:     bestChromosome.Stops,
 	}
 
-	ro.calculateRouteMetrics(route)
+	ro.calculateRouteMetrics(costs, route)
 	return route, nil
 }
 
 // simulatedAnnealingOptimization implements simulated annealing algorithm
-func (ro *RouteOptimizer) simulatedAnnealingOptimization(req *RouteRequest) (*OptimizedRoute, error) {
+func (ro *RouteOptimizer) simulatedAnnealingOptimization(costs *routeCosts, req *RouteRequest) (*OptimizedRoute, error) {
 	const (
 		initialTemp = 1000.0
 		finalTemp   = 0.1
@@ -304,7 +341,7 @@ func (ro *RouteOptimizer) simulatedAnnealingOptimization(req *RouteRequest) (*Op
 
 	// Start with a random route
 	currentRoute := ro.generateRandomRoute(req.Stops)
-	currentCost := ro.calculateRouteCost(currentRoute, req.Optimization)
+	currentCost := ro.calculateRouteCost(costs, currentRoute, req.Optimization)
 
 	bestRoute := currentRoute
 	bestCost := currentCost
@@ -314,7 +351,7 @@ func (ro *RouteOptimizer) simulatedAnnealingOptimization(req *RouteRequest) (*Op
 	for temperature > finalTemp {
 		// Generate neighbor solution
 		neighborRoute := ro.generateNeighbor(currentRoute)
-		neighborCost := ro.calculateRouteCost(neighborRoute, req.Optimization)
+		neighborCost := ro.calculateRouteCost(costs, neighborRoute, req.Optimization)
 
 		// Accept or reject neighbor
 		if neighborCost < currentCost || ro.randomFloat() < math.Exp(-(neighborCost-currentCost)/temperature) {
@@ -336,7 +373,7 @@ func (ro *RouteOptimizer) simulatedAnnealingOptimization(req *RouteRequest) (*Op
 		Stops:     bestRoute,
 	}
 
-	ro.calculateRouteMetrics(route)
+	ro.calculateRouteMetrics(costs, route)
 	return route, nil
 }
 
@@ -374,16 +411,16 @@ func (ro *RouteOptimizer) generateRandomRoute(stops []RouteStop) []RouteStop {
 }
 
 // calculateFitness calculates fitness of a route chromosome
-func (ro *RouteOptimizer) calculateFitness(chromosome RouteChromosome, criteria OptimizationCriteria) float64 {
+func (ro *RouteOptimizer) calculateFitness(costs *routeCosts, chromosome RouteChromosome, criteria OptimizationCriteria) float64 {
 	// Calculate route cost (lower is better)
-	cost := ro.calculateRouteCost(chromosome.Stops, criteria)
+	cost := ro.calculateRouteCost(costs, chromosome.Stops, criteria)
 	
 	// Convert to fitness (higher is better)
 	return 1.0 / (1.0 + cost)
 }
 
 // calculateRouteCost calculates the cost of a route
-func (ro *RouteOptimizer) calculateRouteCost(stops []RouteStop, criteria OptimizationCriteria) float64 {
+func (ro *RouteOptimizer) calculateRouteCost(costs *routeCosts, stops []RouteStop, criteria OptimizationCriteria) float64 {
 	if len(stops) < 2 {
 		return 0
 	}
@@ -392,19 +429,19 @@ func (ro *RouteOptimizer) calculateRouteCost(stops []RouteStop, criteria Optimiz
 
 	// Calculate distance cost
 	if criteria.MinimizeDistance {
-		distance := ro.calculateTotalDistance(stops)
+		distance := ro.calculateTotalDistance(costs, stops)
 		totalCost += distance * 0.1 // Weight factor
 	}
 
 	// Calculate time cost
 	if criteria.MinimizeTime {
-		duration := ro.calculateTotalDuration(stops)
+		duration := ro.calculateTotalDuration(costs, stops)
 		totalCost += float64(duration) * 0.01 // Weight factor
 	}
 
 	// Calculate fuel cost
 	if criteria.MinimizeFuel {
-		fuelCost := ro.calculateTotalFuelCost(stops)
+		fuelCost := ro.calculateTotalFuelCost(costs, stops)
 		totalCost += fuelCost * 0.001 // Weight factor
 	}
 
@@ -440,91 +477,150 @@ func (ro *RouteOptimizer) calculateOptimizationScore(route *OptimizedRoute, crit
 }
 
 // Helper methods for route calculations
-func (ro *RouteOptimizer) findNearestStop(current RouteStop, stops []RouteStop, visited map[string]bool) *RouteStop {
+func (ro *RouteOptimizer) findNearestStop(costs *routeCosts, current RouteStop, stops []RouteStop, visited map[string]bool) *RouteStop {
 	var nearest *RouteStop
 	minDistance := math.MaxFloat64
+	matrix := costs.matrixAt(costs.departure)
 
-	for _, stop := range stops {
-		if visited[stop.ID] {
+	for i := range stops {
+		if visited[stops[i].ID] {
 			continue
 		}
 
-		distance := ro.calculateDistance(current.Latitude, current.Longitude, stop.Latitude, stop.Longitude)
+		distance := matrix.Distances[costs.index[current.ID]][costs.index[stops[i].ID]]
 		if distance < minDistance {
 			minDistance = distance
-			nearest = &stop
+			nearest = &stops[i]
 		}
 	}
 
 	return nearest
 }
 
-func (ro *RouteOptimizer) calculateTotalDistance(stops []RouteStop) float64 {
+func (ro *RouteOptimizer) calculateTotalDistance(costs *routeCosts, stops []RouteStop) float64 {
 	if len(stops) < 2 {
 		return 0
 	}
 
+	matrix := costs.matrixAt(costs.departure)
 	totalDistance := 0.0
 	for i := 1; i < len(stops); i++ {
-		distance := ro.calculateDistance(
-			stops[i-1].Latitude, stops[i-1].Longitude,
-			stops[i].Latitude, stops[i].Longitude,
-		)
-		totalDistance += distance
+		totalDistance += matrix.Distances[costs.index[stops[i-1].ID]][costs.index[stops[i].ID]]
 	}
 
 	return totalDistance
 }
 
-func (ro *RouteOptimizer) calculateTotalDuration(stops []RouteStop) int {
+func (ro *RouteOptimizer) calculateTotalDuration(costs *routeCosts, stops []RouteStop) int {
 	if len(stops) < 2 {
 		return 0
 	}
 
-	totalDuration := 0
+	matrix := costs.matrixAt(costs.departure)
+	totalDuration := 0.0
 	for i := 1; i < len(stops); i++ {
-		distance := ro.calculateDistance(
-			stops[i-1].Latitude, stops[i-1].Longitude,
-			stops[i].Latitude, stops[i].Longitude,
-		)
-		// Assume average speed of 40 km/h in city traffic
-		duration := int(distance / 40.0 * 60) // minutes
-		totalDuration += duration
-		totalDuration += stops[i].ServiceTime
+		totalDuration += matrix.Durations[costs.index[stops[i-1].ID]][costs.index[stops[i].ID]]
+		totalDuration += float64(stops[i].ServiceTime)
 	}
 
-	return totalDuration
+	return int(math.Round(totalDuration))
 }
 
-func (ro *RouteOptimizer) calculateTotalFuelCost(stops []RouteStop) float64 {
-	distance := ro.calculateTotalDistance(stops)
-	// Assume 10 km/liter fuel efficiency and 15,000 IDR/liter
-	fuelConsumption := distance / 10.0
-	fuelCost := fuelConsumption * 15000
-	return fuelCost
+func (ro *RouteOptimizer) calculateTotalFuelCost(costs *routeCosts, stops []RouteStop) float64 {
+	distance := ro.calculateTotalDistance(costs, stops)
+	return fuelCost(distance)
 }
 
-func (ro *RouteOptimizer) calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371 // Earth's radius in kilometers
+// fuelCost returns the fuel cost in IDR of driving a distance in km
+func fuelCost(distance float64) float64 {
+	// Assume 10 km/liter fuel efficiency and 15,000 IDR/liter
+	fuelConsumption := distance / 10.0
+	return fuelConsumption * 15000
+}
+
+// calculateRouteMetrics drives the route leg by leg from its departure,
+// timing each leg with the traffic of the hour it starts in
+func (ro *RouteOptimizer) calculateRouteMetrics(costs *routeCosts, route *OptimizedRoute) {
+	route.Departure = costs.departure
+	route.Legs = make([]RouteLeg, 0, len(route.Stops))
+	route.TotalDistance = 0
+
+	clock := costs.departure
+	for i := 1; i < len(route.Stops); i++ {
+		from, to := route.Stops[i-1], route.Stops[i]
+		matrix := costs.matrixAt(clock)
+		leg := RouteLeg{
+			FromStopID: from.ID,
+			ToStopID:   to.ID,
+			Distance:   matrix.Distances[costs.index[from.ID]][costs.index[to.ID]],
+			Duration:   matrix.Durations[costs.index[from.ID]][costs.index[to.ID]],
+			Departure:  clock,
+		}
+		leg.Arrival = clock.Add(time.Duration(leg.Duration * float64(time.Minute)))
+		route.Legs = append(route.Legs, leg)
+		route.TotalDistance += leg.Distance
+		route.DistanceSource = matrix.Source
+
+		clock = leg.Arrival
+		if i < len(route.Stops)-1 {
+			clock = clock.Add(time.Duration(to.ServiceTime) * time.Minute)
+		}
+	}
 
-	dLat := (lat2 - lat1) * math.Pi / 180
-	dLon := (lon2 - lon1) * math.Pi / 180
+	route.EstimatedArrival = clock
+	route.TotalDuration = int(math.Round(clock.Sub(costs.departure).Minutes()))
+	if n := len(route.Stops); n > 1 {
+		// The service time at the last stop counts towards the route's work
+		route.TotalDuration += route.Stops[n-1].ServiceTime
+	}
+	route.TotalFuelCost = fuelCost(route.TotalDistance)
+}
 
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
+// routeCosts holds the travel matrices between the stops of one request,
+// computed at most once per hour of the day the route is driven in
+type routeCosts struct {
+	ctx       context.Context
+	provider  DistanceMatrixProvider
+	locations []Location
+	index     map[string]int // stop ID to matrix index
+	departure time.Time
+	matrices  map[time.Time]*DistanceMatrix
+}
 
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return R * c
+func (ro *RouteOptimizer) newRouteCosts(ctx context.Context, stops []RouteStop, departure time.Time) *routeCosts {
+	costs := &routeCosts{
+		ctx:       ctx,
+		provider:  ro.matrices,
+		locations: make([]Location, len(stops)),
+		index:     make(map[string]int, len(stops)),
+		departure: departure,
+		matrices:  make(map[time.Time]*DistanceMatrix),
+	}
+	if costs.provider == nil {
+		costs.provider = NewHaversineProvider()
+	}
+	for i, stop := range stops {
+		costs.locations[i] = Location{Latitude: stop.Latitude, Longitude: stop.Longitude, Address: stop.Address, Name: stop.Name}
+		costs.index[stop.ID] = i
+	}
+	return costs
 }
 
-func (ro *RouteOptimizer) calculateRouteMetrics(route *OptimizedRoute) {
-	route.TotalDistance = ro.calculateTotalDistance(route.Stops)
-	route.TotalDuration = ro.calculateTotalDuration(route.Stops)
-	route.TotalFuelCost = ro.calculateTotalFuelCost(route.Stops)
-	
-	// Calculate estimated arrival time
-	route.EstimatedArrival = time.Now().Add(time.Duration(route.TotalDuration) * time.Minute)
+// matrixAt returns the travel matrix for departures in the hour of t, using
+// straight lines when the provider fails
+func (rc *routeCosts) matrixAt(t time.Time) *DistanceMatrix {
+	hour := t.Truncate(time.Hour)
+	if matrix, ok := rc.matrices[hour]; ok {
+		return matrix
+	}
+
+	matrix, err := rc.provider.DistanceMatrix(rc.ctx, rc.locations, t)
+	if err != nil || len(matrix.Distances) != len(rc.locations) {
+		fmt.Printf("Distance matrix from %s unavailable, using straight lines: %v\n", rc.provider.Name(), err)
+		matrix, _ = NewHaversineProvider().DistanceMatrix(rc.ctx, rc.locations, t)
+	}
+	rc.matrices[hour] = matrix
+	return matrix
 }
 
 // Genetic algorithm helper methods
@@ -8,6 +8,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 )
 
 // GeofenceAPI provides HTTP API for geofencing operations
@@ -32,16 +34,18 @@ func (ga *GeofenceAPI) CreateGeofenceHandler(c *gin.Context) {
 
 	// Get company information
 	companyID, _ := c.Get("company_id")
+	geofence.ID = ""
 	geofence.CompanyID = companyID.(string)
 
 	// Get user information
 	userID, _ := c.Get("user_id")
-	geofence.CreatedBy = userID.(string)
+	createdBy := userID.(string)
+	geofence.CreatedBy = &createdBy
 
 	// Create geofence
 	err := ga.geofenceManager.CreateGeofence(c.Request.Context(), &geofence)
 	if err != nil {
-		middleware.AbortWithInternal(c, "Operation failed", err)
+		abortWithError(c, err)
 		return
 	}
 
@@ -56,20 +60,36 @@ func (ga *GeofenceAPI) UpdateGeofenceHandler(c *gin.Context) {
 		return
 	}
 
-	var updates Geofence
-	if err := c.ShouldBindJSON(&updates); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Get company information
+	companyID, _ := c.Get("company_id")
+
+	geofence, err := ga.geofenceManager.GetGeofence(c.Request.Context(), companyID.(string), id)
+	if err != nil {
+		abortWithError(c, err)
 		return
 	}
 
+	// Fields missing from the body keep their current values. Polygon data is
+	// replaced as a whole rather than merged into the stored map.
+	polygonData := geofence.PolygonData
+	geofence.PolygonData = nil
+	if err := c.ShouldBindJSON(geofence); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+	if geofence.PolygonData == nil {
+		geofence.PolygonData = polygonData
+	}
+	geofence.ID = id
+	geofence.CompanyID = companyID.(string)
+
 	// Update geofence
-	err := ga.geofenceManager.UpdateGeofence(c.Request.Context(), id, &updates)
-	if err != nil {
-		middleware.AbortWithInternal(c, "Operation failed", err)
+	if err := ga.geofenceManager.UpdateGeofence(c.Request.Context(), geofence); err != nil {
+		abortWithError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Geofence updated successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Geofence updated successfully", "geofence": geofence})
 }
 
 // DeleteGeofenceHandler handles geofence deletion requests
@@ -80,10 +100,13 @@ func (ga *GeofenceAPI) DeleteGeofenceHandler(c *gin.Context) {
 		return
 	}
 
+	// Get company information
+	companyID, _ := c.Get("company_id")
+
 	// Delete geofence
-	err := ga.geofenceManager.DeleteGeofence(c.Request.Context(), id)
+	err := ga.geofenceManager.DeleteGeofence(c.Request.Context(), companyID.(string), id)
 	if err != nil {
-		middleware.AbortWithInternal(c, "Operation failed", err)
+		abortWithError(c, err)
 		return
 	}
 
@@ -120,10 +143,13 @@ func (ga *GeofenceAPI) GetGeofenceHandler(c *gin.Context) {
 		return
 	}
 
+	// Get company information
+	companyID, _ := c.Get("company_id")
+
 	// Get geofence
-	geofence, err := ga.geofenceManager.GetGeofence(c.Request.Context(), id)
+	geofence, err := ga.geofenceManager.GetGeofence(c.Request.Context(), companyID.(string), id)
 	if err != nil {
-		middleware.AbortWithInternal(c, "Operation failed", err)
+		abortWithError(c, err)
 		return
 	}
 
@@ -259,13 +285,14 @@ func (ga *GeofenceAPI) ResolveViolationHandler(c *gin.Context) {
 		return
 	}
 
-	// Get user information
+	// Get company and user information
+	companyID, _ := c.Get("company_id")
 	userID, _ := c.Get("user_id")
 
 	// Resolve violation
-	err := ga.geofenceManager.ResolveViolation(c.Request.Context(), violationID, userID.(string), req.Resolution)
+	err := ga.geofenceManager.ResolveViolation(c.Request.Context(), companyID.(string), violationID, userID.(string), req.Resolution)
 	if err != nil {
-		middleware.AbortWithInternal(c, "Operation failed", err)
+		abortWithError(c, err)
 		return
 	}
 
@@ -320,8 +347,12 @@ func (ga *GeofenceAPI) CreateGeofenceFromMapHandler(c *gin.Context) {
 	var req struct {
 		Name        string        `json:"name" binding:"required"`
 		Description string        `json:"description"`
-		Type        string        `json:"type" binding:"required"` // polygon, circle, rectangle
-		Coordinates []Coordinate  `json:"coordinates" binding:"required"`
+		Shape       string        `json:"shape"` // polygon, circle, rectangle
+		Type        string        `json:"type"` // zone, pickup, delivery, restricted
+		Category    string        `json:"category"` // deprecated: purpose sent by clients that still put the shape in type
+		Coordinates []Coordinate  `json:"coordinates"` // polygon vertices, or two opposite rectangle corners
+		CenterLat   float64       `json:"center_lat"` // for circular geofences
+		CenterLng   float64       `json:"center_lng"` // for circular geofences
 		Radius      float64       `json:"radius"` // for circular geofences
 		Priority    int           `json:"priority"`
 		Color       string        `json:"color"`
@@ -343,21 +374,33 @@ func (ga *GeofenceAPI) CreateGeofenceFromMapHandler(c *gin.Context) {
 		return
 	}
 
+	// Older clients sent the shape as type and the purpose as category
+	if req.Shape == "" && models.IsGeofenceShape(req.Type) {
+		req.Shape, req.Type = req.Type, req.Category
+	}
+	if req.Shape == "" {
+		req.Shape = models.GeofenceShapeCircle
+	}
+
 	// Get company and user information
 	companyID, _ := c.Get("company_id")
 	userID, _ := c.Get("user_id")
 
+	createdBy := userID.(string)
+
 	// Create geofence
 	geofence := &Geofence{
 		CompanyID:         companyID.(string),
 		Name:              req.Name,
 		Description:       req.Description,
-		Type:              req.Type,
-		Coordinates:       req.Coordinates,
+		Shape:             req.Shape,
+		Category:          req.Type,
+		CenterLatitude:    req.CenterLat,
+		CenterLongitude:   req.CenterLng,
 		Radius:            req.Radius,
 		Priority:          req.Priority,
 		Color:             req.Color,
-		AlertOnEntry:      req.AlertOnEntry,
+		AlertOnEnter:      req.AlertOnEntry,
 		AlertOnExit:       req.AlertOnExit,
 		AlertOnDwell:      req.AlertOnDwell,
 		DwellTime:         req.DwellTime,
@@ -369,7 +412,16 @@ func (ga *GeofenceAPI) CreateGeofenceFromMapHandler(c *gin.Context) {
 		RestrictedVehicles: req.RestrictedVehicles,
 		RestrictedDrivers:  req.RestrictedDrivers,
 		IsActive:          true,
-		CreatedBy:         userID.(string),
+		CreatedBy:         &createdBy,
+	}
+
+	if req.Shape != "circle" {
+		polygonData, err := PolygonDataFromCoordinates(req.Shape, req.Coordinates)
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		geofence.PolygonData = polygonData
 	}
 
 	// Set defaults
@@ -379,17 +431,11 @@ func (ga *GeofenceAPI) CreateGeofenceFromMapHandler(c *gin.Context) {
 	if geofence.Color == "" {
 		geofence.Color = "#FF0000"
 	}
-	if geofence.AlertOnEntry {
-		geofence.AlertOnEntry = true
-	}
-	if geofence.AlertOnExit {
-		geofence.AlertOnExit = true
-	}
 
 	// Create geofence
 	err := ga.geofenceManager.CreateGeofence(c.Request.Context(), geofence)
 	if err != nil {
-		middleware.AbortWithInternal(c, "Operation failed", err)
+		abortWithError(c, err)
 		return
 	}
 
@@ -486,6 +532,15 @@ func (ga *GeofenceAPI) GetGeofenceHeatmapHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"heatmap_data": heatmapData})
 }
 
+// abortWithError responds with the status of an AppError, or 500
+func abortWithError(c *gin.Context, err error) {
+	if appErr, ok := err.(*apperrors.AppError); ok {
+		middleware.AbortWithError(c, appErr)
+		return
+	}
+	middleware.AbortWithInternal(c, "Operation failed", err)
+}
+
 // SetupGeofenceRoutes sets up geofencing API routes
 func SetupGeofenceRoutes(r *gin.RouterGroup, api *GeofenceAPI) {
 	geofences := r.Group("/geofences")
@@ -2,80 +2,56 @@ package geofencing
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+const (
+	geofenceStateKeyPrefix = "geofence_state:"
+
+	// geofenceStateTTL expires the state of vehicles that stopped reporting
+	geofenceStateTTL = 7 * 24 * time.Hour
 )
 
 // GeofenceManager provides advanced geofencing capabilities
 type GeofenceManager struct {
 	db    *gorm.DB
 	redis *redis.Client
-}
 
-// Geofence represents a geofence zone
-type Geofence struct {
-	ID          string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	CompanyID   string    `json:"company_id" gorm:"type:uuid;not null;index"`
-	Name        string    `json:"name" gorm:"type:varchar(255);not null"`
-	Description string    `json:"description" gorm:"type:text"`
-	Type        string    `json:"type" gorm:"type:varchar(50);not null"` // polygon, circle, rectangle, route
-	
-	// Geometry
-	Coordinates []Coordinate `json:"coordinates" gorm:"type:jsonb"`
-	CenterLat   float64     `json:"center_lat" gorm:"not null"`
-	CenterLng   float64     `json:"center_lng" gorm:"not null"`
-	Radius      float64     `json:"radius" gorm:"default:0"` // meters, for circular geofences
-	
-	// Configuration
-	IsActive    bool      `json:"is_active" gorm:"default:true"`
-	Priority    int       `json:"priority" gorm:"default:1"` // 1-10, higher is more important
-	Color       string    `json:"color" gorm:"type:varchar(7);default:'#FF0000'"` // hex color
-	
-	// Alerts and Actions
-	AlertOnEntry    bool   `json:"alert_on_entry" gorm:"default:true"`
-	AlertOnExit     bool   `json:"alert_on_exit" gorm:"default:true"`
-	AlertOnDwell    bool   `json:"alert_on_dwell" gorm:"default:false"`
-	DwellTime       int    `json:"dwell_time" gorm:"default:0"` // minutes
-	SpeedLimit      float64 `json:"speed_limit" gorm:"default:0"` // km/h, 0 means no limit
-	AlertOnSpeed    bool   `json:"alert_on_speed" gorm:"default:false"`
-	
-	// Time Restrictions
-	TimeRestrictions []TimeRestriction `json:"time_restrictions" gorm:"type:jsonb"`
-	
-	// Vehicle and Driver Restrictions
-	AllowedVehicles []string `json:"allowed_vehicles" gorm:"type:jsonb"`
-	AllowedDrivers  []string `json:"allowed_drivers" gorm:"type:jsonb"`
-	RestrictedVehicles []string `json:"restricted_vehicles" gorm:"type:jsonb"`
-	RestrictedDrivers  []string `json:"restricted_drivers" gorm:"type:jsonb"`
-	
-	// Metadata
-	CreatedAt   time.Time `json:"created_at" gorm:"not null"`
-	UpdatedAt   time.Time `json:"updated_at" gorm:"not null"`
-	CreatedBy   string    `json:"created_by" gorm:"type:uuid;not null"`
+	// states holds vehicle geofence states when Redis is not configured
+	states  map[string]map[string]VehicleGeofenceState
+	stateMu sync.Mutex
 }
 
+// Geofence is the geofence model shared with the tracking API. Type holds the
+// shape (circle, polygon, rectangle) and PolygonData the GeoJSON geometry.
+type Geofence = models.Geofence
+
+// TimeRestriction represents time-based restrictions for geofences
+type TimeRestriction = models.GeofenceTimeRestriction
+
 // Coordinate represents a geographical coordinate
 type Coordinate struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 }
 
-// TimeRestriction represents time-based restrictions for geofences
-type TimeRestriction struct {
-	DayOfWeek int    `json:"day_of_week"` // 0=Sunday, 1=Monday, ..., 6=Saturday
-	StartTime string `json:"start_time"`  // HH:MM format
-	EndTime   string `json:"end_time"`    // HH:MM format
-	IsActive  bool   `json:"is_active"`
-}
-
 // GeofenceEvent represents a geofence event
 type GeofenceEvent struct {
 	ID          string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	GeofenceID  string    `json:"geofence_id" gorm:"type:uuid;not null;index"`
+	GeofenceName string   `json:"geofence_name,omitempty" gorm:"-"`
 	VehicleID   string    `json:"vehicle_id" gorm:"type:uuid;not null;index"`
 	DriverID    string    `json:"driver_id" gorm:"type:uuid;index"`
 	CompanyID   string    `json:"company_id" gorm:"type:uuid;not null;index"`
@@ -105,6 +81,7 @@ type GeofenceEvent struct {
 type GeofenceViolation struct {
 	ID          string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	GeofenceID  string    `json:"geofence_id" gorm:"type:uuid;not null;index"`
+	GeofenceName string   `json:"geofence_name,omitempty" gorm:"-"`
 	VehicleID   string    `json:"vehicle_id" gorm:"type:uuid;not null;index"`
 	DriverID    string    `json:"driver_id" gorm:"type:uuid;index"`
 	CompanyID   string    `json:"company_id" gorm:"type:uuid;not null;index"`
@@ -221,8 +198,9 @@ type AlertInfo struct {
 // NewGeofenceManager creates a new geofence manager
 func NewGeofenceManager(db *gorm.DB, redis *redis.Client) *GeofenceManager {
 	return &GeofenceManager{
-		db:    db,
-		redis: redis,
+		db:     db,
+		redis:  redis,
+		states: make(map[string]map[string]VehicleGeofenceState),
 	}
 }
 
@@ -230,16 +208,11 @@ func NewGeofenceManager(db *gorm.DB, redis *redis.Client) *GeofenceManager {
 func (gm *GeofenceManager) CreateGeofence(ctx context.Context, geofence *Geofence) error {
 	// Validate geofence
 	if err := gm.validateGeofence(geofence); err != nil {
-		return fmt.Errorf("geofence validation failed: %w", err)
-	}
-
-	// Calculate center coordinates if not provided
-	if geofence.CenterLat == 0 && geofence.CenterLng == 0 {
-		gm.calculateCenter(geofence)
+		return err
 	}
 
 	// Save to database
-	if err := gm.db.Create(geofence).Error; err != nil {
+	if err := gm.db.WithContext(ctx).Omit(clause.Associations).Create(geofence).Error; err != nil {
 		return fmt.Errorf("failed to create geofence: %w", err)
 	}
 
@@ -252,57 +225,42 @@ func (gm *GeofenceManager) CreateGeofence(ctx context.Context, geofence *Geofenc
 	return nil
 }
 
-// UpdateGeofence updates an existing geofence
-func (gm *GeofenceManager) UpdateGeofence(ctx context.Context, id string, updates *Geofence) error {
-	// Validate updates
-	if err := gm.validateGeofence(updates); err != nil {
-		return fmt.Errorf("geofence validation failed: %w", err)
-	}
-
-	// Calculate center coordinates if coordinates changed
-	if len(updates.Coordinates) > 0 {
-		gm.calculateCenter(updates)
+// UpdateGeofence validates and saves a geofence loaded with GetGeofence
+func (gm *GeofenceManager) UpdateGeofence(ctx context.Context, geofence *Geofence) error {
+	// Validate geofence
+	if err := gm.validateGeofence(geofence); err != nil {
+		return err
 	}
 
 	// Update in database
-	updates.UpdatedAt = time.Now()
-	if err := gm.db.Model(&Geofence{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+	if err := gm.db.WithContext(ctx).Omit(clause.Associations, "CreatedAt", "CreatedBy").Save(geofence).Error; err != nil {
 		return fmt.Errorf("failed to update geofence: %w", err)
 	}
 
-	// Get updated geofence
-	var updatedGeofence Geofence
-	if err := gm.db.First(&updatedGeofence, "id = ?", id).Error; err != nil {
-		return fmt.Errorf("failed to get updated geofence: %w", err)
-	}
-
 	// Update cache
-	gm.cacheGeofence(context.Background(), &updatedGeofence)
+	gm.cacheGeofence(context.Background(), geofence)
 
 	// Invalidate company geofence cache
-	gm.invalidateCompanyGeofenceCache(context.Background(), updatedGeofence.CompanyID)
+	gm.invalidateCompanyGeofenceCache(context.Background(), geofence.CompanyID)
 
 	return nil
 }
 
-// DeleteGeofence deletes a geofence
-func (gm *GeofenceManager) DeleteGeofence(ctx context.Context, id string) error {
-	// Get geofence to get company ID
-	var geofence Geofence
-	if err := gm.db.First(&geofence, "id = ?", id).Error; err != nil {
-		return fmt.Errorf("geofence not found: %w", err)
+// DeleteGeofence deletes a company geofence
+func (gm *GeofenceManager) DeleteGeofence(ctx context.Context, companyID, id string) error {
+	result := gm.db.WithContext(ctx).Where("id = ? AND company_id = ?", id, companyID).Delete(&Geofence{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete geofence: %w", result.Error)
 	}
-
-	// Delete from database
-	if err := gm.db.Delete(&Geofence{}, "id = ?", id).Error; err != nil {
-		return fmt.Errorf("failed to delete geofence: %w", err)
+	if result.RowsAffected == 0 {
+		return apperrors.NewNotFoundError("geofence")
 	}
 
 	// Remove from cache
 	gm.removeGeofenceFromCache(context.Background(), id)
 
 	// Invalidate company geofence cache
-	gm.invalidateCompanyGeofenceCache(context.Background(), geofence.CompanyID)
+	gm.invalidateCompanyGeofenceCache(context.Background(), companyID)
 
 	return nil
 }
@@ -316,16 +274,14 @@ func (gm *GeofenceManager) GetGeofences(ctx context.Context, companyID string, a
 		return cached, nil
 	}
 
-	var geofences []Geofence
-	query := gm.db.Where("company_id = ?", companyID)
-	
+	filters := map[string]interface{}{}
 	if activeOnly {
-		query = query.Where("is_active = true")
+		filters["is_active"] = true
 	}
-	
-	err = query.Order("priority DESC, created_at DESC").Find(&geofences).Error
+
+	geofences, err := gm.FindGeofences(ctx, companyID, filters)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get geofences: %w", err)
+		return nil, err
 	}
 
 	// Cache the result
@@ -334,18 +290,44 @@ func (gm *GeofenceManager) GetGeofences(ctx context.Context, companyID string, a
 	return geofences, nil
 }
 
-// GetGeofence retrieves a specific geofence
-func (gm *GeofenceManager) GetGeofence(ctx context.Context, id string) (*Geofence, error) {
+// FindGeofences retrieves company geofences filtered by shape (the type
+// column), category and is_active, most important first
+func (gm *GeofenceManager) FindGeofences(ctx context.Context, companyID string, filters map[string]interface{}) ([]Geofence, error) {
+	query := gm.db.WithContext(ctx).Where("company_id = ?", companyID)
+
+	if shape, ok := filters["shape"]; ok {
+		query = query.Where("type = ?", shape)
+	}
+	if category, ok := filters["category"]; ok {
+		query = query.Where("category = ?", category)
+	}
+	if isActive, ok := filters["is_active"]; ok {
+		query = query.Where("is_active = ?", isActive)
+	}
+
+	var geofences []Geofence
+	if err := query.Order("priority DESC, created_at DESC").Find(&geofences).Error; err != nil {
+		return nil, fmt.Errorf("failed to get geofences: %w", err)
+	}
+
+	return geofences, nil
+}
+
+// GetGeofence retrieves a company geofence
+func (gm *GeofenceManager) GetGeofence(ctx context.Context, companyID, id string) (*Geofence, error) {
 	// Check cache first
 	cached, err := gm.getCachedGeofence(context.Background(), id)
-	if err == nil && cached != nil {
+	if err == nil && cached != nil && cached.CompanyID == companyID {
 		return cached, nil
 	}
 
 	var geofence Geofence
-	err = gm.db.First(&geofence, "id = ?", id).Error
+	err = gm.db.WithContext(ctx).Where("id = ? AND company_id = ?", id, companyID).First(&geofence).Error
 	if err != nil {
-		return nil, fmt.Errorf("geofence not found: %w", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("geofence")
+		}
+		return nil, fmt.Errorf("failed to get geofence: %w", err)
 	}
 
 	// Cache the result
@@ -354,7 +336,9 @@ func (gm *GeofenceManager) GetGeofence(ctx context.Context, id string) (*Geofenc
 	return &geofence, nil
 }
 
-// CheckGeofences checks if a location is within any geofences
+// CheckGeofences checks if a location is within any geofences. Entry, exit,
+// dwell and speed events are generated from the vehicle's previous state, so
+// repeated checks of the same position do not repeat events.
 func (gm *GeofenceManager) CheckGeofences(ctx context.Context, req *GeofenceCheckRequest) (*GeofenceCheckResult, error) {
 	// Get active geofences for the company
 	geofences, err := gm.GetGeofences(ctx, req.CompanyID, true)
@@ -362,6 +346,77 @@ func (gm *GeofenceManager) CheckGeofences(ctx context.Context, req *GeofenceChec
 		return nil, fmt.Errorf("failed to get geofences: %w", err)
 	}
 
+	// Get the vehicle's previous state
+	states, err := gm.getVehicleGeofenceStates(ctx, req.VehicleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vehicle geofence state: %w", err)
+	}
+
+	result, changed := gm.evaluateGeofences(req, geofences, states)
+
+	// Update vehicle geofence state before saving events, so a concurrent
+	// check of the same vehicle does not repeat them
+	if err := gm.updateVehicleGeofenceState(ctx, req.VehicleID, changed); err != nil {
+		return nil, fmt.Errorf("failed to update vehicle geofence state: %w", err)
+	}
+
+	// Save events and violations to database
+	if err := gm.saveGeofenceEvents(ctx, result.GeofenceEvents); err != nil {
+		fmt.Printf("Failed to save geofence events for vehicle %s: %v\n", req.VehicleID, err)
+	}
+	if err := gm.saveGeofenceViolations(ctx, result.Violations); err != nil {
+		fmt.Printf("Failed to save geofence violations for vehicle %s: %v\n", req.VehicleID, err)
+	}
+
+	return result, nil
+}
+
+// RestoreGeofenceStates marks a vehicle inside the geofences that contain its
+// last known location without raising events, so the first fix after a
+// restart is not reported as an entry. Stored states are kept. It returns
+// the IDs of the geofences the vehicle is inside.
+func (gm *GeofenceManager) RestoreGeofenceStates(ctx context.Context, req *GeofenceCheckRequest) ([]string, error) {
+	geofences, err := gm.GetGeofences(ctx, req.CompanyID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get geofences: %w", err)
+	}
+
+	states, err := gm.getVehicleGeofenceStates(ctx, req.VehicleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vehicle geofence state: %w", err)
+	}
+
+	inside, changed := gm.seedGeofenceStates(req, geofences, states)
+	if err := gm.updateVehicleGeofenceState(ctx, req.VehicleID, changed); err != nil {
+		return nil, fmt.Errorf("failed to update vehicle geofence state: %w", err)
+	}
+	return inside, nil
+}
+
+// seedGeofenceStates returns the geofences containing a location and the
+// states to add for those the vehicle has no state for, entered at the
+// location's time
+func (gm *GeofenceManager) seedGeofenceStates(req *GeofenceCheckRequest, geofences []Geofence, states map[string]*VehicleGeofenceState) ([]string, map[string]*VehicleGeofenceState) {
+	var inside []string
+	changed := make(map[string]*VehicleGeofenceState)
+	for i := range geofences {
+		geofence := &geofences[i]
+		isInside, err := gm.isPointInGeofence(req.Latitude, req.Longitude, geofence)
+		if err != nil || !isInside {
+			continue
+		}
+		inside = append(inside, geofence.ID)
+		if _, known := states[geofence.ID]; !known {
+			changed[geofence.ID] = &VehicleGeofenceState{EnteredAt: req.Timestamp}
+		}
+	}
+	return inside, changed
+}
+
+// evaluateGeofences compares a location with the vehicle's previous state and
+// returns the resulting events together with the changed states. A nil state
+// means the vehicle is no longer inside that geofence.
+func (gm *GeofenceManager) evaluateGeofences(req *GeofenceCheckRequest, geofences []Geofence, states map[string]*VehicleGeofenceState) (*GeofenceCheckResult, map[string]*VehicleGeofenceState) {
 	result := &GeofenceCheckResult{
 		VehicleID:       req.VehicleID,
 		DriverID:        req.DriverID,
@@ -374,91 +429,98 @@ func (gm *GeofenceManager) CheckGeofences(ctx context.Context, req *GeofenceChec
 		Violations:      []GeofenceViolation{},
 		AlertsGenerated: []AlertInfo{},
 	}
+	changed := make(map[string]*VehicleGeofenceState)
 
 	// Check each geofence
-	for _, geofence := range geofences {
+	checked := make(map[string]bool, len(geofences))
+	for i := range geofences {
+		geofence := &geofences[i]
+		checked[geofence.ID] = true
+
 		// Check if location is within geofence
-		isInside, err := gm.isPointInGeofence(req.Latitude, req.Longitude, &geofence)
+		isInside, err := gm.isPointInGeofence(req.Latitude, req.Longitude, geofence)
 		if err != nil {
 			continue
 		}
 
-		// Check time restrictions
-		if !gm.isTimeAllowed(&geofence, req.Timestamp) {
-			continue
-		}
-
-		// Check vehicle/driver restrictions
-		if !gm.isVehicleAllowed(&geofence, req.VehicleID, req.DriverID) {
-			continue
-		}
-
 		// Get previous state
-		wasInside, err := gm.wasVehicleInGeofence(context.Background(), req.VehicleID, geofence.ID)
-		if err != nil {
-			wasInside = false
+		previous, wasInside := states[geofence.ID]
+		state := &VehicleGeofenceState{EnteredAt: req.Timestamp}
+		if wasInside {
+			copied := *previous
+			state = &copied
 		}
 
 		// Generate events based on state changes
 		if isInside && !wasInside {
 			// Entry event
-			event := gm.createGeofenceEvent(&geofence, req, "entry")
+			event := gm.createGeofenceEvent(geofence, req, "entry")
 			result.GeofenceEvents = append(result.GeofenceEvents, *event)
-			
-			if geofence.AlertOnEntry {
-				alert := gm.generateAlert(&geofence, req, "entry")
+
+			if geofence.AlertOnEnter {
+				alert := gm.generateAlert(geofence, req, "entry")
 				result.AlertsGenerated = append(result.AlertsGenerated, *alert)
 			}
 		} else if !isInside && wasInside {
 			// Exit event
-			event := gm.createGeofenceEvent(&geofence, req, "exit")
+			event := gm.createGeofenceEvent(geofence, req, "exit")
+			event.Duration = state.dwellSeconds(req.Timestamp)
 			result.GeofenceEvents = append(result.GeofenceEvents, *event)
-			
+
 			if geofence.AlertOnExit {
-				alert := gm.generateAlert(&geofence, req, "exit")
+				alert := gm.generateAlert(geofence, req, "exit")
 				result.AlertsGenerated = append(result.AlertsGenerated, *alert)
 			}
-		} else if isInside {
-			// Check for speed violations
-			if geofence.AlertOnSpeed && geofence.SpeedLimit > 0 && req.Speed > geofence.SpeedLimit {
-				event := gm.createGeofenceEvent(&geofence, req, "speed_violation")
+		}
+
+		if isInside {
+			// Check for speed violations, once each time the limit is exceeded
+			speeding := geofence.AlertOnSpeed && geofence.SpeedLimit > 0 && req.Speed > geofence.SpeedLimit
+			if speeding && !state.Speeding {
+				event := gm.createGeofenceEvent(geofence, req, "speed_violation")
 				result.GeofenceEvents = append(result.GeofenceEvents, *event)
-				
-				alert := gm.generateAlert(&geofence, req, "speed_violation")
+
+				alert := gm.generateAlert(geofence, req, "speed_violation")
 				result.AlertsGenerated = append(result.AlertsGenerated, *alert)
 			}
 
-			// Check for dwell time
-			if geofence.AlertOnDwell && geofence.DwellTime > 0 {
-				dwellTime, err := gm.getDwellTime(context.Background(), req.VehicleID, geofence.ID)
-				if err == nil && dwellTime >= geofence.DwellTime {
-					event := gm.createGeofenceEvent(&geofence, req, "dwell")
-					event.Duration = dwellTime
-					result.GeofenceEvents = append(result.GeofenceEvents, *event)
-					
-					alert := gm.generateAlert(&geofence, req, "dwell")
-					result.AlertsGenerated = append(result.AlertsGenerated, *alert)
-				}
+			// Check for dwell time, once per visit
+			dwellTime := state.dwellSeconds(req.Timestamp)
+			if geofence.AlertOnDwell && geofence.DwellTime > 0 && !state.DwellAlerted && dwellTime >= geofence.DwellTime*60 {
+				event := gm.createGeofenceEvent(geofence, req, "dwell")
+				event.Duration = dwellTime
+				result.GeofenceEvents = append(result.GeofenceEvents, *event)
+
+				alert := gm.generateAlert(geofence, req, "dwell")
+				result.AlertsGenerated = append(result.AlertsGenerated, *alert)
+				state.DwellAlerted = true
 			}
 		}
 
 		// Check for violations
-		violations := gm.checkViolations(&geofence, req, isInside, wasInside)
+		violations := gm.checkViolations(geofence, req, isInside, wasInside, state)
 		result.Violations = append(result.Violations, violations...)
-	}
 
-	// Save events and violations to database
-	if len(result.GeofenceEvents) > 0 {
-		gm.saveGeofenceEvents(context.Background(), result.GeofenceEvents)
-	}
-	if len(result.Violations) > 0 {
-		gm.saveGeofenceViolations(context.Background(), result.Violations)
+		if !isInside {
+			if wasInside {
+				changed[geofence.ID] = nil
+			}
+			continue
+		}
+		state.Speeding = geofence.AlertOnSpeed && geofence.SpeedLimit > 0 && req.Speed > geofence.SpeedLimit
+		if !wasInside || *state != *previous {
+			changed[geofence.ID] = state
+		}
 	}
 
-	// Update vehicle geofence state
-	gm.updateVehicleGeofenceState(context.Background(), req.VehicleID, result.GeofenceEvents)
+	// Forget geofences that were deleted or deactivated while the vehicle was inside
+	for geofenceID := range states {
+		if !checked[geofenceID] {
+			changed[geofenceID] = nil
+		}
+	}
 
-	return result, nil
+	return result, changed
 }
 
 // GetGeofenceEvents retrieves geofence events
@@ -535,8 +597,8 @@ func (gm *GeofenceManager) GetGeofenceViolations(_ context.Context, companyID st
 	return violations, nil
 }
 
-// ResolveViolation resolves a geofence violation
-func (gm *GeofenceManager) ResolveViolation(_ context.Context, violationID string, resolvedBy string, resolution string) error {
+// ResolveViolation resolves a company geofence violation
+func (gm *GeofenceManager) ResolveViolation(ctx context.Context, companyID, violationID string, resolvedBy string, resolution string) error {
 	updates := map[string]interface{}{
 		"is_resolved": true,
 		"resolved_at": time.Now(),
@@ -545,8 +607,12 @@ func (gm *GeofenceManager) ResolveViolation(_ context.Context, violationID strin
 		"updated_at":  time.Now(),
 	}
 
-	if err := gm.db.Model(&GeofenceViolation{}).Where("id = ?", violationID).Updates(updates).Error; err != nil {
-		return fmt.Errorf("failed to resolve violation: %w", err)
+	result := gm.db.WithContext(ctx).Model(&GeofenceViolation{}).Where("id = ? AND company_id = ?", violationID, companyID).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to resolve violation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.NewNotFoundError("geofence violation")
 	}
 
 	return nil
@@ -635,92 +701,107 @@ func (gm *GeofenceManager) GetGeofenceAnalytics(ctx context.Context, companyID s
 	return analytics, nil
 }
 
-// validateGeofence validates a geofence
+// validateGeofence validates a geofence and fills in defaults and the center
+// of polygon and rectangle geofences
 func (gm *GeofenceManager) validateGeofence(geofence *Geofence) error {
 	if geofence.CompanyID == "" {
-		return fmt.Errorf("company ID is required")
+		return apperrors.NewValidationError("company ID is required")
 	}
 	if geofence.Name == "" {
-		return fmt.Errorf("geofence name is required")
+		return apperrors.NewValidationError("geofence name is required")
+	}
+	if geofence.Shape == "" {
+		geofence.Shape = models.GeofenceShapeCircle
+	}
+	if geofence.Category == "" {
+		geofence.Category = models.GeofencePurposeZone
 	}
-	if geofence.Type == "" {
-		return fmt.Errorf("geofence type is required")
+	if !models.IsGeofencePurpose(geofence.Category) {
+		if models.IsGeofenceShape(geofence.Category) {
+			return apperrors.NewValidationError("type is the geofence purpose (zone, pickup, delivery, restricted); send the geometry as shape")
+		}
+		return apperrors.NewValidationError("type must be one of zone, pickup, delivery, restricted")
+	}
+	if geofence.Shape == models.GeofenceShapeCircle {
+		geofence.PolygonData = nil
+	} else {
+		geofence.Radius = 0
 	}
-	if len(geofence.Coordinates) == 0 && geofence.Type != "circle" {
-		return fmt.Errorf("coordinates are required for non-circular geofences")
+	if err := geofence.ValidateGeometry(); err != nil {
+		return apperrors.NewValidationError(err.Error())
 	}
-	if geofence.Type == "circle" && geofence.Radius <= 0 {
-		return fmt.Errorf("radius is required for circular geofences")
+	if geofence.Priority == 0 {
+		geofence.Priority = 5
 	}
 	if geofence.Priority < 1 || geofence.Priority > 10 {
-		return fmt.Errorf("priority must be between 1 and 10")
+		return apperrors.NewValidationError("priority must be between 1 and 10")
 	}
-	return nil
-}
-
-// calculateCenter calculates the center coordinates of a geofence
-func (gm *GeofenceManager) calculateCenter(geofence *Geofence) {
-	if len(geofence.Coordinates) == 0 {
-		return
+	if geofence.AlertOnDwell && geofence.DwellTime <= 0 {
+		return apperrors.NewValidationError("dwell time is required when dwell alerts are enabled")
 	}
-
-	var sumLat, sumLng float64
-	for _, coord := range geofence.Coordinates {
-		sumLat += coord.Latitude
-		sumLng += coord.Longitude
+	if geofence.SpeedLimit < 0 {
+		return apperrors.NewValidationError("speed limit cannot be negative")
 	}
-
-	geofence.CenterLat = sumLat / float64(len(geofence.Coordinates))
-	geofence.CenterLng = sumLng / float64(len(geofence.Coordinates))
+	for _, restriction := range geofence.TimeRestrictions {
+		if restriction.DayOfWeek < 0 || restriction.DayOfWeek > 6 {
+			return apperrors.NewValidationError("time restriction day_of_week must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		start, err := time.Parse("15:04", restriction.StartTime)
+		if err != nil {
+			return apperrors.NewValidationError("time restriction start_time must be in HH:MM format")
+		}
+		end, err := time.Parse("15:04", restriction.EndTime)
+		if err != nil {
+			return apperrors.NewValidationError("time restriction end_time must be in HH:MM format")
+		}
+		if !start.Before(end) {
+			return apperrors.NewValidationError("time restriction start_time must be before end_time")
+		}
+	}
+	return nil
 }
 
 // isPointInGeofence checks if a point is inside a geofence
 func (gm *GeofenceManager) isPointInGeofence(lat, lng float64, geofence *Geofence) (bool, error) {
-	switch geofence.Type {
-	case "circle":
-		distance := gm.calculateDistance(lat, lng, geofence.CenterLat, geofence.CenterLng)
-		return distance <= geofence.Radius, nil
-	case "polygon":
-		return gm.isPointInPolygon(lat, lng, geofence.Coordinates), nil
-	case "rectangle":
-		return gm.isPointInRectangle(lat, lng, geofence.Coordinates), nil
+	switch geofence.Shape {
+	case models.GeofenceShapeCircle, models.GeofenceShapePolygon, models.GeofenceShapeRectangle:
+		return geofence.IsPointInside(lat, lng), nil
 	default:
-		return false, fmt.Errorf("unsupported geofence type: %s", geofence.Type)
+		return false, fmt.Errorf("unsupported geofence shape: %s", geofence.Shape)
 	}
 }
 
-// isPointInPolygon checks if a point is inside a polygon using ray casting algorithm
-func (gm *GeofenceManager) isPointInPolygon(lat, lng float64, coordinates []Coordinate) bool {
-	if len(coordinates) < 3 {
-		return false
-	}
-
-	inside := false
-	j := len(coordinates) - 1
-
-	for i := 0; i < len(coordinates); i++ {
-		if ((coordinates[i].Latitude > lat) != (coordinates[j].Latitude > lat)) &&
-			(lng < (coordinates[j].Longitude-coordinates[i].Longitude)*(lat-coordinates[i].Latitude)/(coordinates[j].Latitude-coordinates[i].Latitude)+coordinates[i].Longitude) {
-			inside = !inside
+// PolygonDataFromCoordinates converts map vertices to polygon data: a closed
+// GeoJSON ring for polygons, or the bbox of two opposite corners for rectangles
+func PolygonDataFromCoordinates(shape string, coordinates []Coordinate) (models.JSON, error) {
+	switch shape {
+	case models.GeofenceShapePolygon:
+		if len(coordinates) < 3 {
+			return nil, apperrors.NewValidationError("polygon geofences require at least 3 coordinates")
 		}
-		j = i
-	}
-
-	return inside
-}
-
-// isPointInRectangle checks if a point is inside a rectangle
-func (gm *GeofenceManager) isPointInRectangle(lat, lng float64, coordinates []Coordinate) bool {
-	if len(coordinates) != 2 {
-		return false
+		ring := make([]interface{}, 0, len(coordinates)+1)
+		for _, coordinate := range coordinates {
+			ring = append(ring, []interface{}{coordinate.Longitude, coordinate.Latitude})
+		}
+		first, last := coordinates[0], coordinates[len(coordinates)-1]
+		if first != last {
+			ring = append(ring, []interface{}{first.Longitude, first.Latitude})
+		}
+		return models.JSON{"type": "Polygon", "coordinates": []interface{}{ring}}, nil
+	case models.GeofenceShapeRectangle:
+		if len(coordinates) != 2 {
+			return nil, apperrors.NewValidationError("rectangle geofences require exactly 2 opposite corners")
+		}
+		a, b := coordinates[0], coordinates[1]
+		return models.JSON{"bbox": []interface{}{
+			math.Min(a.Longitude, b.Longitude),
+			math.Min(a.Latitude, b.Latitude),
+			math.Max(a.Longitude, b.Longitude),
+			math.Max(a.Latitude, b.Latitude),
+		}}, nil
+	default:
+		return nil, apperrors.NewValidationError("coordinates are only used by polygon and rectangle geofences")
 	}
-
-	minLat := math.Min(coordinates[0].Latitude, coordinates[1].Latitude)
-	maxLat := math.Max(coordinates[0].Latitude, coordinates[1].Latitude)
-	minLng := math.Min(coordinates[0].Longitude, coordinates[1].Longitude)
-	maxLng := math.Max(coordinates[0].Longitude, coordinates[1].Longitude)
-
-	return lat >= minLat && lat <= maxLat && lng >= minLng && lng <= maxLng
 }
 
 // isTimeAllowed checks if the current time is allowed for the geofence
@@ -789,28 +870,101 @@ func (gm *GeofenceManager) isVehicleAllowed(geofence *Geofence, vehicleID, drive
 	return true
 }
 
-// wasVehicleInGeofence checks if a vehicle was previously in a geofence
-func (gm *GeofenceManager) wasVehicleInGeofence(_ context.Context, _, _ string) (bool, error) {
-	// This would check the vehicle's previous geofence state
-	// For now, return false as a placeholder
-	return false, nil
+// VehicleGeofenceState is the state of a vehicle inside a geofence
+type VehicleGeofenceState struct {
+	EnteredAt    time.Time `json:"entered_at"`
+	DwellAlerted bool      `json:"dwell_alerted"`
+	Speeding     bool      `json:"speeding"`
+	TimeViolated bool      `json:"time_violated"`
 }
 
-// getDwellTime gets the dwell time for a vehicle in a geofence
-func (gm *GeofenceManager) getDwellTime(_ context.Context, _, _ string) (int, error) {
-	// This would calculate the dwell time based on entry/exit events
-	// For now, return 0 as a placeholder
-	return 0, nil
+// dwellSeconds returns how long the vehicle has been inside at the given time
+func (s *VehicleGeofenceState) dwellSeconds(at time.Time) int {
+	if at.Before(s.EnteredAt) {
+		return 0
+	}
+	return int(at.Sub(s.EnteredAt).Seconds())
+}
+
+// getVehicleGeofenceStates gets the geofences a vehicle is inside, keyed by geofence ID
+func (gm *GeofenceManager) getVehicleGeofenceStates(ctx context.Context, vehicleID string) (map[string]*VehicleGeofenceState, error) {
+	states := make(map[string]*VehicleGeofenceState)
+
+	if gm.redis == nil {
+		gm.stateMu.Lock()
+		defer gm.stateMu.Unlock()
+		for geofenceID, state := range gm.states[vehicleID] {
+			copied := state
+			states[geofenceID] = &copied
+		}
+		return states, nil
+	}
+
+	values, err := gm.redis.HGetAll(ctx, geofenceStateKeyPrefix+vehicleID).Result()
+	if err != nil {
+		return nil, err
+	}
+	for geofenceID, value := range values {
+		var state VehicleGeofenceState
+		if err := json.Unmarshal([]byte(value), &state); err != nil {
+			continue
+		}
+		states[geofenceID] = &state
+	}
+
+	return states, nil
+}
+
+// updateVehicleGeofenceState stores the changed states of a vehicle. A nil
+// state removes the geofence from the vehicle's state.
+func (gm *GeofenceManager) updateVehicleGeofenceState(ctx context.Context, vehicleID string, changed map[string]*VehicleGeofenceState) error {
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if gm.redis == nil {
+		gm.stateMu.Lock()
+		defer gm.stateMu.Unlock()
+		if gm.states[vehicleID] == nil {
+			gm.states[vehicleID] = make(map[string]VehicleGeofenceState)
+		}
+		for geofenceID, state := range changed {
+			if state == nil {
+				delete(gm.states[vehicleID], geofenceID)
+			} else {
+				gm.states[vehicleID][geofenceID] = *state
+			}
+		}
+		return nil
+	}
+
+	key := geofenceStateKeyPrefix + vehicleID
+	pipe := gm.redis.TxPipeline()
+	for geofenceID, state := range changed {
+		if state == nil {
+			pipe.HDel(ctx, key, geofenceID)
+			continue
+		}
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		pipe.HSet(ctx, key, geofenceID, data)
+	}
+	pipe.Expire(ctx, key, geofenceStateTTL)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
 // createGeofenceEvent creates a geofence event
 func (gm *GeofenceManager) createGeofenceEvent(geofence *Geofence, req *GeofenceCheckRequest, eventType string) *GeofenceEvent {
 	return &GeofenceEvent{
-		GeofenceID:  geofence.ID,
-		VehicleID:   req.VehicleID,
-		DriverID:    req.DriverID,
-		CompanyID:   req.CompanyID,
-		EventType:   eventType,
+		GeofenceID:   geofence.ID,
+		GeofenceName: geofence.Name,
+		VehicleID:    req.VehicleID,
+		DriverID:     req.DriverID,
+		CompanyID:    req.CompanyID,
+		EventType:    eventType,
 		Latitude:    req.Latitude,
 		Longitude:   req.Longitude,
 		Speed:       req.Speed,
@@ -841,83 +995,60 @@ func (gm *GeofenceManager) generateAlert(geofence *Geofence, req *GeofenceCheckR
 	}
 }
 
-// checkViolations checks for geofence violations
-func (gm *GeofenceManager) checkViolations(geofence *Geofence, req *GeofenceCheckRequest, isInside, wasInside bool) []GeofenceViolation {
+// checkViolations checks for geofence violations. Speed and time violations
+// are reported once until the vehicle complies again or leaves the geofence.
+func (gm *GeofenceManager) checkViolations(geofence *Geofence, req *GeofenceCheckRequest, isInside, wasInside bool, state *VehicleGeofenceState) []GeofenceViolation {
 	var violations []GeofenceViolation
 
-	// Check for unauthorized entry/exit
-	if !gm.isVehicleAllowed(geofence, req.VehicleID, req.DriverID) {
-		if isInside && !wasInside {
-			violation := GeofenceViolation{
-				GeofenceID:    geofence.ID,
-				VehicleID:     req.VehicleID,
-				DriverID:      req.DriverID,
-				CompanyID:     req.CompanyID,
-				ViolationType: "unauthorized_entry",
-				Severity:      gm.getViolationSeverity(geofence.Priority),
-				Description:   fmt.Sprintf("Unauthorized entry into geofence %s", geofence.Name),
-				Latitude:      req.Latitude,
-				Longitude:     req.Longitude,
-				Speed:         req.Speed,
-				ViolationTime: req.Timestamp,
-				CreatedAt:     time.Now(),
-			}
-			violations = append(violations, violation)
-		} else if !isInside && wasInside {
-			violation := GeofenceViolation{
-				GeofenceID:    geofence.ID,
-				VehicleID:     req.VehicleID,
-				DriverID:      req.DriverID,
-				CompanyID:     req.CompanyID,
-				ViolationType: "unauthorized_exit",
-				Severity:      gm.getViolationSeverity(geofence.Priority),
-				Description:   fmt.Sprintf("Unauthorized exit from geofence %s", geofence.Name),
-				Latitude:      req.Latitude,
-				Longitude:     req.Longitude,
-				Speed:         req.Speed,
-				ViolationTime: req.Timestamp,
-				CreatedAt:     time.Now(),
-			}
-			violations = append(violations, violation)
-		}
-	}
-
-	// Check for speed violations
-	if geofence.AlertOnSpeed && geofence.SpeedLimit > 0 && req.Speed > geofence.SpeedLimit {
-		violation := GeofenceViolation{
+	newViolation := func(violationType, severity, description string) GeofenceViolation {
+		return GeofenceViolation{
 			GeofenceID:    geofence.ID,
+			GeofenceName:  geofence.Name,
 			VehicleID:     req.VehicleID,
 			DriverID:      req.DriverID,
 			CompanyID:     req.CompanyID,
-			ViolationType: "speed_violation",
-			Severity:      "high",
-			Description:   fmt.Sprintf("Speed violation in geofence %s: %.1f km/h (limit: %.1f km/h)", geofence.Name, req.Speed, geofence.SpeedLimit),
+			ViolationType: violationType,
+			Severity:      severity,
+			Description:   description,
 			Latitude:      req.Latitude,
 			Longitude:     req.Longitude,
 			Speed:         req.Speed,
 			ViolationTime: req.Timestamp,
 			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
 		}
-		violations = append(violations, violation)
+	}
+
+	// Check for unauthorized entry/exit
+	if !gm.isVehicleAllowed(geofence, req.VehicleID, req.DriverID) {
+		if isInside && !wasInside {
+			violations = append(violations, newViolation("unauthorized_entry", gm.getViolationSeverity(geofence.Priority),
+				fmt.Sprintf("Unauthorized entry into geofence %s", geofence.Name)))
+		} else if !isInside && wasInside {
+			violations = append(violations, newViolation("unauthorized_exit", gm.getViolationSeverity(geofence.Priority),
+				fmt.Sprintf("Unauthorized exit from geofence %s", geofence.Name)))
+		}
+	}
+
+	if !isInside {
+		return violations
+	}
+
+	// Check for speed violations
+	if geofence.AlertOnSpeed && geofence.SpeedLimit > 0 && req.Speed > geofence.SpeedLimit && !state.Speeding {
+		violations = append(violations, newViolation("speed_violation", "high",
+			fmt.Sprintf("Speed violation in geofence %s: %.1f km/h (limit: %.1f km/h)", geofence.Name, req.Speed, geofence.SpeedLimit)))
 	}
 
 	// Check for time violations
-	if !gm.isTimeAllowed(geofence, req.Timestamp) && isInside {
-		violation := GeofenceViolation{
-			GeofenceID:    geofence.ID,
-			VehicleID:     req.VehicleID,
-			DriverID:      req.DriverID,
-			CompanyID:     req.CompanyID,
-			ViolationType: "time_violation",
-			Severity:      "medium",
-			Description:   fmt.Sprintf("Time violation in geofence %s", geofence.Name),
-			Latitude:      req.Latitude,
-			Longitude:     req.Longitude,
-			Speed:         req.Speed,
-			ViolationTime: req.Timestamp,
-			CreatedAt:     time.Now(),
+	if !gm.isTimeAllowed(geofence, req.Timestamp) {
+		if !state.TimeViolated {
+			violations = append(violations, newViolation("time_violation", "medium",
+				fmt.Sprintf("Time violation in geofence %s", geofence.Name)))
+			state.TimeViolated = true
 		}
-		violations = append(violations, violation)
+	} else {
+		state.TimeViolated = false
 	}
 
 	return violations
@@ -935,29 +1066,45 @@ func (gm *GeofenceManager) getViolationSeverity(priority int) string {
 	return "low"
 }
 
-// saveGeofenceEvents saves geofence events to database
-func (gm *GeofenceManager) saveGeofenceEvents(_ context.Context, events []GeofenceEvent) error {
+// saveGeofenceEvents saves geofence events to database. Events of vehicles
+// without a driver are stored with a NULL driver_id.
+func (gm *GeofenceManager) saveGeofenceEvents(ctx context.Context, events []GeofenceEvent) error {
 	if len(events) == 0 {
 		return nil
 	}
 
-	return gm.db.Create(&events).Error
+	return gm.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range events {
+			query := tx
+			if events[i].DriverID == "" {
+				query = query.Omit("DriverID")
+			}
+			if err := query.Create(&events[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // saveGeofenceViolations saves geofence violations to database
-func (gm *GeofenceManager) saveGeofenceViolations(_ context.Context, violations []GeofenceViolation) error {
+func (gm *GeofenceManager) saveGeofenceViolations(ctx context.Context, violations []GeofenceViolation) error {
 	if len(violations) == 0 {
 		return nil
 	}
 
-	return gm.db.Create(&violations).Error
-}
-
-// updateVehicleGeofenceState updates the vehicle's geofence state
-func (gm *GeofenceManager) updateVehicleGeofenceState(_ context.Context, _ string, _ []GeofenceEvent) error {
-	// This would update the vehicle's current geofence state
-	// For now, just return nil as a placeholder
-	return nil
+	return gm.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range violations {
+			query := tx
+			if violations[i].DriverID == "" {
+				query = query.Omit("DriverID")
+			}
+			if err := query.Create(&violations[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 // Helper methods for analytics
@@ -0,0 +1,288 @@
+package geofencing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// depot is a 200 m circle around Monas, Jakarta
+func depot() Geofence {
+	return Geofence{
+		ID:              "depot",
+		CompanyID:       "company-1",
+		Name:            "Depot Monas",
+		Shape:           "circle",
+		CenterLatitude:  -6.175392,
+		CenterLongitude: 106.827153,
+		Radius:          200,
+		IsActive:        true,
+		Priority:        5,
+		AlertOnEnter:    true,
+		AlertOnExit:     true,
+	}
+}
+
+// checker evaluates fixes of one vehicle the way CheckGeofences does,
+// keeping the vehicle state in memory
+type checker struct {
+	t         *testing.T
+	manager   *GeofenceManager
+	geofences []Geofence
+}
+
+func newChecker(t *testing.T, geofences ...Geofence) *checker {
+	return &checker{t: t, manager: NewGeofenceManager(nil, nil), geofences: geofences}
+}
+
+func (c *checker) check(lat, lng, speed float64, at time.Time) *GeofenceCheckResult {
+	c.t.Helper()
+	ctx := context.Background()
+
+	req := &GeofenceCheckRequest{
+		VehicleID: "vehicle-1",
+		DriverID:  "driver-1",
+		CompanyID: "company-1",
+		Latitude:  lat,
+		Longitude: lng,
+		Speed:     speed,
+		Timestamp: at,
+	}
+
+	states, err := c.manager.getVehicleGeofenceStates(ctx, req.VehicleID)
+	require.NoError(c.t, err)
+	result, changed := c.manager.evaluateGeofences(req, c.geofences, states)
+	require.NoError(c.t, c.manager.updateVehicleGeofenceState(ctx, req.VehicleID, changed))
+	return result
+}
+
+func eventTypes(result *GeofenceCheckResult) []string {
+	types := []string{}
+	for _, event := range result.GeofenceEvents {
+		types = append(types, event.EventType)
+	}
+	return types
+}
+
+func violationTypes(result *GeofenceCheckResult) []string {
+	types := []string{}
+	for _, violation := range result.Violations {
+		types = append(types, violation.ViolationType)
+	}
+	return types
+}
+
+const (
+	insideLat, insideLng   = -6.175392, 106.827153
+	outsideLat, outsideLng = -6.185392, 106.827153
+)
+
+func TestEvaluateGeofences_EntryAndExit(t *testing.T) {
+	c := newChecker(t, depot())
+	start := time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)
+
+	assert.Empty(t, eventTypes(c.check(outsideLat, outsideLng, 30, start)))
+
+	result := c.check(insideLat, insideLng, 20, start.Add(time.Minute))
+	require.Equal(t, []string{"entry"}, eventTypes(result))
+	assert.Equal(t, "Depot Monas", result.GeofenceEvents[0].GeofenceName)
+	assert.Len(t, result.AlertsGenerated, 1)
+
+	// Staying inside does not repeat the entry
+	assert.Empty(t, eventTypes(c.check(insideLat, insideLng, 0, start.Add(2*time.Minute))))
+
+	result = c.check(outsideLat, outsideLng, 25, start.Add(21*time.Minute))
+	require.Equal(t, []string{"exit"}, eventTypes(result))
+	assert.Equal(t, 20*60, result.GeofenceEvents[0].Duration)
+
+	assert.Empty(t, eventTypes(c.check(outsideLat, outsideLng, 25, start.Add(22*time.Minute))))
+}
+
+func TestEvaluateGeofences_Dwell(t *testing.T) {
+	geofence := depot()
+	geofence.AlertOnDwell = true
+	geofence.DwellTime = 15
+	c := newChecker(t, geofence)
+	start := time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)
+
+	require.Equal(t, []string{"entry"}, eventTypes(c.check(insideLat, insideLng, 10, start)))
+	assert.Empty(t, eventTypes(c.check(insideLat, insideLng, 0, start.Add(14*time.Minute))))
+
+	result := c.check(insideLat, insideLng, 0, start.Add(15*time.Minute))
+	require.Equal(t, []string{"dwell"}, eventTypes(result))
+	assert.Equal(t, 15*60, result.GeofenceEvents[0].Duration)
+
+	// Dwell is reported once per visit
+	assert.Empty(t, eventTypes(c.check(insideLat, insideLng, 0, start.Add(30*time.Minute))))
+
+	c.check(outsideLat, outsideLng, 20, start.Add(31*time.Minute))
+	c.check(insideLat, insideLng, 10, start.Add(40*time.Minute))
+	assert.Equal(t, []string{"dwell"}, eventTypes(c.check(insideLat, insideLng, 0, start.Add(56*time.Minute))))
+}
+
+func TestEvaluateGeofences_SpeedViolation(t *testing.T) {
+	geofence := depot()
+	geofence.AlertOnSpeed = true
+	geofence.SpeedLimit = 20
+	c := newChecker(t, geofence)
+	start := time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)
+
+	// Speeding outside the geofence is not a geofence violation
+	assert.Empty(t, violationTypes(c.check(outsideLat, outsideLng, 60, start)))
+
+	result := c.check(insideLat, insideLng, 35, start.Add(time.Minute))
+	assert.Equal(t, []string{"entry", "speed_violation"}, eventTypes(result))
+	assert.Equal(t, []string{"speed_violation"}, violationTypes(result))
+
+	// Reported once until the vehicle slows down
+	assert.Empty(t, violationTypes(c.check(insideLat, insideLng, 40, start.Add(2*time.Minute))))
+	assert.Empty(t, violationTypes(c.check(insideLat, insideLng, 15, start.Add(3*time.Minute))))
+	assert.Equal(t, []string{"speed_violation"}, violationTypes(c.check(insideLat, insideLng, 30, start.Add(4*time.Minute))))
+}
+
+func TestEvaluateGeofences_Restrictions(t *testing.T) {
+	geofence := depot()
+	geofence.RestrictedVehicles = []string{"vehicle-1"}
+	geofence.TimeRestrictions = []TimeRestriction{{DayOfWeek: int(time.Monday), StartTime: "06:00", EndTime: "18:00", IsActive: true}}
+	c := newChecker(t, geofence)
+
+	// Monday 20:00, outside the allowed hours
+	night := time.Date(2025, 3, 3, 20, 0, 0, 0, time.UTC)
+	result := c.check(insideLat, insideLng, 10, night)
+	assert.Equal(t, []string{"entry"}, eventTypes(result))
+	assert.ElementsMatch(t, []string{"unauthorized_entry", "time_violation"}, violationTypes(result))
+
+	assert.Empty(t, violationTypes(c.check(insideLat, insideLng, 0, night.Add(time.Minute))))
+
+	result = c.check(outsideLat, outsideLng, 10, night.Add(10*time.Minute))
+	assert.Equal(t, []string{"unauthorized_exit"}, violationTypes(result))
+}
+
+func TestEvaluateGeofences_DeletedGeofence(t *testing.T) {
+	c := newChecker(t, depot())
+	start := time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)
+
+	c.check(insideLat, insideLng, 10, start)
+
+	// The geofence is deleted while the vehicle is inside: no exit is reported
+	// and the state is forgotten
+	c.geofences = nil
+	assert.Empty(t, eventTypes(c.check(outsideLat, outsideLng, 10, start.Add(time.Minute))))
+
+	states, err := c.manager.getVehicleGeofenceStates(context.Background(), "vehicle-1")
+	require.NoError(t, err)
+	assert.Empty(t, states)
+}
+
+func TestEvaluateGeofences_Polygon(t *testing.T) {
+	polygonData, err := PolygonDataFromCoordinates("polygon", []Coordinate{
+		{Latitude: -6.170, Longitude: 106.820},
+		{Latitude: -6.170, Longitude: 106.835},
+		{Latitude: -6.180, Longitude: 106.835},
+		{Latitude: -6.180, Longitude: 106.820},
+	})
+	require.NoError(t, err)
+
+	geofence := depot()
+	geofence.Shape = "polygon"
+	geofence.Radius = 0
+	geofence.PolygonData = polygonData
+	require.NoError(t, NewGeofenceManager(nil, nil).validateGeofence(&geofence))
+
+	c := newChecker(t, geofence)
+	start := time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, []string{"entry"}, eventTypes(c.check(insideLat, insideLng, 20, start)))
+	assert.Equal(t, []string{"exit"}, eventTypes(c.check(outsideLat, outsideLng, 20, start.Add(time.Minute))))
+}
+
+func TestSeedGeofenceStates_Restart(t *testing.T) {
+	warehouse := depot()
+	warehouse.ID = "warehouse"
+	warehouse.CenterLatitude = outsideLat
+	c := newChecker(t, depot(), warehouse)
+	ctx := context.Background()
+	parkedAt := time.Date(2025, 3, 3, 8, 0, 0, 0, time.UTC)
+
+	// After a restart the vehicle was last seen parked in the depot
+	req := &GeofenceCheckRequest{VehicleID: "vehicle-1", CompanyID: "company-1", Latitude: insideLat, Longitude: insideLng, Timestamp: parkedAt}
+	states, err := c.manager.getVehicleGeofenceStates(ctx, req.VehicleID)
+	require.NoError(t, err)
+	inside, changed := c.manager.seedGeofenceStates(req, c.geofences, states)
+	assert.Equal(t, []string{"depot"}, inside)
+	require.NoError(t, c.manager.updateVehicleGeofenceState(ctx, req.VehicleID, changed))
+
+	// Its next fix in the depot is not an entry, and leaving reports the
+	// time since it was last seen
+	assert.Empty(t, eventTypes(c.check(insideLat, insideLng, 0, parkedAt.Add(time.Minute))))
+	result := c.check(outsideLat, outsideLng, 20, parkedAt.Add(10*time.Minute))
+	assert.Equal(t, []string{"exit", "entry"}, eventTypes(result))
+	assert.Equal(t, 10*60, result.GeofenceEvents[0].Duration)
+
+	// Seeding again keeps the stored states
+	req.Latitude, req.Timestamp = outsideLat, parkedAt.Add(20*time.Minute)
+	states, err = c.manager.getVehicleGeofenceStates(ctx, req.VehicleID)
+	require.NoError(t, err)
+	inside, changed = c.manager.seedGeofenceStates(req, c.geofences, states)
+	assert.Equal(t, []string{"warehouse"}, inside)
+	assert.Empty(t, changed)
+}
+
+func TestPolygonDataFromCoordinates(t *testing.T) {
+	t.Run("polygon ring is closed", func(t *testing.T) {
+		data, err := PolygonDataFromCoordinates("polygon", []Coordinate{
+			{Latitude: 1, Longitude: 10}, {Latitude: 2, Longitude: 10}, {Latitude: 2, Longitude: 11},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "Polygon", data["type"])
+		ring := data["coordinates"].([]interface{})[0].([]interface{})
+		require.Len(t, ring, 4)
+		assert.Equal(t, []interface{}{10.0, 1.0}, ring[3])
+	})
+
+	t.Run("rectangle corners become a bbox", func(t *testing.T) {
+		data, err := PolygonDataFromCoordinates("rectangle", []Coordinate{
+			{Latitude: 2, Longitude: 11}, {Latitude: 1, Longitude: 10},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{10.0, 1.0, 11.0, 2.0}, data["bbox"])
+	})
+
+	t.Run("too few vertices", func(t *testing.T) {
+		_, err := PolygonDataFromCoordinates("polygon", []Coordinate{{Latitude: 1, Longitude: 10}})
+		assert.Error(t, err)
+	})
+}
+
+func TestValidateGeofence(t *testing.T) {
+	manager := NewGeofenceManager(nil, nil)
+
+	geofence := depot()
+	geofence.Priority = 0
+	geofence.PolygonData = map[string]interface{}{"bbox": []interface{}{1, 2, 3, 4}}
+	require.NoError(t, manager.validateGeofence(&geofence))
+	assert.Equal(t, 5, geofence.Priority)
+	assert.Nil(t, geofence.PolygonData, "circles do not keep polygon data")
+
+	tests := map[string]func(g *Geofence){
+		"missing radius":       func(g *Geofence) { g.Radius = 0 },
+		"priority too high":    func(g *Geofence) { g.Priority = 11 },
+		"dwell without time":   func(g *Geofence) { g.AlertOnDwell = true },
+		"polygon without data": func(g *Geofence) { g.Shape = "polygon" },
+		"shape sent as type":   func(g *Geofence) { g.Category = "polygon" },
+		"unknown purpose":      func(g *Geofence) { g.Category = "parking" },
+		"bad time window": func(g *Geofence) {
+			g.TimeRestrictions = []TimeRestriction{{DayOfWeek: 1, StartTime: "18:00", EndTime: "06:00", IsActive: true}}
+		},
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			geofence := depot()
+			mutate(&geofence)
+			assert.Error(t, manager.validateGeofence(&geofence))
+		})
+	}
+}
@@ -8,13 +8,21 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
 
+// Broadcaster publishes geofence events and violations to connected clients
+type Broadcaster interface {
+	BroadcastGeofenceViolationUpdate(ctx context.Context, vehicleID, driverID, geofenceID, geofenceName, violationType string, lat, lng float64) error
+}
+
 // GeofenceMonitor provides real-time geofence monitoring capabilities
 type GeofenceMonitor struct {
 	db              *gorm.DB
 	redis           *redis.Client
 	geofenceManager *GeofenceManager
+	broadcaster     Broadcaster
 	monitoring      map[string]*VehicleMonitor
 	mu              sync.RWMutex
 	stopChan        chan struct{}
@@ -31,6 +39,9 @@ type VehicleMonitor struct {
 	LastUpdate      time.Time              `json:"last_update"`
 	IsActive        bool                   `json:"is_active"`
 	StopChan        chan struct{}          `json:"-"`
+
+	// mu serializes geofence checks and guards the location and states
+	mu *sync.Mutex
 }
 
 // Location represents a geographical location
@@ -91,12 +102,23 @@ func (gm *GeofenceMonitor) StartMonitoring(ctx context.Context, config *Monitori
 		}
 	}
 
+	// Resume monitoring of active vehicles from their last known location
+	// (vehicles that fail to load are added on their next GPS fix)
+	if err := gm.registerActiveVehicles(ctx); err != nil {
+		fmt.Printf("Failed to register active vehicles for geofence monitoring: %v\n", err)
+	}
+
 	gm.wg.Add(1)
 	go gm.monitoringLoop(ctx, config)
 
 	return nil
 }
 
+// SetBroadcaster sets the broadcaster notified about geofence events and violations
+func (gm *GeofenceMonitor) SetBroadcaster(broadcaster Broadcaster) {
+	gm.broadcaster = broadcaster
+}
+
 // StopMonitoring stops the geofence monitoring service
 func (gm *GeofenceMonitor) StopMonitoring() {
 	close(gm.stopChan)
@@ -114,16 +136,7 @@ func (gm *GeofenceMonitor) AddVehicleToMonitoring(ctx context.Context, vehicleID
 	}
 
 	// Create vehicle monitor
-	monitor := &VehicleMonitor{
-		VehicleID:      vehicleID,
-		DriverID:       driverID,
-		CompanyID:      companyID,
-		GeofenceStates: make(map[string]bool),
-		LastUpdate:     time.Now(),
-		IsActive:       true,
-		StopChan:       make(chan struct{}),
-	}
-
+	monitor := newVehicleMonitor(vehicleID, driverID, companyID)
 	gm.monitoring[vehicleID] = monitor
 
 	// Cache the monitor
@@ -165,17 +178,69 @@ func (gm *GeofenceMonitor) UpdateVehicleLocation(ctx context.Context, vehicleID
 		return fmt.Errorf("vehicle %s is not being monitored", vehicleID)
 	}
 
-	// Update location
+	// Check geofences immediately
+	go gm.processLocation(ctx, monitor, "", location, true)
+
+	return nil
+}
+
+// TrackLocation checks a GPS fix against the company's geofences, adding the
+// vehicle to monitoring on its first fix. Fixes older than the vehicle's
+// current location are ignored so late deliveries do not replay entries.
+func (gm *GeofenceMonitor) TrackLocation(ctx context.Context, vehicleID, driverID, companyID string, location Location) error {
+	monitor := gm.trackedMonitor(ctx, vehicleID, driverID, companyID)
+	return gm.processLocation(ctx, monitor, driverID, location, true)
+}
+
+// ReplayLocations checks past GPS fixes of a vehicle, oldest first, so
+// entries, exits and violations between them are recorded. Nothing is sent
+// to clients for them; only a following TrackLocation call is live.
+func (gm *GeofenceMonitor) ReplayLocations(ctx context.Context, vehicleID, driverID, companyID string, locations []Location) error {
+	monitor := gm.trackedMonitor(ctx, vehicleID, driverID, companyID)
+	for _, location := range locations {
+		if err := gm.processLocation(ctx, monitor, driverID, location, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trackedMonitor returns a vehicle's monitor, adding the vehicle to
+// monitoring when it has none yet
+func (gm *GeofenceMonitor) trackedMonitor(ctx context.Context, vehicleID, driverID, companyID string) *VehicleMonitor {
+	gm.mu.Lock()
+	monitor, exists := gm.monitoring[vehicleID]
+	if !exists {
+		monitor = newVehicleMonitor(vehicleID, driverID, companyID)
+		gm.monitoring[vehicleID] = monitor
+	}
+	gm.mu.Unlock()
+
+	if !exists {
+		gm.cacheVehicleMonitor(ctx, monitor)
+	}
+	return monitor
+}
+
+// processLocation updates the monitor's location and checks its geofences.
+// Alerts and broadcasts are only sent for live locations.
+func (gm *GeofenceMonitor) processLocation(ctx context.Context, monitor *VehicleMonitor, driverID string, location Location, live bool) error {
+	monitor.mu.Lock()
+	if location.Timestamp.Before(monitor.CurrentLocation.Timestamp) {
+		monitor.mu.Unlock()
+		return nil
+	}
+	if driverID != "" {
+		monitor.DriverID = driverID
+	}
 	monitor.CurrentLocation = location
 	monitor.LastUpdate = time.Now()
+	monitor.mu.Unlock()
 
 	// Cache the updated monitor
 	gm.cacheVehicleMonitor(ctx, monitor)
 
-	// Check geofences immediately
-	go gm.checkVehicleGeofences(ctx, monitor, location)
-
-	return nil
+	return gm.checkVehicleGeofences(ctx, monitor, location, live)
 }
 
 // GetVehicleMonitoringStatus gets the monitoring status for a vehicle
@@ -199,7 +264,7 @@ func (gm *GeofenceMonitor) GetActiveVehicles(ctx context.Context, companyID stri
 	var activeVehicles []VehicleMonitor
 	for _, monitor := range gm.monitoring {
 		if monitor.CompanyID == companyID && monitor.IsActive {
-			activeVehicles = append(activeVehicles, *monitor)
+			activeVehicles = append(activeVehicles, monitor.snapshot())
 		}
 	}
 
@@ -241,19 +306,35 @@ func (gm *GeofenceMonitor) performMonitoringCheck(ctx context.Context, _ *Monito
 	}
 	gm.mu.RUnlock()
 
-	// Check each vehicle
+	// Check each vehicle that has reported a location. The last position is
+	// re-evaluated at the current time so dwell time keeps advancing for
+	// vehicles that stopped reporting while parked.
 	for _, monitor := range monitors {
 		select {
 		case <-monitor.StopChan:
 			continue
 		default:
-			gm.checkVehicleGeofences(ctx, monitor, monitor.CurrentLocation)
+			monitor.mu.Lock()
+			location := monitor.CurrentLocation
+			monitor.mu.Unlock()
+			if location.Timestamp.IsZero() {
+				continue
+			}
+			location.Timestamp = time.Now()
+
+			if err := gm.checkVehicleGeofences(ctx, monitor, location, true); err != nil {
+				fmt.Printf("Failed to check geofences for vehicle %s: %v\n", monitor.VehicleID, err)
+			}
 		}
 	}
 }
 
-// checkVehicleGeofences checks geofences for a specific vehicle
-func (gm *GeofenceMonitor) checkVehicleGeofences(ctx context.Context, monitor *VehicleMonitor, location Location) {
+// checkVehicleGeofences checks geofences for a specific vehicle. Events and
+// violations are always recorded; alerts are only raised when live.
+func (gm *GeofenceMonitor) checkVehicleGeofences(ctx context.Context, monitor *VehicleMonitor, location Location, live bool) error {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
 	// Create geofence check request
 	req := &GeofenceCheckRequest{
 		VehicleID:   monitor.VehicleID,
@@ -270,16 +351,21 @@ func (gm *GeofenceMonitor) checkVehicleGeofences(ctx context.Context, monitor *V
 	// Check geofences
 	result, err := gm.geofenceManager.CheckGeofences(ctx, req)
 	if err != nil {
-		return
+		return err
+	}
+
+	// Update geofence states
+	gm.updateGeofenceStates(monitor, result.GeofenceEvents)
+	if !live {
+		return nil
 	}
 
 	// Process events and violations
 	gm.processGeofenceEvents(ctx, monitor, result.GeofenceEvents)
 	gm.processGeofenceViolations(ctx, monitor, result.Violations)
-	gm.processAlerts(ctx, monitor, result.AlertsGenerated)
+	gm.processAlerts(ctx, monitor, location, result.AlertsGenerated)
 
-	// Update geofence states
-	gm.updateGeofenceStates(monitor, result.GeofenceEvents)
+	return nil
 }
 
 // processGeofenceEvents processes geofence events
@@ -313,6 +399,9 @@ func (gm *GeofenceMonitor) processGeofenceEvents(ctx context.Context, _ *Vehicle
 
 		// Cache the alert
 		gm.cacheGeofenceAlert(ctx, alert)
+
+		// Notify connected clients
+		gm.broadcast(ctx, event.VehicleID, event.DriverID, event.GeofenceID, event.GeofenceName, event.EventType, event.Latitude, event.Longitude)
 	}
 }
 
@@ -345,11 +434,14 @@ func (gm *GeofenceMonitor) processGeofenceViolations(ctx context.Context, _ *Veh
 
 		// Cache the alert
 		gm.cacheGeofenceAlert(ctx, alert)
+
+		// Notify connected clients
+		gm.broadcast(ctx, violation.VehicleID, violation.DriverID, violation.GeofenceID, violation.GeofenceName, violation.ViolationType, violation.Latitude, violation.Longitude)
 	}
 }
 
 // processAlerts processes generated alerts
-func (gm *GeofenceMonitor) processAlerts(ctx context.Context, monitor *VehicleMonitor, alerts []AlertInfo) {
+func (gm *GeofenceMonitor) processAlerts(ctx context.Context, monitor *VehicleMonitor, location Location, alerts []AlertInfo) {
 	for _, alertInfo := range alerts {
 		// Create real-time alert
 		alert := &GeofenceAlert{
@@ -360,7 +452,7 @@ func (gm *GeofenceMonitor) processAlerts(ctx context.Context, monitor *VehicleMo
 			AlertType: "system_alert",
 			Severity:  alertInfo.Severity,
 			Message:   alertInfo.Message,
-			Location:  monitor.CurrentLocation,
+			Location:  location,
 			Timestamp: time.Now(),
 			IsRead:    false,
 			IsResolved: false,
@@ -430,6 +522,116 @@ func (gm *GeofenceMonitor) sendRealTimeAlert(_ context.Context, alert *GeofenceA
 	fmt.Printf("Geofence Alert: %s - %s\n", alert.AlertType, alert.Message)
 }
 
+// broadcast sends a geofence event or violation to the company's clients
+func (gm *GeofenceMonitor) broadcast(ctx context.Context, vehicleID, driverID, geofenceID, geofenceName, eventType string, lat, lng float64) {
+	if gm.broadcaster == nil {
+		return
+	}
+	if err := gm.broadcaster.BroadcastGeofenceViolationUpdate(ctx, vehicleID, driverID, geofenceID, geofenceName, eventType, lat, lng); err != nil {
+		fmt.Printf("Failed to broadcast geofence %s for vehicle %s: %v\n", eventType, vehicleID, err)
+	}
+}
+
+// registerActiveVehicles adds active vehicles that are not monitored yet.
+// Vehicles resumed at their last known location start inside the geofences
+// containing it, so their next fix does not raise false entries.
+func (gm *GeofenceMonitor) registerActiveVehicles(ctx context.Context) error {
+	if gm.db == nil {
+		return nil
+	}
+
+	var vehicles []models.Vehicle
+	err := gm.db.WithContext(ctx).
+		Select("id", "company_id", "driver_id", "last_latitude", "last_longitude", "last_updated_at").
+		Where("is_active = ?", true).
+		Find(&vehicles).Error
+	if err != nil {
+		return err
+	}
+
+	// Monitors resumed at a location, seeded once the lock is released
+	restored := make(map[*VehicleMonitor]Location)
+	gm.mu.Lock()
+	for _, vehicle := range vehicles {
+		if _, exists := gm.monitoring[vehicle.ID]; exists {
+			continue
+		}
+
+		driverID := ""
+		if vehicle.DriverID != nil {
+			driverID = *vehicle.DriverID
+		}
+		monitor := newVehicleMonitor(vehicle.ID, driverID, vehicle.CompanyID)
+		if vehicle.LastUpdatedAt != nil {
+			monitor.CurrentLocation = Location{
+				Latitude:  vehicle.LastLatitude,
+				Longitude: vehicle.LastLongitude,
+				Timestamp: *vehicle.LastUpdatedAt,
+			}
+			restored[monitor] = monitor.CurrentLocation
+		}
+		gm.monitoring[vehicle.ID] = monitor
+	}
+	gm.mu.Unlock()
+
+	for monitor, location := range restored {
+		if err := gm.restoreGeofenceStates(ctx, monitor, location); err != nil {
+			fmt.Printf("Failed to restore geofence states of vehicle %s: %v\n", monitor.VehicleID, err)
+		}
+	}
+
+	return nil
+}
+
+// restoreGeofenceStates seeds a resumed monitor's geofence states from its
+// last known location. Checks of the monitor wait until it is done.
+func (gm *GeofenceMonitor) restoreGeofenceStates(ctx context.Context, monitor *VehicleMonitor, location Location) error {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	inside, err := gm.geofenceManager.RestoreGeofenceStates(ctx, &GeofenceCheckRequest{
+		VehicleID: monitor.VehicleID,
+		CompanyID: monitor.CompanyID,
+		Latitude:  location.Latitude,
+		Longitude: location.Longitude,
+		Timestamp: location.Timestamp,
+	})
+	if err != nil {
+		return err
+	}
+	for _, geofenceID := range inside {
+		monitor.GeofenceStates[geofenceID] = true
+	}
+	return nil
+}
+
+// newVehicleMonitor creates the monitoring state of a vehicle
+func newVehicleMonitor(vehicleID, driverID, companyID string) *VehicleMonitor {
+	return &VehicleMonitor{
+		VehicleID:      vehicleID,
+		DriverID:       driverID,
+		CompanyID:      companyID,
+		GeofenceStates: make(map[string]bool),
+		LastUpdate:     time.Now(),
+		IsActive:       true,
+		StopChan:       make(chan struct{}),
+		mu:             &sync.Mutex{},
+	}
+}
+
+// snapshot returns a copy of the monitor that is safe to read while checks run
+func (vm *VehicleMonitor) snapshot() VehicleMonitor {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	copied := *vm
+	copied.GeofenceStates = make(map[string]bool, len(vm.GeofenceStates))
+	for geofenceID, inside := range vm.GeofenceStates {
+		copied.GeofenceStates[geofenceID] = inside
+	}
+	return copied
+}
+
 // Cache methods
 func (gm *GeofenceMonitor) cacheVehicleMonitor(_ context.Context, _ *VehicleMonitor) error {
 	// Implementation would use Redis to cache vehicle monitor
@@ -489,6 +691,9 @@ func (gm *GeofenceMonitor) GetVehicleGeofenceStatus(ctx context.Context, vehicle
 		return nil, fmt.Errorf("vehicle %s is not being monitored", vehicleID)
 	}
 
+	snapshot := monitor.snapshot()
+	monitor = &snapshot
+
 	status := map[string]interface{}{
 		"vehicle_id":      monitor.VehicleID,
 		"driver_id":       monitor.DriverID,
@@ -58,9 +58,13 @@ type ScheduledJobRequest struct {
 	Name      string                 `json:"name" binding:"required"`
 	JobType   string                 `json:"job_type" binding:"required"`
 	Data      map[string]interface{} `json:"data"`
-	Schedule  string                 `json:"schedule" binding:"required"`
+	Schedule  string                 `json:"schedule" binding:"required"` // e.g. "0 7 * * MON-FRI", "@daily", "30m"
+	Timezone  string                 `json:"timezone"`                     // defaults to Asia/Jakarta
 	Priority  JobPriority            `json:"priority"`
 	IsActive  bool                   `json:"is_active"`
+
+	MisfirePolicy  MisfirePolicy `json:"misfire_policy" binding:"omitempty,oneof=skip catch_up"`
+	MaxCatchUpRuns int           `json:"max_catch_up_runs" binding:"omitempty,min=1,max=100"`
 }
 
 // EnqueueJobHandler handles job enqueue requests
@@ -221,6 +225,11 @@ func (ja *JobAPI) CreateScheduledJobHandler(c *gin.Context) {
 		return
 	}
 
+	if err := ValidateSchedule(req.Schedule, req.Timezone); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
 	// Get user and company information
 	userID, _ := c.Get("user_id")
 	companyID, _ := c.Get("company_id")
@@ -231,10 +240,14 @@ func (ja *JobAPI) CreateScheduledJobHandler(c *gin.Context) {
 		JobType:   req.JobType,
 		Data:      req.Data,
 		Schedule:  req.Schedule,
+		Timezone:  req.Timezone,
 		Priority:  req.Priority,
 		IsActive:  req.IsActive,
 		CompanyID: companyID.(string),
 		UserID:    userID.(string),
+
+		MisfirePolicy:  req.MisfirePolicy,
+		MaxCatchUpRuns: req.MaxCatchUpRuns,
 	}
 
 	err := ja.manager.UpdateScheduledJob(scheduledJob)
@@ -315,6 +328,32 @@ func (ja *JobAPI) UpdateScheduledJobHandler(c *gin.Context) {
 	if isActive, ok := updates["is_active"].(bool); ok {
 		existingJob.IsActive = isActive
 	}
+	if schedule, ok := updates["schedule"].(string); ok {
+		existingJob.Schedule = schedule
+	}
+	if timezone, ok := updates["timezone"].(string); ok {
+		existingJob.Timezone = timezone
+	}
+	if policy, ok := updates["misfire_policy"].(string); ok {
+		existingJob.MisfirePolicy = MisfirePolicy(policy)
+	}
+	if value, ok := updates["max_catch_up_runs"]; ok {
+		maxRuns, err := parseMaxCatchUpRuns(value)
+		if err != nil {
+			middleware.AbortWithBadRequest(c, err.Error())
+			return
+		}
+		existingJob.MaxCatchUpRuns = maxRuns
+	}
+	
+	if err := ValidateSchedule(existingJob.Schedule, existingJob.Timezone); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+	if err := validateMisfirePolicy(existingJob.MisfirePolicy); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
 	
 	err := ja.manager.UpdateScheduledJob(existingJob)
 	if err != nil {
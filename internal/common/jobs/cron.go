@@ -0,0 +1,292 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed cron expression.
+//
+// Both the standard 5-field form (minute hour day-of-month month day-of-week)
+// and the 6-field form with a leading seconds field are accepted. Each field
+// supports "*", "?", single values, ranges ("1-5"), steps ("*/15", "0-30/10",
+// "5/20") and comma separated lists of those. Months and days of week accept
+// three-letter English names (JAN-DEC, SUN-SAT) and day-of-week 7 is Sunday.
+// When both day-of-month and day-of-week are restricted a time matches if
+// either one matches, as in Vixie cron.
+type CronSchedule struct {
+	second     uint64
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+
+	// domRestricted and dowRestricted record whether the field was not "*"
+	domRestricted bool
+	dowRestricted bool
+}
+
+// cronField describes the bounds and aliases of a cron field
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronSecondField = cronField{name: "second", min: 0, max: 59}
+	cronMinuteField = cronField{name: "minute", min: 0, max: 59}
+	cronHourField   = cronField{name: "hour", min: 0, max: 23}
+	cronDomField    = cronField{name: "day-of-month", min: 1, max: 31}
+	cronMonthField  = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	cronDowField = cronField{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+)
+
+// cronDescriptors maps the predefined @-schedules to their cron expressions
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSearchLimit bounds the search for the next matching time so impossible
+// expressions such as "0 0 30 2 *" fail instead of looping forever
+const cronSearchLimit = 5
+
+// ParseCronSchedule parses a 5 or 6 field cron expression or an @-descriptor
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expression, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = expression
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron expression must have 5 or 6 fields, got %d: %q", len(fields), spec)
+	}
+
+	schedule := &CronSchedule{}
+	var err error
+
+	if schedule.second, err = parseCronField(fields[0], cronSecondField); err != nil {
+		return nil, err
+	}
+	if schedule.minute, err = parseCronField(fields[1], cronMinuteField); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[2], cronHourField); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfMonth, err = parseCronField(fields[3], cronDomField); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[4], cronMonthField); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfWeek, err = parseCronField(fields[5], cronDowField); err != nil {
+		return nil, err
+	}
+
+	// Day-of-week 7 is an alias for Sunday
+	if schedule.dayOfWeek&(1<<7) != 0 {
+		schedule.dayOfWeek = (schedule.dayOfWeek | 1) &^ (1 << 7)
+	}
+
+	schedule.domRestricted = !isCronWildcard(fields[3])
+	schedule.dowRestricted = !isCronWildcard(fields[5])
+
+	return schedule, nil
+}
+
+// isCronWildcard reports whether a field matches every value
+func isCronWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// parseCronField parses one comma separated field into a bitset
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		partBits, err := parseCronPart(part, spec)
+		if err != nil {
+			return 0, err
+		}
+		bits |= partBits
+	}
+	return bits, nil
+}
+
+// parseCronPart parses a single value, range or step expression
+func parseCronPart(part string, spec cronField) (uint64, error) {
+	if part == "" {
+		return 0, fmt.Errorf("empty %s value", spec.name)
+	}
+
+	rangePart, step := part, 1
+	if idx := strings.Index(part, "/"); idx >= 0 {
+		rangePart = part[:idx]
+		parsed, err := strconv.Atoi(part[idx+1:])
+		if err != nil || parsed <= 0 {
+			return 0, fmt.Errorf("invalid %s step in %q", spec.name, part)
+		}
+		step = parsed
+	}
+
+	start, end := spec.min, spec.max
+	switch {
+	case isCronWildcard(rangePart):
+		if spec.max == 7 {
+			// Day-of-week wildcards cover 0-6; 7 only exists as an alias
+			end = 6
+		}
+	case strings.Contains(rangePart, "-"):
+		bounds := strings.SplitN(rangePart, "-", 2)
+		var err error
+		if start, err = parseCronValue(bounds[0], spec); err != nil {
+			return 0, err
+		}
+		if end, err = parseCronValue(bounds[1], spec); err != nil {
+			return 0, err
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid %s range %q: start is after end", spec.name, rangePart)
+		}
+	default:
+		value, err := parseCronValue(rangePart, spec)
+		if err != nil {
+			return 0, err
+		}
+		start = value
+		// "5/20" means every 20 starting at 5; a bare value is just itself
+		if step == 1 {
+			end = value
+		}
+	}
+
+	var bits uint64
+	for value := start; value <= end; value += step {
+		bits |= 1 << uint(value)
+	}
+	return bits, nil
+}
+
+// parseCronValue parses a number or name and checks field bounds
+func parseCronValue(value string, spec cronField) (int, error) {
+	if number, ok := spec.names[strings.ToUpper(value)]; ok {
+		return number, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q", spec.name, value)
+	}
+	if number < spec.min || number > spec.max {
+		return 0, fmt.Errorf("%s value %d out of range %d-%d", spec.name, number, spec.min, spec.max)
+	}
+	return number, nil
+}
+
+// Next returns the first matching time strictly after the given time, in the
+// location of that time. It returns the zero time if nothing matches within
+// the next five years.
+func (cs *CronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Second).Add(time.Second)
+	limit := t.AddDate(cronSearchLimit, 0, 0)
+
+	for t.Before(limit) {
+		if cs.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !cs.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if cs.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if cs.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if cs.second&(1<<uint(t.Second())) == 0 {
+			t = t.Add(time.Second)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// matchesDay applies the day-of-month / day-of-week rules
+func (cs *CronSchedule) matchesDay(t time.Time) bool {
+	domMatch := cs.dayOfMonth&(1<<uint(t.Day())) != 0
+	dowMatch := cs.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if cs.domRestricted && cs.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+// Schedule computes the next run time of a scheduled job
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// intervalSchedule fires at a fixed interval after the previous run
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Next returns the time one interval after the given time
+func (is intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(is.interval)
+}
+
+// ParseSchedule parses a cron expression, an @-descriptor, "@every <duration>"
+// or a plain Go duration such as "30m"
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(strings.ToLower(spec), "@every ") {
+		return parseIntervalSchedule(strings.TrimSpace(spec[len("@every "):]))
+	}
+	if duration, err := time.ParseDuration(spec); err == nil {
+		return parseIntervalSchedule(duration.String())
+	}
+
+	return ParseCronSchedule(spec)
+}
+
+// parseIntervalSchedule parses a positive Go duration
+func parseIntervalSchedule(value string) (Schedule, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval %q: %w", value, err)
+	}
+	if duration < time.Second {
+		return nil, fmt.Errorf("interval must be at least 1s, got %s", duration)
+	}
+	return intervalSchedule{interval: duration}, nil
+}
@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{name: "five fields", spec: "0 7 * * MON-FRI", wantErr: false},
+		{name: "six fields with seconds", spec: "30 0 7 * * *", wantErr: false},
+		{name: "steps and lists", spec: "*/15 8-18/2 1,15 JAN,JUL *", wantErr: false},
+		{name: "question mark", spec: "0 0 ? * SUN", wantErr: false},
+		{name: "descriptor", spec: "@daily", wantErr: false},
+		{name: "too few fields", spec: "0 7 * *", wantErr: true},
+		{name: "too many fields", spec: "0 0 7 * * * *", wantErr: true},
+		{name: "minute out of range", spec: "60 * * * *", wantErr: true},
+		{name: "unknown day name", spec: "0 7 * * FUN", wantErr: true},
+		{name: "inverted range", spec: "0 7 * * FRI-MON", wantErr: true},
+		{name: "zero step", spec: "*/0 * * * *", wantErr: true},
+		{name: "empty list item", spec: "0,,30 * * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCronSchedule(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCronSchedule_Next(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		spec     string
+		after    time.Time
+		expected time.Time
+	}{
+		{
+			name:     "weekday morning skips the weekend",
+			spec:     "0 7 * * MON-FRI",
+			after:    time.Date(2025, 1, 3, 8, 0, 0, 0, jakarta), // Friday
+			expected: time.Date(2025, 1, 6, 7, 0, 0, 0, jakarta), // Monday
+		},
+		{
+			name:     "daily fires at local midnight",
+			spec:     "@daily",
+			after:    time.Date(2025, 1, 1, 23, 30, 0, 0, jakarta),
+			expected: time.Date(2025, 1, 2, 0, 0, 0, 0, jakarta),
+		},
+		{
+			name:     "minute step",
+			spec:     "*/15 * * * *",
+			after:    time.Date(2025, 1, 1, 10, 16, 0, 0, jakarta),
+			expected: time.Date(2025, 1, 1, 10, 30, 0, 0, jakarta),
+		},
+		{
+			name:     "strictly after the given time",
+			spec:     "*/15 * * * *",
+			after:    time.Date(2025, 1, 1, 10, 15, 0, 0, jakarta),
+			expected: time.Date(2025, 1, 1, 10, 30, 0, 0, jakarta),
+		},
+		{
+			name:     "seconds field",
+			spec:     "30 * * * * *",
+			after:    time.Date(2025, 1, 1, 10, 0, 45, 0, jakarta),
+			expected: time.Date(2025, 1, 1, 10, 1, 30, 0, jakarta),
+		},
+		{
+			name:     "month list rolls over the year",
+			spec:     "0 0 1 JAN,JUL *",
+			after:    time.Date(2025, 7, 1, 0, 0, 0, 0, jakarta),
+			expected: time.Date(2026, 1, 1, 0, 0, 0, 0, jakarta),
+		},
+		{
+			name:     "day of month or day of week",
+			spec:     "0 9 15 * MON",
+			after:    time.Date(2025, 1, 7, 0, 0, 0, 0, jakarta), // Tuesday
+			expected: time.Date(2025, 1, 13, 9, 0, 0, 0, jakarta),
+		},
+		{
+			name:     "sunday as seven",
+			spec:     "0 6 * * 7",
+			after:    time.Date(2025, 1, 1, 0, 0, 0, 0, jakarta), // Wednesday
+			expected: time.Date(2025, 1, 5, 6, 0, 0, 0, jakarta),
+		},
+		{
+			name:     "leap day",
+			spec:     "0 0 29 2 *",
+			after:    time.Date(2025, 1, 1, 0, 0, 0, 0, jakarta),
+			expected: time.Date(2028, 2, 29, 0, 0, 0, 0, jakarta),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseCronSchedule(tt.spec)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, schedule.Next(tt.after))
+		})
+	}
+}
+
+func TestCronSchedule_Next_NeverFires(t *testing.T) {
+	schedule, err := ParseCronSchedule("0 0 30 2 *")
+	require.NoError(t, err)
+
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestParseSchedule_Interval(t *testing.T) {
+	after := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	schedule, err := ParseSchedule("30m")
+	require.NoError(t, err)
+	assert.Equal(t, after.Add(30*time.Minute), schedule.Next(after))
+
+	schedule, err = ParseSchedule("@every 1h30m")
+	require.NoError(t, err)
+	assert.Equal(t, after.Add(90*time.Minute), schedule.Next(after))
+
+	_, err = ParseSchedule("@every 0s")
+	assert.Error(t, err)
+}
+
+func TestJobScheduler_CalculateNextRun_Timezone(t *testing.T) {
+	js := &JobScheduler{}
+	after := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC) // 19:00 WIB
+
+	nextRun, err := js.calculateNextRun(&ScheduledJob{Schedule: "@daily"}, after)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 1, 17, 0, 0, 0, time.UTC), nextRun.UTC(), "midnight WIB by default")
+
+	nextRun, err = js.calculateNextRun(&ScheduledJob{Schedule: "@daily", Timezone: "UTC"}, after)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), nextRun.UTC())
+
+	_, err = js.calculateNextRun(&ScheduledJob{Schedule: "@daily", Timezone: "Mars/Olympus"}, after)
+	assert.Error(t, err)
+}
+
+func TestJobScheduler_DueRuns_Misfire(t *testing.T) {
+	js := &JobScheduler{}
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+
+	nextRun := time.Date(2025, 1, 1, 7, 0, 0, 0, jakarta)
+	now := time.Date(2025, 1, 1, 10, 30, 0, 0, jakarta)
+
+	t.Run("on time", func(t *testing.T) {
+		job := &ScheduledJob{Schedule: "@hourly", NextRun: nextRun}
+		runs := js.dueRuns(job, nextRun.Add(time.Second))
+		assert.Equal(t, []time.Time{nextRun}, runs)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		job := &ScheduledJob{Schedule: "@hourly", NextRun: nextRun, MisfirePolicy: MisfirePolicySkip}
+		assert.Empty(t, js.dueRuns(job, now))
+	})
+
+	t.Run("catch up", func(t *testing.T) {
+		job := &ScheduledJob{Schedule: "@hourly", NextRun: nextRun, MisfirePolicy: MisfirePolicyCatchUp}
+		runs := js.dueRuns(job, now)
+		require.Len(t, runs, 4)
+		assert.True(t, runs[0].Equal(nextRun))
+		assert.True(t, runs[3].Equal(time.Date(2025, 1, 1, 10, 0, 0, 0, jakarta)))
+	})
+
+	t.Run("catch up keeps most recent runs", func(t *testing.T) {
+		job := &ScheduledJob{Schedule: "@hourly", NextRun: nextRun, MisfirePolicy: MisfirePolicyCatchUp, MaxCatchUpRuns: 2}
+		runs := js.dueRuns(job, now)
+		require.Len(t, runs, 2)
+		assert.True(t, runs[0].Equal(time.Date(2025, 1, 1, 9, 0, 0, 0, jakarta)))
+		assert.True(t, runs[1].Equal(time.Date(2025, 1, 1, 10, 0, 0, 0, jakarta)))
+	})
+}
+
+func TestParseMaxCatchUpRuns(t *testing.T) {
+	maxRuns, err := parseMaxCatchUpRuns(float64(25))
+	require.NoError(t, err)
+	assert.Equal(t, 25, maxRuns)
+
+	maxRuns, err = parseMaxCatchUpRuns(0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, maxRuns, "zero uses the default")
+
+	for _, value := range []interface{}{float64(MaxCatchUpRunsLimit + 1), -1, 2.5, "10"} {
+		_, err := parseMaxCatchUpRuns(value)
+		assert.Error(t, err, "%v", value)
+	}
+}
+
+func TestJobScheduler_UpdateScheduledJob_MaxCatchUpRuns(t *testing.T) {
+	job := &ScheduledJob{ID: "report", Schedule: "@daily", MisfirePolicy: MisfirePolicyCatchUp, MaxCatchUpRuns: 5}
+	js := &JobScheduler{scheduledJobs: map[string]*ScheduledJob{job.ID: job}}
+
+	err := js.UpdateScheduledJob(job.ID, map[string]interface{}{"max_catch_up_runs": float64(500)})
+	assert.Error(t, err)
+	assert.Equal(t, 5, job.MaxCatchUpRuns)
+
+	err = js.AddScheduledJob(&ScheduledJob{ID: "other", Schedule: "@daily", MaxCatchUpRuns: -3})
+	assert.Error(t, err)
+}
@@ -7,18 +7,21 @@ import (
 
 	"gorm.io/gorm"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/email"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/export"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/notification"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/reports"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
 
-// EmailNotificationJob handles email notification jobs
+// EmailNotificationJob delivers recorded emails
 type EmailNotificationJob struct {
-	db *gorm.DB
+	emailService *email.Service
 }
 
 // NewEmailNotificationJob creates a new email notification job handler
-func NewEmailNotificationJob(db *gorm.DB) *EmailNotificationJob {
-	return &EmailNotificationJob{db: db}
+func NewEmailNotificationJob(emailService *email.Service) *EmailNotificationJob {
+	return &EmailNotificationJob{emailService: emailService}
 }
 
 // GetJobType returns the job type
@@ -26,52 +29,83 @@ func (e *EmailNotificationJob) GetJobType() string {
 	return "email_notification"
 }
 
-// Handle processes email notification jobs
+// Handle processes email notification jobs. Jobs carry the ID of an email
+// recorded by the email service; jobs enqueued directly with a recipient,
+// subject and body record their email first.
 func (e *EmailNotificationJob) Handle(ctx context.Context, job *Job) error {
-	// Extract job data
-	to, ok := job.Data["to"].(string)
-	if !ok {
-		return fmt.Errorf("missing 'to' field in job data")
-	}
-
-	subject, ok := job.Data["subject"].(string)
-	if !ok {
-		return fmt.Errorf("missing 'subject' field in job data")
-	}
+	emailID, _ := job.Data["email_id"].(string)
+	if emailID == "" {
+		to, ok := job.Data["to"].(string)
+		if !ok {
+			return fmt.Errorf("missing 'email_id' or 'to' field in job data")
+		}
+		subject, ok := job.Data["subject"].(string)
+		if !ok {
+			return fmt.Errorf("missing 'subject' field in job data")
+		}
+		body, ok := job.Data["body"].(string)
+		if !ok {
+			return fmt.Errorf("missing 'body' field in job data")
+		}
+
+		message, err := e.emailService.Create(ctx, &email.Email{
+			CompanyID: job.CompanyID,
+			UserID:    job.UserID,
+			To:        to,
+			Subject:   subject,
+			Text:      body,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create email: %w", err)
+		}
+		emailID = message.ID
+		job.Data["email_id"] = emailID
+	}
+
+	return e.emailService.Deliver(ctx, emailID, job.RetryCount >= job.MaxRetries)
+}
 
-	body, ok := job.Data["body"].(string)
-	if !ok {
-		return fmt.Errorf("missing 'body' field in job data")
-	}
-	_ = body // Use the variable to avoid unused variable error
+// NotificationDeliveryJob delivers recorded WhatsApp and SMS notifications
+type NotificationDeliveryJob struct {
+	notificationService *notification.Service
+}
 
-	// Simulate email sending (replace with actual email service)
-	fmt.Printf("Sending email to %s: %s\n", to, subject)
-	time.Sleep(2 * time.Second) // Simulate email sending time
+// NewNotificationDeliveryJob creates a new notification delivery job handler
+func NewNotificationDeliveryJob(notificationService *notification.Service) *NotificationDeliveryJob {
+	return &NotificationDeliveryJob{notificationService: notificationService}
+}
 
-	// Log email notification
-	notification := models.AuditLog{
-		UserID:    job.UserID,
-		Action:    "email_notification_sent",
-		Details:   models.JSON{"to": to, "subject": subject},
-		IPAddress: "system",
-	}
+// GetJobType returns the job type
+func (n *NotificationDeliveryJob) GetJobType() string {
+	return "notification_delivery"
+}
 
-	if err := e.db.Create(&notification).Error; err != nil {
-		return fmt.Errorf("failed to log email notification: %w", err)
+// Handle delivers the notification recorded by the notification service
+func (n *NotificationDeliveryJob) Handle(ctx context.Context, job *Job) error {
+	notificationID, ok := job.Data["notification_id"].(string)
+	if !ok || notificationID == "" {
+		return fmt.Errorf("missing 'notification_id' field in job data")
 	}
 
-	return nil
+	return n.notificationService.Deliver(ctx, notificationID, job.RetryCount >= job.MaxRetries)
 }
 
-// ReportGenerationJob handles report generation jobs
+// reportGenerationTimeout bounds a single report; reports aggregate a whole
+// period of trips and events
+const reportGenerationTimeout = 30 * time.Minute
+
+// ReportGenerationJob generates requested reports into blob storage
 type ReportGenerationJob struct {
-	db *gorm.DB
+	db            *gorm.DB
+	reportService *reports.Service
 }
 
 // NewReportGenerationJob creates a new report generation job handler
-func NewReportGenerationJob(db *gorm.DB) *ReportGenerationJob {
-	return &ReportGenerationJob{db: db}
+func NewReportGenerationJob(db *gorm.DB, reportService *reports.Service) *ReportGenerationJob {
+	return &ReportGenerationJob{
+		db:            db,
+		reportService: reportService,
+	}
 }
 
 // GetJobType returns the job type
@@ -79,80 +113,59 @@ func (r *ReportGenerationJob) GetJobType() string {
 	return "report_generation"
 }
 
-// Handle processes report generation jobs
-func (r *ReportGenerationJob) Handle(ctx context.Context, job *Job) error {
-	// Extract job data
-	reportType, ok := job.Data["report_type"].(string)
-	if !ok {
-		return fmt.Errorf("missing 'report_type' field in job data")
-	}
-
-	startDate, ok := job.Data["start_date"].(string)
-	if !ok {
-		return fmt.Errorf("missing 'start_date' field in job data")
-	}
-
-	endDate, ok := job.Data["end_date"].(string)
-	if !ok {
-		return fmt.Errorf("missing 'end_date' field in job data")
-	}
+// JobTimeout returns how long a report may run
+func (r *ReportGenerationJob) JobTimeout() time.Duration {
+	return reportGenerationTimeout
+}
 
-	// Parse dates
-	start, err := time.Parse("2006-01-02", startDate)
+// Handle processes report generation jobs. Jobs carry the ID of a report
+// requested through the API; jobs enqueued directly with a report type
+// create their report first.
+func (r *ReportGenerationJob) Handle(ctx context.Context, job *Job) error {
+	reportID, _ := job.Data["report_id"].(string)
+	if reportID == "" {
+		reportType, ok := job.Data["report_type"].(string)
+		if !ok {
+			return fmt.Errorf("missing 'report_id' or 'report_type' field in job data")
+		}
+		format, _ := job.Data["format"].(string)
+		startDate, _ := job.Data["start_date"].(string)
+		endDate, _ := job.Data["end_date"].(string)
+
+		report, err := r.reportService.CreateReport(ctx, &reports.ReportRequest{
+			ReportType: reportType,
+			Format:     format,
+			StartDate:  startDate,
+			EndDate:    endDate,
+			CompanyID:  job.CompanyID,
+			UserID:     job.UserID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create report: %w", err)
+		}
+		reportID = report.ID
+		job.Data["report_id"] = reportID
+	}
+
+	report, err := r.reportService.RunReport(ctx, reportID)
 	if err != nil {
-		return fmt.Errorf("invalid start_date format: %w", err)
+		return fmt.Errorf("failed to generate report: %w", err)
 	}
 
-	end, err := time.Parse("2006-01-02", endDate)
-	if err != nil {
-		return fmt.Errorf("invalid end_date format: %w", err)
-	}
-
-	// Generate report based on type
-	switch reportType {
-	case "fleet_summary":
-		return r.generateFleetSummaryReport(ctx, job, start, end)
-	case "driver_performance":
-		return r.generateDriverPerformanceReport(ctx, job, start, end)
-	case "fuel_consumption":
-		return r.generateFuelConsumptionReport(ctx, job, start, end)
-	case "maintenance":
-		return r.generateMaintenanceReport(ctx, job, start, end)
-	default:
-		return fmt.Errorf("unknown report type: %s", reportType)
+	// Log the report for the user who owns it
+	if report.RequestedBy == nil {
+		return nil
 	}
-}
-
-// generateFleetSummaryReport generates a fleet summary report
-func (r *ReportGenerationJob) generateFleetSummaryReport(_ context.Context, job *Job, start, end time.Time) error {
-	// Simulate report generation
-	fmt.Printf("Generating fleet summary report for %s to %s\n", start.Format("2006-01-02"), end.Format("2006-01-02"))
-	time.Sleep(5 * time.Second) // Simulate report generation time
-
-	// Get fleet statistics
-	var totalVehicles int64
-	var activeVehicles int64
-	var totalTrips int64
-	var totalDistance float64
-
-	r.db.Model(&models.Vehicle{}).Where("company_id = ?", job.CompanyID).Count(&totalVehicles)
-	r.db.Model(&models.Vehicle{}).Where("company_id = ? AND status = ?", job.CompanyID, "active").Count(&activeVehicles)
-	
-	r.db.Model(&models.Trip{}).Where("company_id = ? AND start_time >= ? AND start_time <= ?", 
-		job.CompanyID, start, end).Count(&totalTrips)
-	
-	r.db.Model(&models.Trip{}).Where("company_id = ? AND start_time >= ? AND start_time <= ?", 
-		job.CompanyID, start, end).Select("COALESCE(SUM(total_distance), 0)").Scan(&totalDistance)
-
-	// Log report generation
 	notification := models.AuditLog{
-		UserID:    job.UserID,
-		Action:    "report_generated",
-		Details:   models.JSON{
-			"type": "fleet_summary", 
-			"vehicles": activeVehicles, 
-			"trips": totalTrips, 
-			"distance": totalDistance,
+		UserID:     *report.RequestedBy,
+		Action:     "report_generated",
+		Resource:   "report",
+		ResourceID: report.ID,
+		Details: models.JSON{
+			"type":      report.ReportType,
+			"format":    report.Format,
+			"row_count": report.RowCount,
+			"file_size": report.FileSize,
 		},
 		IPAddress: "system",
 	}
@@ -164,112 +177,47 @@ func (r *ReportGenerationJob) generateFleetSummaryReport(_ context.Context, job
 	return nil
 }
 
-// generateDriverPerformanceReport generates a driver performance report
-func (r *ReportGenerationJob) generateDriverPerformanceReport(_ context.Context, job *Job, start, end time.Time) error {
-	// Simulate report generation
-	fmt.Printf("Generating driver performance report for %s to %s\n", start.Format("2006-01-02"), end.Format("2006-01-02"))
-	time.Sleep(8 * time.Second) // Simulate report generation time
-
-	// Get driver performance statistics
-	var totalDrivers int64
-	var activeDrivers int64
-	var totalEvents int64
-
-	r.db.Model(&models.Driver{}).Where("company_id = ?", job.CompanyID).Count(&totalDrivers)
-	r.db.Model(&models.Driver{}).Where("company_id = ? AND status = ?", job.CompanyID, "active").Count(&activeDrivers)
-	
-	r.db.Model(&models.DriverEvent{}).Where("created_at >= ? AND created_at <= ?", start, end).Count(&totalEvents)
-
-	// Log report generation
-	notification := models.AuditLog{
-		UserID:    job.UserID,
-		Action:    "report_generated",
-		Details:   models.JSON{
-			"type": "driver_performance", 
-			"drivers": activeDrivers, 
-			"events": totalEvents,
-		},
-		IPAddress: "system",
-	}
-
-	if err := r.db.Create(&notification).Error; err != nil {
-		return fmt.Errorf("failed to log report generation: %w", err)
-	}
-
-	return nil
+// ReportSubscriptionJob queues the report of a report subscription's
+// scheduled run
+type ReportSubscriptionJob struct {
+	reportService *reports.Service
 }
 
-// generateFuelConsumptionReport generates a fuel consumption report
-func (r *ReportGenerationJob) generateFuelConsumptionReport(_ context.Context, job *Job, start, end time.Time) error {
-	// Simulate report generation
-	fmt.Printf("Generating fuel consumption report for %s to %s\n", start.Format("2006-01-02"), end.Format("2006-01-02"))
-	time.Sleep(6 * time.Second) // Simulate report generation time
-
-	// Get fuel consumption statistics
-	var totalFuelConsumed float64
-	var totalTrips int64
-
-	r.db.Model(&models.Trip{}).Where("company_id = ? AND start_time >= ? AND start_time <= ?", 
-		job.CompanyID, start, end).Select("COALESCE(SUM(fuel_consumed), 0)").Scan(&totalFuelConsumed)
-	
-	r.db.Model(&models.Trip{}).Where("company_id = ? AND start_time >= ? AND start_time <= ?", 
-		job.CompanyID, start, end).Count(&totalTrips)
-
-	// Log report generation
-	notification := models.AuditLog{
-		UserID:    job.UserID,
-		Action:    "report_generated",
-		Details:   models.JSON{
-			"type": "fuel_consumption", 
-			"fuel": totalFuelConsumed, 
-			"trips": totalTrips,
-		},
-		IPAddress: "system",
-	}
-
-	if err := r.db.Create(&notification).Error; err != nil {
-		return fmt.Errorf("failed to log report generation: %w", err)
-	}
-
-	return nil
+// NewReportSubscriptionJob creates a new report subscription job handler
+func NewReportSubscriptionJob(reportService *reports.Service) *ReportSubscriptionJob {
+	return &ReportSubscriptionJob{reportService: reportService}
 }
 
-// generateMaintenanceReport generates a maintenance report
-func (r *ReportGenerationJob) generateMaintenanceReport(_ context.Context, job *Job, start, end time.Time) error {
-	// Simulate report generation
-	fmt.Printf("Generating maintenance report for %s to %s\n", start.Format("2006-01-02"), end.Format("2006-01-02"))
-	time.Sleep(7 * time.Second) // Simulate report generation time
-
-	// Get maintenance statistics
-	var totalMaintenanceLogs int64
-	var pendingMaintenance int64
-
-	r.db.Model(&models.MaintenanceLog{}).Where("company_id = ? AND created_at >= ? AND created_at <= ?", 
-		job.CompanyID, start, end).Count(&totalMaintenanceLogs)
-	
-	r.db.Model(&models.MaintenanceLog{}).Where("company_id = ? AND status = ? AND created_at >= ? AND created_at <= ?", 
-		job.CompanyID, "pending", start, end).Count(&pendingMaintenance)
+// GetJobType returns the job type
+func (r *ReportSubscriptionJob) GetJobType() string {
+	return "report_subscription"
+}
 
-	// Log report generation
-	notification := models.AuditLog{
-		UserID:    job.UserID,
-		Action:    "report_generated",
-		Details:   models.JSON{
-			"type": "maintenance", 
-			"logs": totalMaintenanceLogs, 
-			"pending": pendingMaintenance,
-		},
-		IPAddress: "system",
+// Handle queues the report covering the period before the scheduled run
+func (r *ReportSubscriptionJob) Handle(ctx context.Context, job *Job) error {
+	subscriptionID, ok := job.Data["subscription_id"].(string)
+	if !ok {
+		return fmt.Errorf("missing 'subscription_id' field in job data")
 	}
 
-	if err := r.db.Create(&notification).Error; err != nil {
-		return fmt.Errorf("failed to log report generation: %w", err)
+	scheduledFor := time.Now()
+	if value, ok := job.Data["scheduled_for"].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+			scheduledFor = parsed
+		}
 	}
 
+	if _, err := r.reportService.RunSubscription(ctx, subscriptionID, scheduledFor); err != nil {
+		return fmt.Errorf("failed to run report subscription: %w", err)
+	}
 	return nil
 }
 
-// DataExportJob handles data export jobs
+// dataExportTimeout bounds a single export; large GPS exports run far
+// longer than the default job timeout
+const dataExportTimeout = 2 * time.Hour
+
+// DataExportJob streams a requested export into blob storage
 type DataExportJob struct {
 	db            *gorm.DB
 	exportService *export.ExportService
@@ -288,51 +236,60 @@ func (d *DataExportJob) GetJobType() string {
 	return "data_export"
 }
 
-// Handle processes data export jobs
-func (d *DataExportJob) Handle(ctx context.Context, job *Job) error {
-	// Extract job data
-	exportType, ok := job.Data["export_type"].(string)
-	if !ok {
-		return fmt.Errorf("missing 'export_type' field in job data")
-	}
-
-	format, ok := job.Data["format"].(string)
-	if !ok {
-		format = "csv" // Default format
-	}
-
-	// Extract filters
-	filters := make(map[string]interface{})
-	if filtersData, ok := job.Data["filters"].(map[string]interface{}); ok {
-		filters = filtersData
-	}
-
-	// Create export request
-	exportReq := &export.ExportRequest{
-		ExportType: exportType,
-		Format:     format,
-		Filters:    filters,
-		CompanyID:  job.CompanyID,
-		UserID:     job.UserID,
-	}
+// JobTimeout returns how long an export may run
+func (d *DataExportJob) JobTimeout() time.Duration {
+	return dataExportTimeout
+}
 
-	// Use the export service with caching
-	response, err := d.exportService.ExportData(ctx, exportReq)
+// Handle processes data export jobs. Jobs carry the ID of an export
+// requested through the API; jobs enqueued directly with an export type
+// create their export first.
+func (d *DataExportJob) Handle(ctx context.Context, job *Job) error {
+	exportID, _ := job.Data["export_id"].(string)
+	if exportID == "" {
+		exportType, ok := job.Data["export_type"].(string)
+		if !ok {
+			return fmt.Errorf("missing 'export_id' or 'export_type' field in job data")
+		}
+		format, ok := job.Data["format"].(string)
+		if !ok {
+			format = "csv" // Default format
+		}
+		filters, _ := job.Data["filters"].(map[string]interface{})
+
+		dataExport, err := d.exportService.CreateExport(ctx, &export.ExportRequest{
+			ExportType: exportType,
+			Format:     format,
+			Filters:    filters,
+			CompanyID:  job.CompanyID,
+			UserID:     job.UserID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create export: %w", err)
+		}
+		exportID = dataExport.ID
+		job.Data["export_id"] = exportID
+	}
+
+	dataExport, err := d.exportService.RunExport(ctx, exportID)
 	if err != nil {
 		return fmt.Errorf("failed to export data: %w", err)
 	}
 
-	// Log the export
+	// Log the export for the user who requested it
+	if dataExport.RequestedBy == nil {
+		return nil
+	}
 	notification := models.AuditLog{
-		UserID:    job.UserID,
-		Action:    "data_exported",
-		Details:   models.JSON{
-			"export_type": exportType,
-			"format": format,
-			"record_count": response.Metadata.RecordCount,
-			"file_size": response.Metadata.FileSize,
-			"from_cache": response.FromCache,
-			"cache_hit": response.CacheHit,
+		UserID:     *dataExport.RequestedBy,
+		Action:     "data_exported",
+		Resource:   "data_export",
+		ResourceID: dataExport.ID,
+		Details: models.JSON{
+			"export_type":  dataExport.ExportType,
+			"format":       dataExport.Format,
+			"record_count": dataExport.RecordCount,
+			"file_size":    dataExport.FileSize,
 		},
 		IPAddress: "system",
 	}
@@ -344,6 +301,32 @@ func (d *DataExportJob) Handle(ctx context.Context, job *Job) error {
 	return nil
 }
 
+// ExportCleanupJob deletes the files of expired exports from blob storage
+type ExportCleanupJob struct {
+	exportService *export.ExportService
+}
+
+// NewExportCleanupJob creates a new export cleanup job handler
+func NewExportCleanupJob(exportService *export.ExportService) *ExportCleanupJob {
+	return &ExportCleanupJob{exportService: exportService}
+}
+
+// GetJobType returns the job type
+func (e *ExportCleanupJob) GetJobType() string {
+	return "export_cleanup"
+}
+
+// Handle deletes expired export files
+func (e *ExportCleanupJob) Handle(ctx context.Context, _ *Job) error {
+	removed, err := e.exportService.CleanupExpiredExports(ctx)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		fmt.Printf("Deleted %d expired export files\n", removed)
+	}
+	return nil
+}
 
 // MaintenanceReminderJob handles maintenance reminder jobs
 type MaintenanceReminderJob struct {
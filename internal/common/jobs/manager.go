@@ -8,6 +8,8 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
 
 // Manager coordinates job queue, workers, and scheduler
@@ -100,11 +102,6 @@ func (m *Manager) RegisterHandler(handler JobHandler) {
 func (m *Manager) RegisterAllHandlers() {
 	log.Println("Registering job handlers...")
 
-	// Report generation jobs
-	reportHandler := NewReportGenerationJob(m.db)
-	m.RegisterHandler(reportHandler)
-	log.Printf("Registered handler: %s", reportHandler.GetJobType())
-
 	// Data cleanup jobs
 	cleanupHandler := NewDataCleanupJob(m.db)
 	m.RegisterHandler(cleanupHandler)
@@ -113,12 +110,14 @@ func (m *Manager) RegisterAllHandlers() {
 	log.Printf("Registered %d job handlers", len(m.handlers))
 }
 
-// SetupScheduledJobs sets up recurring scheduled jobs
+// SetupScheduledJobs sets up recurring scheduled jobs. The jobs use stable IDs
+// so restarts update the persisted jobs instead of adding duplicates.
 func (m *Manager) SetupScheduledJobs() error {
 	log.Println("Setting up scheduled jobs...")
 
 	// Daily analytics aggregation
 	err := m.scheduler.AddScheduledJob(&ScheduledJob{
+		ID:       "system_daily_analytics_aggregation",
 		Name:     "Daily Analytics Aggregation",
 		JobType:  "analytics_aggregation",
 		Schedule: "@daily",
@@ -134,6 +133,7 @@ func (m *Manager) SetupScheduledJobs() error {
 
 	// Monthly invoice generation
 	err = m.scheduler.AddScheduledJob(&ScheduledJob{
+		ID:       "system_monthly_invoice_generation",
 		Name:     "Monthly Invoice Generation",
 		JobType:  "invoice_generation",
 		Schedule: "@monthly",
@@ -149,6 +149,7 @@ func (m *Manager) SetupScheduledJobs() error {
 
 	// Weekly data cleanup
 	err = m.scheduler.AddScheduledJob(&ScheduledJob{
+		ID:       "system_weekly_data_cleanup",
 		Name:     "Weekly Data Cleanup",
 		JobType:  "data_cleanup",
 		Schedule: "@weekly",
@@ -163,24 +164,15 @@ func (m *Manager) SetupScheduledJobs() error {
 		return fmt.Errorf("failed to schedule weekly cleanup: %w", err)
 	}
 
-	// Daily report generation
-	err = m.scheduler.AddScheduledJob(&ScheduledJob{
-		Name:     "Daily Fleet Report",
-		JobType:  "report_generation",
-		Schedule: "@daily",
-		Data: map[string]interface{}{
-			"report_type": "fleet_summary",
-			"period": "daily",
-		},
-		Priority: JobPriorityNormal,
-		IsActive: true,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to schedule daily report: %w", err)
+	// Fleet reports are generated per company by report subscriptions; drop
+	// the company-less daily report persisted by earlier versions
+	if err := m.scheduler.RemoveScheduledJob("system_daily_fleet_report"); err != nil {
+		log.Printf("Failed to remove legacy daily fleet report job: %v", err)
 	}
 
 	// Hourly notification processing
 	err = m.scheduler.AddScheduledJob(&ScheduledJob{
+		ID:       "system_hourly_notification_processing",
 		Name:     "Hourly Notification Processing",
 		JobType:  "notification",
 		Schedule: "@hourly",
@@ -205,17 +197,18 @@ func (m *Manager) Start() error {
 	// Register all handlers
 	m.RegisterAllHandlers()
 
-	// Setup scheduled jobs
-	if err := m.SetupScheduledJobs(); err != nil {
-		return fmt.Errorf("failed to setup scheduled jobs: %w", err)
-	}
-
 	// Start worker
 	m.worker.Start()
 
-	// Start scheduler
+	// Start scheduler first so persisted run times are loaded before the
+	// default jobs are registered
 	m.scheduler.Start()
 
+	// Setup scheduled jobs
+	if err := m.SetupScheduledJobs(); err != nil {
+		return fmt.Errorf("failed to setup scheduled jobs: %w", err)
+	}
+
 	log.Println("Job manager started successfully")
 	return nil
 }
@@ -310,6 +303,11 @@ func (m *Manager) GetScheduledJobs() []*ScheduledJob {
 	return m.scheduler.GetScheduledJobs()
 }
 
+// AddScheduledJob adds a recurring job, replacing any job with the same ID
+func (m *Manager) AddScheduledJob(job *ScheduledJob) error {
+	return m.scheduler.AddScheduledJob(job)
+}
+
 // UpdateScheduledJob updates a scheduled job
 func (m *Manager) UpdateScheduledJob(job *ScheduledJob) error {
 	return m.scheduler.AddScheduledJob(job)
@@ -322,28 +320,105 @@ func (m *Manager) DeleteScheduledJob(jobID string) error {
 
 // Helper methods for specific job types
 
-// EnqueueReportGeneration enqueues a report generation job
-func (m *Manager) EnqueueReportGeneration(ctx context.Context, reportType string, companyID string, data map[string]interface{}) (*Job, error) {
+// EnqueueReport enqueues the job generating a requested report
+func (m *Manager) EnqueueReport(ctx context.Context, companyID, userID, reportID string) error {
 	job := &Job{
-		Type:      "report_generation",
-		CompanyID: companyID,
-		Priority:  JobPriorityNormal,
+		Type:       "report_generation",
+		CompanyID:  companyID,
+		UserID:     userID,
+		Priority:   JobPriorityNormal,
 		MaxRetries: 3,
 		Data: map[string]interface{}{
-			"report_type": reportType,
+			"report_id": reportID,
 		},
 	}
 
-	// Merge additional data
-	for k, v := range data {
-		job.Data[k] = v
+	return m.EnqueueJob(ctx, job)
+}
+
+// EnqueueEmail enqueues the job delivering a recorded email
+func (m *Manager) EnqueueEmail(ctx context.Context, userID, emailID string) error {
+	job := &Job{
+		Type:       "email_notification",
+		UserID:     userID,
+		Priority:   JobPriorityHigh,
+		MaxRetries: 5,
+		Data: map[string]interface{}{
+			"email_id": emailID,
+		},
 	}
 
-	if err := m.EnqueueJob(ctx, job); err != nil {
-		return nil, err
+	return m.EnqueueJob(ctx, job)
+}
+
+// EnqueueNotificationDelivery enqueues the job delivering a recorded
+// WhatsApp or SMS notification
+func (m *Manager) EnqueueNotificationDelivery(ctx context.Context, companyID, notificationID string) error {
+	job := &Job{
+		Type:       "notification_delivery",
+		CompanyID:  companyID,
+		Priority:   JobPriorityHigh,
+		MaxRetries: 5,
+		Data: map[string]interface{}{
+			"notification_id": notificationID,
+		},
 	}
 
-	return job, nil
+	return m.EnqueueJob(ctx, job)
+}
+
+// ValidateSchedule checks that a schedule and timezone can be used for a job
+func (m *Manager) ValidateSchedule(schedule, timezone string) error {
+	return ValidateSchedule(schedule, timezone)
+}
+
+// reportSubscriptionJobID returns the scheduled job ID of a report subscription
+func reportSubscriptionJobID(subscriptionID string) string {
+	return "report_subscription_" + subscriptionID
+}
+
+// ScheduleReportSubscription schedules the runs of a report subscription,
+// replacing its previous schedule. Paused subscriptions are unscheduled.
+func (m *Manager) ScheduleReportSubscription(subscription *models.ReportSubscription) error {
+	if !subscription.IsActive {
+		return m.UnscheduleReportSubscription(subscription.ID)
+	}
+
+	return m.scheduler.AddScheduledJob(&ScheduledJob{
+		ID:       reportSubscriptionJobID(subscription.ID),
+		Name:     subscription.Name,
+		JobType:  "report_subscription",
+		Schedule: subscription.Schedule,
+		Timezone: subscription.Timezone,
+		Data: map[string]interface{}{
+			"subscription_id": subscription.ID,
+		},
+		Priority:  JobPriorityNormal,
+		IsActive:  true,
+		CompanyID: subscription.CompanyID,
+		UserID:    subscription.UserID,
+	})
+}
+
+// UnscheduleReportSubscription stops the runs of a report subscription
+func (m *Manager) UnscheduleReportSubscription(subscriptionID string) error {
+	return m.scheduler.RemoveScheduledJob(reportSubscriptionJobID(subscriptionID))
+}
+
+// EnqueueDataExport enqueues the job writing a requested export to blob storage
+func (m *Manager) EnqueueDataExport(ctx context.Context, companyID, userID, exportID string) error {
+	job := &Job{
+		Type:       "data_export",
+		CompanyID:  companyID,
+		UserID:     userID,
+		Priority:   JobPriorityNormal,
+		MaxRetries: 2,
+		Data: map[string]interface{}{
+			"export_id": exportID,
+		},
+	}
+
+	return m.EnqueueJob(ctx, job)
 }
 
 // EnqueueInvoiceGeneration enqueues an invoice generation job
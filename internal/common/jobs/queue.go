@@ -56,6 +56,13 @@ type JobHandler interface {
 	GetJobType() string
 }
 
+// TimeoutJobHandler is implemented by handlers whose jobs need a different
+// time limit than the worker's job timeout
+type TimeoutJobHandler interface {
+	JobHandler
+	JobTimeout() time.Duration
+}
+
 // JobQueue provides job queue functionality
 type JobQueue struct {
 	redis         *redis.Client
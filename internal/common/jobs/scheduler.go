@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"sync"
 	"time"
 
@@ -17,17 +18,50 @@ type ScheduledJob struct {
 	Name        string                 `json:"name"`
 	JobType     string                 `json:"job_type"`
 	Data        map[string]interface{} `json:"data"`
-	Schedule    string                 `json:"schedule"`    // Cron-like schedule
+	Schedule    string                 `json:"schedule"`    // Cron expression, @-descriptor or duration
+	Timezone    string                 `json:"timezone"`    // IANA zone the schedule is evaluated in
 	Priority    JobPriority            `json:"priority"`
 	IsActive    bool                   `json:"is_active"`
 	LastRun     *time.Time             `json:"last_run,omitempty"`
 	NextRun     time.Time              `json:"next_run"`
 	CompanyID   string                 `json:"company_id,omitempty"`
 	UserID      string                 `json:"user_id,omitempty"`
+
+	// MisfirePolicy controls what happens to runs missed while the scheduler
+	// was down: "skip" drops them, "catch_up" enqueues up to MaxCatchUpRuns
+	// of the most recent missed runs
+	MisfirePolicy  MisfirePolicy `json:"misfire_policy"`
+	MaxCatchUpRuns int           `json:"max_catch_up_runs,omitempty"`
+
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
 }
 
+// MisfirePolicy defines how missed runs are handled
+type MisfirePolicy string
+
+const (
+	MisfirePolicySkip    MisfirePolicy = "skip"
+	MisfirePolicyCatchUp MisfirePolicy = "catch_up"
+)
+
+const (
+	// DefaultScheduleTimezone is used when a scheduled job has no timezone
+	DefaultScheduleTimezone = "Asia/Jakarta"
+
+	// DefaultMaxCatchUpRuns limits how many missed runs are replayed
+	DefaultMaxCatchUpRuns = 10
+
+	// MaxCatchUpRunsLimit is the highest MaxCatchUpRuns a job may set
+	MaxCatchUpRunsLimit = 100
+
+	// misfireThreshold is how late a run may start before it counts as missed
+	misfireThreshold = 1 * time.Minute
+
+	// maxMisfireScan bounds the number of missed occurrences examined
+	maxMisfireScan = 10000
+)
+
 // JobScheduler manages scheduled jobs
 type JobScheduler struct {
 	redis       *redis.Client
@@ -49,7 +83,7 @@ func NewJobScheduler(redis *redis.Client, queue *JobQueue) *JobScheduler {
 		scheduledJobs: make(map[string]*ScheduledJob),
 		ctx:           ctx,
 		cancel:        cancel,
-		ticker:        time.NewTicker(1 * time.Minute), // Check every minute
+		ticker:        time.NewTicker(1 * time.Second), // Check every second so seconds fields fire on time
 	}
 }
 
@@ -84,13 +118,34 @@ func (js *JobScheduler) AddScheduledJob(job *ScheduledJob) error {
 		job.CreatedAt = time.Now()
 	}
 	job.UpdatedAt = time.Now()
+	applyScheduleDefaults(job)
 	
-	// Calculate next run time
-	nextRun, err := js.calculateNextRun(job.Schedule)
-	if err != nil {
-		return fmt.Errorf("invalid schedule: %w", err)
+	if err := ValidateSchedule(job.Schedule, job.Timezone); err != nil {
+		return err
+	}
+	if err := validateMisfirePolicy(job.MisfirePolicy); err != nil {
+		return err
+	}
+	if err := validateMaxCatchUpRuns(job.MaxCatchUpRuns); err != nil {
+		return err
+	}
+	
+	// Keep the pending run of an existing job whose timing is unchanged, so
+	// restarts and edits do not push runs back or lose missed ones
+	existing, exists := js.scheduledJobs[job.ID]
+	if exists && existing.Schedule == job.Schedule && existing.Timezone == job.Timezone && !existing.NextRun.IsZero() {
+		job.NextRun = existing.NextRun
+		if job.LastRun == nil {
+			job.LastRun = existing.LastRun
+		}
+		job.CreatedAt = existing.CreatedAt
+	} else {
+		nextRun, err := js.calculateNextRun(job, time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid schedule: %w", err)
+		}
+		job.NextRun = nextRun
 	}
-	job.NextRun = nextRun
 	
 	// Store in memory
 	js.scheduledJobs[job.ID] = job
@@ -110,15 +165,43 @@ func (js *JobScheduler) UpdateScheduledJob(jobID string, updates map[string]inte
 	}
 	
 	// Update fields
-	if schedule, ok := updates["schedule"].(string); ok {
+	schedule, scheduleChanged := updates["schedule"].(string)
+	if !scheduleChanged {
+		schedule = job.Schedule
+	}
+	timezone, timezoneChanged := updates["timezone"].(string)
+	if !timezoneChanged {
+		timezone = job.Timezone
+	}
+	if scheduleChanged || timezoneChanged {
+		if err := ValidateSchedule(schedule, timezone); err != nil {
+			return err
+		}
 		job.Schedule = schedule
-		nextRun, err := js.calculateNextRun(schedule)
+		job.Timezone = timezone
+		applyScheduleDefaults(job)
+		nextRun, err := js.calculateNextRun(job, time.Now())
 		if err != nil {
 			return fmt.Errorf("invalid schedule: %w", err)
 		}
 		job.NextRun = nextRun
 	}
 	
+	if policy, ok := updates["misfire_policy"].(string); ok {
+		if err := validateMisfirePolicy(MisfirePolicy(policy)); err != nil {
+			return err
+		}
+		job.MisfirePolicy = MisfirePolicy(policy)
+	}
+	
+	if value, ok := updates["max_catch_up_runs"]; ok {
+		maxRuns, err := parseMaxCatchUpRuns(value)
+		if err != nil {
+			return err
+		}
+		job.MaxCatchUpRuns = maxRuns
+	}
+	
 	if isActive, ok := updates["is_active"].(bool); ok {
 		job.IsActive = isActive
 	}
@@ -198,7 +281,7 @@ func (js *JobScheduler) checkScheduledJobs() {
 	
 	var jobsToRun []*ScheduledJob
 	for _, job := range js.scheduledJobs {
-		if job.IsActive && job.NextRun.Before(now) {
+		if job.IsActive && !job.NextRun.After(now) {
 			jobsToRun = append(jobsToRun, job)
 		}
 	}
@@ -206,73 +289,203 @@ func (js *JobScheduler) checkScheduledJobs() {
 	
 	// Execute jobs that are due
 	for _, job := range jobsToRun {
-		js.executeScheduledJob(job)
+		js.executeScheduledJob(job, now)
 	}
 }
 
-// executeScheduledJob executes a scheduled job
-func (js *JobScheduler) executeScheduledJob(scheduledJob *ScheduledJob) {
-	log.Printf("Executing scheduled job: %s", scheduledJob.Name)
-	
-	// Create a regular job from the scheduled job
-	job := &Job{
-		Type:      scheduledJob.JobType,
-		Data:      scheduledJob.Data,
-		Priority:  scheduledJob.Priority,
-		CompanyID: scheduledJob.CompanyID,
-		UserID:    scheduledJob.UserID,
-		Tags:      []string{"scheduled", scheduledJob.ID},
-	}
-	
-	// Enqueue the job
-	err := js.queue.Enqueue(js.ctx, job)
-	if err != nil {
-		log.Printf("Failed to enqueue scheduled job %s: %v", scheduledJob.Name, err)
-		return
-	}
-	
-	// Update scheduled job
+// executeScheduledJob enqueues the due runs of a scheduled job and advances
+// its next run time
+func (js *JobScheduler) executeScheduledJob(scheduledJob *ScheduledJob, now time.Time) {
 	js.mutex.Lock()
-	now := time.Now()
-	scheduledJob.LastRun = &now
+	runs := js.dueRuns(scheduledJob, now)
 	
 	// Calculate next run time
-	nextRun, err := js.calculateNextRun(scheduledJob.Schedule)
+	nextRun, err := js.calculateNextRun(scheduledJob, now)
 	if err != nil {
 		log.Printf("Failed to calculate next run for job %s: %v", scheduledJob.Name, err)
 		scheduledJob.IsActive = false
 	} else {
 		scheduledJob.NextRun = nextRun
 	}
-	
 	scheduledJob.UpdatedAt = now
 	js.mutex.Unlock()
 	
+	enqueued := 0
+	for _, runAt := range runs {
+		log.Printf("Executing scheduled job: %s (scheduled for %s)", scheduledJob.Name, runAt.Format(time.RFC3339))
+		
+		// Create a regular job from the scheduled job
+		job := &Job{
+			Type:      scheduledJob.JobType,
+			Data:      scheduledRunData(scheduledJob, runAt, now),
+			Priority:  scheduledJob.Priority,
+			CompanyID: scheduledJob.CompanyID,
+			UserID:    scheduledJob.UserID,
+			Tags:      []string{"scheduled", scheduledJob.ID},
+		}
+		
+		// Enqueue the job
+		if err := js.queue.Enqueue(js.ctx, job); err != nil {
+			log.Printf("Failed to enqueue scheduled job %s: %v", scheduledJob.Name, err)
+			continue
+		}
+		enqueued++
+	}
+	
+	js.mutex.Lock()
+	if enqueued > 0 {
+		scheduledJob.LastRun = &now
+	}
+	js.mutex.Unlock()
+	
 	// Save updated job
 	js.saveScheduledJob(scheduledJob)
 }
 
-// calculateNextRun calculates the next run time based on schedule
-func (js *JobScheduler) calculateNextRun(schedule string) (time.Time, error) {
-	now := time.Now()
+// dueRuns returns the scheduled times that should be enqueued now. A run that
+// is later than misfireThreshold counts as missed and is handled according to
+// the job's misfire policy.
+func (js *JobScheduler) dueRuns(job *ScheduledJob, now time.Time) []time.Time {
+	if now.Sub(job.NextRun) <= misfireThreshold {
+		return []time.Time{job.NextRun}
+	}
+	
+	schedule, loc, err := parseJobSchedule(job)
+	if err != nil {
+		return nil
+	}
+	
+	// Collect the missed occurrences, keeping only the most recent ones
+	limit := job.MaxCatchUpRuns
+	if limit <= 0 {
+		limit = DefaultMaxCatchUpRuns
+	}
+	var missed []time.Time
+	total := 0
+	for runAt := job.NextRun; !runAt.IsZero() && !runAt.After(now) && total < maxMisfireScan; runAt = schedule.Next(runAt.In(loc)) {
+		missed = append(missed, runAt)
+		if len(missed) > limit {
+			missed = missed[1:]
+		}
+		total++
+	}
+	
+	if job.MisfirePolicy != MisfirePolicyCatchUp {
+		log.Printf("Scheduled job %s missed %d run(s) since %s, skipping", job.Name, total, job.NextRun.Format(time.RFC3339))
+		return nil
+	}
 	
-	// Simple schedule parsing (can be extended for more complex cron expressions)
-	switch schedule {
-	case "@hourly":
-		return now.Add(1 * time.Hour).Truncate(time.Hour), nil
-	case "@daily":
-		return now.Add(24 * time.Hour).Truncate(24 * time.Hour), nil
-	case "@weekly":
-		return now.Add(7 * 24 * time.Hour).Truncate(24 * time.Hour), nil
-	case "@monthly":
-		return now.AddDate(0, 1, 0).Truncate(24 * time.Hour), nil
+	log.Printf("Scheduled job %s missed %d run(s) since %s, catching up %d", job.Name, total, job.NextRun.Format(time.RFC3339), len(missed))
+	return missed
+}
+
+// scheduledRunData copies the job data and records when the run was due
+func scheduledRunData(job *ScheduledJob, runAt, now time.Time) map[string]interface{} {
+	data := make(map[string]interface{}, len(job.Data)+2)
+	for key, value := range job.Data {
+		data[key] = value
+	}
+	data["scheduled_for"] = runAt.Format(time.RFC3339)
+	if now.Sub(runAt) > misfireThreshold {
+		data["catch_up"] = true
+	}
+	return data
+}
+
+// calculateNextRun calculates the first run time after the given time in the
+// job's timezone
+func (js *JobScheduler) calculateNextRun(job *ScheduledJob, after time.Time) (time.Time, error) {
+	schedule, loc, err := parseJobSchedule(job)
+	if err != nil {
+		return time.Time{}, err
+	}
+	
+	nextRun := schedule.Next(after.In(loc))
+	if nextRun.IsZero() {
+		return time.Time{}, fmt.Errorf("schedule %q has no upcoming run", job.Schedule)
+	}
+	return nextRun, nil
+}
+
+// parseJobSchedule parses the job's schedule and timezone
+func parseJobSchedule(job *ScheduledJob) (Schedule, *time.Location, error) {
+	timezone := job.Timezone
+	if timezone == "" {
+		timezone = DefaultScheduleTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+	}
+	
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid schedule format: %w", err)
+	}
+	return schedule, loc, nil
+}
+
+// ValidateSchedule checks that a schedule and timezone can be used for a job
+func ValidateSchedule(schedule, timezone string) error {
+	job := &ScheduledJob{Schedule: schedule, Timezone: timezone}
+	s, loc, err := parseJobSchedule(job)
+	if err != nil {
+		return err
+	}
+	if s.Next(time.Now().In(loc)).IsZero() {
+		return fmt.Errorf("schedule %q has no upcoming run", schedule)
+	}
+	return nil
+}
+
+// validateMisfirePolicy checks that the misfire policy is known
+func validateMisfirePolicy(policy MisfirePolicy) error {
+	switch policy {
+	case "", MisfirePolicySkip, MisfirePolicyCatchUp:
+		return nil
 	default:
-		// Try to parse as duration (e.g., "1h", "30m", "1d")
-		duration, err := time.ParseDuration(schedule)
-		if err != nil {
-			return time.Time{}, fmt.Errorf("invalid schedule format: %s", schedule)
+		return fmt.Errorf("invalid misfire policy %q: must be %q or %q", policy, MisfirePolicySkip, MisfirePolicyCatchUp)
+	}
+}
+
+// validateMaxCatchUpRuns checks the catch-up bound; zero uses
+// DefaultMaxCatchUpRuns
+func validateMaxCatchUpRuns(maxRuns int) error {
+	if maxRuns < 0 || maxRuns > MaxCatchUpRunsLimit {
+		return fmt.Errorf("invalid max catch-up runs %d: must be between 1 and %d, or 0 for the default of %d",
+			maxRuns, MaxCatchUpRunsLimit, DefaultMaxCatchUpRuns)
+	}
+	return nil
+}
+
+// parseMaxCatchUpRuns reads a catch-up bound from an update, where JSON
+// numbers arrive as float64
+func parseMaxCatchUpRuns(value interface{}) (int, error) {
+	var maxRuns int
+	switch v := value.(type) {
+	case int:
+		maxRuns = v
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("invalid max catch-up runs %v: must be a whole number", v)
 		}
-		return now.Add(duration), nil
+		maxRuns = int(v)
+	default:
+		return 0, fmt.Errorf("invalid max catch-up runs %v: must be a number", value)
+	}
+	if err := validateMaxCatchUpRuns(maxRuns); err != nil {
+		return 0, err
+	}
+	return maxRuns, nil
+}
+
+// applyScheduleDefaults fills in the timezone and misfire policy
+func applyScheduleDefaults(job *ScheduledJob) {
+	if job.Timezone == "" {
+		job.Timezone = DefaultScheduleTimezone
+	}
+	if job.MisfirePolicy == "" {
+		job.MisfirePolicy = MisfirePolicySkip
 	}
 }
 
@@ -294,6 +507,7 @@ func (js *JobScheduler) loadScheduledJobs() {
 		if err := json.Unmarshal([]byte(data), &job); err != nil {
 			continue
 		}
+		applyScheduleDefaults(&job)
 		
 		js.scheduledJobs[job.ID] = &job
 	}
@@ -316,6 +530,7 @@ func (js *JobScheduler) saveScheduledJob(job *ScheduledJob) error {
 func (js *JobScheduler) InitializeDefaultScheduledJobs() {
 	// Daily data cleanup job
 	cleanupJob := &ScheduledJob{
+		ID:        "system_daily_data_cleanup",
 		Name:      "Daily Data Cleanup",
 		JobType:   "data_cleanup",
 		Schedule:  "@daily",
@@ -332,6 +547,7 @@ func (js *JobScheduler) InitializeDefaultScheduledJobs() {
 	
 	// Weekly maintenance reminder job
 	maintenanceJob := &ScheduledJob{
+		ID:        "system_weekly_maintenance_check",
 		Name:      "Weekly Maintenance Check",
 		JobType:   "maintenance_reminder",
 		Schedule:  "@weekly",
@@ -345,22 +561,12 @@ func (js *JobScheduler) InitializeDefaultScheduledJobs() {
 	}
 	js.AddScheduledJob(maintenanceJob)
 	
-	// Monthly report generation job
-	reportJob := &ScheduledJob{
-		Name:      "Monthly Fleet Report",
-		JobType:   "report_generation",
-		Schedule:  "@monthly",
-		Priority:  JobPriorityNormal,
-		IsActive:  true,
-		Data: map[string]interface{}{
-			"report_type": "fleet_summary",
-			"start_date":  time.Now().AddDate(0, -1, 0).Format("2006-01-02"),
-			"end_date":    time.Now().Format("2006-01-02"),
-		},
-		CompanyID: "system",
-		UserID:    "system",
+	// Fleet reports belong to a company and are scheduled as report
+	// subscriptions. Earlier versions saved a system-wide monthly report
+	// job, which has no report to generate any more.
+	if err := js.RemoveScheduledJob("system_monthly_fleet_report"); err != nil {
+		log.Printf("Failed to remove retired scheduled job system_monthly_fleet_report: %v", err)
 	}
-	js.AddScheduledJob(reportJob)
 	
 	log.Println("Initialized default scheduled jobs")
 }
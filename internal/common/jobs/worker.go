@@ -145,19 +145,23 @@ func (w *Worker) processJob(workerID int, job *Job) {
 	startTime := time.Now()
 	log.Printf("Worker %d: Processing job %s of type %s", workerID, job.ID, job.Type)
 
-	// Create job context with timeout
-	jobCtx, cancel := context.WithTimeout(w.ctx, w.config.JobTimeout)
-	defer cancel()
-
 	// Get handler for job type
 	handler, exists := w.handlers[job.Type]
 	if !exists {
 		log.Printf("Worker %d: No handler found for job type %s", workerID, job.Type)
-		w.queue.Fail(jobCtx, job.ID, fmt.Sprintf("No handler found for job type: %s", job.Type))
+		w.queue.Fail(w.ctx, job.ID, fmt.Sprintf("No handler found for job type: %s", job.Type))
 		w.updateMetrics(false, false, startTime)
 		return
 	}
 
+	// Create job context with timeout
+	timeout := w.config.JobTimeout
+	if limited, ok := handler.(TimeoutJobHandler); ok {
+		timeout = limited.JobTimeout()
+	}
+	jobCtx, cancel := context.WithTimeout(w.ctx, timeout)
+	defer cancel()
+
 	// Process the job
 	err := handler.Handle(jobCtx, job)
 	processingTime := time.Since(startTime)
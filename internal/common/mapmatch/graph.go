@@ -0,0 +1,411 @@
+// Package mapmatch snaps GPS tracks to an offline road network.
+//
+// The road network is loaded from an OpenStreetMap extract pre-processed to
+// GeoJSON, for example with osmium:
+//
+//	osmium tags-filter indonesia-latest.osm.pbf w/highway -o roads.osm.pbf
+//	osmium export roads.osm.pbf -f geojsonseq -o roads.geojsonseq
+//
+// Both GeoJSON feature collections and GeoJSON text sequences (one feature
+// per line) are accepted. Each way's highway, maxspeed, oneway, junction and
+// name tags describe the road; ways sharing a node are connected.
+package mapmatch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// earthRadius is the mean Earth radius in meters
+	earthRadius = 6371000
+
+	// metersPerDegree is the length of a degree of latitude in meters
+	metersPerDegree = earthRadius * math.Pi / 180
+
+	// gridCellSize is the size in degrees of the spatial index cells,
+	// about 550 m at the equator
+	gridCellSize = 0.005
+
+	// coordinatePrecision rounds coordinates when joining ways into a
+	// network, about 1 cm
+	coordinatePrecision = 1e7
+)
+
+// DefaultSpeedLimits are the speed limits in km/h of roads without a usable
+// maxspeed tag, by OSM highway class, following the Indonesian limits for
+// toll roads, rural and urban roads and residential areas
+var DefaultSpeedLimits = map[string]int{
+	"motorway":      100,
+	"trunk":         80,
+	"primary":       80,
+	"secondary":     60,
+	"tertiary":      50,
+	"unclassified":  50,
+	"road":          50,
+	"residential":   30,
+	"living_street": 20,
+	"service":       20,
+	"track":         20,
+}
+
+// zoneSpeedLimits are the speed limits of the maxspeed zone values in km/h
+var zoneSpeedLimits = map[string]int{
+	"ID:motorway":      100,
+	"ID:rural":         80,
+	"ID:urban":         50,
+	"ID:living_street": 20,
+	"walk":             10,
+}
+
+// Coordinate is a WGS84 position in degrees
+type Coordinate struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Road describes the road an edge belongs to
+type Road struct {
+	Class      string `json:"road_class"` // OSM highway class, e.g. primary
+	Name       string `json:"road_name"`
+	SpeedLimit int    `json:"speed_limit"` // km/h
+}
+
+// edge is a directed straight stretch of road between two nodes
+type edge struct {
+	from, to int32
+	road     int32
+	length   float64 // meters
+}
+
+// cell identifies a spatial index cell
+type cell struct {
+	x, y int32
+}
+
+// Graph is a directed road network with a spatial index over its edges.
+// A Graph is immutable once loaded and safe for concurrent use.
+type Graph struct {
+	nodes []Coordinate
+	edges []edge
+	roads []Road
+	out   [][]int32 // outgoing edges per node
+	grid  map[cell][]int32
+}
+
+// LoadGraph loads a road network from a GeoJSON file
+func LoadGraph(path string) (*Graph, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open road network: %w", err)
+	}
+	defer file.Close()
+
+	graph, err := ReadGraph(bufio.NewReaderSize(file, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read road network %s: %w", path, err)
+	}
+	return graph, nil
+}
+
+// geoJSON is a GeoJSON feature collection or feature
+type geoJSON struct {
+	Type       string           `json:"type"`
+	Features   []geoJSON        `json:"features"`
+	Geometry   *geoJSONGeometry `json:"geometry"`
+	Properties map[string]any   `json:"properties"`
+}
+
+// geoJSONGeometry is a GeoJSON geometry; only line strings are used
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// ReadGraph reads a road network from GeoJSON. Features other than line
+// strings tagged as roads for motor vehicles are skipped.
+func ReadGraph(r io.Reader) (*Graph, error) {
+	builder := newGraphBuilder()
+
+	// GeoJSON text sequences start every record with a record separator
+	decoder := json.NewDecoder(&recordSeparatorReader{r: r})
+	for {
+		var object geoJSON
+		err := decoder.Decode(&object)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		features := object.Features
+		if object.Type == "Feature" {
+			features = []geoJSON{object}
+		}
+		for i := range features {
+			if err := builder.addFeature(&features[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(builder.graph.edges) == 0 {
+		return nil, errors.New("no roads found")
+	}
+	return builder.graph, nil
+}
+
+// recordSeparatorReader replaces the RS characters of GeoJSON text
+// sequences with spaces
+type recordSeparatorReader struct {
+	r io.Reader
+}
+
+func (rs *recordSeparatorReader) Read(p []byte) (int, error) {
+	n, err := rs.r.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == 0x1e {
+			p[i] = ' '
+		}
+	}
+	return n, err
+}
+
+// graphBuilder joins ways into a graph by their shared coordinates
+type graphBuilder struct {
+	graph *Graph
+	index map[[2]int64]int32
+}
+
+func newGraphBuilder() *graphBuilder {
+	return &graphBuilder{
+		graph: &Graph{grid: make(map[cell][]int32)},
+		index: make(map[[2]int64]int32),
+	}
+}
+
+// addFeature adds the edges of a road feature
+func (b *graphBuilder) addFeature(feature *geoJSON) error {
+	if feature.Geometry == nil {
+		return nil
+	}
+	class, _ := feature.Properties["highway"].(string)
+	if _, ok := DefaultSpeedLimits[strings.TrimSuffix(class, "_link")]; !ok {
+		return nil
+	}
+
+	var lines [][][]float64
+	switch feature.Geometry.Type {
+	case "LineString":
+		var line [][]float64
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &line); err != nil {
+			return fmt.Errorf("invalid line string: %w", err)
+		}
+		lines = [][][]float64{line}
+	case "MultiLineString":
+		if err := json.Unmarshal(feature.Geometry.Coordinates, &lines); err != nil {
+			return fmt.Errorf("invalid multi line string: %w", err)
+		}
+	default:
+		return nil
+	}
+
+	tag := func(key string) string {
+		value, _ := feature.Properties[key].(string)
+		return value
+	}
+	road := Road{
+		Class:      class,
+		Name:       tag("name"),
+		SpeedLimit: parseMaxSpeed(tag("maxspeed"), class),
+	}
+	forward, backward := roadDirections(class, tag("oneway"), tag("junction"))
+
+	b.graph.roads = append(b.graph.roads, road)
+	roadID := int32(len(b.graph.roads) - 1)
+	for _, line := range lines {
+		for i := 1; i < len(line); i++ {
+			if len(line[i-1]) < 2 || len(line[i]) < 2 {
+				return errors.New("invalid coordinate")
+			}
+			from := b.node(line[i-1][1], line[i-1][0])
+			to := b.node(line[i][1], line[i][0])
+			if from == to {
+				continue
+			}
+			if forward {
+				b.addEdge(from, to, roadID)
+			}
+			if backward {
+				b.addEdge(to, from, roadID)
+			}
+		}
+	}
+	return nil
+}
+
+// node returns the node at a coordinate, adding it if needed
+func (b *graphBuilder) node(lat, lon float64) int32 {
+	key := [2]int64{int64(math.Round(lat * coordinatePrecision)), int64(math.Round(lon * coordinatePrecision))}
+	if id, ok := b.index[key]; ok {
+		return id
+	}
+	b.graph.nodes = append(b.graph.nodes, Coordinate{Latitude: lat, Longitude: lon})
+	b.graph.out = append(b.graph.out, nil)
+	id := int32(len(b.graph.nodes) - 1)
+	b.index[key] = id
+	return id
+}
+
+// addEdge adds a directed edge and indexes it in every cell its bounding
+// box touches
+func (b *graphBuilder) addEdge(from, to, road int32) {
+	g := b.graph
+	a, c := g.nodes[from], g.nodes[to]
+	g.edges = append(g.edges, edge{from: from, to: to, road: road, length: distance(a, c)})
+	id := int32(len(g.edges) - 1)
+	g.out[from] = append(g.out[from], id)
+
+	minX, maxX := cellIndex(math.Min(a.Longitude, c.Longitude)), cellIndex(math.Max(a.Longitude, c.Longitude))
+	minY, maxY := cellIndex(math.Min(a.Latitude, c.Latitude)), cellIndex(math.Max(a.Latitude, c.Latitude))
+	for x := minX; x <= maxX; x++ {
+		for y := minY; y <= maxY; y++ {
+			g.grid[cell{x, y}] = append(g.grid[cell{x, y}], id)
+		}
+	}
+}
+
+// roadDirections returns whether a road may be driven along and against the
+// direction of its geometry
+func roadDirections(class, oneway, junction string) (forward, backward bool) {
+	switch oneway {
+	case "yes", "true", "1":
+		return true, false
+	case "-1", "reverse":
+		return false, true
+	case "no", "false", "0":
+		return true, true
+	}
+	if class == "motorway" || class == "motorway_link" || junction == "roundabout" {
+		return true, false
+	}
+	return true, true
+}
+
+// parseMaxSpeed returns the speed limit in km/h of a maxspeed tag, or the
+// default limit of the road class when the tag is missing or unusable
+func parseMaxSpeed(value, class string) int {
+	value = strings.TrimSpace(strings.Split(value, ";")[0])
+	if limit, ok := zoneSpeedLimits[value]; ok {
+		return limit
+	}
+
+	number, unit, _ := strings.Cut(value, " ")
+	if speed, err := strconv.ParseFloat(number, 64); err == nil && speed > 0 {
+		if strings.TrimSpace(unit) == "mph" {
+			speed *= 1.609344
+		}
+		return int(math.Round(speed))
+	}
+	return DefaultSpeedLimits[strings.TrimSuffix(class, "_link")]
+}
+
+// NodeCount returns the number of road network nodes
+func (g *Graph) NodeCount() int {
+	return len(g.nodes)
+}
+
+// EdgeCount returns the number of directed road network edges
+func (g *Graph) EdgeCount() int {
+	return len(g.edges)
+}
+
+// cellIndex returns the spatial index cell of a coordinate in degrees
+func cellIndex(degrees float64) int32 {
+	return int32(math.Floor(degrees / gridCellSize))
+}
+
+// projection is the point of an edge closest to a position
+type projection struct {
+	edge     int32
+	fraction float64 // position along the edge, 0 at its start node
+	point    Coordinate
+	distance float64 // meters from the position
+}
+
+// nearbyEdges returns the projections of a position on every edge within
+// radius meters, closest first
+func (g *Graph) nearbyEdges(position Coordinate, radius float64) []projection {
+	latRadius := radius / metersPerDegree
+	lonRadius := latRadius / math.Max(math.Cos(position.Latitude*math.Pi/180), 0.01)
+
+	seen := make(map[int32]bool)
+	var projections []projection
+	for x := cellIndex(position.Longitude - lonRadius); x <= cellIndex(position.Longitude+lonRadius); x++ {
+		for y := cellIndex(position.Latitude - latRadius); y <= cellIndex(position.Latitude+latRadius); y++ {
+			for _, id := range g.grid[cell{x, y}] {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+
+				p := g.project(id, position)
+				if p.distance <= radius {
+					projections = append(projections, p)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(projections, func(i, j int) bool {
+		return projections[i].distance < projections[j].distance
+	})
+	return projections
+}
+
+// project returns the point of an edge closest to a position, using a local
+// flat projection that is accurate over the length of a road segment
+func (g *Graph) project(id int32, position Coordinate) projection {
+	e := g.edges[id]
+	a, b := g.nodes[e.from], g.nodes[e.to]
+
+	scale := math.Cos(position.Latitude * math.Pi / 180)
+	ax, ay := (a.Longitude-position.Longitude)*scale, a.Latitude-position.Latitude
+	bx, by := (b.Longitude-position.Longitude)*scale, b.Latitude-position.Latitude
+	dx, dy := bx-ax, by-ay
+
+	t := 0.0
+	if lengthSquared := dx*dx + dy*dy; lengthSquared > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSquared))
+	}
+	point := interpolate(a, b, t)
+	return projection{edge: id, fraction: t, point: point, distance: distance(position, point)}
+}
+
+// interpolate returns the position a fraction of the way from a to b
+func interpolate(a, b Coordinate, t float64) Coordinate {
+	return Coordinate{
+		Latitude:  a.Latitude + (b.Latitude-a.Latitude)*t,
+		Longitude: a.Longitude + (b.Longitude-a.Longitude)*t,
+	}
+}
+
+// distance returns the great-circle distance between two positions in meters
+func distance(a, b Coordinate) float64 {
+	φ1 := a.Latitude * math.Pi / 180
+	φ2 := b.Latitude * math.Pi / 180
+	Δφ := (b.Latitude - a.Latitude) * math.Pi / 180
+	Δλ := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(Δφ/2)*math.Sin(Δφ/2) + math.Cos(φ1)*math.Cos(φ2)*math.Sin(Δλ/2)*math.Sin(Δλ/2)
+	return 2 * earthRadius * math.Atan2(math.Sqrt(h), math.Sqrt(1-h))
+}
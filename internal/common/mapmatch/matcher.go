@@ -0,0 +1,416 @@
+package mapmatch
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Options tunes the map matcher
+type Options struct {
+	SearchRadius  float64 // meters around a fix searched for roads
+	MaxCandidates int     // closest road positions considered per fix
+	GPSSigma      float64 // meters, GPS noise; a fix's reported accuracy is used when larger
+	Beta          float64 // meters, how readily the route may differ from the straight line between fixes
+	MaxDetour     float64 // meters the route between fixes may exceed twice their straight distance
+}
+
+// DefaultOptions returns options suited to fixes a few seconds to a minute
+// apart
+func DefaultOptions() Options {
+	return Options{
+		SearchRadius:  50,
+		MaxCandidates: 8,
+		GPSSigma:      10,
+		Beta:          30,
+		MaxDetour:     1000,
+	}
+}
+
+// Point is a GPS fix to match
+type Point struct {
+	Latitude  float64
+	Longitude float64
+	Accuracy  float64 // meters, 0 when unknown
+}
+
+// MatchedPoint is a fix snapped to the road it was most likely taken on
+type MatchedPoint struct {
+	Matched bool `json:"matched"` // false when no road was near or reachable
+	Coordinate
+	Road
+	Offset float64 `json:"offset"` // meters between the fix and its snapped position
+}
+
+// Segment is a stretch of the matched route along roads of the same class,
+// name and speed limit. Stretches between fixes that could not be matched
+// are straight lines with an empty road class.
+type Segment struct {
+	Road
+	Distance float64      `json:"distance"` // meters
+	Path     []Coordinate `json:"path"`
+}
+
+// Result is a track matched to the road network
+type Result struct {
+	Points   []MatchedPoint `json:"points"`   // one per input point
+	Segments []Segment      `json:"segments"` // the route, in order
+	Distance float64        `json:"distance"` // meters along the route
+	Matched  int            `json:"matched"`  // number of points matched to a road
+}
+
+// Matcher snaps GPS tracks to a road network with a hidden Markov model:
+// each fix may have been taken at any nearby road position, positions close
+// to the fix are likely, and consecutive positions are likely when the road
+// route between them is about as long as the straight line between the
+// fixes. The Viterbi algorithm finds the most likely sequence of positions.
+// A Matcher is safe for concurrent use.
+type Matcher struct {
+	graph   *Graph
+	options Options
+}
+
+// NewMatcher creates a matcher over a road network
+func NewMatcher(graph *Graph, options Options) *Matcher {
+	defaults := DefaultOptions()
+	if options.SearchRadius <= 0 {
+		options.SearchRadius = defaults.SearchRadius
+	}
+	if options.MaxCandidates <= 0 {
+		options.MaxCandidates = defaults.MaxCandidates
+	}
+	if options.GPSSigma <= 0 {
+		options.GPSSigma = defaults.GPSSigma
+	}
+	if options.Beta <= 0 {
+		options.Beta = defaults.Beta
+	}
+	if options.MaxDetour <= 0 {
+		options.MaxDetour = defaults.MaxDetour
+	}
+	return &Matcher{graph: graph, options: options}
+}
+
+// Graph returns the road network the matcher snaps to
+func (m *Matcher) Graph() *Graph {
+	return m.graph
+}
+
+// state is a candidate road position of a fix in the Viterbi lattice
+type state struct {
+	projection
+	score float64 // log probability of the best sequence ending here
+	prev  int     // best predecessor in the previous layer
+}
+
+// Match snaps a track, oldest fix first, to the road network. Fixes without
+// a road nearby, or whose road cannot be reached from the previous fix's,
+// split the track into independently matched pieces.
+func (m *Matcher) Match(points []Point) *Result {
+	result := &Result{Points: make([]MatchedPoint, len(points))}
+	positions := make([]*projection, len(points))
+
+	// Fixes of the current piece, with their candidate layers
+	var piece []int
+	var layers [][]state
+	finish := func() {
+		if len(piece) > 0 {
+			m.resolve(piece, layers, positions)
+		}
+		piece, layers = nil, nil
+	}
+
+	for i, point := range points {
+		position := Coordinate{Latitude: point.Latitude, Longitude: point.Longitude}
+		candidates := m.graph.nearbyEdges(position, m.options.SearchRadius)
+		if len(candidates) > m.options.MaxCandidates {
+			candidates = candidates[:m.options.MaxCandidates]
+		}
+		if len(candidates) == 0 {
+			finish()
+			continue
+		}
+
+		sigma := math.Max(m.options.GPSSigma, point.Accuracy)
+		layer := make([]state, len(candidates))
+		for j, candidate := range candidates {
+			layer[j] = state{projection: candidate, score: emission(candidate.distance, sigma), prev: -1}
+		}
+
+		if len(piece) > 0 {
+			prev := points[piece[len(piece)-1]]
+			straight := distance(Coordinate{Latitude: prev.Latitude, Longitude: prev.Longitude}, position)
+			if !m.transition(layers[len(layers)-1], layer, straight) {
+				finish()
+			}
+		}
+		piece = append(piece, i)
+		layers = append(layers, layer)
+	}
+	finish()
+
+	m.buildRoute(points, positions, result)
+	return result
+}
+
+// emission is the log probability of observing a fix offset meters from its
+// true road position
+func emission(offset, sigma float64) float64 {
+	return -0.5 * (offset / sigma) * (offset / sigma)
+}
+
+// transition scores every candidate of a layer by its most likely
+// predecessor. It reports false when no candidate can be reached.
+func (m *Matcher) transition(prev, next []state, straight float64) bool {
+	limit := 2*straight + m.options.MaxDetour
+	scores := make([]float64, len(next))
+	for j := range scores {
+		scores[j] = math.Inf(-1)
+	}
+
+	for i := range prev {
+		var reach map[int32]float64
+		for j := range next {
+			route, ok := m.routeLength(&prev[i].projection, &next[j].projection, limit, &reach)
+			if !ok {
+				continue
+			}
+			score := prev[i].score - math.Abs(route-straight)/m.options.Beta
+			if score > scores[j] {
+				scores[j] = score
+				next[j].prev = i
+			}
+		}
+	}
+
+	reachable := false
+	for j := range next {
+		if next[j].prev >= 0 {
+			reachable = true
+		}
+	}
+	if reachable {
+		// Candidates no route leads to cannot continue the piece
+		for j := range next {
+			next[j].score += scores[j]
+		}
+	}
+	return reachable
+}
+
+// sameEdgeTolerance is how far in meters a position may fall behind the
+// previous one on the same edge and still count as not having moved, which
+// absorbs GPS jitter while stopped
+const sameEdgeTolerance = 5
+
+// routeLength returns the road distance from one road position to another,
+// and false when it exceeds limit. reach caches the distances from the end
+// of the first position's edge.
+func (m *Matcher) routeLength(from, to *projection, limit float64, reach *map[int32]float64) (float64, bool) {
+	g := m.graph
+	a, b := g.edges[from.edge], g.edges[to.edge]
+
+	if from.edge == to.edge {
+		along := (to.fraction - from.fraction) * a.length
+		if along >= 0 {
+			return along, along <= limit
+		}
+		if along >= -sameEdgeTolerance {
+			return 0, true
+		}
+	}
+
+	if *reach == nil {
+		*reach, _ = g.shortestPaths(a.to, limit)
+	}
+	between, ok := (*reach)[b.from]
+	if !ok {
+		return 0, false
+	}
+	route := (1-from.fraction)*a.length + between + to.fraction*b.length
+	return route, route <= limit
+}
+
+// resolve backtracks the most likely road positions of a piece of the track
+func (m *Matcher) resolve(piece []int, layers [][]state, positions []*projection) {
+	best := 0
+	last := layers[len(layers)-1]
+	for j := range last {
+		if last[j].score > last[best].score {
+			best = j
+		}
+	}
+
+	for k := len(layers) - 1; k >= 0; k-- {
+		chosen := layers[k][best]
+		positions[piece[k]] = &chosen.projection
+		best = chosen.prev
+	}
+}
+
+// buildRoute records the matched positions and joins them into segments
+func (m *Matcher) buildRoute(points []Point, positions []*projection, result *Result) {
+	g := m.graph
+	for i, position := range positions {
+		if position == nil {
+			continue
+		}
+		result.Points[i] = MatchedPoint{
+			Matched:    true,
+			Coordinate: position.point,
+			Road:       g.roads[g.edges[position.edge].road],
+			Offset:     position.distance,
+		}
+		result.Matched++
+	}
+
+	builder := routeBuilder{result: result}
+	for i := 1; i < len(points); i++ {
+		from, to := positions[i-1], positions[i]
+		if from != nil && to != nil && m.appendRoadRoute(&builder, from, to) {
+			continue
+		}
+
+		// Stretches without a road route follow the fixes in a straight line
+		start := Coordinate{Latitude: points[i-1].Latitude, Longitude: points[i-1].Longitude}
+		end := Coordinate{Latitude: points[i].Latitude, Longitude: points[i].Longitude}
+		if from != nil {
+			start = from.point
+		}
+		if to != nil {
+			end = to.point
+		}
+		builder.add(Road{}, start, end, distance(start, end))
+	}
+}
+
+// appendRoadRoute adds the road route between two road positions. It reports
+// false when no route joins them, as between separately matched pieces.
+func (m *Matcher) appendRoadRoute(builder *routeBuilder, from, to *projection) bool {
+	g := m.graph
+	a, b := g.edges[from.edge], g.edges[to.edge]
+
+	if from.edge == to.edge {
+		along := (to.fraction - from.fraction) * a.length
+		if along >= 0 {
+			builder.add(g.roads[a.road], from.point, to.point, along)
+			return true
+		}
+		if along >= -sameEdgeTolerance {
+			return true
+		}
+	}
+
+	limit := 2*distance(from.point, to.point) + m.options.MaxDetour
+	_, previous := g.shortestPaths(a.to, limit)
+	path, ok := g.pathTo(previous, a.to, b.from)
+	if !ok {
+		return false
+	}
+
+	builder.add(g.roads[a.road], from.point, g.nodes[a.to], (1-from.fraction)*a.length)
+	for _, id := range path {
+		e := g.edges[id]
+		builder.add(g.roads[e.road], g.nodes[e.from], g.nodes[e.to], e.length)
+	}
+	builder.add(g.roads[b.road], g.nodes[b.from], to.point, to.fraction*b.length)
+	return true
+}
+
+// routeBuilder appends stretches of road to a result's segments, starting a
+// new segment whenever the road changes
+type routeBuilder struct {
+	result *Result
+}
+
+// add appends a stretch from one position to another along a road
+func (rb *routeBuilder) add(road Road, from, to Coordinate, length float64) {
+	segments := rb.result.Segments
+	rb.result.Distance += length
+
+	if n := len(segments); n > 0 && segments[n-1].Road == road {
+		last := &segments[n-1]
+		if last.Path[len(last.Path)-1] != from {
+			last.Path = append(last.Path, from)
+		}
+		if to != from {
+			last.Path = append(last.Path, to)
+		}
+		last.Distance += length
+		return
+	}
+
+	path := []Coordinate{from}
+	if to != from {
+		path = append(path, to)
+	}
+	rb.result.Segments = append(segments, Segment{Road: road, Distance: length, Path: path})
+}
+
+// shortestPaths runs Dijkstra's algorithm from a node up to limit meters. It
+// returns the distance to every node reached and the edge each was reached by.
+func (g *Graph) shortestPaths(source int32, limit float64) (map[int32]float64, map[int32]int32) {
+	dist := map[int32]float64{source: 0}
+	previous := make(map[int32]int32)
+	queue := &nodeQueue{{node: source}}
+
+	for queue.Len() > 0 {
+		current := heap.Pop(queue).(queuedNode)
+		if current.distance > dist[current.node] {
+			continue
+		}
+		for _, id := range g.out[current.node] {
+			e := g.edges[id]
+			next := current.distance + e.length
+			if next > limit {
+				continue
+			}
+			if known, ok := dist[e.to]; ok && known <= next {
+				continue
+			}
+			dist[e.to] = next
+			previous[e.to] = id
+			heap.Push(queue, queuedNode{node: e.to, distance: next})
+		}
+	}
+	return dist, previous
+}
+
+// pathTo returns the edges of the shortest path from source to target found
+// by shortestPaths
+func (g *Graph) pathTo(previous map[int32]int32, source, target int32) ([]int32, bool) {
+	var path []int32
+	for node := target; node != source; {
+		id, ok := previous[node]
+		if !ok {
+			return nil, false
+		}
+		path = append(path, id)
+		node = g.edges[id].from
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, true
+}
+
+// queuedNode is a node waiting in Dijkstra's priority queue
+type queuedNode struct {
+	node     int32
+	distance float64
+}
+
+// nodeQueue is a min-heap of nodes by distance
+type nodeQueue []queuedNode
+
+func (q nodeQueue) Len() int            { return len(q) }
+func (q nodeQueue) Less(i, j int) bool  { return q[i].distance < q[j].distance }
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(queuedNode)) }
+
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,149 @@
+package mapmatch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNetwork is a primary road running east along latitude -6.2, a
+// residential road 60 m south of it, and a secondary road heading north from
+// the primary road at longitude 106.815
+const testNetwork = `{"type": "FeatureCollection", "features": [
+	{"type": "Feature", "properties": {"highway": "primary", "name": "Jalan Sudirman"},
+	 "geometry": {"type": "LineString", "coordinates": [[106.800, -6.2], [106.805, -6.2], [106.810, -6.2], [106.815, -6.2], [106.820, -6.2], [106.825, -6.2]]}},
+	{"type": "Feature", "properties": {"highway": "residential", "name": "Gang Mawar"},
+	 "geometry": {"type": "LineString", "coordinates": [[106.800, -6.20054], [106.810, -6.20054], [106.825, -6.20054]]}},
+	{"type": "Feature", "properties": {"highway": "secondary", "name": "Jalan Thamrin", "maxspeed": "40"},
+	 "geometry": {"type": "LineString", "coordinates": [[106.815, -6.2], [106.815, -6.195], [106.815, -6.19]]}},
+	{"type": "Feature", "properties": {"highway": "footway"},
+	 "geometry": {"type": "LineString", "coordinates": [[106.800, -6.199], [106.825, -6.199]]}}
+]}`
+
+func loadTestNetwork(t *testing.T) *Graph {
+	t.Helper()
+	graph, err := ReadGraph(strings.NewReader(testNetwork))
+	require.NoError(t, err)
+	return graph
+}
+
+func TestReadGraph(t *testing.T) {
+	graph := loadTestNetwork(t)
+
+	// The secondary road shares its first node with the primary road; the
+	// footway is not a road for vehicles
+	assert.Equal(t, 6+3+2, graph.NodeCount())
+	assert.Equal(t, 2*(5+2+2), graph.EdgeCount(), "two-way roads have an edge per direction")
+}
+
+func TestReadGraph_TextSequence(t *testing.T) {
+	sequence := "\x1e" + `{"type": "Feature", "properties": {"highway": "motorway", "name": "Tol Dalam Kota"}, "geometry": {"type": "LineString", "coordinates": [[106.8, -6.2], [106.81, -6.2]]}}` + "\n" +
+		"\x1e" + `{"type": "Feature", "properties": {"highway": "primary_link", "oneway": "-1"}, "geometry": {"type": "LineString", "coordinates": [[106.81, -6.2], [106.81, -6.19]]}}` + "\n"
+
+	graph, err := ReadGraph(strings.NewReader(sequence))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, graph.EdgeCount(), "motorways and oneway links have one direction")
+	assert.Equal(t, int32(2), graph.edges[1].from, "oneway=-1 runs against the geometry")
+	assert.Equal(t, 100, graph.roads[0].SpeedLimit)
+	assert.Equal(t, 80, graph.roads[1].SpeedLimit, "links take the limit of their road class")
+}
+
+func TestReadGraph_NoRoads(t *testing.T) {
+	_, err := ReadGraph(strings.NewReader(`{"type": "FeatureCollection", "features": []}`))
+	assert.Error(t, err)
+}
+
+func TestParseMaxSpeed(t *testing.T) {
+	tests := []struct {
+		value, class string
+		want         int
+	}{
+		{"60", "primary", 60},
+		{"60 km/h", "primary", 60},
+		{"30 mph", "primary", 48},
+		{"40;60", "primary", 40},
+		{"ID:urban", "trunk", 50},
+		{"none", "secondary", 60},
+		{"", "residential", 30},
+		{"", "tertiary_link", 50},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseMaxSpeed(tt.value, tt.class), "maxspeed %q on %s", tt.value, tt.class)
+	}
+}
+
+func TestMatcher_SnapsNoisyTrackToRoads(t *testing.T) {
+	matcher := NewMatcher(loadTestNetwork(t), DefaultOptions())
+
+	// East along the primary road, zigzagging up to 25 m to either side, then
+	// north on the secondary road
+	points := []Point{
+		{Latitude: -6.20020, Longitude: 106.801},
+		{Latitude: -6.19980, Longitude: 106.804},
+		{Latitude: -6.20022, Longitude: 106.807},
+		{Latitude: -6.19985, Longitude: 106.810},
+		{Latitude: -6.20020, Longitude: 106.813},
+		{Latitude: -6.19800, Longitude: 106.8152},
+		{Latitude: -6.19500, Longitude: 106.8148},
+	}
+	result := matcher.Match(points)
+
+	require.Len(t, result.Points, len(points))
+	assert.Equal(t, len(points), result.Matched)
+	for _, point := range result.Points[:5] {
+		assert.Equal(t, "primary", point.Class, "the residential road is closer to some fixes but not continuous with the route")
+		assert.InDelta(t, -6.2, point.Latitude, 1e-9)
+	}
+	assert.Equal(t, "secondary", result.Points[6].Class)
+	assert.Equal(t, 40, result.Points[6].SpeedLimit)
+	assert.InDelta(t, 106.815, result.Points[6].Longitude, 1e-9)
+
+	require.Len(t, result.Segments, 2)
+	assert.Equal(t, "Jalan Sudirman", result.Segments[0].Name)
+	assert.Equal(t, Coordinate{Latitude: -6.2, Longitude: 106.815}, result.Segments[0].Path[len(result.Segments[0].Path)-1], "turns at the junction")
+	assert.Equal(t, "Jalan Thamrin", result.Segments[1].Name)
+
+	// 14 × 110.6 m east, then 5 × 111.3 m north, without the zigzag
+	assert.InDelta(t, 1548+556, result.Distance, 10)
+	assert.InDelta(t, result.Distance, result.Segments[0].Distance+result.Segments[1].Distance, 1e-6)
+}
+
+func TestMatcher_TrackLeavingTheNetwork(t *testing.T) {
+	matcher := NewMatcher(loadTestNetwork(t), DefaultOptions())
+
+	points := []Point{
+		{Latitude: -6.2, Longitude: 106.801},
+		{Latitude: -6.2, Longitude: 106.803},
+		{Latitude: -6.21, Longitude: 106.803}, // a kilometer from any road
+		{Latitude: -6.2, Longitude: 106.805},
+		{Latitude: -6.2, Longitude: 106.807},
+	}
+	result := matcher.Match(points)
+
+	assert.Equal(t, 4, result.Matched)
+	assert.False(t, result.Points[2].Matched)
+
+	var classes []string
+	for _, segment := range result.Segments {
+		classes = append(classes, segment.Class)
+	}
+	assert.Equal(t, []string{"primary", "", "primary"}, classes, "off-road stretches are straight lines")
+}
+
+func TestMatcher_StoppedVehicleJitter(t *testing.T) {
+	matcher := NewMatcher(loadTestNetwork(t), DefaultOptions())
+
+	// Parked on the primary road, the fixes jittering back and forth
+	points := []Point{
+		{Latitude: -6.2, Longitude: 106.80700},
+		{Latitude: -6.2, Longitude: 106.80698},
+		{Latitude: -6.2, Longitude: 106.80701},
+	}
+	result := matcher.Match(points)
+
+	assert.Equal(t, 3, result.Matched)
+	assert.Less(t, result.Distance, 10.0)
+}
@@ -0,0 +1,185 @@
+package mapmatch
+
+import (
+	"container/heap"
+	"math"
+)
+
+// TravelMatrix holds the fastest routes between every pair of a set of
+// positions, indexed like the positions
+type TravelMatrix struct {
+	Distances [][]float64 // meters
+	Durations [][]float64 // seconds
+	Reachable [][]bool    // false when a position is off the network or cut off from the other
+}
+
+// SpeedFunc returns the speed in km/h at which a road is driven
+type SpeedFunc func(Road) float64
+
+// roadAccess is a position where a route may join or leave the network
+type roadAccess struct {
+	edge     int32
+	fraction float64
+}
+
+// TravelMatrix computes the fastest routes between every pair of positions.
+// Positions are joined to the closest road within snapRadius meters and
+// roads are driven at the speed returned by speed, which must be positive.
+func (g *Graph) TravelMatrix(positions []Coordinate, snapRadius float64, speed SpeedFunc) *TravelMatrix {
+	n := len(positions)
+	matrix := &TravelMatrix{
+		Distances: make([][]float64, n),
+		Durations: make([][]float64, n),
+		Reachable: make([][]bool, n),
+	}
+
+	accesses := make([][]roadAccess, n)
+	for i, position := range positions {
+		accesses[i] = g.roadAccesses(position, snapRadius)
+	}
+
+	// Seconds to drive each edge, computed once per road
+	roadSeconds := make([]float64, len(g.roads))
+	for i, road := range g.roads {
+		roadSeconds[i] = 3.6 / speed(road) // per meter
+	}
+	edgeSeconds := func(id int32, meters float64) float64 {
+		return meters * roadSeconds[g.edges[id].road]
+	}
+
+	for i := range positions {
+		matrix.Distances[i] = make([]float64, n)
+		matrix.Durations[i] = make([]float64, n)
+		matrix.Reachable[i] = make([]bool, n)
+		matrix.Reachable[i][i] = true
+		if len(accesses[i]) == 0 {
+			continue
+		}
+
+		// Leave along every edge the position was joined to
+		var starts []queuedRoute
+		for _, access := range accesses[i] {
+			e := g.edges[access.edge]
+			meters := (1 - access.fraction) * e.length
+			starts = append(starts, queuedRoute{node: e.to, seconds: edgeSeconds(access.edge, meters), meters: meters})
+		}
+		targets := make(map[int32]bool)
+		for j := range positions {
+			for _, access := range accesses[j] {
+				targets[g.edges[access.edge].from] = true
+			}
+		}
+		reached := g.fastestRoutes(starts, targets, edgeSeconds)
+
+		for j := range positions {
+			if j == i {
+				continue
+			}
+			best := math.Inf(1)
+			var bestMeters float64
+			for _, from := range accesses[i] {
+				for _, to := range accesses[j] {
+					e := g.edges[to.edge]
+					var seconds, meters float64
+					if from.edge == to.edge && to.fraction >= from.fraction {
+						meters = (to.fraction - from.fraction) * e.length
+						seconds = edgeSeconds(to.edge, meters)
+					} else if route, ok := reached[e.from]; ok {
+						meters = route.meters + to.fraction*e.length
+						seconds = route.seconds + edgeSeconds(to.edge, to.fraction*e.length)
+					} else {
+						continue
+					}
+					if seconds < best {
+						best, bestMeters = seconds, meters
+					}
+				}
+			}
+			if !math.IsInf(best, 1) {
+				matrix.Distances[i][j] = bestMeters
+				matrix.Durations[i][j] = best
+				matrix.Reachable[i][j] = true
+			}
+		}
+	}
+	return matrix
+}
+
+// roadAccesses returns the edges closest to a position within radius, both
+// directions of a two-way road included
+func (g *Graph) roadAccesses(position Coordinate, radius float64) []roadAccess {
+	projections := g.nearbyEdges(position, radius)
+
+	var accesses []roadAccess
+	for _, p := range projections {
+		if p.distance > projections[0].distance+1 {
+			break
+		}
+		accesses = append(accesses, roadAccess{edge: p.edge, fraction: p.fraction})
+	}
+	return accesses
+}
+
+// queuedRoute is a node reached in a fastest route search
+type queuedRoute struct {
+	node    int32
+	seconds float64
+	meters  float64
+}
+
+// routeQueue is a min-heap of routes by duration
+type routeQueue []queuedRoute
+
+func (q routeQueue) Len() int            { return len(q) }
+func (q routeQueue) Less(i, j int) bool  { return q[i].seconds < q[j].seconds }
+func (q routeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *routeQueue) Push(x interface{}) { *q = append(*q, x.(queuedRoute)) }
+
+func (q *routeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// fastestRoutes runs Dijkstra's algorithm by travel time from the start
+// routes until every target node is settled, and returns the fastest route
+// found to each node
+func (g *Graph) fastestRoutes(starts []queuedRoute, targets map[int32]bool, edgeSeconds func(int32, float64) float64) map[int32]queuedRoute {
+	best := make(map[int32]queuedRoute)
+	queue := &routeQueue{}
+	for _, start := range starts {
+		if known, ok := best[start.node]; !ok || start.seconds < known.seconds {
+			best[start.node] = start
+			heap.Push(queue, start)
+		}
+	}
+
+	settled := make(map[int32]bool)
+	remaining := len(targets)
+	for queue.Len() > 0 && remaining > 0 {
+		current := heap.Pop(queue).(queuedRoute)
+		if settled[current.node] {
+			continue
+		}
+		settled[current.node] = true
+		if targets[current.node] {
+			remaining--
+		}
+
+		for _, id := range g.out[current.node] {
+			e := g.edges[id]
+			next := queuedRoute{
+				node:    e.to,
+				seconds: current.seconds + edgeSeconds(id, e.length),
+				meters:  current.meters + e.length,
+			}
+			if known, ok := best[e.to]; ok && known.seconds <= next.seconds {
+				continue
+			}
+			best[e.to] = next
+			heap.Push(queue, next)
+		}
+	}
+	return best
+}
@@ -0,0 +1,51 @@
+package mapmatch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTravelMatrix(t *testing.T) {
+	graph := loadTestNetwork(t)
+	positions := []Coordinate{
+		{Latitude: -6.2001, Longitude: 106.801}, // on the primary road
+		{Latitude: -6.195, Longitude: 106.8151}, // on the secondary road
+		{Latitude: -6.25, Longitude: 106.801},   // far from any road
+	}
+	speed := func(road Road) float64 { return float64(road.SpeedLimit) }
+
+	matrix := graph.TravelMatrix(positions, 100, speed)
+
+	// 14 × 110.6 m east at 80 km/h, then 5 × 111.3 m north at 40 km/h
+	assert.True(t, matrix.Reachable[0][1])
+	assert.InDelta(t, 1548+556, matrix.Distances[0][1], 5)
+	assert.InDelta(t, 1548/(80/3.6)+556/(40/3.6), matrix.Durations[0][1], 1)
+	assert.InDelta(t, matrix.Durations[0][1], matrix.Durations[1][0], 0.5, "two-way roads")
+
+	assert.False(t, matrix.Reachable[0][2])
+	assert.False(t, matrix.Reachable[2][1])
+	assert.True(t, matrix.Reachable[2][2])
+}
+
+func TestTravelMatrix_OneWay(t *testing.T) {
+	// A one-way street east, and a slower two-way road looping back west
+	graph, err := ReadGraph(strings.NewReader(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"highway": "primary", "oneway": "yes", "maxspeed": "60"},
+		 "geometry": {"type": "LineString", "coordinates": [[106.80, -6.2], [106.81, -6.2]]}},
+		{"type": "Feature", "properties": {"highway": "residential"},
+		 "geometry": {"type": "LineString", "coordinates": [[106.81, -6.2], [106.81, -6.201], [106.80, -6.201], [106.80, -6.2]]}}
+	]}`))
+	require.NoError(t, err)
+
+	positions := []Coordinate{
+		{Latitude: -6.2, Longitude: 106.801},
+		{Latitude: -6.2, Longitude: 106.809},
+	}
+	matrix := graph.TravelMatrix(positions, 50, func(road Road) float64 { return float64(road.SpeedLimit) })
+
+	assert.InDelta(t, 885, matrix.Distances[0][1], 5)
+	assert.Greater(t, matrix.Distances[1][0], 1200.0, "going back west takes the loop")
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+)
+
+// FeatureChecker checks whether the subscription plan of a company includes a feature
+type FeatureChecker interface {
+	RequireFeature(ctx context.Context, companyID, feature string) error
+}
+
+// FeatureRequired middleware rejects requests from companies whose plan does
+// not include a feature with 403 FEATURE_NOT_AVAILABLE, or with 402
+// PAYMENT_REQUIRED when their subscription has ended. Super-admins are not
+// bound to a plan.
+func FeatureRequired(checker FeatureChecker, feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("user_role") == "super-admin" {
+			c.Next()
+			return
+		}
+
+		companyID := c.GetString("company_id")
+		if companyID == "" {
+			AbortWithForbidden(c, "User company could not be determined")
+			return
+		}
+
+		if err := checker.RequireFeature(c.Request.Context(), companyID, feature); err != nil {
+			if appErr, ok := err.(*errors.AppError); ok {
+				AbortWithError(c, appErr)
+			} else {
+				AbortWithInternal(c, "Failed to check plan features", err)
+			}
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,247 @@
+// Package migrate applies the versioned SQL migrations in migrations/ and
+// records them in a schema table, so a database can be brought to the
+// current schema without running the scripts by hand.
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NoTransactionDirective marks a script that must not run inside a
+// transaction. Scripts using CREATE/DROP INDEX CONCURRENTLY are detected
+// automatically.
+const NoTransactionDirective = "-- migrate:no-transaction"
+
+// concurrentlyPattern matches index operations that cannot run in a transaction
+var concurrentlyPattern = regexp.MustCompile(`(?i)\bconcurrently\b`)
+
+// fileNamePattern matches {version}_{description}.{up|down}.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a versioned pair of up and down SQL scripts
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	UpFile   string
+	DownFile string
+}
+
+// Checksum returns the SHA-256 of the up script, used to detect scripts
+// that were edited after being applied
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// Label returns the version and name, e.g. 009_payment_gateway
+func (m *Migration) Label() string {
+	return fmt.Sprintf("%03d_%s", m.Version, m.Name)
+}
+
+// Load reads the migrations in dir ordered by version
+func Load(dir string) ([]*Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s does not match {version}_{description}.{up|down}.sql", entry.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration file %s has an invalid version", entry.Name())
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, match[2])
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+			migration.UpFile = entry.Name()
+		} else {
+			migration.Down = string(content)
+			migration.DownFile = entry.Name()
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.UpFile == "" {
+			return nil, fmt.Errorf("migration %s has no up script", migration.Label())
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Gaps returns the versions missing from the sequence of migrations
+func Gaps(migrations []*Migration) []int64 {
+	var gaps []int64
+	for i := 1; i < len(migrations); i++ {
+		for v := migrations[i-1].Version + 1; v < migrations[i].Version; v++ {
+			gaps = append(gaps, v)
+		}
+	}
+	return gaps
+}
+
+// Create writes empty up and down scripts for a new migration numbered after
+// the latest one in dir and returns their paths
+func Create(dir, name string) (string, string, error) {
+	name = strings.Trim(strings.ToLower(regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(name, "_")), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migration name is required")
+	}
+
+	migrations, err := Load(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	version := int64(1)
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := fmt.Sprintf("%03d_%s", version, name)
+	upPath := filepath.Join(dir, base+".up.sql")
+	downPath := filepath.Join(dir, base+".down.sql")
+	title := strings.ReplaceAll(name, "_", " ")
+
+	if err := os.WriteFile(upPath, []byte(fmt.Sprintf("-- %s\n\n", title)), 0o644); err != nil {
+		return "", "", fmt.Errorf("failed to create %s: %w", upPath, err)
+	}
+	if err := os.WriteFile(downPath, []byte(fmt.Sprintf("-- Rollback %s\n\n", title)), 0o644); err != nil {
+		return "", "", fmt.Errorf("failed to create %s: %w", downPath, err)
+	}
+
+	return upPath, downPath, nil
+}
+
+// requiresNoTransaction reports whether a script must run outside a transaction
+func requiresNoTransaction(script string) bool {
+	if strings.Contains(script, NoTransactionDirective) {
+		return true
+	}
+	for _, statement := range splitStatements(script) {
+		if concurrentlyPattern.MatchString(stripComments(statement)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitStatements splits a script into statements on top-level semicolons,
+// skipping semicolons inside quotes, comments and dollar-quoted bodies
+func splitStatements(script string) []string {
+	var statements []string
+	start := 0
+
+	flush := func(end int) {
+		statement := strings.TrimSpace(script[start:end])
+		if strings.TrimSpace(stripComments(statement)) != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	for i := 0; i < len(script); i++ {
+		switch {
+		case strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(script)
+			}
+		case script[i] == '\'' || script[i] == '"':
+			quote := script[i]
+			for i++; i < len(script); i++ {
+				if script[i] == quote {
+					if i+1 < len(script) && script[i+1] == quote {
+						i++ // escaped quote
+						continue
+					}
+					break
+				}
+			}
+		case script[i] == '$':
+			if tag := dollarQuoteTag(script[i:]); tag != "" {
+				if end := strings.Index(script[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				} else {
+					i = len(script)
+				}
+			}
+		case script[i] == ';':
+			flush(i)
+			start = i + 1
+		}
+	}
+	flush(len(script))
+
+	return statements
+}
+
+// dollarQuoteTag returns the opening tag ($$ or $name$) at the start of s
+func dollarQuoteTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+// stripComments removes line comments so directives and keywords can be
+// matched on the SQL alone
+func stripComments(statement string) string {
+	var b strings.Builder
+	for _, line := range strings.Split(statement, "\n") {
+		if idx := strings.Index(line, "--"); idx >= 0 {
+			line = line[:idx]
+		}
+		b.WriteString(line)
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMigration(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("repository migrations", func(t *testing.T) {
+		migrations, err := Load("../../../migrations")
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+
+		assert.Equal(t, int64(1), migrations[0].Version)
+		assert.Equal(t, "initial_schema", migrations[0].Name)
+		assert.Equal(t, []int64{2}, Gaps(migrations))
+		for _, migration := range migrations {
+			assert.NotEmpty(t, migration.DownFile, migration.Label())
+		}
+	})
+
+	t.Run("ordered by version", func(t *testing.T) {
+		dir := t.TempDir()
+		writeMigration(t, dir, "010_second.up.sql", "SELECT 2;")
+		writeMigration(t, dir, "002_first.up.sql", "SELECT 1;")
+		writeMigration(t, dir, "002_first.down.sql", "SELECT -1;")
+		writeMigration(t, dir, "README.md", "ignored")
+
+		migrations, err := Load(dir)
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+		assert.Equal(t, "002_first", migrations[0].Label())
+		assert.Equal(t, "SELECT -1;", migrations[0].Down)
+		assert.Equal(t, "010_second", migrations[1].Label())
+		assert.Empty(t, migrations[1].DownFile)
+	})
+
+	t.Run("invalid files", func(t *testing.T) {
+		tests := map[string][]string{
+			"bad name":       {"create_users.up.sql"},
+			"missing up":     {"001_users.down.sql"},
+			"shared version": {"001_users.up.sql", "001_vehicles.up.sql"},
+		}
+		for name, files := range tests {
+			t.Run(name, func(t *testing.T) {
+				dir := t.TempDir()
+				for _, file := range files {
+					writeMigration(t, dir, file, "SELECT 1;")
+				}
+				_, err := Load(dir)
+				assert.Error(t, err)
+			})
+		}
+	})
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	writeMigration(t, dir, "007_existing.up.sql", "SELECT 1;")
+
+	upPath, downPath, err := Create(dir, "Add Trip Stops")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "008_add_trip_stops.up.sql"), upPath)
+	assert.Equal(t, filepath.Join(dir, "008_add_trip_stops.down.sql"), downPath)
+
+	migrations, err := Load(dir)
+	require.NoError(t, err)
+	assert.Len(t, migrations, 2)
+
+	_, _, err = Create(dir, "  ")
+	assert.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- header; with a semicolon
+CREATE TABLE a (note TEXT DEFAULT 'x;y');
+/* block; comment */
+CREATE FUNCTION f() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+DO $body$ BEGIN PERFORM 1; END $body$;
+SELECT "semi;colon" FROM a WHERE id = $1
+`
+	statements := splitStatements(script)
+	require.Len(t, statements, 4)
+	assert.Contains(t, statements[0], "'x;y'")
+	assert.Contains(t, statements[1], "RETURN NEW;")
+	assert.Contains(t, statements[1], "LANGUAGE plpgsql")
+	assert.Equal(t, "DO $body$ BEGIN PERFORM 1; END $body$", statements[2])
+	assert.Equal(t, `SELECT "semi;colon" FROM a WHERE id = $1`, statements[3])
+}
+
+func TestRequiresNoTransaction(t *testing.T) {
+	assert.True(t, requiresNoTransaction("CREATE INDEX CONCURRENTLY IF NOT EXISTS idx ON a (b);"))
+	assert.True(t, requiresNoTransaction(NoTransactionDirective+"\nALTER TYPE status ADD VALUE 'x';"))
+	assert.False(t, requiresNoTransaction("-- not CONCURRENTLY\nCREATE INDEX idx ON a (b);"))
+	assert.False(t, requiresNoTransaction("CREATE TABLE a (concurrently_updated BOOLEAN);"))
+
+	migrations, err := Load("../../../migrations")
+	require.NoError(t, err)
+	for _, migration := range migrations {
+		if migration.Version == 3 {
+			assert.True(t, requiresNoTransaction(migration.Up))
+		}
+		if migration.Version == 1 {
+			assert.False(t, requiresNoTransaction(migration.Up))
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	migrations := []*Migration{
+		{Version: 1, Name: "one", Up: "SELECT 1;"},
+		{Version: 3, Name: "three", Up: "SELECT 3;"},
+		{Version: 4, Name: "four", Up: "SELECT 4;"},
+	}
+	appliedRow := func(m *Migration) AppliedMigration {
+		return AppliedMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum(), AppliedAt: time.Now()}
+	}
+
+	t.Run("pending after applied", func(t *testing.T) {
+		pending, err := plan(migrations, []AppliedMigration{appliedRow(migrations[0])})
+		require.NoError(t, err)
+		require.Len(t, pending, 2)
+		assert.Equal(t, int64(3), pending[0].Version)
+	})
+
+	t.Run("modified script", func(t *testing.T) {
+		row := appliedRow(migrations[0])
+		row.Checksum = "edited"
+		_, err := plan(migrations, []AppliedMigration{row})
+		assert.True(t, errors.Is(err, ErrDrift))
+		assert.Contains(t, err.Error(), "001_one was modified")
+	})
+
+	t.Run("missing script", func(t *testing.T) {
+		_, err := plan(migrations, []AppliedMigration{appliedRow(migrations[0]), {Version: 2, Name: "two", Checksum: "x"}})
+		assert.True(t, errors.Is(err, ErrDrift))
+		assert.Contains(t, err.Error(), "002_two was applied but its script is missing")
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		_, err := plan(migrations, []AppliedMigration{appliedRow(migrations[0]), appliedRow(migrations[2])})
+		assert.True(t, errors.Is(err, ErrDrift))
+		assert.Contains(t, err.Error(), "003_three is pending")
+	})
+}
+
+func TestStatus(t *testing.T) {
+	migrations := []*Migration{
+		{Version: 1, Name: "one", Up: "SELECT 1;"},
+		{Version: 3, Name: "three", Up: "SELECT 3;"},
+	}
+	applied := []AppliedMigration{
+		{Version: 1, Name: "one", Checksum: migrations[0].Checksum(), AppliedAt: time.Now()},
+		{Version: 2, Name: "two", Checksum: "x", AppliedAt: time.Now()},
+	}
+
+	statuses := status(migrations, applied)
+	require.Len(t, statuses, 3)
+	assert.Equal(t, StateApplied, statuses[0].State)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Equal(t, StateMissing, statuses[1].State)
+	assert.Equal(t, StatePending, statuses[2].State)
+	assert.Nil(t, statuses[2].AppliedAt)
+}
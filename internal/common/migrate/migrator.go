@@ -0,0 +1,388 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTable is the schema table that records applied migrations
+const DefaultTable = "schema_versions"
+
+// advisoryLockKey serializes migrators across processes, e.g. several API
+// instances starting at once
+const advisoryLockKey int64 = 7_240_501_861_302_118_001
+
+// Migration states reported by Status
+const (
+	StateApplied  = "applied"
+	StatePending  = "pending"
+	StateModified = "modified" // applied, but the up script changed since
+	StateMissing  = "missing"  // applied, but the script no longer exists
+)
+
+// ErrDrift is returned when the applied migrations do not match the scripts
+var ErrDrift = errors.New("applied migrations do not match the migration scripts")
+
+// AppliedMigration is a row of the schema table
+type AppliedMigration struct {
+	Version       int64
+	Name          string
+	Checksum      string
+	AppliedAt     time.Time
+	ExecutionTime time.Duration
+}
+
+// MigrationStatus is the state of a migration in the database
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	State     string
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back migrations
+type Migrator struct {
+	db    *sql.DB
+	dir   string
+	table string
+}
+
+// New creates a migrator for the scripts in dir
+func New(db *sql.DB, dir string) *Migrator {
+	return &Migrator{db: db, dir: dir, table: DefaultTable}
+}
+
+// Status returns the state of every migration, known or applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Load(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		statuses = status(migrations, applied)
+		return nil
+	})
+	return statuses, err
+}
+
+// Up applies up to n pending migrations in version order, or all of them
+// when n <= 0, and returns the applied migrations
+func (m *Migrator) Up(ctx context.Context, n int) ([]*Migration, error) {
+	migrations, err := Load(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		pending, err := plan(migrations, applied)
+		if err != nil {
+			return err
+		}
+		if n > 0 && n < len(pending) {
+			pending = pending[:n]
+		}
+
+		for _, migration := range pending {
+			start := time.Now()
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration.Label(), err)
+			}
+			log.Printf("✅ Applied migration %s (%s)", migration.Label(), time.Since(start).Round(time.Millisecond))
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the n most recently applied migrations and returns them
+func (m *Migrator) Down(ctx context.Context, n int) ([]*Migration, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("number of migrations to roll back must be positive")
+	}
+
+	migrations, err := Load(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration, len(migrations))
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var done []*Migration
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(applied) - 1; i >= 0 && len(done) < n; i-- {
+			migration, ok := byVersion[applied[i].Version]
+			if !ok {
+				return fmt.Errorf("%w: applied migration %03d_%s has no scripts", ErrDrift, applied[i].Version, applied[i].Name)
+			}
+			if migration.DownFile == "" {
+				return fmt.Errorf("migration %s has no down script", migration.Label())
+			}
+
+			start := time.Now()
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return fmt.Errorf("rollback of %s failed: %w", migration.Label(), err)
+			}
+			log.Printf("↩️  Rolled back migration %s (%s)", migration.Label(), time.Since(start).Round(time.Millisecond))
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Baseline records the migrations up to version as applied without running
+// them, for databases whose schema was created by hand
+func (m *Migrator) Baseline(ctx context.Context, version int64) ([]*Migration, error) {
+	migrations, err := Load(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []*Migration
+	err = m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) > 0 {
+			return fmt.Errorf("cannot baseline, %d migrations are already recorded", len(applied))
+		}
+
+		for _, migration := range migrations {
+			if migration.Version > version {
+				break
+			}
+			if err := m.record(ctx, conn, migration, 0); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// The lock is released with the session if the unlock fails
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		execution_ms BIGINT NOT NULL DEFAULT 0
+	)`, m.table)); err != nil {
+		return fmt.Errorf("failed to create %s table: %w", m.table, err)
+	}
+
+	return fn(conn)
+}
+
+// applied returns the recorded migrations ordered by version
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) ([]AppliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(
+		"SELECT version, name, checksum, applied_at, execution_ms FROM %s ORDER BY version", m.table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	var applied []AppliedMigration
+	for rows.Next() {
+		var row AppliedMigration
+		var executionMs int64
+		if err := rows.Scan(&row.Version, &row.Name, &row.Checksum, &row.AppliedAt, &executionMs); err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		row.ExecutionTime = time.Duration(executionMs) * time.Millisecond
+		applied = append(applied, row)
+	}
+	return applied, rows.Err()
+}
+
+// apply runs an up script and records it. Scripts that cannot run in a
+// transaction are executed statement by statement and recorded once all
+// statements succeeded; they should be idempotent so a failed run can be retried.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	start := time.Now()
+
+	if requiresNoTransaction(migration.Up) {
+		for _, statement := range splitStatements(migration.Up) {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+		return m.record(ctx, conn, migration, time.Since(start))
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, name, checksum, execution_ms) VALUES ($1, $2, $3, $4)", m.table),
+		migration.Version, migration.Name, migration.Checksum(), time.Since(start).Milliseconds()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// revert runs a down script and removes the migration from the schema table
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.table)
+
+	if requiresNoTransaction(migration.Down) {
+		for _, statement := range splitStatements(migration.Down) {
+			if _, err := conn.ExecContext(ctx, statement); err != nil {
+				return err
+			}
+		}
+		_, err := conn.ExecContext(ctx, deleteQuery, migration.Version)
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, deleteQuery, migration.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// record marks a migration as applied
+func (m *Migrator) record(ctx context.Context, conn *sql.Conn, migration *Migration, elapsed time.Duration) error {
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (version, name, checksum, execution_ms) VALUES ($1, $2, $3, $4)", m.table),
+		migration.Version, migration.Name, migration.Checksum(), elapsed.Milliseconds()); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration.Label(), err)
+	}
+	return nil
+}
+
+// plan returns the migrations to apply. It fails on drift: applied scripts
+// that were edited or deleted, or pending scripts older than the latest
+// applied migration, which would otherwise run out of order.
+func plan(migrations []*Migration, applied []AppliedMigration) ([]*Migration, error) {
+	var problems []string
+	appliedVersions := make(map[int64]bool, len(applied))
+	var latest int64
+
+	for _, status := range status(migrations, applied) {
+		switch status.State {
+		case StateModified:
+			problems = append(problems, fmt.Sprintf("%03d_%s was modified after it was applied", status.Version, status.Name))
+		case StateMissing:
+			problems = append(problems, fmt.Sprintf("%03d_%s was applied but its script is missing", status.Version, status.Name))
+		}
+	}
+	for _, row := range applied {
+		appliedVersions[row.Version] = true
+		if row.Version > latest {
+			latest = row.Version
+		}
+	}
+
+	var pending []*Migration
+	for _, migration := range migrations {
+		if appliedVersions[migration.Version] {
+			continue
+		}
+		if migration.Version < latest {
+			problems = append(problems, fmt.Sprintf("%s is pending but older than the applied %03d", migration.Label(), latest))
+		}
+		pending = append(pending, migration)
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDrift, strings.Join(problems, "; "))
+	}
+	return pending, nil
+}
+
+// status merges the migration scripts with the applied migrations
+func status(migrations []*Migration, applied []AppliedMigration) []MigrationStatus {
+	byVersion := make(map[int64]AppliedMigration, len(applied))
+	for _, row := range applied {
+		byVersion[row.Version] = row
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	known := make(map[int64]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		s := MigrationStatus{Version: migration.Version, Name: migration.Name, State: StatePending}
+		if row, ok := byVersion[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			s.AppliedAt = &appliedAt
+			s.State = StateApplied
+			if row.Checksum != migration.Checksum() {
+				s.State = StateModified
+			}
+		}
+		statuses = append(statuses, s)
+	}
+
+	for _, row := range applied {
+		if known[row.Version] {
+			continue
+		}
+		appliedAt := row.AppliedAt
+		statuses = append(statuses, MigrationStatus{Version: row.Version, Name: row.Name, State: StateMissing, AppliedAt: &appliedAt})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+	return statuses
+}
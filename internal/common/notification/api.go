@@ -0,0 +1,119 @@
+package notification
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+)
+
+// NotificationAPI provides HTTP API for WhatsApp and SMS notifications and
+// the delivery reports of their providers
+type NotificationAPI struct {
+	service *Service
+}
+
+// NewNotificationAPI creates a new notification API
+func NewNotificationAPI(service *Service) *NotificationAPI {
+	return &NotificationAPI{
+		service: service,
+	}
+}
+
+// ListNotificationsHandler lists the company's notifications and their
+// delivery status, newest first
+func (na *NotificationAPI) ListNotificationsHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	filters := NotificationFilters{
+		Channel:   c.Query("channel"),
+		Status:    c.Query("status"),
+		Recipient: c.Query("recipient"),
+		Page:      page,
+		Limit:     limit,
+	}
+
+	notifications, total, err := na.service.ListNotifications(c.Request.Context(), c.GetString("company_id"), filters)
+	if err != nil {
+		abortWithNotificationError(c, "Failed to list notifications", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "total": total, "page": page, "limit": limit})
+}
+
+// GetNotificationHandler returns a notification and its delivery status
+func (na *NotificationAPI) GetNotificationHandler(c *gin.Context) {
+	notification, err := na.service.GetNotification(c.Request.Context(), c.GetString("company_id"), c.Param("id"))
+	if err != nil {
+		abortWithNotificationError(c, "Failed to get notification", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notification)
+}
+
+// VerifyWhatsAppWebhookHandler answers the subscription check WhatsApp makes
+// when the webhook URL is configured
+func (na *NotificationAPI) VerifyWhatsAppWebhookHandler(c *gin.Context) {
+	challenge, ok := na.service.VerifyWhatsAppSubscription(c.Query("hub.mode"), c.Query("hub.verify_token"), c.Query("hub.challenge"))
+	if !ok {
+		middleware.AbortWithError(c, apperrors.NewForbiddenError("invalid verify token"))
+		return
+	}
+
+	c.String(http.StatusOK, challenge)
+}
+
+// StatusWebhookHandler receives the signed delivery reports of a channel's
+// provider
+func (na *NotificationAPI) StatusWebhookHandler(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		middleware.AbortWithBadRequest(c, "Failed to read webhook body")
+		return
+	}
+
+	updated, err := na.service.HandleStatusWebhook(c.Request.Context(), c.Param("channel"), c.Request.Header, body)
+	if err != nil {
+		abortWithNotificationError(c, "Failed to process webhook", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    gin.H{"updated": updated},
+	})
+}
+
+// abortWithNotificationError aborts with the service's error, or an
+// internal error
+func abortWithNotificationError(c *gin.Context, message string, err error) {
+	if appErr, ok := err.(*apperrors.AppError); ok {
+		middleware.AbortWithError(c, appErr)
+		return
+	}
+	middleware.AbortWithInternal(c, message, err)
+}
+
+// SetupNotificationRoutes sets up notification API routes. The history
+// holds phone numbers, so only company administrators can read it.
+func SetupNotificationRoutes(r *gin.RouterGroup, api *NotificationAPI) {
+	notifications := r.Group("/notifications", middleware.RoleRequired("super-admin", "owner", "admin"))
+	{
+		notifications.GET("", api.ListNotificationsHandler)
+		notifications.GET("/:id", api.GetNotificationHandler)
+	}
+}
+
+// SetupWebhookRoutes sets up the provider webhook routes, which are
+// authenticated by signature, not JWT
+func SetupWebhookRoutes(r *gin.RouterGroup, api *NotificationAPI) {
+	webhooks := r.Group("/notifications/webhooks")
+	{
+		webhooks.GET("/whatsapp", api.VerifyWhatsAppWebhookHandler)
+		webhooks.POST("/:channel", api.StatusWebhookHandler)
+	}
+}
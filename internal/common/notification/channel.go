@@ -0,0 +1,102 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Message is a message to a phone number. WhatsApp sends the approved
+// template with its parameters; SMS sends the rendered text.
+type Message struct {
+	To       string // +62 phone number
+	Template string
+	Language string
+	Params   []string
+	Text     string
+}
+
+// Channel sends messages to phones through a provider
+type Channel interface {
+	// Name is the channel's name, e.g. models.NotificationChannelWhatsApp
+	Name() string
+	// Send hands a message to the provider and returns the provider's ID of
+	// the message, used to match its status updates
+	Send(ctx context.Context, msg *Message) (string, error)
+}
+
+// StatusUpdate is a delivery report of a sent message
+type StatusUpdate struct {
+	ProviderMessageID string
+	Status            string // sent, delivered, read, failed
+	Error             string
+	Timestamp         time.Time
+}
+
+// PermanentError is a failure that retrying cannot fix, such as a number
+// that is not on WhatsApp or a rejected template
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether a send failure should not be retried
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// postJSON posts a JSON body with a bearer token and returns the response
+// status and body
+func postJSON(ctx context.Context, client *http.Client, url, token string, body interface{}) (int, []byte, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(encoded))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp.StatusCode, payload, nil
+}
+
+// validSignature checks a hex HMAC-SHA256 signature of a body
+func validSignature(secret, signature string, body []byte) bool {
+	if signature == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(signature)))
+}
@@ -0,0 +1,522 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/email"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/realtime"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/validators"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+const (
+	// alertCooldown is how long the same alert about a vehicle is not sent
+	// to the same phone again
+	alertCooldown = 15 * time.Minute
+
+	// alertTimeLayout formats alert times in messages
+	alertTimeLayout = "02/01/2006 15:04"
+)
+
+// alertRecipientRoles are the roles of the users who receive fleet alerts
+var alertRecipientRoles = []string{"owner", "admin", "operator"}
+
+// statusRank orders the statuses a message moves through; failed can follow
+// any status before delivery
+var statusRank = map[string]int{
+	models.NotificationStatusQueued:    0,
+	models.NotificationStatusSent:      1,
+	models.NotificationStatusDelivered: 2,
+	models.NotificationStatusRead:      3,
+}
+
+// Queue delivers recorded notifications in the background, retrying failures
+type Queue interface {
+	EnqueueNotificationDelivery(ctx context.Context, companyID, notificationID string) error
+}
+
+// StatusParser verifies the status webhooks of a channel's provider
+type StatusParser interface {
+	ParseStatuses(header http.Header, body []byte) ([]StatusUpdate, error)
+}
+
+// Service sends WhatsApp and SMS notifications, records them and tracks
+// their delivery
+type Service struct {
+	db       *gorm.DB
+	channels map[string]Channel
+	queue    Queue
+	location *time.Location
+
+	// sentAlerts holds when an alert was last sent to a phone
+	sentAlerts map[string]time.Time
+	alertsMu   sync.Mutex
+}
+
+// Notification is a templated message to a phone
+type Notification struct {
+	CompanyID string
+	UserID    string // recipient user, if any
+	DriverID  string // recipient driver, if any
+	Phone     string
+	Language  string // id or en; Indonesian when empty
+	Channel   string // empty prefers WhatsApp, then SMS
+	Template  string
+	Params    []string
+}
+
+// NotificationFilters filters the notification history
+type NotificationFilters struct {
+	Channel   string
+	Status    string
+	Recipient string
+	Page      int
+	Limit     int
+}
+
+// NewService creates a notification service sending through the configured
+// channels
+func NewService(db *gorm.DB, channels ...Channel) *Service {
+	location, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		location = time.UTC
+	}
+	s := &Service{
+		db:         db,
+		channels:   make(map[string]Channel),
+		location:   location,
+		sentAlerts: make(map[string]time.Time),
+	}
+	for _, channel := range channels {
+		s.channels[channel.Name()] = channel
+	}
+	return s
+}
+
+// SetQueue sets the queue delivering notifications. Without a queue
+// notifications are delivered while sending them.
+func (s *Service) SetQueue(queue Queue) {
+	s.queue = queue
+}
+
+// SetLocation sets the time zone of times in messages
+func (s *Service) SetLocation(location *time.Location) {
+	if location != nil {
+		s.location = location
+	}
+}
+
+// Send records a notification and queues its delivery
+func (s *Service) Send(ctx context.Context, n *Notification) (*models.NotificationMessage, error) {
+	message, err := s.Create(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(ctx, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Create validates and records a notification without sending it
+func (s *Service) Create(ctx context.Context, n *Notification) (*models.NotificationMessage, error) {
+	if err := validators.ValidatePhoneNumber(n.Phone); err != nil {
+		return nil, apperrors.NewValidationError(fmt.Sprintf("invalid phone number %q", n.Phone))
+	}
+	channel := n.Channel
+	if channel == "" {
+		channel = s.preferredChannel()
+	}
+	if _, ok := s.channels[channel]; !ok {
+		return nil, apperrors.NewServiceUnavailableError(fmt.Sprintf("notification channel %q is not configured", channel))
+	}
+
+	params := sanitizeParams(n.Params)
+	language := email.NormalizeLanguage(n.Language)
+	body, err := renderTemplate(n.Template, language, params)
+	if err != nil {
+		return nil, apperrors.NewValidationError(err.Error())
+	}
+
+	message := &models.NotificationMessage{
+		Channel:   channel,
+		Recipient: validators.FormatPhoneNumber(n.Phone),
+		Template:  n.Template,
+		Language:  language,
+		Params:    params,
+		Body:      body,
+		Status:    models.NotificationStatusQueued,
+	}
+	if n.CompanyID != "" {
+		message.CompanyID = &n.CompanyID
+	}
+	if n.UserID != "" {
+		message.UserID = &n.UserID
+	}
+	if n.DriverID != "" {
+		message.DriverID = &n.DriverID
+	}
+
+	if err := s.db.WithContext(ctx).Create(message).Error; err != nil {
+		return nil, fmt.Errorf("failed to record notification: %w", err)
+	}
+	return message, nil
+}
+
+// Deliver hands a recorded notification to its channel. Notifications
+// already sent are not sent again and permanent failures, such as a number
+// without WhatsApp, are not retried. Other failures are returned so the
+// queue retries them, except on the last attempt, which marks the
+// notification failed. WhatsApp messages that fail are sent again by SMS
+// when SMS is configured.
+func (s *Service) Deliver(ctx context.Context, notificationID string, lastAttempt bool) error {
+	var message models.NotificationMessage
+	if err := s.db.WithContext(ctx).First(&message, "id = ?", notificationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to load notification: %w", err)
+	}
+	if message.Status != models.NotificationStatusQueued {
+		return nil
+	}
+	channel, ok := s.channels[message.Channel]
+	if !ok {
+		s.fail(ctx, &message, fmt.Sprintf("notification channel %q is not configured", message.Channel))
+		return nil
+	}
+
+	providerID, err := channel.Send(ctx, &Message{
+		To:       message.Recipient,
+		Template: message.Template,
+		Language: message.Language,
+		Params:   message.Params,
+		Text:     message.Body,
+	})
+	message.Attempts++
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		if updateErr := s.db.WithContext(ctx).Model(&message).Updates(map[string]interface{}{
+			"status":              models.NotificationStatusSent,
+			"attempts":            message.Attempts,
+			"last_error":          "",
+			"provider_message_id": providerID,
+			"sent_at":             now,
+		}).Error; updateErr != nil {
+			fmt.Printf("Failed to record delivery of notification %s: %v\n", message.ID, updateErr)
+		}
+		return nil
+	case IsPermanent(err) || lastAttempt:
+		fmt.Printf("Failed to send %s notification %s to %s: %v\n", message.Channel, message.ID, message.Recipient, err)
+		s.fail(ctx, &message, err.Error())
+		return nil
+	default:
+		if updateErr := s.db.WithContext(ctx).Model(&message).Updates(map[string]interface{}{
+			"attempts":   message.Attempts,
+			"last_error": err.Error(),
+		}).Error; updateErr != nil {
+			fmt.Printf("Failed to record attempt of notification %s: %v\n", message.ID, updateErr)
+		}
+		return fmt.Errorf("failed to send %s notification: %w", message.Channel, err)
+	}
+}
+
+// HandleStatusWebhook applies the delivery reports of a channel's provider
+// and returns how many notifications they updated
+func (s *Service) HandleStatusWebhook(ctx context.Context, channelName string, header http.Header, body []byte) (int, error) {
+	parser, ok := s.channels[channelName].(StatusParser)
+	if !ok {
+		return 0, apperrors.NewNotFoundError("notification channel")
+	}
+	updates, err := parser.ParseStatuses(header, body)
+	if err != nil {
+		return 0, apperrors.NewUnauthorizedError("invalid webhook").WithInternal(err)
+	}
+
+	applied := 0
+	for _, update := range updates {
+		ok, err := s.applyStatus(ctx, channelName, update)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// VerifyWhatsAppSubscription answers the WhatsApp webhook subscription check
+func (s *Service) VerifyWhatsAppSubscription(mode, token, challenge string) (string, bool) {
+	whatsApp, ok := s.channels[models.NotificationChannelWhatsApp].(*WhatsAppChannel)
+	if !ok {
+		return "", false
+	}
+	return whatsApp.VerifySubscription(mode, token, challenge)
+}
+
+// applyStatus moves a notification forward to a reported status. Reports
+// arrive out of order and more than once, so statuses never move back and
+// a failure after delivery is ignored.
+func (s *Service) applyStatus(ctx context.Context, channel string, update StatusUpdate) (bool, error) {
+	var message models.NotificationMessage
+	err := s.db.WithContext(ctx).Where("channel = ? AND provider_message_id = ?", channel, update.ProviderMessageID).
+		First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to load notification: %w", err)
+	}
+	if message.Status == models.NotificationStatusFailed {
+		return false, nil
+	}
+
+	if update.Status == models.NotificationStatusFailed {
+		if statusRank[message.Status] >= statusRank[models.NotificationStatusDelivered] {
+			return false, nil
+		}
+		lastError := update.Error
+		if lastError == "" {
+			lastError = "reported failed by provider"
+		}
+		s.fail(ctx, &message, lastError)
+		return true, nil
+	}
+	if statusRank[update.Status] <= statusRank[message.Status] {
+		return false, nil
+	}
+
+	at := update.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	updates := map[string]interface{}{"status": update.Status}
+	if message.SentAt == nil {
+		updates["sent_at"] = at
+	}
+	if update.Status == models.NotificationStatusDelivered || update.Status == models.NotificationStatusRead {
+		if message.DeliveredAt == nil {
+			updates["delivered_at"] = at
+		}
+	}
+	if update.Status == models.NotificationStatusRead {
+		updates["read_at"] = at
+	}
+	if err := s.db.WithContext(ctx).Model(&message).Updates(updates).Error; err != nil {
+		return false, fmt.Errorf("failed to update notification status: %w", err)
+	}
+	return true, nil
+}
+
+// fail marks a notification failed and falls back from WhatsApp to SMS
+func (s *Service) fail(ctx context.Context, message *models.NotificationMessage, lastError string) {
+	if err := s.db.WithContext(ctx).Model(message).Updates(map[string]interface{}{
+		"status":     models.NotificationStatusFailed,
+		"attempts":   message.Attempts,
+		"last_error": lastError,
+		"failed_at":  time.Now(),
+	}).Error; err != nil {
+		fmt.Printf("Failed to record status of notification %s: %v\n", message.ID, err)
+		return
+	}
+
+	if message.Channel != models.NotificationChannelWhatsApp {
+		return
+	}
+	if _, ok := s.channels[models.NotificationChannelSMS]; !ok {
+		return
+	}
+	fallback := &models.NotificationMessage{
+		CompanyID: message.CompanyID,
+		UserID:    message.UserID,
+		DriverID:  message.DriverID,
+		Channel:   models.NotificationChannelSMS,
+		Recipient: message.Recipient,
+		Template:  message.Template,
+		Language:  message.Language,
+		Params:    message.Params,
+		Body:      message.Body,
+		Status:    models.NotificationStatusQueued,
+	}
+	if err := s.db.WithContext(ctx).Create(fallback).Error; err != nil {
+		fmt.Printf("Failed to record SMS fallback of notification %s: %v\n", message.ID, err)
+		return
+	}
+	if err := s.enqueue(ctx, fallback); err != nil {
+		fmt.Printf("Failed to queue SMS fallback of notification %s: %v\n", message.ID, err)
+	}
+}
+
+// enqueue queues the delivery of a recorded notification, or delivers it
+// when there is no queue
+func (s *Service) enqueue(ctx context.Context, message *models.NotificationMessage) error {
+	if s.queue == nil {
+		return s.Deliver(ctx, message.ID, true)
+	}
+	companyID := ""
+	if message.CompanyID != nil {
+		companyID = *message.CompanyID
+	}
+	if err := s.queue.EnqueueNotificationDelivery(ctx, companyID, message.ID); err != nil {
+		if updateErr := s.db.WithContext(ctx).Model(message).Updates(map[string]interface{}{
+			"status":     models.NotificationStatusFailed,
+			"last_error": fmt.Sprintf("failed to queue notification: %v", err),
+			"failed_at":  time.Now(),
+		}).Error; updateErr != nil {
+			fmt.Printf("Failed to record status of notification %s: %v\n", message.ID, updateErr)
+		}
+		return fmt.Errorf("failed to queue notification: %w", err)
+	}
+	return nil
+}
+
+// preferredChannel is WhatsApp when configured, otherwise SMS
+func (s *Service) preferredChannel() string {
+	if _, ok := s.channels[models.NotificationChannelWhatsApp]; ok {
+		return models.NotificationChannelWhatsApp
+	}
+	return models.NotificationChannelSMS
+}
+
+// ListNotifications lists a company's notifications, newest first
+func (s *Service) ListNotifications(ctx context.Context, companyID string, filters NotificationFilters) ([]models.NotificationMessage, int64, error) {
+	if filters.Page < 1 {
+		filters.Page = 1
+	}
+	if filters.Limit < 1 || filters.Limit > 100 {
+		filters.Limit = 20
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.NotificationMessage{}).Where("company_id = ?", companyID)
+	if filters.Channel != "" {
+		query = query.Where("channel = ?", filters.Channel)
+	}
+	if filters.Status != "" {
+		query = query.Where("status = ?", filters.Status)
+	}
+	if filters.Recipient != "" {
+		query = query.Where("recipient = ?", validators.FormatPhoneNumber(filters.Recipient))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	var messages []models.NotificationMessage
+	if err := query.Order("created_at DESC").Offset((filters.Page - 1) * filters.Limit).Limit(filters.Limit).
+		Find(&messages).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	return messages, total, nil
+}
+
+// GetNotification returns one of a company's notifications
+func (s *Service) GetNotification(ctx context.Context, companyID, id string) (*models.NotificationMessage, error) {
+	var message models.NotificationMessage
+	if err := s.db.WithContext(ctx).Where("id = ? AND company_id = ?", id, companyID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("notification")
+		}
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+	return &message, nil
+}
+
+// NotifyAlert sends high and critical fleet alerts to the phones of the
+// company's owners, admins and operators, or of the user the alert is for,
+// and of the driver involved. The same alert about a vehicle is sent to a
+// phone at most once per cooldown.
+func (s *Service) NotifyAlert(ctx context.Context, alert *realtime.Alert) error {
+	if alert.Severity != realtime.AlertSeverityHigh && alert.Severity != realtime.AlertSeverityCritical {
+		return nil
+	}
+
+	var users []models.User
+	query := s.db.WithContext(ctx).Select("id", "phone", "language").
+		Where("company_id = ? AND is_active = ? AND phone <> ''", alert.CompanyID, true)
+	if alert.UserID != "" {
+		query = query.Where("id = ?", alert.UserID)
+	} else {
+		query = query.Where("role IN ?", alertRecipientRoles)
+	}
+	if err := query.Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to load alert recipients: %w", err)
+	}
+
+	recipients := make([]Notification, 0, len(users)+1)
+	for _, user := range users {
+		recipients = append(recipients, Notification{UserID: user.ID, Phone: user.Phone, Language: user.Language})
+	}
+	if alert.DriverID != "" {
+		var driver models.Driver
+		if err := s.db.WithContext(ctx).Select("id", "phone").
+			Where("id = ? AND company_id = ?", alert.DriverID, alert.CompanyID).First(&driver).Error; err == nil && driver.Phone != "" {
+			recipients = append(recipients, Notification{DriverID: driver.ID, Phone: driver.Phone})
+		}
+	}
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	vehicle := "-"
+	if alert.VehicleID != "" {
+		var v models.Vehicle
+		if err := s.db.WithContext(ctx).Select("license_plate").First(&v, "id = ?", alert.VehicleID).Error; err == nil {
+			vehicle = v.LicensePlate
+		}
+	}
+	at := alert.Timestamp
+	if at.IsZero() {
+		at = time.Now()
+	}
+	params := []string{alert.Title, vehicle, alert.Message, at.In(s.location).Format(alertTimeLayout)}
+
+	var errs []error
+	sent := make(map[string]bool)
+	for _, recipient := range recipients {
+		phone := validators.FormatPhoneNumber(recipient.Phone)
+		if sent[phone] || !s.claimAlert(alert, phone) {
+			continue
+		}
+		sent[phone] = true
+
+		recipient.CompanyID = alert.CompanyID
+		recipient.Template = TemplateFleetAlert
+		recipient.Params = params
+		if _, err := s.Send(ctx, &recipient); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", phone, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// claimAlert reports whether an alert may be sent to a phone, and if so
+// starts its cooldown
+func (s *Service) claimAlert(alert *realtime.Alert, phone string) bool {
+	key := alert.CompanyID + "|" + alert.Type + "|" + alert.VehicleID + "|" + phone
+	now := time.Now()
+
+	s.alertsMu.Lock()
+	defer s.alertsMu.Unlock()
+	if last, ok := s.sentAlerts[key]; ok && now.Sub(last) < alertCooldown {
+		return false
+	}
+	for k, last := range s.sentAlerts {
+		if now.Sub(last) >= alertCooldown {
+			delete(s.sentAlerts, k)
+		}
+	}
+	s.sentAlerts[key] = now
+	return true
+}
@@ -0,0 +1,116 @@
+package notification
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/realtime"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	params := []string{"Speed Violation Detected", "B 1234 ABC", "Vehicle exceeded speed limit by 22.0 km/h", "03/06/2024 14:00"}
+
+	indonesian, err := renderTemplate(TemplateFleetAlert, "id", params)
+	require.NoError(t, err)
+	assert.Equal(t, "Peringatan FleetTracker: Speed Violation Detected\nKendaraan: B 1234 ABC\n"+
+		"Vehicle exceeded speed limit by 22.0 km/h\nWaktu: 03/06/2024 14:00", indonesian)
+
+	english, err := renderTemplate(TemplateFleetAlert, "en-US", params)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(english, "FleetTracker alert: Speed Violation Detected\nVehicle: B 1234 ABC"))
+
+	_, err = renderTemplate(TemplateFleetAlert, "id", params[:3])
+	assert.Error(t, err)
+	_, err = renderTemplate("welcome", "id", nil)
+	assert.Error(t, err)
+}
+
+func TestSanitizeParams(t *testing.T) {
+	long := strings.Repeat("a", maxParamLength+10)
+	params := sanitizeParams([]string{"line one\nline two\t end", "   ", long})
+
+	assert.Equal(t, "line one line two end", params[0])
+	assert.Equal(t, "-", params[1])
+	assert.Equal(t, maxParamLength, len([]rune(params[2])))
+}
+
+func TestService_CreateValidation(t *testing.T) {
+	whatsApp, err := NewWhatsAppChannel(WhatsAppConfig{APIURL: "http://127.0.0.1", AccessToken: "token", PhoneNumberID: "1055"})
+	require.NoError(t, err)
+	service := NewService(nil, whatsApp)
+	params := []string{"Alert", "B 1234 ABC", "Message", "03/06/2024 14:00"}
+
+	_, err = service.Create(context.Background(), &Notification{Phone: "12345", Template: TemplateFleetAlert, Params: params})
+	assertAppError(t, err, http.StatusBadRequest)
+
+	_, err = service.Create(context.Background(), &Notification{Phone: "081234567890", Channel: models.NotificationChannelSMS,
+		Template: TemplateFleetAlert, Params: params})
+	assertAppError(t, err, http.StatusServiceUnavailable)
+
+	_, err = service.Create(context.Background(), &Notification{Phone: "081234567890", Template: "welcome"})
+	assertAppError(t, err, http.StatusBadRequest)
+}
+
+func TestService_PreferredChannel(t *testing.T) {
+	whatsApp, err := NewWhatsAppChannel(WhatsAppConfig{APIURL: "http://127.0.0.1", AccessToken: "token", PhoneNumberID: "1055"})
+	require.NoError(t, err)
+	sms, err := NewSMSChannel(SMSConfig{APIURL: "http://127.0.0.1", APIKey: "key"})
+	require.NoError(t, err)
+
+	assert.Equal(t, models.NotificationChannelWhatsApp, NewService(nil, sms, whatsApp).preferredChannel())
+	assert.Equal(t, models.NotificationChannelSMS, NewService(nil, sms).preferredChannel())
+}
+
+func TestService_HandleStatusWebhookErrors(t *testing.T) {
+	sms, err := NewSMSChannel(SMSConfig{APIURL: "http://127.0.0.1", APIKey: "key", WebhookSecret: "secret"})
+	require.NoError(t, err)
+	service := NewService(nil, sms)
+
+	_, err = service.HandleStatusWebhook(context.Background(), models.NotificationChannelWhatsApp, http.Header{}, []byte(`{}`))
+	assertAppError(t, err, http.StatusNotFound)
+
+	_, err = service.HandleStatusWebhook(context.Background(), models.NotificationChannelSMS, http.Header{}, []byte(`{}`))
+	assertAppError(t, err, http.StatusUnauthorized)
+
+	_, ok := service.VerifyWhatsAppSubscription("subscribe", "token", "challenge")
+	assert.False(t, ok)
+}
+
+func TestService_NotifyAlertSkipsLowSeverity(t *testing.T) {
+	service := NewService(nil)
+	for _, severity := range []string{realtime.AlertSeverityLow, realtime.AlertSeverityMedium} {
+		assert.NoError(t, service.NotifyAlert(context.Background(), &realtime.Alert{CompanyID: "c1", Severity: severity}))
+	}
+}
+
+func TestService_ClaimAlertCooldown(t *testing.T) {
+	service := NewService(nil)
+	alert := &realtime.Alert{CompanyID: "c1", Type: realtime.AlertTypeSpeedViolation, VehicleID: "v1"}
+
+	assert.True(t, service.claimAlert(alert, "+6281234567890"))
+	assert.False(t, service.claimAlert(alert, "+6281234567890"))
+	assert.True(t, service.claimAlert(alert, "+6281234567891"))
+
+	other := *alert
+	other.VehicleID = "v2"
+	assert.True(t, service.claimAlert(&other, "+6281234567890"))
+
+	key := alert.CompanyID + "|" + alert.Type + "|" + alert.VehicleID + "|+6281234567890"
+	service.sentAlerts[key] = service.sentAlerts[key].Add(-alertCooldown)
+	assert.True(t, service.claimAlert(alert, "+6281234567890"))
+}
+
+func assertAppError(t *testing.T, err error, status int) {
+	t.Helper()
+	require.Error(t, err)
+	appErr, ok := err.(*apperrors.AppError)
+	require.True(t, ok, "expected an AppError, got %v", err)
+	assert.Equal(t, status, appErr.Status)
+}
@@ -0,0 +1,177 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// SMSSignatureHeader carries the hex HMAC-SHA256 of a delivery report body,
+// signed with the webhook secret
+const SMSSignatureHeader = "X-SMS-Signature"
+
+// SMSConfig configures the SMS channel
+type SMSConfig struct {
+	APIURL        string // e.g. https://api.sms-gateway.id
+	APIKey        string
+	SenderID      string // alphanumeric sender shown to the recipient
+	WebhookSecret string // verifies delivery reports
+}
+
+// SMSChannel sends text messages through an SMS gateway with a generic HTTP
+// API: POST {api_url}/v1/messages with a bearer API key and
+// {"to", "message", "sender_id"}, answered with {"message_id", "status"}.
+// Delivery reports are posted back as {"message_id", "status", "error",
+// "timestamp"}, one report or an array of them.
+type SMSChannel struct {
+	config SMSConfig
+	client *http.Client
+}
+
+// smsReport is a delivery report of the SMS gateway
+type smsReport struct {
+	MessageID string          `json:"message_id"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error"`
+	Timestamp json.RawMessage `json:"timestamp"`
+}
+
+// NewSMSChannel creates an SMS channel
+func NewSMSChannel(config SMSConfig) (*SMSChannel, error) {
+	if config.APIURL == "" || config.APIKey == "" {
+		return nil, fmt.Errorf("SMS API URL and API key are required")
+	}
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+	return &SMSChannel{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name returns the channel name
+func (s *SMSChannel) Name() string {
+	return models.NotificationChannelSMS
+}
+
+// Send sends the message text
+func (s *SMSChannel) Send(ctx context.Context, msg *Message) (string, error) {
+	if strings.TrimSpace(msg.Text) == "" {
+		return "", &PermanentError{Err: errors.New("SMS messages need a text")}
+	}
+	body := map[string]string{
+		"to":      msg.To,
+		"message": msg.Text,
+	}
+	if s.config.SenderID != "" {
+		body["sender_id"] = s.config.SenderID
+	}
+
+	status, payload, err := postJSON(ctx, s.client, s.config.APIURL+"/v1/messages", s.config.APIKey, body)
+	if err != nil {
+		return "", fmt.Errorf("SMS request failed: %w", err)
+	}
+	if status < 200 || status >= 300 {
+		err := fmt.Errorf("SMS gateway returned status %d: %s", status, strings.TrimSpace(string(payload)))
+		if status == http.StatusTooManyRequests || status >= 500 {
+			return "", err
+		}
+		return "", &PermanentError{Err: err}
+	}
+
+	var response struct {
+		MessageID string `json:"message_id"`
+		ID        string `json:"id"`
+		Status    string `json:"status"`
+	}
+	if err := json.Unmarshal(payload, &response); err != nil {
+		return "", fmt.Errorf("unexpected SMS gateway response: %s", strings.TrimSpace(string(payload)))
+	}
+	if smsStatus(response.Status) == models.NotificationStatusFailed {
+		return "", &PermanentError{Err: fmt.Errorf("SMS gateway rejected the message: %s", strings.TrimSpace(string(payload)))}
+	}
+	if response.MessageID == "" {
+		response.MessageID = response.ID
+	}
+	if response.MessageID == "" {
+		return "", fmt.Errorf("unexpected SMS gateway response: %s", strings.TrimSpace(string(payload)))
+	}
+	return response.MessageID, nil
+}
+
+// ParseStatuses verifies a delivery report webhook and returns the message
+// statuses in it
+func (s *SMSChannel) ParseStatuses(header http.Header, body []byte) ([]StatusUpdate, error) {
+	if s.config.WebhookSecret == "" {
+		return nil, errors.New("no SMS webhook secret configured")
+	}
+	if !validSignature(s.config.WebhookSecret, header.Get(SMSSignatureHeader), body) {
+		return nil, errors.New("SMS webhook signature mismatch")
+	}
+
+	var reports []smsReport
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &reports); err != nil {
+			return nil, fmt.Errorf("invalid SMS webhook payload: %w", err)
+		}
+	} else {
+		var report smsReport
+		if err := json.Unmarshal(trimmed, &report); err != nil {
+			return nil, fmt.Errorf("invalid SMS webhook payload: %w", err)
+		}
+		reports = append(reports, report)
+	}
+
+	var updates []StatusUpdate
+	for _, report := range reports {
+		status := smsStatus(report.Status)
+		if report.MessageID == "" || status == "" {
+			continue
+		}
+		updates = append(updates, StatusUpdate{
+			ProviderMessageID: report.MessageID,
+			Status:            status,
+			Error:             report.Error,
+			Timestamp:         parseReportTime(report.Timestamp),
+		})
+	}
+	return updates, nil
+}
+
+// smsStatus maps the statuses used by SMS gateways to notification
+// statuses, or returns "" for statuses that say nothing new
+func smsStatus(status string) string {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "sent", "submitted", "accepted", "queued", "enroute":
+		return models.NotificationStatusSent
+	case "delivered", "delivrd":
+		return models.NotificationStatusDelivered
+	case "failed", "undelivered", "undeliv", "rejected", "rejectd", "expired":
+		return models.NotificationStatusFailed
+	default:
+		return ""
+	}
+}
+
+// parseReportTime reads a report timestamp given as RFC 3339 or Unix seconds
+func parseReportTime(raw json.RawMessage) time.Time {
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		text = string(raw)
+	}
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t
+	}
+	if unix, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return time.Unix(unix, 0)
+	}
+	return time.Time{}
+}
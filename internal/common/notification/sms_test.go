@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+func testSMSChannel(t *testing.T, handler http.HandlerFunc) *SMSChannel {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	channel, err := NewSMSChannel(SMSConfig{
+		APIURL:        server.URL,
+		APIKey:        "sms-key",
+		SenderID:      "FleetTrack",
+		WebhookSecret: "sms-secret",
+	})
+	require.NoError(t, err)
+	return channel
+}
+
+func TestSMSChannel_Send(t *testing.T) {
+	var path, auth string
+	var body map[string]string
+	channel := testSMSChannel(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(data, &body))
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"message_id":"sms-42","status":"queued"}`))
+	})
+
+	id, err := channel.Send(context.Background(), &Message{To: "+6281234567890", Text: "Peringatan FleetTracker"})
+	require.NoError(t, err)
+	assert.Equal(t, "sms-42", id)
+	assert.Equal(t, "/v1/messages", path)
+	assert.Equal(t, "Bearer sms-key", auth)
+	assert.Equal(t, map[string]string{
+		"to":        "+6281234567890",
+		"message":   "Peringatan FleetTracker",
+		"sender_id": "FleetTrack",
+	}, body)
+}
+
+func TestSMSChannel_SendErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		permanent bool
+	}{
+		{"invalid number", http.StatusUnprocessableEntity, `{"error":"invalid destination"}`, true},
+		{"rejected", http.StatusOK, `{"message_id":"sms-43","status":"rejected"}`, true},
+		{"rate limited", http.StatusTooManyRequests, `{"error":"slow down"}`, false},
+		{"outage", http.StatusBadGateway, `bad gateway`, false},
+		{"no message id", http.StatusOK, `{"status":"queued"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := testSMSChannel(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			_, err := channel.Send(context.Background(), &Message{To: "+6281234567890", Text: "Halo"})
+			require.Error(t, err)
+			assert.Equal(t, tt.permanent, IsPermanent(err))
+		})
+	}
+
+	channel := testSMSChannel(t, nil)
+	_, err := channel.Send(context.Background(), &Message{To: "+6281234567890"})
+	assert.True(t, IsPermanent(err), "empty text")
+}
+
+func TestSMSChannel_ParseStatuses(t *testing.T) {
+	channel := testSMSChannel(t, nil)
+
+	body := []byte(`{"message_id":"sms-42","status":"DELIVRD","timestamp":"2024-06-03T07:00:00Z"}`)
+	header := http.Header{}
+	header.Set(SMSSignatureHeader, sign("sms-secret", body))
+	updates, err := channel.ParseStatuses(header, body)
+	require.NoError(t, err)
+	assert.Equal(t, []StatusUpdate{{
+		ProviderMessageID: "sms-42",
+		Status:            models.NotificationStatusDelivered,
+		Timestamp:         time.Date(2024, 6, 3, 7, 0, 0, 0, time.UTC),
+	}}, updates)
+
+	body = []byte(`[
+		{"message_id":"sms-43","status":"undelivered","error":"absent subscriber","timestamp":1717398000},
+		{"message_id":"sms-44","status":"unknown"}
+	]`)
+	header.Set(SMSSignatureHeader, sign("sms-secret", body))
+	updates, err = channel.ParseStatuses(header, body)
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	assert.Equal(t, models.NotificationStatusFailed, updates[0].Status)
+	assert.Equal(t, "absent subscriber", updates[0].Error)
+	assert.Equal(t, time.Unix(1717398000, 0), updates[0].Timestamp)
+
+	header.Set(SMSSignatureHeader, sign("wrong", body))
+	_, err = channel.ParseStatuses(header, body)
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package notification
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/email"
+)
+
+// Notification templates. WhatsApp needs templates with the same names,
+// languages (id, en) and bodies approved in WhatsApp Manager.
+const (
+	// TemplateFleetAlert: alert title, vehicle, alert message, time
+	TemplateFleetAlert = "fleet_alert"
+)
+
+// maxParamLength is the longest WhatsApp accepts for a template parameter
+const maxParamLength = 1024
+
+// template is the body of a notification template in each language, with
+// WhatsApp-style {{1}}, {{2}}... parameter placeholders
+type template struct {
+	params int
+	bodies map[string]string
+}
+
+var templates = map[string]template{
+	TemplateFleetAlert: {
+		params: 4,
+		bodies: map[string]string{
+			email.LanguageIndonesian: "Peringatan FleetTracker: {{1}}\nKendaraan: {{2}}\n{{3}}\nWaktu: {{4}}",
+			email.LanguageEnglish:    "FleetTracker alert: {{1}}\nVehicle: {{2}}\n{{3}}\nTime: {{4}}",
+		},
+	},
+}
+
+// renderTemplate returns the text of a template in a language with its
+// parameters filled in, for channels without templates such as SMS
+func renderTemplate(name, language string, params []string) (string, error) {
+	t, ok := templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown notification template %q", name)
+	}
+	if len(params) != t.params {
+		return "", fmt.Errorf("notification template %q takes %d parameters, got %d", name, t.params, len(params))
+	}
+
+	body := t.bodies[email.NormalizeLanguage(language)]
+	for i := len(params); i >= 1; i-- {
+		body = strings.ReplaceAll(body, "{{"+strconv.Itoa(i)+"}}", params[i-1])
+	}
+	return body, nil
+}
+
+// sanitizeParams makes parameters acceptable to WhatsApp, which rejects
+// parameters that are empty or contain new lines, tabs or more than four
+// spaces in a row
+func sanitizeParams(params []string) []string {
+	sanitized := make([]string, len(params))
+	for i, param := range params {
+		param = strings.Join(strings.Fields(param), " ")
+		if param == "" {
+			param = "-"
+		}
+		if runes := []rune(param); len(runes) > maxParamLength {
+			param = string(runes[:maxParamLength-1]) + "…"
+		}
+		sanitized[i] = param
+	}
+	return sanitized
+}
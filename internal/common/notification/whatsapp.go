@@ -0,0 +1,224 @@
+package notification
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// WhatsAppSignatureHeader carries the "sha256=<hex>" HMAC of a status
+// webhook body, signed with the app secret
+const WhatsAppSignatureHeader = "X-Hub-Signature-256"
+
+// whatsAppRetryableCodes are Cloud API error codes worth retrying: rate
+// limits and temporary outages. Other client errors are permanent.
+var whatsAppRetryableCodes = map[int]bool{
+	4:      true, // application request limit
+	80007:  true, // account rate limit
+	130429: true, // throughput limit
+	131000: true, // something went wrong
+	131016: true, // service unavailable
+	131048: true, // spam rate limit
+	131056: true, // pair rate limit
+	133004: true, // server temporarily unavailable
+}
+
+// WhatsAppConfig configures the WhatsApp Cloud API channel
+type WhatsAppConfig struct {
+	APIURL        string // e.g. https://graph.facebook.com/v18.0
+	AccessToken   string
+	PhoneNumberID string // business phone number messages are sent from
+	AppSecret     string // verifies status webhooks
+	VerifyToken   string // answers the webhook subscription check
+}
+
+// WhatsAppChannel sends approved template messages through the WhatsApp
+// Cloud API
+type WhatsAppChannel struct {
+	config WhatsAppConfig
+	client *http.Client
+}
+
+// whatsAppError is the error body of the Cloud API
+type whatsAppError struct {
+	Error struct {
+		Message   string `json:"message"`
+		Code      int    `json:"code"`
+		ErrorData struct {
+			Details string `json:"details"`
+		} `json:"error_data"`
+	} `json:"error"`
+}
+
+// whatsAppWebhook is the body of a Cloud API webhook; only message statuses
+// are read
+type whatsAppWebhook struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		Changes []struct {
+			Field string `json:"field"`
+			Value struct {
+				Statuses []struct {
+					ID        string `json:"id"`
+					Status    string `json:"status"`
+					Timestamp string `json:"timestamp"`
+					Errors    []struct {
+						Code    int    `json:"code"`
+						Title   string `json:"title"`
+						Message string `json:"message"`
+					} `json:"errors"`
+				} `json:"statuses"`
+			} `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+// NewWhatsAppChannel creates a WhatsApp channel
+func NewWhatsAppChannel(config WhatsAppConfig) (*WhatsAppChannel, error) {
+	if config.APIURL == "" || config.AccessToken == "" || config.PhoneNumberID == "" {
+		return nil, fmt.Errorf("WhatsApp API URL, access token and phone number ID are required")
+	}
+	config.APIURL = strings.TrimRight(config.APIURL, "/")
+	return &WhatsAppChannel{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name returns the channel name
+func (w *WhatsAppChannel) Name() string {
+	return models.NotificationChannelWhatsApp
+}
+
+// Send sends a template message. Business-initiated WhatsApp messages must
+// use a template approved in WhatsApp Manager with the same name, language
+// and number of parameters.
+func (w *WhatsAppChannel) Send(ctx context.Context, msg *Message) (string, error) {
+	if msg.Template == "" {
+		return "", &PermanentError{Err: errors.New("WhatsApp messages need a template")}
+	}
+
+	parameters := make([]map[string]string, 0, len(msg.Params))
+	for _, param := range msg.Params {
+		parameters = append(parameters, map[string]string{"type": "text", "text": param})
+	}
+	template := map[string]interface{}{
+		"name":     msg.Template,
+		"language": map[string]string{"code": msg.Language},
+	}
+	if len(parameters) > 0 {
+		template["components"] = []map[string]interface{}{{"type": "body", "parameters": parameters}}
+	}
+	body := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                strings.TrimPrefix(msg.To, "+"),
+		"type":              "template",
+		"template":          template,
+	}
+
+	status, payload, err := postJSON(ctx, w.client, w.config.APIURL+"/"+w.config.PhoneNumberID+"/messages", w.config.AccessToken, body)
+	if err != nil {
+		return "", fmt.Errorf("WhatsApp request failed: %w", err)
+	}
+	if status < 200 || status >= 300 {
+		return "", whatsAppSendError(status, payload)
+	}
+
+	var response struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(payload, &response); err != nil || len(response.Messages) == 0 || response.Messages[0].ID == "" {
+		return "", fmt.Errorf("unexpected WhatsApp response: %s", strings.TrimSpace(string(payload)))
+	}
+	return response.Messages[0].ID, nil
+}
+
+// VerifySubscription answers the webhook subscription check, returning the
+// challenge to echo when the verify token matches
+func (w *WhatsAppChannel) VerifySubscription(mode, token, challenge string) (string, bool) {
+	if w.config.VerifyToken == "" || mode != "subscribe" ||
+		!hmac.Equal([]byte(token), []byte(w.config.VerifyToken)) {
+		return "", false
+	}
+	return challenge, true
+}
+
+// ParseStatuses verifies a status webhook and returns the message statuses
+// in it
+func (w *WhatsAppChannel) ParseStatuses(header http.Header, body []byte) ([]StatusUpdate, error) {
+	if w.config.AppSecret == "" {
+		return nil, errors.New("no WhatsApp app secret configured")
+	}
+	signature := strings.TrimPrefix(header.Get(WhatsAppSignatureHeader), "sha256=")
+	if !validSignature(w.config.AppSecret, signature, body) {
+		return nil, errors.New("WhatsApp webhook signature mismatch")
+	}
+
+	var webhook whatsAppWebhook
+	if err := json.Unmarshal(body, &webhook); err != nil {
+		return nil, fmt.Errorf("invalid WhatsApp webhook payload: %w", err)
+	}
+
+	var updates []StatusUpdate
+	for _, entry := range webhook.Entry {
+		for _, change := range entry.Changes {
+			for _, status := range change.Value.Statuses {
+				update := StatusUpdate{ProviderMessageID: status.ID}
+				switch status.Status {
+				case "sent":
+					update.Status = models.NotificationStatusSent
+				case "delivered":
+					update.Status = models.NotificationStatusDelivered
+				case "read":
+					update.Status = models.NotificationStatusRead
+				case "failed":
+					update.Status = models.NotificationStatusFailed
+				default:
+					continue
+				}
+				if unix, err := strconv.ParseInt(status.Timestamp, 10, 64); err == nil {
+					update.Timestamp = time.Unix(unix, 0)
+				}
+				for _, statusErr := range status.Errors {
+					message := statusErr.Message
+					if message == "" {
+						message = statusErr.Title
+					}
+					update.Error = fmt.Sprintf("%d: %s", statusErr.Code, message)
+				}
+				updates = append(updates, update)
+			}
+		}
+	}
+	return updates, nil
+}
+
+// whatsAppSendError turns an error response into an error, permanent unless
+// it is a rate limit or outage
+func whatsAppSendError(status int, payload []byte) error {
+	var parsed whatsAppError
+	message := strings.TrimSpace(string(payload))
+	if err := json.Unmarshal(payload, &parsed); err == nil && parsed.Error.Message != "" {
+		message = fmt.Sprintf("%d: %s", parsed.Error.Code, parsed.Error.Message)
+		if parsed.Error.ErrorData.Details != "" {
+			message += " (" + parsed.Error.ErrorData.Details + ")"
+		}
+	}
+	err := fmt.Errorf("WhatsApp returned status %d: %s", status, message)
+
+	if status == http.StatusTooManyRequests || status >= 500 || whatsAppRetryableCodes[parsed.Error.Code] {
+		return err
+	}
+	return &PermanentError{Err: err}
+}
@@ -0,0 +1,148 @@
+package notification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func testWhatsAppChannel(t *testing.T, handler http.HandlerFunc) *WhatsAppChannel {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	channel, err := NewWhatsAppChannel(WhatsAppConfig{
+		APIURL:        server.URL + "/v18.0/",
+		AccessToken:   "token",
+		PhoneNumberID: "1055",
+		AppSecret:     "app-secret",
+		VerifyToken:   "verify-me",
+	})
+	require.NoError(t, err)
+	return channel
+}
+
+func TestWhatsAppChannel_Send(t *testing.T) {
+	var path, auth string
+	var body map[string]interface{}
+	channel := testWhatsAppChannel(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(data, &body))
+		w.Write([]byte(`{"messaging_product":"whatsapp","contacts":[{"input":"6281234567890","wa_id":"6281234567890"}],"messages":[{"id":"wamid.HBgM"}]}`))
+	})
+
+	id, err := channel.Send(context.Background(), &Message{
+		To:       "+6281234567890",
+		Template: TemplateFleetAlert,
+		Language: "id",
+		Params:   []string{"Speed Violation Detected", "B 1234 ABC", "Melebihi batas", "03/06/2024 14:00"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "wamid.HBgM", id)
+	assert.Equal(t, "/v18.0/1055/messages", path)
+	assert.Equal(t, "Bearer token", auth)
+	assert.Equal(t, "6281234567890", body["to"])
+	assert.Equal(t, "template", body["type"])
+
+	template := body["template"].(map[string]interface{})
+	assert.Equal(t, TemplateFleetAlert, template["name"])
+	assert.Equal(t, map[string]interface{}{"code": "id"}, template["language"])
+	components := template["components"].([]interface{})
+	require.Len(t, components, 1)
+	parameters := components[0].(map[string]interface{})["parameters"].([]interface{})
+	require.Len(t, parameters, 4)
+	assert.Equal(t, map[string]interface{}{"type": "text", "text": "B 1234 ABC"}, parameters[1])
+}
+
+func TestWhatsAppChannel_SendErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		permanent bool
+	}{
+		{"not on WhatsApp", http.StatusBadRequest, `{"error":{"message":"Recipient phone number not in allowed list","code":131030}}`, true},
+		{"template missing", http.StatusBadRequest, `{"error":{"message":"Template name does not exist in the translation","code":132001}}`, true},
+		{"spam rate limit", http.StatusBadRequest, `{"error":{"message":"Spam rate limit hit","code":131048}}`, false},
+		{"too many requests", http.StatusTooManyRequests, `{"error":{"message":"Rate limit","code":130429}}`, false},
+		{"outage", http.StatusInternalServerError, `upstream error`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := testWhatsAppChannel(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			_, err := channel.Send(context.Background(), &Message{To: "+6281234567890", Template: TemplateFleetAlert, Language: "id"})
+			require.Error(t, err)
+			assert.Equal(t, tt.permanent, IsPermanent(err))
+		})
+	}
+}
+
+func TestWhatsAppChannel_VerifySubscription(t *testing.T) {
+	channel := testWhatsAppChannel(t, nil)
+
+	challenge, ok := channel.VerifySubscription("subscribe", "verify-me", "1158201444")
+	assert.True(t, ok)
+	assert.Equal(t, "1158201444", challenge)
+
+	_, ok = channel.VerifySubscription("subscribe", "wrong", "1158201444")
+	assert.False(t, ok)
+	_, ok = channel.VerifySubscription("unsubscribe", "verify-me", "1158201444")
+	assert.False(t, ok)
+}
+
+func TestWhatsAppChannel_ParseStatuses(t *testing.T) {
+	channel := testWhatsAppChannel(t, nil)
+	body := []byte(`{"object":"whatsapp_business_account","entry":[{"id":"1","changes":[{"field":"messages","value":{
+		"messaging_product":"whatsapp",
+		"statuses":[
+			{"id":"wamid.1","status":"delivered","timestamp":"1717398000","recipient_id":"6281234567890"},
+			{"id":"wamid.2","status":"failed","timestamp":"1717398060","recipient_id":"6281234567891","errors":[{"code":131026,"title":"Message undeliverable"}]},
+			{"id":"wamid.3","status":"deleted","timestamp":"1717398060"}
+		]}}]}]}`)
+	header := http.Header{}
+	header.Set(WhatsAppSignatureHeader, "sha256="+sign("app-secret", body))
+
+	updates, err := channel.ParseStatuses(header, body)
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	assert.Equal(t, StatusUpdate{
+		ProviderMessageID: "wamid.1",
+		Status:            models.NotificationStatusDelivered,
+		Timestamp:         time.Unix(1717398000, 0),
+	}, updates[0])
+	assert.Equal(t, models.NotificationStatusFailed, updates[1].Status)
+	assert.Equal(t, "131026: Message undeliverable", updates[1].Error)
+
+	header.Set(WhatsAppSignatureHeader, "sha256="+sign("other-secret", body))
+	_, err = channel.ParseStatuses(header, body)
+	assert.Error(t, err)
+
+	_, err = channel.ParseStatuses(http.Header{}, body)
+	assert.Error(t, err)
+}
+
+func TestNewWhatsAppChannel_RequiresCredentials(t *testing.T) {
+	_, err := NewWhatsAppChannel(WhatsAppConfig{APIURL: "https://graph.facebook.com/v18.0", AccessToken: "token"})
+	assert.Error(t, err)
+}
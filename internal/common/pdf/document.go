@@ -0,0 +1,349 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size in points (1/72 inch)
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Font is one of the standard PDF Type1 fonts. Standard fonts need no
+// embedding, which keeps generated documents small and dependency free.
+type Font int
+
+// Supported standard fonts
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+// fontNames are the PostScript names of the fonts, in Font order
+var fontNames = []string{"Helvetica", "Helvetica-Bold"}
+
+// Document builds a PDF document page by page. Coordinates are in points
+// with the origin at the top left corner of the page; y grows downwards and
+// refers to the text baseline for text operations. Finished pages are kept
+// compressed, so long documents stay small in memory.
+type Document struct {
+	pages    [][]byte
+	current  *bytes.Buffer
+	width    float64
+	height   float64
+	font     Font
+	fontSize float64
+	title    string
+	err      error
+}
+
+// New creates an empty A4 portrait document
+func New() *Document {
+	return &Document{width: PageWidth, height: PageHeight, font: Helvetica, fontSize: 10}
+}
+
+// NewLandscape creates an empty A4 landscape document
+func NewLandscape() *Document {
+	return &Document{width: PageHeight, height: PageWidth, font: Helvetica, fontSize: 10}
+}
+
+// Width returns the page width
+func (d *Document) Width() float64 {
+	return d.width
+}
+
+// Height returns the page height
+func (d *Document) Height() float64 {
+	return d.height
+}
+
+// SetTitle sets the document title shown by PDF viewers
+func (d *Document) SetTitle(title string) {
+	d.title = title
+}
+
+// AddPage starts a new page; drawing operations go to the newest page
+func (d *Document) AddPage() {
+	if d.current != nil {
+		d.finishPage()
+	}
+	d.current = &bytes.Buffer{}
+}
+
+// PageCount returns the number of pages added so far
+func (d *Document) PageCount() int {
+	if d.current == nil {
+		return len(d.pages)
+	}
+	return len(d.pages) + 1
+}
+
+// SetFont sets the font used by subsequent text operations
+func (d *Document) SetFont(font Font, size float64) {
+	d.font = font
+	d.fontSize = size
+}
+
+// FontSize returns the current font size
+func (d *Document) FontSize() float64 {
+	return d.fontSize
+}
+
+// Text draws text with its left edge at x and its baseline at y
+func (d *Document) Text(x, y float64, text string) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "BT /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		d.font+1, num(d.fontSize), num(x), num(d.height-y), escapeText(text))
+}
+
+// TextRight draws text with its right edge at x
+func (d *Document) TextRight(x, y float64, text string) {
+	d.Text(x-d.StringWidth(text), y, text)
+}
+
+// TextCenter draws text centered on x
+func (d *Document) TextCenter(x, y float64, text string) {
+	d.Text(x-d.StringWidth(text)/2, y, text)
+}
+
+// StringWidth returns the width of text in the current font and size
+func (d *Document) StringWidth(text string) float64 {
+	return StringWidth(d.font, d.fontSize, text)
+}
+
+// WrapText splits text into lines no wider than width in the current font.
+// Existing line breaks are kept and words longer than a line are broken.
+func (d *Document) WrapText(text string, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+
+		line := ""
+		for _, word := range words {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if d.StringWidth(candidate) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Break on rune boundaries so multi-byte characters stay whole
+			runes := []rune(word)
+			for d.StringWidth(string(runes)) > width && len(runes) > 1 {
+				cut := len(runes) - 1
+				for cut > 1 && d.StringWidth(string(runes[:cut])) > width {
+					cut--
+				}
+				lines = append(lines, string(runes[:cut]))
+				runes = runes[cut:]
+			}
+			line = string(runes)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// SetLineWidth sets the stroke width of lines and rectangles
+func (d *Document) SetLineWidth(width float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "%s w\n", num(width))
+}
+
+// SetStrokeGray sets the stroke color as a gray level from 0 (black) to 1 (white)
+func (d *Document) SetStrokeGray(gray float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "%s G\n", num(gray))
+}
+
+// SetFillGray sets the fill and text color as a gray level
+func (d *Document) SetFillGray(gray float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "%s g\n", num(gray))
+}
+
+// Line draws a straight line
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "%s %s m %s %s l S\n", num(x1), num(d.height-y1), num(x2), num(d.height-y2))
+}
+
+// Rect strokes a rectangle whose top left corner is at x, y
+func (d *Document) Rect(x, y, width, height float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "%s %s %s %s re S\n", num(x), num(d.height-y-height), num(width), num(height))
+}
+
+// FillRect fills a rectangle with a gray level and restores black filling
+func (d *Document) FillRect(x, y, width, height, gray float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "%s g %s %s %s %s re f 0 g\n", num(gray), num(x), num(d.height-y-height), num(width), num(height))
+}
+
+// FillRectRGB fills a rectangle with a color whose components range from 0
+// to 1 and restores black filling
+func (d *Document) FillRectRGB(x, y, width, height, r, g, b float64) {
+	d.ensurePage()
+	fmt.Fprintf(d.current, "%s %s %s rg %s %s %s %s re f 0 g\n", num(r), num(g), num(b), num(x), num(d.height-y-height), num(width), num(height))
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo renders the document to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	d.ensurePage()
+	if d.err != nil {
+		return 0, d.err
+	}
+	current, err := compress(d.current.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("failed to compress page %d: %w", len(d.pages)+1, err)
+	}
+	pages := append(d.pages[:len(d.pages):len(d.pages)], current)
+
+	// Object layout: 1 catalog, 2 page tree, 3 info, one object per font,
+	// then a page object and a content stream object per page
+	fontBase := 4
+	pageBase := fontBase + len(fontNames)
+	objectCount := pageBase + 2*len(pages) - 1
+
+	var out bytes.Buffer
+	offsets := make([]int, objectCount+1)
+	begin := func(id int) {
+		offsets[id] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", id)
+	}
+	end := func() {
+		out.WriteString("endobj\n")
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	begin(1)
+	out.WriteString("<< /Type /Catalog /Pages 2 0 R >>\n")
+	end()
+
+	begin(2)
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pageBase+2*i)
+	}
+	fmt.Fprintf(&out, "<< /Type /Pages /Kids [%s] /Count %d >>\n", strings.Join(kids, " "), len(pages))
+	end()
+
+	begin(3)
+	fmt.Fprintf(&out, "<< /Producer (FleetTracker Pro) /Title (%s) >>\n", escapeText(d.title))
+	end()
+
+	fonts := make([]string, len(fontNames))
+	for i, name := range fontNames {
+		begin(fontBase + i)
+		fmt.Fprintf(&out, "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>\n", name)
+		end()
+		fonts[i] = fmt.Sprintf("/F%d %d 0 R", i+1, fontBase+i)
+	}
+
+	for i, page := range pages {
+		pageID := pageBase + 2*i
+		begin(pageID)
+		fmt.Fprintf(&out, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << %s >> >> /Contents %d 0 R >>\n",
+			num(d.width), num(d.height), strings.Join(fonts, " "), pageID+1)
+		end()
+
+		begin(pageID + 1)
+		fmt.Fprintf(&out, "<< /Length %d /Filter /FlateDecode >>\nstream\n", len(page))
+		out.Write(page)
+		out.WriteString("\nendstream\n")
+		end()
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", objectCount+1)
+	for id := 1; id <= objectCount; id++ {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offsets[id])
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", objectCount+1, xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+// finishPage compresses the current page into the finished pages
+func (d *Document) finishPage() {
+	compressed, err := compress(d.current.Bytes())
+	if err != nil && d.err == nil {
+		d.err = fmt.Errorf("failed to compress page %d: %w", len(d.pages)+1, err)
+	}
+	d.pages = append(d.pages, compressed)
+	d.current = nil
+}
+
+// compress deflates a page content stream
+func compress(content []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// ensurePage adds the first page if none exists yet
+func (d *Document) ensurePage() {
+	if d.current == nil {
+		d.AddPage()
+	}
+}
+
+// num formats a coordinate with at most two decimals
+func num(value float64) string {
+	s := fmt.Sprintf("%.2f", value)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-" {
+		return "0"
+	}
+	return s
+}
+
+// escapeText encodes text as a WinAnsi PDF string literal body. Latin-1
+// characters map directly; other characters are replaced with "?".
+func escapeText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
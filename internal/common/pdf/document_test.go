@@ -0,0 +1,135 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pageContents returns the decompressed content streams of a rendered document
+func pageContents(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	streams := regexp.MustCompile(`(?s)/Length (\d+) /Filter /FlateDecode >>\nstream\n`)
+	var contents []string
+	for _, match := range streams.FindAllSubmatchIndex(data, -1) {
+		length, err := strconv.Atoi(string(data[match[2]:match[3]]))
+		require.NoError(t, err)
+
+		reader, err := zlib.NewReader(bytes.NewReader(data[match[1] : match[1]+length]))
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		contents = append(contents, string(content))
+	}
+	return contents
+}
+
+func TestDocument_Bytes(t *testing.T) {
+	doc := New()
+	doc.SetTitle("Test (1)")
+	doc.SetFont(HelveticaBold, 12)
+	doc.Text(40, 60, "Hello (world)")
+	doc.AddPage()
+	doc.SetFont(Helvetica, 10)
+	doc.TextRight(555, 60, "Jumlah")
+	doc.Line(40, 70, 555, 70)
+
+	data, err := doc.Bytes()
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+	assert.Contains(t, string(data), "/Count 2")
+	assert.Contains(t, string(data), `/Title (Test \(1\))`)
+
+	contents := pageContents(t, data)
+	require.Len(t, contents, 2)
+	assert.Contains(t, contents[0], `/F2 12 Tf 40 781.89 Td (Hello \(world\)) Tj`)
+	assert.Contains(t, contents[1], "(Jumlah) Tj")
+
+	// Every xref entry must point at the start of its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(data)
+	require.NotNil(t, startxref)
+	offset, err := strconv.Atoi(string(startxref[1]))
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(data[offset:], []byte("xref\n")))
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[offset:], -1)
+	require.NotEmpty(t, entries)
+	for i, entry := range entries {
+		position, err := strconv.Atoi(string(entry[1]))
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(data[position:], []byte(fmt.Sprintf("%d 0 obj", i+1))), "object %d", i+1)
+	}
+}
+
+func TestStringWidth(t *testing.T) {
+	assert.InDelta(t, 5.56, StringWidth(Helvetica, 10, "0"), 0.001)
+	assert.InDelta(t, 21.12, StringWidth(Helvetica, 10, "Rp 1"), 0.001)
+	assert.Greater(t, StringWidth(HelveticaBold, 10, "Total"), StringWidth(Helvetica, 10, "Total"))
+}
+
+func TestDocument_WrapText(t *testing.T) {
+	doc := New()
+	doc.SetFont(Helvetica, 10)
+
+	lines := doc.WrapText("FleetTracker Pro Subscription for fifty vehicles", 100)
+	require.Greater(t, len(lines), 1)
+	for _, line := range lines {
+		assert.LessOrEqual(t, doc.StringWidth(line), 100.0)
+	}
+
+	lines = doc.WrapText("first\nsecond", 500)
+	assert.Equal(t, []string{"first", "second"}, lines)
+
+	lines = doc.WrapText("ABCDEFGHIJKLMNOPQRSTUVWXYZ", 50)
+	require.Greater(t, len(lines), 1)
+	for _, line := range lines {
+		assert.LessOrEqual(t, doc.StringWidth(line), 50.0)
+	}
+
+	// Words are broken between runes, never inside a multi-byte character
+	lines = doc.WrapText("Ab€É", 3)
+	assert.Equal(t, []string{"A", "b", "€", "É"}, lines)
+	for _, line := range lines {
+		assert.True(t, utf8.ValidString(line), "line %q is not valid UTF-8", line)
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	assert.Equal(t, `a\\b \(c\)`, escapeText(`a\b (c)`))
+	assert.Equal(t, `caf\351`, escapeText("café"))
+	assert.Equal(t, "Rp ?", escapeText("Rp €"))
+}
+
+func TestDocument_Landscape(t *testing.T) {
+	doc := NewLandscape()
+	assert.Equal(t, PageHeight, doc.Width())
+	assert.Equal(t, PageWidth, doc.Height())
+
+	doc.SetFont(HelveticaBold, 12)
+	doc.Text(36, 48, "Trips")
+	doc.FillRectRGB(36, 72, 100, 14, 0.12, 0.31, 0.47)
+	doc.AddPage()
+	doc.Text(36, 48, "Trips")
+	assert.Equal(t, 2, doc.PageCount())
+
+	data, err := doc.Bytes()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "/MediaBox [0 0 841.89 595.28]")
+
+	contents := pageContents(t, data)
+	require.Len(t, contents, 2)
+	assert.Contains(t, contents[0], "/F2 12 Tf 36 547.28 Td (Trips) Tj")
+	assert.Contains(t, contents[0], "0.12 0.31 0.47 rg 36 509.28 100 14 re f 0 g")
+	assert.Contains(t, contents[1], "(Trips) Tj")
+}
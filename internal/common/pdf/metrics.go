@@ -0,0 +1,39 @@
+package pdf
+
+// Glyph widths of the standard fonts for character codes 32-126, in 1/1000
+// of the font size (from the Adobe Core14 AFM files)
+var fontWidths = [][95]int{
+	Helvetica: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	HelveticaBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// defaultGlyphWidth is used for Latin-1 characters outside the ASCII range
+const defaultGlyphWidth = 556
+
+// StringWidth returns the width of text in points for a font and size
+func StringWidth(font Font, size float64, text string) float64 {
+	widths := fontWidths[font]
+	total := 0
+	for _, r := range text {
+		if r >= 32 && r < 127 {
+			total += widths[r-32]
+		} else {
+			total += defaultGlyphWidth
+		}
+	}
+	return float64(total) * size / 1000
+}
@@ -26,10 +26,16 @@ type Alert struct {
 	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`
 }
 
+// AlertNotifier sends alerts outside the app, e.g. by WhatsApp or SMS
+type AlertNotifier interface {
+	NotifyAlert(ctx context.Context, alert *Alert) error
+}
+
 // AlertSystem manages real-time alerts
 type AlertSystem struct {
-	hub   *WebSocketHub
-	redis *redis.Client
+	hub      *WebSocketHub
+	redis    *redis.Client
+	notifier AlertNotifier
 }
 
 // NewAlertSystem creates a new alert system
@@ -40,6 +46,11 @@ func NewAlertSystem(hub *WebSocketHub, redis *redis.Client) *AlertSystem {
 	}
 }
 
+// SetNotifier sets the notifier alerts are also sent through
+func (as *AlertSystem) SetNotifier(notifier AlertNotifier) {
+	as.notifier = notifier
+}
+
 // Alert types
 const (
 	AlertTypeSpeedViolation     = "speed_violation"
@@ -51,6 +62,7 @@ const (
 	AlertTypeSystemError        = "system_error"
 	AlertTypePaymentReceived    = "payment_received"
 	AlertTypeInvoiceGenerated   = "invoice_generated"
+	AlertTypeReportReady        = "report_ready"
 )
 
 // Alert severities
@@ -109,6 +121,13 @@ func (as *AlertSystem) CreateAlert(ctx context.Context, alert *Alert) error {
 		as.hub.BroadcastToCompany(alert.CompanyID, message)
 	}
 	
+	// Notify by phone; failures do not fail the alert
+	if as.notifier != nil {
+		if err := as.notifier.NotifyAlert(ctx, alert); err != nil {
+			fmt.Printf("Failed to send alert %s notifications: %v\n", alert.ID, err)
+		}
+	}
+	
 	// Publish to Redis for cross-instance communication
 	return as.publishAlertToRedis(message)
 }
@@ -297,23 +316,53 @@ func (as *AlertSystem) CreateFuelTheftAlert(ctx context.Context, companyID, vehi
 	return as.CreateAlert(ctx, alert)
 }
 
-// CreateVehicleOfflineAlert creates a vehicle offline alert
-func (as *AlertSystem) CreateVehicleOfflineAlert(ctx context.Context, companyID, vehicleID string, lastSeen time.Time) error {
+// CreateVehicleOfflineAlert creates a vehicle offline alert. A vehicle that
+// went dark with the ignition on (signal_lost) is a likely theft or tampering
+// signal and is raised as critical; a parked vehicle (ignition_off) as low.
+// Vehicles whose devices do not report ignition (unknown) are raised as
+// medium. Each vehicle has at most one offline alert, removed by
+// ClearVehicleOfflineAlert.
+func (as *AlertSystem) CreateVehicleOfflineAlert(ctx context.Context, companyID, vehicleID, licensePlate, reason string, lastSeen time.Time) error {
+	severity := AlertSeverityCritical
+	message := fmt.Sprintf("Vehicle %s lost signal with the ignition on, last seen %s", licensePlate, lastSeen.Format("2006-01-02 15:04:05"))
+	switch reason {
+	case "ignition_off":
+		severity = AlertSeverityLow
+		message = fmt.Sprintf("Vehicle %s stopped reporting after the ignition was turned off, last seen %s", licensePlate, lastSeen.Format("2006-01-02 15:04:05"))
+	case "unknown":
+		severity = AlertSeverityMedium
+		message = fmt.Sprintf("Vehicle %s stopped reporting, last seen %s", licensePlate, lastSeen.Format("2006-01-02 15:04:05"))
+	}
+
 	alert := &Alert{
+		ID:        vehicleOfflineAlertID(vehicleID),
 		Type:      AlertTypeVehicleOffline,
 		CompanyID: companyID,
 		VehicleID: vehicleID,
-		Severity:  AlertSeverityHigh,
+		Severity:  severity,
 		Title:     "Vehicle Offline",
-		Message:   fmt.Sprintf("Vehicle has been offline since %s", lastSeen.Format("2006-01-02 15:04:05")),
+		Message:   message,
 		Data: map[string]interface{}{
-			"last_seen": lastSeen,
+			"last_seen":     lastSeen,
+			"license_plate": licensePlate,
+			"reason":        reason,
 		},
 	}
 	
 	return as.CreateAlert(ctx, alert)
 }
 
+// ClearVehicleOfflineAlert removes the offline alert of a vehicle that is
+// reporting again
+func (as *AlertSystem) ClearVehicleOfflineAlert(ctx context.Context, companyID, vehicleID string) error {
+	return as.DeleteAlert(ctx, companyID, vehicleOfflineAlertID(vehicleID))
+}
+
+// vehicleOfflineAlertID is the ID of a vehicle's offline alert
+func vehicleOfflineAlertID(vehicleID string) string {
+	return "vehicle_offline_" + vehicleID
+}
+
 // CreatePaymentReceivedAlert creates a payment received alert
 func (as *AlertSystem) CreatePaymentReceivedAlert(ctx context.Context, companyID, invoiceID string, amount float64) error {
 	alert := &Alert{
@@ -331,6 +380,25 @@ func (as *AlertSystem) CreatePaymentReceivedAlert(ctx context.Context, companyID
 	return as.CreateAlert(ctx, alert)
 }
 
+// CreateReportReadyAlert tells the user who asked for a report that it can be
+// downloaded
+func (as *AlertSystem) CreateReportReadyAlert(ctx context.Context, companyID, userID, reportID, title string) error {
+	alert := &Alert{
+		Type:      AlertTypeReportReady,
+		CompanyID: companyID,
+		UserID:    userID,
+		Severity:  AlertSeverityLow,
+		Title:     "Report Ready",
+		Message:   fmt.Sprintf("%s is ready to download", title),
+		Data: map[string]interface{}{
+			"report_id":    reportID,
+			"download_url": "/api/v1/reports/" + reportID + "/download",
+		},
+	}
+	
+	return as.CreateAlert(ctx, alert)
+}
+
 // publishAlertToRedis publishes an alert to Redis for cross-instance communication
 func (as *AlertSystem) publishAlertToRedis(message WebSocketMessage) error {
 	data, err := json.Marshal(message)
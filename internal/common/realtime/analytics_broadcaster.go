@@ -2,7 +2,6 @@ package realtime
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -77,7 +76,7 @@ type GeofenceViolationUpdate struct {
 	DriverID    string    `json:"driver_id"`
 	GeofenceID  string    `json:"geofence_id"`
 	GeofenceName string   `json:"geofence_name"`
-	ViolationType string  `json:"violation_type"` // "enter" or "exit"
+	ViolationType string  `json:"violation_type"` // entry, exit, dwell, speed_violation, or a violation type
 	Latitude    float64   `json:"latitude"`
 	Longitude   float64   `json:"longitude"`
 	Timestamp   time.Time `json:"timestamp"`
@@ -134,7 +133,7 @@ func (ab *AnalyticsBroadcaster) BroadcastFleetDashboardUpdate(ctx context.Contex
 // BroadcastVehicleLocationUpdate broadcasts a vehicle location update
 func (ab *AnalyticsBroadcaster) BroadcastVehicleLocationUpdate(ctx context.Context, gpsTrack *models.GPSTrack) error {
 	// Get vehicle and driver information
-	vehicle, err := ab.repoManager.GetVehicles().GetByID(ctx, gpsTrack.VehicleID)
+	vehicle, err := ab.getVehicle(ctx, gpsTrack.VehicleID)
 	if err != nil {
 		return fmt.Errorf("failed to get vehicle: %w", err)
 	}
@@ -168,7 +167,7 @@ func (ab *AnalyticsBroadcaster) BroadcastVehicleLocationUpdate(ctx context.Conte
 // BroadcastDriverEventUpdate broadcasts a driver event update
 func (ab *AnalyticsBroadcaster) BroadcastDriverEventUpdate(ctx context.Context, event *models.DriverEvent) error {
 	// Get vehicle information
-	vehicle, err := ab.repoManager.GetVehicles().GetByID(ctx, event.VehicleID)
+	vehicle, err := ab.getVehicle(ctx, event.VehicleID)
 	if err != nil {
 		return fmt.Errorf("failed to get vehicle: %w", err)
 	}
@@ -201,7 +200,7 @@ func (ab *AnalyticsBroadcaster) BroadcastDriverEventUpdate(ctx context.Context,
 // BroadcastGeofenceViolationUpdate broadcasts a geofence violation update
 func (ab *AnalyticsBroadcaster) BroadcastGeofenceViolationUpdate(ctx context.Context, vehicleID, driverID, geofenceID, geofenceName, violationType string, lat, lng float64) error {
 	// Get vehicle information
-	vehicle, err := ab.repoManager.GetVehicles().GetByID(ctx, vehicleID)
+	vehicle, err := ab.getVehicle(ctx, vehicleID)
 	if err != nil {
 		return fmt.Errorf("failed to get vehicle: %w", err)
 	}
@@ -353,14 +352,23 @@ func (ab *AnalyticsBroadcaster) generateFleetDashboardUpdate(ctx context.Context
 	}, nil
 }
 
+// getVehicle gets a vehicle through the repository manager, or the database
+// when the broadcaster was created without one
+func (ab *AnalyticsBroadcaster) getVehicle(ctx context.Context, vehicleID string) (*models.Vehicle, error) {
+	if ab.repoManager != nil {
+		return ab.repoManager.GetVehicles().GetByID(ctx, vehicleID)
+	}
+
+	var vehicle models.Vehicle
+	if err := ab.db.WithContext(ctx).Select("id", "company_id").First(&vehicle, "id = ?", vehicleID).Error; err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
 // publishToRedis publishes a message to Redis for cross-instance communication
 func (ab *AnalyticsBroadcaster) publishToRedis(_ string, message WebSocketMessage) error {
-	data, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-	
-	return ab.redis.Publish(context.Background(), "fleet_tracker:websocket", data).Err()
+	return ab.hub.Publish(context.Background(), message)
 }
 
 // StartPeriodicDashboardUpdates starts periodic dashboard updates
@@ -0,0 +1,268 @@
+package realtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+const (
+	// BearerSubprotocol lets browsers, which cannot set headers on the
+	// handshake, send the access token as Sec-WebSocket-Protocol: bearer, <token>
+	BearerSubprotocol = "bearer"
+
+	// TicketTTL is how long a ticket from the ticket endpoint can be redeemed
+	TicketTTL = 30 * time.Second
+
+	ticketKeyPrefix       = "ws_ticket:"
+	sessionRevokedChannel = "fleet_tracker:session_revoked"
+)
+
+// ErrUnauthenticated is returned when a handshake carries no valid credentials
+var ErrUnauthenticated = errors.New("valid access token or ticket required")
+
+// Identity is the authenticated user behind a WebSocket connection
+type Identity struct {
+	UserID    string `json:"user_id"`
+	CompanyID string `json:"company_id"`
+	Role      string `json:"role"`
+	SessionID string `json:"session_id"`
+}
+
+// Authenticator authenticates WebSocket handshakes and reports which
+// sessions are still valid for connected clients
+type Authenticator interface {
+	// Authenticate resolves the identity from the Authorization header, the
+	// bearer subprotocol or a ticket query parameter
+	Authenticate(r *http.Request) (*Identity, error)
+
+	// IssueTicket exchanges an access token for a single-use ticket
+	IssueTicket(ctx context.Context, accessToken string) (string, error)
+
+	// ActiveSessions returns which of the sessions are still active
+	ActiveSessions(ctx context.Context, sessionIDs []string) (map[string]bool, error)
+}
+
+// SessionRevocation asks every instance to disconnect the WebSocket clients
+// of a session, or of all sessions of a user when SessionID is empty
+type SessionRevocation struct {
+	SessionID string `json:"session_id,omitempty"`
+	UserID    string `json:"user_id,omitempty"`
+}
+
+// PublishSessionRevocation notifies the WebSocket hubs of all instances
+func PublishSessionRevocation(ctx context.Context, redisClient *redis.Client, revocation SessionRevocation) error {
+	data, err := json.Marshal(revocation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session revocation: %w", err)
+	}
+	return redisClient.Publish(ctx, sessionRevokedChannel, data).Err()
+}
+
+// SessionAuthenticator validates access tokens against the sessions table,
+// the same way the REST API does
+type SessionAuthenticator struct {
+	db        *gorm.DB
+	redis     *redis.Client
+	jwtSecret []byte
+}
+
+// NewSessionAuthenticator creates a new session authenticator
+func NewSessionAuthenticator(db *gorm.DB, redis *redis.Client, jwtSecret string) *SessionAuthenticator {
+	return &SessionAuthenticator{
+		db:        db,
+		redis:     redis,
+		jwtSecret: []byte(jwtSecret),
+	}
+}
+
+// Authenticate resolves the identity of a handshake
+func (a *SessionAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		return a.redeemTicket(r.Context(), ticket)
+	}
+
+	token := handshakeToken(r)
+	if token == "" {
+		return nil, ErrUnauthenticated
+	}
+	return a.identify(r.Context(), token)
+}
+
+// IssueTicket exchanges an access token for a single-use ticket
+func (a *SessionAuthenticator) IssueTicket(ctx context.Context, accessToken string) (string, error) {
+	identity, err := a.identify(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate ticket: %w", err)
+	}
+	ticket := hex.EncodeToString(b)
+
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ticket: %w", err)
+	}
+	if err := a.redis.Set(ctx, ticketKeyPrefix+ticket, data, TicketTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store ticket: %w", err)
+	}
+
+	return ticket, nil
+}
+
+// ActiveSessions returns which of the sessions are active, unexpired and
+// belong to an active user
+func (a *SessionAuthenticator) ActiveSessions(ctx context.Context, sessionIDs []string) (map[string]bool, error) {
+	active := make(map[string]bool, len(sessionIDs))
+	if len(sessionIDs) == 0 {
+		return active, nil
+	}
+
+	var ids []string
+	err := a.db.WithContext(ctx).Model(&models.Session{}).
+		Joins("JOIN users ON users.id = sessions.user_id").
+		Where("sessions.id IN ? AND sessions.is_active = ? AND sessions.expires_at > ?", sessionIDs, true, time.Now()).
+		Where("users.is_active = ? AND users.deleted_at IS NULL", true).
+		Pluck("sessions.id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to check sessions: %w", err)
+	}
+
+	for _, id := range ids {
+		active[id] = true
+	}
+	return active, nil
+}
+
+// identify validates an access token and finds its session
+func (a *SessionAuthenticator) identify(ctx context.Context, token string) (*Identity, error) {
+	claims := &middleware.Claims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return a.jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !parsed.Valid || claims.UserID == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	var session models.Session
+	err = a.db.WithContext(ctx).
+		Where("token = ? AND user_id = ? AND is_active = ? AND expires_at > ?", token, claims.UserID, true, time.Now()).
+		First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnauthenticated
+		}
+		return nil, fmt.Errorf("failed to find session: %w", err)
+	}
+
+	var user models.User
+	if err := a.db.WithContext(ctx).Select("id").Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUnauthenticated
+		}
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	return &Identity{
+		UserID:    claims.UserID,
+		CompanyID: claims.CompanyID,
+		Role:      claims.Role,
+		SessionID: session.ID,
+	}, nil
+}
+
+// redeemTicket returns the identity of a ticket and deletes it
+func (a *SessionAuthenticator) redeemTicket(ctx context.Context, ticket string) (*Identity, error) {
+	key := ticketKeyPrefix + ticket
+
+	var get *redis.StringCmd
+	_, err := a.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem ticket: %w", err)
+	}
+
+	var identity Identity
+	if err := json.Unmarshal([]byte(get.Val()), &identity); err != nil {
+		return nil, ErrUnauthenticated
+	}
+	return &identity, nil
+}
+
+// handshakeToken extracts the access token from the Authorization header or
+// the bearer subprotocol. Tokens in the query string are not accepted because
+// URLs end up in proxy and access logs.
+func handshakeToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+
+	var protocols []string
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(value, ",") {
+			protocols = append(protocols, strings.TrimSpace(protocol))
+		}
+	}
+	for i, protocol := range protocols {
+		if protocol == BearerSubprotocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+	return ""
+}
+
+// NewOriginChecker returns a CheckOrigin function accepting handshakes
+// without an Origin header (non-browser clients), from the server's own
+// host, or from one of the allowed origins. "*" allows every origin.
+func NewOriginChecker(allowedOrigins []string) func(r *http.Request) bool {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	allowAll := false
+	for _, origin := range allowedOrigins {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		if origin == "*" {
+			allowAll = true
+		}
+		if origin != "" {
+			allowed[origin] = true
+		}
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || allowAll {
+			return true
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		return allowed[strings.ToLower(u.Scheme+"://"+u.Host)]
+	}
+}
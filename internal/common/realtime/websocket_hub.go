@@ -2,7 +2,10 @@ package realtime
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -28,6 +31,8 @@ type Client struct {
 	ID        string
 	CompanyID string
 	UserID    string
+	Role      string
+	SessionID string
 	Conn      *websocket.Conn
 	Send      chan []byte
 	Hub       *WebSocketHub
@@ -49,6 +54,14 @@ type WebSocketHub struct {
 	// Redis client for pub/sub
 	redis *redis.Client
 	
+	// instanceID marks messages this instance published to Redis, which it
+	// has already delivered to its own clients
+	instanceID string
+	
+	// Handshake authentication and origin allow-list
+	authenticator Authenticator
+	checkOrigin   func(r *http.Request) bool
+	
 	// Mutex for thread safety
 	mutex sync.RWMutex
 	
@@ -56,6 +69,12 @@ type WebSocketHub struct {
 	config *WebSocketConfig
 }
 
+// redisEnvelope wraps messages published for the other instances
+type redisEnvelope struct {
+	Instance string          `json:"instance"`
+	Message  json.RawMessage `json:"message"`
+}
+
 // WebSocketConfig holds WebSocket configuration
 type WebSocketConfig struct {
 	ReadBufferSize  int
@@ -64,6 +83,11 @@ type WebSocketConfig struct {
 	PongWait        time.Duration
 	WriteWait       time.Duration
 	MaxMessageSize  int64
+	
+	// SessionCheckInterval is how often connected clients' sessions are
+	// checked, so revoked or expired sessions are disconnected even when the
+	// revocation notice was missed
+	SessionCheckInterval time.Duration
 }
 
 // DefaultWebSocketConfig returns default WebSocket configuration
@@ -75,6 +99,7 @@ func DefaultWebSocketConfig() *WebSocketConfig {
 		PongWait:        60 * time.Second,
 		WriteWait:       10 * time.Second,
 		MaxMessageSize:  512,
+		SessionCheckInterval: 30 * time.Second,
 	}
 }
 
@@ -91,6 +116,8 @@ func NewWebSocketHub(redis *redis.Client, config *WebSocketConfig) *WebSocketHub
 		broadcast:       make(chan []byte),
 		companyChannels: make(map[string]chan []byte),
 		redis:           redis,
+		instanceID:      newInstanceID(),
+		checkOrigin:     NewOriginChecker(nil),
 		config:          config,
 	}
 	
@@ -100,9 +127,38 @@ func NewWebSocketHub(redis *redis.Client, config *WebSocketConfig) *WebSocketHub
 	// Start Redis pub/sub for cross-instance communication
 	go hub.startRedisPubSub()
 	
+	// Disconnect clients whose session was revoked
+	go hub.watchRevocations()
+	go hub.checkSessions()
+	
 	return hub
 }
 
+// SetAuthenticator sets how handshakes are authenticated. Connections are
+// refused until an authenticator is set.
+func (h *WebSocketHub) SetAuthenticator(authenticator Authenticator) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.authenticator = authenticator
+}
+
+// SetAllowedOrigins sets the browser origins allowed to connect besides the
+// server's own host
+func (h *WebSocketHub) SetAllowedOrigins(origins []string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.checkOrigin = NewOriginChecker(origins)
+}
+
+// newInstanceID returns a random identifier for this hub
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
 // run starts the WebSocket hub
 func (h *WebSocketHub) run() {
 	for {
@@ -124,46 +180,210 @@ func (h *WebSocketHub) run() {
 
 		case client := <-h.unregister:
 			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.Send)
-			}
+			h.removeClient(client)
 			h.mutex.Unlock()
 			
-			log.Printf("Client %s disconnected. Total clients: %d", client.ID, len(h.clients))
+			log.Printf("Client %s disconnected. Total clients: %d", client.ID, h.GetConnectedClients())
 
 		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for client := range h.clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.clients, client)
-				}
-			}
-			h.mutex.RUnlock()
+			h.deliver(message, func(*Client) bool { return true })
 		}
 	}
 }
 
+// deliver queues a message for the matching clients, dropping clients that
+// cannot keep up
+func (h *WebSocketHub) deliver(data []byte, match func(*Client) bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	
+	for client := range h.clients {
+		if !match(client) {
+			continue
+		}
+		select {
+		case client.Send <- data:
+		default:
+			h.removeClient(client)
+		}
+	}
+}
+
+// removeClient removes a client and closes its send channel once. The
+// caller must hold the mutex.
+func (h *WebSocketHub) removeClient(client *Client) {
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.Send)
+	}
+}
+
 // startRedisPubSub starts Redis pub/sub for cross-instance communication
 func (h *WebSocketHub) startRedisPubSub() {
+	if h.redis == nil {
+		return
+	}
+	
 	pubsub := h.redis.Subscribe(context.Background(), "fleet_tracker:websocket")
 	defer pubsub.Close()
 	
 	ch := pubsub.Channel()
 	for msg := range ch {
-		h.broadcast <- []byte(msg.Payload)
+		var envelope redisEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil || envelope.Instance == h.instanceID {
+			continue
+		}
+		
+		// Only deliver to the company, and user, the message is addressed to
+		var message WebSocketMessage
+		if err := json.Unmarshal(envelope.Message, &message); err != nil || message.CompanyID == "" {
+			continue
+		}
+		h.deliver(envelope.Message, func(client *Client) bool {
+			return client.CompanyID == message.CompanyID && (message.UserID == "" || client.UserID == message.UserID)
+		})
+	}
+}
+
+// Publish sends a company message to the clients connected to other instances
+func (h *WebSocketHub) Publish(ctx context.Context, message WebSocketMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	
+	envelope, err := json.Marshal(redisEnvelope{Instance: h.instanceID, Message: data})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	
+	return h.redis.Publish(ctx, "fleet_tracker:websocket", envelope).Err()
+}
+
+// watchRevocations disconnects clients when any instance revokes their session
+func (h *WebSocketHub) watchRevocations() {
+	if h.redis == nil {
+		return
+	}
+	
+	pubsub := h.redis.Subscribe(context.Background(), sessionRevokedChannel)
+	defer pubsub.Close()
+	
+	for msg := range pubsub.Channel() {
+		var revocation SessionRevocation
+		if err := json.Unmarshal([]byte(msg.Payload), &revocation); err != nil {
+			continue
+		}
+		h.DisconnectSession(revocation)
 	}
 }
 
-// HandleWebSocket handles WebSocket connections
+// checkSessions periodically disconnects clients whose session was revoked,
+// expired, or whose user was deactivated
+func (h *WebSocketHub) checkSessions() {
+	if h.config.SessionCheckInterval <= 0 {
+		return
+	}
+	
+	ticker := time.NewTicker(h.config.SessionCheckInterval)
+	defer ticker.Stop()
+	
+	for range ticker.C {
+		h.mutex.RLock()
+		authenticator := h.authenticator
+		sessionIDs := make([]string, 0, len(h.clients))
+		for client := range h.clients {
+			sessionIDs = append(sessionIDs, client.SessionID)
+		}
+		h.mutex.RUnlock()
+		
+		if authenticator == nil || len(sessionIDs) == 0 {
+			continue
+		}
+		
+		ctx, cancel := context.WithTimeout(context.Background(), h.config.SessionCheckInterval)
+		active, err := authenticator.ActiveSessions(ctx, sessionIDs)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to check WebSocket sessions: %v", err)
+			continue
+		}
+		
+		h.disconnect(func(client *Client) bool { return !active[client.SessionID] }, "session expired")
+	}
+}
+
+// DisconnectSession closes the connections of a revoked session, or of every
+// session of the user when only the user is given
+func (h *WebSocketHub) DisconnectSession(revocation SessionRevocation) {
+	if revocation.SessionID == "" && revocation.UserID == "" {
+		return
+	}
+	
+	h.disconnect(func(client *Client) bool {
+		if revocation.SessionID != "" {
+			return client.SessionID == revocation.SessionID
+		}
+		return client.UserID == revocation.UserID
+	}, "session revoked")
+}
+
+// disconnect closes the matching connections with a policy violation close
+// frame. Their read pumps then unregister them.
+func (h *WebSocketHub) disconnect(match func(*Client) bool, reason string) {
+	h.mutex.RLock()
+	var clients []*Client
+	for client := range h.clients {
+		if match(client) {
+			clients = append(clients, client)
+		}
+	}
+	h.mutex.RUnlock()
+	
+	for _, client := range clients {
+		closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+		client.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(h.config.WriteWait))
+		client.Conn.Close()
+		log.Printf("Client %s disconnected: %s", client.ID, reason)
+	}
+}
+
+// HandleWebSocket handles WebSocket connections. The handshake must carry an
+// access token (Authorization header or bearer subprotocol) or a ticket from
+// the ticket endpoint; company and role come from the token, not the client.
 func (h *WebSocketHub) HandleWebSocket(c *gin.Context) {
-	// Get company ID and user ID from query parameters or headers
-	companyID := c.Query("company_id")
-	userID := c.Query("user_id")
+	h.mutex.RLock()
+	authenticator, checkOrigin := h.authenticator, h.checkOrigin
+	h.mutex.RUnlock()
+	
+	if authenticator == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "WebSocket authentication is not configured"})
+		return
+	}
+	
+	if !checkOrigin(c.Request) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
+		return
+	}
 	
+	identity, err := authenticator.Authenticate(c.Request)
+	if err != nil {
+		if !errors.Is(err, ErrUnauthenticated) {
+			log.Printf("WebSocket authentication error: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrUnauthenticated.Error()})
+		return
+	}
+	
+	// Only super-admins may watch a company other than their own
+	companyID := identity.CompanyID
+	if requested := c.Query("company_id"); requested != "" && requested != companyID {
+		if identity.Role != "super-admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access to this company is not allowed"})
+			return
+		}
+		companyID = requested
+	}
 	if companyID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "company_id is required"})
 		return
@@ -173,24 +393,24 @@ func (h *WebSocketHub) HandleWebSocket(c *gin.Context) {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  h.config.ReadBufferSize,
 		WriteBufferSize: h.config.WriteBufferSize,
-		CheckOrigin: func(r *http.Request) bool {
-			// In production, implement proper origin checking
-			return true
-		},
+		CheckOrigin:     checkOrigin,
+		Subprotocols:    []string{BearerSubprotocol},
 	}
 	
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
+		// The upgrader has already replied with an error status
 		log.Printf("WebSocket upgrade error: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to upgrade to WebSocket"})
 		return
 	}
 	
 	// Create client
 	client := &Client{
-		ID:        fmt.Sprintf("%s_%s_%d", companyID, userID, time.Now().UnixNano()),
+		ID:        fmt.Sprintf("%s_%s_%d", companyID, identity.UserID, time.Now().UnixNano()),
 		CompanyID: companyID,
-		UserID:    userID,
+		UserID:    identity.UserID,
+		Role:      identity.Role,
+		SessionID: identity.SessionID,
 		Conn:      conn,
 		Send:      make(chan []byte, 256),
 		Hub:       h,
@@ -224,18 +444,9 @@ func (h *WebSocketHub) BroadcastToCompany(companyID string, message WebSocketMes
 		return
 	}
 	
-	h.mutex.RLock()
-	for client := range h.clients {
-		if client.CompanyID == companyID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
-		}
-	}
-	h.mutex.RUnlock()
+	h.deliver(data, func(client *Client) bool {
+		return client.CompanyID == companyID
+	})
 }
 
 // BroadcastToUser broadcasts a message to a specific user
@@ -248,18 +459,9 @@ func (h *WebSocketHub) BroadcastToUser(companyID, userID string, message WebSock
 		return
 	}
 	
-	h.mutex.RLock()
-	for client := range h.clients {
-		if client.CompanyID == companyID && client.UserID == userID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
-		}
-	}
-	h.mutex.RUnlock()
+	h.deliver(data, func(client *Client) bool {
+		return client.CompanyID == companyID && client.UserID == userID
+	})
 }
 
 // GetConnectedClients returns the number of connected clients
@@ -359,9 +561,9 @@ func (c *Client) sendMessage(message WebSocketMessage) {
 		return
 	}
 	
+	// Drop the message when the buffer is full; the hub removes slow clients
 	select {
 	case c.Send <- data:
 	default:
-		close(c.Send)
 	}
 }
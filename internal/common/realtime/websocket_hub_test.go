@@ -0,0 +1,248 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuthenticator maps access tokens to identities
+type fakeAuthenticator struct {
+	identities map[string]*Identity
+	active     map[string]bool
+}
+
+func (f *fakeAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if identity, ok := f.identities[handshakeToken(r)]; ok {
+		return identity, nil
+	}
+	return nil, ErrUnauthenticated
+}
+
+func (f *fakeAuthenticator) IssueTicket(ctx context.Context, accessToken string) (string, error) {
+	return "", ErrUnauthenticated
+}
+
+func (f *fakeAuthenticator) ActiveSessions(ctx context.Context, sessionIDs []string) (map[string]bool, error) {
+	return f.active, nil
+}
+
+func newTestHub(t *testing.T, authenticator Authenticator) (*WebSocketHub, *httptest.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	hub := &WebSocketHub{
+		clients:         make(map[*Client]bool),
+		register:        make(chan *Client),
+		unregister:      make(chan *Client),
+		broadcast:       make(chan []byte),
+		companyChannels: make(map[string]chan []byte),
+		instanceID:      newInstanceID(),
+		checkOrigin:     NewOriginChecker([]string{"https://app.fleettracker.id"}),
+		config:          DefaultWebSocketConfig(),
+	}
+	if authenticator != nil {
+		hub.SetAuthenticator(authenticator)
+	}
+	go hub.run()
+
+	router := gin.New()
+	router.GET("/ws/tracking", hub.HandleWebSocket)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return hub, server
+}
+
+func dial(t *testing.T, server *httptest.Server, query string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/tracking" + query
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": []string{"Bearer " + token}}
+}
+
+// readMessage returns the next message of the given type
+func readMessage(t *testing.T, conn *websocket.Conn, messageType string) WebSocketMessage {
+	t.Helper()
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+
+		var message WebSocketMessage
+		require.NoError(t, json.Unmarshal(data, &message))
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+func TestHandleWebSocket_Handshake(t *testing.T) {
+	authenticator := &fakeAuthenticator{identities: map[string]*Identity{
+		"token-a":     {UserID: "user-a", CompanyID: "company-a", Role: "admin", SessionID: "session-a"},
+		"token-admin": {UserID: "root", CompanyID: "company-root", Role: "super-admin", SessionID: "session-root"},
+	}}
+	_, server := newTestHub(t, authenticator)
+
+	t.Run("rejects missing credentials", func(t *testing.T) {
+		_, resp, err := dial(t, server, "?company_id=company-a&user_id=user-a", nil)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("rejects invalid token", func(t *testing.T) {
+		_, resp, err := dial(t, server, "", bearer("forged"))
+		require.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("rejects another company", func(t *testing.T) {
+		_, resp, err := dial(t, server, "?company_id=company-b", bearer("token-a"))
+		require.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("rejects origins outside the allow-list", func(t *testing.T) {
+		header := bearer("token-a")
+		header.Set("Origin", "https://evil.example.com")
+		_, resp, err := dial(t, server, "", header)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("accepts the bearer subprotocol", func(t *testing.T) {
+		header := http.Header{"Origin": []string{"https://app.fleettracker.id"}}
+		header.Set("Sec-WebSocket-Protocol", BearerSubprotocol+", token-a")
+		conn, resp, err := dial(t, server, "", header)
+		require.NoError(t, err)
+		defer conn.Close()
+		assert.Equal(t, BearerSubprotocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+	})
+
+	t.Run("super-admin can watch any company", func(t *testing.T) {
+		conn, _, err := dial(t, server, "?company_id=company-b", bearer("token-admin"))
+		require.NoError(t, err)
+		conn.Close()
+	})
+}
+
+func TestHandleWebSocket_NotConfigured(t *testing.T) {
+	_, server := newTestHub(t, nil)
+
+	_, resp, err := dial(t, server, "?company_id=company-a", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestWebSocketHub_CompanyIsolation(t *testing.T) {
+	authenticator := &fakeAuthenticator{identities: map[string]*Identity{
+		"token-a": {UserID: "user-a", CompanyID: "company-a", SessionID: "session-a"},
+		"token-b": {UserID: "user-b", CompanyID: "company-b", SessionID: "session-b"},
+	}}
+	hub, server := newTestHub(t, authenticator)
+
+	connA, _, err := dial(t, server, "", bearer("token-a"))
+	require.NoError(t, err)
+	defer connA.Close()
+	connB, _, err := dial(t, server, "", bearer("token-b"))
+	require.NoError(t, err)
+	defer connB.Close()
+
+	readMessage(t, connA, "connection_established")
+	readMessage(t, connB, "connection_established")
+
+	hub.BroadcastToCompany("company-b", WebSocketMessage{Type: "vehicle_location_update", Data: "b-only"})
+	hub.BroadcastToCompany("company-a", WebSocketMessage{Type: "vehicle_location_update", Data: "a-only"})
+
+	// Messages are delivered in order, so company A's first update is its own
+	assert.Equal(t, "a-only", readMessage(t, connA, "vehicle_location_update").Data)
+	assert.Equal(t, "b-only", readMessage(t, connB, "vehicle_location_update").Data)
+}
+
+func TestWebSocketHub_DisconnectSession(t *testing.T) {
+	authenticator := &fakeAuthenticator{
+		identities: map[string]*Identity{
+			"token-a": {UserID: "user-a", CompanyID: "company-a", SessionID: "session-a"},
+			"token-b": {UserID: "user-b", CompanyID: "company-a", SessionID: "session-b"},
+		},
+		active: map[string]bool{"session-b": true},
+	}
+	hub, server := newTestHub(t, authenticator)
+
+	connA, _, err := dial(t, server, "", bearer("token-a"))
+	require.NoError(t, err)
+	defer connA.Close()
+	connB, _, err := dial(t, server, "", bearer("token-b"))
+	require.NoError(t, err)
+	defer connB.Close()
+
+	readMessage(t, connA, "connection_established")
+	readMessage(t, connB, "connection_established")
+	require.Eventually(t, func() bool { return hub.GetConnectedClients() == 2 }, time.Second, 10*time.Millisecond)
+
+	hub.DisconnectSession(SessionRevocation{SessionID: "session-a"})
+
+	connA.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = connA.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "unexpected error: %v", err)
+	require.Eventually(t, func() bool { return hub.GetConnectedClients() == 1 }, time.Second, 10*time.Millisecond)
+
+	// Session B is still active and keeps receiving updates
+	hub.BroadcastToCompany("company-a", WebSocketMessage{Type: "trip_update"})
+	readMessage(t, connB, "trip_update")
+}
+
+func TestHandshakeToken(t *testing.T) {
+	tests := map[string]struct {
+		header http.Header
+		want   string
+	}{
+		"authorization header":      {bearer("abc"), "abc"},
+		"bearer subprotocol":        {http.Header{"Sec-Websocket-Protocol": []string{"bearer, abc"}}, "abc"},
+		"subprotocol without token": {http.Header{"Sec-Websocket-Protocol": []string{"bearer"}}, ""},
+		"other subprotocol":         {http.Header{"Sec-Websocket-Protocol": []string{"chat, abc"}}, ""},
+		"none":                      {http.Header{}, ""},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws/tracking?token=query-token", nil)
+			r.Header = tt.header
+			assert.Equal(t, tt.want, handshakeToken(r))
+		})
+	}
+}
+
+func TestNewOriginChecker(t *testing.T) {
+	check := NewOriginChecker([]string{" https://app.fleettracker.id/ ", "http://localhost:5173"})
+
+	request := func(origin string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://api.fleettracker.id/ws/tracking", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return r
+	}
+
+	assert.True(t, check(request("")), "non-browser clients send no origin")
+	assert.True(t, check(request("https://APP.fleettracker.id")))
+	assert.True(t, check(request("http://localhost:5173")))
+	assert.True(t, check(request("https://api.fleettracker.id")), "same host")
+	assert.False(t, check(request("http://app.fleettracker.id")), "scheme must match")
+	assert.False(t, check(request("https://app.fleettracker.id.evil.com")))
+	assert.False(t, check(request("null")))
+
+	assert.True(t, NewOriginChecker([]string{"*"})(request("https://anything.example.com")))
+}
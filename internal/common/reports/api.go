@@ -0,0 +1,221 @@
+package reports
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// ReportAPI provides HTTP API for reports and report subscriptions
+type ReportAPI struct {
+	service *Service
+}
+
+// NewReportAPI creates a new report API
+func NewReportAPI(service *Service) *ReportAPI {
+	return &ReportAPI{
+		service: service,
+	}
+}
+
+// ListReportTypesHandler lists the report types that can be generated
+func (ra *ReportAPI) ListReportTypesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"report_types": ra.service.ReportTypes()})
+}
+
+// RequestReportHandler queues a report; poll GET /reports/:id until it
+// completes, or wait for the report ready alert
+func (ra *ReportAPI) RequestReportHandler(c *gin.Context) {
+	var req ReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+	req.CompanyID = c.GetString("company_id")
+	req.UserID = c.GetString("user_id")
+
+	report, err := ra.service.RequestReport(c.Request.Context(), &req)
+	if err != nil {
+		abortWithReportError(c, "Failed to request report", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, QueuedReport(report))
+}
+
+// ListReportsHandler lists the company's reports, newest first. mine=true
+// lists only the reports the user asked for.
+func (ra *ReportAPI) ListReportsHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	filters := ReportFilters{
+		ReportType:     c.Query("type"),
+		Status:         c.Query("status"),
+		SubscriptionID: c.Query("subscription_id"),
+		Page:           page,
+		Limit:          limit,
+	}
+	if c.Query("mine") == "true" {
+		filters.RequestedBy = c.GetString("user_id")
+	}
+
+	reports, total, err := ra.service.ListReports(c.Request.Context(), c.GetString("company_id"), filters)
+	if err != nil {
+		abortWithReportError(c, "Failed to list reports", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reports": reports, "total": total, "page": page, "limit": limit})
+}
+
+// GetReportHandler returns a report and its status
+func (ra *ReportAPI) GetReportHandler(c *gin.Context) {
+	report, err := ra.service.GetReport(c.Request.Context(), c.GetString("company_id"), c.Param("id"))
+	if err != nil {
+		abortWithReportError(c, "Failed to get report", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// DownloadReportHandler streams the file of a completed report
+func (ra *ReportAPI) DownloadReportHandler(c *gin.Context) {
+	reader, report, err := ra.service.OpenReport(c.Request.Context(), c.GetString("company_id"), c.Param("id"))
+	if err != nil {
+		abortWithReportError(c, "Failed to download report", err)
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, report.FileSize, report.ContentType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", report.FileName),
+		"Cache-Control":       "private, no-store",
+	})
+}
+
+// RerunReportHandler generates a report again with the same parameters
+func (ra *ReportAPI) RerunReportHandler(c *gin.Context) {
+	report, err := ra.service.RerunReport(c.Request.Context(), c.GetString("company_id"), c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		abortWithReportError(c, "Failed to re-run report", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, QueuedReport(report))
+}
+
+// ListSubscriptionsHandler lists the company's report subscriptions
+func (ra *ReportAPI) ListSubscriptionsHandler(c *gin.Context) {
+	subscriptions, err := ra.service.ListSubscriptions(c.Request.Context(), c.GetString("company_id"))
+	if err != nil {
+		abortWithReportError(c, "Failed to list report subscriptions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions})
+}
+
+// CreateSubscriptionHandler subscribes the user to a recurring report
+func (ra *ReportAPI) CreateSubscriptionHandler(c *gin.Context) {
+	var req SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	subscription, err := ra.service.CreateSubscription(c.Request.Context(), c.GetString("company_id"), c.GetString("user_id"), &req)
+	if err != nil {
+		abortWithReportError(c, "Failed to create report subscription", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, subscription)
+}
+
+// GetSubscriptionHandler returns a report subscription
+func (ra *ReportAPI) GetSubscriptionHandler(c *gin.Context) {
+	subscription, err := ra.service.GetSubscription(c.Request.Context(), c.GetString("company_id"), c.Param("id"))
+	if err != nil {
+		abortWithReportError(c, "Failed to get report subscription", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// UpdateSubscriptionHandler changes a report subscription; is_active pauses
+// and resumes it
+func (ra *ReportAPI) UpdateSubscriptionHandler(c *gin.Context) {
+	var req SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	subscription, err := ra.service.UpdateSubscription(c.Request.Context(), c.GetString("company_id"), c.Param("id"), &req)
+	if err != nil {
+		abortWithReportError(c, "Failed to update report subscription", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+// DeleteSubscriptionHandler removes a report subscription
+func (ra *ReportAPI) DeleteSubscriptionHandler(c *gin.Context) {
+	if err := ra.service.DeleteSubscription(c.Request.Context(), c.GetString("company_id"), c.Param("id")); err != nil {
+		abortWithReportError(c, "Failed to delete report subscription", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report subscription deleted successfully"})
+}
+
+// QueuedReport is the response to a queued report: the report and where to
+// poll its status and download it
+func QueuedReport(report *models.Report) gin.H {
+	return gin.H{
+		"report":       report,
+		"status_url":   "/api/v1/reports/" + report.ID,
+		"download_url": "/api/v1/reports/" + report.ID + "/download",
+	}
+}
+
+// abortWithReportError aborts with the service's error, or an internal error
+func abortWithReportError(c *gin.Context, message string, err error) {
+	if appErr, ok := err.(*apperrors.AppError); ok {
+		middleware.AbortWithError(c, appErr)
+		return
+	}
+	middleware.AbortWithInternal(c, message, err)
+}
+
+// SetupReportRoutes sets up report API routes
+func SetupReportRoutes(r *gin.RouterGroup, api *ReportAPI) {
+	reports := r.Group("/reports")
+	{
+		reports.GET("", api.ListReportsHandler)
+		reports.POST("", api.RequestReportHandler)
+		reports.GET("/types", api.ListReportTypesHandler)
+
+		// Recurring reports
+		subscriptions := reports.Group("/subscriptions")
+		{
+			subscriptions.GET("", api.ListSubscriptionsHandler)
+			subscriptions.POST("", api.CreateSubscriptionHandler)
+			subscriptions.GET("/:id", api.GetSubscriptionHandler)
+			subscriptions.PUT("/:id", api.UpdateSubscriptionHandler)
+			subscriptions.DELETE("/:id", api.DeleteSubscriptionHandler)
+		}
+
+		reports.GET("/:id", api.GetReportHandler)
+		reports.GET("/:id/download", api.DownloadReportHandler)
+		reports.POST("/:id/rerun", api.RerunReportHandler)
+	}
+}
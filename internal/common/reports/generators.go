@@ -0,0 +1,244 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// Built-in reports, computed from trips, driver events, fuel and maintenance
+// logs of a period
+
+// FleetSummaryReport sums up the trips of every vehicle in a period
+type FleetSummaryReport struct {
+	PeriodStart    time.Time            `json:"period_start"`
+	PeriodEnd      time.Time            `json:"period_end"`
+	TotalVehicles  int64                `json:"total_vehicles"`
+	ActiveVehicles int64                `json:"active_vehicles"`
+	TotalTrips     int64                `json:"total_trips"`
+	TotalDistance  float64              `json:"total_distance_km"`
+	TotalFuel      float64              `json:"total_fuel_liters"`
+	Vehicles       []VehicleTripSummary `json:"vehicles"`
+}
+
+// VehicleTripSummary is a vehicle's line of the fleet summary
+type VehicleTripSummary struct {
+	VehicleID    string  `json:"vehicle_id"`
+	LicensePlate string  `json:"license_plate"`
+	Status       string  `json:"status"`
+	Trips        int64   `json:"trips"`
+	Distance     float64 `json:"distance_km"`
+	Duration     float64 `json:"driving_hours"`
+	Fuel         float64 `json:"fuel_liters"`
+}
+
+// DriverPerformanceReport lists the driving and behavior events of every
+// driver in a period
+type DriverPerformanceReport struct {
+	PeriodStart  time.Time                `json:"period_start"`
+	PeriodEnd    time.Time                `json:"period_end"`
+	TotalDrivers int64                    `json:"total_drivers"`
+	TotalTrips   int64                    `json:"total_trips"`
+	TotalEvents  int64                    `json:"total_events"`
+	Drivers      []DriverPerformanceEntry `json:"drivers"`
+}
+
+// DriverPerformanceEntry is a driver's line of the performance report
+type DriverPerformanceEntry struct {
+	DriverID     string  `json:"driver_id"`
+	DriverName   string  `json:"driver_name"`
+	Trips        int64   `json:"trips"`
+	Distance     float64 `json:"distance_km"`
+	Events       int64   `json:"events"`
+	HighSeverity int64   `json:"high_severity_events"`
+	EventsPer100 float64 `json:"events_per_100_km"`
+	OverallScore float64 `json:"overall_score"`
+}
+
+// FuelConsumptionReport compares the fuel used and bought by every vehicle
+// in a period
+type FuelConsumptionReport struct {
+	PeriodStart   time.Time            `json:"period_start"`
+	PeriodEnd     time.Time            `json:"period_end"`
+	TotalFuel     float64              `json:"total_fuel_liters"`
+	TotalDistance float64              `json:"total_distance_km"`
+	KmPerLiter    float64              `json:"km_per_liter"`
+	TotalRefueled float64              `json:"total_refueled_liters"`
+	TotalFuelCost float64              `json:"total_fuel_cost"`
+	Vehicles      []VehicleFuelSummary `json:"vehicles"`
+}
+
+// VehicleFuelSummary is a vehicle's line of the fuel consumption report
+type VehicleFuelSummary struct {
+	VehicleID    string  `json:"vehicle_id"`
+	LicensePlate string  `json:"license_plate"`
+	Fuel         float64 `json:"fuel_liters"`
+	Distance     float64 `json:"distance_km"`
+	KmPerLiter   float64 `json:"km_per_liter"`
+	Refuels      int64   `json:"refuels"`
+	Refueled     float64 `json:"refueled_liters"`
+	FuelCost     float64 `json:"fuel_cost"`
+}
+
+// MaintenanceReport lists the maintenance performed in a period
+type MaintenanceReport struct {
+	PeriodStart time.Time                `json:"period_start"`
+	PeriodEnd   time.Time                `json:"period_end"`
+	TotalLogs   int64                    `json:"total_logs"`
+	TotalCost   float64                  `json:"total_cost"`
+	ByType      []MaintenanceTypeSummary `json:"by_type"`
+	Logs        []MaintenanceEntry       `json:"logs"`
+}
+
+// MaintenanceTypeSummary totals the maintenance of a type
+type MaintenanceTypeSummary struct {
+	MaintenanceType string  `json:"maintenance_type"`
+	Count           int64   `json:"count"`
+	Cost            float64 `json:"cost"`
+}
+
+// MaintenanceEntry is a maintenance log of the report
+type MaintenanceEntry struct {
+	VehicleID       string    `json:"vehicle_id"`
+	LicensePlate    string    `json:"license_plate"`
+	PerformedAt     time.Time `json:"performed_at"`
+	MaintenanceType string    `json:"maintenance_type"`
+	Description     string    `json:"description"`
+	PerformedBy     string    `json:"performed_by"`
+	Odometer        float64   `json:"odometer_km"`
+	Cost            float64   `json:"cost"`
+}
+
+// fleetSummary generates the fleet_summary report
+func (s *Service) fleetSummary(ctx context.Context, companyID string, period Period) (interface{}, error) {
+	report := &FleetSummaryReport{PeriodStart: period.Start, PeriodEnd: period.End, Vehicles: []VehicleTripSummary{}}
+	db := s.db.WithContext(ctx)
+
+	if err := db.Model(&models.Vehicle{}).Where("company_id = ?", companyID).Count(&report.TotalVehicles).Error; err != nil {
+		return nil, fmt.Errorf("failed to count vehicles: %w", err)
+	}
+	if err := db.Table("vehicles").
+		Select(`vehicles.id AS vehicle_id, vehicles.license_plate, vehicles.status,
+			COUNT(trips.id) AS trips,
+			COALESCE(SUM(trips.total_distance), 0) AS distance,
+			COALESCE(SUM(trips.total_duration), 0) / 3600.0 AS duration,
+			COALESCE(SUM(trips.fuel_consumed), 0) AS fuel`).
+		Joins("LEFT JOIN trips ON trips.vehicle_id = vehicles.id AND trips.start_time >= ? AND trips.start_time < ?", period.Start, period.End).
+		Where("vehicles.company_id = ? AND vehicles.deleted_at IS NULL", companyID).
+		Group("vehicles.id, vehicles.license_plate, vehicles.status").
+		Order("vehicles.license_plate").
+		Scan(&report.Vehicles).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum up vehicle trips: %w", err)
+	}
+
+	for _, vehicle := range report.Vehicles {
+		if vehicle.Trips > 0 {
+			report.ActiveVehicles++
+		}
+		report.TotalTrips += vehicle.Trips
+		report.TotalDistance += vehicle.Distance
+		report.TotalFuel += vehicle.Fuel
+	}
+	return report, nil
+}
+
+// driverPerformance generates the driver_performance report
+func (s *Service) driverPerformance(ctx context.Context, companyID string, period Period) (interface{}, error) {
+	report := &DriverPerformanceReport{PeriodStart: period.Start, PeriodEnd: period.End, Drivers: []DriverPerformanceEntry{}}
+	db := s.db.WithContext(ctx)
+
+	if err := db.Table("drivers").
+		Select(`drivers.id AS driver_id, CONCAT(drivers.first_name, ' ', drivers.last_name) AS driver_name,
+			drivers.overall_score,
+			(SELECT COUNT(*) FROM trips WHERE trips.driver_id = drivers.id AND trips.start_time >= @start AND trips.start_time < @end) AS trips,
+			(SELECT COALESCE(SUM(trips.total_distance), 0) FROM trips WHERE trips.driver_id = drivers.id AND trips.start_time >= @start AND trips.start_time < @end) AS distance,
+			(SELECT COUNT(*) FROM driver_events WHERE driver_events.driver_id = drivers.id AND driver_events.created_at >= @start AND driver_events.created_at < @end) AS events,
+			(SELECT COUNT(*) FROM driver_events WHERE driver_events.driver_id = drivers.id AND driver_events.created_at >= @start AND driver_events.created_at < @end
+				AND driver_events.severity IN ('high', 'critical')) AS high_severity`,
+			map[string]interface{}{"start": period.Start, "end": period.End}).
+		Where("drivers.company_id = ? AND drivers.deleted_at IS NULL", companyID).
+		Order("drivers.first_name, drivers.last_name").
+		Scan(&report.Drivers).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum up driver performance: %w", err)
+	}
+
+	report.TotalDrivers = int64(len(report.Drivers))
+	for i := range report.Drivers {
+		driver := &report.Drivers[i]
+		if driver.Distance > 0 {
+			driver.EventsPer100 = float64(driver.Events) / driver.Distance * 100
+		}
+		report.TotalTrips += driver.Trips
+		report.TotalEvents += driver.Events
+	}
+	return report, nil
+}
+
+// fuelConsumption generates the fuel_consumption report
+func (s *Service) fuelConsumption(ctx context.Context, companyID string, period Period) (interface{}, error) {
+	report := &FuelConsumptionReport{PeriodStart: period.Start, PeriodEnd: period.End, Vehicles: []VehicleFuelSummary{}}
+	db := s.db.WithContext(ctx)
+
+	if err := db.Table("vehicles").
+		Select(`vehicles.id AS vehicle_id, vehicles.license_plate,
+			(SELECT COALESCE(SUM(trips.fuel_consumed), 0) FROM trips WHERE trips.vehicle_id = vehicles.id AND trips.start_time >= @start AND trips.start_time < @end) AS fuel,
+			(SELECT COALESCE(SUM(trips.total_distance), 0) FROM trips WHERE trips.vehicle_id = vehicles.id AND trips.start_time >= @start AND trips.start_time < @end) AS distance,
+			(SELECT COUNT(*) FROM fuel_logs WHERE fuel_logs.vehicle_id = vehicles.id AND fuel_logs.created_at >= @start AND fuel_logs.created_at < @end) AS refuels,
+			(SELECT COALESCE(SUM(fuel_logs.quantity), 0) FROM fuel_logs WHERE fuel_logs.vehicle_id = vehicles.id AND fuel_logs.created_at >= @start AND fuel_logs.created_at < @end) AS refueled,
+			(SELECT COALESCE(SUM(fuel_logs.cost), 0) FROM fuel_logs WHERE fuel_logs.vehicle_id = vehicles.id AND fuel_logs.created_at >= @start AND fuel_logs.created_at < @end) AS fuel_cost`,
+			map[string]interface{}{"start": period.Start, "end": period.End}).
+		Where("vehicles.company_id = ? AND vehicles.deleted_at IS NULL", companyID).
+		Order("vehicles.license_plate").
+		Scan(&report.Vehicles).Error; err != nil {
+		return nil, fmt.Errorf("failed to sum up vehicle fuel: %w", err)
+	}
+
+	for i := range report.Vehicles {
+		vehicle := &report.Vehicles[i]
+		if vehicle.Fuel > 0 {
+			vehicle.KmPerLiter = vehicle.Distance / vehicle.Fuel
+		}
+		report.TotalFuel += vehicle.Fuel
+		report.TotalDistance += vehicle.Distance
+		report.TotalRefueled += vehicle.Refueled
+		report.TotalFuelCost += vehicle.FuelCost
+	}
+	if report.TotalFuel > 0 {
+		report.KmPerLiter = report.TotalDistance / report.TotalFuel
+	}
+	return report, nil
+}
+
+// maintenance generates the maintenance report
+func (s *Service) maintenance(ctx context.Context, companyID string, period Period) (interface{}, error) {
+	report := &MaintenanceReport{PeriodStart: period.Start, PeriodEnd: period.End, ByType: []MaintenanceTypeSummary{}, Logs: []MaintenanceEntry{}}
+	db := s.db.WithContext(ctx)
+
+	if err := db.Table("maintenance_logs").
+		Select(`maintenance_logs.vehicle_id, vehicles.license_plate, maintenance_logs.created_at AS performed_at,
+			maintenance_logs.maintenance_type, maintenance_logs.description, maintenance_logs.performed_by,
+			maintenance_logs.odometer_reading AS odometer, maintenance_logs.cost`).
+		Joins("JOIN vehicles ON vehicles.id = maintenance_logs.vehicle_id").
+		Where("vehicles.company_id = ? AND maintenance_logs.created_at >= ? AND maintenance_logs.created_at < ?", companyID, period.Start, period.End).
+		Order("maintenance_logs.created_at").
+		Scan(&report.Logs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list maintenance logs: %w", err)
+	}
+
+	byType := map[string]int{}
+	for _, log := range report.Logs {
+		i, ok := byType[log.MaintenanceType]
+		if !ok {
+			i = len(report.ByType)
+			byType[log.MaintenanceType] = i
+			report.ByType = append(report.ByType, MaintenanceTypeSummary{MaintenanceType: log.MaintenanceType})
+		}
+		report.ByType[i].Count++
+		report.ByType[i].Cost += log.Cost
+		report.TotalLogs++
+		report.TotalCost += log.Cost
+	}
+	return report, nil
+}
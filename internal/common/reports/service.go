@@ -0,0 +1,558 @@
+package reports
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/email"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/export"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/storage"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+const (
+	// defaultPeriodDays is the span of reports requested without dates
+	defaultPeriodDays = 30
+
+	// maxPeriodDays bounds the span of a single report
+	maxPeriodDays = 366
+
+	// emailLinkTTL is how long links to reports sent by email work, the
+	// longest an S3 presigned URL may live
+	emailLinkTTL = 7 * 24 * time.Hour
+
+	// reportKeyPrefix starts the blob storage keys of report files
+	reportKeyPrefix = "reports/"
+)
+
+// Period is the span of time a report covers; End is exclusive
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Generator builds the data of a report for a company and period. The data
+// is rendered like export reports: a summary of its fields and a table for
+// every list of records in it.
+type Generator func(ctx context.Context, companyID string, period Period) (interface{}, error)
+
+// ReportType is a kind of report the service can generate
+type ReportType struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	generate Generator
+}
+
+// ReportQueue runs requested reports in the background
+type ReportQueue interface {
+	EnqueueReport(ctx context.Context, companyID, userID, reportID string) error
+}
+
+// ReportAlerter notifies users in the app when their report is ready
+type ReportAlerter interface {
+	CreateReportReadyAlert(ctx context.Context, companyID, userID, reportID, title string) error
+}
+
+// ReportMailer sends emails in the background
+type ReportMailer interface {
+	Send(ctx context.Context, email *email.Email) (*models.EmailMessage, error)
+}
+
+// Service generates reports in the background, keeps their files in blob
+// storage and notifies the users who asked for them
+type Service struct {
+	db        *gorm.DB
+	store     storage.BlobStore
+	queue     ReportQueue
+	scheduler SubscriptionScheduler
+	alerter   ReportAlerter
+	mailer    ReportMailer
+	location  *time.Location
+	types     map[string]*ReportType
+}
+
+// ReportRequest represents a request to generate a report. Dates are
+// inclusive days in the service's timezone; without them the report covers
+// the last 30 days.
+type ReportRequest struct {
+	ReportType string `json:"report_type" binding:"required"`
+	Format     string `json:"format"`
+	StartDate  string `json:"start_date"` // YYYY-MM-DD
+	EndDate    string `json:"end_date"`   // YYYY-MM-DD
+	CompanyID  string `json:"-"`
+	UserID     string `json:"-"`
+}
+
+// NewService creates a new report service with the built-in report types
+func NewService(db *gorm.DB) *Service {
+	location, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		location = time.UTC
+	}
+
+	s := &Service{
+		db:       db,
+		location: location,
+		types:    map[string]*ReportType{},
+	}
+	s.RegisterGenerator("fleet_summary", "Fleet Summary", s.fleetSummary)
+	s.RegisterGenerator("driver_performance", "Driver Performance", s.driverPerformance)
+	s.RegisterGenerator("fuel_consumption", "Fuel Consumption", s.fuelConsumption)
+	s.RegisterGenerator("maintenance", "Maintenance", s.maintenance)
+	return s
+}
+
+// SetStorage sets the blob store report files are written to
+func (s *Service) SetStorage(store storage.BlobStore) {
+	s.store = store
+}
+
+// SetQueue sets the queue that runs requested reports
+func (s *Service) SetQueue(queue ReportQueue) {
+	s.queue = queue
+}
+
+// SetAlerter sets the alerter notified when reports are ready
+func (s *Service) SetAlerter(alerter ReportAlerter) {
+	s.alerter = alerter
+}
+
+// SetMailer sets the mailer sending subscribed reports
+func (s *Service) SetMailer(mailer ReportMailer) {
+	s.mailer = mailer
+}
+
+// SetLocation sets the timezone report dates and periods are evaluated in
+func (s *Service) SetLocation(location *time.Location) {
+	if location != nil {
+		s.location = location
+	}
+}
+
+// RegisterGenerator adds a report type, replacing any type of the same name
+func (s *Service) RegisterGenerator(reportType, name string, generate Generator) {
+	s.types[reportType] = &ReportType{Type: reportType, Name: name, generate: generate}
+}
+
+// ReportTypes returns the report types that can be generated, by type
+func (s *Service) ReportTypes() []ReportType {
+	types := make([]ReportType, 0, len(s.types))
+	for _, reportType := range s.types {
+		types = append(types, *reportType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Type < types[j].Type })
+	return types
+}
+
+// RequestReport records a report and generates it in the background
+func (s *Service) RequestReport(ctx context.Context, req *ReportRequest) (*models.Report, error) {
+	if s.store == nil || s.queue == nil {
+		return nil, apperrors.NewServiceUnavailableError("reports are not available")
+	}
+
+	report, err := s.CreateReport(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(ctx, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// CreateReport records a pending report without queueing it
+func (s *Service) CreateReport(ctx context.Context, req *ReportRequest) (*models.Report, error) {
+	period, err := s.requestPeriod(req.StartDate, req.EndDate, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.createReport(ctx, &models.Report{
+		CompanyID:   req.CompanyID,
+		ReportType:  req.ReportType,
+		Format:      req.Format,
+		PeriodStart: period.Start,
+		PeriodEnd:   period.End,
+	}, req.UserID)
+}
+
+// RerunReport generates a report again with the parameters of an earlier one
+func (s *Service) RerunReport(ctx context.Context, companyID, userID, reportID string) (*models.Report, error) {
+	if s.store == nil || s.queue == nil {
+		return nil, apperrors.NewServiceUnavailableError("reports are not available")
+	}
+
+	original, err := s.GetReport(ctx, companyID, reportID)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.createReport(ctx, &models.Report{
+		CompanyID:   original.CompanyID,
+		RerunOf:     &original.ID,
+		ReportType:  original.ReportType,
+		Format:      original.Format,
+		PeriodStart: original.PeriodStart,
+		PeriodEnd:   original.PeriodEnd,
+	}, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.enqueue(ctx, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// createReport validates and records a pending report
+func (s *Service) createReport(ctx context.Context, report *models.Report, userID string) (*models.Report, error) {
+	if report.Format == "" {
+		report.Format = "pdf"
+	}
+	if err := s.validateReport(report); err != nil {
+		return nil, err
+	}
+
+	report.Title = s.reportTitle(report)
+	report.Status = models.ReportStatusPending
+	if userID != "" {
+		report.RequestedBy = &userID
+	}
+	if err := s.db.WithContext(ctx).Create(report).Error; err != nil {
+		return nil, apperrors.Wrap(err, "Failed to create report")
+	}
+	return report, nil
+}
+
+// enqueue queues the generation of a recorded report
+func (s *Service) enqueue(ctx context.Context, report *models.Report) error {
+	var userID string
+	if report.RequestedBy != nil {
+		userID = *report.RequestedBy
+	}
+	if err := s.queue.EnqueueReport(ctx, report.CompanyID, userID, report.ID); err != nil {
+		s.failReport(ctx, report, err)
+		return apperrors.Wrap(err, "Failed to queue report")
+	}
+	return nil
+}
+
+// RunReport generates the file of a pending report, stores it and notifies
+// the owner. Reports that already completed are returned as they are, so
+// retried jobs do not generate twice.
+func (s *Service) RunReport(ctx context.Context, reportID string) (*models.Report, error) {
+	if s.store == nil {
+		return nil, fmt.Errorf("report storage is not configured")
+	}
+
+	var report models.Report
+	if err := s.db.WithContext(ctx).First(&report, "id = ?", reportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("report")
+		}
+		return nil, fmt.Errorf("failed to load report: %w", err)
+	}
+	if report.Status == models.ReportStatusCompleted {
+		return &report, nil
+	}
+
+	startedAt := time.Now()
+	report.StartedAt = &startedAt
+	if err := s.db.WithContext(ctx).Model(&report).Updates(map[string]interface{}{
+		"status":     models.ReportStatusRunning,
+		"started_at": startedAt,
+		"error":      "",
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to start report: %w", err)
+	}
+
+	if err := s.writeReport(ctx, &report); err != nil {
+		s.failReport(ctx, &report, err)
+		return &report, err
+	}
+
+	completedAt := time.Now()
+	report.Status = models.ReportStatusCompleted
+	report.CompletedAt = &completedAt
+	if err := s.db.WithContext(ctx).Model(&report).Updates(map[string]interface{}{
+		"status":       models.ReportStatusCompleted,
+		"storage_key":  report.StorageKey,
+		"file_name":    report.FileName,
+		"content_type": report.ContentType,
+		"row_count":    report.RowCount,
+		"file_size":    report.FileSize,
+		"completed_at": completedAt,
+	}).Error; err != nil {
+		s.store.Delete(ctx, report.StorageKey)
+		return nil, fmt.Errorf("failed to complete report: %w", err)
+	}
+
+	s.notifyReady(ctx, &report)
+	return &report, nil
+}
+
+// writeReport generates the data of a report, renders it into a temporary
+// file and moves the file to blob storage
+func (s *Service) writeReport(ctx context.Context, report *models.Report) error {
+	reportType, ok := s.types[report.ReportType]
+	if !ok {
+		return fmt.Errorf("unknown report type: %s", report.ReportType)
+	}
+	data, err := reportType.generate(ctx, report.CompanyID, Period{Start: report.PeriodStart, End: report.PeriodEnd})
+	if err != nil {
+		return fmt.Errorf("failed to generate %s report: %w", report.ReportType, err)
+	}
+
+	file, err := os.CreateTemp("", "report-*."+report.Format)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	buffered := bufio.NewWriterSize(file, 64*1024)
+	count, err := export.WriteReport(report.Format, buffered, report.Title, data)
+	if err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to size report file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind report file: %w", err)
+	}
+
+	report.FileName = reportFileName(report, s.location)
+	report.StorageKey = fmt.Sprintf("%s%s/%s/%s", reportKeyPrefix, report.CompanyID, report.ID, report.FileName)
+	report.ContentType = export.ContentType(report.Format)
+	report.RowCount = count
+	report.FileSize = size
+
+	if err := s.store.Put(ctx, report.StorageKey, file, size, report.ContentType); err != nil {
+		return fmt.Errorf("failed to store report file: %w", err)
+	}
+	return nil
+}
+
+// failReport records why a report failed
+func (s *Service) failReport(ctx context.Context, report *models.Report, cause error) {
+	report.Status = models.ReportStatusFailed
+	report.Error = cause.Error()
+	if err := s.db.WithContext(ctx).Model(report).Updates(map[string]interface{}{
+		"status": models.ReportStatusFailed,
+		"error":  cause.Error(),
+	}).Error; err != nil {
+		fmt.Printf("Failed to mark report %s as failed: %v\n", report.ID, err)
+	}
+}
+
+// GetReport returns a report of a company
+func (s *Service) GetReport(ctx context.Context, companyID, reportID string) (*models.Report, error) {
+	var report models.Report
+	if err := s.db.WithContext(ctx).Where("id = ? AND company_id = ?", reportID, companyID).First(&report).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("report")
+		}
+		return nil, apperrors.Wrap(err, "Failed to get report")
+	}
+	return &report, nil
+}
+
+// ReportFilters narrow the reports listed
+type ReportFilters struct {
+	ReportType     string
+	Status         string
+	SubscriptionID string
+	RequestedBy    string
+	Page           int
+	Limit          int
+}
+
+// ListReports returns a page of a company's reports, newest first, and the
+// number of reports matching the filters
+func (s *Service) ListReports(ctx context.Context, companyID string, filters ReportFilters) ([]models.Report, int64, error) {
+	if filters.Limit <= 0 || filters.Limit > 100 {
+		filters.Limit = 20
+	}
+	if filters.Page <= 0 {
+		filters.Page = 1
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.Report{}).Where("company_id = ?", companyID)
+	if filters.ReportType != "" {
+		query = query.Where("report_type = ?", filters.ReportType)
+	}
+	if filters.Status != "" {
+		query = query.Where("status = ?", filters.Status)
+	}
+	if filters.SubscriptionID != "" {
+		query = query.Where("subscription_id = ?", filters.SubscriptionID)
+	}
+	if filters.RequestedBy != "" {
+		query = query.Where("requested_by = ?", filters.RequestedBy)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, apperrors.Wrap(err, "Failed to count reports")
+	}
+	var reports []models.Report
+	if err := query.Order("created_at DESC").Offset((filters.Page - 1) * filters.Limit).Limit(filters.Limit).
+		Find(&reports).Error; err != nil {
+		return nil, 0, apperrors.Wrap(err, "Failed to list reports")
+	}
+	return reports, total, nil
+}
+
+// OpenReport opens the file of a completed report
+func (s *Service) OpenReport(ctx context.Context, companyID, reportID string) (io.ReadCloser, *models.Report, error) {
+	report, err := s.GetReport(ctx, companyID, reportID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if report.Status != models.ReportStatusCompleted {
+		return nil, nil, apperrors.NewConflictError("Report is not ready yet")
+	}
+	if s.store == nil {
+		return nil, nil, apperrors.NewServiceUnavailableError("reports are not available")
+	}
+
+	reader, err := s.store.Open(ctx, report.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, apperrors.NewNotFoundError("report file")
+	}
+	if err != nil {
+		return nil, nil, apperrors.Wrap(err, "Failed to open report file")
+	}
+	return reader, report, nil
+}
+
+// notifyReady tells the owner of a report in the app and, for subscribed
+// reports, emails the subscription's recipients a link to it. Notification
+// failures are logged; the report itself succeeded.
+func (s *Service) notifyReady(ctx context.Context, report *models.Report) {
+	if s.alerter != nil && report.RequestedBy != nil {
+		if err := s.alerter.CreateReportReadyAlert(ctx, report.CompanyID, *report.RequestedBy, report.ID, report.Title); err != nil {
+			fmt.Printf("Failed to alert about report %s: %v\n", report.ID, err)
+		}
+	}
+
+	if s.mailer == nil || report.SubscriptionID == nil {
+		return
+	}
+	var subscription models.ReportSubscription
+	if err := s.db.WithContext(ctx).First(&subscription, "id = ?", *report.SubscriptionID).Error; err != nil {
+		fmt.Printf("Failed to load subscription of report %s: %v\n", report.ID, err)
+		return
+	}
+	recipients, err := s.subscriptionRecipients(ctx, &subscription)
+	if err != nil {
+		fmt.Printf("Failed to find recipients of report %s: %v\n", report.ID, err)
+		return
+	}
+	link, err := s.store.SignedURL(ctx, report.StorageKey, emailLinkTTL)
+	if err != nil {
+		fmt.Printf("Failed to sign link to report %s: %v\n", report.ID, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(emailLinkTTL).In(s.location)
+	for _, recipient := range recipients {
+		if _, err := s.mailer.Send(ctx, &email.Email{
+			CompanyID: report.CompanyID,
+			UserID:    subscription.UserID,
+			To:        recipient,
+			Template:  email.TemplateReportReady,
+			Data: map[string]interface{}{
+				"Title":       report.Title,
+				"DownloadURL": link,
+				"ExpiresAt":   expiresAt.Format("02/01/2006 15:04"),
+			},
+		}); err != nil {
+			fmt.Printf("Failed to email report %s to %s: %v\n", report.ID, recipient, err)
+		}
+	}
+}
+
+// requestPeriod turns the inclusive dates of a request into a period. A
+// missing end is today and a missing start is 30 days before the end.
+func (s *Service) requestPeriod(startDate, endDate string, now time.Time) (Period, error) {
+	end := startOfDay(now.In(s.location)).AddDate(0, 0, 1)
+	if endDate != "" {
+		day, err := time.ParseInLocation("2006-01-02", endDate, s.location)
+		if err != nil {
+			return Period{}, apperrors.NewValidationError("end_date must be a date in YYYY-MM-DD format")
+		}
+		end = day.AddDate(0, 0, 1)
+	}
+	start := end.AddDate(0, 0, -defaultPeriodDays)
+	if startDate != "" {
+		day, err := time.ParseInLocation("2006-01-02", startDate, s.location)
+		if err != nil {
+			return Period{}, apperrors.NewValidationError("start_date must be a date in YYYY-MM-DD format")
+		}
+		start = day
+	}
+
+	if !start.Before(end) {
+		return Period{}, apperrors.NewValidationError("start_date must not be after end_date")
+	}
+	if start.AddDate(0, 0, maxPeriodDays).Before(end) {
+		return Period{}, apperrors.NewValidationError(fmt.Sprintf("reports cover at most %d days", maxPeriodDays))
+	}
+	return Period{Start: start, End: end}, nil
+}
+
+// validateReport checks the company, type and format of a report
+func (s *Service) validateReport(report *models.Report) error {
+	if report.CompanyID == "" {
+		return apperrors.NewValidationError("company is required")
+	}
+	if _, ok := s.types[report.ReportType]; !ok {
+		return apperrors.NewValidationError(fmt.Sprintf("unknown report type: %s", report.ReportType))
+	}
+	if !export.IsValidFormat(report.Format) {
+		return apperrors.NewValidationError(fmt.Sprintf("unsupported format: %s", report.Format))
+	}
+	return nil
+}
+
+// reportTitle names a report after its type and the days it covers
+func (s *Service) reportTitle(report *models.Report) string {
+	name := report.ReportType
+	if reportType, ok := s.types[report.ReportType]; ok {
+		name = reportType.Name
+	}
+	first := report.PeriodStart.In(s.location)
+	last := report.PeriodEnd.In(s.location).Add(-time.Nanosecond)
+	if startOfDay(first).Equal(startOfDay(last)) {
+		return fmt.Sprintf("%s Report %s", name, first.Format("02/01/2006"))
+	}
+	return fmt.Sprintf("%s Report %s - %s", name, first.Format("02/01/2006"), last.Format("02/01/2006"))
+}
+
+// reportFileName names the file of a report after its type and period
+func reportFileName(report *models.Report, location *time.Location) string {
+	first := report.PeriodStart.In(location)
+	last := report.PeriodEnd.In(location).Add(-time.Nanosecond)
+	return fmt.Sprintf("%s_%s_%s.%s", report.ReportType, first.Format("20060102"), last.Format("20060102"), report.Format)
+}
+
+// startOfDay returns midnight of a time's day in its location
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
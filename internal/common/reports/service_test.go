@@ -0,0 +1,465 @@
+package reports
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/email"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/storage"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// fakeScheduler accepts every schedule except "not a schedule"
+type fakeScheduler struct{}
+
+func (fakeScheduler) ValidateSchedule(schedule, timezone string) error {
+	if schedule == "not a schedule" {
+		return fmt.Errorf("invalid schedule format")
+	}
+	return nil
+}
+
+func (fakeScheduler) ScheduleReportSubscription(subscription *models.ReportSubscription) error {
+	return nil
+}
+
+func (fakeScheduler) UnscheduleReportSubscription(subscriptionID string) error {
+	return nil
+}
+
+func jakarta(t *testing.T) *time.Location {
+	location, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	return location
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestRequestPeriod(t *testing.T) {
+	s := NewService(nil)
+	location := jakarta(t)
+	now := time.Date(2024, 6, 5, 20, 0, 0, 0, time.UTC) // 6 June 03:00 in Jakarta
+
+	period, err := s.requestPeriod("", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 7, 0, 0, 0, 0, location), period.End)
+	assert.Equal(t, time.Date(2024, 5, 8, 0, 0, 0, 0, location), period.Start)
+
+	period, err = s.requestPeriod("2024-05-01", "2024-05-31", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, location), period.Start)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, location), period.End)
+
+	// A single day
+	period, err = s.requestPeriod("2024-05-01", "2024-05-01", now)
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, period.End.Sub(period.Start))
+
+	for _, dates := range [][2]string{
+		{"01/05/2024", ""},
+		{"", "2024-13-01"},
+		{"2024-05-02", "2024-05-01"},
+		{"2023-01-01", "2024-05-01"},
+	} {
+		_, err := s.requestPeriod(dates[0], dates[1], now)
+		var appErr *apperrors.AppError
+		if assert.ErrorAs(t, err, &appErr, "dates %v", dates) {
+			assert.Equal(t, http.StatusBadRequest, appErr.Status)
+		}
+	}
+}
+
+func TestReportTitleAndFileName(t *testing.T) {
+	s := NewService(nil)
+	location := jakarta(t)
+	report := &models.Report{
+		ReportType:  "fuel_consumption",
+		Format:      "xlsx",
+		PeriodStart: time.Date(2024, 5, 1, 0, 0, 0, 0, location),
+		PeriodEnd:   time.Date(2024, 6, 1, 0, 0, 0, 0, location),
+	}
+
+	assert.Equal(t, "Fuel Consumption Report 01/05/2024 - 31/05/2024", s.reportTitle(report))
+	assert.Equal(t, "fuel_consumption_20240501_20240531.xlsx", reportFileName(report, location))
+
+	report.PeriodEnd = time.Date(2024, 5, 2, 0, 0, 0, 0, location)
+	assert.Equal(t, "Fuel Consumption Report 01/05/2024", s.reportTitle(report))
+}
+
+func TestSubscriptionPeriod(t *testing.T) {
+	location := jakarta(t)
+	// Monday 3 June 2024, 07:00 in Jakarta
+	runAt := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		period string
+		start  time.Time
+		end    time.Time
+	}{
+		{models.ReportPeriodDay, time.Date(2024, 6, 2, 0, 0, 0, 0, location), time.Date(2024, 6, 3, 0, 0, 0, 0, location)},
+		{models.ReportPeriodWeek, time.Date(2024, 5, 27, 0, 0, 0, 0, location), time.Date(2024, 6, 3, 0, 0, 0, 0, location)},
+		{models.ReportPeriodMonth, time.Date(2024, 5, 1, 0, 0, 0, 0, location), time.Date(2024, 6, 1, 0, 0, 0, 0, location)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.period, func(t *testing.T) {
+			period, err := subscriptionPeriod(&models.ReportSubscription{Timezone: "Asia/Jakarta", Period: tt.period}, runAt)
+			require.NoError(t, err)
+			assert.True(t, tt.start.Equal(period.Start), "start %s", period.Start)
+			assert.True(t, tt.end.Equal(period.End), "end %s", period.End)
+		})
+	}
+
+	// The run's day is taken in the subscription's timezone
+	period, err := subscriptionPeriod(&models.ReportSubscription{Timezone: "UTC", Period: models.ReportPeriodDay},
+		time.Date(2024, 6, 2, 23, 30, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), period.Start)
+
+	_, err = subscriptionPeriod(&models.ReportSubscription{Timezone: "Mars/Olympus", Period: models.ReportPeriodDay}, runAt)
+	assert.Error(t, err)
+	_, err = subscriptionPeriod(&models.ReportSubscription{Timezone: "UTC", Period: "year"}, runAt)
+	assert.Error(t, err)
+}
+
+func TestApplySubscriptionRequest(t *testing.T) {
+	subscription := &models.ReportSubscription{
+		Name:       "Weekly fuel",
+		ReportType: "fuel_consumption",
+		Format:     "pdf",
+		Schedule:   "0 7 * * 1",
+		Period:     models.ReportPeriodWeek,
+		Recipients: []string{"ops@example.co.id"},
+		IsActive:   true,
+	}
+	recipients := []string{" fleet@example.co.id ", ""}
+	active := false
+
+	applySubscriptionRequest(subscription, &SubscriptionRequest{
+		Format:     stringPtr("xlsx"),
+		Recipients: &recipients,
+		IsActive:   &active,
+	})
+
+	assert.Equal(t, "Weekly fuel", subscription.Name)
+	assert.Equal(t, "0 7 * * 1", subscription.Schedule)
+	assert.Equal(t, "xlsx", subscription.Format)
+	assert.Equal(t, []string{"fleet@example.co.id"}, subscription.Recipients)
+	assert.False(t, subscription.IsActive)
+}
+
+func TestValidateSubscription(t *testing.T) {
+	s := NewService(nil)
+	s.SetScheduler(fakeScheduler{})
+	valid := func() *models.ReportSubscription {
+		return &models.ReportSubscription{
+			CompanyID:  "company-1",
+			Name:       "Weekly fuel",
+			ReportType: "fuel_consumption",
+			Format:     "pdf",
+			Schedule:   "0 7 * * 1",
+			Timezone:   "Asia/Jakarta",
+			Period:     models.ReportPeriodWeek,
+			Recipients: []string{"ops@example.co.id"},
+		}
+	}
+	require.NoError(t, s.validateSubscription(valid()))
+
+	tooMany := make([]string, maxRecipients+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("user%d@example.co.id", i)
+	}
+	tests := map[string]func(*models.ReportSubscription){
+		"no name":         func(sub *models.ReportSubscription) { sub.Name = "" },
+		"unknown type":    func(sub *models.ReportSubscription) { sub.ReportType = "payroll" },
+		"unknown format":  func(sub *models.ReportSubscription) { sub.Format = "docx" },
+		"unknown period":  func(sub *models.ReportSubscription) { sub.Period = "year" },
+		"no schedule":     func(sub *models.ReportSubscription) { sub.Schedule = "" },
+		"bad schedule":    func(sub *models.ReportSubscription) { sub.Schedule = "not a schedule" },
+		"bad recipient":   func(sub *models.ReportSubscription) { sub.Recipients = []string{"ops"} },
+		"named recipient": func(sub *models.ReportSubscription) { sub.Recipients = []string{"Ops <ops@example.co.id>"} },
+		"many recipients": func(sub *models.ReportSubscription) { sub.Recipients = tooMany },
+		"no company":      func(sub *models.ReportSubscription) { sub.CompanyID = "" },
+	}
+	for name, change := range tests {
+		t.Run(name, func(t *testing.T) {
+			subscription := valid()
+			change(subscription)
+			var appErr *apperrors.AppError
+			if assert.ErrorAs(t, s.validateSubscription(subscription), &appErr) {
+				assert.Equal(t, http.StatusBadRequest, appErr.Status)
+			}
+		})
+	}
+}
+
+func TestReportTypes(t *testing.T) {
+	s := NewService(nil)
+	s.RegisterGenerator("compliance", "Compliance", func(ctx context.Context, companyID string, period Period) (interface{}, error) {
+		return nil, nil
+	})
+
+	var types []string
+	for _, reportType := range s.ReportTypes() {
+		types = append(types, reportType.Type)
+	}
+	assert.Equal(t, []string{"compliance", "driver_performance", "fleet_summary", "fuel_consumption", "maintenance"}, types)
+}
+
+func TestRequestReport_Unavailable(t *testing.T) {
+	s := NewService(nil)
+
+	_, err := s.RequestReport(context.Background(), &ReportRequest{ReportType: "fleet_summary", CompanyID: "company-1"})
+	var appErr *apperrors.AppError
+	if assert.ErrorAs(t, err, &appErr) {
+		assert.Equal(t, http.StatusServiceUnavailable, appErr.Status)
+	}
+}
+
+// fakeReportQueue records the reports it is asked to run
+type fakeReportQueue struct {
+	reportIDs []string
+	err       error
+}
+
+func (q *fakeReportQueue) EnqueueReport(_ context.Context, _, _, reportID string) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.reportIDs = append(q.reportIDs, reportID)
+	return nil
+}
+
+// fakeReportAlerter records the reports users were alerted about
+type fakeReportAlerter struct {
+	alerted map[string]string // report ID -> user ID
+}
+
+func (a *fakeReportAlerter) CreateReportReadyAlert(_ context.Context, _, userID, reportID, _ string) error {
+	a.alerted[reportID] = userID
+	return nil
+}
+
+// fakeReportMailer records the addresses reports were emailed to
+type fakeReportMailer struct {
+	sent []string
+}
+
+func (m *fakeReportMailer) Send(_ context.Context, message *email.Email) (*models.EmailMessage, error) {
+	m.sent = append(m.sent, message.To)
+	return &models.EmailMessage{}, nil
+}
+
+// testVehicleReport is rendered as a summary row and a table of vehicles
+type testVehicleReport struct {
+	Vehicles int `json:"vehicles"`
+	Rows     []struct {
+		Plate string `json:"plate"`
+	} `json:"rows"`
+}
+
+// newTestReportService returns a report service writing to a temporary
+// local store, with a "vehicles" report type listing two vehicles
+func newTestReportService(t *testing.T, db *gorm.DB) (*Service, *fakeReportQueue, *fakeReportAlerter, *fakeReportMailer) {
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080/api/v1/exports/download", "test-report-link-secret")
+	require.NoError(t, err)
+	queue := &fakeReportQueue{}
+	alerter := &fakeReportAlerter{alerted: map[string]string{}}
+	mailer := &fakeReportMailer{}
+
+	s := NewService(db)
+	s.SetStorage(store)
+	s.SetQueue(queue)
+	s.SetAlerter(alerter)
+	s.SetMailer(mailer)
+	s.SetScheduler(fakeScheduler{})
+	s.RegisterGenerator("vehicles", "Vehicles", func(ctx context.Context, companyID string, period Period) (interface{}, error) {
+		report := testVehicleReport{Vehicles: 2}
+		report.Rows = make([]struct {
+			Plate string `json:"plate"`
+		}, 2)
+		report.Rows[0].Plate, report.Rows[1].Plate = "B 1234 ABC", "B 5678 DEF"
+		return report, nil
+	})
+	return s, queue, alerter, mailer
+}
+
+func TestService_Reports(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	s, queue, alerter, _ := newTestReportService(t, db)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	otherCompany := testutil.NewTestCompany()
+	require.NoError(t, db.Create(otherCompany).Error)
+	userID := uuid.New().String()
+
+	report, err := s.RequestReport(ctx, &ReportRequest{
+		ReportType: "vehicles",
+		Format:     "csv",
+		StartDate:  "2025-03-01",
+		EndDate:    "2025-03-31",
+		CompanyID:  company.ID,
+		UserID:     userID,
+	})
+	require.NoError(t, err)
+	testutil.AssertValidUUID(t, report.ID)
+	assert.Equal(t, models.ReportStatusPending, report.Status)
+	assert.Equal(t, "Vehicles Report 01/03/2025 - 31/03/2025", report.Title)
+	assert.Equal(t, []string{report.ID}, queue.reportIDs)
+
+	t.Run("reject unknown report type", func(t *testing.T) {
+		_, err := s.RequestReport(ctx, &ReportRequest{ReportType: "unknown", CompanyID: company.ID})
+		var appErr *apperrors.AppError
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, http.StatusBadRequest, appErr.Status)
+	})
+
+	t.Run("not ready before it runs", func(t *testing.T) {
+		_, _, err := s.OpenReport(ctx, company.ID, report.ID)
+		var appErr *apperrors.AppError
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, http.StatusConflict, appErr.Status)
+	})
+
+	completed, err := s.RunReport(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReportStatusCompleted, completed.Status)
+	assert.Equal(t, int64(3), completed.RowCount, "the summary row and two vehicles")
+	assert.Equal(t, "vehicles_20250301_20250331.csv", completed.FileName)
+	assert.Equal(t, userID, alerter.alerted[report.ID])
+
+	t.Run("running again keeps the completed report", func(t *testing.T) {
+		again, err := s.RunReport(ctx, report.ID)
+		require.NoError(t, err)
+		assert.Equal(t, completed.StorageKey, again.StorageKey)
+	})
+
+	t.Run("open the report of its company", func(t *testing.T) {
+		reader, opened, err := s.OpenReport(ctx, company.ID, report.ID)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, completed.FileName, opened.FileName)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "B 5678 DEF")
+
+		_, _, err = s.OpenReport(ctx, otherCompany.ID, report.ID)
+		var appErr *apperrors.AppError
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, http.StatusNotFound, appErr.Status)
+	})
+
+	t.Run("rerun records a new report", func(t *testing.T) {
+		rerun, err := s.RerunReport(ctx, company.ID, userID, report.ID)
+		require.NoError(t, err)
+		assert.NotEqual(t, report.ID, rerun.ID)
+		require.NotNil(t, rerun.RerunOf)
+		assert.Equal(t, report.ID, *rerun.RerunOf)
+		assert.True(t, rerun.PeriodStart.Equal(report.PeriodStart))
+		assert.Equal(t, models.ReportStatusPending, rerun.Status)
+	})
+
+	t.Run("mark the report failed when it cannot be queued", func(t *testing.T) {
+		queue.err = fmt.Errorf("redis unavailable")
+		defer func() { queue.err = nil }()
+
+		_, err := s.RequestReport(ctx, &ReportRequest{ReportType: "vehicles", CompanyID: company.ID})
+		require.Error(t, err)
+
+		failed, total, err := s.ListReports(ctx, company.ID, ReportFilters{Status: models.ReportStatusFailed})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		require.Len(t, failed, 1)
+		assert.Equal(t, "redis unavailable", failed[0].Error)
+	})
+
+	t.Run("list reports per company", func(t *testing.T) {
+		reports, total, err := s.ListReports(ctx, company.ID, ReportFilters{RequestedBy: userID})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Len(t, reports, 2)
+
+		page, total, err := s.ListReports(ctx, company.ID, ReportFilters{Page: 2, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), total)
+		assert.Len(t, page, 1)
+
+		others, total, err := s.ListReports(ctx, otherCompany.ID, ReportFilters{})
+		require.NoError(t, err)
+		assert.Zero(t, total)
+		assert.Empty(t, others)
+	})
+}
+
+func TestService_SubscriptionReports(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	s, queue, alerter, mailer := newTestReportService(t, db)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	userID := uuid.New().String()
+
+	subscription, err := s.CreateSubscription(ctx, company.ID, userID, &SubscriptionRequest{
+		ReportType: stringPtr("vehicles"),
+		Format:     stringPtr("csv"),
+		Schedule:   stringPtr("0 7 * * 1"),
+		Recipients: &[]string{"fleet@example.com", "owner@example.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Vehicles Report", subscription.Name)
+
+	// Monday 7:00 in Jakarta covers the previous Monday to Sunday
+	runAt := time.Date(2025, 3, 10, 7, 0, 0, 0, jakarta(t))
+	report, err := s.RunSubscription(ctx, subscription.ID, runAt)
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	require.NotNil(t, report.SubscriptionID)
+	assert.Equal(t, subscription.ID, *report.SubscriptionID)
+	assert.True(t, report.PeriodStart.Equal(time.Date(2025, 3, 3, 0, 0, 0, 0, jakarta(t))))
+	assert.Equal(t, []string{report.ID}, queue.reportIDs)
+
+	stored, err := s.GetSubscription(ctx, company.ID, subscription.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.LastReportID)
+	assert.Equal(t, report.ID, *stored.LastReportID)
+	assert.NotNil(t, stored.LastRunAt)
+
+	_, err = s.RunReport(ctx, report.ID)
+	require.NoError(t, err)
+	assert.Equal(t, userID, alerter.alerted[report.ID])
+	assert.Equal(t, []string{"fleet@example.com", "owner@example.com"}, mailer.sent)
+
+	listed, total, err := s.ListReports(ctx, company.ID, ReportFilters{SubscriptionID: subscription.ID})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, listed, 1)
+	assert.Equal(t, models.ReportStatusCompleted, listed[0].Status)
+
+	t.Run("runs of deleted subscriptions are skipped", func(t *testing.T) {
+		require.NoError(t, s.DeleteSubscription(ctx, company.ID, subscription.ID))
+
+		report, err := s.RunSubscription(ctx, subscription.ID, runAt.AddDate(0, 0, 7))
+		require.NoError(t, err)
+		assert.Nil(t, report)
+		assert.Len(t, queue.reportIDs, 1)
+	})
+}
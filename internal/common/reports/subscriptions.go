@@ -0,0 +1,326 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// maxRecipients limits the addresses a subscription emails
+const maxRecipients = 20
+
+// SubscriptionScheduler runs report subscriptions on their schedules
+type SubscriptionScheduler interface {
+	ValidateSchedule(schedule, timezone string) error
+	ScheduleReportSubscription(subscription *models.ReportSubscription) error
+	UnscheduleReportSubscription(subscriptionID string) error
+}
+
+// SubscriptionRequest represents a request to create or change a report
+// subscription. Omitted fields of a change keep their values.
+type SubscriptionRequest struct {
+	Name       *string   `json:"name"`
+	ReportType *string   `json:"report_type"`
+	Format     *string   `json:"format"`
+	Schedule   *string   `json:"schedule"` // cron expression or @-descriptor, e.g. "0 7 * * 1"
+	Timezone   *string   `json:"timezone"`
+	Period     *string   `json:"period"` // day, week or month
+	Recipients *[]string `json:"recipients"`
+	IsActive   *bool     `json:"is_active"`
+}
+
+// SetScheduler sets the scheduler that runs report subscriptions
+func (s *Service) SetScheduler(scheduler SubscriptionScheduler) {
+	s.scheduler = scheduler
+}
+
+// CreateSubscription records a report subscription of a user and schedules it
+func (s *Service) CreateSubscription(ctx context.Context, companyID, userID string, req *SubscriptionRequest) (*models.ReportSubscription, error) {
+	if s.scheduler == nil {
+		return nil, apperrors.NewServiceUnavailableError("report subscriptions are not available")
+	}
+
+	subscription := &models.ReportSubscription{
+		CompanyID: companyID,
+		UserID:    userID,
+		Format:    "pdf",
+		Timezone:  s.location.String(),
+		Period:    models.ReportPeriodWeek,
+		IsActive:  true,
+	}
+	applySubscriptionRequest(subscription, req)
+	if subscription.Name == "" {
+		subscription.Name = s.reportTitleName(subscription.ReportType)
+	}
+	if err := s.validateSubscription(subscription); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Create(subscription).Error; err != nil {
+		return nil, apperrors.Wrap(err, "Failed to create report subscription")
+	}
+	if err := s.scheduler.ScheduleReportSubscription(subscription); err != nil {
+		s.db.WithContext(ctx).Delete(subscription)
+		return nil, apperrors.Wrap(err, "Failed to schedule report subscription")
+	}
+	return subscription, nil
+}
+
+// UpdateSubscription changes a report subscription and its schedule
+func (s *Service) UpdateSubscription(ctx context.Context, companyID, subscriptionID string, req *SubscriptionRequest) (*models.ReportSubscription, error) {
+	if s.scheduler == nil {
+		return nil, apperrors.NewServiceUnavailableError("report subscriptions are not available")
+	}
+
+	subscription, err := s.GetSubscription(ctx, companyID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	applySubscriptionRequest(subscription, req)
+	if err := s.validateSubscription(subscription); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Save(subscription).Error; err != nil {
+		return nil, apperrors.Wrap(err, "Failed to update report subscription")
+	}
+	if err := s.scheduler.ScheduleReportSubscription(subscription); err != nil {
+		return nil, apperrors.Wrap(err, "Failed to schedule report subscription")
+	}
+	return subscription, nil
+}
+
+// DeleteSubscription stops and removes a report subscription. Reports it
+// generated are kept.
+func (s *Service) DeleteSubscription(ctx context.Context, companyID, subscriptionID string) error {
+	subscription, err := s.GetSubscription(ctx, companyID, subscriptionID)
+	if err != nil {
+		return err
+	}
+	if s.scheduler != nil {
+		if err := s.scheduler.UnscheduleReportSubscription(subscription.ID); err != nil {
+			return apperrors.Wrap(err, "Failed to unschedule report subscription")
+		}
+	}
+	if err := s.db.WithContext(ctx).Delete(subscription).Error; err != nil {
+		return apperrors.Wrap(err, "Failed to delete report subscription")
+	}
+	return nil
+}
+
+// GetSubscription returns a report subscription of a company
+func (s *Service) GetSubscription(ctx context.Context, companyID, subscriptionID string) (*models.ReportSubscription, error) {
+	var subscription models.ReportSubscription
+	if err := s.db.WithContext(ctx).Where("id = ? AND company_id = ?", subscriptionID, companyID).
+		First(&subscription).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("report subscription")
+		}
+		return nil, apperrors.Wrap(err, "Failed to get report subscription")
+	}
+	return &subscription, nil
+}
+
+// ListSubscriptions returns the report subscriptions of a company
+func (s *Service) ListSubscriptions(ctx context.Context, companyID string) ([]models.ReportSubscription, error) {
+	var subscriptions []models.ReportSubscription
+	if err := s.db.WithContext(ctx).Where("company_id = ?", companyID).Order("created_at").
+		Find(&subscriptions).Error; err != nil {
+		return nil, apperrors.Wrap(err, "Failed to list report subscriptions")
+	}
+	return subscriptions, nil
+}
+
+// ScheduleSubscriptions schedules every active subscription, so the
+// scheduler follows the database after restarts. Subscriptions whose timing
+// did not change keep their pending run.
+func (s *Service) ScheduleSubscriptions(ctx context.Context) (int, error) {
+	if s.scheduler == nil {
+		return 0, nil
+	}
+
+	var subscriptions []models.ReportSubscription
+	if err := s.db.WithContext(ctx).Where("is_active = ?", true).Find(&subscriptions).Error; err != nil {
+		return 0, fmt.Errorf("failed to load report subscriptions: %w", err)
+	}
+	scheduled := 0
+	for i := range subscriptions {
+		if err := s.scheduler.ScheduleReportSubscription(&subscriptions[i]); err != nil {
+			fmt.Printf("Failed to schedule report subscription %s: %v\n", subscriptions[i].ID, err)
+			continue
+		}
+		scheduled++
+	}
+	return scheduled, nil
+}
+
+// RunSubscription queues the report of a subscription's run due at a time,
+// covering the period that ended on that day. Runs of subscriptions that were
+// deleted or paused unschedule them and return nil.
+func (s *Service) RunSubscription(ctx context.Context, subscriptionID string, scheduledFor time.Time) (*models.Report, error) {
+	if s.store == nil || s.queue == nil {
+		return nil, fmt.Errorf("reports are not available")
+	}
+
+	var subscription models.ReportSubscription
+	err := s.db.WithContext(ctx).First(&subscription, "id = ?", subscriptionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !subscription.IsActive) {
+		if s.scheduler != nil {
+			s.scheduler.UnscheduleReportSubscription(subscriptionID)
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load report subscription: %w", err)
+	}
+
+	period, err := subscriptionPeriod(&subscription, scheduledFor)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.createReport(ctx, &models.Report{
+		CompanyID:      subscription.CompanyID,
+		SubscriptionID: &subscription.ID,
+		ReportType:     subscription.ReportType,
+		Format:         subscription.Format,
+		PeriodStart:    period.Start,
+		PeriodEnd:      period.End,
+	}, subscription.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(&subscription).Updates(map[string]interface{}{
+		"last_run_at":    now,
+		"last_report_id": report.ID,
+	}).Error; err != nil {
+		fmt.Printf("Failed to record run of report subscription %s: %v\n", subscription.ID, err)
+	}
+
+	if err := s.enqueue(ctx, report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// subscriptionRecipients returns the addresses a subscription emails: its
+// recipients, or its owner
+func (s *Service) subscriptionRecipients(ctx context.Context, subscription *models.ReportSubscription) ([]string, error) {
+	if len(subscription.Recipients) > 0 {
+		return subscription.Recipients, nil
+	}
+	var owner models.User
+	if err := s.db.WithContext(ctx).Select("email").First(&owner, "id = ?", subscription.UserID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load subscription owner: %w", err)
+	}
+	return []string{owner.Email}, nil
+}
+
+// subscriptionPeriod returns the period a subscription's run covers: the
+// day, week or calendar month that ended at the start of the run's day in
+// the subscription's timezone. A weekly report run on Monday covers the
+// previous Monday to Sunday.
+func subscriptionPeriod(subscription *models.ReportSubscription, runAt time.Time) (Period, error) {
+	location, err := time.LoadLocation(subscription.Timezone)
+	if err != nil {
+		return Period{}, fmt.Errorf("invalid timezone %q: %w", subscription.Timezone, err)
+	}
+	end := startOfDay(runAt.In(location))
+	switch subscription.Period {
+	case models.ReportPeriodDay:
+		return Period{Start: end.AddDate(0, 0, -1), End: end}, nil
+	case models.ReportPeriodWeek:
+		return Period{Start: end.AddDate(0, 0, -7), End: end}, nil
+	case models.ReportPeriodMonth:
+		start := time.Date(end.Year(), end.Month()-1, 1, 0, 0, 0, 0, location)
+		return Period{Start: start, End: time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, location)}, nil
+	default:
+		return Period{}, fmt.Errorf("unknown report period: %s", subscription.Period)
+	}
+}
+
+// applySubscriptionRequest copies the fields given in a request
+func applySubscriptionRequest(subscription *models.ReportSubscription, req *SubscriptionRequest) {
+	if req.Name != nil {
+		subscription.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.ReportType != nil {
+		subscription.ReportType = *req.ReportType
+	}
+	if req.Format != nil {
+		subscription.Format = *req.Format
+	}
+	if req.Schedule != nil {
+		subscription.Schedule = strings.TrimSpace(*req.Schedule)
+	}
+	if req.Timezone != nil {
+		subscription.Timezone = *req.Timezone
+	}
+	if req.Period != nil {
+		subscription.Period = *req.Period
+	}
+	if req.Recipients != nil {
+		recipients := make([]string, 0, len(*req.Recipients))
+		for _, recipient := range *req.Recipients {
+			if recipient = strings.TrimSpace(recipient); recipient != "" {
+				recipients = append(recipients, recipient)
+			}
+		}
+		subscription.Recipients = recipients
+	}
+	if req.IsActive != nil {
+		subscription.IsActive = *req.IsActive
+	}
+}
+
+// validateSubscription checks the report, schedule and recipients of a
+// subscription
+func (s *Service) validateSubscription(subscription *models.ReportSubscription) error {
+	if subscription.Name == "" {
+		return apperrors.NewValidationError("name is required")
+	}
+	if err := s.validateReport(&models.Report{
+		CompanyID:  subscription.CompanyID,
+		ReportType: subscription.ReportType,
+		Format:     subscription.Format,
+	}); err != nil {
+		return err
+	}
+	switch subscription.Period {
+	case models.ReportPeriodDay, models.ReportPeriodWeek, models.ReportPeriodMonth:
+	default:
+		return apperrors.NewValidationError("period must be day, week or month")
+	}
+	if subscription.Schedule == "" {
+		return apperrors.NewValidationError("schedule is required")
+	}
+	if err := s.scheduler.ValidateSchedule(subscription.Schedule, subscription.Timezone); err != nil {
+		return apperrors.NewValidationError(err.Error())
+	}
+	if len(subscription.Recipients) > maxRecipients {
+		return apperrors.NewValidationError(fmt.Sprintf("a subscription emails at most %d recipients", maxRecipients))
+	}
+	for _, recipient := range subscription.Recipients {
+		if address, err := mail.ParseAddress(recipient); err != nil || address.Address != recipient {
+			return apperrors.NewValidationError(fmt.Sprintf("invalid recipient email: %s", recipient))
+		}
+	}
+	return nil
+}
+
+// reportTitleName names a subscription after its report type
+func (s *Service) reportTitleName(reportType string) string {
+	if registered, ok := s.types[reportType]; ok {
+		return registered.Name + " Report"
+	}
+	return ""
+}
@@ -262,4 +262,5 @@ type SubscriptionRepository interface {
 	GetByPlanType(ctx context.Context, planType string, pagination Pagination) ([]*models.Subscription, error)
 	UpdateStatus(ctx context.Context, subscriptionID string, status string) error
 	GetCompanyActiveSubscription(ctx context.Context, companyID string) (*models.Subscription, error)
+	GetDueForRenewal(ctx context.Context, before time.Time) ([]*models.Subscription, error)
 }
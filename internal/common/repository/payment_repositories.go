@@ -309,3 +309,15 @@ func (r *SubscriptionRepositoryImpl) GetCompanyActiveSubscription(ctx context.Co
 	
 	return &subscription, nil
 }
+
+// GetDueForRenewal retrieves active subscriptions whose period ends before the given time
+func (r *SubscriptionRepositoryImpl) GetDueForRenewal(ctx context.Context, before time.Time) ([]*models.Subscription, error) {
+	var subscriptions []*models.Subscription
+	
+	if err := r.db.WithContext(ctx).Where("is_active = true AND status = ? AND end_date <= ?", "active", before).
+		Order("end_date ASC").Find(&subscriptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get subscriptions due for renewal: %w", err)
+	}
+	
+	return subscriptions, nil
+}
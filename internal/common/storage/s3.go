@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// unsignedPayload skips hashing request bodies, so uploads stream
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// maxPresignExpiry is the longest expiry S3 accepts for presigned URLs
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+// S3Config configures an S3-compatible object store
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+// S3Store keeps blobs in a bucket of an S3-compatible object store, such as
+// AWS S3 or MinIO, signing requests with AWS Signature Version 4. Its signed
+// URLs are presigned GET requests served by the object store itself.
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Store creates an S3-compatible store
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Bucket == "" || config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("bucket, access key and secret key are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+// Put uploads a blob in a single PUT request
+func (ss *S3Store) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	req, err := ss.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	ss.sign(req)
+
+	resp, err := ss.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload blob: %w", err)
+	}
+	defer resp.Body.Close()
+	return s3Error(resp, "upload")
+}
+
+// Open downloads a blob
+func (ss *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := ss.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	ss.sign(req)
+
+	resp, err := ss.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if err := s3Error(resp, "download"); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes a blob
+func (ss *S3Store) Delete(ctx context.Context, key string) error {
+	req, err := ss.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	ss.sign(req)
+
+	resp, err := ss.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return s3Error(resp, "delete")
+}
+
+// SignedURL returns a presigned GET URL for the blob
+func (ss *S3Store) SignedURL(_ context.Context, key string, expiry time.Duration) (string, error) {
+	target, err := ss.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	if expiry > maxPresignExpiry {
+		expiry = maxPresignExpiry
+	}
+	return ss.presign(http.MethodGet, target, expiry), nil
+}
+
+// objectURL returns the URL of a blob
+func (ss *S3Store) objectURL(key string) (*url.URL, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	target := *ss.endpoint
+	if ss.config.PathStyle {
+		target.Path = target.Path + "/" + ss.config.Bucket + "/" + cleaned
+	} else {
+		target.Host = ss.config.Bucket + "." + target.Host
+		target.Path = target.Path + "/" + cleaned
+	}
+	target.RawPath = awsURIEncode(target.Path, false)
+	return &target, nil
+}
+
+// newRequest creates an unsigned request for a blob
+func (ss *S3Store) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	target, err := ss.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	return http.NewRequestWithContext(ctx, method, target.String(), body)
+}
+
+// sign adds a Signature Version 4 Authorization header to a request
+func (ss *S3Store) sign(req *http.Request) {
+	now := ss.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	headers := map[string]string{
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": unsignedPayload,
+		"x-amz-date":           amzDate,
+	}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers["content-type"] = contentType
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := ss.scope(now)
+	signature := ss.signature(now, scope, amzDate, canonicalRequest)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		ss.config.AccessKey, scope, signedHeaders, signature))
+}
+
+// presign returns a URL carrying its Signature Version 4 signature in the
+// query string
+func (ss *S3Store) presign(method string, target *url.URL, expiry time.Duration) string {
+	now := ss.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := ss.scope(now)
+
+	query := target.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", ss.config.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		target.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + target.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+
+	signed := *target
+	signed.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + ss.signature(now, scope, amzDate, canonicalRequest)
+	return signed.String()
+}
+
+// scope returns the credential scope of requests signed at a time
+func (ss *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + ss.config.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with a key derived from the secret key
+func (ss *S3Store) signature(now time.Time, scope, amzDate, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+ss.config.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, ss.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name as Signature
+// Version 4 requires
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsURIEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash is set
+func awsURIEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+// s3Error turns an unsuccessful response into an error
+func s3Error(resp *http.Response, operation string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("object store %s failed with status %d: %s", operation, resp.StatusCode, strings.TrimSpace(string(message)))
+}
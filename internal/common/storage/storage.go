@@ -0,0 +1,84 @@
+// Package storage keeps generated files, such as data exports, in a blob
+// store: a directory on the local filesystem or an S3-compatible object
+// store. Stored files are handed out through signed, expiring URLs so
+// downloads need no further authentication.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidSignature is returned for download links that were tampered with
+// or have expired
+var ErrInvalidSignature = errors.New("invalid or expired download signature")
+
+// BlobStore stores blobs under slash-separated keys
+type BlobStore interface {
+	// Put stores size bytes read from body under key, replacing any blob
+	// stored there
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Open streams a stored blob
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that downloads the blob until expiry has passed
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// Config selects and configures a blob store
+type Config struct {
+	Driver string // local or s3
+
+	// Local filesystem
+	Dir       string // directory the blobs are stored in
+	PublicURL string // URL the download route of this API is served at
+	Secret    string // key signing the download links
+
+	// S3-compatible object store
+	S3Endpoint  string // e.g. https://s3.ap-southeast-3.amazonaws.com or http://minio:9000
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool // address the bucket in the path instead of the host name
+}
+
+// New creates the blob store selected by the configuration
+func New(cfg Config) (BlobStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalStore(cfg.Dir, cfg.PublicURL, cfg.Secret)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+// cleanKey validates a blob key, rejecting keys that would escape the store
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return cleaned, nil
+}
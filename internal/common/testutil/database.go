@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/geofencing"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -75,13 +76,25 @@ func SetupTestDB(t *testing.T) (*gorm.DB, func()) {
 		&models.Driver{},
 		&models.DriverEvent{},
 		&models.PerformanceLog{},
+		&models.DriverBehaviorRuleSet{},
+		&models.DriverBehaviorRule{},
 		&models.GPSTrack{},
 		&models.Trip{},
 		&models.Geofence{},
+		&geofencing.GeofenceEvent{},
+		&geofencing.GeofenceViolation{},
 		&models.VehicleHistory{},
 		&models.Subscription{},
 		&models.Payment{},
 		&models.Invoice{},
+		&models.PaymentWebhookEvent{},
+		&models.EmailMessage{},
+		&models.NotificationMessage{},
+		&models.DataExport{},
+		&models.ReportSubscription{},
+		&models.Report{},
+		&models.Device{},
+		&models.DeviceBinding{},
 	)
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
@@ -112,13 +125,25 @@ func SetupTestDB(t *testing.T) (*gorm.DB, func()) {
 func ClearDatabase(db *gorm.DB) error {
 	// Delete in reverse order of dependencies
 	tables := []interface{}{
+		&models.DeviceBinding{},
+		&models.Device{},
+		&models.Report{},
+		&models.ReportSubscription{},
+		&models.DataExport{},
+		&models.NotificationMessage{},
+		&models.EmailMessage{},
+		&models.PaymentWebhookEvent{},
 		&models.Invoice{},
 		&models.Payment{},
 		&models.Subscription{},
 		&models.VehicleHistory{},
+		&geofencing.GeofenceViolation{},
+		&geofencing.GeofenceEvent{},
 		&models.Geofence{},
 		&models.Trip{},
 		&models.GPSTrack{},
+		&models.DriverBehaviorRule{},
+		&models.DriverBehaviorRuleSet{},
 		&models.PerformanceLog{},
 		&models.DriverEvent{},
 		&models.Driver{},
@@ -0,0 +1,457 @@
+package device
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+)
+
+// Handler handles device registry HTTP requests
+type Handler struct {
+	service   *Service
+	validator *validator.Validate
+}
+
+// NewHandler creates a new device handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service:   service,
+		validator: validator.New(),
+	}
+}
+
+// SuccessResponse represents a success response
+type SuccessResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data"`
+	Message string      `json:"message,omitempty"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Success bool   `json:"success" example:"false"`
+	Error   string `json:"error"`
+	Message string `json:"message,omitempty"`
+}
+
+// PaginatedResponse represents a paginated response
+type PaginatedResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data"`
+	Meta    Meta        `json:"meta"`
+}
+
+// Meta represents pagination metadata
+type Meta struct {
+	Total       int64 `json:"total"`
+	Page        int   `json:"page"`
+	Limit       int   `json:"limit"`
+	TotalPages  int   `json:"total_pages"`
+	HasNext     bool  `json:"has_next"`
+	HasPrevious bool  `json:"has_previous"`
+}
+
+// CreateDevice godoc
+// @Summary Register a device
+// @Description Register a GPS tracker or mobile device, optionally binding it to a vehicle. The device API key is returned only once.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param device body CreateDeviceRequest true "Device data"
+// @Success 201 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse "Vehicle not found"
+// @Failure 409 {object} ErrorResponse "IMEI already registered"
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices [post]
+// @Security BearerAuth
+func (h *Handler) CreateDevice(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	var req CreateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		middleware.AbortWithValidation(c, err.Error())
+		return
+	}
+
+	credentials, err := h.service.CreateDevice(companyID.(string), toString(userID), req)
+	if err != nil {
+		abortWithServiceError(c, "Failed to create device", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse{
+		Success: true,
+		Data:    credentials,
+		Message: "Device registered successfully. Store the API key now, it will not be shown again",
+	})
+}
+
+// GetDevice godoc
+// @Summary Get device by ID
+// @Description Get device details including the vehicle it is bound to
+// @Tags devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices/{id} [get]
+// @Security BearerAuth
+func (h *Handler) GetDevice(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	device, err := h.service.GetDevice(companyID.(string), c.Param("id"))
+	if err != nil {
+		abortWithServiceError(c, "Failed to fetch device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    device,
+	})
+}
+
+// ListDevices godoc
+// @Summary List devices
+// @Description List the company's devices with filters and pagination
+// @Tags devices
+// @Produce json
+// @Param device_type query string false "Device type (tracker, mobile)"
+// @Param vehicle_id query string false "Vehicle ID"
+// @Param is_bound query bool false "Bound to a vehicle"
+// @Param is_active query bool false "Active status"
+// @Param search query string false "Search IMEI, serial number, name or SIM number"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} PaginatedResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices [get]
+// @Security BearerAuth
+func (h *Handler) ListDevices(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	// Parse filters
+	filters := DeviceFilters{
+		Page:  1,
+		Limit: 20,
+	}
+
+	if deviceType := c.Query("device_type"); deviceType != "" {
+		filters.DeviceType = &deviceType
+	}
+	if vehicleID := c.Query("vehicle_id"); vehicleID != "" {
+		filters.VehicleID = &vehicleID
+	}
+	if isBoundStr := c.Query("is_bound"); isBoundStr != "" {
+		if isBound, err := strconv.ParseBool(isBoundStr); err == nil {
+			filters.IsBound = &isBound
+		}
+	}
+	if isActiveStr := c.Query("is_active"); isActiveStr != "" {
+		if isActive, err := strconv.ParseBool(isActiveStr); err == nil {
+			filters.IsActive = &isActive
+		}
+	}
+	if search := c.Query("search"); search != "" {
+		filters.Search = &search
+	}
+	if pageStr := c.Query("page"); pageStr != "" {
+		if page, err := strconv.Atoi(pageStr); err == nil && page > 0 {
+			filters.Page = page
+		}
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if limit, err := strconv.Atoi(limitStr); err == nil && limit > 0 && limit <= 100 {
+			filters.Limit = limit
+		}
+	}
+
+	devices, total, err := h.service.ListDevices(companyID.(string), filters)
+	if err != nil {
+		abortWithServiceError(c, "Failed to list devices", err)
+		return
+	}
+
+	// Calculate pagination metadata
+	totalPages := int((total + int64(filters.Limit) - 1) / int64(filters.Limit))
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Success: true,
+		Data:    devices,
+		Meta: Meta{
+			Total:       total,
+			Page:        filters.Page,
+			Limit:       filters.Limit,
+			TotalPages:  totalPages,
+			HasNext:     filters.Page < totalPages,
+			HasPrevious: filters.Page > 1,
+		},
+	})
+}
+
+// UpdateDevice godoc
+// @Summary Update device
+// @Description Update device metadata or deactivate a device
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param device body UpdateDeviceRequest true "Device update data"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices/{id} [put]
+// @Security BearerAuth
+func (h *Handler) UpdateDevice(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	var req UpdateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		middleware.AbortWithValidation(c, err.Error())
+		return
+	}
+
+	device, err := h.service.UpdateDevice(companyID.(string), c.Param("id"), req)
+	if err != nil {
+		abortWithServiceError(c, "Failed to update device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    device,
+		Message: "Device updated successfully",
+	})
+}
+
+// DeleteDevice godoc
+// @Summary Delete device
+// @Description Delete a device (soft delete), ending its vehicle binding and revoking its API key
+// @Tags devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) DeleteDevice(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	if err := h.service.DeleteDevice(companyID.(string), c.Param("id"), toString(userID)); err != nil {
+		abortWithServiceError(c, "Failed to delete device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Message: "Device deleted successfully",
+	})
+}
+
+// BindDevice godoc
+// @Summary Bind device to vehicle
+// @Description Install a device in a vehicle. Any previous binding of the device is ended.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param id path string true "Device ID"
+// @Param binding body BindDeviceRequest true "Vehicle to bind to"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "Device bound concurrently"
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices/{id}/bind [post]
+// @Security BearerAuth
+func (h *Handler) BindDevice(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	var req BindDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		middleware.AbortWithValidation(c, err.Error())
+		return
+	}
+
+	device, err := h.service.BindDevice(companyID.(string), c.Param("id"), req.VehicleID, toString(userID))
+	if err != nil {
+		abortWithServiceError(c, "Failed to bind device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    device,
+		Message: "Device bound to vehicle successfully",
+	})
+}
+
+// UnbindDevice godoc
+// @Summary Unbind device from vehicle
+// @Description Remove a device from the vehicle it is installed in
+// @Tags devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices/{id}/unbind [post]
+// @Security BearerAuth
+func (h *Handler) UnbindDevice(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+	userID, _ := c.Get("user_id")
+
+	device, err := h.service.UnbindDevice(companyID.(string), c.Param("id"), toString(userID))
+	if err != nil {
+		abortWithServiceError(c, "Failed to unbind device", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    device,
+		Message: "Device unbound from vehicle successfully",
+	})
+}
+
+// GetBindingHistory godoc
+// @Summary Get device binding history
+// @Description Get the vehicles a device has been installed in, newest first
+// @Tags devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices/{id}/bindings [get]
+// @Security BearerAuth
+func (h *Handler) GetBindingHistory(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	bindings, err := h.service.GetBindingHistory(companyID.(string), c.Param("id"))
+	if err != nil {
+		abortWithServiceError(c, "Failed to fetch binding history", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    bindings,
+	})
+}
+
+// RotateAPIKey godoc
+// @Summary Rotate device API key
+// @Description Issue a new API key for a device. The previous key stops working immediately.
+// @Tags devices
+// @Produce json
+// @Param id path string true "Device ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/devices/{id}/rotate-key [post]
+// @Security BearerAuth
+func (h *Handler) RotateAPIKey(c *gin.Context) {
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	credentials, err := h.service.RotateAPIKey(companyID.(string), c.Param("id"))
+	if err != nil {
+		abortWithServiceError(c, "Failed to rotate device API key", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    credentials,
+		Message: "Device API key rotated successfully. Store the API key now, it will not be shown again",
+	})
+}
+
+// abortWithServiceError aborts with the service's error, or an internal error
+func abortWithServiceError(c *gin.Context, message string, err error) {
+	if appErr, ok := err.(*apperrors.AppError); ok {
+		middleware.AbortWithError(c, appErr)
+	} else {
+		middleware.AbortWithInternal(c, message, err)
+	}
+}
+
+// toString returns a context value as a string
+func toString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
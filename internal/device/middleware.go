@@ -0,0 +1,47 @@
+package device
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+)
+
+// APIKeyHeader carries the API key of a device posting data without a user JWT
+const APIKeyHeader = "X-Device-Key"
+
+// AuthRequired middleware authenticates a device by its API key and sets
+// device_id, company_id and, when the device is bound, vehicle_id in context
+func AuthRequired(service *Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := c.GetHeader(APIKeyHeader)
+		if apiKey == "" {
+			middleware.AbortWithUnauthorized(c, APIKeyHeader+" header required")
+			return
+		}
+
+		device, err := service.Authenticate(c.Request.Context(), apiKey)
+		if err != nil {
+			if appErr, ok := err.(*apperrors.AppError); ok {
+				middleware.AbortWithError(c, appErr)
+			} else {
+				middleware.AbortWithInternal(c, "Failed to authenticate device", err)
+			}
+			return
+		}
+
+		if err := service.Touch(c.Request.Context(), device.ID, time.Now()); err != nil {
+			fmt.Printf("Failed to update last seen time of device %s: %v\n", device.ID, err)
+		}
+
+		c.Set("device_id", device.ID)
+		c.Set("company_id", device.CompanyID)
+		if device.VehicleID != nil {
+			c.Set("vehicle_id", *device.VehicleID)
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,472 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// apiKeyPrefix marks device API keys so they are recognizable in logs and
+// secret scanners
+const apiKeyPrefix = "ftd_"
+
+// Unique indexes whose violations are reported as conflicts
+const (
+	imeiIndex           = "idx_devices_imei"
+	currentBindingIndex = "idx_device_bindings_current"
+)
+
+// Service handles device registry operations
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates a new device service
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// CreateDeviceRequest represents the request to register a device
+type CreateDeviceRequest struct {
+	IMEI            string  `json:"imei" validate:"omitempty,numeric,min=15,max=17"`
+	SerialNumber    string  `json:"serial_number" validate:"omitempty,max=50"`
+	DeviceType      string  `json:"device_type" validate:"required,oneof=tracker mobile"`
+	Protocol        string  `json:"protocol" validate:"omitempty,oneof=teltonika"`
+	Name            string  `json:"name" validate:"omitempty,max=100"`
+	FirmwareVersion string  `json:"firmware_version" validate:"omitempty,max=50"`
+	SIMNumber       string  `json:"sim_number" validate:"omitempty,max=20"`
+	VehicleID       *string `json:"vehicle_id,omitempty"` // bind right away
+}
+
+// UpdateDeviceRequest represents the request to update a device
+type UpdateDeviceRequest struct {
+	SerialNumber    *string `json:"serial_number,omitempty" validate:"omitempty,max=50"`
+	Name            *string `json:"name,omitempty" validate:"omitempty,max=100"`
+	FirmwareVersion *string `json:"firmware_version,omitempty" validate:"omitempty,max=50"`
+	SIMNumber       *string `json:"sim_number,omitempty" validate:"omitempty,max=20"`
+	IsActive        *bool   `json:"is_active,omitempty"`
+}
+
+// BindDeviceRequest represents the request to install a device in a vehicle
+type BindDeviceRequest struct {
+	VehicleID string `json:"vehicle_id" validate:"required"`
+}
+
+// DeviceFilters represents filters for listing devices
+type DeviceFilters struct {
+	DeviceType *string `json:"device_type" form:"device_type"`
+	VehicleID  *string `json:"vehicle_id" form:"vehicle_id"`
+	IsBound    *bool   `json:"is_bound" form:"is_bound"`
+	IsActive   *bool   `json:"is_active" form:"is_active"`
+	Search     *string `json:"search" form:"search"`
+
+	// Pagination
+	Page  int `json:"page" form:"page" validate:"min=1"`
+	Limit int `json:"limit" form:"limit" validate:"min=1,max=100"`
+}
+
+// DeviceCredentials is returned when a device API key is issued. The key is
+// shown only once; the server keeps its hash.
+type DeviceCredentials struct {
+	Device *models.Device `json:"device"`
+	APIKey string         `json:"api_key"`
+}
+
+// CreateDevice registers a device, issues its API key and optionally binds it
+// to a vehicle
+func (s *Service) CreateDevice(companyID, userID string, req CreateDeviceRequest) (*DeviceCredentials, error) {
+	device := &models.Device{
+		CompanyID:       companyID,
+		SerialNumber:    req.SerialNumber,
+		DeviceType:      req.DeviceType,
+		Protocol:        req.Protocol,
+		Name:            req.Name,
+		FirmwareVersion: req.FirmwareVersion,
+		SIMNumber:       req.SIMNumber,
+		IsActive:        true,
+	}
+
+	if req.DeviceType == models.DeviceTypeTracker {
+		// The gateway identifies trackers by IMEI
+		if req.IMEI == "" {
+			return nil, apperrors.NewValidationError("IMEI is required for trackers")
+		}
+		if device.Protocol == "" {
+			device.Protocol = models.DeviceProtocolTeltonika
+		}
+	} else {
+		device.Protocol = ""
+	}
+
+	if req.IMEI != "" {
+		imei := req.IMEI
+		device.IMEI = &imei
+
+		var count int64
+		if err := s.db.Model(&models.Device{}).Where("imei = ?", imei).Count(&count).Error; err != nil {
+			return nil, apperrors.Wrap(err, "failed to check IMEI")
+		}
+		if count > 0 {
+			return nil, apperrors.NewConflictError("Device with this IMEI already exists")
+		}
+	}
+
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to generate device API key")
+	}
+	setAPIKey(device, apiKey)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Company", "Vehicle").Create(device).Error; err != nil {
+			// Another request registered the IMEI since it was checked
+			if isUniqueViolation(err, imeiIndex) {
+				return apperrors.NewConflictError("Device with this IMEI already exists")
+			}
+			return apperrors.NewInternalError("Failed to create device").WithInternal(err)
+		}
+		if req.VehicleID != nil && *req.VehicleID != "" {
+			return s.bind(tx, device, *req.VehicleID, userID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeviceCredentials{Device: device, APIKey: apiKey}, nil
+}
+
+// GetDevice retrieves a device of a company
+func (s *Service) GetDevice(companyID, deviceID string) (*models.Device, error) {
+	var device models.Device
+	if err := s.db.Preload("Vehicle").Where("company_id = ? AND id = ?", companyID, deviceID).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("Device")
+		}
+		return nil, apperrors.NewInternalError("Failed to fetch device").WithInternal(err)
+	}
+	return &device, nil
+}
+
+// ListDevices lists the devices of a company with filters and pagination
+func (s *Service) ListDevices(companyID string, filters DeviceFilters) ([]models.Device, int64, error) {
+	var devices []models.Device
+	var total int64
+
+	query := s.db.Model(&models.Device{}).Where("company_id = ?", companyID)
+
+	if filters.DeviceType != nil {
+		query = query.Where("device_type = ?", *filters.DeviceType)
+	}
+	if filters.VehicleID != nil {
+		query = query.Where("vehicle_id = ?", *filters.VehicleID)
+	}
+	if filters.IsBound != nil {
+		if *filters.IsBound {
+			query = query.Where("vehicle_id IS NOT NULL")
+		} else {
+			query = query.Where("vehicle_id IS NULL")
+		}
+	}
+	if filters.IsActive != nil {
+		query = query.Where("is_active = ?", *filters.IsActive)
+	}
+	if filters.Search != nil && *filters.Search != "" {
+		searchTerm := "%" + *filters.Search + "%"
+		query = query.Where("(imei ILIKE ? OR serial_number ILIKE ? OR name ILIKE ? OR sim_number ILIKE ?)", searchTerm, searchTerm, searchTerm, searchTerm)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, apperrors.NewInternalError("Failed to count devices").WithInternal(err)
+	}
+
+	page := filters.Page
+	if page < 1 {
+		page = 1
+	}
+	limit := filters.Limit
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	if err := query.Preload("Vehicle").Order("created_at DESC").Offset((page - 1) * limit).Limit(limit).Find(&devices).Error; err != nil {
+		return nil, 0, apperrors.NewInternalError("Failed to list devices").WithInternal(err)
+	}
+
+	return devices, total, nil
+}
+
+// UpdateDevice updates a device's metadata. Deactivated devices can no
+// longer authenticate or connect to the gateway.
+func (s *Service) UpdateDevice(companyID, deviceID string, req UpdateDeviceRequest) (*models.Device, error) {
+	device, err := s.GetDevice(companyID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.SerialNumber != nil {
+		updates["serial_number"] = *req.SerialNumber
+	}
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.FirmwareVersion != nil {
+		updates["firmware_version"] = *req.FirmwareVersion
+	}
+	if req.SIMNumber != nil {
+		updates["sim_number"] = *req.SIMNumber
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if len(updates) == 0 {
+		return device, nil
+	}
+
+	if err := s.db.Model(device).Omit("Company", "Vehicle").Updates(updates).Error; err != nil {
+		return nil, apperrors.NewInternalError("Failed to update device").WithInternal(err)
+	}
+
+	return s.GetDevice(companyID, deviceID)
+}
+
+// DeleteDevice deletes a device (soft delete), ending its current binding
+func (s *Service) DeleteDevice(companyID, deviceID, userID string) error {
+	device, err := s.GetDevice(companyID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.unbind(tx, device, userID); err != nil {
+			return err
+		}
+		// Free the IMEI and revoke the key so the device can be registered again
+		if err := tx.Model(device).Updates(map[string]interface{}{"imei": nil, "api_key_hash": nil}).Error; err != nil {
+			return apperrors.NewInternalError("Failed to delete device").WithInternal(err)
+		}
+		if err := tx.Delete(device).Error; err != nil {
+			return apperrors.NewInternalError("Failed to delete device").WithInternal(err)
+		}
+		return nil
+	})
+}
+
+// BindDevice installs a device in a vehicle of the same company, ending any
+// previous binding of the device
+func (s *Service) BindDevice(companyID, deviceID, vehicleID, userID string) (*models.Device, error) {
+	device, err := s.GetDevice(companyID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device.VehicleID != nil && *device.VehicleID == vehicleID {
+		return device, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.unbind(tx, device, userID); err != nil {
+			return err
+		}
+		return s.bind(tx, device, vehicleID, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetDevice(companyID, deviceID)
+}
+
+// UnbindDevice removes a device from its vehicle
+func (s *Service) UnbindDevice(companyID, deviceID, userID string) (*models.Device, error) {
+	device, err := s.GetDevice(companyID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device.VehicleID == nil {
+		return nil, apperrors.NewBadRequestError("Device is not bound to a vehicle")
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.unbind(tx, device, userID)
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.GetDevice(companyID, deviceID)
+}
+
+// GetBindingHistory returns the vehicles a device has been installed in,
+// newest first
+func (s *Service) GetBindingHistory(companyID, deviceID string) ([]models.DeviceBinding, error) {
+	if _, err := s.GetDevice(companyID, deviceID); err != nil {
+		return nil, err
+	}
+
+	var bindings []models.DeviceBinding
+	if err := s.db.Preload("Vehicle").
+		Where("company_id = ? AND device_id = ?", companyID, deviceID).
+		Order("bound_at DESC").Find(&bindings).Error; err != nil {
+		return nil, apperrors.NewInternalError("Failed to fetch binding history").WithInternal(err)
+	}
+	return bindings, nil
+}
+
+// RotateAPIKey issues a new API key for a device, invalidating the old one
+func (s *Service) RotateAPIKey(companyID, deviceID string) (*DeviceCredentials, error) {
+	device, err := s.GetDevice(companyID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, err := generateAPIKey()
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to generate device API key")
+	}
+	setAPIKey(device, apiKey)
+
+	if err := s.db.Model(device).Updates(map[string]interface{}{
+		"api_key_hash":   device.APIKeyHash,
+		"api_key_prefix": device.APIKeyPrefix,
+	}).Error; err != nil {
+		return nil, apperrors.NewInternalError("Failed to rotate device API key").WithInternal(err)
+	}
+
+	return &DeviceCredentials{Device: device, APIKey: apiKey}, nil
+}
+
+// Authenticate returns the active device owning an API key
+func (s *Service) Authenticate(ctx context.Context, apiKey string) (*models.Device, error) {
+	if !strings.HasPrefix(apiKey, apiKeyPrefix) {
+		return nil, apperrors.NewUnauthorizedError("Invalid device API key")
+	}
+
+	var device models.Device
+	if err := s.db.WithContext(ctx).Where("api_key_hash = ? AND is_active = ?", hashAPIKey(apiKey), true).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewUnauthorizedError("Invalid device API key")
+		}
+		return nil, apperrors.Wrap(err, "failed to authenticate device")
+	}
+	return &device, nil
+}
+
+// LookupByIMEI returns the active tracker with the given IMEI and protocol.
+// Trackers that are not bound to a vehicle are reported as not found, since
+// their fixes cannot be attributed.
+func (s *Service) LookupByIMEI(ctx context.Context, imei, protocol string) (*models.Device, error) {
+	var device models.Device
+	if err := s.db.WithContext(ctx).
+		Where("imei = ? AND protocol = ? AND is_active = ? AND vehicle_id IS NOT NULL", imei, protocol, true).
+		First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("device")
+		}
+		return nil, apperrors.Wrap(err, "failed to look up device")
+	}
+	return &device, nil
+}
+
+// Touch records that a device has just been heard from
+func (s *Service) Touch(ctx context.Context, deviceID string, seenAt time.Time) error {
+	return s.db.WithContext(ctx).Model(&models.Device{}).
+		Where("id = ?", deviceID).
+		Update("last_seen_at", seenAt).Error
+}
+
+// bind opens a binding between a device and a vehicle of its company
+func (s *Service) bind(tx *gorm.DB, device *models.Device, vehicleID, userID string) error {
+	var vehicle models.Vehicle
+	if err := tx.Where("company_id = ? AND id = ?", device.CompanyID, vehicleID).First(&vehicle).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperrors.NewNotFoundError("Vehicle")
+		}
+		return apperrors.NewInternalError("Failed to fetch vehicle").WithInternal(err)
+	}
+
+	binding := &models.DeviceBinding{
+		CompanyID: device.CompanyID,
+		DeviceID:  device.ID,
+		VehicleID: vehicleID,
+		BoundAt:   time.Now(),
+		BoundBy:   optionalID(userID),
+	}
+	if err := tx.Omit("Vehicle").Create(binding).Error; err != nil {
+		if isUniqueViolation(err, currentBindingIndex) {
+			return apperrors.NewConflictError("Device is being bound by another request")
+		}
+		return apperrors.NewInternalError("Failed to bind device").WithInternal(err)
+	}
+
+	if err := tx.Model(&models.Device{}).Where("id = ?", device.ID).Update("vehicle_id", vehicleID).Error; err != nil {
+		return apperrors.NewInternalError("Failed to bind device").WithInternal(err)
+	}
+	device.VehicleID = &vehicleID
+	return nil
+}
+
+// unbind closes the current binding of a device, if any
+func (s *Service) unbind(tx *gorm.DB, device *models.Device, userID string) error {
+	if err := tx.Model(&models.DeviceBinding{}).
+		Where("device_id = ? AND unbound_at IS NULL", device.ID).
+		Updates(map[string]interface{}{
+			"unbound_at": time.Now(),
+			"unbound_by": optionalID(userID),
+		}).Error; err != nil {
+		return apperrors.NewInternalError("Failed to unbind device").WithInternal(err)
+	}
+
+	if err := tx.Model(&models.Device{}).Where("id = ?", device.ID).Update("vehicle_id", nil).Error; err != nil {
+		return apperrors.NewInternalError("Failed to unbind device").WithInternal(err)
+	}
+	device.VehicleID = nil
+	return nil
+}
+
+// generateAPIKey returns a new random device API key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// setAPIKey stores the hash and display prefix of an API key on a device
+func setAPIKey(device *models.Device, apiKey string) {
+	hash := hashAPIKey(apiKey)
+	device.APIKeyHash = &hash
+	device.APIKeyPrefix = apiKey[:len(apiKeyPrefix)+8]
+}
+
+// hashAPIKey hashes a device API key for storage and lookup
+func hashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// optionalID converts an empty ID to NULL
+func optionalID(id string) *string {
+	if id == "" {
+		return nil
+	}
+	return &id
+}
+
+// isUniqueViolation reports whether err is a violation of the named unique
+// index
+func isUniqueViolation(err error, index string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == index
+}
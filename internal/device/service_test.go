@@ -0,0 +1,339 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	first, err := generateAPIKey()
+	require.NoError(t, err)
+	second, err := generateAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(first, apiKeyPrefix))
+	assert.Len(t, first, len(apiKeyPrefix)+64)
+	assert.NotEqual(t, first, second)
+}
+
+func TestSetAPIKey(t *testing.T) {
+	apiKey, err := generateAPIKey()
+	require.NoError(t, err)
+
+	device := &models.Device{}
+	setAPIKey(device, apiKey)
+
+	require.NotNil(t, device.APIKeyHash)
+	assert.Equal(t, hashAPIKey(apiKey), *device.APIKeyHash)
+	assert.NotContains(t, *device.APIKeyHash, apiKey[len(apiKeyPrefix):])
+	assert.Equal(t, apiKey[:12], device.APIKeyPrefix)
+	assert.Len(t, device.APIKeyPrefix, 12, "fits the api_key_prefix column")
+}
+
+func TestAuthRequired_RejectsMissingOrMalformedKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.ErrorHandler())
+	router.POST("/device/gps", AuthRequired(NewService(nil)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, key := range []string{"", "not-a-device-key"} {
+		req := httptest.NewRequest(http.MethodPost, "/device/gps", nil)
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "key %q", key)
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	violation := &pgconn.PgError{Code: "23505", ConstraintName: imeiIndex}
+
+	assert.True(t, isUniqueViolation(fmt.Errorf("insert: %w", violation), imeiIndex))
+	assert.False(t, isUniqueViolation(violation, currentBindingIndex), "other index")
+	assert.False(t, isUniqueViolation(&pgconn.PgError{Code: "23503", ConstraintName: imeiIndex}, imeiIndex), "foreign key violation")
+	assert.False(t, isUniqueViolation(gorm.ErrRecordNotFound, imeiIndex))
+}
+
+// testIMEI returns an IMEI not used by earlier tests; cleared devices are
+// only soft-deleted
+func testIMEI() string {
+	return fmt.Sprintf("35%013d", uuid.New().ID())
+}
+
+// createTestVehicle creates a vehicle with a unique plate and VIN
+func createTestVehicle(t *testing.T, db *gorm.DB, companyID string) *models.Vehicle {
+	vehicle := testutil.NewTestVehicle(companyID)
+	suffix := strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", ""))
+	vehicle.LicensePlate = "B " + suffix[:8]
+	vehicle.VIN = suffix[:17]
+	require.NoError(t, db.Create(vehicle).Error)
+	return vehicle
+}
+
+// assertAppErrorStatus asserts that err is an AppError with an HTTP status
+func assertAppErrorStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	appErr, ok := err.(*apperrors.AppError)
+	require.True(t, ok, "expected an AppError, got %v", err)
+	assert.Equal(t, status, appErr.Status)
+}
+
+func TestService_CreateDevice(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db)
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	vehicle := createTestVehicle(t, db, company.ID)
+
+	t.Run("tracker bound on creation", func(t *testing.T) {
+		credentials, err := service.CreateDevice(company.ID, "", CreateDeviceRequest{
+			IMEI:       testIMEI(),
+			DeviceType: models.DeviceTypeTracker,
+			VehicleID:  &vehicle.ID,
+		})
+		require.NoError(t, err)
+
+		device := credentials.Device
+		testutil.AssertValidUUID(t, device.ID)
+		assert.Equal(t, models.DeviceProtocolTeltonika, device.Protocol)
+		require.NotNil(t, device.VehicleID)
+		assert.Equal(t, vehicle.ID, *device.VehicleID)
+		assert.True(t, strings.HasPrefix(credentials.APIKey, device.APIKeyPrefix))
+
+		bindings, err := service.GetBindingHistory(company.ID, device.ID)
+		require.NoError(t, err)
+		require.Len(t, bindings, 1)
+		assert.Nil(t, bindings[0].UnboundAt)
+	})
+
+	t.Run("tracker without IMEI", func(t *testing.T) {
+		_, err := service.CreateDevice(company.ID, "", CreateDeviceRequest{DeviceType: models.DeviceTypeTracker})
+		assertAppErrorStatus(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("mobile device drops the protocol", func(t *testing.T) {
+		credentials, err := service.CreateDevice(company.ID, "", CreateDeviceRequest{
+			DeviceType: models.DeviceTypeMobile,
+			Protocol:   models.DeviceProtocolTeltonika,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, credentials.Device.Protocol)
+		assert.Nil(t, credentials.Device.IMEI)
+	})
+
+	t.Run("duplicate IMEI", func(t *testing.T) {
+		imei := testIMEI()
+		_, err := service.CreateDevice(company.ID, "", CreateDeviceRequest{IMEI: imei, DeviceType: models.DeviceTypeTracker})
+		require.NoError(t, err)
+
+		_, err = service.CreateDevice(company.ID, "", CreateDeviceRequest{IMEI: imei, DeviceType: models.DeviceTypeTracker})
+		assertAppErrorStatus(t, err, http.StatusConflict)
+	})
+
+	t.Run("concurrent registrations of an IMEI", func(t *testing.T) {
+		imei := testIMEI()
+		errs := make([]error, 5)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = service.CreateDevice(company.ID, "", CreateDeviceRequest{IMEI: imei, DeviceType: models.DeviceTypeTracker})
+			}(i)
+		}
+		wg.Wait()
+
+		created := 0
+		for _, err := range errs {
+			if err == nil {
+				created++
+				continue
+			}
+			assertAppErrorStatus(t, err, http.StatusConflict)
+		}
+		assert.Equal(t, 1, created)
+	})
+}
+
+func TestService_BindDevice(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db)
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	user := testutil.NewTestUser(company.ID)
+	require.NoError(t, db.Create(user).Error)
+	truck := createTestVehicle(t, db, company.ID)
+	van := createTestVehicle(t, db, company.ID)
+
+	credentials, err := service.CreateDevice(company.ID, user.ID, CreateDeviceRequest{IMEI: testIMEI(), DeviceType: models.DeviceTypeTracker})
+	require.NoError(t, err)
+	deviceID := credentials.Device.ID
+
+	device, err := service.BindDevice(company.ID, deviceID, truck.ID, user.ID)
+	require.NoError(t, err)
+	require.NotNil(t, device.VehicleID)
+	assert.Equal(t, truck.ID, *device.VehicleID)
+
+	// Rebinding to the same vehicle keeps the current binding
+	_, err = service.BindDevice(company.ID, deviceID, truck.ID, user.ID)
+	require.NoError(t, err)
+
+	// Moving the device ends the previous binding
+	device, err = service.BindDevice(company.ID, deviceID, van.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, van.ID, *device.VehicleID)
+
+	bindings, err := service.GetBindingHistory(company.ID, deviceID)
+	require.NoError(t, err)
+	require.Len(t, bindings, 2)
+	assert.Equal(t, van.ID, bindings[0].VehicleID, "newest first")
+	assert.Nil(t, bindings[0].UnboundAt)
+	assert.Equal(t, truck.ID, bindings[1].VehicleID)
+	require.NotNil(t, bindings[1].UnboundAt)
+	require.NotNil(t, bindings[1].UnboundBy)
+	assert.Equal(t, user.ID, *bindings[1].UnboundBy)
+
+	t.Run("vehicle of another company", func(t *testing.T) {
+		other := testutil.NewTestCompany()
+		require.NoError(t, db.Create(other).Error)
+		otherVehicle := createTestVehicle(t, db, other.ID)
+
+		_, err := service.BindDevice(company.ID, deviceID, otherVehicle.ID, user.ID)
+		assertAppErrorStatus(t, err, http.StatusNotFound)
+
+		device, err := service.GetDevice(company.ID, deviceID)
+		require.NoError(t, err)
+		assert.Equal(t, van.ID, *device.VehicleID, "the failed bind is rolled back")
+	})
+
+	t.Run("device of another company", func(t *testing.T) {
+		_, err := service.BindDevice(uuid.New().String(), deviceID, truck.ID, user.ID)
+		assertAppErrorStatus(t, err, http.StatusNotFound)
+	})
+}
+
+func TestService_UnbindDevice(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db)
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	vehicle := createTestVehicle(t, db, company.ID)
+
+	credentials, err := service.CreateDevice(company.ID, "", CreateDeviceRequest{
+		IMEI:       testIMEI(),
+		DeviceType: models.DeviceTypeTracker,
+		VehicleID:  &vehicle.ID,
+	})
+	require.NoError(t, err)
+	deviceID := credentials.Device.ID
+
+	device, err := service.UnbindDevice(company.ID, deviceID, "")
+	require.NoError(t, err)
+	assert.Nil(t, device.VehicleID)
+
+	bindings, err := service.GetBindingHistory(company.ID, deviceID)
+	require.NoError(t, err)
+	require.Len(t, bindings, 1)
+	assert.NotNil(t, bindings[0].UnboundAt)
+
+	// Unbound trackers cannot have their fixes attributed
+	_, err = service.LookupByIMEI(context.Background(), *device.IMEI, models.DeviceProtocolTeltonika)
+	assertAppErrorStatus(t, err, http.StatusNotFound)
+
+	_, err = service.UnbindDevice(company.ID, deviceID, "")
+	assertAppErrorStatus(t, err, http.StatusBadRequest)
+}
+
+func TestService_GetBindingHistory(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db)
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	credentials, err := service.CreateDevice(company.ID, "", CreateDeviceRequest{DeviceType: models.DeviceTypeMobile})
+	require.NoError(t, err)
+
+	bindings, err := service.GetBindingHistory(company.ID, credentials.Device.ID)
+	require.NoError(t, err)
+	assert.Empty(t, bindings)
+
+	_, err = service.GetBindingHistory(uuid.New().String(), credentials.Device.ID)
+	assertAppErrorStatus(t, err, http.StatusNotFound)
+}
+
+func TestService_Authenticate(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	service := NewService(db)
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	credentials, err := service.CreateDevice(company.ID, "", CreateDeviceRequest{DeviceType: models.DeviceTypeMobile})
+	require.NoError(t, err)
+	deviceID := credentials.Device.ID
+
+	device, err := service.Authenticate(ctx, credentials.APIKey)
+	require.NoError(t, err)
+	assert.Equal(t, deviceID, device.ID)
+
+	t.Run("unknown key", func(t *testing.T) {
+		unknown, err := generateAPIKey()
+		require.NoError(t, err)
+		_, err = service.Authenticate(ctx, unknown)
+		assertAppErrorStatus(t, err, http.StatusUnauthorized)
+	})
+
+	t.Run("rotated key", func(t *testing.T) {
+		rotated, err := service.RotateAPIKey(company.ID, deviceID)
+		require.NoError(t, err)
+
+		_, err = service.Authenticate(ctx, credentials.APIKey)
+		assertAppErrorStatus(t, err, http.StatusUnauthorized)
+
+		device, err := service.Authenticate(ctx, rotated.APIKey)
+		require.NoError(t, err)
+		assert.Equal(t, deviceID, device.ID)
+		credentials = rotated
+	})
+
+	t.Run("deactivated device", func(t *testing.T) {
+		inactive := false
+		_, err := service.UpdateDevice(company.ID, deviceID, UpdateDeviceRequest{IsActive: &inactive})
+		require.NoError(t, err)
+
+		_, err = service.Authenticate(ctx, credentials.APIKey)
+		assertAppErrorStatus(t, err, http.StatusUnauthorized)
+	})
+}
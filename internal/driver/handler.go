@@ -66,6 +66,7 @@ type Meta struct {
 // @Success 201 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 402 {object} ErrorResponse "Driver limit of the subscription plan reached"
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/drivers [post]
 // @Security BearerAuth
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
 	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 	"gorm.io/gorm"
@@ -17,9 +18,10 @@ import (
 
 // Service handles driver operations
 type Service struct {
-	db    *gorm.DB
-	redis *redis.Client
-	cache *CacheService
+	db           *gorm.DB
+	redis        *redis.Client
+	cache        *CacheService
+	entitlements *entitlement.Service
 }
 
 // CacheService provides caching functionality for driver operations
@@ -155,9 +157,10 @@ func (cs *CacheService) generateDriverListCacheKey(companyID string, filters Dri
 // NewService creates a new driver service
 func NewService(db *gorm.DB, redis *redis.Client) *Service {
 	return &Service{
-		db:    db,
-		redis: redis,
-		cache: NewCacheService(redis),
+		db:           db,
+		redis:        redis,
+		cache:        NewCacheService(redis),
+		entitlements: entitlement.NewService(db),
 	}
 }
 
@@ -358,9 +361,15 @@ func (s *Service) CreateDriver(companyID string, req CreateDriverRequest) (*mode
 		OverallScore:          100.0,
 	}
 
-	// Save to database
-	if err := s.db.Create(driver).Error; err != nil {
-		return nil, apperrors.Wrap(err, "failed to create driver")
+	// Save to database within the driver limit of the subscription plan
+	err := s.entitlements.WithinDriverLimit(context.Background(), companyID, func(tx *gorm.DB) error {
+		if err := tx.Create(driver).Error; err != nil {
+			return apperrors.Wrap(err, "failed to create driver")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return driver, nil
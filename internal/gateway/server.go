@@ -0,0 +1,306 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/tracking"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// DefaultIdleTimeout closes connections of trackers that stop sending data.
+// Teltonika devices keep their link open for 300 seconds by default.
+const DefaultIdleTimeout = 10 * time.Minute
+
+// DeviceResolver maps trackers to vehicles, see device.Service
+type DeviceResolver interface {
+	LookupByIMEI(ctx context.Context, imei, protocol string) (*models.Device, error)
+	Touch(ctx context.Context, deviceID string, seenAt time.Time) error
+}
+
+// Ingester stores GPS fixes, see tracking.Service.ProcessDeviceGPSBatch
+type Ingester interface {
+	ProcessDeviceGPSBatch(deviceID, vehicleID string, points []tracking.GPSBatchPoint) (*tracking.GPSBatchResult, error)
+}
+
+// Server accepts TCP connections from hardwired GPS trackers speaking the
+// Teltonika protocol and feeds their fixes into the GPS tracking pipeline
+type Server struct {
+	addr        string
+	idleTimeout time.Duration
+	devices     DeviceResolver
+	ingester    Ingester
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a new device gateway listening on addr
+func NewServer(addr string, devices DeviceResolver, ingester Ingester) *Server {
+	return &Server{
+		addr:        addr,
+		idleTimeout: DefaultIdleTimeout,
+		devices:     devices,
+		ingester:    ingester,
+		conns:       make(map[net.Conn]struct{}),
+	}
+}
+
+// SetIdleTimeout sets how long a connection may stay silent before it is closed
+func (s *Server) SetIdleTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.idleTimeout = timeout
+	}
+}
+
+// Start opens the listener and accepts connections in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.acceptLoop(listener)
+	return nil
+}
+
+// Addr returns the address the server listens on, once started
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Stop closes the listener and all tracker connections and waits for their
+// sessions to finish. Trackers resend unacknowledged records on reconnect.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	s.closing = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// acceptLoop accepts tracker connections until the listener is closed
+func (s *Server) acceptLoop(listener net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosing() {
+				return
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			log.Printf("Device gateway stopped accepting connections: %v", err)
+			return
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(conn)
+			s.serveTeltonika(conn)
+		}()
+	}
+}
+
+// serveTeltonika runs a Teltonika session: the tracker sends its IMEI, the
+// server accepts (0x01) or rejects (0x00) it, then each AVL packet is
+// answered with the number of records stored. The session ends once the
+// device is no longer bound to an active vehicle.
+func (s *Server) serveTeltonika(conn net.Conn) {
+	ctx := context.Background()
+	remote := conn.RemoteAddr()
+
+	conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+	imei, err := readTeltonikaIMEI(conn)
+	if err != nil {
+		if !s.isClosing() && !errors.Is(err, io.EOF) {
+			log.Printf("Invalid tracker handshake from %v: %v", remote, err)
+		}
+		return
+	}
+
+	device, err := s.devices.LookupByIMEI(ctx, imei, models.DeviceProtocolTeltonika)
+	if err != nil {
+		log.Printf("Rejected tracker %s from %v: %v", imei, remote, err)
+		s.write(conn, []byte{0x00})
+		return
+	}
+	if !s.write(conn, []byte{0x01}) {
+		return
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+		records, err := readTeltonikaPacket(conn)
+		if errors.Is(err, ErrInvalidCRC) {
+			// Acknowledge nothing so the tracker sends the packet again
+			if !s.write(conn, teltonikaAck(0)) {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			if !s.isClosing() && !errors.Is(err, io.EOF) {
+				log.Printf("Closing connection of tracker %s: %v", imei, err)
+			}
+			return
+		}
+
+		// The device may have been rebound, unbound or deactivated since the
+		// handshake, so its binding is resolved again for every packet
+		device, err = s.devices.LookupByIMEI(ctx, imei, models.DeviceProtocolTeltonika)
+		if err != nil {
+			if appErr, ok := err.(*apperrors.AppError); ok && appErr.Status == http.StatusNotFound {
+				log.Printf("Closing connection of tracker %s: no longer bound to an active vehicle", imei)
+				return
+			}
+			log.Printf("Failed to look up tracker %s: %v", imei, err)
+			if !s.write(conn, teltonikaAck(0)) {
+				return
+			}
+			continue
+		}
+
+		accepted := s.ingest(ctx, imei, device, records)
+		if !s.write(conn, teltonikaAck(accepted)) {
+			return
+		}
+	}
+}
+
+// ingest stores the records of an AVL packet and returns how many of them
+// the tracker may discard. On failure none are, so it sends them again.
+func (s *Server) ingest(ctx context.Context, imei string, device *models.Device, records []AVLRecord) int {
+	if err := s.devices.Touch(ctx, device.ID, time.Now()); err != nil {
+		log.Printf("Failed to update last seen time of tracker %s: %v", imei, err)
+	}
+
+	points := make([]tracking.GPSBatchPoint, 0, len(records))
+	for i := range records {
+		// Records without a fix repeat the last known position
+		if !records[i].HasFix() {
+			continue
+		}
+		points = append(points, toGPSBatchPoint(&records[i]))
+	}
+	if len(points) == 0 {
+		return len(records)
+	}
+
+	result, err := s.ingester.ProcessDeviceGPSBatch(device.ID, *device.VehicleID, points)
+	if err != nil {
+		log.Printf("Failed to store %d records of tracker %s: %v", len(points), imei, err)
+		return 0
+	}
+	if len(result.Rejected) > 0 {
+		log.Printf("Dropped %d invalid records of tracker %s", len(result.Rejected), imei)
+	}
+
+	return len(records)
+}
+
+// toGPSBatchPoint converts an AVL record into a GPS batch point
+func toGPSBatchPoint(record *AVLRecord) tracking.GPSBatchPoint {
+	point := tracking.GPSBatchPoint{
+		Latitude:   record.Latitude,
+		Longitude:  record.Longitude,
+		Altitude:   float64(record.Altitude),
+		Speed:      float64(record.Speed),
+		Heading:    float64(record.Angle),
+		Timestamp:  record.Timestamp,
+		Satellites: int(record.Satellites),
+		RawData: models.JSON{
+			"protocol":    models.DeviceProtocolTeltonika,
+			"priority":    record.Priority,
+			"event_io_id": record.EventIOID,
+			"io":          record.ioAttributes(),
+		},
+	}
+
+	if value, ok := record.IO[ioIgnition]; ok {
+		ignitionOn := value == 1
+		point.IgnitionOn = &ignitionOn
+	}
+	if value, ok := record.IO[ioFuelLevel]; ok {
+		liters := float64(value) / 10
+		point.FuelLevel = &liters
+	}
+	if value, ok := record.IO[ioTotalOdometer]; ok {
+		km := float64(value) / 1000
+		point.Odometer = &km
+	}
+
+	return point
+}
+
+// write sends a reply to the tracker, reporting whether it succeeded
+func (s *Server) write(conn net.Conn, data []byte) bool {
+	conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+	if _, err := conn.Write(data); err != nil {
+		if !s.isClosing() {
+			log.Printf("Failed to reply to tracker at %v: %v", conn.RemoteAddr(), err)
+		}
+		return false
+	}
+	return true
+}
+
+// track registers an open connection, unless the server is stopping
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+// untrack closes and forgets a connection
+func (s *Server) untrack(conn net.Conn) {
+	conn.Close()
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+// isClosing reports whether Stop has been called
+func (s *Server) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
@@ -0,0 +1,229 @@
+package gateway
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/tracking"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+type fakeDevices struct {
+	mu      sync.Mutex
+	devices map[string]*models.Device
+}
+
+func (f *fakeDevices) LookupByIMEI(_ context.Context, imei, _ string) (*models.Device, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if device, ok := f.devices[imei]; ok {
+		copied := *device
+		return &copied, nil
+	}
+	return nil, apperrors.NewNotFoundError("device")
+}
+
+func (f *fakeDevices) set(imei string, device *models.Device) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if device == nil {
+		delete(f.devices, imei)
+		return
+	}
+	f.devices[imei] = device
+}
+
+func (f *fakeDevices) Touch(context.Context, string, time.Time) error {
+	return nil
+}
+
+type ingestedBatch struct {
+	DeviceID  string
+	VehicleID string
+	Points    []tracking.GPSBatchPoint
+}
+
+type fakeIngester struct {
+	mu      sync.Mutex
+	err     error
+	batches []ingestedBatch
+}
+
+func (f *fakeIngester) ProcessDeviceGPSBatch(deviceID, vehicleID string, points []tracking.GPSBatchPoint) (*tracking.GPSBatchResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.batches = append(f.batches, ingestedBatch{DeviceID: deviceID, VehicleID: vehicleID, Points: points})
+	return &tracking.GPSBatchResult{Received: len(points), Accepted: len(points)}, nil
+}
+
+func startTestServer(t *testing.T, devices *fakeDevices, ingester *fakeIngester) *Server {
+	t.Helper()
+	server := NewServer("127.0.0.1:0", devices, ingester)
+	require.NoError(t, server.Start())
+	t.Cleanup(server.Stop)
+	return server
+}
+
+func dialTracker(t *testing.T, server *Server, imei string) (net.Conn, byte) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	handshake := binary.BigEndian.AppendUint16(nil, uint16(len(imei)))
+	_, err = conn.Write(append(handshake, imei...))
+	require.NoError(t, err)
+
+	reply := make([]byte, 1)
+	_, err = io.ReadFull(conn, reply)
+	require.NoError(t, err)
+	return conn, reply[0]
+}
+
+func sendPacket(t *testing.T, conn net.Conn, packet []byte) uint32 {
+	t.Helper()
+	_, err := conn.Write(packet)
+	require.NoError(t, err)
+
+	ack := make([]byte, 4)
+	_, err = io.ReadFull(conn, ack)
+	require.NoError(t, err)
+	return binary.BigEndian.Uint32(ack)
+}
+
+func TestServer_TeltonikaSession(t *testing.T) {
+	vehicleID := "vehicle-1"
+	devices := &fakeDevices{
+		devices: map[string]*models.Device{"356307042441013": {ID: "device-1", VehicleID: &vehicleID}},
+	}
+	ingester := &fakeIngester{}
+	server := startTestServer(t, devices, ingester)
+
+	conn, reply := dialTracker(t, server, "356307042441013")
+	require.Equal(t, byte(0x01), reply)
+
+	base := time.Date(2025, 3, 1, 8, 30, 0, 0, time.UTC)
+	packet := codec8Packet(
+		AVLRecord{Timestamp: base, Latitude: -1.2379, Longitude: 116.8528, Satellites: 9, Speed: 40, IO: map[uint16]uint64{ioIgnition: 1}},
+		AVLRecord{Timestamp: base.Add(time.Minute), Latitude: -1.2379, Longitude: 116.8528}, // no fix
+		AVLRecord{Timestamp: base.Add(2 * time.Minute), Latitude: -1.2401, Longitude: 116.8611, Satellites: 11, IO: map[uint16]uint64{ioIgnition: 0}},
+	)
+	assert.Equal(t, uint32(3), sendPacket(t, conn, packet), "acknowledges every record, including those without a fix")
+
+	ingester.mu.Lock()
+	defer ingester.mu.Unlock()
+	require.Len(t, ingester.batches, 1)
+	batch := ingester.batches[0]
+	assert.Equal(t, "device-1", batch.DeviceID)
+	assert.Equal(t, vehicleID, batch.VehicleID)
+	require.Len(t, batch.Points, 2)
+	assert.Equal(t, base, batch.Points[0].Timestamp)
+	require.NotNil(t, batch.Points[0].IgnitionOn)
+	assert.True(t, *batch.Points[0].IgnitionOn)
+	require.NotNil(t, batch.Points[1].IgnitionOn)
+	assert.False(t, *batch.Points[1].IgnitionOn)
+	assert.Equal(t, 11, batch.Points[1].Satellites)
+}
+
+func TestServer_RejectsUnknownTracker(t *testing.T) {
+	server := startTestServer(t, &fakeDevices{}, &fakeIngester{})
+
+	_, reply := dialTracker(t, server, "356307042441099")
+	assert.Equal(t, byte(0x00), reply)
+}
+
+func TestServer_HoldsRecordsWhenStoreFails(t *testing.T) {
+	vehicleID := "vehicle-1"
+	devices := &fakeDevices{
+		devices: map[string]*models.Device{"356307042441013": {ID: "device-1", VehicleID: &vehicleID}},
+	}
+	ingester := &fakeIngester{err: apperrors.NewInternalError("database unavailable")}
+	server := startTestServer(t, devices, ingester)
+
+	conn, reply := dialTracker(t, server, "356307042441013")
+	require.Equal(t, byte(0x01), reply)
+
+	packet := codec8Packet(AVLRecord{Timestamp: time.Now(), Latitude: -6.2, Longitude: 106.8, Satellites: 7})
+	assert.Equal(t, uint32(0), sendPacket(t, conn, packet), "tracker keeps the records and retries")
+
+	corrupted := codec8Packet(AVLRecord{Timestamp: time.Now(), Latitude: -6.2, Longitude: 106.8, Satellites: 7})
+	corrupted[len(corrupted)-1] ^= 0xFF
+	assert.Equal(t, uint32(0), sendPacket(t, conn, corrupted), "CRC errors keep the session open")
+
+	assert.Empty(t, ingester.batches)
+}
+
+func TestServer_FollowsBindingChanges(t *testing.T) {
+	vehicleID, otherVehicleID := "vehicle-1", "vehicle-2"
+	devices := &fakeDevices{
+		devices: map[string]*models.Device{"356307042441013": {ID: "device-1", VehicleID: &vehicleID}},
+	}
+	ingester := &fakeIngester{}
+	server := startTestServer(t, devices, ingester)
+
+	conn, reply := dialTracker(t, server, "356307042441013")
+	require.Equal(t, byte(0x01), reply)
+
+	base := time.Date(2025, 3, 1, 8, 30, 0, 0, time.UTC)
+	record := func(offset time.Duration) []byte {
+		return codec8Packet(AVLRecord{Timestamp: base.Add(offset), Latitude: -6.2, Longitude: 106.8, Satellites: 7})
+	}
+	assert.Equal(t, uint32(1), sendPacket(t, conn, record(0)))
+
+	devices.set("356307042441013", &models.Device{ID: "device-1", VehicleID: &otherVehicleID})
+	assert.Equal(t, uint32(1), sendPacket(t, conn, record(time.Minute)))
+
+	ingester.mu.Lock()
+	require.Len(t, ingester.batches, 2)
+	assert.Equal(t, vehicleID, ingester.batches[0].VehicleID)
+	assert.Equal(t, otherVehicleID, ingester.batches[1].VehicleID, "fixes after a rebind go to the new vehicle")
+	ingester.mu.Unlock()
+
+	// Unbinding or deactivating the device ends the session unacknowledged
+	devices.set("356307042441013", nil)
+	_, err := conn.Write(record(2 * time.Minute))
+	require.NoError(t, err)
+	_, err = io.ReadFull(conn, make([]byte, 4))
+	assert.Error(t, err)
+
+	ingester.mu.Lock()
+	defer ingester.mu.Unlock()
+	assert.Len(t, ingester.batches, 2)
+}
+
+func TestToGPSBatchPoint(t *testing.T) {
+	record := &AVLRecord{
+		Timestamp:  time.Date(2025, 3, 1, 8, 30, 0, 0, time.UTC),
+		Latitude:   -1.2379,
+		Longitude:  116.8528,
+		Altitude:   42,
+		Angle:      275,
+		Satellites: 9,
+		Speed:      63,
+		IO:         map[uint16]uint64{ioIgnition: 1, ioFuelLevel: 1525, ioTotalOdometer: 123456789},
+	}
+
+	point := toGPSBatchPoint(record)
+
+	assert.Equal(t, 275.0, point.Heading)
+	assert.Equal(t, 63.0, point.Speed)
+	require.NotNil(t, point.FuelLevel)
+	assert.InDelta(t, 152.5, *point.FuelLevel, 1e-9)
+	require.NotNil(t, point.Odometer)
+	assert.InDelta(t, 123456.789, *point.Odometer, 1e-9)
+	assert.Equal(t, models.DeviceProtocolTeltonika, point.RawData["protocol"])
+	assert.Equal(t, uint64(1525), point.RawData["io"].(map[string]interface{})["84"])
+}
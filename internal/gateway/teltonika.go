@@ -0,0 +1,286 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Teltonika codec identifiers
+const (
+	codec8         = 0x08
+	codec8Extended = 0x8E
+)
+
+// Teltonika FMB IO element IDs mapped onto GPS tracks. All IO elements are
+// also kept in the track's raw data.
+const (
+	ioTotalOdometer = 16  // meters
+	ioFuelLevel     = 84  // CAN fuel level, 0.1 liters
+	ioIgnition      = 239 // 0 off, 1 on
+)
+
+// maxTeltonikaDataLength bounds the AVL data field of a single packet. FMB
+// devices send at most 1280 bytes; anything far beyond that is not a
+// Teltonika packet.
+const maxTeltonikaDataLength = 64 * 1024
+
+// ErrInvalidCRC is returned for packets whose checksum does not match
+var ErrInvalidCRC = errors.New("teltonika: CRC mismatch")
+
+// AVLRecord is a single position record sent by a Teltonika tracker
+type AVLRecord struct {
+	Timestamp  time.Time
+	Priority   uint8
+	Longitude  float64
+	Latitude   float64
+	Altitude   int16  // meters
+	Angle      uint16 // degrees
+	Satellites uint8
+	Speed      uint16 // km/h
+
+	EventIOID uint16
+	IO        map[uint16]uint64 // fixed-size IO elements
+	IOBytes   map[uint16][]byte // variable-size IO elements (Codec 8 Extended)
+}
+
+// HasFix reports whether the record carries a GNSS fix. Without one the
+// tracker repeats its last known coordinates.
+func (r *AVLRecord) HasFix() bool {
+	return r.Satellites > 0
+}
+
+// readTeltonikaIMEI reads the IMEI a tracker sends when it connects: a
+// two-byte length followed by the IMEI in ASCII digits
+func readTeltonikaIMEI(r io.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length == 0 || length > 20 {
+		return "", fmt.Errorf("teltonika: invalid IMEI length %d", length)
+	}
+
+	imei := make([]byte, length)
+	if _, err := io.ReadFull(r, imei); err != nil {
+		return "", err
+	}
+	for _, b := range imei {
+		if b < '0' || b > '9' {
+			return "", fmt.Errorf("teltonika: invalid IMEI %q", imei)
+		}
+	}
+	return string(imei), nil
+}
+
+// readTeltonikaPacket reads one AVL data packet: a four-byte zero preamble,
+// the data length, the AVL data and a CRC-16/IBM of the data. Packets with a
+// wrong checksum return ErrInvalidCRC.
+func readTeltonikaPacket(r io.Reader) ([]AVLRecord, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint32(header[:4]) != 0 {
+		return nil, errors.New("teltonika: invalid preamble")
+	}
+
+	length := binary.BigEndian.Uint32(header[4:])
+	if length < 3 || length > maxTeltonikaDataLength {
+		return nil, fmt.Errorf("teltonika: invalid data length %d", length)
+	}
+
+	data := make([]byte, length+4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	payload := data[:length]
+	if binary.BigEndian.Uint32(data[length:]) != uint32(crc16IBM(payload)) {
+		return nil, ErrInvalidCRC
+	}
+
+	return decodeTeltonikaAVL(payload)
+}
+
+// decodeTeltonikaAVL decodes the AVL data field of a Codec 8 or Codec 8
+// Extended packet
+func decodeTeltonikaAVL(payload []byte) ([]AVLRecord, error) {
+	r := bytes.NewReader(payload)
+
+	codec, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if codec != codec8 && codec != codec8Extended {
+		return nil, fmt.Errorf("teltonika: unsupported codec 0x%02X", codec)
+	}
+	extended := codec == codec8Extended
+
+	count, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]AVLRecord, 0, count)
+	for i := 0; i < int(count); i++ {
+		record, err := decodeAVLRecord(r, extended)
+		if err != nil {
+			return nil, fmt.Errorf("teltonika: record %d: %w", i, err)
+		}
+		records = append(records, record)
+	}
+
+	trailer, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if trailer != count {
+		return nil, fmt.Errorf("teltonika: record count mismatch (%d and %d)", count, trailer)
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("teltonika: %d trailing bytes", r.Len())
+	}
+
+	return records, nil
+}
+
+// decodeAVLRecord decodes one AVL record: timestamp, priority, GPS element
+// and IO element
+func decodeAVLRecord(r *bytes.Reader, extended bool) (AVLRecord, error) {
+	var gps struct {
+		Timestamp  uint64
+		Priority   uint8
+		Longitude  int32
+		Latitude   int32
+		Altitude   int16
+		Angle      uint16
+		Satellites uint8
+		Speed      uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &gps); err != nil {
+		return AVLRecord{}, err
+	}
+
+	record := AVLRecord{
+		Timestamp:  time.UnixMilli(int64(gps.Timestamp)).UTC(),
+		Priority:   gps.Priority,
+		Longitude:  float64(gps.Longitude) / 1e7,
+		Latitude:   float64(gps.Latitude) / 1e7,
+		Altitude:   gps.Altitude,
+		Angle:      gps.Angle,
+		Satellites: gps.Satellites,
+		Speed:      gps.Speed,
+		IO:         make(map[uint16]uint64),
+	}
+
+	// Codec 8 uses one-byte IDs and counts, Codec 8 Extended two-byte ones
+	readN := func() (uint16, error) {
+		if extended {
+			var n uint16
+			err := binary.Read(r, binary.BigEndian, &n)
+			return n, err
+		}
+		b, err := r.ReadByte()
+		return uint16(b), err
+	}
+
+	eventID, err := readN()
+	if err != nil {
+		return AVLRecord{}, err
+	}
+	record.EventIOID = eventID
+	if _, err := readN(); err != nil { // total IO count, implied by the groups below
+		return AVLRecord{}, err
+	}
+
+	for _, size := range []int{1, 2, 4, 8} {
+		n, err := readN()
+		if err != nil {
+			return AVLRecord{}, err
+		}
+		for j := 0; j < int(n); j++ {
+			id, err := readN()
+			if err != nil {
+				return AVLRecord{}, err
+			}
+			value := make([]byte, size)
+			if _, err := io.ReadFull(r, value); err != nil {
+				return AVLRecord{}, err
+			}
+			var v uint64
+			for _, b := range value {
+				v = v<<8 | uint64(b)
+			}
+			record.IO[id] = v
+		}
+	}
+
+	if extended {
+		n, err := readN()
+		if err != nil {
+			return AVLRecord{}, err
+		}
+		if n > 0 {
+			record.IOBytes = make(map[uint16][]byte, n)
+		}
+		for j := 0; j < int(n); j++ {
+			id, err := readN()
+			if err != nil {
+				return AVLRecord{}, err
+			}
+			length, err := readN()
+			if err != nil {
+				return AVLRecord{}, err
+			}
+			value := make([]byte, length)
+			if _, err := io.ReadFull(r, value); err != nil {
+				return AVLRecord{}, err
+			}
+			record.IOBytes[id] = value
+		}
+	}
+
+	return record, nil
+}
+
+// teltonikaAck encodes the reply to an AVL packet: the number of records
+// the server accepted. Anything less than the packet's count makes the
+// tracker keep the records and send them again.
+func teltonikaAck(accepted int) []byte {
+	ack := make([]byte, 4)
+	binary.BigEndian.PutUint32(ack, uint32(accepted))
+	return ack
+}
+
+// ioAttributes returns the record's IO elements keyed by decimal ID, for
+// storing as raw device data
+func (r *AVLRecord) ioAttributes() map[string]interface{} {
+	attributes := make(map[string]interface{}, len(r.IO)+len(r.IOBytes))
+	for id, value := range r.IO {
+		attributes[strconv.Itoa(int(id))] = value
+	}
+	for id, value := range r.IOBytes {
+		attributes[strconv.Itoa(int(id))] = fmt.Sprintf("%X", value)
+	}
+	return attributes
+}
+
+// crc16IBM computes the CRC-16/IBM checksum used by Teltonika packets
+func crc16IBM(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
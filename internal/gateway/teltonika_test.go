@@ -0,0 +1,147 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return data
+}
+
+// codec8Packet encodes AVL records with one-byte IO elements as a Codec 8 packet
+func codec8Packet(records ...AVLRecord) []byte {
+	var data bytes.Buffer
+	data.WriteByte(codec8)
+	data.WriteByte(byte(len(records)))
+	for _, r := range records {
+		binary.Write(&data, binary.BigEndian, uint64(r.Timestamp.UnixMilli()))
+		data.WriteByte(r.Priority)
+		binary.Write(&data, binary.BigEndian, int32(r.Longitude*1e7))
+		binary.Write(&data, binary.BigEndian, int32(r.Latitude*1e7))
+		binary.Write(&data, binary.BigEndian, r.Altitude)
+		binary.Write(&data, binary.BigEndian, r.Angle)
+		data.WriteByte(r.Satellites)
+		binary.Write(&data, binary.BigEndian, r.Speed)
+
+		data.WriteByte(byte(r.EventIOID))
+		data.WriteByte(byte(len(r.IO)))
+		data.WriteByte(byte(len(r.IO)))
+		for id, value := range r.IO {
+			data.WriteByte(byte(id))
+			data.WriteByte(byte(value))
+		}
+		data.Write([]byte{0, 0, 0}) // no 2, 4 or 8 byte elements
+	}
+	data.WriteByte(byte(len(records)))
+
+	packet := make([]byte, 8, 8+data.Len()+4)
+	binary.BigEndian.PutUint32(packet[4:], uint32(data.Len()))
+	packet = append(packet, data.Bytes()...)
+	return binary.BigEndian.AppendUint32(packet, uint32(crc16IBM(data.Bytes())))
+}
+
+func TestReadTeltonikaIMEI(t *testing.T) {
+	imei, err := readTeltonikaIMEI(bytes.NewReader(mustHex(t, "000F333536333037303432343431303133")))
+	require.NoError(t, err)
+	assert.Equal(t, "356307042441013", imei)
+
+	_, err = readTeltonikaIMEI(bytes.NewReader([]byte{0x00, 0x03, 'a', 'b', 'c'}))
+	assert.Error(t, err)
+
+	_, err = readTeltonikaIMEI(bytes.NewReader([]byte{0x04, 0x00}))
+	assert.Error(t, err, "rejects oversized lengths")
+}
+
+func TestReadTeltonikaPacket_Codec8(t *testing.T) {
+	// Example packet from the Teltonika Codec 8 documentation
+	packet := mustHex(t, "000000000000003608010000016B40D8EA30010000000000000000000000000000000105021503010101425E0F01F10000601A014E0000000000000000010000C7CF")
+
+	records, err := readTeltonikaPacket(bytes.NewReader(packet))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	record := records[0]
+	assert.Equal(t, time.Date(2019, 6, 10, 10, 4, 46, 0, time.UTC), record.Timestamp)
+	assert.Equal(t, uint8(1), record.Priority)
+	assert.False(t, record.HasFix())
+	assert.Equal(t, uint16(1), record.EventIOID)
+	assert.Equal(t, map[uint16]uint64{21: 3, 1: 1, 66: 0x5E0F, 241: 0x601A, 78: 0}, record.IO)
+}
+
+func TestReadTeltonikaPacket_Codec8Extended(t *testing.T) {
+	// Example packet from the Teltonika Codec 8 Extended documentation
+	packet := mustHex(t, "000000000000004A8E010000016B412CEE000100000000000000000000000000000000010005000100010100010011001D00010010015E2C880002000B000000003544C87A000E000000001DD7E06A00000100002994")
+
+	records, err := readTeltonikaPacket(bytes.NewReader(packet))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	record := records[0]
+	assert.Equal(t, uint16(1), record.EventIOID)
+	assert.Equal(t, uint64(1), record.IO[1])
+	assert.Equal(t, uint64(0x1D), record.IO[17])
+	assert.Equal(t, uint64(0x015E2C88), record.IO[16])
+	assert.Equal(t, uint64(0x3544C87A), record.IO[11])
+	assert.Equal(t, uint64(0x1DD7E06A), record.IO[14])
+	assert.Empty(t, record.IOBytes)
+}
+
+func TestReadTeltonikaPacket_GPSElement(t *testing.T) {
+	sent := AVLRecord{
+		Timestamp:  time.Date(2025, 3, 1, 8, 30, 0, 0, time.UTC),
+		Priority:   1,
+		Longitude:  116.8528,
+		Latitude:   -1.2379,
+		Altitude:   42,
+		Angle:      275,
+		Satellites: 9,
+		Speed:      63,
+		EventIOID:  ioIgnition,
+		IO:         map[uint16]uint64{ioIgnition: 1},
+	}
+
+	records, err := readTeltonikaPacket(bytes.NewReader(codec8Packet(sent)))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+
+	got := records[0]
+	assert.Equal(t, sent.Timestamp, got.Timestamp)
+	assert.InDelta(t, sent.Latitude, got.Latitude, 1e-7, "southern latitudes are negative")
+	assert.InDelta(t, sent.Longitude, got.Longitude, 1e-7)
+	assert.Equal(t, sent.Altitude, got.Altitude)
+	assert.Equal(t, sent.Angle, got.Angle)
+	assert.Equal(t, sent.Speed, got.Speed)
+	assert.True(t, got.HasFix())
+	assert.Equal(t, uint64(1), got.IO[ioIgnition])
+}
+
+func TestReadTeltonikaPacket_Invalid(t *testing.T) {
+	packet := mustHex(t, "000000000000003608010000016B40D8EA30010000000000000000000000000000000105021503010101425E0F01F10000601A014E0000000000000000010000C7CF")
+
+	corrupted := append([]byte(nil), packet...)
+	corrupted[20] ^= 0xFF
+	_, err := readTeltonikaPacket(bytes.NewReader(corrupted))
+	assert.ErrorIs(t, err, ErrInvalidCRC)
+
+	badPreamble := append([]byte(nil), packet...)
+	badPreamble[0] = 0x01
+	_, err = readTeltonikaPacket(bytes.NewReader(badPreamble))
+	assert.Error(t, err)
+
+	_, err = readTeltonikaPacket(bytes.NewReader(packet[:30]))
+	assert.Error(t, err, "truncated packet")
+}
+
+func TestTeltonikaAck(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 2}, teltonikaAck(2))
+}
@@ -0,0 +1,209 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/config"
+)
+
+// Payment methods handled by gateways (models.Payment.PaymentMethod)
+const (
+	MethodQRIS         = "qris"
+	MethodBankTransfer = "bank_transfer"
+	MethodEWallet      = "e_wallet"
+)
+
+// Payment channels, i.e. the concrete provider a charge is created with.
+// These are the channels of the Midtrans Core API; OVO and DANA are not
+// offered until a gateway for them is integrated.
+const (
+	ChannelQRIS      = "qris"
+	ChannelBCA       = "bca"
+	ChannelMandiri   = "mandiri"
+	ChannelBNI       = "bni"
+	ChannelBRI       = "bri"
+	ChannelGoPay     = "gopay"
+	ChannelShopeePay = "shopeepay"
+)
+
+// Charge statuses reported by gateways
+const (
+	ChargeStatusPending   = "pending"
+	ChargeStatusCompleted = "completed"
+	ChargeStatusFailed    = "failed"
+	ChargeStatusExpired   = "expired"
+)
+
+// Payment gateway modes (config.PaymentGatewayMode)
+const (
+	GatewayModeLive = "live"
+	GatewayModeFake = "fake"
+)
+
+// Default lifetime of a pending charge per payment method
+var defaultChargeExpiry = map[string]time.Duration{
+	MethodQRIS:         30 * time.Minute,
+	MethodBankTransfer: 24 * time.Hour,
+	MethodEWallet:      15 * time.Minute,
+}
+
+// channelMethods maps every channel to the payment method it belongs to
+var channelMethods = map[string]string{
+	ChannelQRIS:      MethodQRIS,
+	ChannelBCA:       MethodBankTransfer,
+	ChannelMandiri:   MethodBankTransfer,
+	ChannelBNI:       MethodBankTransfer,
+	ChannelBRI:       MethodBankTransfer,
+	ChannelGoPay:     MethodEWallet,
+	ChannelShopeePay: MethodEWallet,
+}
+
+// ErrChargeNotFound is returned by gateways for unknown external IDs
+var ErrChargeNotFound = errors.New("charge not found")
+
+// PaymentGateway creates and manages charges with an external payment provider
+type PaymentGateway interface {
+	// Provider returns the provider name stored with the payment
+	Provider() string
+	// CreateCharge creates a new charge and returns the provider's answer
+	CreateCharge(ctx context.Context, req *ChargeRequest) (*ChargeResult, error)
+	// GetCharge fetches the current state of a charge
+	GetCharge(ctx context.Context, externalID string) (*ChargeResult, error)
+	// ExpireCharge cancels a pending charge so it can no longer be paid
+	ExpireCharge(ctx context.Context, externalID string) error
+}
+
+// ChargeRequest contains the data needed to create a charge
+type ChargeRequest struct {
+	PaymentID       string    `json:"payment_id"`
+	ReferenceNumber string    `json:"reference_number"`
+	Method          string    `json:"method"`
+	Channel         string    `json:"channel"`
+	Amount          float64   `json:"amount"` // total amount including PPN, in IDR
+	Currency        string    `json:"currency"`
+	Description     string    `json:"description"`
+	CustomerName    string    `json:"customer_name"`
+	CustomerEmail   string    `json:"customer_email"`
+	CustomerPhone   string    `json:"customer_phone"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+// ChargeResult is the normalized gateway response for a charge
+type ChargeResult struct {
+	ExternalID    string                 `json:"external_id"`
+	TransactionID string                 `json:"transaction_id"`
+	Status        string                 `json:"status"`
+	QRString      string                 `json:"qr_string,omitempty"`
+	QRImageURL    string                 `json:"qr_image_url,omitempty"`
+	VANumber      string                 `json:"va_number,omitempty"`
+	BankCode      string                 `json:"bank_code,omitempty"`
+	CheckoutURL   string                 `json:"checkout_url,omitempty"`
+	DeeplinkURL   string                 `json:"deeplink_url,omitempty"`
+	ExpiresAt     time.Time              `json:"expires_at"`
+	RawResponse   map[string]interface{} `json:"raw_response,omitempty"`
+}
+
+// GatewayRegistry resolves payment channels to gateways
+type GatewayRegistry struct {
+	gateways map[string]PaymentGateway
+	mutex    sync.RWMutex
+}
+
+// NewGatewayRegistry creates an empty gateway registry
+func NewGatewayRegistry() *GatewayRegistry {
+	return &GatewayRegistry{gateways: make(map[string]PaymentGateway)}
+}
+
+// NewGatewayRegistryFromConfig registers the Midtrans gateway for every
+// channel it supports when a server key is configured. In fake mode all
+// channels use a FakeGateway.
+func NewGatewayRegistryFromConfig(cfg *config.Config) *GatewayRegistry {
+	registry := NewGatewayRegistry()
+
+	if cfg.PaymentGatewayMode == GatewayModeFake {
+		fake := NewFakeGateway()
+		for channel := range channelMethods {
+			registry.Register(channel, fake)
+		}
+		return registry
+	}
+
+	if cfg.MidtransServerKey != "" {
+		midtrans := NewMidtransGateway(cfg.MidtransAPIURL, cfg.MidtransServerKey)
+		for _, channel := range MidtransChannels {
+			registry.Register(channel, midtrans)
+		}
+	}
+
+	return registry
+}
+
+// Register sets the gateway used for a channel
+func (r *GatewayRegistry) Register(channel string, gateway PaymentGateway) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.gateways[strings.ToLower(channel)] = gateway
+}
+
+// Get returns the gateway for a channel
+func (r *GatewayRegistry) Get(channel string) (PaymentGateway, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	gateway, ok := r.gateways[strings.ToLower(channel)]
+	return gateway, ok
+}
+
+// Provider returns the gateway of a provider
+func (r *GatewayRegistry) Provider(name string) (PaymentGateway, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, gateway := range r.gateways {
+		if gateway.Provider() == name {
+			return gateway, true
+		}
+	}
+	return nil, false
+}
+
+// Channels returns the configured channels for a payment method, sorted
+func (r *GatewayRegistry) Channels(method string) []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var channels []string
+	for channel := range r.gateways {
+		if channelMethods[channel] == method {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// validateChannel checks that a channel belongs to the payment method
+func validateChannel(method, channel string) error {
+	if channelMethods[channel] != method {
+		return fmt.Errorf("channel %q is not a valid %s channel", channel, method)
+	}
+	return nil
+}
+
+// normalizeChargeStatus maps provider specific statuses to charge statuses
+func normalizeChargeStatus(status string) string {
+	switch strings.ToUpper(status) {
+	case "PAID", "SETTLED", "SETTLEMENT", "SUCCESS", "SUCCEEDED", "COMPLETED", "CAPTURE":
+		return ChargeStatusCompleted
+	case "EXPIRED", "EXPIRE":
+		return ChargeStatusExpired
+	case "FAILED", "FAILURE", "DENY", "DENIED", "CANCEL", "CANCELLED", "VOIDED":
+		return ChargeStatusFailed
+	default:
+		return ChargeStatusPending
+	}
+}
@@ -0,0 +1,132 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeProvider is the provider name of the fake gateway
+const FakeProvider = "fake"
+
+// FakeGateway is an in-process PaymentGateway for tests and local
+// development. Charges are kept in memory and can be settled with SetStatus.
+type FakeGateway struct {
+	charges  map[string]*ChargeResult
+	requests map[string]*ChargeRequest
+	sequence int
+	mutex    sync.Mutex
+
+	// FailCreate makes CreateCharge return this error when set
+	FailCreate error
+}
+
+// NewFakeGateway creates an empty fake gateway
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		charges:  make(map[string]*ChargeResult),
+		requests: make(map[string]*ChargeRequest),
+	}
+}
+
+// Provider returns the provider name
+func (f *FakeGateway) Provider() string {
+	return FakeProvider
+}
+
+// CreateCharge records the charge and returns method specific payment data
+func (f *FakeGateway) CreateCharge(_ context.Context, req *ChargeRequest) (*ChargeResult, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.FailCreate != nil {
+		return nil, f.FailCreate
+	}
+
+	f.sequence++
+	externalID := fmt.Sprintf("fake_%s_%06d", req.Channel, f.sequence)
+	result := &ChargeResult{
+		ExternalID:    externalID,
+		TransactionID: fmt.Sprintf("trx_%06d", f.sequence),
+		Status:        ChargeStatusPending,
+		ExpiresAt:     req.ExpiresAt,
+	}
+
+	switch req.Method {
+	case MethodQRIS:
+		result.QRString = fmt.Sprintf("00020101021226FAKE%s5303360540%.0f6304", req.ReferenceNumber, req.Amount)
+	case MethodBankTransfer:
+		result.BankCode = req.Channel
+		result.VANumber = fmt.Sprintf("8808%010d", f.sequence)
+	case MethodEWallet:
+		result.CheckoutURL = fmt.Sprintf("https://fake-gateway.local/checkout/%s", externalID)
+		result.DeeplinkURL = fmt.Sprintf("%s://pay/%s", req.Channel, externalID)
+	}
+
+	result.RawResponse = map[string]interface{}{
+		"id":             result.ExternalID,
+		"transaction_id": result.TransactionID,
+		"status":         result.Status,
+		"reference_id":   req.ReferenceNumber,
+		"amount":         req.Amount,
+	}
+
+	f.charges[externalID] = result
+	requestCopy := *req
+	f.requests[externalID] = &requestCopy
+
+	resultCopy := *result
+	return &resultCopy, nil
+}
+
+// GetCharge returns the current state of a charge
+func (f *FakeGateway) GetCharge(_ context.Context, externalID string) (*ChargeResult, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	charge, ok := f.charges[externalID]
+	if !ok {
+		return nil, ErrChargeNotFound
+	}
+	chargeCopy := *charge
+	return &chargeCopy, nil
+}
+
+// ExpireCharge expires a pending charge
+func (f *FakeGateway) ExpireCharge(_ context.Context, externalID string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	charge, ok := f.charges[externalID]
+	if !ok {
+		return ErrChargeNotFound
+	}
+	if charge.Status == ChargeStatusPending {
+		charge.Status = ChargeStatusExpired
+		charge.ExpiresAt = time.Now()
+	}
+	return nil
+}
+
+// SetStatus changes the status of a charge, e.g. to simulate a settlement
+func (f *FakeGateway) SetStatus(externalID, status string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	charge, ok := f.charges[externalID]
+	if !ok {
+		return ErrChargeNotFound
+	}
+	charge.Status = status
+	return nil
+}
+
+// Request returns the request a charge was created with
+func (f *FakeGateway) Request(externalID string) (*ChargeRequest, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	req, ok := f.requests[externalID]
+	return req, ok
+}
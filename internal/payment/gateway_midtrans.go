@@ -0,0 +1,381 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// Midtrans Core API (https://docs.midtrans.com/reference/core-api). Charges
+// are created with POST /v2/charge using our payment reference as order_id
+// and are addressed by order_id afterwards. Requests use HTTP Basic auth
+// with the server key as user name and an empty password.
+const (
+	MidtransProvider      = "midtrans"
+	MidtransProductionURL = "https://api.midtrans.com"
+	MidtransSandboxURL    = "https://api.sandbox.midtrans.com"
+)
+
+const (
+	// midtransTimeLayout is the layout of Midtrans timestamps, which are in
+	// the merchant time zone (WIB)
+	midtransTimeLayout = "2006-01-02 15:04:05"
+
+	// midtransOrderTimeLayout is the layout of custom_expiry.order_time
+	midtransOrderTimeLayout = "2006-01-02 15:04:05 -0700"
+
+	// Mandiri bill payment info limits
+	midtransBillInfo1Length = 10
+	midtransBillInfo2Length = 30
+)
+
+// MidtransChannels are the channels charged through Midtrans
+var MidtransChannels = []string{
+	ChannelQRIS,
+	ChannelBCA,
+	ChannelMandiri,
+	ChannelBNI,
+	ChannelBRI,
+	ChannelGoPay,
+	ChannelShopeePay,
+}
+
+// MidtransGateway creates charges through the Midtrans Core API
+type MidtransGateway struct {
+	baseURL   string
+	serverKey string
+	client    *http.Client
+	location  *time.Location
+}
+
+// midtransResponse holds the fields of Midtrans charge and status responses
+type midtransResponse struct {
+	StatusCode        string `json:"status_code"`
+	StatusMessage     string `json:"status_message"`
+	TransactionID     string `json:"transaction_id"`
+	OrderID           string `json:"order_id"`
+	GrossAmount       string `json:"gross_amount"`
+	PaymentType       string `json:"payment_type"`
+	TransactionStatus string `json:"transaction_status"`
+	FraudStatus       string `json:"fraud_status"`
+	ExpiryTime        string `json:"expiry_time"`
+	VANumbers         []struct {
+		Bank     string `json:"bank"`
+		VANumber string `json:"va_number"`
+	} `json:"va_numbers"`
+	BillKey    string `json:"bill_key"`
+	BillerCode string `json:"biller_code"`
+	QRString   string `json:"qr_string"`
+	Actions    []struct {
+		Name   string `json:"name"`
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"actions"`
+	ValidationMessages []string `json:"validation_messages"`
+}
+
+// midtransNotification is the body of a Midtrans HTTP notification
+type midtransNotification struct {
+	midtransResponse
+	SignatureKey   string `json:"signature_key"`
+	SettlementTime string `json:"settlement_time"`
+}
+
+// NewMidtransGateway creates a Midtrans gateway. An empty base URL uses
+// the sandbox.
+func NewMidtransGateway(baseURL, serverKey string) *MidtransGateway {
+	if baseURL == "" {
+		baseURL = MidtransSandboxURL
+	}
+	location, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		location = time.FixedZone("WIB", 7*60*60)
+	}
+	return &MidtransGateway{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		serverKey: serverKey,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		location:  location,
+	}
+}
+
+// Provider returns the provider name
+func (g *MidtransGateway) Provider() string {
+	return MidtransProvider
+}
+
+// CreateCharge creates a charge with the payment type of the channel
+func (g *MidtransGateway) CreateCharge(ctx context.Context, req *ChargeRequest) (*ChargeResult, error) {
+	body := map[string]interface{}{
+		"transaction_details": map[string]interface{}{
+			"order_id":     req.ReferenceNumber,
+			"gross_amount": midtransAmount(req.Amount),
+		},
+	}
+
+	switch req.Channel {
+	case ChannelQRIS:
+		body["payment_type"] = "qris"
+		body["qris"] = map[string]string{"acquirer": "gopay"}
+	case ChannelBCA, ChannelBNI, ChannelBRI:
+		body["payment_type"] = "bank_transfer"
+		body["bank_transfer"] = map[string]string{"bank": req.Channel}
+	case ChannelMandiri:
+		// Mandiri virtual accounts are bill payments: the customer pays
+		// the bill key under the Midtrans biller code
+		body["payment_type"] = "echannel"
+		body["echannel"] = map[string]string{
+			"bill_info1": truncateRunes("Payment:", midtransBillInfo1Length),
+			"bill_info2": truncateRunes(req.Description, midtransBillInfo2Length),
+		}
+	case ChannelGoPay:
+		body["payment_type"] = "gopay"
+	case ChannelShopeePay:
+		body["payment_type"] = "shopeepay"
+	default:
+		return nil, fmt.Errorf("channel %q is not supported by Midtrans", req.Channel)
+	}
+
+	customer := map[string]string{}
+	if req.CustomerName != "" {
+		customer["first_name"] = req.CustomerName
+	}
+	if req.CustomerEmail != "" {
+		customer["email"] = req.CustomerEmail
+	}
+	if req.CustomerPhone != "" {
+		customer["phone"] = req.CustomerPhone
+	}
+	if len(customer) > 0 {
+		body["customer_details"] = customer
+	}
+
+	if !req.ExpiresAt.IsZero() {
+		now := time.Now()
+		minutes := int(math.Ceil(req.ExpiresAt.Sub(now).Minutes()))
+		if minutes < 1 {
+			minutes = 1
+		}
+		body["custom_expiry"] = map[string]interface{}{
+			"order_time":      now.In(g.location).Format(midtransOrderTimeLayout),
+			"expiry_duration": minutes,
+			"unit":            "minute",
+		}
+	}
+
+	return g.do(ctx, http.MethodPost, "/v2/charge", body)
+}
+
+// GetCharge fetches the status of a charge by order ID
+func (g *MidtransGateway) GetCharge(ctx context.Context, externalID string) (*ChargeResult, error) {
+	return g.do(ctx, http.MethodGet, "/v2/"+externalID+"/status", nil)
+}
+
+// ExpireCharge expires a pending charge by order ID
+func (g *MidtransGateway) ExpireCharge(ctx context.Context, externalID string) error {
+	_, err := g.do(ctx, http.MethodPost, "/v2/"+externalID+"/expire", nil)
+	return err
+}
+
+// do sends a request and parses the transaction in the response. Midtrans
+// reports errors in the status_code of the body, often with HTTP 200.
+func (g *MidtransGateway) do(ctx context.Context, method, path string, body map[string]interface{}) (*ChargeResult, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode Midtrans request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Midtrans request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(g.serverKey+":")))
+	httpReq.Header.Set("Accept", "application/json")
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("Midtrans request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Midtrans response: %w", err)
+	}
+
+	var parsed midtransResponse
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrChargeNotFound
+		}
+		return nil, fmt.Errorf("Midtrans returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(payload)))
+	}
+
+	code, _ := strconv.Atoi(parsed.StatusCode)
+	if code == 0 {
+		code = resp.StatusCode
+	}
+	switch {
+	case code == http.StatusNotFound:
+		return nil, ErrChargeNotFound
+	case code >= 300 && code != 407: // 407 reports an expired transaction
+		message := parsed.StatusMessage
+		if len(parsed.ValidationMessages) > 0 {
+			message += ": " + strings.Join(parsed.ValidationMessages, "; ")
+		}
+		return nil, fmt.Errorf("Midtrans returned status %d: %s", code, message)
+	}
+
+	var raw map[string]interface{}
+	_ = json.Unmarshal(payload, &raw)
+
+	result := &ChargeResult{
+		ExternalID:    parsed.OrderID,
+		TransactionID: parsed.TransactionID,
+		Status:        midtransChargeStatus(parsed.TransactionStatus, parsed.FraudStatus),
+		QRString:      parsed.QRString,
+		RawResponse:   raw,
+	}
+	if len(parsed.VANumbers) > 0 {
+		result.BankCode = parsed.VANumbers[0].Bank
+		result.VANumber = parsed.VANumbers[0].VANumber
+	}
+	if parsed.BillKey != "" {
+		result.BankCode = parsed.BillerCode
+		result.VANumber = parsed.BillKey
+	}
+	for _, action := range parsed.Actions {
+		switch action.Name {
+		case "generate-qr-code":
+			result.QRImageURL = action.URL
+			if parsed.PaymentType == "gopay" {
+				result.CheckoutURL = action.URL
+			}
+		case "deeplink-redirect":
+			result.DeeplinkURL = action.URL
+			if result.CheckoutURL == "" {
+				result.CheckoutURL = action.URL
+			}
+		}
+	}
+	if parsed.ExpiryTime != "" {
+		if expiresAt, err := time.ParseInLocation(midtransTimeLayout, parsed.ExpiryTime, g.location); err == nil {
+			result.ExpiresAt = expiresAt
+		}
+	}
+
+	return result, nil
+}
+
+// ParseNotification verifies and decodes a Midtrans HTTP notification. The
+// signature_key is the hex SHA-512 of order_id, status_code, gross_amount
+// and the server key.
+func (g *MidtransGateway) ParseNotification(header http.Header, body []byte) (*WebhookNotification, models.JSON, error) {
+	var parsed midtransNotification
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, nil, fmt.Errorf("invalid Midtrans notification: %w", err)
+	}
+	if parsed.OrderID == "" || parsed.TransactionID == "" {
+		return nil, nil, errors.New("Midtrans notification has no order_id or transaction_id")
+	}
+
+	sum := sha512.Sum512([]byte(parsed.OrderID + parsed.StatusCode + parsed.GrossAmount + g.serverKey))
+	expected := hex.EncodeToString(sum[:])
+	if g.serverKey == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(strings.ToLower(parsed.SignatureKey))) != 1 {
+		return nil, nil, ErrWebhookSignature
+	}
+
+	var raw models.JSON
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, nil, fmt.Errorf("invalid Midtrans notification: %w", err)
+	}
+
+	amount, err := strconv.ParseFloat(parsed.GrossAmount, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Midtrans gross_amount %q", parsed.GrossAmount)
+	}
+
+	notification := &WebhookNotification{
+		// Midtrans notifies every status change of a transaction once
+		// and retries it unchanged
+		EventID:       parsed.TransactionID + ":" + parsed.TransactionStatus,
+		ExternalID:    parsed.OrderID,
+		TransactionID: parsed.TransactionID,
+		Channel:       midtransChannel(&parsed.midtransResponse),
+		Status:        midtransChargeStatus(parsed.TransactionStatus, parsed.FraudStatus),
+		Amount:        amount,
+		FailureReason: parsed.StatusMessage,
+	}
+	if parsed.SettlementTime != "" {
+		if paidAt, err := time.ParseInLocation(midtransTimeLayout, parsed.SettlementTime, g.location); err == nil {
+			notification.PaidAt = paidAt.Format(time.RFC3339)
+		}
+	}
+	if notification.Status != ChargeStatusFailed {
+		notification.FailureReason = ""
+	}
+
+	return notification, raw, nil
+}
+
+// midtransChannel returns our channel for the payment type of a Midtrans
+// transaction
+func midtransChannel(parsed *midtransResponse) string {
+	switch parsed.PaymentType {
+	case "bank_transfer":
+		if len(parsed.VANumbers) > 0 {
+			return parsed.VANumbers[0].Bank
+		}
+		return ""
+	case "echannel":
+		return ChannelMandiri
+	case "qris", "gopay", "shopeepay":
+		return parsed.PaymentType
+	default:
+		return ""
+	}
+}
+
+// midtransAmount converts an amount to the whole rupiah Midtrans expects
+func midtransAmount(amount float64) int64 {
+	return int64(math.Round(amount))
+}
+
+// midtransChargeStatus maps a Midtrans transaction status to a charge
+// status. Card captures flagged for fraud review are not settled yet.
+func midtransChargeStatus(transactionStatus, fraudStatus string) string {
+	if transactionStatus == "capture" && fraudStatus == "challenge" {
+		return ChargeStatusPending
+	}
+	return normalizeChargeStatus(transactionStatus)
+}
+
+// truncateRunes shortens s to at most n runes
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,294 @@
+package payment
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/config"
+)
+
+func TestMidtransGateway_CreateCharge_BankTransfer(t *testing.T) {
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v2/charge", r.URL.Path)
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "SB-Mid-server-key", user)
+		assert.Empty(t, password)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status_code":"201","status_message":"Success, Bank Transfer transaction is created",
+			"transaction_id":"be03df7d-2f97-4c8c-a53c-8959f1b67295","order_id":"PAY-20250101-ABCD1234",
+			"merchant_id":"G812785002","gross_amount":"277500.00","currency":"IDR","payment_type":"bank_transfer",
+			"transaction_time":"2025-01-01 10:00:00","transaction_status":"pending",
+			"va_numbers":[{"bank":"bca","va_number":"812785002530231"}],"fraud_status":"accept",
+			"expiry_time":"2025-01-02 10:00:00"}`))
+	}))
+	defer server.Close()
+
+	gateway := NewMidtransGateway(server.URL, "SB-Mid-server-key")
+	result, err := gateway.CreateCharge(context.Background(), &ChargeRequest{
+		ReferenceNumber: "PAY-20250101-ABCD1234",
+		Method:          MethodBankTransfer,
+		Channel:         ChannelBCA,
+		Amount:          277499.6,
+		Currency:        "IDR",
+		CustomerName:    "PT Maju Jaya",
+		ExpiresAt:       time.Now().Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "PAY-20250101-ABCD1234", result.ExternalID, "charges are addressed by order ID")
+	assert.Equal(t, "be03df7d-2f97-4c8c-a53c-8959f1b67295", result.TransactionID)
+	assert.Equal(t, ChargeStatusPending, result.Status)
+	assert.Equal(t, "bca", result.BankCode)
+	assert.Equal(t, "812785002530231", result.VANumber)
+	assert.Equal(t, time.Date(2025, 1, 2, 3, 0, 0, 0, time.UTC), result.ExpiresAt.UTC(), "expiry is in WIB")
+	assert.Equal(t, "G812785002", result.RawResponse["merchant_id"])
+
+	assert.Equal(t, "bank_transfer", body["payment_type"])
+	assert.Equal(t, map[string]interface{}{"bank": "bca"}, body["bank_transfer"])
+	assert.Equal(t, map[string]interface{}{"order_id": "PAY-20250101-ABCD1234", "gross_amount": 277500.0}, body["transaction_details"])
+	expiry := body["custom_expiry"].(map[string]interface{})
+	assert.Equal(t, 1440.0, expiry["expiry_duration"])
+	assert.Equal(t, "minute", expiry["unit"])
+}
+
+func TestMidtransGateway_CreateCharge_Channels(t *testing.T) {
+	tests := []struct {
+		channel  string
+		response string
+		check    func(t *testing.T, body map[string]interface{}, result *ChargeResult)
+	}{
+		{
+			channel: ChannelQRIS,
+			response: `{"status_code":"201","order_id":"PAY-1","transaction_id":"trx-1","payment_type":"qris","transaction_status":"pending",
+				"qr_string":"00020101021226620014COM.GO-JEK.WWW","actions":[{"name":"generate-qr-code","method":"GET","url":"https://api.midtrans.com/v2/qris/trx-1/qr-code"}]}`,
+			check: func(t *testing.T, body map[string]interface{}, result *ChargeResult) {
+				assert.Equal(t, "qris", body["payment_type"])
+				assert.Equal(t, "00020101021226620014COM.GO-JEK.WWW", result.QRString)
+				assert.Equal(t, "https://api.midtrans.com/v2/qris/trx-1/qr-code", result.QRImageURL)
+			},
+		},
+		{
+			channel:  ChannelMandiri,
+			response: `{"status_code":"201","order_id":"PAY-1","transaction_id":"trx-1","payment_type":"echannel","transaction_status":"pending","bill_key":"990000000260","biller_code":"70012"}`,
+			check: func(t *testing.T, body map[string]interface{}, result *ChargeResult) {
+				assert.Equal(t, "echannel", body["payment_type"])
+				echannel := body["echannel"].(map[string]interface{})
+				assert.Equal(t, "Invoice INV/2025/01/0001 - PT ", echannel["bill_info2"], "cut to 30 runes")
+				assert.Equal(t, "70012", result.BankCode)
+				assert.Equal(t, "990000000260", result.VANumber)
+			},
+		},
+		{
+			channel: ChannelGoPay,
+			response: `{"status_code":"201","order_id":"PAY-1","transaction_id":"trx-1","payment_type":"gopay","transaction_status":"pending","actions":[
+				{"name":"generate-qr-code","method":"GET","url":"https://api.midtrans.com/v2/gopay/trx-1/qr-code"},
+				{"name":"deeplink-redirect","method":"GET","url":"https://simulator.midtrans.com/gopay/partner/app/payment-pin?id=1"}]}`,
+			check: func(t *testing.T, body map[string]interface{}, result *ChargeResult) {
+				assert.Equal(t, "gopay", body["payment_type"])
+				assert.Equal(t, "https://api.midtrans.com/v2/gopay/trx-1/qr-code", result.CheckoutURL)
+				assert.Equal(t, "https://simulator.midtrans.com/gopay/partner/app/payment-pin?id=1", result.DeeplinkURL)
+			},
+		},
+		{
+			channel: ChannelShopeePay,
+			response: `{"status_code":"201","order_id":"PAY-1","transaction_id":"trx-1","payment_type":"shopeepay","transaction_status":"pending","actions":[
+				{"name":"deeplink-redirect","method":"GET","url":"https://wsa.uat.wallet.airpay.co.id/universal-link/wallet/pay?ref=1"}]}`,
+			check: func(t *testing.T, body map[string]interface{}, result *ChargeResult) {
+				assert.Equal(t, "shopeepay", body["payment_type"])
+				assert.Equal(t, result.DeeplinkURL, result.CheckoutURL)
+				assert.NotEmpty(t, result.DeeplinkURL)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			var body map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			result, err := NewMidtransGateway(server.URL, "key").CreateCharge(context.Background(), &ChargeRequest{
+				ReferenceNumber: "PAY-1",
+				Method:          channelMethods[tt.channel],
+				Channel:         tt.channel,
+				Amount:          100000,
+				Description:     "Invoice INV/2025/01/0001 - PT Maju Jaya",
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "PAY-1", result.ExternalID)
+			tt.check(t, body, result)
+		})
+	}
+
+	_, err := NewMidtransGateway("http://127.0.0.1", "key").CreateCharge(context.Background(), &ChargeRequest{Channel: "ovo"})
+	assert.Error(t, err, "OVO is not offered by Midtrans")
+}
+
+func TestMidtransGateway_StatusAndErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/PAY-settled/status":
+			w.Write([]byte(`{"status_code":"200","order_id":"PAY-settled","transaction_status":"settlement","fraud_status":"accept"}`))
+		case "/v2/PAY-challenged/status":
+			w.Write([]byte(`{"status_code":"201","order_id":"PAY-challenged","transaction_status":"capture","fraud_status":"challenge"}`))
+		case "/v2/PAY-1/expire":
+			assert.Equal(t, http.MethodPost, r.Method)
+			w.Write([]byte(`{"status_code":"407","status_message":"Success, transaction is expired","order_id":"PAY-1","transaction_status":"expire"}`))
+		case "/v2/missing/status":
+			w.Write([]byte(`{"status_code":"404","status_message":"Transaction doesn't exist."}`))
+		default:
+			w.Write([]byte(`{"status_code":"400","status_message":"One or more parameters in the payload is invalid.",
+				"validation_messages":["transaction_details.gross_amount is not equal to the sum of item_details"]}`))
+		}
+	}))
+	defer server.Close()
+
+	gateway := NewMidtransGateway(server.URL, "key")
+	ctx := context.Background()
+
+	settled, err := gateway.GetCharge(ctx, "PAY-settled")
+	require.NoError(t, err)
+	assert.Equal(t, ChargeStatusCompleted, settled.Status)
+
+	challenged, err := gateway.GetCharge(ctx, "PAY-challenged")
+	require.NoError(t, err)
+	assert.Equal(t, ChargeStatusPending, challenged.Status, "fraud review is not settled")
+
+	assert.NoError(t, gateway.ExpireCharge(ctx, "PAY-1"))
+
+	_, err = gateway.GetCharge(ctx, "missing")
+	assert.True(t, errors.Is(err, ErrChargeNotFound))
+
+	_, err = gateway.CreateCharge(ctx, &ChargeRequest{Method: MethodQRIS, Channel: ChannelQRIS, Amount: 1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "gross_amount is not equal")
+}
+
+func TestMidtransGateway_ParseNotification(t *testing.T) {
+	gateway := NewMidtransGateway("", "server-key")
+
+	notification := func(signatureKey string) []byte {
+		return []byte(`{"transaction_time":"2025-01-10 10:00:00","transaction_status":"settlement","transaction_id":"tx-1",
+			"status_message":"midtrans payment notification","status_code":"200","signature_key":"` + signatureKey + `",
+			"settlement_time":"2025-01-10 10:05:00","payment_type":"bank_transfer","order_id":"PAY-1","gross_amount":"150000.00",
+			"fraud_status":"accept","va_numbers":[{"bank":"bca","va_number":"12345678901"}]}`)
+	}
+	sum := sha512.Sum512([]byte("PAY-1" + "200" + "150000.00" + "server-key"))
+
+	t.Run("valid signature", func(t *testing.T) {
+		parsed, raw, err := gateway.ParseNotification(http.Header{}, notification(hex.EncodeToString(sum[:])))
+		require.NoError(t, err)
+		assert.Equal(t, "tx-1:settlement", parsed.EventID)
+		assert.Equal(t, "PAY-1", parsed.ExternalID)
+		assert.Equal(t, ChannelBCA, parsed.Channel)
+		assert.Equal(t, ChargeStatusCompleted, parsed.Status)
+		assert.Equal(t, 150000.0, parsed.Amount)
+		assert.Equal(t, "2025-01-10T10:05:00+07:00", parsed.PaidAt)
+		assert.Empty(t, parsed.FailureReason)
+		assert.Equal(t, "tx-1", raw["transaction_id"])
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		_, _, err := gateway.ParseNotification(http.Header{}, notification("deadbeef"))
+		assert.True(t, errors.Is(err, ErrWebhookSignature))
+	})
+
+	t.Run("signed with another server key", func(t *testing.T) {
+		other := NewMidtransGateway("", "other-key")
+		_, _, err := other.ParseNotification(http.Header{}, notification(hex.EncodeToString(sum[:])))
+		assert.True(t, errors.Is(err, ErrWebhookSignature))
+	})
+}
+
+func TestFakeGateway(t *testing.T) {
+	fake := NewFakeGateway()
+	ctx := context.Background()
+
+	charge, err := fake.CreateCharge(ctx, &ChargeRequest{
+		ReferenceNumber: "PAY-1",
+		Method:          MethodEWallet,
+		Channel:         ChannelGoPay,
+		Amount:          100000,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ChargeStatusPending, charge.Status)
+	assert.NotEmpty(t, charge.CheckoutURL)
+
+	require.NoError(t, fake.SetStatus(charge.ExternalID, ChargeStatusCompleted))
+	current, err := fake.GetCharge(ctx, charge.ExternalID)
+	require.NoError(t, err)
+	assert.Equal(t, ChargeStatusCompleted, current.Status)
+
+	// Completed charges are not expired
+	require.NoError(t, fake.ExpireCharge(ctx, charge.ExternalID))
+	current, _ = fake.GetCharge(ctx, charge.ExternalID)
+	assert.Equal(t, ChargeStatusCompleted, current.Status)
+
+	assert.ErrorIs(t, fake.ExpireCharge(ctx, "unknown"), ErrChargeNotFound)
+
+	fake.FailCreate = errors.New("gateway down")
+	_, err = fake.CreateCharge(ctx, &ChargeRequest{Method: MethodQRIS, Channel: ChannelQRIS})
+	assert.Error(t, err)
+}
+
+func TestNewGatewayRegistryFromConfig(t *testing.T) {
+	assert.Empty(t, NewGatewayRegistryFromConfig(&config.Config{}).Channels(MethodQRIS), "no server key")
+
+	registry := NewGatewayRegistryFromConfig(&config.Config{
+		MidtransAPIURL:    MidtransSandboxURL,
+		MidtransServerKey: "SB-Mid-server-key",
+	})
+	assert.Equal(t, []string{ChannelQRIS}, registry.Channels(MethodQRIS))
+	assert.Equal(t, []string{ChannelBCA, ChannelBNI, ChannelBRI, ChannelMandiri}, registry.Channels(MethodBankTransfer))
+	assert.Equal(t, []string{ChannelGoPay, ChannelShopeePay}, registry.Channels(MethodEWallet))
+	gateway, ok := registry.Get(ChannelBCA)
+	require.True(t, ok)
+	assert.Equal(t, MidtransProvider, gateway.Provider())
+	_, ok = registry.Provider(MidtransProvider)
+	assert.True(t, ok)
+	_, ok = registry.Provider(FakeProvider)
+	assert.False(t, ok)
+
+	fake := NewGatewayRegistryFromConfig(&config.Config{PaymentGatewayMode: GatewayModeFake})
+	assert.Len(t, fake.Channels(MethodBankTransfer), 4)
+	assert.Equal(t, []string{ChannelGoPay, ChannelShopeePay}, fake.Channels(MethodEWallet), "fake mode offers the live channels only")
+	_, ok = fake.Provider(FakeProvider)
+	assert.True(t, ok)
+}
+
+func TestNormalizeChargeStatus(t *testing.T) {
+	tests := []struct {
+		status   string
+		expected string
+	}{
+		{"PENDING", ChargeStatusPending},
+		{"ACTIVE", ChargeStatusPending},
+		{"settlement", ChargeStatusCompleted},
+		{"SUCCEEDED", ChargeStatusCompleted},
+		{"EXPIRED", ChargeStatusExpired},
+		{"deny", ChargeStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizeChargeStatus(tt.status))
+		})
+	}
+}
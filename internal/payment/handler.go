@@ -1,11 +1,14 @@
 package payment
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 )
 
 // SuccessResponse represents a success response
@@ -189,6 +192,47 @@ func (h *Handler) GetPaymentInstructions(c *gin.Context) {
 	})
 }
 
+// DownloadInvoicePDF downloads an invoice as PDF
+// @Summary Download invoice PDF
+// @Description Download an e-Faktur style invoice PDF with seller and buyer NPWP, line items, PPN 11% breakdown and payment instructions
+// @Tags payments
+// @Produce application/pdf
+// @Param id path string true "Invoice ID"
+// @Success 200 {file} file
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/invoices/{id}/pdf [get]
+// @Security BearerAuth
+func (h *Handler) DownloadInvoicePDF(c *gin.Context) {
+	invoiceID := c.Param("id")
+	if invoiceID == "" {
+		middleware.AbortWithBadRequest(c, "Invoice ID is required")
+		return
+	}
+
+	// Get company ID from authenticated user context
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "Company ID not found in context")
+		return
+	}
+
+	content, fileName, err := h.service.GetInvoicePDF(c.Request.Context(), invoiceID, companyID.(string))
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to generate invoice PDF", err)
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Data(http.StatusOK, "application/pdf", content)
+}
+
 // GenerateSubscriptionBilling creates automatic billing for subscriptions
 // @Summary Generate subscription billing
 // @Description Generate automatic billing for company subscription with Indonesian PPN 11% tax calculation
@@ -230,67 +274,356 @@ func (h *Handler) GenerateSubscriptionBilling(c *gin.Context) {
 	})
 }
 
-// Legacy endpoints for backward compatibility (not implemented for manual bank transfer)
-// CreateQRISPayment handles QRIS payment creation (not implemented)
-// @Summary Create QRIS payment (Not Implemented)
-// @Description Create QRIS payment - not supported, using manual bank transfer instead
+// CreateQRISPayment creates a dynamic QRIS charge for an invoice
+// @Summary Create QRIS payment
+// @Description Create a dynamic QRIS code for an invoice through the configured QRIS gateway
 // @Tags payments
 // @Accept json
 // @Produce json
-// @Success 501 {object} ErrorResponse
+// @Param request body GatewayPaymentRequest true "Invoice to pay"
+// @Success 201 {object} SuccessResponse{data=GatewayPaymentResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /api/v1/payments/qris [post]
 // @Security BearerAuth
 func (h *Handler) CreateQRISPayment(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"message": "QRIS payment not supported - using manual bank transfer"})
+	h.createGatewayPayment(c, MethodQRIS)
 }
 
-// CreateBankTransfer handles direct bank transfer (not implemented)
-// @Summary Create bank transfer payment (Not Implemented)
-// @Description Create direct bank transfer - not implemented, use invoice generation and manual confirmation
+// CreateBankTransfer creates a virtual account charge for an invoice
+// @Summary Create bank transfer payment
+// @Description Create a virtual account at BCA, Mandiri, BNI or BRI for an invoice
 // @Tags payments
 // @Accept json
 // @Produce json
-// @Success 501 {object} ErrorResponse
+// @Param request body GatewayPaymentRequest true "Invoice to pay and bank channel (bca, mandiri, bni, bri)"
+// @Success 201 {object} SuccessResponse{data=GatewayPaymentResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /api/v1/payments/bank-transfer [post]
 // @Security BearerAuth
 func (h *Handler) CreateBankTransfer(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"message": "Direct bank transfer not implemented - use invoice generation and manual confirmation"})
+	h.createGatewayPayment(c, MethodBankTransfer)
 }
 
-// CreateEWalletPayment handles e-wallet payment (not implemented)
-// @Summary Create e-wallet payment (Not Implemented)
-// @Description Create e-wallet payment - not supported, using manual bank transfer instead
+// CreateEWalletPayment creates an e-wallet checkout for an invoice
+// @Summary Create e-wallet payment
+// @Description Create a GoPay or ShopeePay checkout for an invoice
 // @Tags payments
 // @Accept json
 // @Produce json
-// @Success 501 {object} ErrorResponse
+// @Param request body GatewayPaymentRequest true "Invoice to pay and wallet channel (gopay, shopeepay)"
+// @Success 201 {object} SuccessResponse{data=GatewayPaymentResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /api/v1/payments/e-wallet [post]
 // @Security BearerAuth
 func (h *Handler) CreateEWalletPayment(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"message": "E-wallet payment not supported - using manual bank transfer"})
+	h.createGatewayPayment(c, MethodEWallet)
+}
+
+// createGatewayPayment binds the request and creates a gateway payment
+func (h *Handler) createGatewayPayment(c *gin.Context, method string) {
+	var req GatewayPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	// Get company ID from authenticated user context
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "Company ID not found in context")
+		return
+	}
+
+	req.CompanyID = companyID.(string)
+	req.Method = method
+
+	response, err := h.service.CreateGatewayPayment(c.Request.Context(), &req)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to create payment", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    response,
+	})
+}
+
+// HandleWebhook receives payment notifications from gateways
+// @Summary Payment gateway webhook
+// @Description Receive a payment notification from the gateway a payment was charged with and settle the payment and its invoice. Midtrans notifications are verified by their signature_key; other providers sign with X-Callback-Signature and X-Callback-Timestamp. The notified amount must match the payment. Redelivered events are acknowledged without being applied again.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param provider path string true "Gateway provider (midtrans; fake in development)"
+// @Success 200 {object} SuccessResponse{data=WebhookResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/webhooks/{provider} [post]
+func (h *Handler) HandleWebhook(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		middleware.AbortWithBadRequest(c, "Failed to read webhook body")
+		return
+	}
+
+	result, err := h.service.HandleWebhook(c.Request.Context(), c.Param("provider"), c.Request.Header, body)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to process webhook", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// GetPlans lists the available subscription plans
+// @Summary Get subscription plans
+// @Description List subscription plans with their monthly and yearly prices (IDR, excluding PPN), limits and features
+// @Tags payments
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=[]Plan}
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/payments/plans [get]
+// @Security BearerAuth
+func (h *Handler) GetPlans(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    entitlement.Plans(),
+	})
+}
+
+// GetPlanUsage compares the usage of the authenticated company with its plan
+// @Summary Get plan usage
+// @Description Get the current number of active vehicles, drivers and users of the company next to the limits and features of its plan
+// @Tags payments
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=PlanUsage}
+// @Failure 401 {object} ErrorResponse
+// @Failure 402 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/usage [get]
+// @Security BearerAuth
+func (h *Handler) GetPlanUsage(c *gin.Context) {
+	// Get company ID from authenticated user context
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "Company ID not found in context")
+		return
+	}
+
+	usage, err := h.service.GetPlanUsage(c.Request.Context(), companyID.(string))
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to retrieve plan usage", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    usage,
+	})
 }
 
-// GetSubscriptions handles subscription listing (not implemented)
-// @Summary Get subscriptions (Not Implemented)
-// @Description Get company subscriptions - not implemented yet
+// GetSubscriptions lists the subscriptions of the authenticated company
+// @Summary Get subscriptions
+// @Description Retrieve the subscriptions of the authenticated company, newest first
 // @Tags payments
 // @Produce json
-// @Success 501 {object} ErrorResponse
+// @Param limit query int false "Number of subscriptions to return (default: 20)"
+// @Param offset query int false "Number of subscriptions to skip (default: 0)"
+// @Success 200 {object} SuccessResponse{data=[]models.Subscription}
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /api/v1/payments/subscriptions [get]
 // @Security BearerAuth
 func (h *Handler) GetSubscriptions(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"message": "Subscription listing not implemented yet"})
+	// Get company ID from authenticated user context
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "Company ID not found in context")
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		limit = 20
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil {
+		offset = 0
+	}
+
+	subscriptions, err := h.service.GetSubscriptions(c.Request.Context(), companyID.(string), limit, offset)
+	if err != nil {
+		middleware.AbortWithInternal(c, "Failed to retrieve subscriptions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    subscriptions,
+	})
 }
 
-// CreateSubscription handles subscription creation (not implemented)
-// @Summary Create subscription (Not Implemented)
-// @Description Create new subscription - not implemented yet
+// CreateSubscription subscribes the authenticated company to a plan
+// @Summary Create subscription
+// @Description Subscribe the company to a plan and generate the invoice for the first billing period
 // @Tags payments
 // @Accept json
 // @Produce json
-// @Success 501 {object} ErrorResponse
+// @Param request body CreateSubscriptionRequest true "Plan and billing cycle"
+// @Success 201 {object} SuccessResponse{data=SubscriptionResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /api/v1/payments/subscriptions [post]
 // @Security BearerAuth
 func (h *Handler) CreateSubscription(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"message": "Subscription creation not implemented yet"})
+	var req CreateSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	// Get company ID from authenticated user context
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "Company ID not found in context")
+		return
+	}
+
+	req.CompanyID = companyID.(string)
+
+	response, err := h.service.CreateSubscription(c.Request.Context(), &req)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to create subscription", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"data":    response,
+	})
+}
+
+// ChangeSubscriptionPlan upgrades or downgrades a subscription
+// @Summary Change subscription plan
+// @Description Upgrade or downgrade immediately. The unused time of the current plan is credited: a positive difference is invoiced right away, a negative one is kept as credit for the next invoice. Downgrades are rejected while usage exceeds the new plan limits.
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param request body ChangePlanRequest true "New plan and optional billing cycle"
+// @Success 200 {object} SuccessResponse{data=SubscriptionResponse}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/subscriptions/{id}/change-plan [post]
+// @Security BearerAuth
+func (h *Handler) ChangeSubscriptionPlan(c *gin.Context) {
+	var req ChangePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	// Get company ID from authenticated user context
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "Company ID not found in context")
+		return
+	}
+
+	req.CompanyID = companyID.(string)
+	req.SubscriptionID = c.Param("id")
+
+	response, err := h.service.ChangePlan(c.Request.Context(), &req)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to change subscription plan", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    response,
+	})
+}
+
+// CancelSubscription cancels a subscription at the end of its period
+// @Summary Cancel subscription
+// @Description Cancel a subscription at the end of the current billing period. The subscription stays active until then and is not renewed.
+// @Tags payments
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} SuccessResponse{data=models.Subscription}
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/payments/subscriptions/{id}/cancel [post]
+// @Security BearerAuth
+func (h *Handler) CancelSubscription(c *gin.Context) {
+	// Get company ID from authenticated user context
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "Company ID not found in context")
+		return
+	}
+
+	subscription, err := h.service.CancelSubscription(c.Request.Context(), companyID.(string), c.Param("id"))
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "Failed to cancel subscription", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Subscription will be cancelled at the end of the billing period",
+		"data":    subscription,
+	})
 }
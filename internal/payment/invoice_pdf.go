@@ -0,0 +1,499 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/pdf"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// Page layout of invoice PDFs, in points
+const (
+	invoiceMarginLeft   = 40.0
+	invoiceMarginRight  = pdf.PageWidth - 40.0
+	invoiceMarginTop    = 50.0
+	invoiceMarginBottom = pdf.PageHeight - 70.0
+)
+
+// Columns of the line item table (right edges for numeric columns)
+const (
+	invoiceColNo          = invoiceMarginLeft + 4
+	invoiceColDescription = invoiceMarginLeft + 28
+	invoiceColQtyRight    = 350.0
+	invoiceColPriceRight  = 452.0
+	invoiceColTotalRight  = invoiceMarginRight - 4
+	invoiceDescriptionW   = invoiceColQtyRight - invoiceColDescription - 40
+)
+
+// indonesianMonths are the month names used on invoices
+var indonesianMonths = [...]string{
+	"Januari", "Februari", "Maret", "April", "Mei", "Juni",
+	"Juli", "Agustus", "September", "Oktober", "November", "Desember",
+}
+
+// invoiceIssuer is the seller (Pengusaha Kena Pajak) printed on invoices
+type invoiceIssuer struct {
+	Name    string
+	NPWP    string
+	Address string
+}
+
+// invoiceLineItem is a line of Invoice.Items
+type invoiceLineItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	Total       float64 `json:"total"`
+}
+
+// invoiceIssuer returns the configured invoice seller
+func (s *Service) invoiceIssuer() invoiceIssuer {
+	issuer := invoiceIssuer{
+		Name:    s.cfg.InvoiceIssuerName,
+		NPWP:    s.cfg.InvoiceIssuerNPWP,
+		Address: s.cfg.InvoiceIssuerAddress,
+	}
+	if issuer.Name == "" {
+		issuer.Name = "PT FleetTracker Indonesia"
+	}
+	return issuer
+}
+
+// invoiceLineItems decodes the line items stored on an invoice. Invoices
+// without items get a single line covering the subtotal.
+func invoiceLineItems(invoice *models.Invoice) []invoiceLineItem {
+	var items []invoiceLineItem
+	if raw, ok := invoice.Items["items"]; ok {
+		if encoded, err := json.Marshal(raw); err == nil {
+			_ = json.Unmarshal(encoded, &items)
+		}
+	}
+
+	for i := range items {
+		if items[i].Quantity == 0 {
+			items[i].Quantity = 1
+		}
+		if items[i].Total == 0 {
+			items[i].Total = items[i].Quantity * items[i].UnitPrice
+		}
+	}
+
+	if len(items) == 0 {
+		items = []invoiceLineItem{{
+			Description: "FleetTracker Pro Subscription",
+			Quantity:    1,
+			UnitPrice:   invoice.Subtotal,
+			Total:       invoice.Subtotal,
+		}}
+	}
+	return items
+}
+
+// renderInvoicePDF renders an e-Faktur style invoice
+func renderInvoicePDF(invoice *models.Invoice, company *models.Company, issuer invoiceIssuer, instructions PaymentInstructions) ([]byte, error) {
+	r := &invoiceRenderer{doc: pdf.New()}
+	r.doc.SetTitle(fmt.Sprintf("Faktur %s", invoice.InvoiceNumber))
+	r.newPage()
+
+	r.header(invoice)
+	r.parties(invoice, company, issuer)
+	r.lineItems(invoice)
+	r.totals(invoice)
+	r.payment(invoice, instructions)
+	r.notes(invoice)
+
+	return r.doc.Bytes()
+}
+
+// invoiceRenderer lays out an invoice top to bottom, starting new pages
+// when the remaining space runs out
+type invoiceRenderer struct {
+	doc *pdf.Document
+	y   float64
+}
+
+// newPage starts a page with the electronic document footer
+func (r *invoiceRenderer) newPage() {
+	r.doc.AddPage()
+	r.y = invoiceMarginTop
+
+	r.doc.SetStrokeGray(0.6)
+	r.doc.SetLineWidth(0.5)
+	r.doc.Line(invoiceMarginLeft, invoiceMarginBottom+20, invoiceMarginRight, invoiceMarginBottom+20)
+	r.doc.SetStrokeGray(0)
+
+	r.doc.SetFont(pdf.Helvetica, 7.5)
+	r.doc.SetFillGray(0.35)
+	r.doc.Text(invoiceMarginLeft, invoiceMarginBottom+32, "Dokumen ini dibuat secara elektronik dan sah tanpa tanda tangan basah.")
+	r.doc.Text(invoiceMarginLeft, invoiceMarginBottom+42, "This document is generated electronically and is valid without a wet signature.")
+	r.doc.TextRight(invoiceMarginRight, invoiceMarginBottom+32, fmt.Sprintf("Halaman %d", r.doc.PageCount()))
+	r.doc.SetFillGray(0)
+}
+
+// ensureSpace starts a new page if height does not fit on the current one
+func (r *invoiceRenderer) ensureSpace(height float64) {
+	if r.y+height > invoiceMarginBottom {
+		r.newPage()
+	}
+}
+
+// header draws the title and the invoice number, dates and status
+func (r *invoiceRenderer) header(invoice *models.Invoice) {
+	r.doc.SetFont(pdf.HelveticaBold, 18)
+	r.doc.Text(invoiceMarginLeft, r.y+14, "FAKTUR")
+	r.doc.SetFont(pdf.Helvetica, 10)
+	r.doc.SetFillGray(0.35)
+	r.doc.Text(invoiceMarginLeft, r.y+28, "Invoice")
+	r.doc.SetFillGray(0)
+
+	status := "BELUM LUNAS / UNPAID"
+	if invoice.IsPaid() {
+		status = "LUNAS / PAID"
+	}
+
+	rows := [][2]string{
+		{"Nomor Faktur", invoice.InvoiceNumber},
+		{"Tanggal", formatIndonesianDate(invoice.InvoiceDate)},
+		{"Jatuh Tempo", formatIndonesianDate(invoice.DueDate)},
+		{"Status", status},
+	}
+	y := r.y + 4
+	for _, row := range rows {
+		r.doc.SetFont(pdf.Helvetica, 9)
+		r.doc.Text(360, y, row[0])
+		r.doc.SetFont(pdf.HelveticaBold, 9)
+		r.doc.TextRight(invoiceMarginRight, y, row[1])
+		y += 13
+	}
+
+	r.y = y + 8
+	r.doc.SetLineWidth(1)
+	r.doc.Line(invoiceMarginLeft, r.y, invoiceMarginRight, r.y)
+	r.y += 20
+}
+
+// parties draws the seller and buyer identity blocks side by side
+func (r *invoiceRenderer) parties(invoice *models.Invoice, company *models.Company, issuer invoiceIssuer) {
+	columnWidth := (invoiceMarginRight-invoiceMarginLeft)/2 - 15
+
+	buyerNPWP := invoice.TaxNumber
+	if buyerNPWP == "" {
+		buyerNPWP = company.NPWP
+	}
+	buyerStatus := "Non-PKP"
+	if company.PKP {
+		buyerStatus = "PKP"
+	}
+
+	sellerEnd := r.party(invoiceMarginLeft, columnWidth, "Pengusaha Kena Pajak / Seller", issuer.Name, issuer.Address, []string{
+		"NPWP: " + formatNPWP(issuer.NPWP),
+	})
+	buyerEnd := r.party(invoiceMarginLeft+columnWidth+30, columnWidth, "Pembeli / Buyer", company.Name, company.GetFullAddress(), []string{
+		"NPWP: " + formatNPWP(buyerNPWP),
+		"Status: " + buyerStatus,
+	})
+
+	r.y = math.Max(sellerEnd, buyerEnd) + 10
+	r.doc.SetFont(pdf.Helvetica, 9)
+	r.doc.Text(invoiceMarginLeft, r.y, fmt.Sprintf("Periode Tagihan / Billing Period: %s - %s",
+		formatIndonesianDate(invoice.BillingPeriodStart), formatIndonesianDate(invoice.BillingPeriodEnd)))
+	r.y += 20
+}
+
+// party draws one identity block and returns the y below it
+func (r *invoiceRenderer) party(x, width float64, title, name, address string, extra []string) float64 {
+	y := r.y
+	r.doc.SetFont(pdf.HelveticaBold, 8)
+	r.doc.SetFillGray(0.35)
+	r.doc.Text(x, y, strings.ToUpper(title))
+	r.doc.SetFillGray(0)
+	y += 14
+
+	r.doc.SetFont(pdf.HelveticaBold, 10)
+	for _, line := range r.doc.WrapText(name, width) {
+		r.doc.Text(x, y, line)
+		y += 13
+	}
+
+	r.doc.SetFont(pdf.Helvetica, 9)
+	if strings.TrimSpace(address) != "" {
+		for _, line := range r.doc.WrapText(address, width) {
+			r.doc.Text(x, y, line)
+			y += 12
+		}
+	}
+	for _, line := range extra {
+		r.doc.Text(x, y, line)
+		y += 12
+	}
+	return y
+}
+
+// lineItems draws the item table
+func (r *invoiceRenderer) lineItems(invoice *models.Invoice) {
+	r.tableHeader()
+
+	for i, item := range invoiceLineItems(invoice) {
+		r.doc.SetFont(pdf.Helvetica, 9)
+		lines := r.doc.WrapText(item.Description, invoiceDescriptionW)
+		height := float64(len(lines))*12 + 8
+
+		if r.y+height > invoiceMarginBottom {
+			r.newPage()
+			r.tableHeader()
+			r.doc.SetFont(pdf.Helvetica, 9)
+		}
+
+		baseline := r.y + 13
+		r.doc.Text(invoiceColNo, baseline, strconv.Itoa(i+1))
+		for j, line := range lines {
+			r.doc.Text(invoiceColDescription, baseline+float64(j)*12, line)
+		}
+		r.doc.TextRight(invoiceColQtyRight, baseline, strconv.FormatFloat(item.Quantity, 'f', -1, 64))
+		r.doc.TextRight(invoiceColPriceRight, baseline, formatNumber(item.UnitPrice))
+		r.doc.TextRight(invoiceColTotalRight, baseline, formatNumber(item.Total))
+
+		r.y += height
+		r.doc.SetStrokeGray(0.8)
+		r.doc.SetLineWidth(0.5)
+		r.doc.Line(invoiceMarginLeft, r.y, invoiceMarginRight, r.y)
+		r.doc.SetStrokeGray(0)
+	}
+	r.y += 12
+}
+
+// tableHeader draws the shaded header row of the item table
+func (r *invoiceRenderer) tableHeader() {
+	r.ensureSpace(40)
+	r.doc.FillRect(invoiceMarginLeft, r.y, invoiceMarginRight-invoiceMarginLeft, 20, 0.9)
+
+	baseline := r.y + 13
+	r.doc.SetFont(pdf.HelveticaBold, 8.5)
+	r.doc.Text(invoiceColNo, baseline, "No")
+	r.doc.Text(invoiceColDescription, baseline, "Nama Barang / Jasa Kena Pajak")
+	r.doc.TextRight(invoiceColQtyRight, baseline, "Qty")
+	r.doc.TextRight(invoiceColPriceRight, baseline, "Harga Satuan (Rp)")
+	r.doc.TextRight(invoiceColTotalRight, baseline, "Jumlah (Rp)")
+	r.y += 20
+}
+
+// totals draws the PPN breakdown, the amount in words and the balance
+func (r *invoiceRenderer) totals(invoice *models.Invoice) {
+	rows := [][2]string{
+		{"Harga Jual / Subtotal", formatRupiah(invoice.Subtotal)},
+		{"Dasar Pengenaan Pajak (DPP)", formatRupiah(invoice.Subtotal)},
+		{fmt.Sprintf("PPN %s%%", strconv.FormatFloat(invoice.TaxRate, 'f', -1, 64)), formatRupiah(invoice.TaxAmount)},
+	}
+	r.ensureSpace(float64(len(rows))*14 + 80)
+
+	labelX := 320.0
+	for _, row := range rows {
+		r.doc.SetFont(pdf.Helvetica, 9)
+		r.doc.Text(labelX, r.y, row[0])
+		r.doc.TextRight(invoiceMarginRight, r.y, row[1])
+		r.y += 14
+	}
+
+	r.doc.SetLineWidth(0.75)
+	r.doc.Line(labelX, r.y-9, invoiceMarginRight, r.y-9)
+	r.y += 3
+	r.doc.SetFont(pdf.HelveticaBold, 10.5)
+	r.doc.Text(labelX, r.y, "Total Tagihan")
+	r.doc.TextRight(invoiceMarginRight, r.y, formatRupiah(invoice.TotalAmount))
+	r.y += 16
+
+	if invoice.PaidAmount > 0 {
+		r.doc.SetFont(pdf.Helvetica, 9)
+		r.doc.Text(labelX, r.y, "Dibayar / Paid")
+		r.doc.TextRight(invoiceMarginRight, r.y, formatRupiah(invoice.PaidAmount))
+		r.y += 14
+		r.doc.SetFont(pdf.HelveticaBold, 9)
+		r.doc.Text(labelX, r.y, "Sisa Tagihan / Balance")
+		r.doc.TextRight(invoiceMarginRight, r.y, formatRupiah(math.Max(invoice.BalanceAmount, 0)))
+		r.y += 14
+	}
+
+	r.y += 6
+	r.doc.SetFont(pdf.HelveticaBold, 9)
+	r.doc.Text(invoiceMarginLeft, r.y, "Terbilang:")
+	r.doc.SetFont(pdf.Helvetica, 9)
+	for _, line := range r.doc.WrapText(amountInWords(invoice.TotalAmount), invoiceMarginRight-invoiceMarginLeft-55) {
+		r.doc.Text(invoiceMarginLeft+55, r.y, line)
+		r.y += 12
+	}
+	r.y += 14
+}
+
+// payment draws the bank transfer instructions, or the payment received
+// for paid invoices
+func (r *invoiceRenderer) payment(invoice *models.Invoice, instructions PaymentInstructions) {
+	if invoice.IsPaid() {
+		r.ensureSpace(40)
+		r.doc.SetFont(pdf.HelveticaBold, 10)
+		r.doc.Text(invoiceMarginLeft, r.y, "Pembayaran Diterima / Payment Received")
+		r.y += 14
+		r.doc.SetFont(pdf.Helvetica, 9)
+		received := fmt.Sprintf("Metode: %s", paymentMethodLabel(invoice.PaymentMethod))
+		if invoice.PaymentReference != "" {
+			received += fmt.Sprintf("   Referensi: %s", invoice.PaymentReference)
+		}
+		r.doc.Text(invoiceMarginLeft, r.y, received)
+		r.y += 22
+		return
+	}
+
+	rows := [][2]string{
+		{"Bank", instructions.BankName},
+		{"Nomor Rekening", instructions.AccountNumber},
+		{"Atas Nama", instructions.AccountHolder},
+		{"Kode Referensi", instructions.ReferenceCode},
+		{"Jumlah", instructions.Amount},
+		{"Berita Transfer", instructions.TransferNote},
+	}
+	height := float64(len(rows))*13 + 30
+	r.ensureSpace(height)
+
+	r.doc.SetLineWidth(0.75)
+	r.doc.Rect(invoiceMarginLeft, r.y, invoiceMarginRight-invoiceMarginLeft, height)
+	y := r.y + 16
+	r.doc.SetFont(pdf.HelveticaBold, 10)
+	r.doc.Text(invoiceMarginLeft+10, y, "Instruksi Pembayaran / Payment Instructions")
+	y += 16
+	for _, row := range rows {
+		r.doc.SetFont(pdf.Helvetica, 9)
+		r.doc.Text(invoiceMarginLeft+10, y, row[0])
+		r.doc.SetFont(pdf.HelveticaBold, 9)
+		r.doc.Text(invoiceMarginLeft+110, y, row[1])
+		y += 13
+	}
+	r.y += height + 20
+}
+
+// notes draws the invoice notes and terms
+func (r *invoiceRenderer) notes(invoice *models.Invoice) {
+	sections := [][2]string{
+		{"Catatan / Notes", invoice.Notes},
+		{"Syarat & Ketentuan / Terms", invoice.Terms},
+	}
+	width := invoiceMarginRight - invoiceMarginLeft
+
+	for _, section := range sections {
+		if strings.TrimSpace(section[1]) == "" {
+			continue
+		}
+		r.ensureSpace(30)
+		r.doc.SetFont(pdf.HelveticaBold, 9)
+		r.doc.Text(invoiceMarginLeft, r.y, section[0])
+		r.y += 13
+		r.doc.SetFont(pdf.Helvetica, 8.5)
+		for _, line := range r.doc.WrapText(section[1], width) {
+			r.ensureSpace(12)
+			r.doc.Text(invoiceMarginLeft, r.y, line)
+			r.y += 11
+		}
+		r.y += 10
+	}
+}
+
+// paymentMethodLabel returns a readable name of a payment method
+func paymentMethodLabel(method string) string {
+	switch method {
+	case MethodQRIS:
+		return "QRIS"
+	case MethodBankTransfer:
+		return "Transfer Bank"
+	case MethodEWallet:
+		return "E-Wallet"
+	case "":
+		return "-"
+	default:
+		return method
+	}
+}
+
+// formatRupiah formats an IDR amount (Rp 1.234.567,00)
+func formatRupiah(amount float64) string {
+	return "Rp " + formatNumber(amount)
+}
+
+// formatNPWP formats a 15 digit NPWP as 01.234.567.8-901.000; other values
+// are returned unchanged
+func formatNPWP(npwp string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, npwp)
+
+	switch {
+	case len(digits) == 15:
+		return fmt.Sprintf("%s.%s.%s.%s-%s.%s", digits[0:2], digits[2:5], digits[5:8], digits[8:9], digits[9:12], digits[12:15])
+	case strings.TrimSpace(npwp) == "":
+		return "-"
+	default:
+		return npwp
+	}
+}
+
+// formatIndonesianDate formats a date as "2 Januari 2025"
+func formatIndonesianDate(date time.Time) string {
+	if date.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%d %s %d", date.Day(), indonesianMonths[date.Month()-1], date.Year())
+}
+
+// amountInWords spells out a Rupiah amount in Indonesian ("terbilang")
+func amountInWords(amount float64) string {
+	rupiah := int64(math.Round(math.Abs(amount)))
+	words := "nol"
+	if rupiah > 0 {
+		words = terbilang(rupiah)
+	}
+	if amount < 0 {
+		words = "minus " + words
+	}
+	return strings.ToUpper(words[:1]) + words[1:] + " rupiah"
+}
+
+// terbilangUnits are the Indonesian words for 0-11
+var terbilangUnits = []string{"", "satu", "dua", "tiga", "empat", "lima", "enam", "tujuh", "delapan", "sembilan", "sepuluh", "sebelas"}
+
+// terbilang spells out a positive integer in Indonesian
+func terbilang(n int64) string {
+	var words string
+	switch {
+	case n < 12:
+		words = terbilangUnits[n]
+	case n < 20:
+		words = terbilang(n-10) + " belas"
+	case n < 100:
+		words = terbilang(n/10) + " puluh " + terbilang(n%10)
+	case n < 200:
+		words = "seratus " + terbilang(n-100)
+	case n < 1000:
+		words = terbilang(n/100) + " ratus " + terbilang(n%100)
+	case n < 2000:
+		words = "seribu " + terbilang(n-1000)
+	case n < 1000000:
+		words = terbilang(n/1000) + " ribu " + terbilang(n%1000)
+	case n < 1000000000:
+		words = terbilang(n/1000000) + " juta " + terbilang(n%1000000)
+	case n < 1000000000000:
+		words = terbilang(n/1000000000) + " miliar " + terbilang(n%1000000000)
+	default:
+		words = terbilang(n/1000000000000) + " triliun " + terbilang(n%1000000000000)
+	}
+	return strings.TrimSpace(words)
+}
+
+// invoiceFileName returns the download file name of an invoice
+func invoiceFileName(invoice *models.Invoice) string {
+	return strings.NewReplacer("/", "-", " ", "_").Replace(invoice.InvoiceNumber) + ".pdf"
+}
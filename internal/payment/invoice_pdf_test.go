@@ -0,0 +1,141 @@
+package payment
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+func TestFormatNumber(t *testing.T) {
+	assert.Equal(t, "0,00", formatNumber(0))
+	assert.Equal(t, "999,50", formatNumber(999.5))
+	assert.Equal(t, "277.500,00", formatNumber(277500))
+	assert.Equal(t, "1.234.567,89", formatNumber(1234567.89))
+	assert.Equal(t, "-27.500,00", formatNumber(-27500))
+	assert.Equal(t, "Rp 27.500,00", formatRupiah(27500))
+}
+
+func TestFormatNPWP(t *testing.T) {
+	assert.Equal(t, "01.234.567.8-901.000", formatNPWP("012345678901000"))
+	assert.Equal(t, "01.234.567.8-901.000", formatNPWP("01.234.567.8-901.000"))
+	assert.Equal(t, "1234567890123456", formatNPWP("1234567890123456"))
+	assert.Equal(t, "-", formatNPWP(""))
+}
+
+func TestAmountInWords(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		expected string
+	}{
+		{0, "Nol rupiah"},
+		{11, "Sebelas rupiah"},
+		{15, "Lima belas rupiah"},
+		{100, "Seratus rupiah"},
+		{1000, "Seribu rupiah"},
+		{1115, "Seribu seratus lima belas rupiah"},
+		{277500, "Dua ratus tujuh puluh tujuh ribu lima ratus rupiah"},
+		{1250000, "Satu juta dua ratus lima puluh ribu rupiah"},
+		{2000000000, "Dua miliar rupiah"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, amountInWords(tt.amount))
+		})
+	}
+}
+
+func TestInvoiceLineItems(t *testing.T) {
+	invoice := &models.Invoice{
+		Subtotal: 500000,
+		Items: models.JSON{"items": []interface{}{
+			map[string]interface{}{"description": "Vehicle tracking", "quantity": 2.0, "unit_price": 200000.0},
+			map[string]interface{}{"description": "Driver app", "quantity": 1, "unit_price": 100000.0, "total": 100000.0},
+		}},
+	}
+
+	items := invoiceLineItems(invoice)
+	require.Len(t, items, 2)
+	assert.Equal(t, 400000.0, items[0].Total)
+	assert.Equal(t, 1.0, items[1].Quantity)
+
+	items = invoiceLineItems(&models.Invoice{Subtotal: 250000})
+	require.Len(t, items, 1)
+	assert.Equal(t, 250000.0, items[0].Total)
+}
+
+func TestRenderInvoicePDF(t *testing.T) {
+	invoice := &models.Invoice{
+		InvoiceNumber:      "INV/2025/01/0001",
+		InvoiceDate:        time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+		DueDate:            time.Date(2025, 2, 14, 0, 0, 0, 0, time.UTC),
+		BillingPeriodStart: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		BillingPeriodEnd:   time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+		Subtotal:           250000,
+		TaxRate:            11,
+		TaxAmount:          27500,
+		TotalAmount:        277500,
+		BalanceAmount:      277500,
+		Currency:           "IDR",
+		TaxNumber:          "012345678901000",
+		Terms:              "Payment due within 14 days of invoice date.",
+	}
+	company := &models.Company{Name: "PT Logistik Nusantara", Address: "Jl. Sudirman No. 1", City: "Jakarta", PKP: true}
+	issuer := invoiceIssuer{Name: "PT FleetTracker Indonesia", NPWP: "019876543210000"}
+	instructions := PaymentInstructions{BankName: "Bank Central Asia (BCA)", AccountNumber: "1234567890", Amount: formatRupiah(277500)}
+
+	content, err := renderInvoicePDF(invoice, company, issuer, instructions)
+	require.NoError(t, err)
+	require.True(t, bytes.HasPrefix(content, []byte("%PDF-")))
+
+	text := invoicePDFText(t, content)
+	for _, expected := range []string{
+		"INV/2025/01/0001",
+		"PT Logistik Nusantara",
+		"NPWP: 01.234.567.8-901.000",
+		"NPWP: 01.987.654.3-210.000",
+		"PPN 11%",
+		"Rp 27.500,00",
+		"Rp 277.500,00",
+		"Dua ratus tujuh puluh tujuh ribu lima ratus rupiah",
+		"1234567890",
+		"31 Januari 2025",
+	} {
+		assert.Contains(t, text, expected)
+	}
+
+	assert.Equal(t, "INV-2025-01-0001.pdf", invoiceFileName(invoice))
+}
+
+// invoicePDFText extracts the drawn strings of all pages
+func invoicePDFText(t *testing.T, content []byte) string {
+	t.Helper()
+
+	streams := regexp.MustCompile(`/Length (\d+) /Filter /FlateDecode >>\nstream\n`)
+	strs := regexp.MustCompile(`\(((?:\\.|[^\\)])*)\) Tj`)
+
+	var text strings.Builder
+	for _, match := range streams.FindAllSubmatchIndex(content, -1) {
+		length, err := strconv.Atoi(string(content[match[2]:match[3]]))
+		require.NoError(t, err)
+		reader, err := zlib.NewReader(bytes.NewReader(content[match[1] : match[1]+length]))
+		require.NoError(t, err)
+		page, err := io.ReadAll(reader)
+		require.NoError(t, err)
+
+		for _, s := range strs.FindAllSubmatch(page, -1) {
+			text.WriteString(strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`).Replace(string(s[1])))
+			text.WriteString("\n")
+		}
+	}
+	return text.String()
+}
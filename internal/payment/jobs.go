@@ -0,0 +1,64 @@
+package payment
+
+import (
+	"context"
+	"log"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/jobs"
+)
+
+// PaymentExpiryJob expires pending gateway payments past their expiry time
+type PaymentExpiryJob struct {
+	service *Service
+}
+
+// NewPaymentExpiryJob creates a new payment expiry job handler
+func NewPaymentExpiryJob(service *Service) *PaymentExpiryJob {
+	return &PaymentExpiryJob{service: service}
+}
+
+// GetJobType returns the job type
+func (p *PaymentExpiryJob) GetJobType() string {
+	return "payment_expiry"
+}
+
+// Handle processes payment expiry jobs
+func (p *PaymentExpiryJob) Handle(ctx context.Context, _ *jobs.Job) error {
+	expired, err := p.service.ExpirePendingPayments(ctx)
+	if err != nil {
+		return err
+	}
+
+	if expired > 0 {
+		log.Printf("Expired %d pending payments", expired)
+	}
+	return nil
+}
+
+// SubscriptionRenewalJob renews and invoices subscriptions at the end of their period
+type SubscriptionRenewalJob struct {
+	service *Service
+}
+
+// NewSubscriptionRenewalJob creates a new subscription renewal job handler
+func NewSubscriptionRenewalJob(service *Service) *SubscriptionRenewalJob {
+	return &SubscriptionRenewalJob{service: service}
+}
+
+// GetJobType returns the job type
+func (r *SubscriptionRenewalJob) GetJobType() string {
+	return "subscription_renewal"
+}
+
+// Handle processes subscription renewal jobs
+func (r *SubscriptionRenewalJob) Handle(ctx context.Context, _ *jobs.Job) error {
+	renewed, err := r.service.RenewSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	if renewed > 0 {
+		log.Printf("Renewed %d subscriptions", renewed)
+	}
+	return nil
+}
@@ -2,25 +2,36 @@ package payment
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/config"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/repository"
 	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Service struct {
-	db          *gorm.DB
-	redis       *redis.Client
-	cfg         *config.Config
-	repoManager *repository.RepositoryManager
-	cache       *CacheService
+	db           *gorm.DB
+	redis        *redis.Client
+	cfg          *config.Config
+	repoManager  *repository.RepositoryManager
+	cache        *CacheService
+	gateways     *GatewayRegistry
+	alerter      PaymentAlerter
+	entitlements *entitlement.Service
 }
 
 // CacheService provides caching functionality for payment operations
@@ -391,14 +402,21 @@ func (cs *CacheService) BulkSetPaymentsInCache(ctx context.Context, payments []*
 
 func NewService(db *gorm.DB, redis *redis.Client, cfg *config.Config, repoManager *repository.RepositoryManager) *Service {
 	return &Service{
-		db:          db,
-		redis:       redis,
-		cfg:         cfg,
-		repoManager: repoManager,
-		cache:       NewCacheService(redis),
+		db:           db,
+		redis:        redis,
+		cfg:          cfg,
+		repoManager:  repoManager,
+		cache:        NewCacheService(redis),
+		gateways:     NewGatewayRegistryFromConfig(cfg),
+		entitlements: entitlement.NewService(db),
 	}
 }
 
+// Gateways returns the payment gateway registry
+func (s *Service) Gateways() *GatewayRegistry {
+	return s.gateways
+}
+
 // InvoiceRequest represents a request to create an invoice
 type InvoiceRequest struct {
 	CompanyID      string    `json:"company_id" binding:"required"`
@@ -449,6 +467,33 @@ type SubscriptionBillingRequest struct {
 	EndDate          string `json:"end_date" binding:"required"`
 }
 
+// GatewayPaymentRequest represents a request to pay an invoice through a payment gateway
+type GatewayPaymentRequest struct {
+	InvoiceID     string `json:"invoice_id" binding:"required"`
+	Channel       string `json:"channel"` // bca, mandiri, bni, bri, gopay, shopeepay (qris for QRIS)
+	CustomerPhone string `json:"customer_phone"`
+	CompanyID     string `json:"-"`
+	Method        string `json:"-"`
+}
+
+// GatewayPaymentResponse contains what the customer needs to complete a gateway payment
+type GatewayPaymentResponse struct {
+	PaymentID       string  `json:"payment_id"`
+	InvoiceID       string  `json:"invoice_id"`
+	ReferenceNumber string  `json:"reference_number"`
+	Method          string  `json:"method"`
+	Channel         string  `json:"channel"`
+	Status          string  `json:"status"`
+	Amount          float64 `json:"amount"`
+	ExpiresAt       string  `json:"expires_at"`
+	QRString        string  `json:"qr_string,omitempty"`
+	QRImageURL      string  `json:"qr_image_url,omitempty"`
+	VANumber        string  `json:"va_number,omitempty"`
+	BankCode        string  `json:"bank_code,omitempty"`
+	CheckoutURL     string  `json:"checkout_url,omitempty"`
+	DeeplinkURL     string  `json:"deeplink_url,omitempty"`
+}
+
 // GenerateInvoice creates a new invoice with Indonesian compliance
 func (s *Service) GenerateInvoice(ctx context.Context, req *InvoiceRequest) (*InvoiceResponse, error) {
 	// Get company details for NPWP and tax information
@@ -460,32 +505,68 @@ func (s *Service) GenerateInvoice(ctx context.Context, req *InvoiceRequest) (*In
 		return nil, apperrors.Wrap(err, "failed to get company")
 	}
 
-	// Generate invoice number (Indonesian format: INV/YYYY/MM/XXXX)
-	invoiceNumber := s.generateInvoiceNumber(req.CompanyID)
-
 	// Calculate billing period
 	startDate, endDate, err := s.parseBillingPeriod(req.BillingPeriod)
 	if err != nil {
-		return nil, apperrors.Wrap(err, "failed to parse billing period")
+		return nil, apperrors.NewValidationError(err.Error())
+	}
+
+	// Invoices without a subscription bill the base subscription amount
+	items := []invoiceLineItem{{
+		Description: "FleetTracker Pro Subscription",
+		Quantity:    1,
+		UnitPrice:   defaultSubscriptionAmount,
+		Total:       defaultSubscriptionAmount,
+	}}
+
+	var subscription *models.Subscription
+	if req.SubscriptionID != "" {
+		subscription, err = s.repoManager.GetSubscriptions().GetByID(ctx, req.SubscriptionID)
+		if err != nil || subscription.CompanyID != req.CompanyID {
+			return nil, apperrors.NewNotFoundError("subscription")
+		}
+		items = subscriptionLineItems(subscription, startDate, endDate)
+	}
+
+	response, invoice, err := s.createInvoice(ctx, company, subscription, items, startDate, endDate, req.DueDate, req.Notes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consume the credit that was applied to this invoice
+	if subscription != nil && subscription.CreditBalance > 0 {
+		used := math.Min(subscription.CreditBalance, subscriptionPeriodPrice(subscription))
+		subscription.CreditBalance = roundRupiah(subscription.CreditBalance - used)
+		if err := s.repoManager.GetSubscriptions().Update(ctx, subscription); err != nil {
+			fmt.Printf("Failed to update credit balance of subscription %s after invoice %s: %v\n", subscription.ID, invoice.InvoiceNumber, err)
+		}
 	}
 
-	// Calculate amounts (assuming subscription-based billing)
-	subtotal := 250000.0 // Base subscription amount in IDR
-	taxRate := 11.0      // Indonesian PPN rate
-	taxAmount := subtotal * (taxRate / 100)
+	return response, nil
+}
+
+// createInvoice stores an invoice for the given line items with PPN on the
+// item total and returns the API response with payment instructions and PDF
+func (s *Service) createInvoice(ctx context.Context, company *models.Company, subscription *models.Subscription, items []invoiceLineItem, startDate, endDate, dueDate time.Time, notes string) (*InvoiceResponse, *models.Invoice, error) {
+	// Calculate amounts
+	subtotal := 0.0
+	for _, item := range items {
+		subtotal += item.Total
+	}
+	subtotal = roundRupiah(math.Max(subtotal, 0))
+	taxRate := 11.0 // Indonesian PPN rate
+	taxAmount := roundRupiah(subtotal * (taxRate / 100))
 	totalAmount := subtotal + taxAmount
 
 	// Set due date (default to 14 days from invoice date)
-	dueDate := req.DueDate
 	if dueDate.IsZero() {
 		dueDate = time.Now().AddDate(0, 0, 14)
 	}
 
-	// Create invoice
+	// Create invoice (Indonesian invoice number format: INV/YYYY/MM/XXXX)
 	invoice := &models.Invoice{
-		CompanyID:          req.CompanyID,
-		SubscriptionID:     &req.SubscriptionID,
-		InvoiceNumber:      invoiceNumber,
+		CompanyID:          company.ID,
+		InvoiceNumber:      s.generateInvoiceNumber(),
 		InvoiceDate:        time.Now(),
 		DueDate:            dueDate,
 		BillingPeriodStart: startDate,
@@ -498,37 +579,40 @@ func (s *Service) GenerateInvoice(ctx context.Context, req *InvoiceRequest) (*In
 		TaxNumber:          company.NPWP,
 		TaxRate:            taxRate,
 		Currency:           "IDR",
-		Notes:              req.Notes,
+		Notes:              notes,
 		Terms:              "Payment due within 14 days of invoice date. Late payments may incur additional charges.",
 	}
+	if subscription != nil {
+		invoice.SubscriptionID = &subscription.ID
+	}
 
 	// Create invoice items
-	invoice.Items = models.JSON{
-		"items": []map[string]interface{}{
-			{
-				"description": "FleetTracker Pro Subscription",
-				"quantity":    1,
-				"unit_price":  subtotal,
-				"total":       subtotal,
-			},
-		},
+	lines := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, map[string]interface{}{
+			"description": item.Description,
+			"quantity":    item.Quantity,
+			"unit_price":  item.UnitPrice,
+			"total":       item.Total,
+		})
 	}
+	invoice.Items = models.JSON{"items": lines}
 
 	// Save invoice to database
 	if err := s.repoManager.InvoiceRepository().Create(ctx, invoice); err != nil {
-		return nil, apperrors.Wrap(err, "failed to create invoice")
+		return nil, nil, apperrors.Wrap(err, "failed to create invoice")
 	}
 
 	// Invalidate invoice list cache after creating new invoice
-	if err := s.cache.InvalidateInvoiceListCache(ctx, req.CompanyID); err != nil {
+	if err := s.cache.InvalidateInvoiceListCache(ctx, company.ID); err != nil {
 		// Log cache invalidation error but don't fail the request
-		fmt.Printf("Failed to invalidate invoice list cache %s: %v\n", req.CompanyID, err)
+		fmt.Printf("Failed to invalidate invoice list cache %s: %v\n", company.ID, err)
 	}
 
 	// Generate payment instructions
 	paymentInstructions := s.generatePaymentInstructions(invoice, company)
 
-	// Generate PDF (placeholder - would use actual PDF generation library)
+	// Generate e-Faktur style PDF
 	pdfContent := s.generateInvoicePDF(invoice, company)
 
 	response := &InvoiceResponse{
@@ -542,7 +626,7 @@ func (s *Service) GenerateInvoice(ctx context.Context, req *InvoiceRequest) (*In
 		InvoicePDF:          pdfContent,
 	}
 
-	return response, nil
+	return response, invoice, nil
 }
 
 // ConfirmPayment confirms a manual bank transfer payment
@@ -597,21 +681,7 @@ func (s *Service) ConfirmPayment(ctx context.Context, req *PaymentConfirmationRe
 	}
 
 	// Invalidate caches after payment confirmation
-	if err := s.cache.InvalidateInvoiceCache(ctx, invoice.ID); err != nil {
-		fmt.Printf("Failed to invalidate invoice cache %s: %v\n", invoice.ID, err)
-	}
-	
-	if err := s.cache.InvalidateInvoiceByNumberCache(ctx, invoice.InvoiceNumber); err != nil {
-		fmt.Printf("Failed to invalidate invoice by number cache %s: %v\n", invoice.InvoiceNumber, err)
-	}
-	
-	if err := s.cache.InvalidateInvoiceListCache(ctx, invoice.CompanyID); err != nil {
-		fmt.Printf("Failed to invalidate invoice list cache %s: %v\n", invoice.CompanyID, err)
-	}
-	
-	if err := s.cache.InvalidatePaymentInstructionsCache(ctx, invoice.ID); err != nil {
-		fmt.Printf("Failed to invalidate payment instructions cache %s: %v\n", invoice.ID, err)
-	}
+	s.invalidateInvoiceCaches(ctx, invoice)
 	
 	// Invalidate payment caches if payment was created
 	if payment.ReferenceNumber != "" {
@@ -623,6 +693,187 @@ func (s *Service) ConfirmPayment(ctx context.Context, req *PaymentConfirmationRe
 	return nil
 }
 
+// CreateGatewayPayment creates a pending payment for an invoice and a matching
+// charge with the gateway configured for the requested channel
+func (s *Service) CreateGatewayPayment(ctx context.Context, req *GatewayPaymentRequest) (*GatewayPaymentResponse, error) {
+	channel := strings.ToLower(req.Channel)
+	if channel == "" && req.Method == MethodQRIS {
+		channel = ChannelQRIS
+	}
+	if err := validateChannel(req.Method, channel); err != nil {
+		return nil, apperrors.NewValidationError(err.Error())
+	}
+
+	gateway, ok := s.gateways.Get(channel)
+	if !ok {
+		return nil, apperrors.NewServiceUnavailableError(fmt.Sprintf("payment channel %s is not configured", channel))
+	}
+
+	invoice, err := s.GetInvoice(ctx, req.InvoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.CompanyID != req.CompanyID {
+		return nil, apperrors.NewNotFoundError("invoice")
+	}
+	if invoice.IsPaid() {
+		return nil, apperrors.NewConflictError("invoice is already paid")
+	}
+
+	company, err := s.repoManager.GetCompanies().GetByID(ctx, invoice.CompanyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("company")
+		}
+		return nil, apperrors.Wrap(err, "failed to get company")
+	}
+
+	customerPhone := req.CustomerPhone
+	if customerPhone == "" {
+		customerPhone = company.Phone
+	}
+
+	expiresAt := time.Now().Add(defaultChargeExpiry[req.Method])
+	payment := &models.Payment{
+		CompanyID:       invoice.CompanyID,
+		SubscriptionID:  invoice.SubscriptionID,
+		Amount:          invoice.Subtotal,
+		TaxAmount:       invoice.TaxAmount,
+		TotalAmount:     invoice.TotalAmount,
+		PaymentMethod:   req.Method,
+		PaymentType:     "invoice",
+		Status:          "pending",
+		ReferenceNumber: generatePaymentReference(),
+		ExpiresAt:       &expiresAt,
+	}
+
+	// Create the payment and link it to the invoice while holding the invoice
+	// row, so concurrent requests cannot open two charges that could both be
+	// paid. A charge is only replaced once it has expired at the gateway.
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked models.Invoice
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, "id = ?", invoice.ID).Error; err != nil {
+			return err
+		}
+		if locked.IsPaid() {
+			return apperrors.NewConflictError("invoice is already paid")
+		}
+		if locked.PaymentID != nil {
+			var pending models.Payment
+			err := tx.Where("id = ? AND status = ? AND expires_at > ?", *locked.PaymentID, "pending", time.Now()).
+				First(&pending).Error
+			if err == nil {
+				return apperrors.NewConflictError("invoice already has a pending payment").WithDetails(map[string]interface{}{
+					"payment_id": pending.ID,
+					"expires_at": pending.ExpiresAt,
+				})
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		return tx.Model(&locked).Updates(map[string]interface{}{
+			"payment_id":        payment.ID,
+			"payment_reference": payment.ReferenceNumber,
+		}).Error
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperrors.Wrap(err, "failed to create payment")
+	}
+	invoice.PaymentID = &payment.ID
+	invoice.PaymentReference = payment.ReferenceNumber
+	s.invalidateInvoiceCaches(ctx, invoice)
+
+	charge, err := gateway.CreateCharge(ctx, &ChargeRequest{
+		PaymentID:       payment.ID,
+		ReferenceNumber: payment.ReferenceNumber,
+		Method:          req.Method,
+		Channel:         channel,
+		Amount:          payment.TotalAmount,
+		Currency:        payment.Currency,
+		Description:     fmt.Sprintf("Invoice %s - %s", invoice.InvoiceNumber, company.Name),
+		CustomerName:    company.Name,
+		CustomerEmail:   company.Email,
+		CustomerPhone:   customerPhone,
+		ExpiresAt:       expiresAt,
+	})
+	if err != nil {
+		payment.FailPayment(err.Error())
+		if updateErr := s.repoManager.PaymentRepository().Update(ctx, payment); updateErr != nil {
+			fmt.Printf("Failed to mark payment %s as failed: %v\n", payment.ID, updateErr)
+		}
+		return nil, apperrors.NewServiceUnavailableError("payment gateway is unavailable, please try again").WithInternal(err)
+	}
+
+	applyChargeResult(payment, gateway.Provider(), channel, charge)
+	if err := s.repoManager.PaymentRepository().Update(ctx, payment); err != nil {
+		return nil, apperrors.Wrap(err, "failed to save gateway response")
+	}
+
+	return &GatewayPaymentResponse{
+		PaymentID:       payment.ID,
+		InvoiceID:       invoice.ID,
+		ReferenceNumber: payment.ReferenceNumber,
+		Method:          req.Method,
+		Channel:         channel,
+		Status:          payment.Status,
+		Amount:          payment.TotalAmount,
+		ExpiresAt:       payment.ExpiresAt.Format(time.RFC3339),
+		QRString:        charge.QRString,
+		QRImageURL:      charge.QRImageURL,
+		VANumber:        charge.VANumber,
+		BankCode:        charge.BankCode,
+		CheckoutURL:     charge.CheckoutURL,
+		DeeplinkURL:     charge.DeeplinkURL,
+	}, nil
+}
+
+// ExpirePendingPayments expires gateway payments that are still pending after
+// their expiry time and returns how many were expired
+func (s *Service) ExpirePendingPayments(ctx context.Context) (int, error) {
+	var payments []*models.Payment
+	if err := s.db.WithContext(ctx).
+		Where("status = ? AND expires_at IS NOT NULL AND expires_at < ?", "pending", time.Now()).
+		Limit(500).
+		Find(&payments).Error; err != nil {
+		return 0, apperrors.Wrap(err, "failed to get pending payments")
+	}
+
+	expired := 0
+	for _, payment := range payments {
+		if gateway, ok := s.gateways.Get(paymentChannel(payment)); ok && payment.ExternalID != "" {
+			// A charge paid just before expiry must not be expired locally
+			if charge, err := gateway.GetCharge(ctx, payment.ExternalID); err == nil && charge.Status == ChargeStatusCompleted {
+				fmt.Printf("Payment %s is settled at the gateway, skipping expiry\n", payment.ID)
+				continue
+			}
+			if err := gateway.ExpireCharge(ctx, payment.ExternalID); err != nil && !errors.Is(err, ErrChargeNotFound) {
+				fmt.Printf("Failed to expire charge %s for payment %s: %v\n", payment.ExternalID, payment.ID, err)
+				continue
+			}
+		}
+
+		payment.ExpirePayment()
+		if err := s.repoManager.PaymentRepository().Update(ctx, payment); err != nil {
+			fmt.Printf("Failed to expire payment %s: %v\n", payment.ID, err)
+			continue
+		}
+		if err := s.cache.InvalidatePaymentCache(ctx, payment.ID); err != nil {
+			fmt.Printf("Failed to invalidate payment cache %s: %v\n", payment.ID, err)
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
 // GetInvoice retrieves an individual invoice by ID with caching
 func (s *Service) GetInvoice(ctx context.Context, invoiceID string) (*models.Invoice, error) {
 	// Try to get from cache first
@@ -861,16 +1112,46 @@ func (s *Service) GetPaymentInstructions(ctx context.Context, invoiceID string)
 	return &instructions, nil
 }
 
+// GetInvoicePDF renders the PDF of a company's invoice and returns it with
+// its download file name
+func (s *Service) GetInvoicePDF(ctx context.Context, invoiceID, companyID string) ([]byte, string, error) {
+	invoice, err := s.GetInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, "", err
+	}
+	if invoice.CompanyID != companyID {
+		return nil, "", apperrors.NewNotFoundError("invoice")
+	}
+
+	company, err := s.repoManager.GetCompanies().GetByID(ctx, invoice.CompanyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", apperrors.NewNotFoundError("company")
+		}
+		return nil, "", apperrors.Wrap(err, "failed to get company")
+	}
+
+	content, err := renderInvoicePDF(invoice, company, s.invoiceIssuer(), s.generatePaymentInstructions(invoice, company))
+	if err != nil {
+		return nil, "", apperrors.Wrap(err, "failed to render invoice PDF")
+	}
+
+	return content, invoiceFileName(invoice), nil
+}
+
 // GenerateSubscriptionBilling creates automatic billing for subscriptions
 func (s *Service) GenerateSubscriptionBilling(ctx context.Context, req *SubscriptionBillingRequest) error {
 	// Get subscription
-	_, err := s.repoManager.GetSubscriptions().GetByID(ctx, req.SubscriptionID)
+	subscription, err := s.repoManager.GetSubscriptions().GetByID(ctx, req.SubscriptionID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return apperrors.NewNotFoundError("subscription")
 		}
 		return apperrors.Wrap(err, "failed to get subscription")
 	}
+	if subscription.CompanyID != req.CompanyID {
+		return apperrors.NewNotFoundError("subscription")
+	}
 
 	// Parse dates
 	_, err = time.Parse("2006-01-02", req.StartDate)
@@ -902,30 +1183,143 @@ func (s *Service) GenerateSubscriptionBilling(ctx context.Context, req *Subscrip
 
 // Helper methods
 
-// generateInvoiceNumber creates Indonesian-style invoice number
-func (s *Service) generateInvoiceNumber(companyID string) string {
+// invalidateInvoiceCaches removes all cached views of an invoice
+func (s *Service) invalidateInvoiceCaches(ctx context.Context, invoice *models.Invoice) {
+	if err := s.cache.InvalidateInvoiceCache(ctx, invoice.ID); err != nil {
+		fmt.Printf("Failed to invalidate invoice cache %s: %v\n", invoice.ID, err)
+	}
+	
+	if err := s.cache.InvalidateInvoiceByNumberCache(ctx, invoice.InvoiceNumber); err != nil {
+		fmt.Printf("Failed to invalidate invoice by number cache %s: %v\n", invoice.InvoiceNumber, err)
+	}
+	
+	if err := s.cache.InvalidateInvoiceListCache(ctx, invoice.CompanyID); err != nil {
+		fmt.Printf("Failed to invalidate invoice list cache %s: %v\n", invoice.CompanyID, err)
+	}
+	
+	if err := s.cache.InvalidatePaymentInstructionsCache(ctx, invoice.ID); err != nil {
+		fmt.Printf("Failed to invalidate payment instructions cache %s: %v\n", invoice.ID, err)
+	}
+}
+
+// applyChargeResult stores the gateway response on the payment
+func applyChargeResult(payment *models.Payment, provider, channel string, charge *ChargeResult) {
+	payment.ExternalID = charge.ExternalID
+	payment.TransactionID = charge.TransactionID
+	if !charge.ExpiresAt.IsZero() {
+		expiresAt := charge.ExpiresAt
+		payment.ExpiresAt = &expiresAt
+	}
+
+	payment.GatewayResponse = models.JSON{
+		"provider": provider,
+		"channel":  channel,
+		"status":   charge.Status,
+		"response": charge.RawResponse,
+	}
+
+	expiresAt := ""
+	if payment.ExpiresAt != nil {
+		expiresAt = payment.ExpiresAt.Format(time.RFC3339)
+	}
+
+	switch payment.PaymentMethod {
+	case MethodQRIS:
+		payment.SetQRISData(map[string]interface{}{
+			"qr_string":    charge.QRString,
+			"qr_image_url": charge.QRImageURL,
+			"expires_at":   expiresAt,
+		})
+	case MethodBankTransfer:
+		payment.SetBankTransferData(map[string]interface{}{
+			"bank":       channel,
+			"bank_code":  charge.BankCode,
+			"va_number":  charge.VANumber,
+			"expires_at": expiresAt,
+		})
+	case MethodEWallet:
+		payment.SetEWalletData(map[string]interface{}{
+			"wallet":       channel,
+			"checkout_url": charge.CheckoutURL,
+			"deeplink_url": charge.DeeplinkURL,
+			"expires_at":   expiresAt,
+		})
+	}
+}
+
+// paymentChannel returns the gateway channel a payment was created with
+func paymentChannel(payment *models.Payment) string {
+	if payment.GatewayResponse == nil {
+		return ""
+	}
+	channel, _ := payment.GatewayResponse["channel"].(string)
+	return channel
+}
+
+// paymentProvider returns the gateway provider a payment was charged with
+func paymentProvider(payment *models.Payment) string {
+	if payment.GatewayResponse == nil {
+		return ""
+	}
+	provider, _ := payment.GatewayResponse["provider"].(string)
+	return provider
+}
+
+// generatePaymentReference creates a unique payment reference (PAY-YYYYMMDD-XXXXXXXX)
+func generatePaymentReference() string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("PAY-%s-%08d", time.Now().Format("20060102"), time.Now().UnixNano()%100000000)
+	}
+	return fmt.Sprintf("PAY-%s-%s", time.Now().Format("20060102"), strings.ToUpper(hex.EncodeToString(suffix)))
+}
+
+// generateInvoiceNumber creates Indonesian-style invoice number. The
+// sequence runs per month across all companies since FleetTracker is the
+// issuer of every invoice.
+func (s *Service) generateInvoiceNumber() string {
 	now := time.Now()
-	year := now.Year()
-	month := int(now.Month())
+	prefix := fmt.Sprintf("INV/%d/%02d/", now.Year(), int(now.Month()))
 	
 	// Get next sequence number for this month
 	var count int64
 	s.db.Model(&models.Invoice{}).
-		Where("company_id = ? AND EXTRACT(year FROM created_at) = ? AND EXTRACT(month FROM created_at) = ?", 
-			companyID, year, month).
+		Where("invoice_number LIKE ?", prefix+"%").
 		Count(&count)
 	
 	sequence := count + 1
-	return fmt.Sprintf("INV/%d/%02d/%04d", year, month, sequence)
+	return fmt.Sprintf("%s%04d", prefix, sequence)
 }
 
-// parseBillingPeriod parses billing period string
-func (s *Service) parseBillingPeriod(_ string) (time.Time, time.Time, error) {
-	// Simple parsing - can be enhanced
-	now := time.Now()
-	startDate := now.AddDate(0, -1, 0) // Last month
-	endDate := now
-	return startDate, endDate, nil
+// parseBillingPeriod parses a billing period: "YYYY-MM" for a calendar month
+// or "YYYY-MM-DD to YYYY-MM-DD". An empty period means the last month.
+func (s *Service) parseBillingPeriod(period string) (time.Time, time.Time, error) {
+	period = strings.TrimSpace(period)
+	if period == "" {
+		now := time.Now()
+		return now.AddDate(0, -1, 0), now, nil
+	}
+
+	if month, err := time.ParseInLocation("2006-01", period, time.Local); err == nil {
+		return month, month.AddDate(0, 1, -1), nil
+	}
+
+	if start, end, found := strings.Cut(period, " to "); found {
+		startDate, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(start), time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid billing period start %q", start)
+		}
+		endDate, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(end), time.Local)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid billing period end %q", end)
+		}
+		if endDate.Before(startDate) {
+			return time.Time{}, time.Time{}, fmt.Errorf("billing period ends before it starts")
+		}
+		return startDate, endDate, nil
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid billing period %q: use YYYY-MM or YYYY-MM-DD to YYYY-MM-DD", period)
 }
 
 // generatePaymentInstructions creates bank transfer instructions
@@ -948,14 +1342,33 @@ func (s *Service) generatePaymentInstructions(invoice *models.Invoice, company *
 	}
 }
 
-// generateInvoicePDF creates PDF content (placeholder)
-func (s *Service) generateInvoicePDF(_ *models.Invoice, _ *models.Company) string {
-	// This would use a PDF generation library like gofpdf
-	// For now, return a placeholder
-	return "PDF_CONTENT_PLACEHOLDER"
+// generateInvoicePDF renders the invoice PDF as base64
+func (s *Service) generateInvoicePDF(invoice *models.Invoice, company *models.Company) string {
+	content, err := renderInvoicePDF(invoice, company, s.invoiceIssuer(), s.generatePaymentInstructions(invoice, company))
+	if err != nil {
+		fmt.Printf("Failed to render invoice PDF %s: %v\n", invoice.InvoiceNumber, err)
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(content)
 }
 
-// formatNumber formats number with Indonesian formatting
+// formatNumber formats number with Indonesian formatting (1.234.567,89)
 func formatNumber(num float64) string {
-	return fmt.Sprintf("%.2f", num)
+	sign := ""
+	if num < 0 {
+		sign = "-"
+		num = -num
+	}
+
+	formatted := strconv.FormatFloat(num, 'f', 2, 64)
+	integer, fraction := formatted[:len(formatted)-3], formatted[len(formatted)-2:]
+
+	var b strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte('.')
+		}
+		b.WriteRune(digit)
+	}
+	return sign + b.String() + "," + fraction
 }
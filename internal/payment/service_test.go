@@ -2,6 +2,9 @@ package payment
 
 import (
 	"context"
+	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,8 +12,11 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/config"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/database"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/repository"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
 
 func TestService_GenerateInvoice(t *testing.T) {
@@ -450,3 +456,389 @@ func TestService_DueDateCalculation(t *testing.T) {
 	})
 }
 
+
+func TestService_CreateGatewayPayment(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	cfg := &config.Config{PaymentGatewayMode: GatewayModeFake}
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	repoManager := repository.NewRepositoryManager(db)
+	service := NewService(db, redisClient, cfg, repoManager)
+
+	// Create test company
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	ctx := context.Background()
+
+	invoiceResp, err := service.GenerateInvoice(ctx, &InvoiceRequest{
+		CompanyID:     company.ID,
+		BillingPeriod: "2025-01",
+		DueDate:       time.Now().AddDate(0, 0, 30),
+	})
+	require.NoError(t, err)
+
+	t.Run("virtual account", func(t *testing.T) {
+		resp, err := service.CreateGatewayPayment(ctx, &GatewayPaymentRequest{
+			InvoiceID: invoiceResp.InvoiceID,
+			Channel:   "BCA",
+			CompanyID: company.ID,
+			Method:    MethodBankTransfer,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "pending", resp.Status)
+		assert.Equal(t, ChannelBCA, resp.Channel)
+		assert.NotEmpty(t, resp.VANumber)
+		assert.Equal(t, invoiceResp.TotalAmount, resp.Amount)
+
+		payment, err := service.GetPayment(ctx, resp.PaymentID)
+		require.NoError(t, err)
+		assert.NotEmpty(t, payment.ExternalID)
+		assert.Equal(t, ChannelBCA, payment.GatewayResponse["channel"])
+		assert.Equal(t, resp.VANumber, payment.BankTransfer["va_number"])
+	})
+
+	t.Run("second pending charge for the invoice", func(t *testing.T) {
+		_, err := service.CreateGatewayPayment(ctx, &GatewayPaymentRequest{
+			InvoiceID: invoiceResp.InvoiceID,
+			Channel:   ChannelGoPay,
+			CompanyID: company.ID,
+			Method:    MethodEWallet,
+		})
+		require.Error(t, err)
+		appErr, ok := err.(*apperrors.AppError)
+		require.True(t, ok)
+		assert.Equal(t, http.StatusConflict, appErr.Status)
+	})
+
+	t.Run("QRIS defaults its channel", func(t *testing.T) {
+		other, err := service.GenerateInvoice(ctx, &InvoiceRequest{
+			CompanyID:     company.ID,
+			BillingPeriod: "2025-02",
+			DueDate:       time.Now().AddDate(0, 0, 30),
+		})
+		require.NoError(t, err)
+
+		resp, err := service.CreateGatewayPayment(ctx, &GatewayPaymentRequest{
+			InvoiceID: other.InvoiceID,
+			CompanyID: company.ID,
+			Method:    MethodQRIS,
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.QRString)
+	})
+
+	t.Run("channel of another method", func(t *testing.T) {
+		_, err := service.CreateGatewayPayment(ctx, &GatewayPaymentRequest{
+			InvoiceID: invoiceResp.InvoiceID,
+			Channel:   ChannelGoPay,
+			CompanyID: company.ID,
+			Method:    MethodBankTransfer,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("invoice of another company", func(t *testing.T) {
+		_, err := service.CreateGatewayPayment(ctx, &GatewayPaymentRequest{
+			InvoiceID: invoiceResp.InvoiceID,
+			Channel:   ChannelShopeePay,
+			CompanyID: "00000000-0000-0000-0000-000000000000",
+			Method:    MethodEWallet,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("expire pending payments", func(t *testing.T) {
+		require.NoError(t, db.Model(&models.Payment{}).
+			Where("company_id = ? AND status = ?", company.ID, "pending").
+			Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		expired, err := service.ExpirePendingPayments(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, expired)
+	})
+}
+
+type recordingAlerter struct {
+	invoiceIDs []string
+}
+
+func (r *recordingAlerter) CreatePaymentReceivedAlert(_ context.Context, _, invoiceID string, _ float64) error {
+	r.invoiceIDs = append(r.invoiceIDs, invoiceID)
+	return nil
+}
+
+func TestService_HandleWebhook(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	cfg := &config.Config{
+		Environment:           "development",
+		PaymentGatewayMode:    GatewayModeFake,
+		PaymentWebhookSecrets: map[string]string{FakeProvider: "whsec_test"},
+	}
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	repoManager := repository.NewRepositoryManager(db)
+	service := NewService(db, redisClient, cfg, repoManager)
+	alerter := &recordingAlerter{}
+	service.SetAlerter(alerter)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	ctx := context.Background()
+
+	invoiceResp, err := service.GenerateInvoice(ctx, &InvoiceRequest{
+		CompanyID:     company.ID,
+		BillingPeriod: "2025-01",
+		DueDate:       time.Now().AddDate(0, 0, 30),
+	})
+	require.NoError(t, err)
+
+	resp, err := service.CreateGatewayPayment(ctx, &GatewayPaymentRequest{
+		InvoiceID: invoiceResp.InvoiceID,
+		CompanyID: company.ID,
+		Method:    MethodQRIS,
+	})
+	require.NoError(t, err)
+
+	payment, err := service.GetPayment(ctx, resp.PaymentID)
+	require.NoError(t, err)
+
+	body := []byte(`{"event_id":"evt_001","id":"` + payment.ExternalID + `","status":"PAID","amount":` +
+		strconv.FormatFloat(payment.TotalAmount, 'f', 2, 64) + `}`)
+
+	t.Run("invalid signature", func(t *testing.T) {
+		_, err := service.HandleWebhook(ctx, FakeProvider, signedWebhookHeader("wrong", time.Now(), body), body)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		_, err := service.HandleWebhook(ctx, MidtransProvider, signedWebhookHeader("whsec_test", time.Now(), body), body)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*apperrors.AppError).Status)
+	})
+
+	t.Run("fake provider outside development", func(t *testing.T) {
+		production := NewService(db, redisClient, &config.Config{
+			Environment:           "production",
+			PaymentGatewayMode:    GatewayModeFake,
+			PaymentWebhookSecrets: map[string]string{FakeProvider: "whsec_test"},
+		}, repoManager)
+		_, err := production.HandleWebhook(ctx, FakeProvider, signedWebhookHeader("whsec_test", time.Now(), body), body)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, err.(*apperrors.AppError).Status)
+	})
+
+	t.Run("channel of another payment", func(t *testing.T) {
+		other := []byte(`{"event_id":"evt_channel","id":"` + payment.ExternalID + `","channel":"bca","status":"PAID","amount":` +
+			strconv.FormatFloat(payment.TotalAmount, 'f', 2, 64) + `}`)
+		_, err := service.HandleWebhook(ctx, FakeProvider, signedWebhookHeader("whsec_test", time.Now(), other), other)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, err.(*apperrors.AppError).Status)
+	})
+
+	t.Run("paid notification without amount does not settle", func(t *testing.T) {
+		noAmount := []byte(`{"event_id":"evt_no_amount","id":"` + payment.ExternalID + `","status":"PAID"}`)
+		result, err := service.HandleWebhook(ctx, FakeProvider, signedWebhookHeader("whsec_test", time.Now(), noAmount), noAmount)
+		require.NoError(t, err)
+		assert.Equal(t, WebhookResultAmountMismatch, result.Result)
+
+		var pending models.Payment
+		require.NoError(t, db.First(&pending, "id = ?", payment.ID).Error)
+		assert.Equal(t, "pending", pending.Status)
+	})
+
+	t.Run("settles payment and invoice", func(t *testing.T) {
+		result, err := service.HandleWebhook(ctx, FakeProvider, signedWebhookHeader("whsec_test", time.Now(), body), body)
+		require.NoError(t, err)
+		assert.Equal(t, WebhookResultSettled, result.Result)
+		assert.False(t, result.Duplicate)
+
+		var settled models.Payment
+		require.NoError(t, db.First(&settled, "id = ?", payment.ID).Error)
+		assert.Equal(t, "completed", settled.Status)
+
+		var invoice models.Invoice
+		require.NoError(t, db.First(&invoice, "id = ?", invoiceResp.InvoiceID).Error)
+		assert.Equal(t, "paid", invoice.Status)
+		assert.Equal(t, []string{invoiceResp.InvoiceID}, alerter.invoiceIDs)
+	})
+
+	t.Run("duplicate delivery is not applied twice", func(t *testing.T) {
+		result, err := service.HandleWebhook(ctx, FakeProvider, signedWebhookHeader("whsec_test", time.Now(), body), body)
+		require.NoError(t, err)
+		assert.True(t, result.Duplicate)
+
+		var invoice models.Invoice
+		require.NoError(t, db.First(&invoice, "id = ?", invoiceResp.InvoiceID).Error)
+		assert.Equal(t, invoiceResp.TotalAmount, invoice.PaidAmount)
+		assert.Len(t, alerter.invoiceIDs, 1)
+	})
+}
+
+func TestService_GetInvoicePDF(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	cfg := &config.Config{}
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	repoManager := repository.NewRepositoryManager(db)
+	service := NewService(db, redisClient, cfg, repoManager)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	ctx := context.Background()
+
+	invoiceResp, err := service.GenerateInvoice(ctx, &InvoiceRequest{
+		CompanyID:     company.ID,
+		BillingPeriod: "2025-01",
+		DueDate:       time.Now().AddDate(0, 0, 30),
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, invoiceResp.InvoicePDF)
+
+	t.Run("own invoice", func(t *testing.T) {
+		content, fileName, err := service.GetInvoicePDF(ctx, invoiceResp.InvoiceID, company.ID)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(content), "%PDF-"))
+		assert.True(t, strings.HasSuffix(fileName, ".pdf"))
+		assert.NotContains(t, fileName, "/")
+	})
+
+	t.Run("invoice of another company", func(t *testing.T) {
+		_, _, err := service.GetInvoicePDF(ctx, invoiceResp.InvoiceID, "00000000-0000-0000-0000-000000000000")
+		assert.Error(t, err)
+	})
+}
+
+func TestService_SubscriptionLifecycle(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	cfg := &config.Config{}
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	repoManager := repository.NewRepositoryManager(db)
+	service := NewService(db, redisClient, cfg, repoManager)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	ctx := context.Background()
+
+	created, err := service.CreateSubscription(ctx, &CreateSubscriptionRequest{
+		CompanyID: company.ID,
+		PlanName:  entitlement.PlanBasic,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, created.Invoice)
+	assert.Equal(t, 250000.0, created.Invoice.Subtotal)
+	assert.Equal(t, 10, created.Subscription.MaxVehicles)
+	subscriptionID := created.Subscription.ID
+
+	t.Run("second active subscription is rejected", func(t *testing.T) {
+		_, err := service.CreateSubscription(ctx, &CreateSubscriptionRequest{CompanyID: company.ID, PlanName: entitlement.PlanProfessional})
+		assert.Error(t, err)
+	})
+
+	t.Run("upgrade invoices the prorated difference", func(t *testing.T) {
+		changed, err := service.ChangePlan(ctx, &ChangePlanRequest{
+			CompanyID:      company.ID,
+			SubscriptionID: subscriptionID,
+			PlanName:       entitlement.PlanProfessional,
+		})
+		require.NoError(t, err)
+		require.NotNil(t, changed.Invoice)
+		assert.Greater(t, changed.Proration.Net, 0.0)
+		assert.Equal(t, changed.Proration.Net, changed.Invoice.Subtotal)
+		assert.Equal(t, 50, changed.Subscription.MaxVehicles)
+
+		var tier string
+		require.NoError(t, db.Model(&models.Company{}).Where("id = ?", company.ID).Pluck("subscription_tier", &tier).Error)
+		assert.Equal(t, entitlement.PlanProfessional, tier)
+	})
+
+	t.Run("downgrade credits the difference", func(t *testing.T) {
+		changed, err := service.ChangePlan(ctx, &ChangePlanRequest{
+			CompanyID:      company.ID,
+			SubscriptionID: subscriptionID,
+			PlanName:       entitlement.PlanBasic,
+		})
+		require.NoError(t, err)
+		assert.Nil(t, changed.Invoice)
+		assert.Less(t, changed.Proration.Net, 0.0)
+		assert.Equal(t, -changed.Proration.Net, changed.Subscription.CreditBalance)
+	})
+
+	t.Run("subscription of another company", func(t *testing.T) {
+		_, err := service.CancelSubscription(ctx, "00000000-0000-0000-0000-000000000000", subscriptionID)
+		assert.Error(t, err)
+	})
+
+	t.Run("cancel at period end", func(t *testing.T) {
+		cancelled, err := service.CancelSubscription(ctx, company.ID, subscriptionID)
+		require.NoError(t, err)
+		assert.True(t, cancelled.CancelAtPeriodEnd)
+		assert.False(t, cancelled.AutoRenew)
+		assert.True(t, cancelled.IsActive)
+
+		_, err = service.CancelSubscription(ctx, company.ID, subscriptionID)
+		assert.Error(t, err)
+	})
+
+	t.Run("renewal closes cancelled subscriptions", func(t *testing.T) {
+		require.NoError(t, db.Model(&models.Subscription{}).Where("id = ?", subscriptionID).
+			Update("end_date", time.Now().Add(-time.Hour)).Error)
+
+		renewed, err := service.RenewSubscriptions(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, renewed)
+
+		var subscription models.Subscription
+		require.NoError(t, db.First(&subscription, "id = ?", subscriptionID).Error)
+		assert.Equal(t, "cancelled", subscription.Status)
+		assert.False(t, subscription.IsActive)
+	})
+}
+
+func TestService_RenewSubscriptions(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	cfg := &config.Config{}
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	repoManager := repository.NewRepositoryManager(db)
+	service := NewService(db, redisClient, cfg, repoManager)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	ctx := context.Background()
+
+	created, err := service.CreateSubscription(ctx, &CreateSubscriptionRequest{CompanyID: company.ID, PlanName: entitlement.PlanBasic})
+	require.NoError(t, err)
+
+	endDate := time.Now().Add(time.Hour).Truncate(time.Second)
+	require.NoError(t, db.Model(&models.Subscription{}).Where("id = ?", created.Subscription.ID).
+		Update("end_date", endDate).Error)
+
+	renewed, err := service.RenewSubscriptions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, renewed)
+
+	// A second run in the same period does nothing
+	renewed, err = service.RenewSubscriptions(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, renewed)
+
+	var subscription models.Subscription
+	require.NoError(t, db.First(&subscription, "id = ?", created.Subscription.ID).Error)
+	assert.True(t, subscription.StartDate.Equal(endDate))
+	assert.True(t, subscription.EndDate.Equal(endDate.AddDate(0, 1, 0)))
+
+	var invoices int64
+	require.NoError(t, db.Model(&models.Invoice{}).Where("subscription_id = ?", subscription.ID).Count(&invoices).Error)
+	assert.Equal(t, int64(2), invoices)
+}
@@ -0,0 +1,476 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/repository"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// defaultSubscriptionAmount is billed by invoices that are not tied to a subscription
+const defaultSubscriptionAmount = 250000.0
+
+// subscriptionRenewalLead is how long before the end of a period the next
+// period is started and invoiced, so access never lapses between job runs
+const subscriptionRenewalLead = 24 * time.Hour
+
+// CreateSubscriptionRequest represents a request to subscribe to a plan
+type CreateSubscriptionRequest struct {
+	PlanName  string `json:"plan_name" binding:"required"` // basic, professional, enterprise
+	PlanType  string `json:"plan_type"`                    // monthly (default) or yearly
+	AutoRenew *bool  `json:"auto_renew"`                   // defaults to true
+	CompanyID string `json:"-"`
+}
+
+// ChangePlanRequest represents a mid-cycle upgrade or downgrade
+type ChangePlanRequest struct {
+	PlanName       string `json:"plan_name" binding:"required"`
+	PlanType       string `json:"plan_type"` // keeps the current billing cycle when empty
+	CompanyID      string `json:"-"`
+	SubscriptionID string `json:"-"`
+}
+
+// SubscriptionResponse contains a subscription and the invoice a change produced
+type SubscriptionResponse struct {
+	Subscription *models.Subscription `json:"subscription"`
+	Invoice      *InvoiceResponse     `json:"invoice,omitempty"`
+	Proration    *Proration           `json:"proration,omitempty"`
+}
+
+// Proration is the settlement of a plan change for the rest of the period
+type Proration struct {
+	RemainingDays int       `json:"remaining_days"`
+	Credit        float64   `json:"credit"` // unused value of the current plan
+	Charge        float64   `json:"charge"` // value of the new plan for the remaining period
+	Net           float64   `json:"net"`    // invoiced when positive, credited when negative
+	PeriodStart   time.Time `json:"period_start"`
+	PeriodEnd     time.Time `json:"period_end"`
+}
+
+// PlanUsage compares the resources a company uses with its entitlements
+type PlanUsage struct {
+	*entitlement.Entitlements
+	Usage *entitlement.Usage `json:"usage"`
+}
+
+// GetSubscriptions lists the subscriptions of a company, newest first
+func (s *Service) GetSubscriptions(ctx context.Context, companyID string, limit, offset int) ([]*models.Subscription, error) {
+	subscriptions, err := s.repoManager.GetSubscriptions().GetByCompany(ctx, companyID, repository.Pagination{Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to get subscriptions")
+	}
+	return subscriptions, nil
+}
+
+// CreateSubscription subscribes a company to a plan and invoices the first period
+func (s *Service) CreateSubscription(ctx context.Context, req *CreateSubscriptionRequest) (*SubscriptionResponse, error) {
+	plan, ok := entitlement.GetPlan(req.PlanName)
+	if !ok {
+		return nil, apperrors.NewValidationError(fmt.Sprintf("unknown plan %q", req.PlanName))
+	}
+	planType, err := normalizePlanType(req.PlanType, entitlement.BillingMonthly)
+	if err != nil {
+		return nil, apperrors.NewValidationError(err.Error())
+	}
+
+	if _, err := s.repoManager.GetSubscriptions().GetCompanyActiveSubscription(ctx, req.CompanyID); err == nil {
+		return nil, apperrors.NewConflictError("company already has an active subscription, change its plan instead")
+	}
+
+	company, err := s.repoManager.GetCompanies().GetByID(ctx, req.CompanyID)
+	if err != nil {
+		return nil, apperrors.NewNotFoundError("company")
+	}
+
+	autoRenew := true
+	if req.AutoRenew != nil {
+		autoRenew = *req.AutoRenew
+	}
+
+	now := time.Now()
+	months := renewalMonths(planType)
+	subscription := &models.Subscription{
+		CompanyID:     company.ID,
+		Status:        "active",
+		IsActive:      true,
+		StartDate:     now,
+		EndDate:       now.AddDate(0, months, 0),
+		AutoRenew:     autoRenew,
+		RenewalPeriod: months,
+		Currency:      "IDR",
+		TaxRate:       11.0,
+	}
+	applyPlan(subscription, plan, planType)
+	subscription.NextBillingDate = subscription.EndDate
+
+	if err := s.repoManager.GetSubscriptions().Create(ctx, subscription); err != nil {
+		return nil, apperrors.Wrap(err, "failed to create subscription")
+	}
+	if !autoRenew {
+		// gorm skips zero values of columns with a default, store it explicitly
+		if err := s.db.WithContext(ctx).Model(subscription).Update("auto_renew", false).Error; err != nil {
+			return nil, apperrors.Wrap(err, "failed to disable auto renewal")
+		}
+	}
+
+	s.updateCompanyTier(ctx, company, plan.Name)
+
+	invoice, _, err := s.createInvoice(ctx, company, subscription,
+		subscriptionLineItems(subscription, subscription.StartDate, subscription.EndDate),
+		subscription.StartDate, subscription.EndDate, time.Time{},
+		fmt.Sprintf("%s subscription, first billing period", plan.DisplayName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SubscriptionResponse{Subscription: subscription, Invoice: invoice}, nil
+}
+
+// ChangePlan upgrades or downgrades a subscription immediately. The unused
+// value of the current plan is credited against the new plan: a positive
+// difference is invoiced right away, a negative one is kept as credit for
+// the next invoice. Changing the billing cycle starts a new period.
+func (s *Service) ChangePlan(ctx context.Context, req *ChangePlanRequest) (*SubscriptionResponse, error) {
+	subscription, err := s.getCompanySubscription(ctx, req.CompanyID, req.SubscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if !subscription.IsSubscriptionActive() {
+		return nil, apperrors.NewConflictError("subscription is not active")
+	}
+
+	plan, ok := entitlement.GetPlan(req.PlanName)
+	if !ok {
+		return nil, apperrors.NewValidationError(fmt.Sprintf("unknown plan %q", req.PlanName))
+	}
+	planType, err := normalizePlanType(req.PlanType, subscription.PlanType)
+	if err != nil {
+		return nil, apperrors.NewValidationError(err.Error())
+	}
+	if plan.Name == subscription.PlanName && planType == subscription.PlanType {
+		return nil, apperrors.NewValidationError(fmt.Sprintf("subscription is already on the %s %s plan", planType, plan.Name))
+	}
+
+	usage, err := s.entitlements.GetUsage(ctx, subscription.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	if exceeded := planLimitsExceeded(plan, usage); len(exceeded) > 0 {
+		return nil, apperrors.NewValidationError(fmt.Sprintf("cannot change to the %s plan: %s", plan.Name, strings.Join(exceeded, ", ")))
+	}
+
+	company, err := s.repoManager.GetCompanies().GetByID(ctx, subscription.CompanyID)
+	if err != nil {
+		return nil, apperrors.NewNotFoundError("company")
+	}
+
+	previous := *subscription
+	proration := calculateProration(subscription, plan, planType, time.Now())
+
+	applyPlan(subscription, plan, planType)
+	if planType != previous.PlanType {
+		subscription.StartDate = proration.PeriodStart
+		subscription.EndDate = proration.PeriodEnd
+		subscription.NextBillingDate = proration.PeriodEnd
+		subscription.RenewalPeriod = renewalMonths(planType)
+	}
+
+	var items []invoiceLineItem
+	if proration.Net > 0 {
+		items = prorationLineItems(&previous, plan, planType, proration)
+		if subscription.CreditBalance > 0 {
+			credit := math.Min(subscription.CreditBalance, proration.Net)
+			items = append(items, invoiceLineItem{Description: "Credit from previous plan changes", Quantity: 1, UnitPrice: -credit, Total: -credit})
+			subscription.CreditBalance = roundRupiah(subscription.CreditBalance - credit)
+		}
+	} else {
+		subscription.CreditBalance = roundRupiah(subscription.CreditBalance - proration.Net)
+	}
+
+	if err := s.repoManager.GetSubscriptions().Update(ctx, subscription); err != nil {
+		return nil, apperrors.Wrap(err, "failed to update subscription")
+	}
+	s.updateCompanyTier(ctx, company, plan.Name)
+
+	response := &SubscriptionResponse{Subscription: subscription, Proration: &proration}
+	if len(items) > 0 {
+		invoice, _, err := s.createInvoice(ctx, company, subscription, items, time.Now(), subscription.EndDate, time.Time{},
+			fmt.Sprintf("Plan change from %s to %s", previous.PlanName, plan.Name))
+		if err != nil {
+			return nil, err
+		}
+		response.Invoice = invoice
+	}
+
+	return response, nil
+}
+
+// CancelSubscription cancels a subscription at the end of its current period
+func (s *Service) CancelSubscription(ctx context.Context, companyID, subscriptionID string) (*models.Subscription, error) {
+	subscription, err := s.getCompanySubscription(ctx, companyID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if !subscription.IsSubscriptionActive() {
+		return nil, apperrors.NewConflictError("subscription is not active")
+	}
+	if subscription.CancelAtPeriodEnd {
+		return nil, apperrors.NewConflictError("subscription is already cancelled at the end of its period")
+	}
+
+	now := time.Now()
+	subscription.CancelAtPeriodEnd = true
+	subscription.CancelledAt = &now
+	subscription.AutoRenew = false
+
+	if err := s.repoManager.GetSubscriptions().Update(ctx, subscription); err != nil {
+		return nil, apperrors.Wrap(err, "failed to cancel subscription")
+	}
+	return subscription, nil
+}
+
+// RenewSubscriptions starts the next period of auto-renewing subscriptions
+// that end within a day and invoices it through GenerateSubscriptionBilling.
+// Subscriptions that are cancelled or do not auto-renew are closed once their
+// period has ended. It returns the number of renewed subscriptions.
+func (s *Service) RenewSubscriptions(ctx context.Context) (int, error) {
+	now := time.Now()
+	due, err := s.repoManager.GetSubscriptions().GetDueForRenewal(ctx, now.Add(subscriptionRenewalLead))
+	if err != nil {
+		return 0, apperrors.Wrap(err, "failed to get subscriptions due for renewal")
+	}
+
+	renewed := 0
+	for _, subscription := range due {
+		if subscription.CancelAtPeriodEnd || !subscription.AutoRenew {
+			if subscription.EndDate.After(now) {
+				continue
+			}
+			status := "expired"
+			if subscription.CancelAtPeriodEnd {
+				status = "cancelled"
+			}
+			if err := s.db.WithContext(ctx).Model(&models.Subscription{}).
+				Where("id = ? AND status = ?", subscription.ID, "active").
+				Updates(map[string]interface{}{"status": status, "is_active": false}).Error; err != nil {
+				fmt.Printf("Failed to close subscription %s: %v\n", subscription.ID, err)
+			}
+			continue
+		}
+
+		months := subscription.RenewalPeriod
+		if months <= 0 {
+			months = renewalMonths(subscription.PlanType)
+		}
+		start := subscription.EndDate
+		end := start.AddDate(0, months, 0)
+
+		// Guard on the old end date so concurrent runs renew a period only once
+		result := s.db.WithContext(ctx).Model(&models.Subscription{}).
+			Where("id = ? AND end_date = ?", subscription.ID, subscription.EndDate).
+			Updates(map[string]interface{}{"start_date": start, "end_date": end, "next_billing_date": end})
+		if result.Error != nil {
+			fmt.Printf("Failed to renew subscription %s: %v\n", subscription.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if err := s.GenerateSubscriptionBilling(ctx, &SubscriptionBillingRequest{
+			CompanyID:      subscription.CompanyID,
+			SubscriptionID: subscription.ID,
+			BillingCycle:   subscription.PlanType,
+			StartDate:      start.Format("2006-01-02"),
+			EndDate:        end.Format("2006-01-02"),
+		}); err != nil {
+			fmt.Printf("Failed to invoice renewal of subscription %s: %v\n", subscription.ID, err)
+		}
+		renewed++
+	}
+
+	return renewed, nil
+}
+
+// GetPlanUsage returns the plan limits and features of a company with its current usage
+func (s *Service) GetPlanUsage(ctx context.Context, companyID string) (*PlanUsage, error) {
+	entitlements, err := s.entitlements.GetEntitlements(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := s.entitlements.GetUsage(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	return &PlanUsage{Entitlements: entitlements, Usage: usage}, nil
+}
+
+// getCompanySubscription loads a subscription that belongs to a company
+func (s *Service) getCompanySubscription(ctx context.Context, companyID, subscriptionID string) (*models.Subscription, error) {
+	subscription, err := s.repoManager.GetSubscriptions().GetByID(ctx, subscriptionID)
+	if err != nil || subscription.CompanyID != companyID {
+		return nil, apperrors.NewNotFoundError("subscription")
+	}
+	return subscription, nil
+}
+
+// updateCompanyTier keeps Company.SubscriptionTier in sync with the plan
+func (s *Service) updateCompanyTier(ctx context.Context, company *models.Company, planName string) {
+	if company.SubscriptionTier == planName {
+		return
+	}
+	if err := s.db.WithContext(ctx).Model(company).Update("subscription_tier", planName).Error; err != nil {
+		fmt.Printf("Failed to update subscription tier of company %s: %v\n", company.ID, err)
+	}
+}
+
+// applyPlan copies the plan limits, features and price onto a subscription
+func applyPlan(subscription *models.Subscription, plan entitlement.Plan, planType string) {
+	subscription.PlanName = plan.Name
+	subscription.PlanType = planType
+	subscription.MaxVehicles = plan.MaxVehicles
+	subscription.MaxDrivers = plan.MaxDrivers
+	subscription.MaxUsers = plan.MaxUsers
+	subscription.Price = plan.Price(planType)
+	subscription.Features = plan.FeatureJSON()
+}
+
+// calculateProration settles a change to plan/planType at the given time.
+// Within the same billing cycle both plans are prorated by the remaining
+// share of the period; a new billing cycle is charged in full from now.
+func calculateProration(subscription *models.Subscription, plan entitlement.Plan, planType string, now time.Time) Proration {
+	total := subscription.EndDate.Sub(subscription.StartDate)
+	remaining := subscription.EndDate.Sub(now)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if remaining > total {
+		remaining = total
+	}
+
+	fraction := 0.0
+	if total > 0 {
+		fraction = float64(remaining) / float64(total)
+	}
+
+	proration := Proration{
+		RemainingDays: int(math.Ceil(remaining.Hours() / 24)),
+		Credit:        roundRupiah(subscription.Price * fraction),
+		PeriodStart:   subscription.StartDate,
+		PeriodEnd:     subscription.EndDate,
+	}
+
+	if planType == subscription.PlanType {
+		proration.Charge = roundRupiah(plan.Price(planType) * fraction)
+	} else {
+		proration.PeriodStart = now
+		proration.PeriodEnd = now.AddDate(0, renewalMonths(planType), 0)
+		proration.RemainingDays = int(math.Ceil(proration.PeriodEnd.Sub(now).Hours() / 24))
+		proration.Charge = plan.Price(planType)
+	}
+
+	proration.Net = roundRupiah(proration.Charge - proration.Credit)
+	return proration
+}
+
+// prorationLineItems describes a plan change on an invoice
+func prorationLineItems(previous *models.Subscription, plan entitlement.Plan, planType string, proration Proration) []invoiceLineItem {
+	items := []invoiceLineItem{{
+		Description: fmt.Sprintf("%s plan (%s), prorated for %d days until %s",
+			plan.DisplayName, planType, proration.RemainingDays, formatIndonesianDate(proration.PeriodEnd)),
+		Quantity:  1,
+		UnitPrice: proration.Charge,
+		Total:     proration.Charge,
+	}}
+	if proration.Credit > 0 {
+		items = append(items, invoiceLineItem{
+			Description: fmt.Sprintf("Unused time on %s plan (%s)", planDisplayName(previous.PlanName), previous.PlanType),
+			Quantity:    1,
+			UnitPrice:   -proration.Credit,
+			Total:       -proration.Credit,
+		})
+	}
+	return items
+}
+
+// subscriptionLineItems bills one period of a subscription, minus any credit
+func subscriptionLineItems(subscription *models.Subscription, start, end time.Time) []invoiceLineItem {
+	price := subscriptionPeriodPrice(subscription)
+	items := []invoiceLineItem{{
+		Description: fmt.Sprintf("FleetTracker Pro %s plan (%s), %s - %s",
+			planDisplayName(subscription.PlanName), subscription.PlanType, formatIndonesianDate(start), formatIndonesianDate(end)),
+		Quantity:  1,
+		UnitPrice: price,
+		Total:     price,
+	}}
+
+	if subscription.CreditBalance > 0 {
+		credit := math.Min(subscription.CreditBalance, price)
+		items = append(items, invoiceLineItem{
+			Description: "Credit from plan changes",
+			Quantity:    1,
+			UnitPrice:   -credit,
+			Total:       -credit,
+		})
+	}
+	return items
+}
+
+// subscriptionPeriodPrice returns the price of one billing period
+func subscriptionPeriodPrice(subscription *models.Subscription) float64 {
+	return subscription.Price
+}
+
+// planLimitsExceeded lists the limits of a plan that the usage is above
+func planLimitsExceeded(plan entitlement.Plan, usage *entitlement.Usage) []string {
+	var exceeded []string
+	if usage.Vehicles > plan.MaxVehicles {
+		exceeded = append(exceeded, fmt.Sprintf("%d active vehicles exceed the limit of %d", usage.Vehicles, plan.MaxVehicles))
+	}
+	if usage.Drivers > plan.MaxDrivers {
+		exceeded = append(exceeded, fmt.Sprintf("%d active drivers exceed the limit of %d", usage.Drivers, plan.MaxDrivers))
+	}
+	if usage.Users > plan.MaxUsers {
+		exceeded = append(exceeded, fmt.Sprintf("%d active users exceed the limit of %d", usage.Users, plan.MaxUsers))
+	}
+	return exceeded
+}
+
+// normalizePlanType validates a billing cycle, using fallback when empty
+func normalizePlanType(planType, fallback string) (string, error) {
+	planType = strings.ToLower(strings.TrimSpace(planType))
+	if planType == "" {
+		planType = fallback
+	}
+	if planType != entitlement.BillingMonthly && planType != entitlement.BillingYearly {
+		return "", fmt.Errorf("plan_type must be %s or %s", entitlement.BillingMonthly, entitlement.BillingYearly)
+	}
+	return planType, nil
+}
+
+// renewalMonths returns the length of a billing cycle in months
+func renewalMonths(planType string) int {
+	if planType == entitlement.BillingYearly {
+		return 12
+	}
+	return 1
+}
+
+// planDisplayName returns the display name of a plan, or the raw name
+func planDisplayName(name string) string {
+	if plan, ok := entitlement.GetPlan(name); ok {
+		return plan.DisplayName
+	}
+	return name
+}
+
+// roundRupiah rounds an amount to whole Rupiah
+func roundRupiah(amount float64) float64 {
+	return math.Round(amount)
+}
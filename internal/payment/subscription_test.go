@@ -0,0 +1,113 @@
+package payment
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+func TestCalculateProration(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	basic, _ := entitlement.GetPlan(entitlement.PlanBasic)
+	professional, _ := entitlement.GetPlan(entitlement.PlanProfessional)
+
+	subscription := &models.Subscription{
+		PlanName:  entitlement.PlanBasic,
+		PlanType:  entitlement.BillingMonthly,
+		Price:     basic.MonthlyPrice,
+		StartDate: start,
+		EndDate:   start.AddDate(0, 1, 0),
+	}
+
+	t.Run("upgrade halfway through the period", func(t *testing.T) {
+		now := start.Add(subscription.EndDate.Sub(start) / 2)
+		proration := calculateProration(subscription, professional, entitlement.BillingMonthly, now)
+
+		assert.Equal(t, 125000.0, proration.Credit)
+		assert.Equal(t, 375000.0, proration.Charge)
+		assert.Equal(t, 250000.0, proration.Net)
+		assert.Equal(t, 16, proration.RemainingDays)
+		assert.Equal(t, subscription.EndDate, proration.PeriodEnd)
+	})
+
+	t.Run("downgrade leaves a credit", func(t *testing.T) {
+		upgraded := *subscription
+		upgraded.PlanName = entitlement.PlanProfessional
+		upgraded.Price = professional.MonthlyPrice
+
+		now := start.Add(upgraded.EndDate.Sub(start) / 2)
+		proration := calculateProration(&upgraded, basic, entitlement.BillingMonthly, now)
+
+		assert.Equal(t, 375000.0, proration.Credit)
+		assert.Equal(t, 125000.0, proration.Charge)
+		assert.Equal(t, -250000.0, proration.Net)
+	})
+
+	t.Run("switching to yearly starts a new period", func(t *testing.T) {
+		now := start.AddDate(0, 0, 10)
+		proration := calculateProration(subscription, basic, entitlement.BillingYearly, now)
+
+		assert.Equal(t, now, proration.PeriodStart)
+		assert.Equal(t, now.AddDate(1, 0, 0), proration.PeriodEnd)
+		assert.Equal(t, basic.YearlyPrice, proration.Charge)
+		assert.Equal(t, proration.Charge-proration.Credit, proration.Net)
+	})
+
+	t.Run("after the period ends nothing is credited", func(t *testing.T) {
+		proration := calculateProration(subscription, professional, entitlement.BillingMonthly, subscription.EndDate.Add(time.Hour))
+
+		assert.Zero(t, proration.Credit)
+		assert.Zero(t, proration.Charge)
+		assert.Zero(t, proration.RemainingDays)
+	})
+}
+
+func TestSubscriptionLineItems(t *testing.T) {
+	start := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	subscription := &models.Subscription{
+		PlanName:      entitlement.PlanProfessional,
+		PlanType:      entitlement.BillingMonthly,
+		Price:         750000,
+		CreditBalance: 100000,
+	}
+
+	items := subscriptionLineItems(subscription, start, start.AddDate(0, 1, 0))
+	require.Len(t, items, 2)
+	assert.Contains(t, items[0].Description, "Professional")
+	assert.Equal(t, 750000.0, items[0].Total)
+	assert.Equal(t, -100000.0, items[1].Total)
+
+	// Credit never exceeds the price of the period
+	subscription.CreditBalance = 1000000
+	items = subscriptionLineItems(subscription, start, start.AddDate(0, 1, 0))
+	require.Len(t, items, 2)
+	assert.Equal(t, -750000.0, items[1].Total)
+}
+
+func TestPlanLimitsExceeded(t *testing.T) {
+	basic, _ := entitlement.GetPlan(entitlement.PlanBasic)
+
+	assert.Empty(t, planLimitsExceeded(basic, &entitlement.Usage{Vehicles: 10, Drivers: 15, Users: 3}))
+
+	exceeded := planLimitsExceeded(basic, &entitlement.Usage{Vehicles: 11, Drivers: 2, Users: 4})
+	require.Len(t, exceeded, 2)
+	assert.Contains(t, exceeded[0], "vehicles")
+	assert.Contains(t, exceeded[1], "users")
+}
+
+func TestNormalizePlanType(t *testing.T) {
+	planType, err := normalizePlanType("", entitlement.BillingMonthly)
+	require.NoError(t, err)
+	assert.Equal(t, entitlement.BillingMonthly, planType)
+
+	planType, err = normalizePlanType(" Yearly", entitlement.BillingMonthly)
+	require.NoError(t, err)
+	assert.Equal(t, entitlement.BillingYearly, planType)
+
+	_, err = normalizePlanType("weekly", entitlement.BillingMonthly)
+	assert.Error(t, err)
+}
@@ -0,0 +1,374 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Headers carrying the webhook signature of providers without their own
+// notification format, such as the fake gateway. They sign
+// "<timestamp>.<raw body>" with HMAC-SHA256 and send the hex digest.
+const (
+	WebhookSignatureHeader = "X-Callback-Signature"
+	WebhookTimestampHeader = "X-Callback-Timestamp"
+)
+
+// Results recorded for a processed webhook event
+const (
+	WebhookResultSettled        = "settled"
+	WebhookResultFailed         = "failed"
+	WebhookResultExpired        = "expired"
+	WebhookResultIgnored        = "ignored"
+	WebhookResultAmountMismatch = "amount_mismatch"
+	WebhookResultDuplicate      = "duplicate"
+)
+
+// defaultWebhookTolerance is the accepted clock skew for signed timestamps
+const defaultWebhookTolerance = 5 * time.Minute
+
+// ErrWebhookSignature is returned for notifications whose signature does not
+// verify
+var ErrWebhookSignature = errors.New("webhook signature mismatch")
+
+// NotificationParser verifies and decodes the notifications of a gateway
+// with its own notification format
+type NotificationParser interface {
+	ParseNotification(header http.Header, body []byte) (*WebhookNotification, models.JSON, error)
+}
+
+// PaymentAlerter is notified when a payment is received
+type PaymentAlerter interface {
+	CreatePaymentReceivedAlert(ctx context.Context, companyID, invoiceID string, amount float64) error
+}
+
+// WebhookNotification is the normalized payload of a gateway notification
+type WebhookNotification struct {
+	EventID       string  `json:"event_id"`
+	ExternalID    string  `json:"id"`
+	ReferenceID   string  `json:"reference_id"`
+	TransactionID string  `json:"transaction_id"`
+	Channel       string  `json:"channel"` // payment channel, when the provider reports it
+	Status        string  `json:"status"`
+	Amount        float64 `json:"amount"`
+	PaidAt        string  `json:"paid_at"`
+	FailureReason string  `json:"failure_reason"`
+}
+
+// WebhookResult describes what a webhook delivery did
+type WebhookResult struct {
+	Provider  string `json:"provider"`
+	EventID   string `json:"event_id"`
+	PaymentID string `json:"payment_id,omitempty"`
+	Status    string `json:"status"`
+	Result    string `json:"result"`
+	Duplicate bool   `json:"duplicate"`
+}
+
+// SignWebhook returns the hex HMAC-SHA256 signature of a webhook body
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebhookSignature checks the signature and timestamp headers of a
+// webhook against the provider secret
+func verifyWebhookSignature(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	if secret == "" {
+		return errors.New("no webhook secret configured")
+	}
+
+	signature := header.Get(WebhookSignatureHeader)
+	timestamp := header.Get(WebhookTimestampHeader)
+	if signature == "" || timestamp == "" {
+		return errors.New("missing webhook signature headers")
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid webhook timestamp %q", timestamp)
+	}
+	if tolerance <= 0 {
+		tolerance = defaultWebhookTolerance
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > tolerance || skew < -tolerance {
+		return fmt.Errorf("webhook timestamp outside tolerance of %s", tolerance)
+	}
+
+	expected := SignWebhook(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return ErrWebhookSignature
+	}
+	return nil
+}
+
+// parseWebhookNotification decodes a notification body. Deliveries without an
+// event ID are identified by the hash of their body so identical retries are
+// still deduplicated.
+func parseWebhookNotification(body []byte) (*WebhookNotification, models.JSON, error) {
+	var notification WebhookNotification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	var raw models.JSON
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	if notification.ExternalID == "" && notification.ReferenceID == "" {
+		return nil, nil, errors.New("webhook payload has no id or reference_id")
+	}
+	if notification.EventID == "" {
+		sum := sha256.Sum256(body)
+		notification.EventID = hex.EncodeToString(sum[:])
+	}
+	notification.Status = normalizeChargeStatus(notification.Status)
+
+	return &notification, raw, nil
+}
+
+// parseWebhook verifies and decodes a notification with the provider's own
+// format, or with the signature headers and the provider's secret
+func (s *Service) parseWebhook(gateway PaymentGateway, header http.Header, body []byte) (*WebhookNotification, models.JSON, error) {
+	if parser, ok := gateway.(NotificationParser); ok {
+		notification, raw, err := parser.ParseNotification(header, body)
+		if err != nil {
+			if errors.Is(err, ErrWebhookSignature) {
+				return nil, nil, apperrors.NewUnauthorizedError("invalid webhook signature").WithInternal(err)
+			}
+			return nil, nil, apperrors.NewBadRequestError(err.Error())
+		}
+		return notification, raw, nil
+	}
+
+	secret := s.cfg.PaymentWebhookSecrets[gateway.Provider()]
+	if err := verifyWebhookSignature(secret, header, body, s.cfg.PaymentWebhookTolerance, time.Now()); err != nil {
+		return nil, nil, apperrors.NewUnauthorizedError("invalid webhook signature").WithInternal(err)
+	}
+	notification, raw, err := parseWebhookNotification(body)
+	if err != nil {
+		return nil, nil, apperrors.NewBadRequestError(err.Error())
+	}
+	return notification, raw, nil
+}
+
+// SetAlerter sets the alerter notified about received payments
+func (s *Service) SetAlerter(alerter PaymentAlerter) {
+	s.alerter = alerter
+}
+
+// HandleWebhook verifies and applies a payment gateway notification. The
+// provider is the gateway the payment was charged with, e.g. midtrans; the
+// fake gateway is only accepted in development. Every event is recorded once
+// per provider; redeliveries of a recorded event are acknowledged without
+// being applied again.
+func (s *Service) HandleWebhook(ctx context.Context, provider string, header http.Header, body []byte) (*WebhookResult, error) {
+	provider = strings.ToLower(provider)
+	gateway, ok := s.gateways.Provider(provider)
+	if !ok || (provider == FakeProvider && s.cfg.Environment != "development") {
+		return nil, apperrors.NewNotFoundError("webhook provider")
+	}
+
+	notification, raw, err := s.parseWebhook(gateway, header, body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WebhookResult{
+		Provider: provider,
+		EventID:  notification.EventID,
+		Status:   notification.Status,
+	}
+	var payment models.Payment
+	var invoice *models.Invoice
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		event := &models.PaymentWebhookEvent{
+			Provider: provider,
+			EventID:  notification.EventID,
+			Status:   notification.Status,
+			Payload:  raw,
+		}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected == 0 {
+			result.Result = WebhookResultDuplicate
+			result.Duplicate = true
+			return nil
+		}
+
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		if notification.ExternalID != "" {
+			query = query.Where("external_id = ?", notification.ExternalID)
+		} else {
+			query = query.Where("reference_number = ?", notification.ReferenceID)
+		}
+		if err := query.First(&payment).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperrors.NewNotFoundError("payment")
+			}
+			return err
+		}
+
+		// A provider may only report on payments charged through it, and
+		// only for the channel the payment was charged with
+		if paymentProvider(&payment) != provider {
+			return apperrors.NewForbiddenError("payment was not charged through this provider")
+		}
+		if notification.Channel != "" && notification.Channel != paymentChannel(&payment) {
+			return apperrors.NewForbiddenError("notification channel does not match the payment")
+		}
+
+		outcome, settled, err := applyWebhookNotification(tx, &payment, notification, raw)
+		if err != nil {
+			return err
+		}
+		invoice = settled
+
+		result.PaymentID = payment.ID
+		result.Result = outcome
+		return tx.Model(event).Updates(map[string]interface{}{
+			"payment_id": payment.ID,
+			"result":     outcome,
+		}).Error
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			return nil, appErr
+		}
+		return nil, apperrors.Wrap(err, "failed to process payment webhook")
+	}
+	if result.Duplicate {
+		return result, nil
+	}
+
+	if err := s.cache.InvalidatePaymentCache(ctx, payment.ID); err != nil {
+		fmt.Printf("Failed to invalidate payment cache %s: %v\n", payment.ID, err)
+	}
+	if payment.ReferenceNumber != "" {
+		if err := s.cache.InvalidatePaymentByReferenceCache(ctx, payment.ReferenceNumber); err != nil {
+			fmt.Printf("Failed to invalidate payment by reference cache %s: %v\n", payment.ReferenceNumber, err)
+		}
+	}
+	if invoice != nil {
+		s.invalidateInvoiceCaches(ctx, invoice)
+	}
+
+	if result.Result == WebhookResultSettled && s.alerter != nil {
+		invoiceID := ""
+		if invoice != nil {
+			invoiceID = invoice.ID
+		}
+		if err := s.alerter.CreatePaymentReceivedAlert(ctx, payment.CompanyID, invoiceID, payment.TotalAmount); err != nil {
+			fmt.Printf("Failed to create payment received alert for payment %s: %v\n", payment.ID, err)
+		}
+	}
+
+	return result, nil
+}
+
+// applyWebhookNotification transitions a locked payment and, on settlement,
+// its linked invoice. It returns the recorded result and the settled invoice.
+func applyWebhookNotification(tx *gorm.DB, payment *models.Payment, notification *WebhookNotification, raw models.JSON) (string, *models.Invoice, error) {
+	payment.CallbackData = raw
+	outcome := WebhookResultIgnored
+	var invoice *models.Invoice
+
+	switch notification.Status {
+	case ChargeStatusCompleted:
+		if payment.IsCompleted() {
+			break
+		}
+		if !webhookAmountMatches(notification.Amount, payment.TotalAmount) {
+			fmt.Printf("Webhook amount %.2f does not match payment %s amount %.2f\n", notification.Amount, payment.ID, payment.TotalAmount)
+			outcome = WebhookResultAmountMismatch
+			break
+		}
+
+		externalID := payment.ExternalID
+		if externalID == "" {
+			externalID = notification.ExternalID
+		}
+		payment.CompletePayment(externalID)
+		if notification.TransactionID != "" {
+			payment.TransactionID = notification.TransactionID
+		}
+		if notification.PaidAt != "" {
+			if paidAt, err := time.Parse(time.RFC3339, notification.PaidAt); err == nil {
+				payment.CompletedAt = &paidAt
+			}
+		}
+		outcome = WebhookResultSettled
+
+		var linked models.Invoice
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("payment_id = ?", payment.ID).
+			First(&linked).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			fmt.Printf("Settled payment %s has no linked invoice\n", payment.ID)
+		case err != nil:
+			return "", nil, err
+		case linked.IsPaid():
+			fmt.Printf("Invoice %s was already paid, payment %s needs manual review\n", linked.ID, payment.ID)
+			invoice = &linked
+		default:
+			linked.MarkAsPaid(payment.TotalAmount, payment.PaymentMethod)
+			linked.PaymentReference = payment.ReferenceNumber
+			if err := tx.Save(&linked).Error; err != nil {
+				return "", nil, err
+			}
+			invoice = &linked
+		}
+
+	case ChargeStatusFailed:
+		if payment.IsPending() {
+			reason := notification.FailureReason
+			if reason == "" {
+				reason = "payment failed at gateway"
+			}
+			payment.FailPayment(reason)
+			outcome = WebhookResultFailed
+		}
+
+	case ChargeStatusExpired:
+		if payment.IsPending() {
+			payment.ExpirePayment()
+			outcome = WebhookResultExpired
+		}
+	}
+
+	if err := tx.Save(payment).Error; err != nil {
+		return "", nil, err
+	}
+	return outcome, invoice, nil
+}
+
+// webhookAmountMatches reports whether a notified amount settles a payment.
+// A notification without an amount never does. Gateways charging whole
+// rupiah report the rounded amount.
+func webhookAmountMatches(notified, expected float64) bool {
+	if notified <= 0 {
+		return false
+	}
+	return math.Abs(notified-expected) <= 0.01 || math.Abs(notified-math.Round(expected)) <= 0.01
+}
@@ -0,0 +1,74 @@
+package payment
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signedWebhookHeader(secret string, at time.Time, body []byte) http.Header {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	header := http.Header{}
+	header.Set(WebhookTimestampHeader, timestamp)
+	header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, body))
+	return header
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"charge_1","status":"PAID"}`)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  http.Header
+		body    []byte
+		wantErr bool
+	}{
+		{name: "valid signature", secret: "s3cret", header: signedWebhookHeader("s3cret", now, body), body: body},
+		{name: "wrong secret", secret: "s3cret", header: signedWebhookHeader("other", now, body), body: body, wantErr: true},
+		{name: "tampered body", secret: "s3cret", header: signedWebhookHeader("s3cret", now, body), body: []byte(`{"id":"charge_1","status":"PAID","amount":1}`), wantErr: true},
+		{name: "stale timestamp", secret: "s3cret", header: signedWebhookHeader("s3cret", now.Add(-10*time.Minute), body), body: body, wantErr: true},
+		{name: "missing headers", secret: "s3cret", header: http.Header{}, body: body, wantErr: true},
+		{name: "no secret configured", secret: "", header: signedWebhookHeader("", now, body), body: body, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyWebhookSignature(tt.secret, tt.header, tt.body, 5*time.Minute, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestParseWebhookNotification(t *testing.T) {
+	notification, raw, err := parseWebhookNotification([]byte(`{"event_id":"evt_1","id":"charge_1","status":"SETTLEMENT","amount":111000}`))
+	require.NoError(t, err)
+	assert.Equal(t, "evt_1", notification.EventID)
+	assert.Equal(t, ChargeStatusCompleted, notification.Status)
+	assert.Equal(t, 111000.0, notification.Amount)
+	assert.Equal(t, "charge_1", raw["id"])
+
+	body := []byte(`{"reference_id":"PAY-20250101-ABCDEF01","status":"EXPIRED"}`)
+	first, _, err := parseWebhookNotification(body)
+	require.NoError(t, err)
+	second, _, err := parseWebhookNotification(body)
+	require.NoError(t, err)
+	assert.NotEmpty(t, first.EventID)
+	assert.Equal(t, first.EventID, second.EventID, "retries without event_id share an ID")
+	assert.Equal(t, ChargeStatusExpired, first.Status)
+
+	_, _, err = parseWebhookNotification([]byte(`{"status":"PAID"}`))
+	assert.Error(t, err)
+
+	_, _, err = parseWebhookNotification([]byte(`not json`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,427 @@
+package tracking
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// MaxGPSBatchSize is the largest number of points accepted in one batch
+const MaxGPSBatchSize = 1000
+
+// gpsBatchInsertSize is the number of rows per INSERT statement
+const gpsBatchInsertSize = 100
+
+// GPSBatchRequest carries the buffered GPS fixes of one device, typically
+// uploaded when a phone regains connectivity after driving out of coverage
+type GPSBatchRequest struct {
+	VehicleID string          `json:"vehicle_id" validate:"required"`
+	DriverID  string          `json:"driver_id" validate:"required"`
+	Points    []GPSBatchPoint `json:"points" validate:"required,min=1,max=1000,dive"`
+}
+
+// DeviceGPSBatchRequest carries GPS fixes posted by an authenticated device.
+// The vehicle and driver are resolved from the device's binding.
+type DeviceGPSBatchRequest struct {
+	Points []GPSBatchPoint `json:"points" validate:"required,min=1,max=1000,dive"`
+}
+
+// GPSBatchPoint is a single fix within a GPS batch
+type GPSBatchPoint struct {
+	Latitude     float64   `json:"latitude" validate:"required,min=-90,max=90"`
+	Longitude    float64   `json:"longitude" validate:"required,min=-180,max=180"`
+	Altitude     float64   `json:"altitude"`
+	Speed        float64   `json:"speed" validate:"min=0,max=200"` // km/h
+	Heading      float64   `json:"heading" validate:"min=0,max=360"`
+	Accuracy     float64   `json:"accuracy" validate:"min=0,max=100"` // meters
+	Timestamp    time.Time `json:"timestamp" validate:"required"`
+	BatteryLevel float64   `json:"battery_level" validate:"min=0,max=100"`
+	NetworkType  string    `json:"network_type"`
+	IgnitionOn   *bool     `json:"ignition_on,omitempty"`
+
+	// Reported by hardwired trackers
+	Satellites int         `json:"satellites,omitempty"`
+	FuelLevel  *float64    `json:"fuel_level,omitempty"` // liters
+	Odometer   *float64    `json:"odometer,omitempty"`   // km
+	RawData    models.JSON `json:"raw_data,omitempty"`   // original device data
+}
+
+// GPSBatchRejection explains why a point of a batch was not stored
+type GPSBatchRejection struct {
+	Index     int       `json:"index"` // position in the submitted points
+	Timestamp time.Time `json:"timestamp"`
+	Reason    string    `json:"reason"`
+}
+
+// GPSBatchResult summarizes a processed GPS batch
+type GPSBatchResult struct {
+	Received        int                 `json:"received"`
+	Accepted        int                 `json:"accepted"`
+	Duplicates      int                 `json:"duplicates"`
+	Rejected        []GPSBatchRejection `json:"rejected"`
+	LatestTrack     *models.GPSTrack    `json:"latest_track,omitempty"`
+	BackfilledTrips []string            `json:"backfilled_trips"`
+}
+
+// indexedGPSPoint keeps a point's position in the request for error reporting
+type indexedGPSPoint struct {
+	index int
+	point GPSBatchPoint
+}
+
+// ProcessGPSBatch stores a batch of GPS fixes posted for a vehicle by its
+// assigned driver, see storeGPSBatch
+func (s *Service) ProcessGPSBatch(req GPSBatchRequest) (*GPSBatchResult, error) {
+	if err := validateGPSBatchSize(req.Points); err != nil {
+		return nil, err
+	}
+
+	// Check if vehicle exists and is active
+	var vehicle models.Vehicle
+	if err := s.db.Where("id = ? AND is_active = ?", req.VehicleID, true).First(&vehicle).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("vehicle")
+		}
+		return nil, apperrors.Wrap(err, "failed to validate vehicle")
+	}
+
+	// Check if driver exists and is active
+	var driver models.Driver
+	if err := s.db.Where("id = ? AND is_active = ?", req.DriverID, true).First(&driver).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("driver")
+		}
+		return nil, apperrors.Wrap(err, "failed to validate driver")
+	}
+
+	// Validate driver is assigned to vehicle
+	if driver.VehicleID == nil || *driver.VehicleID != req.VehicleID {
+		return nil, apperrors.NewBadRequestError("driver not assigned to this vehicle")
+	}
+
+	return s.storeGPSBatch(&vehicle, req.DriverID, "", req.Points)
+}
+
+// ProcessDeviceGPSBatch stores a batch of GPS fixes reported by a device
+// bound to a vehicle. The device is trusted for the vehicle, so fixes are
+// attributed to whichever driver is assigned to it, or to no driver.
+func (s *Service) ProcessDeviceGPSBatch(deviceID, vehicleID string, points []GPSBatchPoint) (*GPSBatchResult, error) {
+	if err := validateGPSBatchSize(points); err != nil {
+		return nil, err
+	}
+
+	// Check if vehicle exists and is active
+	var vehicle models.Vehicle
+	if err := s.db.Where("id = ? AND is_active = ?", vehicleID, true).First(&vehicle).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("vehicle")
+		}
+		return nil, apperrors.Wrap(err, "failed to validate vehicle")
+	}
+
+	driverID, err := s.assignedDriverID(vehicleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storeGPSBatch(&vehicle, driverID, deviceID, points)
+}
+
+// assignedDriverID returns the active driver assigned to a vehicle, or an
+// empty string when nobody is
+func (s *Service) assignedDriverID(vehicleID string) (string, error) {
+	var driver models.Driver
+	if err := s.db.Where("vehicle_id = ? AND is_active = ?", vehicleID, true).First(&driver).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", apperrors.Wrap(err, "failed to look up assigned driver")
+	}
+	return driver.ID, nil
+}
+
+// validateGPSBatchSize checks a batch is neither empty nor too large
+func validateGPSBatchSize(points []GPSBatchPoint) error {
+	if len(points) == 0 {
+		return apperrors.NewValidationError("batch must contain at least one point")
+	}
+	if len(points) > MaxGPSBatchSize {
+		return apperrors.NewValidationError(fmt.Sprintf("batch must not contain more than %d points", MaxGPSBatchSize))
+	}
+	return nil
+}
+
+// storeGPSBatch stores a batch of GPS fixes of one vehicle in a single
+// transaction. Points are sorted by timestamp and deduplicated, both within
+// the batch and against fixes already stored, so a device may safely retry
+// an upload, even concurrently. Points recorded during a trip are attached to it, completed
+// trips receiving late points get their metrics recalculated, and detected
+// trips around the batch are re-segmented. Only the
+// newest point moves the vehicle and runs the live side effects of
+// ProcessGPSData, and only when it is newer than the vehicle's last fix;
+// the earlier points are then replayed through the geofences first.
+// driverID and deviceID may be empty.
+func (s *Service) storeGPSBatch(vehicle *models.Vehicle, driverID, deviceID string, batch []GPSBatchPoint) (*GPSBatchResult, error) {
+	result := &GPSBatchResult{
+		Received:        len(batch),
+		Rejected:        []GPSBatchRejection{},
+		BackfilledTrips: []string{},
+	}
+
+	// Drop points failing the same checks as single submissions
+	valid := make([]indexedGPSPoint, 0, len(batch))
+	for i, point := range batch {
+		if err := s.validateGPSCoordinates(point.Latitude, point.Longitude, point.Accuracy); err != nil {
+			result.Rejected = append(result.Rejected, GPSBatchRejection{Index: i, Timestamp: point.Timestamp, Reason: err.Error()})
+			continue
+		}
+		valid = append(valid, indexedGPSPoint{index: i, point: point})
+	}
+
+	points, duplicates := normalizeGPSBatch(valid)
+	result.Duplicates = duplicates
+	if len(points) == 0 {
+		return result, nil
+	}
+
+	// Attach points to the trips that were running when they were recorded
+	trips, err := s.tripsOverlapping(vehicle.ID, points[0].point.Timestamp, points[len(points)-1].point.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make([]*models.GPSTrack, 0, len(points))
+	for _, p := range points {
+		track := newGPSTrack(GPSDataRequest{
+			VehicleID:  vehicle.ID,
+			DriverID:   driverID,
+			DeviceID:   deviceID,
+			Latitude:   p.point.Latitude,
+			Longitude:  p.point.Longitude,
+			Altitude:   p.point.Altitude,
+			Speed:      p.point.Speed,
+			Heading:    p.point.Heading,
+			Accuracy:   p.point.Accuracy,
+			Timestamp:  p.point.Timestamp,
+			IgnitionOn: p.point.IgnitionOn,
+			Satellites: p.point.Satellites,
+			FuelLevel:  p.point.FuelLevel,
+			Odometer:   p.point.Odometer,
+			RawData:    p.point.RawData,
+		})
+		// Known IDs tell which rows were inserted when some already existed
+		track.ID = uuid.New().String()
+		if trip := findTripAt(trips, p.point.Timestamp); trip != nil {
+			track.TripID = &trip.ID
+		}
+		tracks = append(tracks, track)
+	}
+
+	var advanced bool
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Fixes stored by an earlier or concurrent attempt of the same
+		// upload are skipped by the unique vehicle and timestamp index
+		created := tx.Clauses(gpsTrackOnConflict).CreateInBatches(tracks, gpsBatchInsertSize)
+		if created.Error != nil {
+			return fmt.Errorf("failed to save GPS tracks: %w", created.Error)
+		}
+		if int(created.RowsAffected) < len(tracks) {
+			inserted, err := insertedGPSTracks(tx, tracks)
+			if err != nil {
+				return err
+			}
+			result.Duplicates += len(tracks) - len(inserted)
+			tracks = inserted
+		}
+		if len(tracks) == 0 {
+			return nil
+		}
+		latest := tracks[len(tracks)-1]
+
+		// Only the newest point may move the vehicle, and never backwards
+		update := tx.Model(&models.Vehicle{}).
+			Where("id = ? AND (last_updated_at IS NULL OR last_updated_at <= ?)", vehicle.ID, latest.Timestamp).
+			Updates(map[string]interface{}{
+				"last_latitude":   latest.Latitude,
+				"last_longitude":  latest.Longitude,
+				"last_updated_at": latest.Timestamp,
+			})
+		if update.Error != nil {
+			return fmt.Errorf("failed to update vehicle location: %w", update.Error)
+		}
+		advanced = update.RowsAffected > 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) == 0 {
+		return result, nil
+	}
+	latest := tracks[len(tracks)-1]
+
+	touchedTrips := make(map[string]*models.Trip)
+	for _, track := range tracks {
+		if track.TripID == nil {
+			continue
+		}
+		for i := range trips {
+			if trips[i].ID == *track.TripID {
+				touchedTrips[trips[i].ID] = &trips[i]
+				break
+			}
+		}
+	}
+
+	result.Accepted = len(tracks)
+	result.LatestTrack = latest
+
+	// Completed trips that received late points need their totals redone
+	for tripID, trip := range touchedTrips {
+		if trip.Status != "completed" || trip.DriverID == nil || trip.Detection == TripDetectionAuto {
+			continue
+		}
+		if err := s.recalculateTripMetrics(trip); err != nil {
+			fmt.Printf("Failed to recalculate metrics for trip %s: %v\n", tripID, err)
+			continue
+		}
+		result.BackfilledTrips = append(result.BackfilledTrips, tripID)
+	}
+
+	// Late points may start, extend, split or merge detected trips
+	detected, err := s.redetectTrips(vehicle, tracks[0].Timestamp, latest.Timestamp)
+	if err != nil {
+		fmt.Printf("Failed to redetect trips of vehicle %s: %v\n", vehicle.ID, err)
+	}
+	result.BackfilledTrips = append(result.BackfilledTrips, detected...)
+	sort.Strings(result.BackfilledTrips)
+
+	if advanced {
+		s.publishLatestFix(latest, vehicle.CompanyID, tracks[:len(tracks)-1]...)
+	} else {
+		go func() {
+			// Older fixes still change the stored history
+			if err := s.cache.InvalidateLocationHistoryCache(ctx, vehicle.ID); err != nil {
+				fmt.Printf("Failed to invalidate location history cache %s: %v\n", vehicle.ID, err)
+			}
+		}()
+	}
+
+	return result, nil
+}
+
+// normalizeGPSBatch sorts points by timestamp and drops repeated timestamps,
+// keeping the first occurrence. It returns the remaining points and the
+// number of duplicates dropped.
+func normalizeGPSBatch(points []indexedGPSPoint) ([]indexedGPSPoint, int) {
+	sorted := make([]indexedGPSPoint, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].point.Timestamp.Before(sorted[j].point.Timestamp)
+	})
+
+	unique := sorted[:0]
+	seen := make(map[int64]bool, len(sorted))
+	duplicates := 0
+	for _, p := range sorted {
+		key := gpsTimestampKey(p.point.Timestamp)
+		if seen[key] {
+			duplicates++
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, p)
+	}
+	return unique, duplicates
+}
+
+// gpsTimestampKey identifies a fix by its timestamp at database precision
+func gpsTimestampKey(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// gpsTrackOnConflict skips fixes whose vehicle and timestamp are stored
+var gpsTrackOnConflict = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "vehicle_id"}, {Name: "timestamp"}},
+	DoNothing: true,
+}
+
+// insertedGPSTracks returns the tracks that were stored by an insert
+// skipping conflicts, keeping their order
+func insertedGPSTracks(tx *gorm.DB, tracks []*models.GPSTrack) ([]*models.GPSTrack, error) {
+	ids := make([]string, len(tracks))
+	for i, track := range tracks {
+		ids[i] = track.ID
+	}
+
+	var stored []string
+	if err := tx.Model(&models.GPSTrack{}).Where("id IN ?", ids).Pluck("id", &stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to check stored GPS tracks: %w", err)
+	}
+
+	storedIDs := make(map[string]bool, len(stored))
+	for _, id := range stored {
+		storedIDs[id] = true
+	}
+	inserted := make([]*models.GPSTrack, 0, len(stored))
+	for _, track := range tracks {
+		if storedIDs[track.ID] {
+			inserted = append(inserted, track)
+		}
+	}
+	return inserted, nil
+}
+
+// tripsOverlapping returns a vehicle's started trips overlapping a time range
+func (s *Service) tripsOverlapping(vehicleID string, from, to time.Time) ([]models.Trip, error) {
+	var trips []models.Trip
+	if err := s.db.Where("vehicle_id = ? AND status IN ? AND start_time <= ? AND (end_time IS NULL OR end_time >= ?)",
+		vehicleID, []string{"active", "completed"}, to, from).
+		Order("start_time DESC").Find(&trips).Error; err != nil {
+		return nil, apperrors.Wrap(err, "failed to load trips")
+	}
+	return trips, nil
+}
+
+// findTripAt returns the trip running at the given time. Trips must be
+// ordered by start time, newest first, so the latest start wins overlaps.
+func findTripAt(trips []models.Trip, t time.Time) *models.Trip {
+	for i := range trips {
+		trip := &trips[i]
+		if trip.StartTime == nil || trip.StartTime.After(t) {
+			continue
+		}
+		if trip.EndTime != nil && trip.EndTime.Before(t) {
+			continue
+		}
+		return trip
+	}
+	return nil
+}
+
+// recalculateTripMetrics recomputes the totals of a completed trip from its
+// GPS tracks and refreshes the cached copy
+func (s *Service) recalculateTripMetrics(trip *models.Trip) error {
+	if err := s.calculateTripMetrics(trip); err != nil {
+		return err
+	}
+
+	if err := s.db.Model(trip).Select("total_distance", "total_duration", "max_speed", "average_speed").Updates(trip).Error; err != nil {
+		return fmt.Errorf("failed to update trip: %w", err)
+	}
+
+	go func() {
+		if err := s.cache.InvalidateTripCache(ctx, trip.ID); err != nil {
+			fmt.Printf("Failed to invalidate trip cache %s: %v\n", trip.ID, err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,94 @@
+package tracking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/database"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+func TestNormalizeGPSBatch(t *testing.T) {
+	base := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	points := []indexedGPSPoint{
+		{index: 0, point: GPSBatchPoint{Timestamp: base.Add(2 * time.Minute), Speed: 30}},
+		{index: 1, point: GPSBatchPoint{Timestamp: base}},
+		{index: 2, point: GPSBatchPoint{Timestamp: base.Add(2 * time.Minute), Speed: 99}},
+		{index: 3, point: GPSBatchPoint{Timestamp: base.Add(time.Minute)}},
+	}
+
+	normalized, duplicates := normalizeGPSBatch(points)
+
+	assert.Equal(t, 1, duplicates)
+	if assert.Len(t, normalized, 3) {
+		assert.Equal(t, []int{1, 3, 0}, []int{normalized[0].index, normalized[1].index, normalized[2].index})
+		assert.Equal(t, 30.0, normalized[2].point.Speed, "keeps the first occurrence of a timestamp")
+	}
+	assert.Equal(t, 0, points[0].index, "does not reorder the input")
+}
+
+func TestFindTripAt(t *testing.T) {
+	base := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		ts := base.Add(d)
+		return &ts
+	}
+	// Newest first, as returned by tripsOverlapping
+	trips := []models.Trip{
+		{ID: "active", Status: "active", StartTime: at(3 * time.Hour)},
+		{ID: "morning", Status: "completed", StartTime: at(0), EndTime: at(2 * time.Hour)},
+	}
+
+	assert.Equal(t, "morning", findTripAt(trips, base.Add(time.Hour)).ID)
+	assert.Equal(t, "morning", findTripAt(trips, base.Add(2*time.Hour)).ID, "end time is inclusive")
+	assert.Nil(t, findTripAt(trips, base.Add(150*time.Minute)), "between trips")
+	assert.Equal(t, "active", findTripAt(trips, base.Add(5*time.Hour)).ID)
+	assert.Nil(t, findTripAt(trips, base.Add(-time.Minute)))
+}
+
+func TestService_ProcessGPSBatch_Retry(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	service := NewService(db, redisClient)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	vehicle := testutil.NewTestVehicle(company.ID)
+	require.NoError(t, db.Create(vehicle).Error)
+	driver := testutil.NewTestDriver(company.ID)
+	driver.VehicleID = &vehicle.ID
+	require.NoError(t, db.Create(driver).Error)
+
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	point := func(offset time.Duration) GPSBatchPoint {
+		return GPSBatchPoint{Latitude: -6.2088, Longitude: 106.8456, Speed: 40, Accuracy: 5, Timestamp: base.Add(offset)}
+	}
+	req := GPSBatchRequest{
+		VehicleID: vehicle.ID,
+		DriverID:  driver.ID,
+		Points:    []GPSBatchPoint{point(0), point(time.Minute)},
+	}
+
+	result, err := service.ProcessGPSBatch(req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Accepted)
+
+	// A retry carrying one new fix only stores that fix
+	req.Points = append(req.Points, point(2*time.Minute))
+	result, err = service.ProcessGPSBatch(req)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Accepted)
+	assert.Equal(t, 2, result.Duplicates)
+	if assert.NotNil(t, result.LatestTrack) {
+		assert.True(t, result.LatestTrack.Timestamp.Equal(base.Add(2*time.Minute)))
+	}
+
+	var stored int64
+	require.NoError(t, db.Model(&models.GPSTrack{}).Where("vehicle_id = ?", vehicle.ID).Count(&stored).Error)
+	assert.Equal(t, int64(3), stored)
+}
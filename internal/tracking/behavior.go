@@ -0,0 +1,613 @@
+package tracking
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+const (
+	// standardGravity converts accelerations configured in g to m/s²
+	standardGravity = 9.80665
+
+	// behaviorWindow is how much recent track is evaluated for each new fix.
+	// It bounds the minimum duration a rule can require.
+	behaviorWindow = 5 * time.Minute
+
+	// maxSpeedingSampleGap is the longest gap between fixes that still
+	// counts as continuous speeding
+	maxSpeedingSampleGap = 2 * time.Minute
+
+	// maxAccelerationSampleGap is the longest gap between two fixes used to
+	// derive acceleration. Harsh braking lasts a few seconds; averaged over
+	// longer gaps it is indistinguishable from normal driving.
+	maxAccelerationSampleGap = 15 * time.Second
+
+	// MaxBehaviorDryRunDays bounds the period a dry run replays
+	MaxBehaviorDryRunDays = 7
+
+	// maxDryRunViolations caps the violations listed in a dry run result
+	maxDryRunViolations = 500
+)
+
+// behaviorEventTypes lists the detected event types in evaluation order
+var behaviorEventTypes = []string{
+	models.BehaviorSpeedViolation,
+	models.BehaviorHarshBraking,
+	models.BehaviorRapidAcceleration,
+}
+
+// BehaviorRuleRequest configures one event type of a rule set
+type BehaviorRuleRequest struct {
+	EventType          string  `json:"event_type" validate:"required,oneof=speed_violation harsh_braking rapid_acceleration"`
+	IsEnabled          *bool   `json:"is_enabled,omitempty"`                        // defaults to true
+	Threshold          float64 `json:"threshold" validate:"required,gt=0,lt=10000"` // km/h or m/s²
+	MinDurationSeconds int     `json:"min_duration_seconds" validate:"min=0,max=300"`
+	CooldownSeconds    int     `json:"cooldown_seconds" validate:"min=0,max=86400"`
+	MediumThreshold    float64 `json:"medium_threshold" validate:"min=0,lt=10000"`
+	HighThreshold      float64 `json:"high_threshold" validate:"min=0,lt=10000"`
+	CriticalThreshold  float64 `json:"critical_threshold" validate:"min=0,lt=10000"`
+}
+
+// BehaviorRuleSetRequest creates or replaces the rule set of a vehicle type
+type BehaviorRuleSetRequest struct {
+	VehicleType *string               `json:"vehicle_type,omitempty" validate:"omitempty,max=50"` // omit for the company-wide set
+	Name        string                `json:"name" validate:"omitempty,max=100"`
+	Rules       []BehaviorRuleRequest `json:"rules" validate:"required,min=1,max=3,dive"`
+}
+
+// BehaviorDryRunRequest replays historical GPS tracks against a draft rule set
+type BehaviorDryRunRequest struct {
+	RuleSet   BehaviorRuleSetRequest `json:"rule_set" validate:"required"`
+	VehicleID *string                `json:"vehicle_id,omitempty"` // limit the replay to one vehicle
+	StartTime time.Time              `json:"start_time" validate:"required"`
+	EndTime   time.Time              `json:"end_time" validate:"required"`
+}
+
+// BehaviorRulesResponse lists a company's rule sets and the server defaults
+// used for event types they do not configure
+type BehaviorRulesResponse struct {
+	RuleSets []models.DriverBehaviorRuleSet `json:"rule_sets"`
+	Defaults []models.DriverBehaviorRule    `json:"defaults"`
+}
+
+// BehaviorViolation is a driver behavior event detected in a GPS track
+type BehaviorViolation struct {
+	VehicleID       string    `json:"vehicle_id"`
+	DriverID        *string   `json:"driver_id,omitempty"`
+	EventType       string    `json:"event_type"`
+	Severity        string    `json:"severity"`
+	Value           float64   `json:"value"` // km/h for speed violations, m/s² otherwise
+	Threshold       float64   `json:"threshold"`
+	StartedAt       time.Time `json:"started_at"`
+	DetectedAt      time.Time `json:"detected_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Latitude        float64   `json:"latitude"`
+	Longitude       float64   `json:"longitude"`
+	Speed           float64   `json:"speed"`
+}
+
+// BehaviorDryRunResult compares the events a draft rule set would have
+// raised with those of the rules currently in force
+type BehaviorDryRunResult struct {
+	VehiclesReplayed int                       `json:"vehicles_replayed"`
+	PointsReplayed   int                       `json:"points_replayed"`
+	Draft            map[string]map[string]int `json:"draft"`   // event type -> severity -> count
+	Current          map[string]map[string]int `json:"current"` // same, under the rules in force
+	Violations       []BehaviorViolation       `json:"violations"`
+	Truncated        bool                      `json:"truncated"` // more violations than listed
+}
+
+// DefaultBehaviorRules builds the rules used for event types a company has
+// not configured. Speeds are in km/h; braking and acceleration thresholds are
+// in g, as in the HARSH_BRAKING_THRESHOLD and RAPID_ACCELERATION_THRESHOLD
+// settings.
+//
+// Speeding is medium more than 10 km/h over the limit, high more than 20 km/h
+// over it and critical above the highway limit; with the 80 and 120 km/h
+// defaults these are the original 90, 100 and 120 km/h bands.
+func DefaultBehaviorRules(speedLimit, highwaySpeedLimit int, harshBrakingG, rapidAccelerationG float64) []models.DriverBehaviorRule {
+	limit := float64(speedLimit)
+	critical := float64(highwaySpeedLimit)
+	if critical < limit+20 {
+		critical = limit + 20
+	}
+	braking := harshBrakingG * standardGravity
+	acceleration := rapidAccelerationG * standardGravity
+
+	return []models.DriverBehaviorRule{
+		{
+			EventType:         models.BehaviorSpeedViolation,
+			IsEnabled:         true,
+			Threshold:         limit,
+			CooldownSeconds:   300,
+			MediumThreshold:   limit + 10,
+			HighThreshold:     limit + 20,
+			CriticalThreshold: critical,
+		},
+		{
+			EventType:         models.BehaviorHarshBraking,
+			IsEnabled:         true,
+			Threshold:         braking,
+			CooldownSeconds:   30,
+			MediumThreshold:   braking,
+			HighThreshold:     braking * 1.25,
+			CriticalThreshold: braking * 1.5,
+		},
+		{
+			EventType:         models.BehaviorRapidAcceleration,
+			IsEnabled:         true,
+			Threshold:         acceleration,
+			CooldownSeconds:   30,
+			MediumThreshold:   acceleration,
+			HighThreshold:     acceleration * 1.2,
+			CriticalThreshold: acceleration * 1.4,
+		},
+	}
+}
+
+// SetDefaultBehaviorRules sets the rules used for event types a company has
+// not configured
+func (s *Service) SetDefaultBehaviorRules(rules []models.DriverBehaviorRule) {
+	if len(rules) > 0 {
+		s.behaviorDefaults = rules
+	}
+}
+
+// GetBehaviorRules lists a company's driver behavior rule sets
+func (s *Service) GetBehaviorRules(companyID string) (*BehaviorRulesResponse, error) {
+	var ruleSets []models.DriverBehaviorRuleSet
+	if err := s.db.Preload("Rules").Where("company_id = ?", companyID).
+		Order("vehicle_type NULLS FIRST").Find(&ruleSets).Error; err != nil {
+		return nil, apperrors.Wrap(err, "failed to get behavior rules")
+	}
+
+	return &BehaviorRulesResponse{RuleSets: ruleSets, Defaults: s.behaviorDefaults}, nil
+}
+
+// SaveBehaviorRuleSet creates or replaces the rule set of a company for a
+// vehicle type, or its company-wide set when no vehicle type is given
+func (s *Service) SaveBehaviorRuleSet(companyID string, req BehaviorRuleSetRequest) (*models.DriverBehaviorRuleSet, error) {
+	rules, err := behaviorRulesFromRequest(req.Rules)
+	if err != nil {
+		return nil, err
+	}
+	vehicleType := normalizeVehicleType(req.VehicleType)
+
+	var ruleSet models.DriverBehaviorRuleSet
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("company_id = ?", companyID)
+		if vehicleType == nil {
+			query = query.Where("vehicle_type IS NULL")
+		} else {
+			query = query.Where("vehicle_type = ?", *vehicleType)
+		}
+
+		err := query.First(&ruleSet).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ruleSet = models.DriverBehaviorRuleSet{CompanyID: companyID, VehicleType: vehicleType, Name: req.Name}
+			if err := tx.Omit("Rules").Create(&ruleSet).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			if err := tx.Model(&ruleSet).Update("name", req.Name).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("rule_set_id = ?", ruleSet.ID).Delete(&models.DriverBehaviorRule{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for i := range rules {
+			rules[i].RuleSetID = ruleSet.ID
+		}
+		if err := tx.Create(&rules).Error; err != nil {
+			return err
+		}
+		ruleSet.Rules = rules
+		return nil
+	})
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to save behavior rules")
+	}
+
+	return &ruleSet, nil
+}
+
+// DeleteBehaviorRuleSet deletes a rule set; its vehicles fall back to the
+// company-wide set or the server defaults
+func (s *Service) DeleteBehaviorRuleSet(companyID, ruleSetID string) error {
+	result := s.db.Where("company_id = ? AND id = ?", companyID, ruleSetID).Delete(&models.DriverBehaviorRuleSet{})
+	if result.Error != nil {
+		return apperrors.Wrap(result.Error, "failed to delete behavior rules")
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.NewNotFoundError("behavior rule set")
+	}
+	return nil
+}
+
+// DryRunBehaviorRules replays a company's GPS tracks over a period against a
+// draft rule set without saving it or raising events
+func (s *Service) DryRunBehaviorRules(companyID string, req BehaviorDryRunRequest) (*BehaviorDryRunResult, error) {
+	if !req.EndTime.After(req.StartTime) {
+		return nil, apperrors.NewValidationError("end_time must be after start_time")
+	}
+	if req.EndTime.Sub(req.StartTime) > MaxBehaviorDryRunDays*24*time.Hour {
+		return nil, apperrors.NewValidationError(fmt.Sprintf("dry runs cover at most %d days", MaxBehaviorDryRunDays))
+	}
+	draft, err := behaviorRulesFromRequest(req.RuleSet.Rules)
+	if err != nil {
+		return nil, err
+	}
+	vehicleType := normalizeVehicleType(req.RuleSet.VehicleType)
+
+	// A type-specific draft falls back to the company-wide set, like a saved one
+	var fallback []models.DriverBehaviorRule
+	if vehicleType != nil {
+		var ruleSet models.DriverBehaviorRuleSet
+		err := s.db.Preload("Rules").Where("company_id = ? AND vehicle_type IS NULL", companyID).First(&ruleSet).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.Wrap(err, "failed to get behavior rules")
+		}
+		fallback = ruleSet.Rules
+	}
+	draftRules := mergeBehaviorRules(draft, fallback, s.behaviorDefaults)
+
+	query := s.db.Where("company_id = ?", companyID)
+	if req.VehicleID != nil {
+		query = query.Where("id = ?", *req.VehicleID)
+	}
+	if vehicleType != nil {
+		query = query.Where("LOWER(type) = ?", *vehicleType)
+	}
+	var vehicles []models.Vehicle
+	if err := query.Find(&vehicles).Error; err != nil {
+		return nil, apperrors.Wrap(err, "failed to get vehicles")
+	}
+	if req.VehicleID != nil && len(vehicles) == 0 {
+		return nil, apperrors.NewNotFoundError("vehicle")
+	}
+
+	result := &BehaviorDryRunResult{
+		Draft:      make(map[string]map[string]int),
+		Current:    make(map[string]map[string]int),
+		Violations: []BehaviorViolation{},
+	}
+	for _, vehicle := range vehicles {
+		currentRules, err := s.behaviorRules(companyID, vehicle.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		var tracks []models.GPSTrack
+		// Road speed limits are replayed as recorded when the fixes arrived
+		if err := s.db.Select("vehicle_id", "driver_id", "latitude", "longitude", "speed", "speed_limit", "timestamp").
+			Where("vehicle_id = ? AND timestamp BETWEEN ? AND ?", vehicle.ID, req.StartTime, req.EndTime).
+			Order("timestamp ASC").Find(&tracks).Error; err != nil {
+			return nil, apperrors.Wrap(err, "failed to get GPS tracks")
+		}
+		if len(tracks) == 0 {
+			continue
+		}
+		result.VehiclesReplayed++
+		result.PointsReplayed += len(tracks)
+
+		for _, violation := range replayBehavior(draftRules, tracks) {
+			countViolation(result.Draft, violation)
+			if len(result.Violations) < maxDryRunViolations {
+				result.Violations = append(result.Violations, violation)
+			} else {
+				result.Truncated = true
+			}
+		}
+		for _, violation := range replayBehavior(currentRules, tracks) {
+			countViolation(result.Current, violation)
+		}
+	}
+
+	return result, nil
+}
+
+// behaviorRules returns the rules in force for a vehicle type of a company:
+// its rule set for the type, then its company-wide set, then the server
+// defaults, per event type
+func (s *Service) behaviorRules(companyID, vehicleType string) ([]models.DriverBehaviorRule, error) {
+	var ruleSets []models.DriverBehaviorRuleSet
+	if err := s.db.Preload("Rules").
+		Where("company_id = ? AND (vehicle_type = ? OR vehicle_type IS NULL)", companyID, strings.ToLower(strings.TrimSpace(vehicleType))).
+		Order("vehicle_type NULLS LAST").Find(&ruleSets).Error; err != nil {
+		return nil, apperrors.Wrap(err, "failed to get behavior rules")
+	}
+
+	layers := make([][]models.DriverBehaviorRule, 0, len(ruleSets)+1)
+	for _, ruleSet := range ruleSets {
+		layers = append(layers, ruleSet.Rules)
+	}
+	layers = append(layers, s.behaviorDefaults)
+	return mergeBehaviorRules(layers...), nil
+}
+
+// behaviorCooldowns returns when the latest event of each type was raised
+// for a vehicle, as far back as the longest cooldown reaches
+func (s *Service) behaviorCooldowns(vehicleID string, rules []models.DriverBehaviorRule, at time.Time) map[string]time.Time {
+	cooldowns := make(map[string]time.Time)
+
+	longest := 0
+	for _, rule := range rules {
+		if rule.CooldownSeconds > longest {
+			longest = rule.CooldownSeconds
+		}
+	}
+	if longest == 0 {
+		return cooldowns
+	}
+
+	var latest []struct {
+		EventType string
+		CreatedAt time.Time
+	}
+	if err := s.db.Model(&models.DriverEvent{}).
+		Select("event_type, MAX(created_at) AS created_at").
+		Where("vehicle_id = ? AND created_at > ?", vehicleID, at.Add(-time.Duration(longest)*time.Second)).
+		Group("event_type").Scan(&latest).Error; err != nil {
+		fmt.Printf("Failed to get driver event cooldowns: %v\n", err)
+		return cooldowns
+	}
+	for _, event := range latest {
+		cooldowns[event.EventType] = event.CreatedAt
+	}
+	return cooldowns
+}
+
+// behaviorRulesFromRequest validates the rules of a rule set request
+func behaviorRulesFromRequest(requests []BehaviorRuleRequest) ([]models.DriverBehaviorRule, error) {
+	rules := make([]models.DriverBehaviorRule, 0, len(requests))
+	seen := make(map[string]bool)
+	for _, req := range requests {
+		if seen[req.EventType] {
+			return nil, apperrors.NewValidationError("duplicate rule for " + req.EventType)
+		}
+		seen[req.EventType] = true
+
+		// Severity bands must be ascending and start at the threshold
+		previous := req.Threshold
+		for _, band := range []float64{req.MediumThreshold, req.HighThreshold, req.CriticalThreshold} {
+			if band == 0 {
+				continue
+			}
+			if band < previous {
+				return nil, apperrors.NewValidationError(req.EventType + " severity bands must be ascending and not below the threshold")
+			}
+			previous = band
+		}
+
+		isEnabled := true
+		if req.IsEnabled != nil {
+			isEnabled = *req.IsEnabled
+		}
+		rules = append(rules, models.DriverBehaviorRule{
+			EventType:          req.EventType,
+			IsEnabled:          isEnabled,
+			Threshold:          req.Threshold,
+			MinDurationSeconds: req.MinDurationSeconds,
+			CooldownSeconds:    req.CooldownSeconds,
+			MediumThreshold:    req.MediumThreshold,
+			HighThreshold:      req.HighThreshold,
+			CriticalThreshold:  req.CriticalThreshold,
+		})
+	}
+	return rules, nil
+}
+
+// mergeBehaviorRules picks each event type's rule from the first layer that
+// configures it
+func mergeBehaviorRules(layers ...[]models.DriverBehaviorRule) []models.DriverBehaviorRule {
+	merged := make([]models.DriverBehaviorRule, 0, len(behaviorEventTypes))
+	for _, eventType := range behaviorEventTypes {
+	layers:
+		for _, layer := range layers {
+			for _, rule := range layer {
+				if rule.EventType == eventType {
+					merged = append(merged, rule)
+					break layers
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// normalizeVehicleType lower-cases a vehicle type, treating blank as none
+func normalizeVehicleType(vehicleType *string) *string {
+	if vehicleType == nil {
+		return nil
+	}
+	normalized := strings.ToLower(strings.TrimSpace(*vehicleType))
+	if normalized == "" {
+		return nil
+	}
+	return &normalized
+}
+
+// replayBehavior evaluates every fix of a vehicle's track, oldest first, as
+// if it had just arrived
+func replayBehavior(rules []models.DriverBehaviorRule, tracks []models.GPSTrack) []BehaviorViolation {
+	evaluator := newBehaviorEvaluator(rules, nil)
+
+	var violations []BehaviorViolation
+	start := 0
+	for i := range tracks {
+		for tracks[i].Timestamp.Sub(tracks[start].Timestamp) > behaviorWindow {
+			start++
+		}
+		// Live evaluation only covers fixes with a driver
+		if tracks[i].DriverID == nil {
+			continue
+		}
+		violations = append(violations, evaluator.evaluate(tracks[start:i+1])...)
+	}
+	return violations
+}
+
+// countViolation adds a violation to per event type and severity counts
+func countViolation(counts map[string]map[string]int, violation BehaviorViolation) {
+	if counts[violation.EventType] == nil {
+		counts[violation.EventType] = make(map[string]int)
+	}
+	counts[violation.EventType][violation.Severity]++
+}
+
+// behaviorEvaluator detects driver behavior events in a vehicle's track,
+// holding back events of a type during its cooldown
+type behaviorEvaluator struct {
+	rules     []models.DriverBehaviorRule
+	lastEvent map[string]time.Time
+}
+
+// newBehaviorEvaluator creates an evaluator, with the times events were last
+// raised if known
+func newBehaviorEvaluator(rules []models.DriverBehaviorRule, lastEvent map[string]time.Time) *behaviorEvaluator {
+	if lastEvent == nil {
+		lastEvent = make(map[string]time.Time)
+	}
+	return &behaviorEvaluator{rules: rules, lastEvent: lastEvent}
+}
+
+// evaluate returns the events raised by the newest fix of window, a recent
+// stretch of one vehicle's track sorted oldest first
+func (e *behaviorEvaluator) evaluate(window []models.GPSTrack) []BehaviorViolation {
+	if len(window) == 0 {
+		return nil
+	}
+	latest := &window[len(window)-1]
+
+	var violations []BehaviorViolation
+	for i := range e.rules {
+		rule := &e.rules[i]
+		if !rule.IsEnabled {
+			continue
+		}
+		if last, ok := e.lastEvent[rule.EventType]; ok &&
+			latest.Timestamp.Sub(last) < time.Duration(rule.CooldownSeconds)*time.Second {
+			continue
+		}
+
+		var violation *BehaviorViolation
+		switch rule.EventType {
+		case models.BehaviorSpeedViolation:
+			violation = detectSpeeding(rule, window)
+		case models.BehaviorHarshBraking:
+			violation = detectAcceleration(rule, window, -1)
+		case models.BehaviorRapidAcceleration:
+			violation = detectAcceleration(rule, window, 1)
+		}
+		if violation == nil {
+			continue
+		}
+
+		violation.VehicleID = latest.VehicleID
+		violation.DriverID = latest.DriverID
+		violation.EventType = rule.EventType
+		if violation.Threshold == 0 {
+			violation.Threshold = rule.Threshold
+		}
+		// Severity bands are set relative to the rule's threshold, so a lower
+		// road limit grades by how far the value exceeds that limit
+		violation.Severity = rule.Severity(violation.Value + rule.Threshold - violation.Threshold)
+		violation.DetectedAt = latest.Timestamp
+		violation.DurationSeconds = latest.Timestamp.Sub(violation.StartedAt).Seconds()
+		violation.Latitude = latest.Latitude
+		violation.Longitude = latest.Longitude
+		violation.Speed = latest.Speed
+
+		e.lastEvent[rule.EventType] = latest.Timestamp
+		violations = append(violations, *violation)
+	}
+	return violations
+}
+
+// detectSpeeding reports a speed violation when the vehicle has been above
+// the speed limit for at least the rule's minimum duration up to the newest
+// fix. The limit is the rule's threshold, or the posted limit of the road a
+// fix was matched to when lower.
+func detectSpeeding(rule *models.DriverBehaviorRule, window []models.GPSTrack) *BehaviorViolation {
+	last := len(window) - 1
+	limit := speedLimitAt(rule, &window[last])
+	if window[last].Speed <= limit {
+		return nil
+	}
+
+	start := last
+	maxSpeed := window[last].Speed
+	for start > 0 &&
+		window[start-1].Speed > speedLimitAt(rule, &window[start-1]) &&
+		window[start].Timestamp.Sub(window[start-1].Timestamp) <= maxSpeedingSampleGap {
+		start--
+		if window[start].Speed > maxSpeed {
+			maxSpeed = window[start].Speed
+		}
+	}
+
+	if window[last].Timestamp.Sub(window[start].Timestamp) < time.Duration(rule.MinDurationSeconds)*time.Second {
+		return nil
+	}
+	return &BehaviorViolation{Value: maxSpeed, Threshold: limit, StartedAt: window[start].Timestamp}
+}
+
+// speedLimitAt returns the speed above which a fix is speeding under a rule
+func speedLimitAt(rule *models.DriverBehaviorRule, fix *models.GPSTrack) float64 {
+	if fix.SpeedLimit > 0 && fix.SpeedLimit < rule.Threshold {
+		return fix.SpeedLimit
+	}
+	return rule.Threshold
+}
+
+// detectAcceleration reports harsh braking (sign -1) or rapid acceleration
+// (sign 1) when the acceleration between consecutive fixes has exceeded the
+// threshold for at least the rule's minimum duration up to the newest fix.
+// Speeds are in km/h; the threshold is in m/s².
+func detectAcceleration(rule *models.DriverBehaviorRule, window []models.GPSTrack, sign float64) *BehaviorViolation {
+	acceleration := func(i int) (float64, bool) {
+		dt := window[i].Timestamp.Sub(window[i-1].Timestamp)
+		if dt <= 0 || dt > maxAccelerationSampleGap {
+			return 0, false
+		}
+		return sign * (window[i].Speed - window[i-1].Speed) / 3.6 / dt.Seconds(), true
+	}
+
+	last := len(window) - 1
+	if last < 1 {
+		return nil
+	}
+	value, ok := acceleration(last)
+	if !ok || value <= rule.Threshold {
+		return nil
+	}
+
+	start := last - 1
+	for start > 0 {
+		a, ok := acceleration(start)
+		if !ok || a <= rule.Threshold {
+			break
+		}
+		if a > value {
+			value = a
+		}
+		start--
+	}
+
+	if window[last].Timestamp.Sub(window[start].Timestamp) < time.Duration(rule.MinDurationSeconds)*time.Second {
+		return nil
+	}
+	return &BehaviorViolation{Value: value, StartedAt: window[start].Timestamp}
+}
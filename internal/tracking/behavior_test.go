@@ -0,0 +1,365 @@
+package tracking
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// behaviorTrack builds one fix per second with the given speeds in km/h
+func behaviorTrack(start time.Time, speeds ...float64) []models.GPSTrack {
+	driverID := "driver-1"
+	tracks := make([]models.GPSTrack, len(speeds))
+	for i, speed := range speeds {
+		tracks[i] = models.GPSTrack{
+			VehicleID: "vehicle-1",
+			DriverID:  &driverID,
+			Speed:     speed,
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+		}
+	}
+	return tracks
+}
+
+func TestDefaultBehaviorRules(t *testing.T) {
+	rules := DefaultBehaviorRules(80, 120, 0.4, 0.3)
+	require.Len(t, rules, 3)
+
+	// The original speeding bands: over 80, 90, 100 and 120 km/h
+	assert.Equal(t, models.BehaviorSpeedViolation, rules[0].EventType)
+	assert.Equal(t, 80.0, rules[0].Threshold)
+	assert.Equal(t, 90.0, rules[0].MediumThreshold)
+	assert.Equal(t, 100.0, rules[0].HighThreshold)
+	assert.Equal(t, 120.0, rules[0].CriticalThreshold)
+	assert.Zero(t, rules[0].MinDurationSeconds, "a single fix over the limit is speeding")
+
+	// Thresholds configured in g are converted to m/s²
+	assert.InDelta(t, 3.92, rules[1].Threshold, 0.01)
+	assert.InDelta(t, 2.94, rules[2].Threshold, 0.01)
+}
+
+func TestDetectAcceleration_UsesMetersPerSecondSquared(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	rule := &models.DriverBehaviorRule{EventType: models.BehaviorHarshBraking, IsEnabled: true, Threshold: 3.92}
+
+	// 60 -> 50 km/h in one second is 2.8 m/s², normal braking
+	assert.Nil(t, detectAcceleration(rule, behaviorTrack(start, 60, 50), -1))
+
+	// 60 -> 40 km/h in one second is 5.6 m/s²
+	violation := detectAcceleration(rule, behaviorTrack(start, 60, 40), -1)
+	require.NotNil(t, violation)
+	assert.InDelta(t, 5.56, violation.Value, 0.01)
+
+	// The same drop spread over ten seconds is not harsh
+	slow := behaviorTrack(start, 60, 40)
+	slow[1].Timestamp = start.Add(10 * time.Second)
+	assert.Nil(t, detectAcceleration(rule, slow, -1))
+
+	// Gaps too long to derive acceleration from are ignored
+	gap := behaviorTrack(start, 60, 0)
+	gap[1].Timestamp = start.Add(time.Minute)
+	assert.Nil(t, detectAcceleration(rule, gap, -1))
+}
+
+func TestDetectAcceleration_MinDuration(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	rule := &models.DriverBehaviorRule{EventType: models.BehaviorRapidAcceleration, IsEnabled: true, Threshold: 2.5, MinDurationSeconds: 2}
+
+	assert.Nil(t, detectAcceleration(rule, behaviorTrack(start, 20, 20, 35), 1), "one second of acceleration")
+
+	violation := detectAcceleration(rule, behaviorTrack(start, 20, 20, 35, 50), 1)
+	require.NotNil(t, violation)
+	assert.Equal(t, start.Add(time.Second), violation.StartedAt)
+}
+
+func TestDetectSpeeding_MinDuration(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	rule := &models.DriverBehaviorRule{EventType: models.BehaviorSpeedViolation, IsEnabled: true, Threshold: 80, MinDurationSeconds: 3}
+
+	assert.Nil(t, detectSpeeding(rule, behaviorTrack(start, 70, 85, 90, 88)), "above the limit for two seconds")
+
+	violation := detectSpeeding(rule, behaviorTrack(start, 70, 85, 90, 88, 86))
+	require.NotNil(t, violation)
+	assert.Equal(t, 90.0, violation.Value)
+	assert.Equal(t, start.Add(time.Second), violation.StartedAt)
+
+	assert.Nil(t, detectSpeeding(rule, behaviorTrack(start, 85, 90, 88, 86, 75)), "back under the limit")
+}
+
+func TestBehaviorEvaluator_Cooldown(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	rules := []models.DriverBehaviorRule{
+		{EventType: models.BehaviorSpeedViolation, IsEnabled: true, Threshold: 80, CooldownSeconds: 60, MediumThreshold: 90},
+	}
+
+	speeds := make([]float64, 120)
+	for i := range speeds {
+		speeds[i] = 95
+	}
+	violations := replayBehavior(rules, behaviorTrack(start, speeds...))
+
+	require.Len(t, violations, 2)
+	assert.Equal(t, start, violations[0].DetectedAt)
+	assert.Equal(t, start.Add(time.Minute), violations[1].DetectedAt)
+	assert.Equal(t, "medium", violations[0].Severity)
+	assert.Equal(t, "vehicle-1", violations[0].VehicleID)
+}
+
+func TestBehaviorEvaluator_SkipsDisabledRules(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	rules := []models.DriverBehaviorRule{
+		{EventType: models.BehaviorSpeedViolation, IsEnabled: false, Threshold: 80},
+	}
+
+	assert.Empty(t, newBehaviorEvaluator(rules, nil).evaluate(behaviorTrack(start, 120)))
+}
+
+func TestMergeBehaviorRules(t *testing.T) {
+	defaults := DefaultBehaviorRules(100, 120, 0.4, 0.3)
+	truck := []models.DriverBehaviorRule{{EventType: models.BehaviorSpeedViolation, IsEnabled: true, Threshold: 80}}
+	company := []models.DriverBehaviorRule{
+		{EventType: models.BehaviorSpeedViolation, IsEnabled: true, Threshold: 90},
+		{EventType: models.BehaviorHarshBraking, IsEnabled: false, Threshold: 5},
+	}
+
+	merged := mergeBehaviorRules(truck, company, defaults)
+
+	require.Len(t, merged, 3)
+	assert.Equal(t, 80.0, merged[0].Threshold, "vehicle type set wins")
+	assert.False(t, merged[1].IsEnabled, "company set disables harsh braking")
+	assert.Equal(t, defaults[2], merged[2], "server default fills the gap")
+}
+
+func TestBehaviorRulesFromRequest(t *testing.T) {
+	_, err := behaviorRulesFromRequest([]BehaviorRuleRequest{
+		{EventType: models.BehaviorSpeedViolation, Threshold: 80},
+		{EventType: models.BehaviorSpeedViolation, Threshold: 90},
+	})
+	assert.Error(t, err, "duplicate event type")
+
+	_, err = behaviorRulesFromRequest([]BehaviorRuleRequest{
+		{EventType: models.BehaviorSpeedViolation, Threshold: 80, MediumThreshold: 100, HighThreshold: 90},
+	})
+	assert.Error(t, err, "descending severity bands")
+
+	disabled := false
+	rules, err := behaviorRulesFromRequest([]BehaviorRuleRequest{
+		{EventType: models.BehaviorSpeedViolation, Threshold: 60, MediumThreshold: 70, CriticalThreshold: 90},
+		{EventType: models.BehaviorHarshBraking, IsEnabled: &disabled, Threshold: 3},
+	})
+	require.NoError(t, err)
+	assert.True(t, rules[0].IsEnabled)
+	assert.False(t, rules[1].IsEnabled)
+}
+
+func TestDetectSpeeding_RoadSpeedLimit(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	rule := &models.DriverBehaviorRule{EventType: models.BehaviorSpeedViolation, IsEnabled: true, Threshold: 80}
+
+	// 60 km/h on a 40 km/h street
+	track := behaviorTrack(start, 60, 60)
+	assert.Nil(t, detectSpeeding(rule, track), "no road limit known")
+
+	for i := range track {
+		track[i].SpeedLimit = 40
+	}
+	violation := detectSpeeding(rule, track)
+	require.NotNil(t, violation)
+	assert.Equal(t, 40.0, violation.Threshold)
+
+	// A road limit above the rule's threshold does not raise it
+	for i := range track {
+		track[i].SpeedLimit = 100
+		track[i].Speed = 90
+	}
+	violation = detectSpeeding(rule, track)
+	require.NotNil(t, violation)
+	assert.Equal(t, 80.0, violation.Threshold)
+}
+
+func TestBehaviorEvaluator_SeverityAgainstRoadLimit(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	rules := DefaultBehaviorRules(80, 120, 0.4, 0.3)[:1]
+
+	// 25 km/h over a 50 km/h limit grades like 105 km/h against the rule's 80
+	track := behaviorTrack(start, 75, 75, 75, 75, 75, 75, 75, 75, 75, 75, 75)
+	for i := range track {
+		track[i].SpeedLimit = 50
+	}
+	violations := newBehaviorEvaluator(rules, nil).evaluate(track)
+
+	require.Len(t, violations, 1)
+	assert.Equal(t, 50.0, violations[0].Threshold)
+	assert.Equal(t, "high", violations[0].Severity)
+}
+
+// behaviorRule returns the rule of an event type
+func behaviorRule(t *testing.T, rules []models.DriverBehaviorRule, eventType string) models.DriverBehaviorRule {
+	t.Helper()
+	for _, rule := range rules {
+		if rule.EventType == eventType {
+			return rule
+		}
+	}
+	require.Failf(t, "missing rule", "no %s rule", eventType)
+	return models.DriverBehaviorRule{}
+}
+
+func TestService_BehaviorRuleSets(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db, nil)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	otherCompany := testutil.NewTestCompany()
+	require.NoError(t, db.Create(otherCompany).Error)
+
+	truck := " Truck "
+	companyWide, err := service.SaveBehaviorRuleSet(company.ID, BehaviorRuleSetRequest{
+		Name:  "Fleet",
+		Rules: []BehaviorRuleRequest{{EventType: models.BehaviorSpeedViolation, Threshold: 90, MediumThreshold: 100}},
+	})
+	require.NoError(t, err)
+	testutil.AssertValidUUID(t, companyWide.ID)
+	assert.Nil(t, companyWide.VehicleType)
+	require.Len(t, companyWide.Rules, 1)
+	assert.Equal(t, companyWide.ID, companyWide.Rules[0].RuleSetID)
+	assert.True(t, companyWide.Rules[0].IsEnabled)
+
+	trucks, err := service.SaveBehaviorRuleSet(company.ID, BehaviorRuleSetRequest{
+		VehicleType: &truck,
+		Name:        "Trucks",
+		Rules:       []BehaviorRuleRequest{{EventType: models.BehaviorHarshBraking, Threshold: 3}},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, trucks.VehicleType)
+	assert.Equal(t, "truck", *trucks.VehicleType)
+
+	t.Run("saving again replaces the rules of the set", func(t *testing.T) {
+		replaced, err := service.SaveBehaviorRuleSet(company.ID, BehaviorRuleSetRequest{
+			Name: "Fleet 2025",
+			Rules: []BehaviorRuleRequest{
+				{EventType: models.BehaviorSpeedViolation, Threshold: 85},
+				{EventType: models.BehaviorRapidAcceleration, Threshold: 2.5},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, companyWide.ID, replaced.ID)
+
+		var rules []models.DriverBehaviorRule
+		require.NoError(t, db.Where("rule_set_id = ?", companyWide.ID).Find(&rules).Error)
+		assert.Len(t, rules, 2)
+		assert.Equal(t, 85.0, behaviorRule(t, rules, models.BehaviorSpeedViolation).Threshold)
+	})
+
+	t.Run("invalid rules are not saved", func(t *testing.T) {
+		_, err := service.SaveBehaviorRuleSet(company.ID, BehaviorRuleSetRequest{
+			Rules: []BehaviorRuleRequest{
+				{EventType: models.BehaviorHarshBraking, Threshold: 3},
+				{EventType: models.BehaviorHarshBraking, Threshold: 4},
+			},
+		})
+		assertAppErrorStatus(t, err, http.StatusBadRequest)
+
+		var rules []models.DriverBehaviorRule
+		require.NoError(t, db.Where("rule_set_id = ?", companyWide.ID).Find(&rules).Error)
+		assert.Len(t, rules, 2)
+	})
+
+	t.Run("list rule sets", func(t *testing.T) {
+		response, err := service.GetBehaviorRules(company.ID)
+		require.NoError(t, err)
+		require.Len(t, response.RuleSets, 2)
+		assert.Nil(t, response.RuleSets[0].VehicleType, "company-wide set first")
+		assert.Equal(t, "Fleet 2025", response.RuleSets[0].Name)
+		assert.Len(t, response.RuleSets[0].Rules, 2)
+		assert.Len(t, response.RuleSets[1].Rules, 1)
+		assert.Len(t, response.Defaults, 3)
+
+		others, err := service.GetBehaviorRules(otherCompany.ID)
+		require.NoError(t, err)
+		assert.Empty(t, others.RuleSets)
+	})
+
+	t.Run("rules in force layer type, company-wide set and defaults", func(t *testing.T) {
+		rules, err := service.behaviorRules(company.ID, "TRUCK")
+		require.NoError(t, err)
+		require.Len(t, rules, 3)
+		assert.Equal(t, 85.0, behaviorRule(t, rules, models.BehaviorSpeedViolation).Threshold)
+		assert.Equal(t, 3.0, behaviorRule(t, rules, models.BehaviorHarshBraking).Threshold)
+		assert.Equal(t, 2.5, behaviorRule(t, rules, models.BehaviorRapidAcceleration).Threshold)
+
+		rules, err = service.behaviorRules(company.ID, "van")
+		require.NoError(t, err)
+		assert.InDelta(t, 0.4*standardGravity, behaviorRule(t, rules, models.BehaviorHarshBraking).Threshold, 0.001)
+
+		rules, err = service.behaviorRules(otherCompany.ID, "truck")
+		require.NoError(t, err)
+		assert.Equal(t, 80.0, behaviorRule(t, rules, models.BehaviorSpeedViolation).Threshold)
+	})
+
+	t.Run("delete rule set", func(t *testing.T) {
+		err := service.DeleteBehaviorRuleSet(otherCompany.ID, trucks.ID)
+		assertAppErrorStatus(t, err, http.StatusNotFound)
+
+		require.NoError(t, service.DeleteBehaviorRuleSet(company.ID, trucks.ID))
+
+		rules, err := service.behaviorRules(company.ID, "truck")
+		require.NoError(t, err)
+		assert.InDelta(t, 0.4*standardGravity, behaviorRule(t, rules, models.BehaviorHarshBraking).Threshold, 0.001)
+
+		err = service.DeleteBehaviorRuleSet(company.ID, trucks.ID)
+		assertAppErrorStatus(t, err, http.StatusNotFound)
+	})
+}
+
+func TestService_DryRunBehaviorRules_StoredRoadSpeedLimits(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db, nil)
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	matched := createTestVehicle(t, db, company.ID)
+	unmatched := createTestVehicle(t, db, company.ID)
+
+	// 60 km/h, on a 40 km/h street for the map-matched vehicle
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, vehicle := range []*models.Vehicle{matched, unmatched} {
+		for i, fix := range behaviorTrack(start, 60, 60, 60) {
+			fix.VehicleID = vehicle.ID
+			fix.DriverID = nil
+			fix.Latitude, fix.Longitude = -6.2088, 106.8456
+			if vehicle == matched {
+				fix.SpeedLimit = 40
+			}
+			require.NoError(t, db.Create(&fix).Error, "fix %d", i)
+		}
+	}
+
+	result, err := service.DryRunBehaviorRules(company.ID, BehaviorDryRunRequest{
+		RuleSet: BehaviorRuleSetRequest{
+			Rules: []BehaviorRuleRequest{{EventType: models.BehaviorSpeedViolation, Threshold: 80, CooldownSeconds: 300}},
+		},
+		StartTime: start.Add(-time.Minute),
+		EndTime:   start.Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, result.VehiclesReplayed)
+	assert.Equal(t, 6, result.PointsReplayed)
+	require.Len(t, result.Violations, 1)
+	assert.Equal(t, matched.ID, result.Violations[0].VehicleID)
+	assert.Equal(t, 40.0, result.Violations[0].Threshold)
+	assert.Equal(t, 1, result.Draft[models.BehaviorSpeedViolation]["low"])
+	assert.Equal(t, 1, result.Current[models.BehaviorSpeedViolation]["medium"])
+}
@@ -4,13 +4,17 @@ import (
 	std_errors "errors" // Alias standard errors to avoid conflict
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"gorm.io/gorm"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/mapmatch"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/realtime"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/reports"
 	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
@@ -19,6 +23,7 @@ import (
 type Handler struct {
 	service   *Service
 	validator *validator.Validate
+	reports   *reports.Service
 }
 
 // NewHandler creates a new tracking handler
@@ -29,6 +34,12 @@ func NewHandler(service *Service) *Handler {
 	}
 }
 
+// SetReportService enables generated reports, which are kept in blob storage
+// by background jobs
+func (h *Handler) SetReportService(reportService *reports.Service) {
+	h.reports = reportService
+}
+
 // SuccessResponse represents a success response
 type SuccessResponse struct {
 	Success bool        `json:"success"`
@@ -70,6 +81,7 @@ type Meta struct {
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/tracking/gps [post]
 // @Security BearerAuth
@@ -104,6 +116,105 @@ func (h *Handler) ProcessGPSData(c *gin.Context) {
 	})
 }
 
+// ProcessGPSBatch godoc
+// @Summary Submit a batch of GPS data
+// @Description Submit up to 1000 buffered GPS fixes from one device, e.g. after an offline period. Points are sorted and deduplicated by timestamp and stored in one transaction; rejected points are reported individually
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param batch body GPSBatchRequest true "GPS batch"
+// @Success 200 {object} SuccessResponse{data=GPSBatchResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/tracking/gps/batch [post]
+// @Security BearerAuth
+func (h *Handler) ProcessGPSBatch(c *gin.Context) {
+	var req GPSBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, "invalid request data")
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		middleware.AbortWithValidation(c, err.Error())
+		return
+	}
+
+	result, err := h.service.ProcessGPSBatch(req)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to process GPS batch", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    result,
+		Message: "GPS batch processed successfully",
+	})
+}
+
+// ProcessDeviceGPSBatch godoc
+// @Summary Submit GPS data as a device
+// @Description Submit up to 1000 GPS fixes authenticated with a device API key instead of a user token. The vehicle is taken from the device's binding and the fixes are attributed to the vehicle's assigned driver, if any
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param X-Device-Key header string true "Device API key"
+// @Param batch body DeviceGPSBatchRequest true "GPS batch"
+// @Success 200 {object} SuccessResponse{data=GPSBatchResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/device/gps [post]
+func (h *Handler) ProcessDeviceGPSBatch(c *gin.Context) {
+	deviceID, exists := c.Get("device_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "device not authenticated")
+		return
+	}
+	vehicleID, bound := c.Get("vehicle_id")
+	if !bound {
+		middleware.AbortWithBadRequest(c, "device is not bound to a vehicle")
+		return
+	}
+
+	var req DeviceGPSBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, "invalid request data")
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		middleware.AbortWithValidation(c, err.Error())
+		return
+	}
+
+	result, err := h.service.ProcessDeviceGPSBatch(deviceID.(string), vehicleID.(string), req.Points)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to process GPS batch", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    result,
+		Message: "GPS batch processed successfully",
+	})
+}
+
 // GetCurrentLocation godoc
 // @Summary Get current vehicle location
 // @Description Get the current location of a vehicle
@@ -285,7 +396,7 @@ func (h *Handler) GetLocationHistory(c *gin.Context) {
 
 // GetRoute godoc
 // @Summary Get vehicle route data
-// @Description Get route information for a vehicle including distance and duration
+// @Description Get route information for a vehicle including distance and duration. When a road network is loaded the route is snapped to roads, with the road class and speed limit of each segment.
 // @Tags tracking
 // @Produce json
 // @Param id path string true "Vehicle ID"
@@ -367,7 +478,7 @@ func (h *Handler) GetRoute(c *gin.Context) {
 	}
 
 	// Calculate route metrics
-	routeData := h.calculateRouteMetrics(gpsTracks)
+	routeData := h.calculateRouteMetrics(gpsTracks, h.service.matchTrack(gpsTracks))
 
 	c.JSON(http.StatusOK, SuccessResponse{
 		Success: true,
@@ -375,8 +486,9 @@ func (h *Handler) GetRoute(c *gin.Context) {
 	})
 }
 
-// calculateRouteMetrics calculates route metrics from GPS tracks
-func (h *Handler) calculateRouteMetrics(gpsTracks []models.GPSTrack) map[string]interface{} {
+// calculateRouteMetrics calculates route metrics from GPS tracks, following
+// the roads driven when the tracks were matched to the road network
+func (h *Handler) calculateRouteMetrics(gpsTracks []models.GPSTrack, match *mapmatch.Result) map[string]interface{} {
 	if len(gpsTracks) == 0 {
 		return map[string]interface{}{
 			"distance":      0,
@@ -431,7 +543,7 @@ func (h *Handler) calculateRouteMetrics(gpsTracks []models.GPSTrack) map[string]
 
 	duration := int(endTime.Sub(startTime).Minutes())
 
-	return map[string]interface{}{
+	routeData := map[string]interface{}{
 		"distance":      totalDistance,
 		"duration":      duration,
 		"average_speed": averageSpeed,
@@ -439,7 +551,18 @@ func (h *Handler) calculateRouteMetrics(gpsTracks []models.GPSTrack) map[string]
 		"start_time":    startTime,
 		"end_time":      endTime,
 		"points":        points,
+		"map_matched":   false,
+	}
+
+	if distance, ok := matchedDistance(gpsTracks, match); ok {
+		routeData["distance"] = distance
+		routeData["raw_distance"] = totalDistance
+		routeData["map_matched"] = true
+		routeData["matched_points"] = match.Points
+		routeData["segments"] = match.Segments
 	}
+
+	return routeData
 }
 
 // ProcessDriverEvent godoc
@@ -762,7 +885,7 @@ func (h *Handler) GetTrips(c *gin.Context) {
 
 // CreateGeofence godoc
 // @Summary Create geofence
-// @Description Create a new geofence for monitoring
+// @Description Create a new circle, polygon or rectangle geofence for monitoring
 // @Tags tracking
 // @Accept json
 // @Produce json
@@ -795,6 +918,9 @@ func (h *Handler) CreateGeofence(c *gin.Context) {
 
 	// Set company ID from JWT
 	req.CompanyID = companyID.(string)
+	if userID, exists := c.Get("user_id"); exists {
+		req.CreatedBy = userID.(string)
+	}
 
 	// Create geofence
 	geofence, err := h.service.CreateGeofence(req)
@@ -819,7 +945,8 @@ func (h *Handler) CreateGeofence(c *gin.Context) {
 // @Description Get list of geofences for the company
 // @Tags tracking
 // @Produce json
-// @Param type query string false "Geofence type"
+// @Param type query string false "Geofence purpose (zone, pickup, delivery, restricted)"
+// @Param shape query string false "Geofence shape (circle, polygon, rectangle)"
 // @Param is_active query bool false "Active status"
 // @Success 200 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
@@ -835,21 +962,26 @@ func (h *Handler) GetGeofences(c *gin.Context) {
 		return
 	}
 
-	// Build query
-	query := h.service.db.Where("company_id = ?", companyID)
+	// Build filters
+	filters := make(map[string]interface{})
 
+	// type is the geofence purpose, stored as category; the shape, stored
+	// in the type column, is filtered with shape
 	if geofenceType := c.Query("type"); geofenceType != "" {
-		query = query.Where("type = ?", geofenceType)
+		filters["category"] = geofenceType
+	}
+	if shape := c.Query("shape"); shape != "" {
+		filters["shape"] = shape
 	}
 	if isActiveStr := c.Query("is_active"); isActiveStr != "" {
 		if isActive, err := strconv.ParseBool(isActiveStr); err == nil {
-			query = query.Where("is_active = ?", isActive)
+			filters["is_active"] = isActive
 		}
 	}
 
 	// Get geofences
-	var geofences []models.Geofence
-	if err := query.Order("created_at DESC").Find(&geofences).Error; err != nil {
+	geofences, err := h.service.GetGeofences(companyID.(string), filters)
+	if err != nil {
 		middleware.AbortWithInternal(c, "failed to get geofences", err)
 		return
 	}
@@ -895,43 +1027,20 @@ func (h *Handler) UpdateGeofence(c *gin.Context) {
 		return
 	}
 
-	// Verify geofence belongs to company
-	var geofence models.Geofence
-	if err := h.service.db.Where("id = ? AND company_id = ?", geofenceID, companyID).First(&geofence).Error; err != nil {
-		if std_errors.Is(err, gorm.ErrRecordNotFound) {
-			middleware.AbortWithNotFound(c, "geofence")
-		} else {
-			middleware.AbortWithInternal(c, "failed to verify geofence", err)
-		}
+	// Validate request
+	if err := h.validator.StructPartial(&req, "Shape", "CenterLat", "CenterLng", "Radius"); err != nil {
+		middleware.AbortWithValidation(c, err.Error())
 		return
 	}
 
-	// Update geofence
-	if req.Name != "" {
-		geofence.Name = req.Name
-	}
-	if req.Type != "" {
-		geofence.Type = req.Type
-	}
-	if req.CenterLat != 0 {
-		geofence.CenterLatitude = req.CenterLat
-	}
-	if req.CenterLng != 0 {
-		geofence.CenterLongitude = req.CenterLng
-	}
-	if req.Radius != 0 {
-		geofence.Radius = req.Radius
-	}
-	geofence.AlertOnEnter = req.AlertOnEntry
-	geofence.AlertOnExit = req.AlertOnExit
-	geofence.IsActive = req.IsActive
-	if req.Description != "" {
-		geofence.Description = req.Description
-	}
-
-	// Save changes
-	if err := h.service.db.Save(&geofence).Error; err != nil {
-		middleware.AbortWithInternal(c, "failed to update geofence", err)
+	// Update geofence (scoped to the caller's company)
+	geofence, err := h.service.UpdateGeofence(companyID.(string), geofenceID, req)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to update geofence", err)
+		}
 		return
 	}
 
@@ -970,14 +1079,12 @@ func (h *Handler) DeleteGeofence(c *gin.Context) {
 	}
 
 	// Verify geofence belongs to company and delete
-	result := h.service.db.Where("id = ? AND company_id = ?", geofenceID, companyID).Delete(&models.Geofence{})
-	if result.Error != nil {
-		middleware.AbortWithInternal(c, "failed to delete geofence", result.Error)
-		return
-	}
-
-	if result.RowsAffected == 0 {
-		middleware.AbortWithNotFound(c, "geofence")
+	if err := h.service.DeleteGeofence(companyID.(string), geofenceID); err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to delete geofence", err)
+		}
 		return
 	}
 
@@ -1002,6 +1109,285 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 	h.service.HandleWebSocket(c)
 }
 
+// CreateWebSocketTicket godoc
+// @Summary Create WebSocket ticket
+// @Description Exchange the access token for a single-use ticket, valid for 30 seconds, to open /ws/tracking?ticket=... from browsers that cannot send an Authorization header
+// @Tags tracking
+// @Produce json
+// @Success 201 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/tracking/ws/ticket [post]
+// @Security BearerAuth
+func (h *Handler) CreateWebSocketTicket(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+	ticket, err := h.service.CreateWebSocketTicket(c.Request.Context(), token)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to create WebSocket ticket", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, SuccessResponse{
+		Success: true,
+		Data: gin.H{
+			"ticket":     ticket,
+			"expires_in": int(realtime.TicketTTL.Seconds()),
+		},
+	})
+}
+
+// GetOfflineVehicles godoc
+// @Summary Get offline vehicles
+// @Description List vehicles that stopped sending GPS fixes for longer than the company's offline threshold, longest silent first. Reason is ignition_off for parked vehicles and signal_lost for vehicles that went dark with the ignition on.
+// @Tags tracking
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=OfflineVehiclesResponse}
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/tracking/vehicles/offline [get]
+// @Security BearerAuth
+func (h *Handler) GetOfflineVehicles(c *gin.Context) {
+	// Get company ID from JWT claims
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	offline, err := h.service.GetOfflineVehicles(c.Request.Context(), companyID.(string))
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to get offline vehicles", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    offline,
+	})
+}
+
+// SetOfflineThreshold godoc
+// @Summary Set offline threshold
+// @Description Set how many minutes a company's vehicles may stay silent before they are marked offline and an alert is raised (owner/admin only). 0 uses the server default.
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param request body OfflineThresholdRequest true "Threshold"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/v1/tracking/vehicles/offline/threshold [put]
+// @Security BearerAuth
+func (h *Handler) SetOfflineThreshold(c *gin.Context) {
+	// Get company ID from JWT claims
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	var req OfflineThresholdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	threshold, err := h.service.SetCompanyOfflineThreshold(c.Request.Context(), companyID.(string), *req.ThresholdMinutes)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to update offline threshold", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    gin.H{"threshold_minutes": threshold},
+		Message: "Offline threshold updated",
+	})
+}
+
+// GetBehaviorRules godoc
+// @Summary Get driver behavior rules
+// @Description Get the company's driver behavior rule sets per vehicle type and the server defaults used for event types they do not configure
+// @Tags tracking
+// @Produce json
+// @Success 200 {object} SuccessResponse{data=BehaviorRulesResponse}
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/tracking/behavior-rules [get]
+// @Security BearerAuth
+func (h *Handler) GetBehaviorRules(c *gin.Context) {
+	// Get company ID from JWT claims
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	rules, err := h.service.GetBehaviorRules(companyID.(string))
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to get behavior rules", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    rules,
+	})
+}
+
+// SaveBehaviorRules godoc
+// @Summary Save driver behavior rules
+// @Description Create or replace the driver behavior rule set for a vehicle type, or the company-wide set when vehicle_type is omitted (owner/admin only). Speed thresholds are in km/h, braking and acceleration in m/s²
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param request body BehaviorRuleSetRequest true "Rule set"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/v1/tracking/behavior-rules [put]
+// @Security BearerAuth
+func (h *Handler) SaveBehaviorRules(c *gin.Context) {
+	// Get company ID from JWT claims
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	var req BehaviorRuleSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		middleware.AbortWithValidation(c, err.Error())
+		return
+	}
+
+	ruleSet, err := h.service.SaveBehaviorRuleSet(companyID.(string), req)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to save behavior rules", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    ruleSet,
+		Message: "Behavior rules saved",
+	})
+}
+
+// DeleteBehaviorRules godoc
+// @Summary Delete driver behavior rules
+// @Description Delete a driver behavior rule set; its vehicles fall back to the company-wide set or the server defaults (owner/admin only)
+// @Tags tracking
+// @Produce json
+// @Param id path string true "Rule set ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/tracking/behavior-rules/{id} [delete]
+// @Security BearerAuth
+func (h *Handler) DeleteBehaviorRules(c *gin.Context) {
+	// Get company ID from JWT claims
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	if err := h.service.DeleteBehaviorRuleSet(companyID.(string), c.Param("id")); err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to delete behavior rules", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Message: "Behavior rules deleted",
+	})
+}
+
+// DryRunBehaviorRules godoc
+// @Summary Dry-run driver behavior rules
+// @Description Replay up to 7 days of recorded GPS tracks against a draft rule set and compare the events it would raise with the rules in force. Nothing is saved
+// @Tags tracking
+// @Accept json
+// @Produce json
+// @Param request body BehaviorDryRunRequest true "Draft rule set and period"
+// @Success 200 {object} SuccessResponse{data=BehaviorDryRunResult}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/tracking/behavior-rules/dry-run [post]
+// @Security BearerAuth
+func (h *Handler) DryRunBehaviorRules(c *gin.Context) {
+	// Get company ID from JWT claims
+	companyID, exists := c.Get("company_id")
+	if !exists {
+		middleware.AbortWithUnauthorized(c, "company ID not found in token")
+		return
+	}
+
+	var req BehaviorDryRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.AbortWithBadRequest(c, err.Error())
+		return
+	}
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		middleware.AbortWithValidation(c, err.Error())
+		return
+	}
+
+	result, err := h.service.DryRunBehaviorRules(companyID.(string), req)
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to replay behavior rules", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
 // GetDashboardStats godoc
 // @Summary Get dashboard statistics
 // @Description Get dashboard statistics for tracking
@@ -1106,13 +1492,17 @@ func (h *Handler) GetDriverPerformance(c *gin.Context) {
 
 // GenerateReport godoc
 // @Summary Generate tracking report
-// @Description Generate comprehensive tracking report
+// @Description Queue a tracking report. The report is kept once generated; poll the returned status_url or wait for the report ready alert, then fetch download_url.
 // @Tags tracking
 // @Produce json
-// @Param type query string false "Report type"
-// @Param format query string false "Report format (json, csv, pdf)"
-// @Success 200 {object} SuccessResponse
+// @Param type query string false "Report type (fleet_summary, driver_performance, fuel_consumption, maintenance)"
+// @Param format query string false "Report format (csv, json, jsonl, xlsx, pdf)"
+// @Param start_date query string false "First day of the report (YYYY-MM-DD), default 30 days ago"
+// @Param end_date query string false "Last day of the report (YYYY-MM-DD), default today"
+// @Success 202 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /api/v1/tracking/reports/generate [post]
 // @Security BearerAuth
 func (h *Handler) GenerateReport(c *gin.Context) {
@@ -1123,17 +1513,32 @@ func (h *Handler) GenerateReport(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implement report generation
-	report := map[string]interface{}{
-		"company_id": companyID,
-		"report_id": "temp-report-id",
-		"status": "generating",
-		"estimated_completion": time.Now().Add(5 * time.Minute),
+	if h.reports == nil {
+		middleware.AbortWithError(c, apperrors.NewServiceUnavailableError("reports are not available"))
+		return
 	}
 
-	c.JSON(http.StatusOK, SuccessResponse{
+	report, err := h.reports.RequestReport(c.Request.Context(), &reports.ReportRequest{
+		ReportType: c.DefaultQuery("type", "fleet_summary"),
+		Format:     c.DefaultQuery("format", "pdf"),
+		StartDate:  c.Query("start_date"),
+		EndDate:    c.Query("end_date"),
+		CompanyID:  companyID.(string),
+		UserID:     c.GetString("user_id"),
+	})
+	if err != nil {
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithInternal(c, "failed to generate report", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, SuccessResponse{
 		Success: true,
-		Data:    report,
+		Data:    reports.QueuedReport(report),
+		Message: "Report queued",
 	})
 }
 
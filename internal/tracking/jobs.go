@@ -0,0 +1,64 @@
+package tracking
+
+import (
+	"context"
+	"log"
+
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/jobs"
+)
+
+// VehicleOfflineJob marks vehicles that stopped reporting as offline
+type VehicleOfflineJob struct {
+	service *Service
+}
+
+// NewVehicleOfflineJob creates a new vehicle offline job handler
+func NewVehicleOfflineJob(service *Service) *VehicleOfflineJob {
+	return &VehicleOfflineJob{service: service}
+}
+
+// GetJobType returns the job type
+func (v *VehicleOfflineJob) GetJobType() string {
+	return "vehicle_offline_check"
+}
+
+// Handle processes vehicle offline jobs
+func (v *VehicleOfflineJob) Handle(ctx context.Context, _ *jobs.Job) error {
+	marked, err := v.service.DetectOfflineVehicles(ctx)
+	if err != nil {
+		return err
+	}
+
+	if marked > 0 {
+		log.Printf("Marked %d vehicles offline", marked)
+	}
+	return nil
+}
+
+// TripCloseJob completes detected trips of vehicles that stopped reporting
+type TripCloseJob struct {
+	service *Service
+}
+
+// NewTripCloseJob creates a new trip close job handler
+func NewTripCloseJob(service *Service) *TripCloseJob {
+	return &TripCloseJob{service: service}
+}
+
+// GetJobType returns the job type
+func (t *TripCloseJob) GetJobType() string {
+	return "trip_auto_close"
+}
+
+// Handle processes trip close jobs
+func (t *TripCloseJob) Handle(ctx context.Context, _ *jobs.Job) error {
+	closed, err := t.service.CloseStaleTrips(ctx)
+	if err != nil {
+		return err
+	}
+
+	if closed > 0 {
+		log.Printf("Closed %d detected trips of silent vehicles", closed)
+	}
+	return nil
+}
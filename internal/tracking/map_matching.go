@@ -0,0 +1,72 @@
+package tracking
+
+import (
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/mapmatch"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// minMatchedShare is the share of a track's fixes that must be matched to
+// roads before its matched distance replaces the straight-line distance
+const minMatchedShare = 0.5
+
+// SetMapMatcher sets the matcher that snaps tracks to the road network.
+// Matched tracks give road-following routes and trip distances, and the
+// speed limits of the roads driven for speeding detection.
+func (s *Service) SetMapMatcher(matcher *mapmatch.Matcher) {
+	s.mapMatcher = matcher
+}
+
+// matchTrack snaps a track, oldest fix first, to the road network. It
+// returns nil when no road network is loaded.
+func (s *Service) matchTrack(tracks []models.GPSTrack) *mapmatch.Result {
+	if s.mapMatcher == nil || len(tracks) == 0 {
+		return nil
+	}
+
+	points := make([]mapmatch.Point, len(tracks))
+	for i := range tracks {
+		points[i] = mapmatch.Point{
+			Latitude:  tracks[i].Latitude,
+			Longitude: tracks[i].Longitude,
+			Accuracy:  tracks[i].Accuracy,
+		}
+	}
+	return s.mapMatcher.Match(points)
+}
+
+// matchedDistance returns the road distance in meters of a track, and false
+// when too little of it could be matched to roads
+func matchedDistance(tracks []models.GPSTrack, result *mapmatch.Result) (float64, bool) {
+	if result == nil || len(tracks) < 2 || float64(result.Matched) < minMatchedShare*float64(len(tracks)) {
+		return 0, false
+	}
+	return result.Distance, true
+}
+
+// useMatchedDistance replaces the straight-line distance of trip totals by
+// the distance along the roads driven, when the trip can be matched
+func (s *Service) useMatchedDistance(fixes []models.GPSTrack, stats *tripStats) {
+	meters, ok := matchedDistance(fixes, s.matchTrack(fixes))
+	if !ok {
+		return
+	}
+
+	stats.Distance = meters / 1000
+	stats.AverageSpeed = 0
+	if moving := stats.Duration - stats.IdleTime; moving > 0 {
+		stats.AverageSpeed = stats.Distance / moving.Hours()
+	}
+}
+
+// applyRoadSpeedLimits sets the speed limit of the road each fix was matched
+// to, keeping the current limit of unmatched fixes
+func applyRoadSpeedLimits(tracks []models.GPSTrack, result *mapmatch.Result) {
+	if result == nil {
+		return
+	}
+	for i := range tracks {
+		if point := result.Points[i]; point.Matched && point.SpeedLimit > 0 {
+			tracks[i].SpeedLimit = float64(point.SpeedLimit)
+		}
+	}
+}
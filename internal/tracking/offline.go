@@ -0,0 +1,249 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// Vehicle connection states and offline reasons
+const (
+	ConnectionOnline  = "online"
+	ConnectionOffline = "offline"
+
+	// OfflineReasonIgnitionOff means the last fix had the ignition off: the
+	// vehicle was parked and the tracker went to sleep
+	OfflineReasonIgnitionOff = "ignition_off"
+
+	// OfflineReasonSignalLost means the vehicle went dark with the ignition on,
+	// the usual sign of a removed or jammed tracker
+	OfflineReasonSignalLost = "signal_lost"
+
+	// OfflineReasonUnknown means the device does not report ignition, so a
+	// parked vehicle cannot be told from a lost signal
+	OfflineReasonUnknown = "unknown"
+
+	// DefaultOfflineThreshold is used until SetOfflineThreshold is called
+	DefaultOfflineThreshold = 30 * time.Minute
+
+	// MaxOfflineThresholdMinutes caps the per-company threshold at one day
+	MaxOfflineThresholdMinutes = 24 * 60
+)
+
+// OfflineVehicle is a vehicle that stopped sending GPS fixes
+type OfflineVehicle struct {
+	VehicleID      string    `json:"vehicle_id"`
+	LicensePlate   string    `json:"license_plate"`
+	DriverID       *string   `json:"driver_id,omitempty"`
+	Reason         string    `json:"reason"` // ignition_off, signal_lost, unknown
+	OfflineSince   time.Time `json:"offline_since"`
+	OfflineMinutes int       `json:"offline_minutes"`
+	LastLatitude   float64   `json:"last_latitude"`
+	LastLongitude  float64   `json:"last_longitude"`
+}
+
+// OfflineVehiclesResponse lists the offline vehicles of a company
+type OfflineVehiclesResponse struct {
+	ThresholdMinutes int              `json:"threshold_minutes"`
+	Vehicles         []OfflineVehicle `json:"vehicles"`
+}
+
+// OfflineThresholdRequest sets how long a company's vehicles may stay silent
+type OfflineThresholdRequest struct {
+	ThresholdMinutes *int `json:"threshold_minutes" binding:"required,min=0,max=1440"` // 0 uses the server default
+}
+
+// SetOfflineThreshold sets the silence after which vehicles of companies
+// without their own threshold are marked offline
+func (s *Service) SetOfflineThreshold(threshold time.Duration) {
+	if threshold > 0 {
+		s.offlineThreshold = threshold
+	}
+}
+
+// DetectOfflineVehicles marks vehicles offline when their last GPS fix is
+// older than the company's threshold and raises an offline alert for each.
+// It returns the number of vehicles marked offline.
+func (s *Service) DetectOfflineVehicles(ctx context.Context) (int, error) {
+	var vehicles []models.Vehicle
+	err := s.db.WithContext(ctx).
+		Select("vehicles.id", "vehicles.company_id", "vehicles.license_plate", "vehicles.last_updated_at").
+		Joins("JOIN companies ON companies.id = vehicles.company_id").
+		Where("vehicles.is_active = ? AND vehicles.is_gps_enabled = ? AND vehicles.status = ?", true, true, "active").
+		Where("vehicles.last_updated_at IS NOT NULL AND (vehicles.connection_status IS NULL OR vehicles.connection_status <> ?)", ConnectionOffline).
+		Where("vehicles.last_updated_at < ?::timestamptz - COALESCE(NULLIF(companies.offline_threshold_minutes, 0), ?) * INTERVAL '1 minute'",
+			time.Now(), s.defaultOfflineThresholdMinutes()).
+		Find(&vehicles).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find silent vehicles: %w", err)
+	}
+
+	marked := 0
+	for i := range vehicles {
+		ok, err := s.markVehicleOffline(ctx, &vehicles[i])
+		if err != nil {
+			fmt.Printf("Failed to mark vehicle %s offline: %v\n", vehicles[i].ID, err)
+			continue
+		}
+		if ok {
+			marked++
+		}
+	}
+
+	return marked, nil
+}
+
+// markVehicleOffline records why the vehicle went offline and raises the
+// alert. It returns false when a fix arrived since the vehicle was loaded.
+func (s *Service) markVehicleOffline(ctx context.Context, vehicle *models.Vehicle) (bool, error) {
+	reason := OfflineReasonUnknown
+	var lastTrack models.GPSTrack
+	err := s.db.WithContext(ctx).Select("ignition_on").Where("vehicle_id = ?", vehicle.ID).Order("timestamp DESC").First(&lastTrack).Error
+	if err == nil {
+		reason = offlineReason(&lastTrack)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, fmt.Errorf("failed to get last GPS track: %w", err)
+	}
+
+	lastSeen := *vehicle.LastUpdatedAt
+	result := s.db.WithContext(ctx).Model(&models.Vehicle{}).
+		Where("id = ? AND last_updated_at = ?", vehicle.ID, lastSeen).
+		Updates(map[string]interface{}{
+			"connection_status": ConnectionOffline,
+			"offline_since":     lastSeen,
+			"offline_reason":    reason,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update vehicle: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	if err := s.alertSystem.CreateVehicleOfflineAlert(ctx, vehicle.CompanyID, vehicle.ID, vehicle.LicensePlate, reason, lastSeen); err != nil {
+		fmt.Printf("Failed to raise offline alert for vehicle %s: %v\n", vehicle.ID, err)
+	}
+
+	return true, nil
+}
+
+// markVehicleOnline clears the offline state when a fix newer than the last
+// one before the silence arrives
+func (s *Service) markVehicleOnline(vehicleID, companyID string, timestamp time.Time) {
+	result := s.db.Model(&models.Vehicle{}).
+		Where("id = ? AND connection_status = ? AND (offline_since IS NULL OR offline_since < ?)", vehicleID, ConnectionOffline, timestamp).
+		Updates(map[string]interface{}{
+			"connection_status": ConnectionOnline,
+			"offline_since":     nil,
+			"offline_reason":    "",
+		})
+	if result.Error != nil {
+		fmt.Printf("Failed to mark vehicle %s online: %v\n", vehicleID, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+
+	if err := s.alertSystem.ClearVehicleOfflineAlert(ctx, companyID, vehicleID); err != nil {
+		fmt.Printf("Failed to clear offline alert for vehicle %s: %v\n", vehicleID, err)
+	}
+}
+
+// GetOfflineVehicles lists the company's offline vehicles, longest silent first
+func (s *Service) GetOfflineVehicles(ctx context.Context, companyID string) (*OfflineVehiclesResponse, error) {
+	var company models.Company
+	if err := s.db.WithContext(ctx).Select("id", "offline_threshold_minutes").Where("id = ?", companyID).First(&company).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperrors.NewNotFoundError("company")
+		}
+		return nil, apperrors.Wrap(err, "failed to get company")
+	}
+
+	var vehicles []models.Vehicle
+	err := s.db.WithContext(ctx).
+		Where("company_id = ? AND connection_status = ?", companyID, ConnectionOffline).
+		Order("offline_since ASC").
+		Find(&vehicles).Error
+	if err != nil {
+		return nil, apperrors.Wrap(err, "failed to get offline vehicles")
+	}
+
+	now := time.Now()
+	response := &OfflineVehiclesResponse{
+		ThresholdMinutes: s.offlineThresholdMinutes(company.OfflineThresholdMinutes),
+		Vehicles:         make([]OfflineVehicle, 0, len(vehicles)),
+	}
+	for _, vehicle := range vehicles {
+		offline := OfflineVehicle{
+			VehicleID:     vehicle.ID,
+			LicensePlate:  vehicle.LicensePlate,
+			DriverID:      vehicle.DriverID,
+			Reason:        vehicle.OfflineReason,
+			LastLatitude:  vehicle.LastLatitude,
+			LastLongitude: vehicle.LastLongitude,
+		}
+		if vehicle.OfflineSince != nil {
+			offline.OfflineSince = *vehicle.OfflineSince
+			offline.OfflineMinutes = int(now.Sub(*vehicle.OfflineSince).Minutes())
+		}
+		response.Vehicles = append(response.Vehicles, offline)
+	}
+
+	return response, nil
+}
+
+// SetCompanyOfflineThreshold sets the company's offline threshold in
+// minutes; 0 reverts to the server default
+func (s *Service) SetCompanyOfflineThreshold(ctx context.Context, companyID string, minutes int) (int, error) {
+	if minutes < 0 || minutes > MaxOfflineThresholdMinutes {
+		return 0, apperrors.NewValidationError(fmt.Sprintf("threshold_minutes must be between 0 and %d", MaxOfflineThresholdMinutes))
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.Company{}).Where("id = ?", companyID).Update("offline_threshold_minutes", minutes)
+	if result.Error != nil {
+		return 0, apperrors.Wrap(result.Error, "failed to update offline threshold")
+	}
+	if result.RowsAffected == 0 {
+		return 0, apperrors.NewNotFoundError("company")
+	}
+
+	return s.offlineThresholdMinutes(minutes), nil
+}
+
+// offlineThresholdMinutes returns the effective threshold of a company
+func (s *Service) offlineThresholdMinutes(companyMinutes int) int {
+	if companyMinutes > 0 {
+		return companyMinutes
+	}
+	return s.defaultOfflineThresholdMinutes()
+}
+
+// defaultOfflineThresholdMinutes returns the server threshold in whole minutes
+func (s *Service) defaultOfflineThresholdMinutes() int {
+	threshold := s.offlineThreshold
+	if threshold <= 0 {
+		threshold = DefaultOfflineThreshold
+	}
+	return int(math.Ceil(threshold.Minutes()))
+}
+
+// offlineReason tells a parked vehicle from one that lost signal while
+// running, when the last fix reported the ignition
+func offlineReason(lastTrack *models.GPSTrack) string {
+	switch {
+	case lastTrack.IgnitionOn == nil:
+		return OfflineReasonUnknown
+	case *lastTrack.IgnitionOn:
+		return OfflineReasonSignalLost
+	default:
+		return OfflineReasonIgnitionOff
+	}
+}
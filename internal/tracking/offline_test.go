@@ -0,0 +1,158 @@
+package tracking
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/database"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+	"gorm.io/gorm"
+)
+
+func TestOfflineReason(t *testing.T) {
+	on, off := true, false
+	assert.Equal(t, OfflineReasonSignalLost, offlineReason(&models.GPSTrack{IgnitionOn: &on}))
+	assert.Equal(t, OfflineReasonIgnitionOff, offlineReason(&models.GPSTrack{IgnitionOn: &off}))
+	assert.Equal(t, OfflineReasonUnknown, offlineReason(&models.GPSTrack{Speed: 40}), "ignition not reported")
+}
+
+func TestOfflineThresholdMinutes(t *testing.T) {
+	service := &Service{}
+	assert.Equal(t, 30, service.offlineThresholdMinutes(0), "falls back to the package default")
+
+	service.SetOfflineThreshold(90 * time.Second)
+	assert.Equal(t, 2, service.offlineThresholdMinutes(0), "rounds the server default up to whole minutes")
+
+	service.SetOfflineThreshold(0)
+	assert.Equal(t, 2, service.offlineThresholdMinutes(0), "ignores non-positive thresholds")
+
+	assert.Equal(t, 120, service.offlineThresholdMinutes(120), "company threshold wins")
+}
+
+// silentVehicle creates a vehicle whose last fix, with the given ignition
+// state, arrived silentFor ago
+func silentVehicle(t *testing.T, db *gorm.DB, companyID, plate string, silentFor time.Duration, ignition *bool) *models.Vehicle {
+	t.Helper()
+
+	lastSeen := time.Now().Add(-silentFor).Truncate(time.Microsecond)
+	vehicle := testutil.NewTestVehicle(companyID)
+	vehicle.LicensePlate = plate
+	vehicle.VIN = vehicle.ID[:17]
+	vehicle.LastUpdatedAt = &lastSeen
+	require.NoError(t, db.Create(vehicle).Error)
+
+	require.NoError(t, db.Create(&models.GPSTrack{
+		VehicleID:  vehicle.ID,
+		Latitude:   -6.2088,
+		Longitude:  106.8456,
+		IgnitionOn: ignition,
+		Timestamp:  lastSeen,
+	}).Error)
+	return vehicle
+}
+
+func TestService_DetectOfflineVehicles(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	service := NewService(db, redisClient)
+	service.SetOfflineThreshold(30 * time.Minute)
+	ctx := context.Background()
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	patient := testutil.NewTestCompany()
+	patient.OfflineThresholdMinutes = 180
+	require.NoError(t, db.Create(patient).Error)
+
+	on, off := true, false
+	running := silentVehicle(t, db, company.ID, "B 1001 OFF", 2*time.Hour, &on)
+	parked := silentVehicle(t, db, company.ID, "B 1002 OFF", 2*time.Hour, &off)
+	phone := silentVehicle(t, db, company.ID, "B 1003 OFF", 2*time.Hour, nil)
+	recent := silentVehicle(t, db, company.ID, "B 1004 OFF", 5*time.Minute, &on)
+	withinCompanyThreshold := silentVehicle(t, db, patient.ID, "B 1005 OFF", 2*time.Hour, &on)
+
+	marked, err := service.DetectOfflineVehicles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, marked)
+
+	expected := map[string]string{
+		running.ID: OfflineReasonSignalLost,
+		parked.ID:  OfflineReasonIgnitionOff,
+		phone.ID:   OfflineReasonUnknown,
+	}
+	for vehicleID, reason := range expected {
+		var vehicle models.Vehicle
+		require.NoError(t, db.First(&vehicle, "id = ?", vehicleID).Error)
+		assert.Equal(t, ConnectionOffline, vehicle.ConnectionStatus, vehicle.LicensePlate)
+		assert.Equal(t, reason, vehicle.OfflineReason, vehicle.LicensePlate)
+		require.NotNil(t, vehicle.OfflineSince)
+		assert.WithinDuration(t, *vehicle.LastUpdatedAt, *vehicle.OfflineSince, time.Millisecond)
+	}
+
+	for _, vehicleID := range []string{recent.ID, withinCompanyThreshold.ID} {
+		var vehicle models.Vehicle
+		require.NoError(t, db.First(&vehicle, "id = ?", vehicleID).Error)
+		assert.NotEqual(t, ConnectionOffline, vehicle.ConnectionStatus, vehicle.LicensePlate)
+	}
+
+	t.Run("offline vehicles are not marked again", func(t *testing.T) {
+		marked, err := service.DetectOfflineVehicles(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, marked)
+	})
+
+	t.Run("listed for the company", func(t *testing.T) {
+		response, err := service.GetOfflineVehicles(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 30, response.ThresholdMinutes)
+		assert.Len(t, response.Vehicles, 3)
+	})
+}
+
+func TestService_MarkVehicleOnline(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	service := NewService(db, redisClient)
+	ctx := context.Background()
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+
+	vehicle := silentVehicle(t, db, company.ID, "B 2001 ON", 2*time.Hour, nil)
+	marked, err := service.DetectOfflineVehicles(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, marked)
+	offlineSince := *vehicle.LastUpdatedAt
+
+	connection := func() models.Vehicle {
+		var current models.Vehicle
+		require.NoError(t, db.First(&current, "id = ?", vehicle.ID).Error)
+		return current
+	}
+
+	t.Run("late fix from before the silence keeps the vehicle offline", func(t *testing.T) {
+		service.markVehicleOnline(vehicle.ID, company.ID, offlineSince.Add(-time.Minute))
+		assert.Equal(t, ConnectionOffline, connection().ConnectionStatus)
+
+		service.markVehicleOnline(vehicle.ID, company.ID, offlineSince)
+		assert.Equal(t, ConnectionOffline, connection().ConnectionStatus, "the last fix before the silence")
+	})
+
+	t.Run("newer fix brings the vehicle back online", func(t *testing.T) {
+		service.markVehicleOnline(vehicle.ID, company.ID, time.Now())
+
+		current := connection()
+		assert.Equal(t, ConnectionOnline, current.ConnectionStatus)
+		assert.Nil(t, current.OfflineSince)
+		assert.Empty(t, current.OfflineReason)
+	})
+}
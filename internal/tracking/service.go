@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"net/http"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,10 +13,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
-	"github.com/gorilla/websocket"
 	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"gorm.io/gorm"
 
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/geofencing"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/mapmatch"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/realtime"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 )
@@ -29,10 +29,17 @@ type Service struct {
 	db                    *gorm.DB
 	redis                 *redis.Client
 	websocketHub          *realtime.WebSocketHub
-	localWebSocketHub     *WebSocketHub
 	cache                 *CacheService
 	analyticsBroadcaster  *realtime.AnalyticsBroadcaster
 	alertSystem           *realtime.AlertSystem
+	wsAuthenticator       realtime.Authenticator
+	geofenceManager       *geofencing.GeofenceManager
+	geofenceMonitor       *geofencing.GeofenceMonitor
+	offlineThreshold      time.Duration
+	behaviorDefaults      []models.DriverBehaviorRule
+	tripSettings          TripDetectionSettings
+	tripLocks             sync.Map // vehicle ID -> *sync.Mutex
+	mapMatcher            *mapmatch.Matcher
 }
 
 // CacheService provides caching functionality for tracking operations
@@ -317,78 +324,6 @@ func (cs *CacheService) generateLocationHistoryCacheKey(vehicleID string, filter
 	return fmt.Sprintf("location:history:%s:%s", vehicleID, hash)
 }
 
-// WebSocketHub manages WebSocket connections
-type WebSocketHub struct {
-	clients    map[*websocket.Conn]bool
-	broadcast  chan []byte
-	register   chan *websocket.Conn
-	unregister chan *websocket.Conn
-	mutex      sync.RWMutex
-}
-
-// NewWebSocketHub creates a new WebSocket hub
-func NewWebSocketHub() *WebSocketHub {
-	return &WebSocketHub{
-		clients:    make(map[*websocket.Conn]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
-	}
-}
-
-// Register registers a new WebSocket connection
-func (h *WebSocketHub) Register(conn *websocket.Conn) {
-	h.register <- conn
-}
-
-// Unregister unregisters a WebSocket connection
-func (h *WebSocketHub) Unregister(conn *websocket.Conn) {
-	h.unregister <- conn
-}
-
-// Broadcast sends a message to all connected clients
-func (h *WebSocketHub) Broadcast(message []byte) {
-	h.broadcast <- message
-}
-
-// GetClientCount returns the number of connected clients
-func (h *WebSocketHub) GetClientCount() int {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
-	return len(h.clients)
-}
-
-// Run starts the WebSocket hub
-func (h *WebSocketHub) Run() {
-	for {
-		select {
-		case conn := <-h.register:
-			h.mutex.Lock()
-			h.clients[conn] = true
-			h.mutex.Unlock()
-
-		case conn := <-h.unregister:
-			h.mutex.Lock()
-			if _, ok := h.clients[conn]; ok {
-				delete(h.clients, conn)
-				conn.Close()
-			}
-			h.mutex.Unlock()
-
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for conn := range h.clients {
-				err := conn.WriteMessage(websocket.TextMessage, message)
-				if err != nil {
-					conn.Close()
-					delete(h.clients, conn)
-				}
-			}
-			h.mutex.RUnlock()
-		}
-	}
-}
-
 // GPSDataRequest represents GPS data from mobile device
 type GPSDataRequest struct {
 	VehicleID     string    `json:"vehicle_id" validate:"required"`
@@ -403,6 +338,15 @@ type GPSDataRequest struct {
 	BatteryLevel  float64   `json:"battery_level" validate:"min=0,max=100"`
 	NetworkType   string    `json:"network_type"` // 4G, 5G, WiFi
 	IsOfflineSync bool      `json:"is_offline_sync"`
+	IgnitionOn    *bool     `json:"ignition_on,omitempty"` // stored as unknown when the device does not report it
+
+	// Reported by hardwired trackers
+	Satellites int         `json:"satellites,omitempty"`
+	FuelLevel  *float64    `json:"fuel_level,omitempty"` // liters
+	Odometer   *float64    `json:"odometer,omitempty"`   // km
+	RawData    models.JSON `json:"raw_data,omitempty"`   // original device data
+
+	DeviceID string `json:"-"` // set for fixes reported by an authenticated device
 }
 
 // GPSFilters represents filters for GPS data queries
@@ -455,17 +399,35 @@ type Location struct {
 }
 
 // GeofenceRequest represents geofence data
+//
+// Shape selects how the zone is defined: circle (center and radius, the
+// default), polygon or rectangle (PolygonData in the GeoJSON-style format
+// documented on models.GeofenceGeometry).
 type GeofenceRequest struct {
-	CompanyID      string  `json:"company_id" validate:"required"`
-	Name           string  `json:"name" validate:"required"`
-	Type           string  `json:"type" validate:"required,oneof=zone pickup delivery restricted"`
-	CenterLat      float64 `json:"center_lat" validate:"required,min=-90,max=90"`
-	CenterLng      float64 `json:"center_lng" validate:"required,min=-180,max=180"`
-	Radius         float64 `json:"radius" validate:"required,min=10,max=10000"` // meters
-	AlertOnEntry   bool    `json:"alert_on_entry"`
-	AlertOnExit    bool    `json:"alert_on_exit"`
-	IsActive       bool    `json:"is_active"`
-	Description    string  `json:"description"`
+	CompanyID      string      `json:"company_id" validate:"required"`
+	Name           string      `json:"name" validate:"required"`
+	Type           string      `json:"type" validate:"required,oneof=zone pickup delivery restricted"`
+	Shape          string      `json:"shape" validate:"omitempty,oneof=circle polygon rectangle"`
+	CenterLat      float64     `json:"center_lat" validate:"min=-90,max=90"`
+	CenterLng      float64     `json:"center_lng" validate:"min=-180,max=180"`
+	Radius         float64     `json:"radius" validate:"omitempty,min=10,max=10000"` // meters, circle only
+	PolygonData    models.JSON `json:"polygon_data,omitempty"`                       // polygon and rectangle only
+	AlertOnEntry   bool        `json:"alert_on_entry"`
+	AlertOnExit    bool        `json:"alert_on_exit"`
+	AlertOnDwell   bool        `json:"alert_on_dwell"`
+	DwellTime      int         `json:"dwell_time" validate:"omitempty,min=1"` // minutes
+	AlertOnSpeed   bool        `json:"alert_on_speed"`
+	SpeedLimit     float64     `json:"speed_limit" validate:"omitempty,min=0"` // km/h
+	Priority       int         `json:"priority" validate:"omitempty,min=1,max=10"`
+	IsActive       bool        `json:"is_active"`
+	Description    string      `json:"description"`
+
+	TimeRestrictions   []models.GeofenceTimeRestriction `json:"time_restrictions,omitempty"`
+	AllowedVehicles    []string                         `json:"allowed_vehicles,omitempty"`
+	AllowedDrivers     []string                         `json:"allowed_drivers,omitempty"`
+	RestrictedVehicles []string                         `json:"restricted_vehicles,omitempty"`
+	RestrictedDrivers  []string                         `json:"restricted_drivers,omitempty"`
+	CreatedBy          string                           `json:"-"`
 }
 
 // NewService creates a new tracking service
@@ -473,8 +435,6 @@ func NewService(db *gorm.DB, redis *redis.Client) *Service {
 	// Create enhanced WebSocket hub
 	hub := realtime.NewWebSocketHub(redis, realtime.DefaultWebSocketConfig())
 	
-	// Create local WebSocket hub for additional functionality
-	localHub := NewWebSocketHub()
 	
 	// Create analytics broadcaster
 	analyticsBroadcaster := realtime.NewAnalyticsBroadcaster(hub, redis, db, nil)
@@ -483,18 +443,18 @@ func NewService(db *gorm.DB, redis *redis.Client) *Service {
 	alertSystem := realtime.NewAlertSystem(hub, redis)
 
 	service := &Service{
+		geofenceManager:      geofencing.NewGeofenceManager(db, redis),
+		offlineThreshold:     DefaultOfflineThreshold,
+		behaviorDefaults:     DefaultBehaviorRules(80, 120, 0.4, 0.3),
+		tripSettings:         DefaultTripDetectionSettings(),
 		db:                   db,
 		redis:                redis,
 		websocketHub:         hub,
-		localWebSocketHub:    localHub,
 		cache:                NewCacheService(redis),
 		analyticsBroadcaster: analyticsBroadcaster,
 		alertSystem:          alertSystem,
 	}
 	
-	// Start the local WebSocket hub in a goroutine
-	go service.localWebSocketHub.Run()
-	
 	return service
 }
 
@@ -529,9 +489,54 @@ func (s *Service) ProcessGPSData(req GPSDataRequest) (*models.GPSTrack, error) {
 	}
 
 	// Create GPS track
+	gpsTrack := newGPSTrack(req)
+
+	// Save to database, once per vehicle and timestamp
+	created := s.db.Clauses(gpsTrackOnConflict).Create(gpsTrack)
+	if created.Error != nil {
+		return nil, fmt.Errorf("failed to save GPS track: %w", created.Error)
+	}
+	if created.RowsAffected == 0 {
+		return nil, apperrors.NewConflictError("GPS fix already recorded for this timestamp")
+	}
+
+	// Update vehicle's last known location
+	advanced, err := s.updateVehicleLocation(req.VehicleID, req.Latitude, req.Longitude, req.Speed, req.Timestamp)
+	if err != nil {
+		// Log error but don't fail the GPS processing
+		fmt.Printf("Failed to update vehicle location: %v\n", err)
+	}
+
+	// Open, extend or close the vehicle's detected trip. A fix older than the
+	// vehicle's last one is a late arrival and re-segments its trips instead.
+	if vehicle.LastUpdatedAt != nil && gpsTrack.Timestamp.Before(*vehicle.LastUpdatedAt) {
+		if _, err := s.redetectTrips(&vehicle, gpsTrack.Timestamp, gpsTrack.Timestamp); err != nil {
+			fmt.Printf("Failed to redetect trips of vehicle %s: %v\n", vehicle.ID, err)
+		}
+	} else {
+		s.detectTrip(gpsTrack, vehicle.CompanyID)
+	}
+
+	// Only a fix that moved the vehicle is its live position
+	if advanced {
+		s.publishLatestFix(gpsTrack, vehicle.CompanyID)
+	} else {
+		go func() {
+			// Older fixes still change the stored history
+			if err := s.cache.InvalidateLocationHistoryCache(ctx, vehicle.ID); err != nil {
+				fmt.Printf("Failed to invalidate location history cache %s: %v\n", vehicle.ID, err)
+			}
+		}()
+	}
+
+	return gpsTrack, nil
+}
+
+// newGPSTrack builds the GPS track stored for a GPS data request. Fixes
+// reported by devices may have no driver.
+func newGPSTrack(req GPSDataRequest) *models.GPSTrack {
 	gpsTrack := &models.GPSTrack{
 		VehicleID:   req.VehicleID,
-		DriverID:    &req.DriverID,
 		Latitude:    req.Latitude,
 		Longitude:   req.Longitude,
 		Altitude:    req.Altitude,
@@ -540,22 +545,41 @@ func (s *Service) ProcessGPSData(req GPSDataRequest) (*models.GPSTrack, error) {
 		Accuracy:    req.Accuracy,
 		Timestamp:   req.Timestamp,
 		ProcessedAt: time.Now(),
+		IgnitionOn:  req.IgnitionOn,
 	}
-
-	// Save to database
-	if err := s.db.Create(gpsTrack).Error; err != nil {
-		return nil, fmt.Errorf("failed to save GPS track: %w", err)
+	if req.FuelLevel != nil {
+		gpsTrack.FuelLevel = *req.FuelLevel
 	}
-
-	// Update vehicle's last known location
-	if err := s.updateVehicleLocation(req.VehicleID, req.Latitude, req.Longitude, req.Speed, req.Timestamp); err != nil {
-		// Log error but don't fail the GPS processing
-		fmt.Printf("Failed to update vehicle location: %v\n", err)
+	if req.Odometer != nil {
+		gpsTrack.Odometer = *req.Odometer
+	}
+	if req.DriverID != "" {
+		driverID := req.DriverID
+		gpsTrack.DriverID = &driverID
 	}
+	if req.DeviceID != "" {
+		deviceID := req.DeviceID
+		gpsTrack.DeviceID = &deviceID
+	}
+	gpsTrack.Satellites = req.Satellites
+	gpsTrack.RawData = req.RawData
+	return gpsTrack
+}
+
+// publishLatestFix runs the live side effects of a vehicle's newest fix:
+// online detection, behavior analysis, geofences, broadcasts and caching.
+// Earlier fixes stored with it, oldest first, are replayed through the
+// geofences before it without being broadcast.
+func (s *Service) publishLatestFix(gpsTrack *models.GPSTrack, companyID string, earlier ...*models.GPSTrack) {
+	// A vehicle marked offline by the watchdog is reporting again
+	s.markVehicleOnline(gpsTrack.VehicleID, companyID, gpsTrack.Timestamp)
 
 	// Process driver behavior events
 	go s.processDriverBehavior(gpsTrack)
 
+	// Check geofences for entry, exit and dwell events
+	go s.checkGeofences(gpsTrack, companyID, earlier)
+
 	// Broadcast real-time location update
 	go func() {
 		if err := s.analyticsBroadcaster.BroadcastVehicleLocationUpdate(ctx, gpsTrack); err != nil {
@@ -563,8 +587,8 @@ func (s *Service) ProcessGPSData(req GPSDataRequest) (*models.GPSTrack, error) {
 		}
 	}()
 	
-	// Broadcast to local WebSocket clients
-	go s.broadcastGPSUpdate(gpsTrack)
+	// Broadcast to the company's WebSocket clients
+	go s.broadcastGPSUpdate(gpsTrack, companyID)
 
 	// Cache current location using new cache service
 	go func() {
@@ -577,8 +601,45 @@ func (s *Service) ProcessGPSData(req GPSDataRequest) (*models.GPSTrack, error) {
 			fmt.Printf("Failed to invalidate location history cache %s: %v\n", gpsTrack.VehicleID, err)
 		}
 	}()
+}
 
-	return gpsTrack, nil
+// checkGeofences feeds a GPS fix to the geofence monitor, after replaying
+// the earlier fixes reported with it
+func (s *Service) checkGeofences(gpsTrack *models.GPSTrack, companyID string, earlier []*models.GPSTrack) {
+	if s.geofenceMonitor == nil {
+		return
+	}
+
+	driverID := ""
+	if gpsTrack.DriverID != nil {
+		driverID = *gpsTrack.DriverID
+	}
+
+	if len(earlier) > 0 {
+		locations := make([]geofencing.Location, 0, len(earlier))
+		for _, track := range earlier {
+			locations = append(locations, geofenceLocation(track))
+		}
+		if err := s.geofenceMonitor.ReplayLocations(ctx, gpsTrack.VehicleID, driverID, companyID, locations); err != nil {
+			fmt.Printf("Failed to replay geofences for vehicle %s: %v\n", gpsTrack.VehicleID, err)
+		}
+	}
+
+	if err := s.geofenceMonitor.TrackLocation(ctx, gpsTrack.VehicleID, driverID, companyID, geofenceLocation(gpsTrack)); err != nil {
+		fmt.Printf("Failed to check geofences for vehicle %s: %v\n", gpsTrack.VehicleID, err)
+	}
+}
+
+// geofenceLocation converts a GPS fix to a geofence monitor location
+func geofenceLocation(gpsTrack *models.GPSTrack) geofencing.Location {
+	return geofencing.Location{
+		Latitude:  gpsTrack.Latitude,
+		Longitude: gpsTrack.Longitude,
+		Speed:     gpsTrack.Speed,
+		Heading:   gpsTrack.Heading,
+		Accuracy:  gpsTrack.Accuracy,
+		Timestamp: gpsTrack.Timestamp,
+	}
 }
 
 // validateGPSCoordinates validates GPS coordinates and accuracy
@@ -629,191 +690,151 @@ func (s *Service) isImpossibleLocation(lat, lng float64) bool {
 	return false
 }
 
-// updateVehicleLocation updates the vehicle's last known location
-func (s *Service) updateVehicleLocation(vehicleID string, lat, lng, _ float64, timestamp time.Time) error {
-	return s.db.Model(&models.Vehicle{}).Where("id = ?", vehicleID).Updates(map[string]interface{}{
+// updateVehicleLocation updates the vehicle's last known location and
+// reports whether it moved. Fixes older than the stored one, such as
+// offline syncs, do not move it back.
+func (s *Service) updateVehicleLocation(vehicleID string, lat, lng, _ float64, timestamp time.Time) (bool, error) {
+	update := s.db.Model(&models.Vehicle{}).Where("id = ? AND (last_updated_at IS NULL OR last_updated_at <= ?)", vehicleID, timestamp).Updates(map[string]interface{}{
 		"last_latitude":   lat,
 		"last_longitude":  lng,
 		"last_updated_at": timestamp,
-	}).Error
+	})
+	return update.RowsAffected > 0, update.Error
 }
 
-// processDriverBehavior analyzes GPS data for driver behavior events
+// processDriverBehavior evaluates the vehicle's recent track against the
+// driver behavior rules of its company and vehicle type
 func (s *Service) processDriverBehavior(gpsTrack *models.GPSTrack) {
-	// Get recent GPS tracks for this driver to analyze behavior
-	var recentTracks []models.GPSTrack
-	if err := s.db.Where("driver_id = ? AND timestamp > ?", 
-		gpsTrack.DriverID, time.Now().Add(-5*time.Minute)).Order("timestamp DESC").Limit(10).Find(&recentTracks).Error; err != nil {
+	// Behavior events belong to a driver
+	if gpsTrack.DriverID == nil {
+		return
+	}
+
+	var vehicle models.Vehicle
+	if err := s.db.Select("id", "company_id", "type").Where("id = ?", gpsTrack.VehicleID).First(&vehicle).Error; err != nil {
+		return
+	}
+
+	rules, err := s.behaviorRules(vehicle.CompanyID, vehicle.Type)
+	if err != nil {
+		fmt.Printf("Failed to get driver behavior rules: %v\n", err)
 		return
 	}
 
-	// Check for speed violations (Indonesian speed limits)
-	if gpsTrack.Speed > 80 { // 80 km/h is typical urban speed limit in Indonesia
-		// Create driver event
+	// Get the vehicle's recent track, up to this fix, to analyze behavior
+	var window []models.GPSTrack
+	if err := s.db.Select("vehicle_id", "driver_id", "latitude", "longitude", "accuracy", "speed", "speed_limit", "timestamp").
+		Where("vehicle_id = ? AND timestamp > ? AND timestamp <= ?", gpsTrack.VehicleID, gpsTrack.Timestamp.Add(-behaviorWindow), gpsTrack.Timestamp).
+		Order("timestamp ASC").Find(&window).Error; err != nil {
+		return
+	}
+	if len(window) == 0 || !window[len(window)-1].Timestamp.Equal(gpsTrack.Timestamp) {
+		window = append(window, *gpsTrack)
+	}
+
+	// Speeding is measured against the limit of the road driven, when known
+	if result := s.matchTrack(window); result != nil {
+		applyRoadSpeedLimits(window, result)
+		if limit := window[len(window)-1].SpeedLimit; limit > 0 && limit != gpsTrack.SpeedLimit {
+			gpsTrack.SpeedLimit = limit
+			if err := s.db.Model(&models.GPSTrack{}).Where("id = ?", gpsTrack.ID).Update("speed_limit", limit).Error; err != nil {
+				fmt.Printf("Failed to store speed limit of GPS track %s: %v\n", gpsTrack.ID, err)
+			}
+		}
+	}
+
+	evaluator := newBehaviorEvaluator(rules, s.behaviorCooldowns(gpsTrack.VehicleID, rules, gpsTrack.Timestamp))
+	for _, violation := range evaluator.evaluate(window) {
 		event := models.DriverEvent{
 			DriverID:    *gpsTrack.DriverID,
 			VehicleID:   gpsTrack.VehicleID,
-			EventType:   "speed_violation",
-			Severity:    s.getSpeedViolationSeverity(gpsTrack.Speed),
-			Latitude:    gpsTrack.Latitude,
-			Longitude:   gpsTrack.Longitude,
-			Speed:       gpsTrack.Speed,
-			Description: fmt.Sprintf("Speed violation: %.1f km/h", gpsTrack.Speed),
+			EventType:   violation.EventType,
+			Severity:    violation.Severity,
+			Latitude:    violation.Latitude,
+			Longitude:   violation.Longitude,
+			Speed:       violation.Speed,
+			Description: describeBehaviorViolation(violation),
+			Data: models.JSON{
+				"value":            violation.Value,
+				"threshold":        violation.Threshold,
+				"started_at":       violation.StartedAt,
+				"duration_seconds": violation.DurationSeconds,
+			},
+			CreatedAt: violation.DetectedAt, // cooldowns are measured in track time
 		}
-		
-		if err := s.createDriverEvent(event); err != nil {
+
+		if err := s.createDriverEvent(event, vehicle.CompanyID); err != nil {
 			// Log error but don't fail the GPS tracking
-			fmt.Printf("Failed to create speed violation event: %v\n", err)
+			fmt.Printf("Failed to create %s event: %v\n", violation.EventType, err)
+			continue
 		}
-		
-		// Create real-time alert
-		go func() {
-			// Get vehicle to get company ID
-			var vehicle models.Vehicle
-			if err := s.db.Where("id = ?", gpsTrack.VehicleID).First(&vehicle).Error; err == nil {
-				if err := s.alertSystem.CreateSpeedViolationAlert(ctx, vehicle.CompanyID, gpsTrack.VehicleID, *gpsTrack.DriverID, gpsTrack.Speed, 80, fmt.Sprintf("%.6f,%.6f", gpsTrack.Latitude, gpsTrack.Longitude)); err != nil {
-					fmt.Printf("Failed to create speed violation alert: %v\n", err)
-				}
-			}
-		}()
-	}
 
-	// Check for harsh braking
-	if len(recentTracks) >= 2 {
-		prevTrack := recentTracks[1]
-		deceleration := (prevTrack.Speed - gpsTrack.Speed) / float64(gpsTrack.Timestamp.Sub(prevTrack.Timestamp).Seconds())
-		if deceleration > 3.5 { // m/s² threshold for harsh braking
-			if err := s.createDriverEvent(models.DriverEvent{
-				DriverID:    *gpsTrack.DriverID,
-				VehicleID:   gpsTrack.VehicleID,
-				EventType:   "harsh_braking",
-				Severity:    s.getBrakingSeverity(deceleration),
-				Latitude:    gpsTrack.Latitude,
-				Longitude:   gpsTrack.Longitude,
-				Speed:       gpsTrack.Speed,
-				Description: fmt.Sprintf("Harsh braking: %.2f m/s²", deceleration),
-			}); err != nil {
-				// Log error but don't fail the GPS tracking
-				fmt.Printf("Failed to create harsh braking event: %v\n", err)
+		if violation.EventType == models.BehaviorSpeedViolation {
+			// Create real-time alert
+			if err := s.alertSystem.CreateSpeedViolationAlert(ctx, vehicle.CompanyID, gpsTrack.VehicleID, *gpsTrack.DriverID, violation.Value, violation.Threshold, fmt.Sprintf("%.6f,%.6f", violation.Latitude, violation.Longitude)); err != nil {
+				fmt.Printf("Failed to create speed violation alert: %v\n", err)
 			}
 		}
 	}
+}
 
-	// Check for rapid acceleration
-	if len(recentTracks) >= 2 {
-		prevTrack := recentTracks[1]
-		acceleration := (gpsTrack.Speed - prevTrack.Speed) / float64(gpsTrack.Timestamp.Sub(prevTrack.Timestamp).Seconds())
-		if acceleration > 2.5 { // m/s² threshold for rapid acceleration
-			if err := s.createDriverEvent(models.DriverEvent{
-				DriverID:    *gpsTrack.DriverID,
-				VehicleID:   gpsTrack.VehicleID,
-				EventType:   "rapid_acceleration",
-				Severity:    s.getAccelerationSeverity(acceleration),
-				Latitude:    gpsTrack.Latitude,
-				Longitude:   gpsTrack.Longitude,
-				Speed:       gpsTrack.Speed,
-				Description: fmt.Sprintf("Rapid acceleration: %.2f m/s²", acceleration),
-			}); err != nil {
-				// Log error but don't fail the GPS tracking
-				fmt.Printf("Failed to create rapid acceleration event: %v\n", err)
-			}
-		}
+// describeBehaviorViolation returns a driver event description
+func describeBehaviorViolation(violation BehaviorViolation) string {
+	switch violation.EventType {
+	case models.BehaviorSpeedViolation:
+		return fmt.Sprintf("Speed violation: %.1f km/h for %.0f s (limit %.0f km/h)", violation.Value, violation.DurationSeconds, violation.Threshold)
+	case models.BehaviorHarshBraking:
+		return fmt.Sprintf("Harsh braking: %.2f m/s²", violation.Value)
+	default:
+		return fmt.Sprintf("Rapid acceleration: %.2f m/s²", violation.Value)
 	}
 }
 
-// createDriverEvent creates a driver behavior event
-func (s *Service) createDriverEvent(event models.DriverEvent) error {
+// createDriverEvent creates a driver behavior event of a company's vehicle
+func (s *Service) createDriverEvent(event models.DriverEvent, companyID string) error {
 	if err := s.db.Create(&event).Error; err != nil {
 		return fmt.Errorf("failed to create driver event: %w", err)
 	}
 	
 	// Broadcast event to WebSocket clients
-	go s.broadcastDriverEvent(&event)
+	go s.broadcastDriverEvent(&event, companyID)
 	
 	return nil
 }
 
-// getSpeedViolationSeverity returns severity based on speed
-func (s *Service) getSpeedViolationSeverity(speed float64) string {
-	if speed > 120 {
-		return "critical"
-	} else if speed > 100 {
-		return "high"
-	} else if speed > 90 {
-		return "medium"
-	}
-	return "low"
-}
-
-// getBrakingSeverity returns severity based on deceleration
-func (s *Service) getBrakingSeverity(deceleration float64) string {
-	if deceleration > 5.0 {
-		return "critical"
-	} else if deceleration > 4.0 {
-		return "high"
-	}
-	return "medium"
-}
-
-// getAccelerationSeverity returns severity based on acceleration
-func (s *Service) getAccelerationSeverity(acceleration float64) string {
-	if acceleration > 3.5 {
-		return "critical"
-	} else if acceleration > 3.0 {
-		return "high"
-	}
-	return "medium"
-}
-
-// broadcastGPSUpdate broadcasts GPS update to WebSocket clients
-func (s *Service) broadcastGPSUpdate(gpsTrack *models.GPSTrack) {
-	// Create GPS update message
-	message := map[string]interface{}{
-		"type":      "gps_update",
-		"vehicle_id": gpsTrack.VehicleID,
-		"latitude":  gpsTrack.Latitude,
-		"longitude": gpsTrack.Longitude,
-		"speed":     gpsTrack.Speed,
-		"heading":   gpsTrack.Heading,
-		"timestamp": gpsTrack.Timestamp,
-	}
-	
-	// Marshal to JSON
-	data, err := json.Marshal(message)
-	if err != nil {
-		fmt.Printf("Failed to marshal GPS update message: %v\n", err)
-		return
-	}
-	
-	// Broadcast to local WebSocket clients
-	s.localWebSocketHub.Broadcast(data)
+// broadcastGPSUpdate broadcasts GPS update to the company's WebSocket clients
+func (s *Service) broadcastGPSUpdate(gpsTrack *models.GPSTrack, companyID string) {
+	s.websocketHub.BroadcastToCompany(companyID, realtime.WebSocketMessage{
+		Type: "gps_update",
+		Data: map[string]interface{}{
+			"vehicle_id": gpsTrack.VehicleID,
+			"latitude":   gpsTrack.Latitude,
+			"longitude":  gpsTrack.Longitude,
+			"speed":      gpsTrack.Speed,
+			"heading":    gpsTrack.Heading,
+			"timestamp":  gpsTrack.Timestamp,
+		},
+		Timestamp: time.Now(),
+	})
 }
 
-// broadcastDriverEvent broadcasts driver event to WebSocket clients
-func (s *Service) broadcastDriverEvent(event *models.DriverEvent) {
-	// Create driver event message
-	message := map[string]interface{}{
-		"type":        "driver_event",
-		"driver_id":   event.DriverID,
-		"vehicle_id":  event.VehicleID,
-		"event_type":  event.EventType,
-		"severity":    event.Severity,
-		"latitude":    event.Latitude,
-		"longitude":   event.Longitude,
-		"speed":       event.Speed,
-		"description": event.Description,
-		"timestamp":   event.CreatedAt,
-	}
-	
-	// Marshal to JSON
-	data, err := json.Marshal(message)
-	if err != nil {
-		fmt.Printf("Failed to marshal driver event message: %v\n", err)
-		return
-	}
-	
-	// Broadcast to local WebSocket clients
-	s.localWebSocketHub.Broadcast(data)
+// broadcastDriverEvent broadcasts driver event to the company's WebSocket clients
+func (s *Service) broadcastDriverEvent(event *models.DriverEvent, companyID string) {
+	s.websocketHub.BroadcastToCompany(companyID, realtime.WebSocketMessage{
+		Type: "driver_event",
+		Data: map[string]interface{}{
+			"driver_id":   event.DriverID,
+			"vehicle_id":  event.VehicleID,
+			"event_type":  event.EventType,
+			"severity":    event.Severity,
+			"latitude":    event.Latitude,
+			"longitude":   event.Longitude,
+			"speed":       event.Speed,
+			"description": event.Description,
+			"timestamp":   event.CreatedAt,
+		},
+		Timestamp: time.Now(),
+	})
 }
 
 
@@ -964,7 +985,7 @@ func (s *Service) ProcessDriverEvent(req DriverEventRequest) (*models.DriverEven
 	}
 
 	// Broadcast to WebSocket clients
-	go s.broadcastDriverEvent(event)
+	go s.broadcastDriverEvent(event, vehicle.CompanyID)
 
 	// Update driver performance scores based on event
 	go s.updateDriverPerformanceFromEvent(event)
@@ -1031,57 +1052,55 @@ func (s *Service) HandleWebSocket(c *gin.Context) {
 	s.websocketHub.HandleWebSocket(c)
 }
 
-// HandleLocalWebSocket handles WebSocket connections using the local hub
-func (s *Service) HandleLocalWebSocket(c *gin.Context) {
-	// Upgrade HTTP connection to WebSocket
-	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins in development
-		},
+// ConfigureWebSocket sets how WebSocket handshakes are authenticated and
+// which browser origins may connect
+func (s *Service) ConfigureWebSocket(authenticator realtime.Authenticator, allowedOrigins []string) {
+	s.websocketHub.SetAuthenticator(authenticator)
+	s.websocketHub.SetAllowedOrigins(allowedOrigins)
+	s.wsAuthenticator = authenticator
+}
+
+// CreateWebSocketTicket exchanges an access token for a short-lived ticket
+// that browsers pass as ?ticket= when opening the tracking WebSocket
+func (s *Service) CreateWebSocketTicket(ctx context.Context, accessToken string) (string, error) {
+	if s.wsAuthenticator == nil {
+		return "", apperrors.NewServiceUnavailableError("WebSocket authentication is not configured")
 	}
-	
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+
+	ticket, err := s.wsAuthenticator.IssueTicket(ctx, accessToken)
 	if err != nil {
-		fmt.Printf("Failed to upgrade WebSocket connection: %v\n", err)
-		return
-	}
-	
-	// Register connection with local hub
-	s.localWebSocketHub.Register(conn)
-	
-	// Send welcome message
-	welcomeMsg := map[string]interface{}{
-		"type":    "welcome",
-		"message": "Connected to tracking WebSocket",
-		"client_count": s.localWebSocketHub.GetClientCount(),
-	}
-	
-	data, err := json.Marshal(welcomeMsg)
-	if err == nil {
-		conn.WriteMessage(websocket.TextMessage, data)
-	}
-	
-	// Handle incoming messages and cleanup on disconnect
-	defer func() {
-		s.localWebSocketHub.Unregister(conn)
-		conn.Close()
-	}()
-	
-	// Keep connection alive and handle incoming messages
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				fmt.Printf("WebSocket error: %v\n", err)
-			}
-			break
+		if errors.Is(err, realtime.ErrUnauthenticated) {
+			return "", apperrors.NewUnauthorizedError("Session is no longer active")
 		}
+		return "", apperrors.Wrap(err, "failed to create WebSocket ticket")
 	}
+	return ticket, nil
 }
 
 // GetWebSocketClientCount returns the number of connected WebSocket clients
 func (s *Service) GetWebSocketClientCount() int {
-	return s.localWebSocketHub.GetClientCount()
+	return s.websocketHub.GetConnectedClients()
+}
+
+// GetAlertSystem returns the real-time alert system shared with other services
+func (s *Service) GetAlertSystem() *realtime.AlertSystem {
+	return s.alertSystem
+}
+
+// GetAnalyticsBroadcaster returns the analytics broadcaster
+func (s *Service) GetAnalyticsBroadcaster() *realtime.AnalyticsBroadcaster {
+	return s.analyticsBroadcaster
+}
+
+// GetGeofenceManager returns the manager that stores the company geofences
+func (s *Service) GetGeofenceManager() *geofencing.GeofenceManager {
+	return s.geofenceManager
+}
+
+// SetGeofenceMonitor sets the monitor that checks every accepted GPS fix
+// against the company's geofences
+func (s *Service) SetGeofenceMonitor(monitor *geofencing.GeofenceMonitor) {
+	s.geofenceMonitor = monitor
 }
 
 
@@ -1104,6 +1123,11 @@ func (s *Service) StartTrip(req TripRequest) (*models.Trip, error) {
 		return nil, apperrors.Wrap(err, "failed to validate driver")
 	}
 
+	// A trip started by the driver replaces the detected one
+	if err := s.closeDetectedTripsOf(vehicle.ID); err != nil {
+		return nil, apperrors.Wrap(err, "failed to close detected trip")
+	}
+
 	// Create trip
 	trip := &models.Trip{
 		CompanyID:       vehicle.CompanyID,
@@ -1222,6 +1246,11 @@ func (s *Service) calculateTripMetrics(trip *models.Trip) error {
 		}
 	}
 
+	// Follow the roads driven rather than straight lines between fixes
+	if matched, ok := matchedDistance(gpsTracks, s.matchTrack(gpsTracks)); ok {
+		totalDistance = matched
+	}
+
 	trip.TotalDistance = totalDistance
 	trip.MaxSpeed = maxSpeed
 	if speedCount > 0 {
@@ -1246,7 +1275,8 @@ func (s *Service) calculateDistance(lat1, lng1, lat2, lng2 float64) float64 {
 	return R * c
 }
 
-// CreateGeofence creates a new geofence
+// CreateGeofence creates a new geofence through the geofence manager, so the
+// zone drives violations, analytics and alerts
 func (s *Service) CreateGeofence(req GeofenceRequest) (*models.Geofence, error) {
 	// Validate company exists
 	var company models.Company
@@ -1259,21 +1289,35 @@ func (s *Service) CreateGeofence(req GeofenceRequest) (*models.Geofence, error)
 
 	// Create geofence
 	geofence := &models.Geofence{
-		CompanyID:       req.CompanyID,
-		Name:            req.Name,
-		Type:            req.Type,
-		CenterLatitude:  req.CenterLat,
-		CenterLongitude: req.CenterLng,
-		Radius:          req.Radius,
-		AlertOnEnter:    req.AlertOnEntry,
-		AlertOnExit:     req.AlertOnExit,
-		IsActive:        req.IsActive,
-		Description:     req.Description,
-	}
-
-	// Save to database
-	if err := s.db.Create(geofence).Error; err != nil {
-		return nil, fmt.Errorf("failed to create geofence: %w", err)
+		CompanyID:          req.CompanyID,
+		Name:               req.Name,
+		Shape:              req.Shape,
+		Category:           req.Type,
+		CenterLatitude:     req.CenterLat,
+		CenterLongitude:    req.CenterLng,
+		Radius:             req.Radius,
+		PolygonData:        req.PolygonData,
+		AlertOnEnter:       req.AlertOnEntry,
+		AlertOnExit:        req.AlertOnExit,
+		AlertOnDwell:       req.AlertOnDwell,
+		DwellTime:          req.DwellTime,
+		AlertOnSpeed:       req.AlertOnSpeed || req.SpeedLimit > 0,
+		SpeedLimit:         req.SpeedLimit,
+		Priority:           req.Priority,
+		IsActive:           req.IsActive,
+		Description:        req.Description,
+		TimeRestrictions:   req.TimeRestrictions,
+		AllowedVehicles:    req.AllowedVehicles,
+		AllowedDrivers:     req.AllowedDrivers,
+		RestrictedVehicles: req.RestrictedVehicles,
+		RestrictedDrivers:  req.RestrictedDrivers,
+	}
+	if req.CreatedBy != "" {
+		geofence.CreatedBy = &req.CreatedBy
+	}
+
+	if err := s.geofenceManager.CreateGeofence(ctx, geofence); err != nil {
+		return nil, err
 	}
 
 	// Cache the geofence for 1 hour
@@ -1289,6 +1333,11 @@ func (s *Service) CreateGeofence(req GeofenceRequest) (*models.Geofence, error)
 	return geofence, nil
 }
 
+// GetGeofences lists company geofences, filtered by shape, category and is_active
+func (s *Service) GetGeofences(companyID string, filters map[string]interface{}) ([]models.Geofence, error) {
+	return s.geofenceManager.FindGeofences(ctx, companyID, filters)
+}
+
 // CheckGeofenceViolations checks if a GPS point violates any geofences
 func (s *Service) CheckGeofenceViolations(vehicleID string, lat, lng float64) ([]models.Geofence, error) {
 	// Get vehicle's company ID
@@ -1319,14 +1368,107 @@ func (s *Service) CheckGeofenceViolations(vehicleID string, lat, lng float64) ([
 		}
 	}
 
-	// Check each geofence
+	// Check each geofence against its own shape
 	var violations []models.Geofence
-	for _, geofence := range geofences {
-		distance := s.calculateDistance(lat, lng, geofence.CenterLatitude, geofence.CenterLongitude)
-		if distance <= geofence.Radius {
-			violations = append(violations, geofence)
+	for i := range geofences {
+		if geofences[i].IsPointInside(lat, lng) {
+			violations = append(violations, geofences[i])
 		}
 	}
 
 	return violations, nil
 }
+
+// UpdateGeofence applies a partial update to a company geofence and re-validates it
+func (s *Service) UpdateGeofence(companyID, geofenceID string, req GeofenceRequest) (*models.Geofence, error) {
+	geofence, err := s.geofenceManager.GetGeofence(ctx, companyID, geofenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		geofence.Name = req.Name
+	}
+	if req.Type != "" {
+		if !models.IsGeofencePurpose(req.Type) {
+			return nil, apperrors.NewValidationError("type must be one of zone, pickup, delivery, restricted")
+		}
+		geofence.Category = req.Type
+	}
+	if req.Shape != "" {
+		geofence.Shape = req.Shape
+	}
+	if req.CenterLat != 0 {
+		geofence.CenterLatitude = req.CenterLat
+	}
+	if req.CenterLng != 0 {
+		geofence.CenterLongitude = req.CenterLng
+	}
+	if req.Radius != 0 {
+		geofence.Radius = req.Radius
+	}
+	if req.PolygonData != nil {
+		geofence.PolygonData = req.PolygonData
+	}
+	geofence.AlertOnEnter = req.AlertOnEntry
+	geofence.AlertOnExit = req.AlertOnExit
+	geofence.AlertOnDwell = req.AlertOnDwell
+	geofence.AlertOnSpeed = req.AlertOnSpeed || req.SpeedLimit > 0
+	geofence.IsActive = req.IsActive
+	if req.DwellTime != 0 {
+		geofence.DwellTime = req.DwellTime
+	}
+	if req.SpeedLimit != 0 {
+		geofence.SpeedLimit = req.SpeedLimit
+	}
+	if req.Priority != 0 {
+		geofence.Priority = req.Priority
+	}
+	if req.Description != "" {
+		geofence.Description = req.Description
+	}
+	if req.TimeRestrictions != nil {
+		geofence.TimeRestrictions = req.TimeRestrictions
+	}
+	if req.AllowedVehicles != nil {
+		geofence.AllowedVehicles = req.AllowedVehicles
+	}
+	if req.AllowedDrivers != nil {
+		geofence.AllowedDrivers = req.AllowedDrivers
+	}
+	if req.RestrictedVehicles != nil {
+		geofence.RestrictedVehicles = req.RestrictedVehicles
+	}
+	if req.RestrictedDrivers != nil {
+		geofence.RestrictedDrivers = req.RestrictedDrivers
+	}
+
+	if err := s.geofenceManager.UpdateGeofence(ctx, geofence); err != nil {
+		return nil, err
+	}
+
+	s.invalidateGeofenceCaches(companyID, geofence.ID)
+
+	return geofence, nil
+}
+
+// DeleteGeofence removes a company geofence
+func (s *Service) DeleteGeofence(companyID, geofenceID string) error {
+	if err := s.geofenceManager.DeleteGeofence(ctx, companyID, geofenceID); err != nil {
+		return err
+	}
+
+	s.invalidateGeofenceCaches(companyID, geofenceID)
+
+	return nil
+}
+
+// invalidateGeofenceCaches drops the cached geofence and the company geofence list
+func (s *Service) invalidateGeofenceCaches(companyID, geofenceID string) {
+	if err := s.cache.InvalidateGeofenceCache(ctx, geofenceID); err != nil {
+		fmt.Printf("Failed to invalidate geofence cache %s: %v\n", geofenceID, err)
+	}
+	if err := s.cache.InvalidateGeofencesByCompanyCache(ctx, companyID); err != nil {
+		fmt.Printf("Failed to invalidate company geofences cache %s: %v\n", companyID, err)
+	}
+}
@@ -1,14 +1,42 @@
 package tracking
 
 import (
+	"context"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/database"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/geofencing"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/testutil"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+	"gorm.io/gorm"
 )
 
+// createTestVehicle creates a vehicle with a unique license plate and VIN,
+// which soft-deleted vehicles of earlier tests keep reserved
+func createTestVehicle(t *testing.T, db *gorm.DB, companyID string) *models.Vehicle {
+	vehicle := testutil.NewTestVehicle(companyID)
+	suffix := strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", ""))
+	vehicle.LicensePlate = "B " + suffix[:8]
+	vehicle.VIN = suffix[:17]
+	require.NoError(t, db.Create(vehicle).Error)
+	return vehicle
+}
+
+// assertAppErrorStatus asserts that err is an AppError with an HTTP status
+func assertAppErrorStatus(t *testing.T, err error, status int) {
+	t.Helper()
+	appErr, ok := err.(*apperrors.AppError)
+	require.True(t, ok, "expected an AppError, got %v", err)
+	assert.Equal(t, status, appErr.Status)
+}
+
 func TestService_ProcessGPSData(t *testing.T) {
 	db, cleanup := testutil.SetupTestDB(t)
 	defer cleanup()
@@ -140,6 +168,51 @@ func TestService_ProcessGPSData(t *testing.T) {
 	}
 }
 
+func TestService_ProcessGPSData_LateFix(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	redisClient, _ := database.ConnectRedis("redis://localhost:6379")
+	service := NewService(db, redisClient)
+	ctx := context.Background()
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	vehicle := testutil.NewTestVehicle(company.ID)
+	require.NoError(t, db.Create(vehicle).Error)
+	driver := testutil.NewTestDriver(company.ID)
+	driver.VehicleID = &vehicle.ID
+	require.NoError(t, db.Create(driver).Error)
+
+	now := time.Now().Truncate(time.Second)
+	fix := func(lat float64, at time.Time) GPSDataRequest {
+		return GPSDataRequest{VehicleID: vehicle.ID, DriverID: driver.ID, Latitude: lat, Longitude: 106.8456, Speed: 40, Accuracy: 5, Timestamp: at}
+	}
+
+	_, err := service.ProcessGPSData(fix(-6.2088, now))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		cached, err := service.cache.GetCurrentLocationFromCache(ctx, vehicle.ID)
+		return err == nil && cached != nil
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// A fix synced after driving out of coverage ten minutes earlier
+	late, err := service.ProcessGPSData(fix(-6.3, now.Add(-10*time.Minute)))
+	require.NoError(t, err)
+	testutil.AssertValidUUID(t, late.ID)
+	time.Sleep(100 * time.Millisecond)
+
+	cached, err := service.cache.GetCurrentLocationFromCache(ctx, vehicle.ID)
+	require.NoError(t, err)
+	require.NotNil(t, cached)
+	assert.Equal(t, -6.2088, cached.Latitude, "the live position does not jump back")
+	assert.Equal(t, now.Unix(), cached.Timestamp.Unix())
+
+	var current models.Vehicle
+	require.NoError(t, db.First(&current, "id = ?", vehicle.ID).Error)
+	assert.Equal(t, -6.2088, current.LastLatitude)
+}
+
 func TestService_ValidateGPSCoordinates(t *testing.T) {
 	db, cleanup := testutil.SetupTestDB(t)
 	defer cleanup()
@@ -488,6 +561,9 @@ func TestService_GetSpeedViolationSeverity(t *testing.T) {
 	defer cleanup()
 
 	service := NewService(db, nil)
+	rules := mergeBehaviorRules(service.behaviorDefaults)
+	require.Equal(t, models.BehaviorSpeedViolation, rules[0].EventType)
+	speedRule := rules[0]
 
 	tests := []struct {
 		name     string
@@ -506,7 +582,7 @@ func TestService_GetSpeedViolationSeverity(t *testing.T) {
 		},
 		{
 			name:     "high speeding",
-			speed:    125.0,
+			speed:    110.0,
 			expected: "high",
 		},
 		{
@@ -514,11 +590,21 @@ func TestService_GetSpeedViolationSeverity(t *testing.T) {
 			speed:    155.0,
 			expected: "critical",
 		},
+		{
+			name:     "at the high limit",
+			speed:    100.0,
+			expected: "medium",
+		},
+		{
+			name:     "at the highway limit",
+			speed:    120.0,
+			expected: "high",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			severity := service.getSpeedViolationSeverity(tt.speed)
+			severity := speedRule.Severity(tt.speed)
 			assert.Equal(t, tt.expected, severity)
 		})
 	}
@@ -582,10 +668,197 @@ func TestService_CreateGeofence(t *testing.T) {
 				testutil.AssertValidUUID(t, geofence.ID)
 				assert.Equal(t, tt.request.CompanyID, geofence.CompanyID)
 				assert.Equal(t, tt.request.Name, geofence.Name)
-				assert.Equal(t, tt.request.Type, geofence.Type)
+				assert.Equal(t, tt.request.Type, geofence.Category)
+				assert.Equal(t, "circle", geofence.Shape)
 			}
 		})
 	}
+
+	t.Run("create polygon geofence", func(t *testing.T) {
+		geofence, err := service.CreateGeofence(GeofenceRequest{
+			CompanyID: company.ID,
+			Name:      "Tanjung Priok Depot",
+			Type:      "restricted",
+			Shape:     "polygon",
+			PolygonData: models.JSON{
+				"type": "Polygon",
+				"coordinates": []interface{}{
+					[]interface{}{
+						[]interface{}{106.88, -6.11},
+						[]interface{}{106.90, -6.11},
+						[]interface{}{106.90, -6.09},
+						[]interface{}{106.88, -6.09},
+						[]interface{}{106.88, -6.11},
+					},
+				},
+			},
+			IsActive: true,
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, "polygon", geofence.Shape)
+		assert.InDelta(t, -6.10, geofence.CenterLatitude, 0.0001)
+		assert.True(t, geofence.IsPointInside(-6.10, 106.89))
+	})
+
+	t.Run("reject unclosed polygon", func(t *testing.T) {
+		geofence, err := service.CreateGeofence(GeofenceRequest{
+			CompanyID: company.ID,
+			Name:      "Broken",
+			Type:      "zone",
+			Shape:     "polygon",
+			PolygonData: models.JSON{
+				"type": "Polygon",
+				"coordinates": []interface{}{
+					[]interface{}{
+						[]interface{}{106.88, -6.11},
+						[]interface{}{106.90, -6.11},
+						[]interface{}{106.90, -6.09},
+						[]interface{}{106.88, -6.09},
+					},
+				},
+			},
+			IsActive: true,
+		})
+
+		assert.Error(t, err)
+		assert.Nil(t, geofence)
+	})
+
+	t.Run("filter by category and shape", func(t *testing.T) {
+		restricted, err := service.GetGeofences(company.ID, map[string]interface{}{"category": "restricted"})
+		require.NoError(t, err)
+		require.Len(t, restricted, 1)
+		assert.Equal(t, "Tanjung Priok Depot", restricted[0].Name)
+
+		circles, err := service.GetGeofences(company.ID, map[string]interface{}{"shape": "circle"})
+		require.NoError(t, err)
+		for _, geofence := range circles {
+			assert.Equal(t, "circle", geofence.Shape)
+		}
+		assert.NotEmpty(t, circles)
+	})
+}
+
+func TestService_GeofenceEvents(t *testing.T) {
+	db, cleanup := testutil.SetupTestDB(t)
+	defer cleanup()
+
+	service := NewService(db, nil)
+	manager := service.GetGeofenceManager()
+	ctx := context.Background()
+
+	company := testutil.NewTestCompany()
+	require.NoError(t, db.Create(company).Error)
+	otherCompany := testutil.NewTestCompany()
+	require.NoError(t, db.Create(otherCompany).Error)
+
+	vehicle := createTestVehicle(t, db, company.ID)
+
+	geofence, err := service.CreateGeofence(GeofenceRequest{
+		CompanyID:          company.ID,
+		Name:               "Depot",
+		Type:               "restricted",
+		CenterLat:          -6.2088,
+		CenterLng:          106.8456,
+		Radius:             500.0,
+		AlertOnSpeed:       true,
+		SpeedLimit:         40,
+		RestrictedVehicles: []string{vehicle.ID},
+		IsActive:           true,
+	})
+	require.NoError(t, err)
+
+	entered := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	result, err := manager.CheckGeofences(ctx, &geofencing.GeofenceCheckRequest{
+		VehicleID: vehicle.ID,
+		CompanyID: company.ID,
+		Latitude:  -6.2088,
+		Longitude: 106.8456,
+		Speed:     60,
+		Timestamp: entered,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.GeofenceEvents, 2)
+	require.Len(t, result.Violations, 2)
+
+	t.Run("events are stored per company", func(t *testing.T) {
+		events, err := manager.GetGeofenceEvents(ctx, company.ID, map[string]interface{}{})
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		for _, event := range events {
+			testutil.AssertValidUUID(t, event.ID)
+			assert.Equal(t, geofence.ID, event.GeofenceID)
+			assert.Equal(t, vehicle.ID, event.VehicleID)
+			assert.Empty(t, event.DriverID)
+		}
+
+		entries, err := manager.GetGeofenceEvents(ctx, company.ID, map[string]interface{}{"event_type": "entry"})
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.True(t, entries[0].EventTime.Equal(entered))
+
+		others, err := manager.GetGeofenceEvents(ctx, otherCompany.ID, map[string]interface{}{})
+		require.NoError(t, err)
+		assert.Empty(t, others)
+	})
+
+	t.Run("violations are stored per company", func(t *testing.T) {
+		violations, err := manager.GetGeofenceViolations(ctx, company.ID, map[string]interface{}{"is_resolved": false})
+		require.NoError(t, err)
+		assert.Len(t, violations, 2)
+
+		speeding, err := manager.GetGeofenceViolations(ctx, company.ID, map[string]interface{}{"violation_type": "speed_violation"})
+		require.NoError(t, err)
+		require.Len(t, speeding, 1)
+		assert.Equal(t, "high", speeding[0].Severity)
+		assert.Equal(t, 60.0, speeding[0].Speed)
+
+		others, err := manager.GetGeofenceViolations(ctx, otherCompany.ID, map[string]interface{}{})
+		require.NoError(t, err)
+		assert.Empty(t, others)
+	})
+
+	t.Run("resolve violation", func(t *testing.T) {
+		unauthorized, err := manager.GetGeofenceViolations(ctx, company.ID, map[string]interface{}{"violation_type": "unauthorized_entry"})
+		require.NoError(t, err)
+		require.Len(t, unauthorized, 1)
+		resolvedBy := uuid.New().String()
+
+		err = manager.ResolveViolation(ctx, otherCompany.ID, unauthorized[0].ID, resolvedBy, "not ours")
+		assertAppErrorStatus(t, err, http.StatusNotFound)
+
+		err = manager.ResolveViolation(ctx, company.ID, uuid.New().String(), resolvedBy, "missing")
+		assertAppErrorStatus(t, err, http.StatusNotFound)
+
+		require.NoError(t, manager.ResolveViolation(ctx, company.ID, unauthorized[0].ID, resolvedBy, "Delivery approved by dispatcher"))
+
+		resolved, err := manager.GetGeofenceViolations(ctx, company.ID, map[string]interface{}{"is_resolved": true})
+		require.NoError(t, err)
+		require.Len(t, resolved, 1)
+		assert.Equal(t, unauthorized[0].ID, resolved[0].ID)
+		assert.Equal(t, "Delivery approved by dispatcher", resolved[0].Resolution)
+		require.NotNil(t, resolved[0].ResolvedBy)
+		assert.Equal(t, resolvedBy, *resolved[0].ResolvedBy)
+		assert.NotNil(t, resolved[0].ResolvedAt)
+	})
+
+	t.Run("exit is stored with the dwell duration", func(t *testing.T) {
+		_, err := manager.CheckGeofences(ctx, &geofencing.GeofenceCheckRequest{
+			VehicleID: vehicle.ID,
+			CompanyID: company.ID,
+			Latitude:  -6.2500,
+			Longitude: 106.8456,
+			Speed:     30,
+			Timestamp: entered.Add(10 * time.Minute),
+		})
+		require.NoError(t, err)
+
+		exits, err := manager.GetGeofenceEvents(ctx, company.ID, map[string]interface{}{"event_type": "exit", "vehicle_id": vehicle.ID})
+		require.NoError(t, err)
+		require.Len(t, exits, 1)
+		assert.Equal(t, 600, exits[0].Duration)
+	})
 }
 
 func TestService_GetLocationHistory(t *testing.T) {
@@ -0,0 +1,723 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// Trip detection sources
+const (
+	TripDetectionManual = "manual" // started and ended by the driver app
+	TripDetectionAuto   = "auto"   // opened and closed from ignition and motion
+)
+
+// TripDetectionSettings tunes automatic trip detection
+type TripDetectionSettings struct {
+	MovingSpeed float64       // km/h; slower fixes with the ignition on are idling
+	IdleTimeout time.Duration // idling this long ends a trip
+	MaxGap      time.Duration // no fix for this long ends a trip
+	MinDistance float64       // km; shorter completed trips are discarded as noise
+}
+
+// DefaultTripDetectionSettings returns the settings used until
+// SetTripDetectionSettings is called
+func DefaultTripDetectionSettings() TripDetectionSettings {
+	return TripDetectionSettings{
+		MovingSpeed: 5,
+		IdleTimeout: 10 * time.Minute,
+		MaxGap:      15 * time.Minute,
+		MinDistance: 0.2,
+	}
+}
+
+// tripFixUpdateSize is the number of GPS tracks attached to a trip per UPDATE
+const tripFixUpdateSize = 1000
+
+// tripFixColumns are the GPS track columns trip detection reads
+var tripFixColumns = []string{
+	"id", "vehicle_id", "driver_id", "trip_id", "latitude", "longitude",
+	"accuracy", "speed", "ignition_on", "fuel_level", "odometer", "timestamp",
+}
+
+// SetTripDetectionSettings sets how trips are detected; zero fields keep
+// their current value
+func (s *Service) SetTripDetectionSettings(settings TripDetectionSettings) {
+	if settings.MovingSpeed > 0 {
+		s.tripSettings.MovingSpeed = settings.MovingSpeed
+	}
+	if settings.IdleTimeout > 0 {
+		s.tripSettings.IdleTimeout = settings.IdleTimeout
+	}
+	if settings.MaxGap > 0 {
+		s.tripSettings.MaxGap = settings.MaxGap
+	}
+	if settings.MinDistance > 0 {
+		s.tripSettings.MinDistance = settings.MinDistance
+	}
+}
+
+// lockVehicleTrips serializes trip detection per vehicle, since the fixes of
+// one vehicle are processed concurrently. It returns the unlock function.
+func (s *Service) lockVehicleTrips(vehicleID string) func() {
+	lock, _ := s.tripLocks.LoadOrStore(vehicleID, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// detectTrip applies a vehicle's newest fix to its trips: the fix is attached
+// to a running driver-started trip, extends or closes a detected trip, or
+// opens a new one when the vehicle starts moving
+func (s *Service) detectTrip(fix *models.GPSTrack, companyID string) {
+	unlock := s.lockVehicleTrips(fix.VehicleID)
+	defer unlock()
+
+	settings := s.tripSettings
+
+	var trip models.Trip
+	err := s.db.Where("vehicle_id = ? AND status = ?", fix.VehicleID, "active").Order("start_time DESC").First(&trip).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		fmt.Printf("Failed to find active trip of vehicle %s: %v\n", fix.VehicleID, err)
+		return
+	}
+	found := err == nil
+
+	// Trips started by the driver are kept as they are
+	if found && trip.Detection != TripDetectionAuto {
+		s.attachFixToTrip(fix, &trip)
+		return
+	}
+
+	if found {
+		var prev models.GPSTrack
+		err := s.db.Select(tripFixColumns).
+			Where("vehicle_id = ? AND timestamp < ?", fix.VehicleID, fix.Timestamp).
+			Order("timestamp DESC").First(&prev).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			fmt.Printf("Failed to find previous fix of vehicle %s: %v\n", fix.VehicleID, err)
+			return
+		}
+
+		switch {
+		case err != nil || fix.Timestamp.Sub(prev.Timestamp) > settings.MaxGap:
+			// The vehicle went silent; the trip ended with its last fix
+			s.closeDetectedTrip(&trip, nil)
+
+		case fix.IsIgnitionReportedOff():
+			// Devices without an ignition input rely on the idle timeout
+			s.attachFixToTrip(fix, &trip)
+			s.closeDetectedTrip(&trip, fix)
+			return
+
+		case isMovingFix(fix, settings):
+			s.extendDetectedTrip(&trip, &prev, fix)
+			return
+
+		default:
+			lastMoving, err := s.lastMovingFix(&trip)
+			if err != nil {
+				fmt.Printf("Failed to find last moving fix of trip %s: %v\n", trip.ID, err)
+				return
+			}
+			if lastMoving != nil && fix.Timestamp.Sub(lastMoving.Timestamp) > settings.IdleTimeout {
+				// Parked with the engine running: the trip ended when it stopped
+				s.closeDetectedTrip(&trip, lastMoving)
+				return
+			}
+			s.extendDetectedTrip(&trip, &prev, fix)
+			return
+		}
+	}
+
+	if !isMovingFix(fix, settings) {
+		return
+	}
+
+	trip = models.Trip{
+		CompanyID:      companyID,
+		VehicleID:      fix.VehicleID,
+		DriverID:       fix.DriverID,
+		Status:         "active",
+		Detection:      TripDetectionAuto,
+		StartTime:      &fix.Timestamp,
+		StartLatitude:  fix.Latitude,
+		StartLongitude: fix.Longitude,
+		StartFuelLevel: fix.FuelLevel,
+		MaxSpeed:       fix.Speed,
+	}
+	if err := s.db.Omit("Company", "Vehicle", "Driver").Create(&trip).Error; err != nil {
+		fmt.Printf("Failed to open trip for vehicle %s: %v\n", fix.VehicleID, err)
+		return
+	}
+	s.attachFixToTrip(fix, &trip)
+	s.publishTripUpdate(&trip)
+}
+
+// attachFixToTrip records that a fix was taken during a trip
+func (s *Service) attachFixToTrip(fix *models.GPSTrack, trip *models.Trip) {
+	fix.TripID = &trip.ID
+	if err := s.db.Model(&models.GPSTrack{}).Where("id = ?", fix.ID).Update("trip_id", trip.ID).Error; err != nil {
+		fmt.Printf("Failed to attach GPS track %s to trip %s: %v\n", fix.ID, trip.ID, err)
+	}
+}
+
+// extendDetectedTrip attaches a fix to a running detected trip and updates
+// its running totals
+func (s *Service) extendDetectedTrip(trip *models.Trip, prev, fix *models.GPSTrack) {
+	s.attachFixToTrip(fix, trip)
+
+	if prev.TripID != nil && *prev.TripID == trip.ID {
+		trip.TotalDistance += fix.CalculateDistance(prev.Latitude, prev.Longitude)
+		if !prev.IsIgnitionReportedOff() && prev.Speed < s.tripSettings.MovingSpeed {
+			trip.IdleTime += int(fix.Timestamp.Sub(prev.Timestamp).Seconds())
+		}
+	}
+	if fix.Speed > trip.MaxSpeed {
+		trip.MaxSpeed = fix.Speed
+	}
+	trip.TotalDuration = int(fix.Timestamp.Sub(*trip.StartTime).Seconds())
+	if moving := trip.TotalDuration - trip.IdleTime; moving > 0 {
+		trip.AverageSpeed = trip.TotalDistance / (float64(moving) / 3600)
+	}
+	if trip.DriverID == nil {
+		trip.DriverID = fix.DriverID
+	}
+
+	if err := s.db.Model(trip).
+		Select("total_distance", "idle_time", "max_speed", "total_duration", "average_speed", "driver_id").
+		Updates(trip).Error; err != nil {
+		fmt.Printf("Failed to update trip %s: %v\n", trip.ID, err)
+		return
+	}
+	go func() {
+		if err := s.cache.InvalidateTripCache(ctx, trip.ID); err != nil {
+			fmt.Printf("Failed to invalidate trip cache %s: %v\n", trip.ID, err)
+		}
+	}()
+}
+
+// lastMovingFix returns the newest fix of a trip taken while moving
+func (s *Service) lastMovingFix(trip *models.Trip) (*models.GPSTrack, error) {
+	var fix models.GPSTrack
+	err := s.db.Select(tripFixColumns).
+		Where("trip_id = ? AND (ignition_on IS NULL OR ignition_on = ?) AND speed >= ?", trip.ID, true, s.tripSettings.MovingSpeed).
+		Order("timestamp DESC").First(&fix).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fix, nil
+}
+
+// closeDetectedTrip completes a detected trip at its end fix, or at its last
+// attached fix when end is nil. Fixes after the end are detached, the totals
+// are recomputed from the remaining fixes, and trips too short to be real
+// driving are discarded.
+func (s *Service) closeDetectedTrip(trip *models.Trip, end *models.GPSTrack) {
+	if end != nil {
+		if err := s.db.Model(&models.GPSTrack{}).
+			Where("trip_id = ? AND timestamp > ?", trip.ID, end.Timestamp).
+			Update("trip_id", nil).Error; err != nil {
+			fmt.Printf("Failed to detach GPS tracks from trip %s: %v\n", trip.ID, err)
+			return
+		}
+	}
+
+	var fixes []models.GPSTrack
+	if err := s.db.Select(tripFixColumns).Where("trip_id = ?", trip.ID).Order("timestamp ASC").Find(&fixes).Error; err != nil {
+		fmt.Printf("Failed to load GPS tracks of trip %s: %v\n", trip.ID, err)
+		return
+	}
+
+	stats := computeTripStats(fixes, s.tripSettings)
+	s.useMatchedDistance(fixes, &stats)
+	if len(fixes) == 0 || stats.Distance < s.tripSettings.MinDistance {
+		if err := s.deleteDetectedTrips([]string{trip.ID}); err != nil {
+			fmt.Printf("Failed to discard trip %s: %v\n", trip.ID, err)
+		}
+		return
+	}
+
+	applyTripStats(trip, fixes, stats)
+	trip.Status = "completed"
+	if err := s.countTripEvents(trip); err != nil {
+		fmt.Printf("Failed to count events of trip %s: %v\n", trip.ID, err)
+	}
+	if err := s.db.Omit("Company", "Vehicle", "Driver").Save(trip).Error; err != nil {
+		fmt.Printf("Failed to complete trip %s: %v\n", trip.ID, err)
+		return
+	}
+	s.publishTripUpdate(trip)
+}
+
+// closeDetectedTripsOf completes the running detected trip of a vehicle, if any
+func (s *Service) closeDetectedTripsOf(vehicleID string) error {
+	unlock := s.lockVehicleTrips(vehicleID)
+	defer unlock()
+
+	var trips []models.Trip
+	if err := s.db.Where("vehicle_id = ? AND status = ? AND detection = ?", vehicleID, "active", TripDetectionAuto).Find(&trips).Error; err != nil {
+		return err
+	}
+	for i := range trips {
+		s.closeDetectedTrip(&trips[i], nil)
+	}
+	return nil
+}
+
+// CloseStaleTrips completes detected trips of vehicles that stopped sending
+// fixes, which would otherwise stay open until the vehicle reports again. It
+// returns the number of trips closed.
+func (s *Service) CloseStaleTrips(ctx context.Context) (int, error) {
+	var trips []models.Trip
+	if err := s.db.WithContext(ctx).
+		Joins("JOIN vehicles ON vehicles.id = trips.vehicle_id").
+		Where("trips.status = ? AND trips.detection = ?", "active", TripDetectionAuto).
+		Where("vehicles.last_updated_at IS NULL OR vehicles.last_updated_at < ?", time.Now().Add(-s.tripSettings.MaxGap)).
+		Find(&trips).Error; err != nil {
+		return 0, fmt.Errorf("failed to find stale trips: %w", err)
+	}
+
+	for i := range trips {
+		unlock := s.lockVehicleTrips(trips[i].VehicleID)
+		s.closeDetectedTrip(&trips[i], nil)
+		unlock()
+	}
+	return len(trips), nil
+}
+
+// redetectTrips re-segments a vehicle's detected trips around a time range
+// that received late fixes. Trips may be extended, split, merged, created or
+// discarded; fixes of driver-started trips are left alone. It returns the IDs
+// of the detected trips that now cover the range.
+func (s *Service) redetectTrips(vehicle *models.Vehicle, from, to time.Time) ([]string, error) {
+	unlock := s.lockVehicleTrips(vehicle.ID)
+	defer unlock()
+
+	settings := s.tripSettings
+	windowStart := from.Add(-settings.MaxGap)
+	windowEnd := to.Add(settings.MaxGap)
+
+	// Widen the window to whole trips so none is cut in two
+	var existing []models.Trip
+	if err := s.db.Where("vehicle_id = ? AND detection = ? AND status IN ? AND start_time <= ? AND (end_time IS NULL OR end_time >= ?)",
+		vehicle.ID, TripDetectionAuto, []string{"active", "completed"}, windowEnd, windowStart).
+		Order("start_time ASC").Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to load detected trips: %w", err)
+	}
+	for _, trip := range existing {
+		if trip.StartTime.Before(windowStart) {
+			windowStart = *trip.StartTime
+		}
+		if trip.EndTime == nil {
+			windowEnd = time.Now()
+		} else if trip.EndTime.After(windowEnd) {
+			windowEnd = *trip.EndTime
+		}
+	}
+
+	var manualIDs []string
+	if err := s.db.Model(&models.Trip{}).
+		Where("vehicle_id = ? AND detection <> ? AND start_time <= ? AND (end_time IS NULL OR end_time >= ?)",
+			vehicle.ID, TripDetectionAuto, windowEnd, windowStart).
+		Pluck("id", &manualIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load trips: %w", err)
+	}
+
+	query := s.db.Select(tripFixColumns).
+		Where("vehicle_id = ? AND timestamp BETWEEN ? AND ?", vehicle.ID, windowStart, windowEnd)
+	if len(manualIDs) > 0 {
+		query = query.Where("(trip_id IS NULL OR trip_id NOT IN ?)", manualIDs)
+	}
+	var fixes []models.GPSTrack
+	if err := query.Order("timestamp ASC").Find(&fixes).Error; err != nil {
+		return nil, fmt.Errorf("failed to load GPS tracks: %w", err)
+	}
+
+	// A trip still running at the window's end stays open only if nothing
+	// newer has been recorded
+	var newer int64
+	if err := s.db.Model(&models.GPSTrack{}).
+		Where("vehicle_id = ? AND timestamp > ?", vehicle.ID, windowEnd).
+		Limit(1).Count(&newer).Error; err != nil {
+		return nil, fmt.Errorf("failed to check newer GPS tracks: %w", err)
+	}
+
+	var trips []models.Trip
+	var segments []tripSegment
+	for _, segment := range segmentTrips(fixes, settings) {
+		segmentFixes := fixes[segment.start : segment.end+1]
+		stats := computeTripStats(segmentFixes, settings)
+		s.useMatchedDistance(segmentFixes, &stats)
+		open := !segment.closed && newer == 0
+		if !open && stats.Distance < settings.MinDistance {
+			continue
+		}
+
+		trip := models.Trip{CompanyID: vehicle.CompanyID, VehicleID: vehicle.ID, Detection: TripDetectionAuto, Status: "completed"}
+		applyTripStats(&trip, segmentFixes, stats)
+		if open {
+			trip.Status = "active"
+			trip.EndTime = nil
+		}
+		trips = append(trips, trip)
+		segments = append(segments, segment)
+	}
+
+	// Keep the IDs of existing trips that still describe the same driving
+	matchDetectedTrips(trips, existing)
+	var stale []string
+	kept := make(map[string]bool, len(trips))
+	for _, trip := range trips {
+		kept[trip.ID] = true
+	}
+	for _, trip := range existing {
+		if !kept[trip.ID] {
+			stale = append(stale, trip.ID)
+		}
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if len(stale) > 0 {
+			if err := tx.Model(&models.GPSTrack{}).Where("trip_id IN ?", stale).Update("trip_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", stale).Delete(&models.Trip{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for i := range trips {
+			trip := &trips[i]
+			if err := s.countTripEventsWith(tx, trip); err != nil {
+				return err
+			}
+			if err := tx.Omit("Company", "Vehicle", "Driver").Save(trip).Error; err != nil {
+				return err
+			}
+
+			segmentFixes := fixes[segments[i].start : segments[i].end+1]
+			ids := make([]string, len(segmentFixes))
+			for j, fix := range segmentFixes {
+				ids[j] = fix.ID
+			}
+			for start := 0; start < len(ids); start += tripFixUpdateSize {
+				end := start + tripFixUpdateSize
+				if end > len(ids) {
+					end = len(ids)
+				}
+				if err := tx.Model(&models.GPSTrack{}).Where("id IN ?", ids[start:end]).Update("trip_id", trip.ID).Error; err != nil {
+					return err
+				}
+			}
+			// Fixes of the window no longer part of this trip
+			if err := tx.Model(&models.GPSTrack{}).
+				Where("trip_id = ? AND (timestamp < ? OR timestamp > ?)", trip.ID, segmentFixes[0].Timestamp, segmentFixes[len(segmentFixes)-1].Timestamp).
+				Update("trip_id", nil).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save detected trips: %w", err)
+	}
+
+	ids := make([]string, 0, len(trips))
+	for i := range trips {
+		s.publishTripUpdate(&trips[i])
+		if !trips[i].StartTime.After(to) && (trips[i].EndTime == nil || !trips[i].EndTime.Before(from)) {
+			ids = append(ids, trips[i].ID)
+		}
+	}
+	for _, id := range stale {
+		go func(id string) {
+			if err := s.cache.InvalidateTripCache(ctx, id); err != nil {
+				fmt.Printf("Failed to invalidate trip cache %s: %v\n", id, err)
+			}
+		}(id)
+	}
+	return ids, nil
+}
+
+// deleteDetectedTrips discards detected trips and detaches their fixes
+func (s *Service) deleteDetectedTrips(ids []string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.GPSTrack{}).Where("trip_id IN ?", ids).Update("trip_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ? AND detection = ?", ids, TripDetectionAuto).Delete(&models.Trip{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for _, id := range ids {
+			if err := s.cache.InvalidateTripCache(ctx, id); err != nil {
+				fmt.Printf("Failed to invalidate trip cache %s: %v\n", id, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// countTripEvents sets a trip's violation counters from the driver events
+// raised for its vehicle during the trip
+func (s *Service) countTripEvents(trip *models.Trip) error {
+	return s.countTripEventsWith(s.db, trip)
+}
+
+// countTripEventsWith is countTripEvents within a transaction
+func (s *Service) countTripEventsWith(db *gorm.DB, trip *models.Trip) error {
+	query := db.Model(&models.DriverEvent{}).
+		Select("event_type, COUNT(*) AS count").
+		Where("vehicle_id = ? AND created_at >= ?", trip.VehicleID, trip.StartTime)
+	if trip.EndTime != nil {
+		query = query.Where("created_at <= ?", trip.EndTime)
+	}
+
+	var counts []struct {
+		EventType string
+		Count     int
+	}
+	if err := query.Group("event_type").Scan(&counts).Error; err != nil {
+		return err
+	}
+
+	trip.Violations, trip.HarshBraking, trip.RapidAcceleration, trip.SpeedingEvents = 0, 0, 0, 0
+	for _, c := range counts {
+		trip.Violations += c.Count
+		switch c.EventType {
+		case models.BehaviorHarshBraking:
+			trip.HarshBraking = c.Count
+		case models.BehaviorRapidAcceleration:
+			trip.RapidAcceleration = c.Count
+		case models.BehaviorSpeedViolation:
+			trip.SpeedingEvents = c.Count
+		}
+	}
+	return nil
+}
+
+// publishTripUpdate refreshes the cached trip and broadcasts it
+func (s *Service) publishTripUpdate(trip *models.Trip) {
+	snapshot := *trip
+	go func() {
+		if err := s.cache.InvalidateTripCache(ctx, snapshot.ID); err != nil {
+			fmt.Printf("Failed to invalidate trip cache %s: %v\n", snapshot.ID, err)
+		}
+		if err := s.analyticsBroadcaster.BroadcastTripUpdate(ctx, &snapshot); err != nil {
+			fmt.Printf("Failed to broadcast trip update %s: %v\n", snapshot.ID, err)
+		}
+	}()
+}
+
+// isMovingFix reports whether a fix shows the vehicle driving
+func isMovingFix(fix *models.GPSTrack, settings TripDetectionSettings) bool {
+	return fix.IsIgnitionOn() && fix.Speed >= settings.MovingSpeed
+}
+
+// tripSegment is a run of fixes forming one trip, as inclusive indexes into
+// a vehicle's track
+type tripSegment struct {
+	start, end int
+	closed     bool // ended by the ignition, idling or a gap; otherwise still running
+}
+
+// segmentTrips splits a vehicle's track, oldest first, into trips. A trip
+// starts at the first moving fix and ends at a fix reporting the ignition
+// off, at the last moving fix before idling longer than the idle timeout, or
+// at the last fix before a gap longer than the maximum gap. Stops of devices
+// that do not report ignition only end trips through the idle timeout.
+func segmentTrips(fixes []models.GPSTrack, settings TripDetectionSettings) []tripSegment {
+	var segments []tripSegment
+	var current tripSegment
+	inTrip := false
+	lastMoving := 0
+
+	for i := range fixes {
+		fix := &fixes[i]
+		moving := isMovingFix(fix, settings)
+
+		if inTrip {
+			switch {
+			case fix.Timestamp.Sub(fixes[i-1].Timestamp) > settings.MaxGap:
+				current.closed = true
+				segments = append(segments, current)
+				inTrip = false
+
+			case fix.IsIgnitionReportedOff():
+				current.end = i
+				current.closed = true
+				segments = append(segments, current)
+				inTrip = false
+				continue
+
+			case moving:
+				current.end = i
+				lastMoving = i
+				continue
+
+			case fix.Timestamp.Sub(fixes[lastMoving].Timestamp) > settings.IdleTimeout:
+				current.end = lastMoving
+				current.closed = true
+				segments = append(segments, current)
+				inTrip = false
+				continue
+
+			default:
+				current.end = i
+				continue
+			}
+		}
+
+		if moving {
+			current = tripSegment{start: i, end: i}
+			lastMoving = i
+			inTrip = true
+		}
+	}
+
+	if inTrip {
+		segments = append(segments, current)
+	}
+	return segments
+}
+
+// tripStats are the totals of a trip computed from its fixes
+type tripStats struct {
+	Distance     float64 // km
+	Duration     time.Duration
+	IdleTime     time.Duration
+	MaxSpeed     float64 // km/h
+	AverageSpeed float64 // km/h while not idling
+	FuelConsumed float64 // liters, refuels excluded
+}
+
+// computeTripStats computes trip totals from its fixes, oldest first. Time
+// across gaps longer than the maximum gap is not counted as idling.
+func computeTripStats(fixes []models.GPSTrack, settings TripDetectionSettings) tripStats {
+	var stats tripStats
+	if len(fixes) == 0 {
+		return stats
+	}
+
+	stats.MaxSpeed = fixes[0].Speed
+	for i := 1; i < len(fixes); i++ {
+		prev, fix := &fixes[i-1], &fixes[i]
+		stats.Distance += fix.CalculateDistance(prev.Latitude, prev.Longitude)
+		if fix.Speed > stats.MaxSpeed {
+			stats.MaxSpeed = fix.Speed
+		}
+
+		dt := fix.Timestamp.Sub(prev.Timestamp)
+		if dt <= settings.MaxGap && !prev.IsIgnitionReportedOff() && prev.Speed < settings.MovingSpeed {
+			stats.IdleTime += dt
+		}
+		if prev.FuelLevel > 0 && fix.FuelLevel > 0 && fix.FuelLevel < prev.FuelLevel {
+			stats.FuelConsumed += prev.FuelLevel - fix.FuelLevel
+		}
+	}
+
+	stats.Duration = fixes[len(fixes)-1].Timestamp.Sub(fixes[0].Timestamp)
+	if moving := stats.Duration - stats.IdleTime; moving > 0 {
+		stats.AverageSpeed = stats.Distance / moving.Hours()
+	}
+	return stats
+}
+
+// applyTripStats sets a detected trip's endpoints and totals from its fixes
+func applyTripStats(trip *models.Trip, fixes []models.GPSTrack, stats tripStats) {
+	first, last := &fixes[0], &fixes[len(fixes)-1]
+
+	startTime, endTime := first.Timestamp, last.Timestamp
+	trip.StartTime = &startTime
+	trip.StartLatitude = first.Latitude
+	trip.StartLongitude = first.Longitude
+	trip.EndTime = &endTime
+	trip.EndLatitude = last.Latitude
+	trip.EndLongitude = last.Longitude
+
+	trip.TotalDistance = stats.Distance
+	trip.TotalDuration = int(stats.Duration.Seconds())
+	trip.IdleTime = int(stats.IdleTime.Seconds())
+	trip.MaxSpeed = stats.MaxSpeed
+	trip.AverageSpeed = stats.AverageSpeed
+
+	trip.StartFuelLevel = first.FuelLevel
+	trip.EndFuelLevel = last.FuelLevel
+	trip.FuelConsumed = stats.FuelConsumed
+	trip.FuelEfficiency = 0
+	if stats.FuelConsumed > 0 {
+		trip.FuelEfficiency = stats.Distance / stats.FuelConsumed
+	}
+
+	trip.DriverID = nil
+	for i := range fixes {
+		if fixes[i].DriverID != nil {
+			trip.DriverID = fixes[i].DriverID
+			break
+		}
+	}
+}
+
+// matchDetectedTrips gives re-detected trips the IDs of the existing trips
+// they overlap most, so trips keep their identity when late fixes only
+// extend them. Both slices must be ordered by start time.
+func matchDetectedTrips(trips, existing []models.Trip) {
+	used := make(map[int]bool, len(existing))
+	for i := range trips {
+		best, bestOverlap := -1, time.Duration(-1)
+		for j := range existing {
+			if used[j] {
+				continue
+			}
+			overlap := tripOverlap(&trips[i], &existing[j])
+			if overlap >= 0 && overlap > bestOverlap {
+				best, bestOverlap = j, overlap
+			}
+		}
+		if best >= 0 {
+			used[best] = true
+			trips[i].ID = existing[best].ID
+			trips[i].CreatedAt = existing[best].CreatedAt
+			trips[i].Name = existing[best].Name
+			trips[i].Purpose = existing[best].Purpose
+			trips[i].Notes = existing[best].Notes
+		}
+	}
+}
+
+// tripOverlap returns how long two trips overlap, or -1 when they do not.
+// Running trips extend to now.
+func tripOverlap(a, b *models.Trip) time.Duration {
+	end := func(t *models.Trip) time.Time {
+		if t.EndTime == nil {
+			return time.Now()
+		}
+		return *t.EndTime
+	}
+
+	start := *a.StartTime
+	if b.StartTime.After(start) {
+		start = *b.StartTime
+	}
+	finish := end(a)
+	if end(b).Before(finish) {
+		finish = end(b)
+	}
+	if finish.Before(start) {
+		return -1
+	}
+	return finish.Sub(start)
+}
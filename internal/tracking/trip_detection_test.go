@@ -0,0 +1,208 @@
+package tracking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
+)
+
+// tripFix is one fix of a test track: seconds after the start, speed in
+// km/h and ignition state
+type tripFix struct {
+	at       int
+	speed    float64
+	ignition bool
+}
+
+// tripTrack builds a track heading north, moving about 0.01° of latitude
+// (1.1 km) between consecutive moving fixes
+func tripTrack(start time.Time, fixes ...tripFix) []models.GPSTrack {
+	tracks := make([]models.GPSTrack, len(fixes))
+	lat := -6.2
+	for i, f := range fixes {
+		if f.speed > 0 && i > 0 {
+			lat += 0.01
+		}
+		ignition := f.ignition
+		tracks[i] = models.GPSTrack{
+			VehicleID:  "vehicle-1",
+			Latitude:   lat,
+			Longitude:  106.8,
+			Speed:      f.speed,
+			IgnitionOn: &ignition,
+			Timestamp:  start.Add(time.Duration(f.at) * time.Second),
+		}
+	}
+	return tracks
+}
+
+func TestSegmentTrips_IgnitionOffEndsTrip(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	track := tripTrack(start,
+		tripFix{0, 0, false},
+		tripFix{60, 0, true}, // engine started, not moving yet
+		tripFix{120, 40, true},
+		tripFix{180, 50, true},
+		tripFix{240, 0, false},
+		tripFix{300, 0, false},
+	)
+
+	segments := segmentTrips(track, DefaultTripDetectionSettings())
+
+	require.Len(t, segments, 1)
+	assert.Equal(t, tripSegment{start: 2, end: 4, closed: true}, segments[0])
+}
+
+func TestSegmentTrips_IdleTimeoutEndsTripAtLastMovingFix(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	track := tripTrack(start,
+		tripFix{0, 40, true},
+		tripFix{60, 30, true},
+		tripFix{300, 0, true}, // idling at a traffic light is part of the trip
+		tripFix{400, 20, true},
+		tripFix{700, 0, true},
+		tripFix{1100, 0, true}, // parked with the engine running
+		tripFix{1100 + 60, 0, true},
+	)
+
+	segments := segmentTrips(track, DefaultTripDetectionSettings())
+
+	require.Len(t, segments, 1)
+	assert.Equal(t, tripSegment{start: 0, end: 3, closed: true}, segments[0])
+}
+
+func TestSegmentTrips_UnreportedIgnition(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	track := tripTrack(start,
+		tripFix{0, 40, true},
+		tripFix{60, 30, true},
+		tripFix{300, 0, true}, // stopped at a traffic light
+		tripFix{400, 20, true},
+		tripFix{700, 0, true},
+		tripFix{1100, 0, true}, // parked
+	)
+	for i := range track {
+		track[i].IgnitionOn = nil // a phone does not report ignition
+	}
+
+	segments := segmentTrips(track, DefaultTripDetectionSettings())
+
+	require.Len(t, segments, 1)
+	assert.Equal(t, tripSegment{start: 0, end: 3, closed: true}, segments[0])
+
+	stats := computeTripStats(track[:4], DefaultTripDetectionSettings())
+	assert.Equal(t, 100*time.Second, stats.IdleTime, "stops count as idling")
+}
+
+func TestSegmentTrips_GapEndsTrip(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	track := tripTrack(start,
+		tripFix{0, 40, true},
+		tripFix{60, 50, true},
+		tripFix{60 + 20*60, 45, true}, // signal lost in a tunnel for twenty minutes
+		tripFix{60 + 21*60, 45, true},
+	)
+
+	segments := segmentTrips(track, DefaultTripDetectionSettings())
+
+	require.Len(t, segments, 2)
+	assert.Equal(t, tripSegment{start: 0, end: 1, closed: true}, segments[0])
+	assert.Equal(t, tripSegment{start: 2, end: 3, closed: false}, segments[1], "still running")
+}
+
+func TestSegmentTrips_NoMovement(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	track := tripTrack(start,
+		tripFix{0, 0, true},
+		tripFix{60, 3, true}, // GPS drift below the moving speed
+		tripFix{120, 60, false},
+	)
+
+	assert.Empty(t, segmentTrips(track, DefaultTripDetectionSettings()))
+}
+
+func TestComputeTripStats(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	track := tripTrack(start,
+		tripFix{0, 40, true},
+		tripFix{60, 60, true},
+		tripFix{120, 0, true},
+		tripFix{240, 50, true},
+		tripFix{300, 0, false},
+	)
+	for i, level := range []float64{50, 49.5, 49, 60, 59.5} { // refuelled while idling
+		track[i].FuelLevel = level
+	}
+
+	stats := computeTripStats(track, DefaultTripDetectionSettings())
+
+	assert.InDelta(t, 2.22, stats.Distance, 0.01)
+	assert.Equal(t, 5*time.Minute, stats.Duration)
+	assert.Equal(t, 2*time.Minute, stats.IdleTime)
+	assert.Equal(t, 60.0, stats.MaxSpeed)
+	assert.InDelta(t, 2.22/(3.0/60), stats.AverageSpeed, 0.5)
+	assert.InDelta(t, 1.5, stats.FuelConsumed, 0.001)
+}
+
+func TestComputeTripStats_GapIsNotIdleTime(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	track := tripTrack(start,
+		tripFix{0, 0, true},
+		tripFix{60 * 60, 0, true},
+	)
+
+	stats := computeTripStats(track, DefaultTripDetectionSettings())
+
+	assert.Zero(t, stats.IdleTime)
+	assert.Equal(t, time.Hour, stats.Duration)
+}
+
+func TestApplyTripStats(t *testing.T) {
+	start := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	driverID := "driver-1"
+	track := tripTrack(start,
+		tripFix{0, 40, true},
+		tripFix{60, 50, true},
+		tripFix{120, 0, false},
+	)
+	track[1].DriverID = &driverID
+	track[0].FuelLevel = 40
+	track[1].FuelLevel = 39.5
+	track[2].FuelLevel = 39
+
+	trip := models.Trip{}
+	applyTripStats(&trip, track, computeTripStats(track, DefaultTripDetectionSettings()))
+
+	assert.Equal(t, start, *trip.StartTime)
+	assert.Equal(t, start.Add(2*time.Minute), *trip.EndTime)
+	assert.Equal(t, track[2].Latitude, trip.EndLatitude)
+	assert.Equal(t, &driverID, trip.DriverID, "first identified driver")
+	assert.Equal(t, 1.0, trip.FuelConsumed)
+	assert.InDelta(t, trip.TotalDistance, trip.FuelEfficiency, 0.001)
+}
+
+func TestMatchDetectedTrips(t *testing.T) {
+	at := func(minutes int) *time.Time {
+		t := time.Date(2025, 3, 1, 8, minutes, 0, 0, time.UTC)
+		return &t
+	}
+	existing := []models.Trip{
+		{ID: "morning", StartTime: at(0), EndTime: at(20), Name: "Depot run"},
+		{ID: "later", StartTime: at(30), EndTime: at(40)},
+	}
+
+	// Late fixes bridged the two trips, then a new trip was found afterwards
+	trips := []models.Trip{
+		{StartTime: at(0), EndTime: at(40)},
+		{StartTime: at(50), EndTime: at(55)},
+	}
+	matchDetectedTrips(trips, existing)
+
+	assert.Equal(t, "morning", trips[0].ID, "largest overlap keeps its ID")
+	assert.Equal(t, "Depot run", trips[0].Name)
+	assert.Empty(t, trips[1].ID, "new trip")
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/tobangado69/fleettracker-pro/backend/internal/common/middleware"
 	customValidators "github.com/tobangado69/fleettracker-pro/backend/internal/common/validators"
+	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 )
 
 // Handler handles vehicle HTTP requests
@@ -67,6 +68,7 @@ type Meta struct {
 // @Success 201 {object} SuccessResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 402 {object} ErrorResponse "Vehicle limit of the subscription plan reached"
 // @Failure 500 {object} ErrorResponse
 // @Router /api/v1/vehicles [post]
 // @Security BearerAuth
@@ -127,7 +129,11 @@ func (h *Handler) CreateVehicle(c *gin.Context) {
 	// Create vehicle
 	vehicle, err := h.service.CreateVehicle(companyID.(string), req)
 	if err != nil {
-		middleware.AbortWithBadRequest(c, err.Error())
+		if appErr, ok := err.(*apperrors.AppError); ok {
+			middleware.AbortWithError(c, appErr)
+		} else {
+			middleware.AbortWithBadRequest(c, err.Error())
+		}
 		return
 	}
 
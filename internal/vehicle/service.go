@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/tobangado69/fleettracker-pro/backend/internal/common/entitlement"
 	apperrors "github.com/tobangado69/fleettracker-pro/backend/pkg/errors"
 	"github.com/tobangado69/fleettracker-pro/backend/pkg/models"
 	"gorm.io/gorm"
@@ -17,9 +18,10 @@ import (
 
 // Service handles vehicle operations
 type Service struct {
-	db    *gorm.DB
-	redis *redis.Client
-	cache *CacheService
+	db           *gorm.DB
+	redis        *redis.Client
+	cache        *CacheService
+	entitlements *entitlement.Service
 }
 
 // CacheService provides caching functionality for vehicle operations
@@ -158,9 +160,10 @@ func (cs *CacheService) generateVehicleListCacheKey(companyID string, filters Ve
 // NewService creates a new vehicle service
 func NewService(db *gorm.DB, redis *redis.Client) *Service {
 	return &Service{
-		db:    db,
-		redis: redis,
-		cache: NewCacheService(redis),
+		db:           db,
+		redis:        redis,
+		cache:        NewCacheService(redis),
+		entitlements: entitlement.NewService(db),
 	}
 }
 
@@ -326,13 +329,19 @@ func (s *Service) CreateVehicle(companyID string, req CreateVehicleRequest) (*mo
 		vehicle.NextServiceDate = &nextInspection
 	}
 
-	// Save to database
-	if err := s.db.Create(vehicle).Error; err != nil {
-		return nil, apperrors.NewInternalError("Failed to create vehicle").WithInternal(err)
+	// Save to database within the vehicle limit of the subscription plan
+	ctx := context.Background()
+	err := s.entitlements.WithinVehicleLimit(ctx, companyID, func(tx *gorm.DB) error {
+		if err := tx.Create(vehicle).Error; err != nil {
+			return apperrors.NewInternalError("Failed to create vehicle").WithInternal(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Invalidate vehicle list cache after creating new vehicle
-	ctx := context.Background()
 	if err := s.cache.InvalidateVehicleListCache(ctx, companyID); err != nil {
 		// Log cache invalidation error but don't fail the request
 		fmt.Printf("Failed to invalidate vehicle list cache %s: %v\n", companyID, err)
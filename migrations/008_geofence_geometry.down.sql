@@ -0,0 +1,10 @@
+-- Rollback geofence geometry migration
+
+DROP INDEX IF EXISTS idx_geofences_company_category;
+
+-- Restore purpose into type for circle geofences
+UPDATE geofences
+SET type = category
+WHERE type = 'circle' AND category IN ('pickup', 'delivery', 'restricted');
+
+ALTER TABLE geofences DROP COLUMN IF EXISTS category;
@@ -0,0 +1,37 @@
+-- Geofence geometry: separate shape from purpose and store GeoJSON polygons
+--
+-- geofences.type now always holds the shape (circle, polygon, rectangle) and
+-- the new category column holds the purpose (zone, pickup, delivery, restricted).
+-- polygon_data holds GeoJSON-style Polygon/MultiPolygon coordinates or a bbox.
+
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS type VARCHAR(50);
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS category VARCHAR(50) DEFAULT 'zone';
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS polygon_data JSONB;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS speed_limit DECIMAL(5,2);
+
+-- Carry over the legacy shape column from the initial schema
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'geofences' AND column_name = 'geofence_type'
+    ) THEN
+        UPDATE geofences SET type = geofence_type WHERE type IS NULL;
+        ALTER TABLE geofences ALTER COLUMN geofence_type DROP NOT NULL;
+    END IF;
+END $$;
+
+-- Geofences created through /tracking/geofences stored their purpose in type.
+-- Those were always circles, so move the purpose to category.
+UPDATE geofences
+SET category = type, type = 'circle'
+WHERE type IN ('zone', 'pickup', 'delivery', 'restricted');
+
+UPDATE geofences SET type = 'circle' WHERE type IS NULL;
+ALTER TABLE geofences ALTER COLUMN type SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_geofences_company_category ON geofences(company_id, category);
+
+COMMENT ON COLUMN geofences.type IS 'Geofence shape: circle, polygon, rectangle';
+COMMENT ON COLUMN geofences.category IS 'Geofence purpose: zone, pickup, delivery, restricted';
+COMMENT ON COLUMN geofences.polygon_data IS 'GeoJSON Polygon/MultiPolygon ([lng, lat] positions, closed rings, holes after the outer ring) or {"bbox": [minLng, minLat, maxLng, maxLat]}';
@@ -0,0 +1,17 @@
+-- Rollback payment gateway migration
+
+DROP TABLE IF EXISTS payment_webhook_events;
+
+DROP INDEX IF EXISTS idx_payments_pending_expiry;
+DROP INDEX IF EXISTS idx_payments_reference_number;
+DROP INDEX IF EXISTS idx_payments_external_id;
+
+-- status, amounts, references and completed_at are kept: the payment model
+-- relies on them independently of the gateway integration
+ALTER TABLE payments DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS initiated_at;
+ALTER TABLE payments DROP COLUMN IF EXISTS callback_data;
+ALTER TABLE payments DROP COLUMN IF EXISTS gateway_response;
+ALTER TABLE payments DROP COLUMN IF EXISTS e_wallet_data;
+ALTER TABLE payments DROP COLUMN IF EXISTS bank_transfer;
+ALTER TABLE payments DROP COLUMN IF EXISTS qris_data;
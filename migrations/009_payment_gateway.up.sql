@@ -0,0 +1,40 @@
+-- Payment gateway integration: gateway columns on payments and webhook deduplication
+--
+-- payments gains the columns used by QRIS, virtual account and e-wallet
+-- charges; payment_webhook_events stores every processed gateway notification
+-- so retried deliveries are applied only once.
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS status VARCHAR(20) DEFAULT 'pending';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS payment_type VARCHAR(50);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS tax_amount DECIMAL(12,2) DEFAULT 0;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS total_amount DECIMAL(12,2);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS qris_data JSONB;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS bank_transfer JSONB;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS e_wallet_data JSONB;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS reference_number VARCHAR(100);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS gateway_response JSONB;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS callback_data JSONB;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS initiated_at TIMESTAMPTZ;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_payments_external_id ON payments(external_id) WHERE external_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payments_reference_number ON payments(reference_number) WHERE reference_number IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payments_pending_expiry ON payments(expires_at) WHERE status = 'pending';
+
+CREATE TABLE IF NOT EXISTS payment_webhook_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    payment_id UUID REFERENCES payments(id) ON DELETE SET NULL,
+    status VARCHAR(20),
+    result VARCHAR(50),
+    payload JSONB,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_webhook_events_provider_event ON payment_webhook_events(provider, event_id);
+CREATE INDEX IF NOT EXISTS idx_payment_webhook_events_payment ON payment_webhook_events(payment_id);
+
+COMMENT ON TABLE payment_webhook_events IS 'Processed payment gateway notifications, unique per provider and event ID';
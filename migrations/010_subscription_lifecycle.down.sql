@@ -0,0 +1,9 @@
+-- Rollback subscription lifecycle migration
+
+DROP INDEX IF EXISTS idx_subscriptions_renewal;
+
+-- Only the lifecycle fields are removed; the remaining columns back the
+-- subscription model independently of this feature
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS credit_balance;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS cancelled_at;
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS cancel_at_period_end;
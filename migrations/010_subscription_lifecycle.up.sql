@@ -0,0 +1,27 @@
+-- Subscription lifecycle: plan changes, cancellation at period end and renewal
+--
+-- Adds the columns of the subscription model that the initial schema lacks
+-- plus the cancellation and proration credit fields.
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS plan_type VARCHAR(50);
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS max_users INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS tax_rate DECIMAL(5,2) DEFAULT 11.00;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS is_active BOOLEAN DEFAULT TRUE;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS next_billing_date TIMESTAMPTZ;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS renewal_period INTEGER DEFAULT 1;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS cancel_at_period_end BOOLEAN DEFAULT FALSE;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ;
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS credit_balance DECIMAL(12,2) DEFAULT 0;
+
+-- The model stores the billing cycle in plan_type and the tier in plan_name
+UPDATE subscriptions SET plan_type = billing_cycle WHERE plan_type IS NULL;
+ALTER TABLE subscriptions ALTER COLUMN plan_tier DROP NOT NULL;
+ALTER TABLE subscriptions ALTER COLUMN billing_cycle DROP NOT NULL;
+
+-- Periods carry a time of day so renewals line up with the original start
+ALTER TABLE subscriptions ALTER COLUMN start_date TYPE TIMESTAMPTZ;
+ALTER TABLE subscriptions ALTER COLUMN end_date TYPE TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_subscriptions_renewal ON subscriptions(end_date)
+    WHERE is_active = TRUE AND status = 'active' AND deleted_at IS NULL;
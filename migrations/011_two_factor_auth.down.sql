@@ -0,0 +1,8 @@
+-- Rollback two-factor authentication migration
+
+ALTER TABLE companies DROP COLUMN IF EXISTS require_two_factor;
+
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_recovery_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_secret;
+ALTER TABLE users DROP COLUMN IF EXISTS two_factor_enabled;
@@ -0,0 +1,11 @@
+-- Two-factor authentication
+--
+-- TOTP enrolment and recovery codes on users, and the company-wide policy
+-- that makes two-factor authentication mandatory for every user.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_enabled BOOLEAN DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_secret VARCHAR(255);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_recovery_codes TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS two_factor_last_step BIGINT DEFAULT 0;
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS require_two_factor BOOLEAN DEFAULT FALSE;
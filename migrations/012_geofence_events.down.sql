@@ -0,0 +1,4 @@
+-- Rollback geofence events migration
+
+DROP TABLE IF EXISTS geofence_violations;
+DROP TABLE IF EXISTS geofence_events;
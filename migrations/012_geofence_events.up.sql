@@ -0,0 +1,57 @@
+-- Geofence events and violations recorded by the geofence monitor
+--
+-- Every accepted GPS fix is checked against the company's geofences. Entry,
+-- exit, dwell and speed events go to geofence_events; unauthorized entry/exit,
+-- speed and time violations go to geofence_violations.
+
+CREATE TABLE IF NOT EXISTS geofence_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    geofence_id UUID NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    driver_id UUID REFERENCES drivers(id) ON DELETE SET NULL,
+    company_id UUID NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    event_type VARCHAR(20) NOT NULL,  -- entry, exit, dwell, speed_violation
+    latitude DECIMAL(10,8) NOT NULL,
+    longitude DECIMAL(11,8) NOT NULL,
+    speed DECIMAL(6,2) DEFAULT 0,  -- km/h
+    heading DECIMAL(5,2) DEFAULT 0,  -- degrees
+    accuracy DECIMAL(8,2) DEFAULT 0,  -- meters
+    event_time TIMESTAMPTZ NOT NULL,
+    duration INTEGER DEFAULT 0,  -- seconds inside the geofence, for dwell and exit events
+    alert_sent BOOLEAN DEFAULT FALSE,
+    alert_type VARCHAR(30),
+    alert_message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_geofence_events_company_time ON geofence_events(company_id, event_time DESC);
+CREATE INDEX IF NOT EXISTS idx_geofence_events_vehicle_time ON geofence_events(vehicle_id, event_time DESC);
+CREATE INDEX IF NOT EXISTS idx_geofence_events_geofence_time ON geofence_events(geofence_id, event_time DESC);
+
+CREATE TABLE IF NOT EXISTS geofence_violations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    geofence_id UUID NOT NULL REFERENCES geofences(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    driver_id UUID REFERENCES drivers(id) ON DELETE SET NULL,
+    company_id UUID NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    violation_type VARCHAR(30) NOT NULL,  -- unauthorized_entry, unauthorized_exit, speed_violation, time_violation
+    severity VARCHAR(20) NOT NULL,  -- low, medium, high, critical
+    description TEXT,
+    latitude DECIMAL(10,8) NOT NULL,
+    longitude DECIMAL(11,8) NOT NULL,
+    speed DECIMAL(6,2) DEFAULT 0,
+    violation_time TIMESTAMPTZ NOT NULL,
+    is_resolved BOOLEAN DEFAULT FALSE,
+    resolved_at TIMESTAMPTZ,
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolution TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_geofence_violations_vehicle_time ON geofence_violations(vehicle_id, violation_time DESC);
+CREATE INDEX IF NOT EXISTS idx_geofence_violations_company_type ON geofence_violations(company_id, violation_type, violation_time DESC);
+CREATE INDEX IF NOT EXISTS idx_geofence_violations_unresolved ON geofence_violations(company_id, violation_time DESC) WHERE is_resolved = FALSE;
+
+COMMENT ON TABLE geofence_events IS 'Geofence entry, exit, dwell and speed events detected from GPS fixes';
+COMMENT ON TABLE geofence_violations IS 'Geofence violations detected from GPS fixes, resolvable by fleet managers';
@@ -0,0 +1,17 @@
+-- Rollback geofence unification migration
+--
+-- Legacy manager columns dropped by the up migration are not restored.
+
+DROP INDEX IF EXISTS idx_geofences_company_priority;
+
+ALTER TABLE geofences DROP COLUMN IF EXISTS created_by;
+ALTER TABLE geofences DROP COLUMN IF EXISTS restricted_drivers;
+ALTER TABLE geofences DROP COLUMN IF EXISTS restricted_vehicles;
+ALTER TABLE geofences DROP COLUMN IF EXISTS allowed_drivers;
+ALTER TABLE geofences DROP COLUMN IF EXISTS allowed_vehicles;
+ALTER TABLE geofences DROP COLUMN IF EXISTS time_restrictions;
+ALTER TABLE geofences DROP COLUMN IF EXISTS alert_on_speed;
+ALTER TABLE geofences DROP COLUMN IF EXISTS dwell_time;
+ALTER TABLE geofences DROP COLUMN IF EXISTS alert_on_dwell;
+ALTER TABLE geofences DROP COLUMN IF EXISTS color;
+ALTER TABLE geofences DROP COLUMN IF EXISTS priority;
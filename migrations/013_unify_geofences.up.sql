@@ -0,0 +1,83 @@
+-- Unify geofences: one table for /tracking/geofences and /geofences
+--
+-- The geofence manager (violations, analytics, alerts) and the tracking
+-- endpoints now share the geofences table. This adds the manager's settings
+-- (priority, dwell, speed, time windows, vehicle/driver allow and deny lists)
+-- and converts rows written in the manager's old column layout.
+
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS priority INTEGER DEFAULT 5;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS color VARCHAR(7) DEFAULT '#FF0000';
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS alert_on_dwell BOOLEAN DEFAULT FALSE;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS dwell_time INTEGER DEFAULT 0;  -- minutes
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS alert_on_speed BOOLEAN DEFAULT FALSE;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS time_restrictions JSONB;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS allowed_vehicles JSONB;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS allowed_drivers JSONB;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS restricted_vehicles JSONB;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS restricted_drivers JSONB;
+ALTER TABLE geofences ADD COLUMN IF NOT EXISTS created_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Geofences with a speed limit were meant to be enforced
+UPDATE geofences SET alert_on_speed = TRUE WHERE speed_limit > 0;
+
+-- Carry over the manager's legacy columns where a database has them
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'geofences' AND column_name = 'center_lat'
+    ) THEN
+        UPDATE geofences
+        SET center_latitude = center_lat, center_longitude = center_lng
+        WHERE center_latitude IS NULL;
+        ALTER TABLE geofences DROP COLUMN center_lat;
+        ALTER TABLE geofences DROP COLUMN IF EXISTS center_lng;
+    END IF;
+
+    -- coordinates held [{"latitude": .., "longitude": ..}] vertices; polygons
+    -- become a closed GeoJSON ring and rectangles a bbox of the two corners
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'geofences' AND column_name = 'coordinates'
+    ) THEN
+        UPDATE geofences g
+        SET polygon_data = jsonb_build_object(
+            'type', 'Polygon',
+            'coordinates', jsonb_build_array(
+                (SELECT jsonb_agg(jsonb_build_array((c->>'longitude')::numeric, (c->>'latitude')::numeric) ORDER BY n)
+                 FROM jsonb_array_elements(g.coordinates) WITH ORDINALITY AS v(c, n))
+                || jsonb_build_array(jsonb_build_array((g.coordinates->0->>'longitude')::numeric, (g.coordinates->0->>'latitude')::numeric))
+            )
+        )
+        WHERE g.type = 'polygon' AND g.polygon_data IS NULL
+          AND jsonb_typeof(g.coordinates) = 'array' AND jsonb_array_length(g.coordinates) >= 3;
+
+        UPDATE geofences g
+        SET polygon_data = jsonb_build_object('bbox', jsonb_build_array(
+            LEAST((g.coordinates->0->>'longitude')::numeric, (g.coordinates->1->>'longitude')::numeric),
+            LEAST((g.coordinates->0->>'latitude')::numeric, (g.coordinates->1->>'latitude')::numeric),
+            GREATEST((g.coordinates->0->>'longitude')::numeric, (g.coordinates->1->>'longitude')::numeric),
+            GREATEST((g.coordinates->0->>'latitude')::numeric, (g.coordinates->1->>'latitude')::numeric)
+        ))
+        WHERE g.type = 'rectangle' AND g.polygon_data IS NULL
+          AND jsonb_typeof(g.coordinates) = 'array' AND jsonb_array_length(g.coordinates) = 2;
+
+        ALTER TABLE geofences DROP COLUMN coordinates;
+    END IF;
+
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'geofences' AND column_name = 'alert_on_entry'
+    ) THEN
+        UPDATE geofences SET alert_on_enter = alert_on_entry WHERE alert_on_entry IS NOT NULL;
+        ALTER TABLE geofences DROP COLUMN alert_on_entry;
+    END IF;
+END $$;
+
+UPDATE geofences SET priority = 5 WHERE priority IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_geofences_company_priority ON geofences(company_id, priority DESC, created_at DESC) WHERE is_active = TRUE;
+
+COMMENT ON COLUMN geofences.priority IS 'Importance from 1 to 10; drives violation severity';
+COMMENT ON COLUMN geofences.time_restrictions IS 'Weekly windows [{"day_of_week", "start_time", "end_time", "is_active"}] during which vehicles may be inside';
+COMMENT ON COLUMN geofences.allowed_vehicles IS 'Vehicle IDs allowed inside; empty allows every vehicle not in restricted_vehicles';
@@ -0,0 +1,12 @@
+-- Rollback vehicle connectivity migration
+--
+-- last_latitude, last_longitude and last_updated_at are kept: GPS processing
+-- writes them independently of the watchdog.
+
+DROP INDEX IF EXISTS idx_vehicles_company_offline;
+
+ALTER TABLE companies DROP COLUMN IF EXISTS offline_threshold_minutes;
+
+ALTER TABLE vehicles DROP COLUMN IF EXISTS offline_reason;
+ALTER TABLE vehicles DROP COLUMN IF EXISTS offline_since;
+ALTER TABLE vehicles DROP COLUMN IF EXISTS connection_status;
@@ -0,0 +1,22 @@
+-- Vehicle connectivity watchdog
+--
+-- The vehicle_offline_check job marks vehicles offline when no GPS fix has
+-- arrived for the company's threshold (offline_threshold_minutes, or the
+-- server's VEHICLE_OFFLINE_THRESHOLD when 0). offline_reason tells a parked
+-- vehicle (ignition_off) from one that went dark while running (signal_lost).
+
+-- Written by every accepted GPS fix
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS last_latitude DECIMAL(10,8);
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS last_longitude DECIMAL(11,8);
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS last_updated_at TIMESTAMPTZ;
+
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS connection_status VARCHAR(20) DEFAULT 'online';  -- online, offline
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS offline_since TIMESTAMPTZ;
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS offline_reason VARCHAR(20);  -- ignition_off, signal_lost
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS offline_threshold_minutes INTEGER DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_vehicles_company_offline ON vehicles(company_id, offline_since) WHERE connection_status = 'offline';
+
+COMMENT ON COLUMN vehicles.offline_since IS 'Time of the last GPS fix before the vehicle went offline';
+COMMENT ON COLUMN companies.offline_threshold_minutes IS 'Minutes without a GPS fix before a vehicle is offline; 0 uses the server default';
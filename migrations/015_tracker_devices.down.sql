@@ -0,0 +1,3 @@
+-- Rollback tracker devices migration
+
+DROP TABLE IF EXISTS devices;
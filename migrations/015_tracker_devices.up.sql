@@ -0,0 +1,27 @@
+-- Hardwired GPS trackers
+--
+-- Trackers connect to the device gateway over TCP and identify themselves
+-- by IMEI. The gateway resolves the IMEI to the vehicle the device is
+-- installed in and feeds its fixes into the GPS tracking pipeline.
+
+CREATE TABLE IF NOT EXISTS devices (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    vehicle_id UUID REFERENCES vehicles(id) ON DELETE SET NULL,
+    imei VARCHAR(20) NOT NULL,
+    protocol VARCHAR(20) NOT NULL DEFAULT 'teltonika',  -- teltonika
+    name VARCHAR(100),
+    is_active BOOLEAN DEFAULT TRUE,
+    last_seen_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_devices_imei ON devices(imei);
+CREATE INDEX IF NOT EXISTS idx_devices_company_id ON devices(company_id);
+CREATE INDEX IF NOT EXISTS idx_devices_vehicle_id ON devices(vehicle_id) WHERE vehicle_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_devices_deleted_at ON devices(deleted_at);
+
+COMMENT ON TABLE devices IS 'Hardwired GPS trackers, identified by IMEI, reporting through the device gateway';
+COMMENT ON COLUMN devices.vehicle_id IS 'Vehicle the tracker is installed in; fixes from unbound devices are refused';
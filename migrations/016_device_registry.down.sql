@@ -0,0 +1,21 @@
+-- Rollback device registry migration
+
+DROP INDEX IF EXISTS idx_gps_tracks_device_id;
+ALTER TABLE gps_tracks DROP COLUMN IF EXISTS device_id;
+
+DROP TABLE IF EXISTS device_bindings;
+
+DROP INDEX IF EXISTS idx_devices_api_key_hash;
+ALTER TABLE devices DROP COLUMN IF EXISTS api_key_prefix;
+ALTER TABLE devices DROP COLUMN IF EXISTS api_key_hash;
+ALTER TABLE devices DROP COLUMN IF EXISTS sim_number;
+ALTER TABLE devices DROP COLUMN IF EXISTS firmware_version;
+ALTER TABLE devices DROP COLUMN IF EXISTS device_type;
+ALTER TABLE devices DROP COLUMN IF EXISTS serial_number;
+
+-- Devices without an IMEI cannot be represented before this migration
+DELETE FROM devices WHERE imei IS NULL;
+UPDATE devices SET protocol = 'teltonika' WHERE protocol IS NULL;
+ALTER TABLE devices ALTER COLUMN protocol SET DEFAULT 'teltonika';
+ALTER TABLE devices ALTER COLUMN protocol SET NOT NULL;
+ALTER TABLE devices ALTER COLUMN imei SET NOT NULL;
@@ -0,0 +1,50 @@
+-- Device registry and device-to-vehicle binding history
+--
+-- Devices become the trusted GPS source: hardwired trackers and phones get
+-- their own API key and their fixes are attributed to the vehicle they are
+-- bound to, with or without an assigned driver. device_bindings keeps the
+-- history of which device was installed in which vehicle.
+
+ALTER TABLE devices ALTER COLUMN imei DROP NOT NULL;
+ALTER TABLE devices ALTER COLUMN protocol DROP NOT NULL;
+ALTER TABLE devices ALTER COLUMN protocol DROP DEFAULT;
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS serial_number VARCHAR(50);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS device_type VARCHAR(20) NOT NULL DEFAULT 'tracker';  -- tracker, mobile
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS firmware_version VARCHAR(50);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS sim_number VARCHAR(20);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS api_key_hash VARCHAR(64);
+ALTER TABLE devices ADD COLUMN IF NOT EXISTS api_key_prefix VARCHAR(12);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_devices_api_key_hash ON devices(api_key_hash);
+
+CREATE TABLE IF NOT EXISTS device_bindings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    vehicle_id UUID NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    bound_at TIMESTAMPTZ NOT NULL,
+    unbound_at TIMESTAMPTZ,
+    bound_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    unbound_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_bindings_company_id ON device_bindings(company_id);
+CREATE INDEX IF NOT EXISTS idx_device_bindings_device_id ON device_bindings(device_id, bound_at DESC);
+CREATE INDEX IF NOT EXISTS idx_device_bindings_vehicle_id ON device_bindings(vehicle_id, bound_at DESC);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_device_bindings_current ON device_bindings(device_id) WHERE unbound_at IS NULL;
+
+-- Devices bound before this migration start their history now
+INSERT INTO device_bindings (company_id, device_id, vehicle_id, bound_at)
+SELECT d.company_id, d.id, d.vehicle_id, d.updated_at
+FROM devices d
+WHERE d.vehicle_id IS NOT NULL AND d.deleted_at IS NULL
+  AND NOT EXISTS (SELECT 1 FROM device_bindings b WHERE b.device_id = d.id AND b.unbound_at IS NULL);
+
+-- Fixes remember the device that reported them
+ALTER TABLE gps_tracks ADD COLUMN IF NOT EXISTS device_id UUID REFERENCES devices(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_gps_tracks_device_id ON gps_tracks(device_id) WHERE device_id IS NOT NULL;
+
+COMMENT ON TABLE device_bindings IS 'History of device installations; the row with unbound_at NULL is the current binding';
+COMMENT ON COLUMN devices.api_key_hash IS 'SHA-256 of the device API key sent in the X-Device-Key header';
+COMMENT ON COLUMN gps_tracks.device_id IS 'Device that reported the fix, NULL for fixes posted by users';
@@ -0,0 +1,6 @@
+-- Rollback driver behavior rules migration
+
+DROP INDEX IF EXISTS idx_driver_events_vehicle_type_created;
+
+DROP TABLE IF EXISTS driver_behavior_rules;
+DROP TABLE IF EXISTS driver_behavior_rule_sets;
@@ -0,0 +1,47 @@
+-- Configurable driver behavior rules
+--
+-- Each company can define one rule set per vehicle type plus a fallback set
+-- (vehicle_type NULL) for the remaining types. Event types a set does not
+-- configure use the server defaults (DEFAULT_SPEED_LIMIT,
+-- HARSH_BRAKING_THRESHOLD, RAPID_ACCELERATION_THRESHOLD).
+
+CREATE TABLE IF NOT EXISTS driver_behavior_rule_sets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    vehicle_type VARCHAR(50),
+    name VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_behavior_rule_sets_company_id ON driver_behavior_rule_sets(company_id);
+CREATE INDEX IF NOT EXISTS idx_driver_behavior_rule_sets_deleted_at ON driver_behavior_rule_sets(deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_driver_behavior_rule_sets_scope
+    ON driver_behavior_rule_sets(company_id, COALESCE(vehicle_type, '')) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS driver_behavior_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    rule_set_id UUID NOT NULL REFERENCES driver_behavior_rule_sets(id) ON DELETE CASCADE,
+    event_type VARCHAR(50) NOT NULL,
+    is_enabled BOOLEAN DEFAULT true,
+    threshold DECIMAL(6,2) NOT NULL,
+    min_duration_seconds INTEGER DEFAULT 0,
+    cooldown_seconds INTEGER DEFAULT 0,
+    medium_threshold DECIMAL(6,2) DEFAULT 0,
+    high_threshold DECIMAL(6,2) DEFAULT 0,
+    critical_threshold DECIMAL(6,2) DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE (rule_set_id, event_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_behavior_rules_rule_set_id ON driver_behavior_rules(rule_set_id);
+
+-- Cooldowns look up the latest event of a type per vehicle
+CREATE INDEX IF NOT EXISTS idx_driver_events_vehicle_type_created ON driver_events(vehicle_id, event_type, created_at DESC);
+
+COMMENT ON COLUMN driver_behavior_rule_sets.vehicle_type IS 'Vehicle type the rules apply to; NULL for all types without their own set';
+COMMENT ON COLUMN driver_behavior_rules.threshold IS 'km/h for speed_violation, m/s² for harsh_braking and rapid_acceleration';
+COMMENT ON COLUMN driver_behavior_rules.min_duration_seconds IS 'How long the threshold must be exceeded before an event is raised';
+COMMENT ON COLUMN driver_behavior_rules.cooldown_seconds IS 'No event of the same type is raised for the vehicle during this period';
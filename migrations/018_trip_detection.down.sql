@@ -0,0 +1,7 @@
+-- Rollback automatic trip detection migration
+--
+-- Detected trips are kept and become indistinguishable from manual ones.
+
+DROP INDEX IF EXISTS idx_trips_vehicle_detection_status;
+
+ALTER TABLE trips DROP COLUMN IF EXISTS detection;
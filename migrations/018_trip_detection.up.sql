@@ -0,0 +1,13 @@
+-- Automatic trip detection
+--
+-- Trips are opened and closed from ignition, motion and gaps between GPS
+-- fixes (detection = 'auto'), next to the trips drivers start and end in the
+-- app (detection = 'manual'). Late fixes re-segment the detected trips around
+-- them. TRIP_IDLE_TIMEOUT and TRIP_MAX_GPS_GAP tune where trips end.
+
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS detection VARCHAR(20) DEFAULT 'manual';  -- manual, auto
+
+-- Running detected trips are looked up on every GPS fix
+CREATE INDEX IF NOT EXISTS idx_trips_vehicle_detection_status ON trips(vehicle_id, detection, status);
+
+COMMENT ON COLUMN trips.detection IS 'manual when started by the driver, auto when detected from GPS fixes';
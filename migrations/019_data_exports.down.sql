@@ -0,0 +1,3 @@
+-- Rollback data exports migration
+
+DROP TABLE IF EXISTS data_exports;
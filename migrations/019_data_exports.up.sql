@@ -0,0 +1,34 @@
+-- Data exports kept in blob storage
+--
+-- Exports are generated in the background by the data_export job, which
+-- streams the rows into a file in blob storage (local disk or an
+-- S3-compatible object store). Users download the file through a signed,
+-- expiring link until the export expires and the file is deleted.
+
+CREATE TABLE IF NOT EXISTS data_exports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    export_type VARCHAR(50) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    filters JSONB,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- pending, running, completed, failed, expired
+    storage_key VARCHAR(500),
+    file_name VARCHAR(255),
+    content_type VARCHAR(100),
+    record_count BIGINT NOT NULL DEFAULT 0,
+    file_size BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_company_created ON data_exports(company_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_data_exports_expires_at ON data_exports(expires_at) WHERE status = 'completed';
+
+COMMENT ON TABLE data_exports IS 'Background data exports and the blob storage files they produced';
+COMMENT ON COLUMN data_exports.storage_key IS 'Key of the export file in blob storage';
+COMMENT ON COLUMN data_exports.expires_at IS 'The file is deleted from blob storage after this time';
@@ -0,0 +1,4 @@
+-- Rollback reports migration
+
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS report_subscriptions;
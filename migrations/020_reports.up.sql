@@ -0,0 +1,62 @@
+-- Reports and report subscriptions
+--
+-- Reports are generated in the background by the report_generation job and
+-- rendered with the export renderers (CSV, JSON, JSON Lines, XLSX, PDF) into
+-- a file in blob storage, which is kept so reports can be listed, downloaded
+-- and re-run later. Report subscriptions generate a report on a recurring
+-- schedule and send it to their recipients.
+
+CREATE TABLE IF NOT EXISTS report_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    report_type VARCHAR(50) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    schedule VARCHAR(100) NOT NULL,
+    timezone VARCHAR(50) NOT NULL DEFAULT 'Asia/Jakarta',
+    period VARCHAR(10) NOT NULL DEFAULT 'week',  -- day, week, month
+    recipients JSONB,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    last_run_at TIMESTAMPTZ,
+    last_report_id UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_subscriptions_company ON report_subscriptions(company_id);
+
+CREATE TABLE IF NOT EXISTS reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    subscription_id UUID REFERENCES report_subscriptions(id) ON DELETE SET NULL,
+    rerun_of UUID REFERENCES reports(id) ON DELETE SET NULL,
+    report_type VARCHAR(50) NOT NULL,
+    format VARCHAR(10) NOT NULL,
+    title VARCHAR(255),
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',  -- pending, running, completed, failed
+    storage_key VARCHAR(500),
+    file_name VARCHAR(255),
+    content_type VARCHAR(100),
+    row_count BIGINT NOT NULL DEFAULT 0,
+    file_size BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_company_created ON reports(company_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_reports_requested_by ON reports(requested_by);
+CREATE INDEX IF NOT EXISTS idx_reports_subscription ON reports(subscription_id) WHERE subscription_id IS NOT NULL;
+
+COMMENT ON TABLE reports IS 'Generated reports and the blob storage files they were rendered to';
+COMMENT ON COLUMN reports.period_end IS 'Exclusive end of the period the report covers';
+COMMENT ON COLUMN reports.storage_key IS 'Key of the report file in blob storage';
+COMMENT ON TABLE report_subscriptions IS 'Reports generated on a recurring schedule and sent to their recipients';
+COMMENT ON COLUMN report_subscriptions.schedule IS 'Cron expression or @-descriptor evaluated in the subscription timezone';
+COMMENT ON COLUMN report_subscriptions.recipients IS 'Email addresses the reports are sent to; the owner when empty';
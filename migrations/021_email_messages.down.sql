@@ -0,0 +1,3 @@
+-- Rollback email messages migration
+
+DROP TABLE IF EXISTS email_messages;
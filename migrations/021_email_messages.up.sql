@@ -0,0 +1,39 @@
+-- Email messages
+--
+-- Every email the system sends is recorded here before it is queued. The
+-- email_notification job delivers it and records the outcome; messages the
+-- mail server rejects permanently are not retried. Bodies of sensitive
+-- messages (temporary passwords, reset links) are erased once delivered or
+-- abandoned.
+
+CREATE TABLE IF NOT EXISTS email_messages (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID REFERENCES companies(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    recipient VARCHAR(255) NOT NULL,
+    sender VARCHAR(255) NOT NULL,
+    subject VARCHAR(500) NOT NULL,
+    template VARCHAR(50),
+    language VARCHAR(10),
+    text_body TEXT,
+    html_body TEXT,
+    attachments JSONB,
+    sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',  -- queued, sent, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    message_id VARCHAR(255),
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_messages_recipient ON email_messages(recipient, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_email_messages_user ON email_messages(user_id) WHERE user_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_email_messages_company ON email_messages(company_id) WHERE company_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_email_messages_status ON email_messages(status) WHERE status <> 'sent';
+
+COMMENT ON TABLE email_messages IS 'Every email sent by the system and the outcome of its delivery';
+COMMENT ON COLUMN email_messages.attachments IS 'Attached files, kept until the message is delivered';
+COMMENT ON COLUMN email_messages.sensitive IS 'Bodies are erased once the message is sent or abandoned';
+COMMENT ON COLUMN email_messages.message_id IS 'Message-ID header, for matching bounces and replies';
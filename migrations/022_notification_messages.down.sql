@@ -0,0 +1,3 @@
+-- Rollback notification messages migration
+
+DROP TABLE IF EXISTS notification_messages;
@@ -0,0 +1,40 @@
+-- Notification messages
+--
+-- Every WhatsApp and SMS message the system sends is recorded here before it
+-- is queued. The notification_delivery job hands it to the provider and
+-- records the provider's message ID; the provider's status webhooks then
+-- move it on to delivered, read or failed.
+
+CREATE TABLE IF NOT EXISTS notification_messages (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    company_id UUID REFERENCES companies(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    driver_id UUID REFERENCES drivers(id) ON DELETE SET NULL,
+    channel VARCHAR(20) NOT NULL,                   -- whatsapp, sms
+    recipient VARCHAR(20) NOT NULL,                 -- +62 phone number
+    template VARCHAR(50),
+    language VARCHAR(10),
+    params JSONB,
+    body TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued',   -- queued, sent, delivered, read, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    provider_message_id VARCHAR(255),
+    sent_at TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ,
+    read_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_messages_recipient ON notification_messages(recipient, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notification_messages_company ON notification_messages(company_id, created_at DESC) WHERE company_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_notification_messages_user ON notification_messages(user_id) WHERE user_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_notification_messages_driver ON notification_messages(driver_id) WHERE driver_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notification_messages_provider ON notification_messages(channel, provider_message_id) WHERE provider_message_id IS NOT NULL AND provider_message_id <> '';
+
+COMMENT ON TABLE notification_messages IS 'Every WhatsApp and SMS message sent by the system and its delivery status';
+COMMENT ON COLUMN notification_messages.params IS 'Parameters of the approved WhatsApp template';
+COMMENT ON COLUMN notification_messages.body IS 'Text of the message as sent by SMS';
+COMMENT ON COLUMN notification_messages.provider_message_id IS 'ID assigned by WhatsApp or the SMS provider, for matching status webhooks';
@@ -0,0 +1,8 @@
+-- Rollback unknown ignition state migration
+--
+-- Fixes without an ignition state are kept as NULL.
+
+COMMENT ON COLUMN vehicles.offline_reason IS NULL;
+COMMENT ON COLUMN gps_tracks.ignition_on IS NULL;
+
+ALTER TABLE gps_tracks ALTER COLUMN ignition_on SET DEFAULT FALSE;
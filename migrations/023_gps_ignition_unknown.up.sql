@@ -0,0 +1,11 @@
+-- Unknown ignition state
+--
+-- Phones and other devices without an ignition input leave ignition_on NULL
+-- instead of having it inferred from speed. Offline vehicles whose last fix
+-- has no ignition state get offline_reason 'unknown'. Fixes stored before
+-- this migration keep their inferred values.
+
+ALTER TABLE gps_tracks ALTER COLUMN ignition_on DROP DEFAULT;
+
+COMMENT ON COLUMN gps_tracks.ignition_on IS 'Ignition reported by the device; NULL when the device does not report it';
+COMMENT ON COLUMN vehicles.offline_reason IS 'ignition_off, signal_lost, or unknown when the device does not report ignition';
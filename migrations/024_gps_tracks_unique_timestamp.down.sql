@@ -0,0 +1,4 @@
+-- migrate:no-transaction
+-- Rollback unique GPS fix per vehicle and timestamp
+
+DROP INDEX CONCURRENTLY IF EXISTS idx_gps_tracks_vehicle_timestamp;
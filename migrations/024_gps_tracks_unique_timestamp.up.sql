@@ -0,0 +1,15 @@
+-- migrate:no-transaction
+-- Unique GPS fix per vehicle and timestamp
+--
+-- A vehicle cannot report two fixes at the same instant, so retried or
+-- concurrent uploads of the same fixes are stored once. The index is built
+-- CONCURRENTLY so GPS ingestion keeps running during the build.
+--
+-- The build fails while duplicate fixes exist. Review and remove them first
+-- with `make gps-dedupe` (see migrations/README.md); this migration does not
+-- delete tracking data. A failed build leaves an invalid index behind, which
+-- is dropped first so the migration can simply be run again.
+
+DROP INDEX CONCURRENTLY IF EXISTS idx_gps_tracks_vehicle_timestamp;
+
+CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS idx_gps_tracks_vehicle_timestamp ON gps_tracks(vehicle_id, timestamp);
@@ -148,6 +148,46 @@ func NewServiceUnavailableError(message string) *AppError {
 	}
 }
 
+// NewPaymentRequiredError creates a new payment required error, used when a
+// company has no usable subscription.
+func NewPaymentRequiredError(message string) *AppError {
+	if message == "" {
+		message = "An active subscription is required"
+	}
+	return &AppError{
+		Code:    "PAYMENT_REQUIRED",
+		Message: message,
+		Status:  http.StatusPaymentRequired,
+	}
+}
+
+// NewPlanLimitExceededError creates an error for a resource limit of the subscription plan.
+func NewPlanLimitExceededError(resource string, limit int, plan string) *AppError {
+	return &AppError{
+		Code:    "PLAN_LIMIT_EXCEEDED",
+		Message: fmt.Sprintf("The %s plan allows at most %d %s, upgrade your plan to add more", plan, limit, resource),
+		Status:  http.StatusPaymentRequired,
+		Details: map[string]interface{}{
+			"resource": resource,
+			"limit":    limit,
+			"plan":     plan,
+		},
+	}
+}
+
+// NewFeatureNotAvailableError creates an error for a feature the subscription plan does not include.
+func NewFeatureNotAvailableError(feature string, plan string) *AppError {
+	return &AppError{
+		Code:    "FEATURE_NOT_AVAILABLE",
+		Message: fmt.Sprintf("The %s feature is not included in the %s plan", feature, plan),
+		Status:  http.StatusForbidden,
+		Details: map[string]interface{}{
+			"feature": feature,
+			"plan":    plan,
+		},
+	}
+}
+
 // Predefined common errors
 var (
 	// ErrNotFound is a generic not found error
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Driver behavior event types detected from GPS tracks
+const (
+	BehaviorSpeedViolation    = "speed_violation"
+	BehaviorHarshBraking      = "harsh_braking"
+	BehaviorRapidAcceleration = "rapid_acceleration"
+)
+
+// DriverBehaviorRuleSet holds a company's driver behavior thresholds for one
+// vehicle type, or for all vehicle types without a set of their own
+type DriverBehaviorRuleSet struct {
+	ID          string  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CompanyID   string  `json:"company_id" gorm:"type:uuid;not null;index"`
+	VehicleType *string `json:"vehicle_type" gorm:"type:varchar(50)"` // nil applies to every vehicle type
+	Name        string  `json:"name" gorm:"type:varchar(100)"`
+
+	// Timestamps
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+
+	// Relationships
+	Rules []DriverBehaviorRule `json:"rules" gorm:"foreignKey:RuleSetID"`
+}
+
+// DriverBehaviorRule configures the detection of one behavior event type.
+// Speed values are in km/h, acceleration and braking in m/s².
+type DriverBehaviorRule struct {
+	ID        string `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RuleSetID string `json:"rule_set_id" gorm:"type:uuid;not null;index"`
+	EventType string `json:"event_type" gorm:"type:varchar(50);not null"` // speed_violation, harsh_braking, rapid_acceleration
+	IsEnabled bool   `json:"is_enabled"`
+
+	// Detection
+	Threshold          float64 `json:"threshold" gorm:"type:decimal(6,2);not null"`
+	MinDurationSeconds int     `json:"min_duration_seconds" gorm:"default:0"` // how long the threshold must be exceeded
+	CooldownSeconds    int     `json:"cooldown_seconds" gorm:"default:0"`     // quiet period after an event of this type
+
+	// Severity bands, events up to MediumThreshold are low; 0 skips a band
+	MediumThreshold   float64 `json:"medium_threshold" gorm:"type:decimal(6,2);default:0"`
+	HighThreshold     float64 `json:"high_threshold" gorm:"type:decimal(6,2);default:0"`
+	CriticalThreshold float64 `json:"critical_threshold" gorm:"type:decimal(6,2);default:0"`
+
+	// Timestamps
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Severity returns the severity of an event whose measured value is value.
+// Like the threshold, a band applies to values above it.
+func (r *DriverBehaviorRule) Severity(value float64) string {
+	switch {
+	case r.CriticalThreshold > 0 && value > r.CriticalThreshold:
+		return "critical"
+	case r.HighThreshold > 0 && value > r.HighThreshold:
+		return "high"
+	case r.MediumThreshold > 0 && value > r.MediumThreshold:
+		return "medium"
+	}
+	return "low"
+}
+
+// TableName specifies the table name for the DriverBehaviorRuleSet model
+func (DriverBehaviorRuleSet) TableName() string {
+	return "driver_behavior_rule_sets"
+}
+
+// TableName specifies the table name for the DriverBehaviorRule model
+func (DriverBehaviorRule) TableName() string {
+	return "driver_behavior_rules"
+}
@@ -35,6 +35,8 @@ type Company struct {
 	Status      string    `json:"status" gorm:"type:varchar(20);default:'active'"` // active, suspended, inactive
 	IsActive    bool      `json:"is_active" gorm:"default:true"`
 	Settings    JSON      `json:"settings" gorm:"type:jsonb"`                      // Company-specific settings
+	RequireTwoFactor bool `json:"require_two_factor" gorm:"default:false"`       // All users must enrol in 2FA
+	OfflineThresholdMinutes int `json:"offline_threshold_minutes" gorm:"default:0"` // Silence before a vehicle is offline, 0 uses the server default
 	
 	// Timestamps
 	CreatedAt   time.Time      `json:"created_at"`
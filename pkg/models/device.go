@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Device types
+const (
+	DeviceTypeTracker = "tracker" // hardwired GPS tracker
+	DeviceTypeMobile  = "mobile"  // phone running the driver app
+)
+
+// Tracker protocols spoken by the device gateway
+const (
+	DeviceProtocolTeltonika = "teltonika" // Teltonika Codec 8 and Codec 8 Extended
+)
+
+// Device represents a GPS source installed in a vehicle: a hardwired tracker
+// reporting over the device gateway or a phone posting fixes over HTTP
+type Device struct {
+	ID        string  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CompanyID string  `json:"company_id" gorm:"type:uuid;not null;index"`
+	VehicleID *string `json:"vehicle_id" gorm:"type:uuid;index"` // Vehicle the device is currently bound to
+
+	// Device Identification
+	IMEI            *string `json:"imei" gorm:"type:varchar(20);uniqueIndex"` // required for trackers
+	SerialNumber    string  `json:"serial_number" gorm:"type:varchar(50)"`
+	DeviceType      string  `json:"device_type" gorm:"type:varchar(20);not null;default:'tracker'"` // tracker, mobile
+	Protocol        string  `json:"protocol" gorm:"type:varchar(20)"`                               // teltonika, for trackers
+	Name            string  `json:"name" gorm:"type:varchar(100)"`
+	FirmwareVersion string  `json:"firmware_version" gorm:"type:varchar(50)"`
+	SIMNumber       string  `json:"sim_number" gorm:"type:varchar(20)"`
+
+	// Credentials for device-authenticated ingestion; only the hash is stored
+	APIKeyHash   *string `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	APIKeyPrefix string  `json:"api_key_prefix" gorm:"type:varchar(12)"` // identifies the key without revealing it
+
+	// Status
+	IsActive   bool       `json:"is_active" gorm:"default:true"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+
+	// Timestamps
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
+
+	// Relationships
+	Company Company  `json:"company,omitempty" gorm:"foreignKey:CompanyID"`
+	Vehicle *Vehicle `json:"vehicle,omitempty" gorm:"foreignKey:VehicleID"`
+}
+
+// DeviceBinding records a period during which a device was installed in a vehicle
+type DeviceBinding struct {
+	ID        string     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CompanyID string     `json:"company_id" gorm:"type:uuid;not null;index"`
+	DeviceID  string     `json:"device_id" gorm:"type:uuid;not null;index"`
+	VehicleID string     `json:"vehicle_id" gorm:"type:uuid;not null;index"`
+	BoundAt   time.Time  `json:"bound_at" gorm:"not null"`
+	UnboundAt *time.Time `json:"unbound_at"` // nil while the binding is current
+	BoundBy   *string    `json:"bound_by" gorm:"type:uuid"`
+	UnboundBy *string    `json:"unbound_by" gorm:"type:uuid"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	Vehicle *Vehicle `json:"vehicle,omitempty" gorm:"foreignKey:VehicleID"`
+}
+
+// TableName specifies the table name for the Device model
+func (Device) TableName() string {
+	return "devices"
+}
+
+// TableName specifies the table name for the DeviceBinding model
+func (DeviceBinding) TableName() string {
+	return "device_bindings"
+}
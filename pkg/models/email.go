@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// Email message statuses
+const (
+	EmailStatusQueued = "queued"
+	EmailStatusSent   = "sent"
+	EmailStatusFailed = "failed"
+)
+
+// EmailMessage records an email the system sends, from queueing to delivery
+type EmailMessage struct {
+	ID        string  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CompanyID *string `json:"company_id" gorm:"type:uuid;index"`
+	UserID    *string `json:"user_id" gorm:"type:uuid;index"` // user the message was sent for
+
+	// Message
+	Recipient   string            `json:"recipient" gorm:"type:varchar(255);not null;index"`
+	Sender      string            `json:"sender" gorm:"type:varchar(255);not null"`
+	Subject     string            `json:"subject" gorm:"type:varchar(500);not null"`
+	Template    string            `json:"template" gorm:"type:varchar(50)"` // empty for plain messages
+	Language    string            `json:"language" gorm:"type:varchar(10)"`
+	TextBody    string            `json:"-" gorm:"type:text"`
+	HTMLBody    string            `json:"-" gorm:"type:text"`
+	Attachments []EmailAttachment `json:"-" gorm:"type:jsonb;serializer:json"`
+	Sensitive   bool              `json:"sensitive" gorm:"default:false"` // bodies are erased once the message is settled
+
+	// Delivery
+	Status    string     `json:"status" gorm:"type:varchar(20);not null;default:'queued'"` // queued, sent, failed
+	Attempts  int        `json:"attempts" gorm:"default:0"`
+	LastError string     `json:"last_error,omitempty" gorm:"type:text"`
+	MessageID string     `json:"message_id" gorm:"type:varchar(255)"` // Message-ID header
+	SentAt    *time.Time `json:"sent_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// EmailAttachment is a file attached to an email message
+type EmailAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        []byte `json:"data"`
+}
+
+// TableName specifies the table name for the EmailMessage model
+func (EmailMessage) TableName() string {
+	return "email_messages"
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// Data export statuses
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+	ExportStatusExpired   = "expired"
+)
+
+// DataExport is a file of company data generated in the background and kept
+// in blob storage until it expires
+type DataExport struct {
+	ID          string  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CompanyID   string  `json:"company_id" gorm:"type:uuid;not null;index"`
+	RequestedBy *string `json:"requested_by" gorm:"type:uuid"` // nil for exports started by the system
+
+	// Request
+	ExportType string `json:"export_type" gorm:"type:varchar(50);not null"` // vehicles, drivers, trips, gps_tracks, reports
+	Format     string `json:"format" gorm:"type:varchar(10);not null"`
+	Filters    JSON   `json:"filters" gorm:"type:jsonb"`
+
+	// Result
+	Status      string `json:"status" gorm:"type:varchar(20);not null;default:'pending'"` // pending, running, completed, failed, expired
+	StorageKey  string `json:"-" gorm:"type:varchar(500)"`
+	FileName    string `json:"file_name" gorm:"type:varchar(255)"`
+	ContentType string `json:"content_type" gorm:"type:varchar(100)"`
+	RecordCount int64  `json:"record_count" gorm:"default:0"`
+	FileSize    int64  `json:"file_size" gorm:"default:0"` // bytes
+	Error       string `json:"error,omitempty" gorm:"type:text"`
+
+	// Timestamps
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"` // the file is deleted after this time
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the DataExport model
+func (DataExport) TableName() string {
+	return "data_exports"
+}
@@ -0,0 +1,284 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Geofence shapes stored in Geofence.Shape
+const (
+	GeofenceShapeCircle    = "circle"
+	GeofenceShapePolygon   = "polygon"
+	GeofenceShapeRectangle = "rectangle"
+)
+
+// Geofence purposes stored in Geofence.Category and sent as "type" in the API
+const (
+	GeofencePurposeZone       = "zone"
+	GeofencePurposePickup     = "pickup"
+	GeofencePurposeDelivery   = "delivery"
+	GeofencePurposeRestricted = "restricted"
+)
+
+// IsGeofenceShape reports whether s names a geofence shape
+func IsGeofenceShape(s string) bool {
+	switch s {
+	case GeofenceShapeCircle, GeofenceShapePolygon, GeofenceShapeRectangle:
+		return true
+	}
+	return false
+}
+
+// IsGeofencePurpose reports whether s names a geofence purpose
+func IsGeofencePurpose(s string) bool {
+	switch s {
+	case GeofencePurposeZone, GeofencePurposePickup, GeofencePurposeDelivery, GeofencePurposeRestricted:
+		return true
+	}
+	return false
+}
+
+// GeofenceGeometry is the parsed form of Geofence.PolygonData.
+//
+// PolygonData follows GeoJSON geometry conventions (RFC 7946): positions are
+// [longitude, latitude] pairs, every ring is closed (first position equals the
+// last) and the first ring of a polygon is its outer boundary while any
+// further rings are holes cut out of it.
+//
+//	{"type": "Polygon", "coordinates": [[[lng, lat], ...], [[lng, lat], ...]]}
+//	{"type": "MultiPolygon", "coordinates": [[[[lng, lat], ...]], ...]}
+//
+// Rectangle geofences may carry either of the above or just a bounding box:
+//
+//	{"bbox": [minLng, minLat, maxLng, maxLat]}
+type GeofenceGeometry struct {
+	Polygons []GeoPolygon `json:"polygons"`
+	BBox     *BoundingBox `json:"bbox,omitempty"`
+}
+
+// GeoPosition is a single [longitude, latitude] pair
+type GeoPosition [2]float64
+
+// Lng returns the longitude of the position
+func (p GeoPosition) Lng() float64 { return p[0] }
+
+// Lat returns the latitude of the position
+func (p GeoPosition) Lat() float64 { return p[1] }
+
+// GeoRing is a closed linear ring of positions
+type GeoRing []GeoPosition
+
+// GeoPolygon is an outer ring followed by zero or more holes
+type GeoPolygon []GeoRing
+
+// BoundingBox represents an axis-aligned latitude/longitude rectangle
+type BoundingBox struct {
+	MinLat float64 `json:"min_lat"`
+	MinLng float64 `json:"min_lng"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLng float64 `json:"max_lng"`
+}
+
+// rawGeometry mirrors the JSON layout accepted in PolygonData
+type rawGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	BBox        []float64       `json:"bbox"`
+}
+
+// ParseGeofenceGeometry parses and validates GeoJSON-style polygon data
+func ParseGeofenceGeometry(data JSON) (*GeofenceGeometry, error) {
+	if len(data) == 0 {
+		return nil, errors.New("polygon data is required")
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid polygon data: %w", err)
+	}
+
+	var raw rawGeometry
+	if err := json.Unmarshal(encoded, &raw); err != nil {
+		return nil, fmt.Errorf("invalid polygon data: %w", err)
+	}
+
+	geometry := &GeofenceGeometry{}
+
+	if raw.BBox != nil {
+		bbox, err := parseBoundingBox(raw.BBox)
+		if err != nil {
+			return nil, err
+		}
+		geometry.BBox = bbox
+	}
+
+	switch raw.Type {
+	case "Polygon":
+		var polygon GeoPolygon
+		if err := json.Unmarshal(raw.Coordinates, &polygon); err != nil {
+			return nil, fmt.Errorf("invalid Polygon coordinates: %w", err)
+		}
+		geometry.Polygons = []GeoPolygon{polygon}
+	case "MultiPolygon":
+		var polygons []GeoPolygon
+		if err := json.Unmarshal(raw.Coordinates, &polygons); err != nil {
+			return nil, fmt.Errorf("invalid MultiPolygon coordinates: %w", err)
+		}
+		if len(polygons) == 0 {
+			return nil, errors.New("MultiPolygon must contain at least one polygon")
+		}
+		geometry.Polygons = polygons
+	case "":
+		if geometry.BBox == nil {
+			return nil, errors.New("polygon data must have a type of Polygon or MultiPolygon, or a bbox")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q: must be Polygon or MultiPolygon", raw.Type)
+	}
+
+	for i, polygon := range geometry.Polygons {
+		if err := polygon.validate(); err != nil {
+			return nil, fmt.Errorf("polygon %d: %w", i, err)
+		}
+	}
+
+	return geometry, nil
+}
+
+// parseBoundingBox parses a GeoJSON bbox array of [minLng, minLat, maxLng, maxLat]
+func parseBoundingBox(values []float64) (*BoundingBox, error) {
+	if len(values) != 4 {
+		return nil, errors.New("bbox must have exactly 4 values: [minLng, minLat, maxLng, maxLat]")
+	}
+
+	bbox := &BoundingBox{
+		MinLng: values[0],
+		MinLat: values[1],
+		MaxLng: values[2],
+		MaxLat: values[3],
+	}
+
+	if !isValidPosition(GeoPosition{bbox.MinLng, bbox.MinLat}) || !isValidPosition(GeoPosition{bbox.MaxLng, bbox.MaxLat}) {
+		return nil, errors.New("bbox coordinates out of range")
+	}
+	if bbox.MinLat >= bbox.MaxLat || bbox.MinLng >= bbox.MaxLng {
+		return nil, errors.New("bbox minimum must be less than maximum")
+	}
+
+	return bbox, nil
+}
+
+// validate checks ring count, closure, vertex count and coordinate ranges
+func (p GeoPolygon) validate() error {
+	if len(p) == 0 {
+		return errors.New("polygon must have an outer ring")
+	}
+
+	for i, ring := range p {
+		if len(ring) < 4 {
+			return fmt.Errorf("ring %d must have at least 4 positions (3 vertices plus closing position)", i)
+		}
+		if ring[0] != ring[len(ring)-1] {
+			return fmt.Errorf("ring %d is not closed: first and last positions must be equal", i)
+		}
+		for _, position := range ring {
+			if !isValidPosition(position) {
+				return fmt.Errorf("ring %d has out of range position [%g, %g]", i, position.Lng(), position.Lat())
+			}
+		}
+		if math.Abs(ring.signedArea()) == 0 {
+			return fmt.Errorf("ring %d has zero area", i)
+		}
+	}
+
+	return nil
+}
+
+// Contains reports whether the point lies inside the polygon and outside its holes
+func (p GeoPolygon) Contains(lat, lng float64) bool {
+	if len(p) == 0 || !p[0].Contains(lat, lng) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.Contains(lat, lng) {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains reports whether the point lies inside the ring using the even-odd rule
+func (r GeoRing) Contains(lat, lng float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		xi, yi := r[i].Lng(), r[i].Lat()
+		xj, yj := r[j].Lng(), r[j].Lat()
+
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// signedArea returns the planar signed area of the ring in square degrees
+func (r GeoRing) signedArea() float64 {
+	var area float64
+	for i := 0; i < len(r)-1; i++ {
+		area += r[i].Lng()*r[i+1].Lat() - r[i+1].Lng()*r[i].Lat()
+	}
+	return area / 2
+}
+
+// Contains reports whether the point lies inside the bounding box, edges included
+func (b BoundingBox) Contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// Center returns the midpoint of the bounding box
+func (b BoundingBox) Center() (lat, lng float64) {
+	return (b.MinLat + b.MaxLat) / 2, (b.MinLng + b.MaxLng) / 2
+}
+
+// Contains reports whether the point lies inside any of the polygons
+func (g *GeofenceGeometry) Contains(lat, lng float64) bool {
+	for _, polygon := range g.Polygons {
+		if polygon.Contains(lat, lng) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bounds returns the explicit bbox, or the extent of all outer rings
+func (g *GeofenceGeometry) Bounds() BoundingBox {
+	if g.BBox != nil {
+		return *g.BBox
+	}
+
+	bounds := BoundingBox{
+		MinLat: math.Inf(1),
+		MinLng: math.Inf(1),
+		MaxLat: math.Inf(-1),
+		MaxLng: math.Inf(-1),
+	}
+	for _, polygon := range g.Polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		for _, position := range polygon[0] {
+			bounds.MinLat = math.Min(bounds.MinLat, position.Lat())
+			bounds.MaxLat = math.Max(bounds.MaxLat, position.Lat())
+			bounds.MinLng = math.Min(bounds.MinLng, position.Lng())
+			bounds.MaxLng = math.Max(bounds.MaxLng, position.Lng())
+		}
+	}
+	return bounds
+}
+
+// isValidPosition checks longitude and latitude ranges
+func isValidPosition(p GeoPosition) bool {
+	return p.Lng() >= -180 && p.Lng() <= 180 && p.Lat() >= -90 && p.Lat() <= 90
+}
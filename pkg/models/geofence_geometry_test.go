@@ -0,0 +1,227 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// squareRing returns a closed square ring as GeoJSON-style [lng, lat] arrays
+func squareRing(minLng, minLat, maxLng, maxLat float64) []interface{} {
+	return []interface{}{
+		[]interface{}{minLng, minLat},
+		[]interface{}{maxLng, minLat},
+		[]interface{}{maxLng, maxLat},
+		[]interface{}{minLng, maxLat},
+		[]interface{}{minLng, minLat},
+	}
+}
+
+func TestParseGeofenceGeometry(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    JSON
+		wantErr bool
+	}{
+		{
+			name: "valid polygon",
+			data: JSON{
+				"type":        "Polygon",
+				"coordinates": []interface{}{squareRing(106.80, -6.25, 106.90, -6.15)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid multipolygon",
+			data: JSON{
+				"type": "MultiPolygon",
+				"coordinates": []interface{}{
+					[]interface{}{squareRing(106.80, -6.25, 106.90, -6.15)},
+					[]interface{}{squareRing(112.70, -7.30, 112.80, -7.20)},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "valid bbox",
+			data:    JSON{"bbox": []interface{}{106.80, -6.25, 106.90, -6.15}},
+			wantErr: false,
+		},
+		{
+			name:    "empty data",
+			data:    JSON{},
+			wantErr: true,
+		},
+		{
+			name: "unsupported type",
+			data: JSON{
+				"type":        "LineString",
+				"coordinates": []interface{}{[]interface{}{106.8, -6.2}, []interface{}{106.9, -6.1}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unclosed ring",
+			data: JSON{
+				"type": "Polygon",
+				"coordinates": []interface{}{
+					[]interface{}{
+						[]interface{}{106.80, -6.25},
+						[]interface{}{106.90, -6.25},
+						[]interface{}{106.90, -6.15},
+						[]interface{}{106.80, -6.15},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "out of range latitude",
+			data: JSON{
+				"type":        "Polygon",
+				"coordinates": []interface{}{squareRing(106.80, -95, 106.90, -6.15)},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "inverted bbox",
+			data:    JSON{"bbox": []interface{}{106.90, -6.15, 106.80, -6.25}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseGeofenceGeometry(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGeofence_IsPointInside_Polygon(t *testing.T) {
+	// Depot outline with a hole for the public road that crosses it
+	geofence := &Geofence{
+		Shape:    GeofenceShapePolygon,
+		IsActive: true,
+		PolygonData: JSON{
+			"type": "Polygon",
+			"coordinates": []interface{}{
+				squareRing(106.80, -6.25, 106.90, -6.15),
+				squareRing(106.84, -6.21, 106.86, -6.19),
+			},
+		},
+	}
+	require.NoError(t, geofence.ValidateGeometry())
+
+	assert.True(t, geofence.IsPointInside(-6.17, 106.82), "inside outer ring")
+	assert.False(t, geofence.IsPointInside(-6.20, 106.85), "inside hole")
+	assert.False(t, geofence.IsPointInside(-6.30, 106.85), "outside outer ring")
+	assert.InDelta(t, -6.20, geofence.CenterLatitude, 0.0001)
+	assert.InDelta(t, 106.85, geofence.CenterLongitude, 0.0001)
+}
+
+func TestGeofence_IsPointInside_ConcavePolygon(t *testing.T) {
+	// L-shaped yard: the notch at the top right is outside the zone
+	geofence := &Geofence{
+		Shape:    GeofenceShapePolygon,
+		IsActive: true,
+		PolygonData: JSON{
+			"type": "Polygon",
+			"coordinates": []interface{}{
+				[]interface{}{
+					[]interface{}{0.0, 0.0},
+					[]interface{}{2.0, 0.0},
+					[]interface{}{2.0, 1.0},
+					[]interface{}{1.0, 1.0},
+					[]interface{}{1.0, 2.0},
+					[]interface{}{0.0, 2.0},
+					[]interface{}{0.0, 0.0},
+				},
+			},
+		},
+	}
+	require.NoError(t, geofence.ValidateGeometry())
+
+	assert.True(t, geofence.IsPointInside(0.5, 1.5))
+	assert.True(t, geofence.IsPointInside(1.5, 0.5))
+	assert.False(t, geofence.IsPointInside(1.5, 1.5))
+}
+
+func TestGeofence_IsPointInside_MultiPolygon(t *testing.T) {
+	geofence := &Geofence{
+		Shape:    GeofenceShapePolygon,
+		IsActive: true,
+		PolygonData: JSON{
+			"type": "MultiPolygon",
+			"coordinates": []interface{}{
+				[]interface{}{squareRing(106.80, -6.25, 106.90, -6.15)},
+				[]interface{}{squareRing(112.70, -7.30, 112.80, -7.20)},
+			},
+		},
+	}
+	require.NoError(t, geofence.ValidateGeometry())
+
+	assert.True(t, geofence.IsPointInside(-6.20, 106.85), "Jakarta part")
+	assert.True(t, geofence.IsPointInside(-7.25, 112.75), "Surabaya part")
+	assert.False(t, geofence.IsPointInside(-6.97, 110.42), "Semarang")
+}
+
+func TestGeofence_IsPointInside_Rectangle(t *testing.T) {
+	tests := []struct {
+		name string
+		data JSON
+	}{
+		{
+			name: "bbox",
+			data: JSON{"bbox": []interface{}{106.80, -6.25, 106.90, -6.15}},
+		},
+		{
+			name: "polygon bounds",
+			data: JSON{
+				"type":        "Polygon",
+				"coordinates": []interface{}{squareRing(106.80, -6.25, 106.90, -6.15)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			geofence := &Geofence{Shape: GeofenceShapeRectangle, IsActive: true, PolygonData: tt.data}
+			require.NoError(t, geofence.ValidateGeometry())
+
+			assert.True(t, geofence.IsPointInside(-6.20, 106.85))
+			assert.True(t, geofence.IsPointInside(-6.25, 106.80), "edges are inside")
+			assert.False(t, geofence.IsPointInside(-6.20, 106.95))
+		})
+	}
+}
+
+func TestGeofence_ValidateGeometry_Circle(t *testing.T) {
+	geofence := &Geofence{Shape: GeofenceShapeCircle, CenterLatitude: -6.2088, CenterLongitude: 106.8456}
+	assert.Error(t, geofence.ValidateGeometry(), "radius is required")
+
+	geofence.Radius = 500
+	assert.NoError(t, geofence.ValidateGeometry())
+
+	geofence.Shape = "zone"
+	assert.Error(t, geofence.ValidateGeometry(), "unknown shape")
+}
+
+func TestGeofence_JSON_TypeIsPurpose(t *testing.T) {
+	geofence := &Geofence{Shape: GeofenceShapePolygon, Category: GeofencePurposeDelivery}
+
+	data, err := json.Marshal(geofence)
+	require.NoError(t, err)
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, "delivery", fields["type"], "type stays the purpose")
+	assert.Equal(t, "polygon", fields["shape"])
+	assert.NotContains(t, fields, "category")
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification channels
+const (
+	NotificationChannelWhatsApp = "whatsapp"
+	NotificationChannelSMS      = "sms"
+)
+
+// Notification message statuses. Providers report delivery and reads after
+// the message is sent; read is only reported by WhatsApp.
+const (
+	NotificationStatusQueued    = "queued"
+	NotificationStatusSent      = "sent"
+	NotificationStatusDelivered = "delivered"
+	NotificationStatusRead      = "read"
+	NotificationStatusFailed    = "failed"
+)
+
+// NotificationMessage records a WhatsApp or SMS message the system sends,
+// from queueing to its delivery report
+type NotificationMessage struct {
+	ID        string  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CompanyID *string `json:"company_id" gorm:"type:uuid;index"`
+	UserID    *string `json:"user_id" gorm:"type:uuid;index"`   // recipient user, if any
+	DriverID  *string `json:"driver_id" gorm:"type:uuid;index"` // recipient driver, if any
+
+	// Message
+	Channel   string   `json:"channel" gorm:"type:varchar(20);not null"`         // whatsapp, sms
+	Recipient string   `json:"recipient" gorm:"type:varchar(20);not null;index"` // +62 phone number
+	Template  string   `json:"template" gorm:"type:varchar(50)"`
+	Language  string   `json:"language" gorm:"type:varchar(10)"`
+	Params    []string `json:"params" gorm:"type:jsonb;serializer:json"` // WhatsApp template parameters
+	Body      string   `json:"body" gorm:"type:text"`                    // text sent by SMS
+
+	// Delivery
+	Status            string     `json:"status" gorm:"type:varchar(20);not null;default:'queued'"` // queued, sent, delivered, read, failed
+	Attempts          int        `json:"attempts" gorm:"default:0"`
+	LastError         string     `json:"last_error,omitempty" gorm:"type:text"`
+	ProviderMessageID string     `json:"provider_message_id" gorm:"type:varchar(255);index"`
+	SentAt            *time.Time `json:"sent_at"`
+	DeliveredAt       *time.Time `json:"delivered_at"`
+	ReadAt            *time.Time `json:"read_at"`
+	FailedAt          *time.Time `json:"failed_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the NotificationMessage model
+func (NotificationMessage) TableName() string {
+	return "notification_messages"
+}
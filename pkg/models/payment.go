@@ -37,6 +37,11 @@ type Subscription struct {
 	AutoRenew       bool      `json:"auto_renew" gorm:"default:true"`
 	RenewalPeriod   int       `json:"renewal_period" gorm:"default:1"` // months
 	
+	// Cancellation and plan changes
+	CancelAtPeriodEnd bool       `json:"cancel_at_period_end" gorm:"default:false"`
+	CancelledAt       *time.Time `json:"cancelled_at"`
+	CreditBalance     float64    `json:"credit_balance" gorm:"type:decimal(12,2);default:0"` // in IDR, unused value carried to the next invoice
+	
 	// Features
 	Features        JSON      `json:"features" gorm:"type:jsonb"` // Plan features and limits
 	
@@ -67,7 +72,7 @@ type Payment struct {
 	PaymentType    string    `json:"payment_type" gorm:"type:varchar(50);not null"` // subscription, invoice, top_up
 	
 	// Payment Status
-	Status         string    `json:"status" gorm:"type:varchar(20);default:'pending'"` // pending, processing, completed, failed, cancelled, refunded
+	Status         string    `json:"status" gorm:"type:varchar(20);default:'pending'"` // pending, processing, completed, failed, cancelled, expired, refunded
 	
 	// Indonesian Payment Details
 	QRISData       JSON      `json:"qris_data" gorm:"type:jsonb"` // QRIS payment details
@@ -148,6 +153,19 @@ type Invoice struct {
 	Payment      *Payment      `json:"payment,omitempty" gorm:"foreignKey:PaymentID"`
 }
 
+// PaymentWebhookEvent records a processed payment gateway notification so
+// retried deliveries are only applied once
+type PaymentWebhookEvent struct {
+	ID        string     `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Provider  string     `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_payment_webhook_events_provider_event"`
+	EventID   string     `json:"event_id" gorm:"type:varchar(255);not null;uniqueIndex:idx_payment_webhook_events_provider_event"`
+	PaymentID *string    `json:"payment_id" gorm:"type:uuid;index"`
+	Status    string     `json:"status" gorm:"type:varchar(20)"` // notification status: pending, completed, failed, expired
+	Result    string     `json:"result" gorm:"type:varchar(50)"` // what the notification did: settled, failed, expired, ignored
+	Payload   JSON       `json:"payload" gorm:"type:jsonb"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
 // TableName specifies the table name for the Subscription model
 func (Subscription) TableName() string {
 	return "subscriptions"
@@ -163,6 +181,11 @@ func (Invoice) TableName() string {
 	return "invoices"
 }
 
+// TableName specifies the table name for the PaymentWebhookEvent model
+func (PaymentWebhookEvent) TableName() string {
+	return "payment_webhook_events"
+}
+
 // BeforeCreate hook for Subscription
 func (s *Subscription) BeforeCreate(tx *gorm.DB) error {
 	if s.Currency == "" {
@@ -305,6 +328,11 @@ func (p *Payment) FailPayment(reason string) {
 	p.GatewayResponse["failure_reason"] = reason
 }
 
+// ExpirePayment marks a pending payment as expired
+func (p *Payment) ExpirePayment() {
+	p.Status = "expired"
+}
+
 // GetQRISData returns QRIS payment data
 func (p *Payment) GetQRISData() map[string]interface{} {
 	if p.QRISData == nil {
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+)
+
+// Report statuses
+const (
+	ReportStatusPending   = "pending"
+	ReportStatusRunning   = "running"
+	ReportStatusCompleted = "completed"
+	ReportStatusFailed    = "failed"
+)
+
+// Report subscription periods, the span of data each scheduled report covers
+const (
+	ReportPeriodDay   = "day"
+	ReportPeriodWeek  = "week"
+	ReportPeriodMonth = "month"
+)
+
+// Report is a report generated in the background and kept as a file in blob
+// storage, rendered in one of the export formats
+type Report struct {
+	ID             string  `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CompanyID      string  `json:"company_id" gorm:"type:uuid;not null;index"`
+	RequestedBy    *string `json:"requested_by" gorm:"type:uuid;index"`    // owner; nil for reports started by the system
+	SubscriptionID *string `json:"subscription_id" gorm:"type:uuid;index"` // set for scheduled reports
+	RerunOf        *string `json:"rerun_of" gorm:"type:uuid"`              // the report this one re-runs
+
+	// Parameters
+	ReportType  string    `json:"report_type" gorm:"type:varchar(50);not null"`
+	Format      string    `json:"format" gorm:"type:varchar(10);not null"`
+	Title       string    `json:"title" gorm:"type:varchar(255)"`
+	PeriodStart time.Time `json:"period_start" gorm:"not null"`
+	PeriodEnd   time.Time `json:"period_end" gorm:"not null"` // exclusive
+
+	// Result
+	Status      string `json:"status" gorm:"type:varchar(20);not null;default:'pending'"` // pending, running, completed, failed
+	StorageKey  string `json:"-" gorm:"type:varchar(500)"`
+	FileName    string `json:"file_name" gorm:"type:varchar(255)"`
+	ContentType string `json:"content_type" gorm:"type:varchar(100)"`
+	RowCount    int64  `json:"row_count" gorm:"default:0"`
+	FileSize    int64  `json:"file_size" gorm:"default:0"` // bytes
+	Error       string `json:"error,omitempty" gorm:"type:text"`
+
+	// Timestamps
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the Report model
+func (Report) TableName() string {
+	return "reports"
+}
+
+// ReportSubscription generates a report on a recurring schedule and sends it
+// to its recipients, e.g. the fuel report every Monday morning
+type ReportSubscription struct {
+	ID        string `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	CompanyID string `json:"company_id" gorm:"type:uuid;not null;index"`
+	UserID    string `json:"user_id" gorm:"type:uuid;not null;index"` // owner of the generated reports
+
+	Name       string   `json:"name" gorm:"type:varchar(255);not null"`
+	ReportType string   `json:"report_type" gorm:"type:varchar(50);not null"`
+	Format     string   `json:"format" gorm:"type:varchar(10);not null"`
+	Schedule   string   `json:"schedule" gorm:"type:varchar(100);not null"` // cron expression or @-descriptor
+	Timezone   string   `json:"timezone" gorm:"type:varchar(50);not null;default:'Asia/Jakarta'"`
+	Period     string   `json:"period" gorm:"type:varchar(10);not null;default:'week'"` // day, week, month
+	Recipients []string `json:"recipients" gorm:"type:jsonb;serializer:json"`           // emails; the owner when empty
+	IsActive   bool     `json:"is_active" gorm:"default:true"`
+
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastReportID *string    `json:"last_report_id" gorm:"type:uuid"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for the ReportSubscription model
+func (ReportSubscription) TableName() string {
+	return "report_subscriptions"
+}
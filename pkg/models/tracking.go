@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"math"
 	"time"
 
@@ -10,9 +12,10 @@ import (
 // GPSTrack represents GPS tracking data with PostGIS geometry
 type GPSTrack struct {
 	ID        string    `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	VehicleID string    `json:"vehicle_id" gorm:"type:uuid;not null;index"`
+	VehicleID string    `json:"vehicle_id" gorm:"type:uuid;not null;index;uniqueIndex:idx_gps_tracks_vehicle_timestamp"`
 	DriverID  *string   `json:"driver_id" gorm:"type:uuid;index"`
 	TripID    *string   `json:"trip_id" gorm:"type:uuid;index"`
+	DeviceID  *string   `json:"device_id" gorm:"type:uuid;index"` // reporting device, when known
 	
 	// GPS Coordinates with PostGIS
 	Latitude    float64   `json:"latitude" gorm:"type:decimal(10,8);not null"`
@@ -34,7 +37,7 @@ type GPSTrack struct {
 	HDOP        float64   `json:"hdop" gorm:"type:decimal(3,1)"` // Horizontal Dilution of Precision
 	
 	// Vehicle Status
-	IgnitionOn  bool      `json:"ignition_on" gorm:"default:false"`
+	IgnitionOn  *bool     `json:"ignition_on"` // nil when the device does not report ignition
 	EngineOn    bool      `json:"engine_on" gorm:"default:false"`
 	Moving      bool      `json:"moving" gorm:"default:false"`
 	IdleTime    int       `json:"idle_time" gorm:"default:0"` // seconds
@@ -70,7 +73,7 @@ type GPSTrack struct {
 	ProcessedAt time.Time `json:"processed_at"`
 	
 	// Timestamps
-	Timestamp   time.Time `json:"timestamp" gorm:"not null;index"` // GPS timestamp
+	Timestamp   time.Time `json:"timestamp" gorm:"not null;index;uniqueIndex:idx_gps_tracks_vehicle_timestamp"` // GPS timestamp
 	CreatedAt   time.Time `json:"created_at" gorm:"index"`
 
 	// Relationships
@@ -93,6 +96,7 @@ type Trip struct {
 	
 	// Trip Status
 	Status      string    `json:"status" gorm:"type:varchar(20);default:'planned'"` // planned, active, completed, cancelled
+	Detection   string    `json:"detection" gorm:"type:varchar(20);default:'manual'"` // manual (started by the driver), auto (detected from GPS)
 	
 	// Start Information
 	StartLatitude  float64   `json:"start_latitude" gorm:"type:decimal(10,8)"`
@@ -157,26 +161,54 @@ type Geofence struct {
 	
 	Name        string    `json:"name" gorm:"type:varchar(255);not null"`
 	Description string    `json:"description" gorm:"type:text"`
-	Type        string    `json:"type" gorm:"type:varchar(50);not null"` // circle, polygon, rectangle
+	Shape       string    `json:"shape" gorm:"column:type;type:varchar(50);not null"` // circle, polygon, rectangle
+	Category    string    `json:"type" gorm:"type:varchar(50);default:'zone'"` // purpose: zone, pickup, delivery, restricted
 	
 	// Geofence Geometry (PostGIS)
 	CenterLatitude  float64 `json:"center_latitude" gorm:"type:decimal(10,8)"`
 	CenterLongitude float64 `json:"center_longitude" gorm:"type:decimal(11,8)"`
 	Radius          float64 `json:"radius" gorm:"type:decimal(8,2)"` // meters
-	PolygonData     JSON    `json:"polygon_data" gorm:"type:jsonb"` // For complex polygons
+	PolygonData     JSON    `json:"polygon_data" gorm:"type:jsonb"` // GeoJSON Polygon/MultiPolygon or bbox, see GeofenceGeometry
 	
 	// Geofence Settings
 	IsActive        bool    `json:"is_active" gorm:"default:true"`
+	Priority        int     `json:"priority" gorm:"default:5"` // 1-10, higher is more important
+	Color           string  `json:"color" gorm:"type:varchar(7);default:'#FF0000'"` // hex color
 	AlertOnEnter    bool    `json:"alert_on_enter" gorm:"default:true"`
 	AlertOnExit     bool    `json:"alert_on_exit" gorm:"default:true"`
-	SpeedLimit      float64 `json:"speed_limit" gorm:"type:decimal(5,2)"` // km/h
-	
-	// Timestamps
+	AlertOnDwell    bool    `json:"alert_on_dwell"`
+	DwellTime       int     `json:"dwell_time"` // minutes
+	AlertOnSpeed    bool    `json:"alert_on_speed"`
+	SpeedLimit      float64 `json:"speed_limit" gorm:"type:decimal(5,2)"` // km/h, 0 means no limit
+	
+	// Time Restrictions: when set, the vehicle may only be inside during these windows
+	TimeRestrictions []GeofenceTimeRestriction `json:"time_restrictions" gorm:"type:jsonb;serializer:json"`
+	
+	// Vehicle and Driver Restrictions
+	AllowedVehicles    []string `json:"allowed_vehicles" gorm:"type:jsonb;serializer:json"`
+	AllowedDrivers     []string `json:"allowed_drivers" gorm:"type:jsonb;serializer:json"`
+	RestrictedVehicles []string `json:"restricted_vehicles" gorm:"type:jsonb;serializer:json"`
+	RestrictedDrivers  []string `json:"restricted_drivers" gorm:"type:jsonb;serializer:json"`
+	
+	// Metadata
+	CreatedBy *string   `json:"created_by,omitempty" gorm:"type:uuid"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
 	// Relationships
 	Company Company `json:"company,omitempty" gorm:"foreignKey:CompanyID"`
+
+	// geometry caches the parsed PolygonData
+	geometry *GeofenceGeometry
+}
+
+// GeofenceTimeRestriction is a weekly window during which vehicles may be
+// inside a geofence
+type GeofenceTimeRestriction struct {
+	DayOfWeek int    `json:"day_of_week"` // 0=Sunday, 1=Monday, ..., 6=Saturday
+	StartTime string `json:"start_time"`  // HH:MM format
+	EndTime   string `json:"end_time"`    // HH:MM format
+	IsActive  bool   `json:"is_active"`
 }
 
 // TableName specifies the table name for the GPSTrack model
@@ -213,8 +245,11 @@ func (t *Trip) BeforeCreate(_ *gorm.DB) error {
 
 // BeforeCreate hook for Geofence
 func (gf *Geofence) BeforeCreate(_ *gorm.DB) error {
-	if gf.Type == "" {
-		gf.Type = "circle"
+	if gf.Shape == "" {
+		gf.Shape = GeofenceShapeCircle
+	}
+	if gf.Category == "" {
+		gf.Category = GeofencePurposeZone
 	}
 	return nil
 }
@@ -252,9 +287,24 @@ func (g *GPSTrack) CalculateDistance(prevLat, prevLon float64) float64 {
 	return earthRadius * c
 }
 
+// IsIgnitionOn checks if the ignition was on. Fixes without a reported
+// ignition state count as on while the vehicle moves.
+func (g *GPSTrack) IsIgnitionOn() bool {
+	if g.IgnitionOn == nil {
+		return g.Speed > 0
+	}
+	return *g.IgnitionOn
+}
+
+// IsIgnitionReportedOff checks if the device reported the ignition off.
+// Devices without an ignition input never do.
+func (g *GPSTrack) IsIgnitionReportedOff() bool {
+	return g.IgnitionOn != nil && !*g.IgnitionOn
+}
+
 // IsIdling checks if vehicle is idling
 func (g *GPSTrack) IsIdling() bool {
-	return g.Speed < 5 && g.IgnitionOn // Less than 5 km/h and ignition on
+	return g.Speed < 5 && g.IsIgnitionOn() // Less than 5 km/h and ignition on
 }
 
 // IsMoving checks if vehicle is moving
@@ -353,7 +403,7 @@ func (gf *Geofence) IsPointInside(lat, lon float64) bool {
 		return false
 	}
 	
-	switch gf.Type {
+	switch gf.Shape {
 	case "circle":
 		return gf.isPointInCircle(lat, lon)
 	case "polygon":
@@ -385,15 +435,69 @@ func (gf *Geofence) isPointInCircle(lat, lon float64) bool {
 }
 
 // isPointInPolygon checks if point is inside polygon geofence
-func (gf *Geofence) isPointInPolygon(_ float64, _ float64) bool {
-	// Implementation for polygon checking
-	// This would require parsing the polygon data from JSON
-	return false // Placeholder
+func (gf *Geofence) isPointInPolygon(lat, lon float64) bool {
+	geometry, err := gf.Geometry()
+	if err != nil {
+		return false
+	}
+	return geometry.Contains(lat, lon)
 }
 
 // isPointInRectangle checks if point is inside rectangle geofence
-func (gf *Geofence) isPointInRectangle(_ float64, _ float64) bool {
-	// Implementation for rectangle checking
-	// This would require parsing rectangle bounds from polygon data
-	return false // Placeholder
+func (gf *Geofence) isPointInRectangle(lat, lon float64) bool {
+	geometry, err := gf.Geometry()
+	if err != nil {
+		return false
+	}
+	return geometry.Bounds().Contains(lat, lon)
+}
+
+// Geometry returns the parsed polygon data, parsing it on first use
+func (gf *Geofence) Geometry() (*GeofenceGeometry, error) {
+	if gf.geometry != nil {
+		return gf.geometry, nil
+	}
+
+	geometry, err := ParseGeofenceGeometry(gf.PolygonData)
+	if err != nil {
+		return nil, err
+	}
+	gf.geometry = geometry
+	return geometry, nil
+}
+
+// ValidateGeometry validates the shape definition and fills in the center point
+// for polygon and rectangle geofences
+func (gf *Geofence) ValidateGeometry() error {
+	gf.geometry = nil
+
+	switch gf.Shape {
+	case GeofenceShapeCircle:
+		if gf.CenterLatitude < -90 || gf.CenterLatitude > 90 || gf.CenterLongitude < -180 || gf.CenterLongitude > 180 {
+			return errors.New("circle center coordinates out of range")
+		}
+		if gf.Radius <= 0 {
+			return errors.New("circle radius must be greater than zero")
+		}
+		return nil
+	case GeofenceShapePolygon:
+		geometry, err := gf.Geometry()
+		if err != nil {
+			return err
+		}
+		if len(geometry.Polygons) == 0 {
+			return errors.New("polygon geofence requires Polygon or MultiPolygon coordinates")
+		}
+		gf.CenterLatitude, gf.CenterLongitude = geometry.Bounds().Center()
+		return nil
+	case GeofenceShapeRectangle:
+		geometry, err := gf.Geometry()
+		if err != nil {
+			return err
+		}
+		gf.CenterLatitude, gf.CenterLongitude = geometry.Bounds().Center()
+		return nil
+	default:
+		return fmt.Errorf("unsupported geofence shape %q: must be circle, polygon or rectangle", gf.Shape)
+	}
 }
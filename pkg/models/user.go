@@ -52,6 +52,8 @@ type User struct {
 	// Security
 	TwoFactorEnabled bool      `json:"two_factor_enabled" gorm:"default:false"`
 	TwoFactorSecret  string    `json:"-" gorm:"type:varchar(255)"` // Hidden from JSON
+	TwoFactorRecoveryCodes string `json:"-" gorm:"type:text"`     // Comma-separated SHA-256 hashes of unused recovery codes
+	TwoFactorLastStep int64    `json:"-" gorm:"default:0"`          // Last accepted TOTP time step, prevents code replay
 	PasswordChangedAt time.Time `json:"password_changed_at"`
 	
 	// Invite-Only System (Force password change on first login)
@@ -52,6 +52,9 @@ type Vehicle struct {
 	LastLongitude   float64   `json:"last_longitude" gorm:"type:decimal(11,8)"`
 	LastLocation    string    `json:"last_location" gorm:"type:varchar(255)"`
 	LastUpdatedAt   *time.Time `json:"last_updated_at"`
+	ConnectionStatus string    `json:"connection_status" gorm:"type:varchar(20);default:'online'"` // online, offline
+	OfflineSince     *time.Time `json:"offline_since,omitempty"`
+	OfflineReason    string    `json:"offline_reason,omitempty" gorm:"type:varchar(20)"` // ignition_off, signal_lost, unknown
 	
 	// Fuel Information
 	CurrentFuelLevel float64 `json:"current_fuel_level" gorm:"type:decimal(5,2)"`    // in liters
@@ -128,6 +128,8 @@ func generateRouteGPSTracks(vehicleID string, route []struct{ lat, lon float64;
 				// Calculate heading (bearing)
 				heading := calculateBearing(start.lat, start.lon, end.lat, end.lon)
 				
+				// Seeded routes are driven by hardwired trackers reporting ignition
+				ignitionOn := true
 				track := models.GPSTrack{
 					VehicleID: vehicleID,
 					Latitude:  lat,
@@ -138,7 +140,7 @@ func generateRouteGPSTracks(vehicleID string, route []struct{ lat, lon float64;
 					Location:  getLocationName(i, start.name, end.name),
 					Accuracy:  RandomFloat(3.0, 15.0),
 					Satellites: 8 + int(RandomFloat(0, 5)),
-					IgnitionOn: true,
+					IgnitionOn: &ignitionOn,
 					EngineOn:   true,
 					Moving:     speed > 5.0,
 					FuelLevel:  RandomFloat(30.0, 90.0),